@@ -0,0 +1,126 @@
+// cmd/blob-server/main.go
+//
+// A local stand-in for an S3-compatible object store, to try the s3 file
+// backend without MinIO or AWS:
+//
+//	go run ./cmd/blob-server -addr 127.0.0.1:9100 -dir ./data/blobs
+//	go run ./cmd/blob-server -access-key dev -secret-key devsecret   # check request signatures
+//
+// It answers path-style PUT, GET, HEAD and DELETE on /{bucket}/{key},
+// keeping each bucket in a directory under -dir, and logs every request.
+// Given -access-key and -secret-key it checks the Signature Version 4 of
+// each request, answering 403 when it does not match. Configure
+// files.backend: s3 with files.s3.endpoint: http://127.0.0.1:9100.
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"yourapp/internal/files"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9100", "listen address")
+	dir := flag.String("dir", "./data/blobs", "directory the buckets are kept in")
+	accessKey := flag.String("access-key", "", "access key of signed requests; skip verification when empty")
+	secretKey := flag.String("secret-key", "", "secret key of signed requests")
+	flag.Parse()
+
+	log.Printf("blob server on http://%s, buckets in %s", *addr, *dir)
+	log.Fatal(http.ListenAndServe(*addr, handler(files.LocalStore{Dir: *dir}, *accessKey, *secretKey)))
+}
+
+// handler serves the buckets kept in store, checking request signatures
+// when accessKey is set.
+func handler(store files.LocalStore, accessKey, secretKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if bucket, _, ok := strings.Cut(key, "/"); !ok || bucket == "" {
+			log.Printf("%s %s -> 400", r.Method, r.URL.Path)
+			http.Error(w, "path must be /{bucket}/{key}", http.StatusBadRequest)
+			return
+		}
+		if accessKey != "" && !verify(r, accessKey, secretKey) {
+			log.Printf("%s %s signature mismatch -> 403", r.Method, r.URL.Path)
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+
+		status := http.StatusOK
+		switch r.Method {
+		case http.MethodPut:
+			if err := store.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+				log.Printf("PUT %s: %v", key, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case http.MethodGet, http.MethodHead:
+			body, err := store.Get(r.Context(), key)
+			if errors.Is(err, files.ErrNotFound) {
+				log.Printf("%s %s -> 404", r.Method, key)
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("%s %s: %v", r.Method, key, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer body.Close()
+			if f, ok := body.(*os.File); ok {
+				if st, err := f.Stat(); err == nil {
+					w.Header().Set("Content-Length", strconv.FormatInt(st.Size(), 10))
+				}
+			}
+			if r.Method == http.MethodGet {
+				w.WriteHeader(status)
+				n, _ := io.Copy(w, body)
+				log.Printf("GET %s -> %d (%d bytes)", key, status, n)
+				return
+			}
+		case http.MethodDelete:
+			if err := store.Delete(r.Context(), key); err != nil {
+				log.Printf("DELETE %s: %v", key, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status = http.StatusNoContent
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		log.Printf("%s %s -> %d", r.Method, key, status)
+		w.WriteHeader(status)
+	}
+}
+
+// verify checks the Signature Version 4 Authorization header of a request:
+// AWS4-HMAC-SHA256 Credential=<key>/<date>/<region>/s3/aws4_request,
+// SignedHeaders=<h1;h2>, Signature=<hex>.
+func verify(r *http.Request, accessKey, secretKey string) bool {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return false
+	}
+	fields := map[string]string{}
+	for _, f := range strings.Split(auth, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(f), "="); ok {
+			fields[k] = v
+		}
+	}
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[0] != accessKey {
+		return false
+	}
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	sig := files.S3Signature(r, secretKey, scope[2], signed)
+	return sig != "" && subtle.ConstantTimeCompare([]byte(sig), []byte(fields["Signature"])) == 1
+}
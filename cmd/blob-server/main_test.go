@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/files"
+)
+
+// quiet discards the request log for the rest of the test.
+func quiet(t *testing.T) {
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(w) })
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	quiet(t)
+	srv := httptest.NewServer(handler(files.LocalStore{Dir: t.TempDir()}, "dev", "devsecret"))
+	defer srv.Close()
+	store := files.S3Store{Endpoint: srv.URL + "/", Bucket: "blobs", AccessKey: "dev", SecretKey: "devsecret", Client: srv.Client()}
+	ctx := context.Background()
+
+	for _, key := range []string{"org/3f2a", "org/3f2a.thumb", "org/a b+c~é.txt"} {
+		body := "content of " + key
+		if err := store.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+		r, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != body {
+			t.Errorf("Get(%q) = %q, want %q", key, got, body)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete(%q): %v", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, files.ErrNotFound) {
+			t.Errorf("Get(%q) after Delete error = %v, want ErrNotFound", key, err)
+		}
+	}
+	if err := store.Delete(ctx, "org/missing"); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	quiet(t)
+	srv := httptest.NewServer(handler(files.LocalStore{Dir: t.TempDir()}, "dev", "devsecret"))
+	defer srv.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		accessKey string
+		secretKey string
+	}{
+		{"wrong secret key", "dev", "guess"},
+		{"wrong access key", "prod", "devsecret"},
+	}
+	for _, tt := range tests {
+		store := files.S3Store{Endpoint: srv.URL, Bucket: "blobs", AccessKey: tt.accessKey, SecretKey: tt.secretKey, Client: srv.Client()}
+		err := store.Put(ctx, "org/x", strings.NewReader("x"), 1, "text/plain")
+		if err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("%s: Put error = %v, want 403", tt.name, err)
+		}
+	}
+
+	// A signed request replayed to another key, and one without a signature
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/blobs/org/x", nil)
+	files.SignS3(req, "dev", "devsecret", "us-east-1", "UNSIGNED-PAYLOAD", time.Now())
+	req.URL.Path = "/blobs/org/y"
+	if verify(req, "dev", "devsecret") {
+		t.Error("verify accepted a signature of another key")
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/blobs/org/x", nil)
+	if verify(req, "dev", "devsecret") {
+		t.Error("verify accepted an unsigned request")
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=dev/20260101, SignedHeaders=host, Signature=00")
+	if verify(req, "dev", "devsecret") {
+		t.Error("verify accepted a malformed credential")
+	}
+}
@@ -0,0 +1,87 @@
+// cmd/provision/main.go
+//
+// Provision built-in table templates into an existing org:
+//
+//	go run ./cmd/provision -org acme                  # default CMMS set
+//	go run ./cmd/provision -org acme assets parts     # specific templates/sets
+//	go run ./cmd/provision -list
+//
+// The database URL comes from -db or DATABASE_URL. Re-running is safe and
+// upgrades the org when a template version adds columns.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"yourapp/internal/repo"
+	"yourapp/internal/templates"
+)
+
+func main() {
+	dbURL := flag.String("db", os.Getenv("DATABASE_URL"), "Postgres connection URL")
+	orgSlug := flag.String("org", "", "slug of the org to provision into")
+	list := flag.Bool("list", false, "list templates and sets, then exit")
+	flag.Parse()
+
+	if *list {
+		for _, s := range templates.Sets() {
+			fmt.Printf("set %-14s %s\n", s.Name, strings.Join(s.Templates, ", "))
+		}
+		for _, t := range templates.All() {
+			fmt.Printf("    %-14s v%d  %s\n", t.Name, t.Version, t.Title)
+		}
+		return
+	}
+	if *orgSlug == "" || *dbURL == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	names := flag.Args()
+	if len(names) == 0 {
+		names = []string{templates.DefaultSet}
+	}
+	if _, err := templates.Resolve(names...); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, *dbURL)
+	if err != nil {
+		log.Fatal("db connect: ", err)
+	}
+	defer pool.Close()
+	r := repo.New(pool)
+
+	org, err := r.FindOrgBySlug(ctx, *orgSlug)
+	if err != nil {
+		log.Fatalf("org %q: %v", *orgSlug, err)
+	}
+	results, err := templates.Provision(ctx, r, org.ID, names...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, res := range results {
+		state := "up to date"
+		switch {
+		case res.TableCreated:
+			state = "created"
+		case len(res.ColumnsAdded) > 0:
+			state = "upgraded"
+		}
+		fmt.Printf("%-14s v%d  %-10s table=%s", res.Template, res.Version, state, res.Table.Slug)
+		if len(res.ColumnsAdded) > 0 && !res.TableCreated {
+			fmt.Printf("  added=%s", strings.Join(res.ColumnsAdded, ","))
+		}
+		fmt.Println()
+		for _, c := range res.Conflicts {
+			fmt.Printf("    conflict: %s\n", c)
+		}
+	}
+}
@@ -16,14 +16,20 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"yourapp/internal/auth"
+	"yourapp/internal/automations"
 	"yourapp/internal/config"
-	db "yourapp/internal/db/gen"
+	"yourapp/internal/files"
 	"yourapp/internal/handlers"
 	"yourapp/internal/logging"
+	"yourapp/internal/mail"
 	"yourapp/internal/middleware"
 	"yourapp/internal/models"
+	"yourapp/internal/pm"
 	"yourapp/internal/repo"
+	"yourapp/internal/requests"
 	"yourapp/internal/session"
+	"yourapp/internal/stream"
+	"yourapp/internal/webhooks"
 )
 
 func main() {
@@ -63,8 +69,75 @@ func main() {
 	slog.Debug("database connection ready")
 
 	// sqlc queries + repo wrapper
-	q := db.New(pool)
-	r := repo.New(q)
+	r := repo.New(pool)
+
+	// --- Webhook delivery from the outbox ---
+	if cfg.Webhooks.Enabled {
+		d := webhooks.NewDispatcher(r, webhooks.Options{
+			PollInterval: cfg.Webhooks.PollInterval,
+			Timeout:      cfg.Webhooks.Timeout,
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		})
+		go d.Run(ctx)
+	}
+
+	// --- Async automation runs ---
+	if cfg.Automations.Enabled {
+		ar := automations.NewRunner(r, automations.Options{
+			PollInterval: cfg.Automations.PollInterval,
+			MaxAttempts:  cfg.Automations.MaxAttempts,
+		})
+		go ar.Run(ctx)
+	}
+
+	// --- Work orders from PM schedules ---
+	if cfg.PM.Enabled {
+		ps := pm.NewScheduler(r, pm.Options{
+			PollInterval: cfg.PM.PollInterval,
+			ScanInterval: cfg.PM.ScanInterval,
+		})
+		go ps.Run(ctx)
+	}
+
+	// --- Email from the mail outbox ---
+	if cfg.Mail.Enabled {
+		var sender mail.Sender = mail.LogSender{}
+		if cfg.Mail.SMTPAddr != "" {
+			sender = mail.SMTPSender{
+				Addr:     cfg.Mail.SMTPAddr,
+				From:     cfg.Mail.From,
+				Username: cfg.Mail.Username,
+				Password: cfg.Mail.Password,
+			}
+		}
+		m := mail.NewMailer(r, sender, mail.Options{
+			PollInterval: cfg.Mail.PollInterval,
+			MaxAttempts:  cfg.Mail.MaxAttempts,
+		})
+		go m.Run(ctx)
+	}
+
+	// --- Uploaded files ---
+	var store files.Store = files.LocalStore{Dir: cfg.Files.Dir}
+	if cfg.Files.Backend == "s3" {
+		store = files.S3Store{
+			Endpoint:  cfg.Files.S3.Endpoint,
+			Region:    cfg.Files.S3.Region,
+			Bucket:    cfg.Files.S3.Bucket,
+			AccessKey: cfg.Files.S3.AccessKey,
+			SecretKey: cfg.Files.S3.SecretKey,
+		}
+	}
+	fs := files.NewService(r, store, files.Options{
+		MaxSize: cfg.Files.MaxSize,
+		Secret:  []byte(cfg.Files.URLSecret),
+		URLTTL:  cfg.Files.URLTTL,
+		BaseURL: cfg.BaseURL,
+	})
+
+	// --- Live row event streams ---
+	hub := stream.NewHub(pool)
+	go hub.Run(ctx)
 
 	// --- Setup OAuth/OIDC providers ---
 	providers := auth.SetupProviders(cfg)
@@ -136,7 +209,13 @@ func main() {
 	})
 
 	// Work orders and tasks routes
-	handlers.RegisterRoutes(mux, r)
+	captcha := requests.Captcha{
+		VerifyURL: cfg.Portal.Captcha.VerifyURL,
+		SiteKey:   cfg.Portal.Captcha.SiteKey,
+		Secret:    cfg.Portal.Captcha.Secret,
+	}
+	portalLimit := middleware.RateLimitWith(cfg.Portal.RateLimit.RequestsPerMinute, cfg.Portal.RateLimit.Burst, cfg.Portal.RateLimit.TTL)
+	handlers.RegisterRoutes(mux, r, hub, fs, captcha, portalLimit)
 
 	// Serve static files from ./static at /static/*
 	mux.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
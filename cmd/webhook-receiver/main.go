@@ -0,0 +1,74 @@
+// cmd/webhook-receiver/main.go
+//
+// A local stand-in for a webhook endpoint, to try webhooks without the real
+// integration:
+//
+//	go run ./cmd/webhook-receiver -addr 127.0.0.1:9000 -secret whsec_...
+//	go run ./cmd/webhook-receiver -fail 3        # answer 503 to the first 3 requests
+//	go run ./cmd/webhook-receiver -status 500    # always fail, to fill the dead-letter queue
+//
+// It logs every delivery with its headers and JSON body and, given -secret,
+// checks the signature (answering 401 when it does not match). Point a
+// webhook at http://127.0.0.1:9000/ and use POST /webhooks/{id}/ping.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"yourapp/internal/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "listen address")
+	secret := flag.String("secret", "", "signing secret of the webhook; skip verification when empty")
+	status := flag.Int("status", http.StatusOK, "status to answer once -fail is used up")
+	fail := flag.Int64("fail", 0, "answer 503 to this many requests first, to exercise retries")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "maximum age of the signed timestamp")
+	flag.Parse()
+
+	var seen atomic.Int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := seen.Add(1)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+		if err != nil {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		log.Printf("#%d %s %s event=%s delivery=%s webhook=%s", n, r.Method, r.URL.Path,
+			r.Header.Get(webhooks.HeaderEvent), r.Header.Get(webhooks.HeaderDelivery), r.Header.Get(webhooks.HeaderWebhook))
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "  ", "  ") == nil {
+			log.Printf("  %s", pretty.String())
+		} else {
+			log.Printf("  %q", body)
+		}
+
+		if *secret != "" {
+			ts, sig := r.Header.Get(webhooks.HeaderTimestamp), r.Header.Get(webhooks.HeaderSignature)
+			if !webhooks.Verify(*secret, ts, sig, body, *tolerance) {
+				log.Printf("  signature mismatch -> 401")
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			log.Printf("  signature ok")
+		}
+		code := *status
+		if n <= *fail {
+			code = http.StatusServiceUnavailable
+		}
+		log.Printf("  -> %d", code)
+		w.WriteHeader(code)
+	}
+
+	log.Printf("webhook receiver listening on http://%s/", *addr)
+	if err := http.ListenAndServe(*addr, http.HandlerFunc(handler)); err != nil {
+		log.Fatal(err)
+	}
+}
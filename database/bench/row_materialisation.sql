@@ -0,0 +1,202 @@
+-- Benchmark: per-row app.row_to_json against set-based app.rows_to_json (028).
+--
+-- Seeds a work order table (text, enum, float, date, bool, uuid reference and
+-- a computed column) with a parent table carrying a rollup, then times:
+--
+--   page       compose one search page of 10 rows
+--   search     filter + sort + page, the way SearchUserTable did it before 028
+--              (compose every filtered row, then sort) and the way it does now
+--              (sort on one cell, compose the page)
+--   full       compose every row of the table
+--   rollup     compose the children of one parent for a rollup refresh
+--
+-- and checks that both paths return the same JSON. Run against a fully
+-- migrated database; everything is rolled back at the end:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -v rows=50000 -f database/bench/row_materialisation.sql
+-- rows defaults to 50000 and iterations (runs averaged per case) to 3.
+
+\if :{?rows}
+\else
+  \set rows 50000
+\endif
+\if :{?iterations}
+\else
+  \set iterations 3
+\endif
+
+BEGIN;
+
+SELECT set_config('bench.rows', :'rows', true),
+       set_config('bench.iterations', :'iterations', true);
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000b1', 'bench-rows', 'Row materialisation bench');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000b1', true);
+
+DO $$
+DECLARE
+  n_rows  int := current_setting('bench.rows')::int;
+  n_sites int := GREATEST(1, current_setting('bench.rows')::int / 100);
+  sites   bigint;
+  orders  bigint;
+  c_title bigint;
+  c_stat  bigint;
+  c_hours bigint;
+  c_due   bigint;
+  c_done  bigint;
+  c_site  bigint;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Bench Sites', 'bench-sites') RETURNING id INTO sites;
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Bench Orders', 'bench-orders') RETURNING id INTO orders;
+
+  INSERT INTO app.columns (table_id, name, type) VALUES (sites, 'name', 'text');
+  INSERT INTO app.columns (table_id, name, type, is_indexed) VALUES (orders, 'title', 'text', true) RETURNING id INTO c_title;
+  INSERT INTO app.columns (table_id, name, type, enum_values)
+  VALUES (orders, 'status', 'enum', ARRAY['OPEN', 'IN_PROGRESS', 'DONE']) RETURNING id INTO c_stat;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'hours', 'float') RETURNING id INTO c_hours;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'due', 'date') RETURNING id INTO c_due;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'billable', 'bool') RETURNING id INTO c_done;
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (orders, 'site', 'uuid', true, sites) RETURNING id INTO c_site;
+  INSERT INTO app.columns (table_id, name, type, kind, expression_sql)
+  VALUES (orders, 'minutes', 'float', 'computed', '((d->>''hours'')::float8 * (60::float8))');
+
+  CREATE TEMP TABLE bench_sites ON COMMIT DROP AS
+  SELECT gen_random_uuid() AS id, g FROM generate_series(1, n_sites) g;
+  INSERT INTO app.rows (id, table_id) SELECT id, sites FROM bench_sites;
+  INSERT INTO app.values_text (row_id, column_id, value)
+  SELECT s.id, c.id, 'Site ' || s.g FROM bench_sites s JOIN app.columns c ON c.table_id = sites;
+
+  CREATE TEMP TABLE bench_orders ON COMMIT DROP AS
+  SELECT gen_random_uuid() AS id, g FROM generate_series(1, n_rows) g;
+  INSERT INTO app.rows (id, table_id, created_at)
+  SELECT id, orders, now() - g * interval '1 minute' FROM bench_orders;
+  INSERT INTO app.values_text (row_id, column_id, value)
+  SELECT id, c_title, 'Work order ' || g FROM bench_orders;
+  INSERT INTO app.values_enum (row_id, column_id, value)
+  SELECT id, c_stat, (ARRAY['OPEN', 'IN_PROGRESS', 'DONE'])[1 + g % 3] FROM bench_orders;
+  INSERT INTO app.values_float (row_id, column_id, value)
+  SELECT id, c_hours, round((random() * 40)::numeric, 2) FROM bench_orders;
+  INSERT INTO app.values_date (row_id, column_id, value)
+  SELECT id, c_due, current_date + g % 365 FROM bench_orders WHERE g % 4 <> 0;
+  INSERT INTO app.values_bool (row_id, column_id, value)
+  SELECT id, c_done, g % 2 = 0 FROM bench_orders;
+  INSERT INTO app.values_uuid (row_id, column_id, value)
+  SELECT o.id, c_site, s.id FROM bench_orders o JOIN bench_sites s ON s.g = 1 + o.g % n_sites;
+
+  -- Added after seeding so the inserts above do not refresh it row by row
+  INSERT INTO app.columns (table_id, name, type, kind, rollup_via_column_id, rollup_aggregate)
+  VALUES (sites, 'open_orders', 'float', 'rollup', c_site, 'count');
+  INSERT INTO app.rollup_values (row_id, column_id, value)
+  SELECT s.id, c.id, app.compute_rollup(c.id, s.id)
+  FROM bench_sites s JOIN app.columns c ON c.table_id = sites AND c.kind = 'rollup';
+
+  ANALYZE app.rows, app.values_text, app.values_enum, app.values_float,
+          app.values_date, app.values_bool, app.values_uuid, app.rollup_values;
+END$$;
+
+DO $$
+DECLARE
+  iterations int := current_setting('bench.iterations')::int;
+  orders  bigint := (SELECT id FROM app.tables WHERE slug = 'bench-orders');
+  sites   bigint := (SELECT id FROM app.tables WHERE slug = 'bench-sites');
+  via     bigint := (SELECT id FROM app.columns WHERE table_id = orders AND name = 'site');
+  hours   bigint := (SELECT id FROM app.columns WHERE table_id = orders AND name = 'hours');
+  stat    bigint := (SELECT id FROM app.columns WHERE table_id = orders AND name = 'status');
+  parent  uuid   := (SELECT id FROM app.rows WHERE table_id = sites ORDER BY created_at, id LIMIT 1);
+  page    uuid[];
+  per_row jsonb;
+  set_row jsonb;
+  started timestamptz;
+  t_old   float8;
+  t_new   float8;
+  i       int;
+BEGIN
+  page := ARRAY(SELECT id FROM app.rows WHERE table_id = orders ORDER BY created_at DESC LIMIT 10);
+
+  -- page
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    SELECT jsonb_agg(app.row_to_json(id) ORDER BY id) INTO per_row FROM unnest(page) id;
+  END LOOP;
+  t_old := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    SELECT jsonb_agg(j.data ORDER BY j.row_id) INTO set_row FROM app.rows_to_json(orders, page) j;
+  END LOOP;
+  t_new := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  IF per_row IS DISTINCT FROM set_row THEN RAISE EXCEPTION 'page: JSON differs'; END IF;
+  RAISE NOTICE 'page     row_to_json % ms   rows_to_json % ms', round(t_old::numeric, 1), round(t_new::numeric, 1);
+
+  -- search: status = OPEN, sorted by hours desc, first page
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    SELECT jsonb_agg(f.data ORDER BY f.k DESC NULLS LAST, f.created_at DESC) INTO per_row
+    FROM (
+      SELECT d.data, d.created_at, NULLIF(d.data -> 'hours', 'null'::jsonb) AS k
+      FROM (
+        SELECT r.created_at, app.row_to_json(r.id) AS data, COUNT(*) OVER () AS total_count
+        FROM app.rows r
+        WHERE r.table_id = orders
+          AND EXISTS (SELECT 1 FROM app.values_enum ve
+                      WHERE ve.row_id = r.id AND ve.column_id = stat AND ve.value = 'OPEN')
+      ) d
+      ORDER BY k DESC NULLS LAST, d.created_at DESC
+      LIMIT 10
+    ) f;
+  END LOOP;
+  t_old := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    WITH filtered AS (
+      SELECT r.id, r.created_at, NULLIF(app.cell_value(r.id, hours), 'null'::jsonb) AS k,
+             COUNT(*) OVER () AS total_count
+      FROM app.rows r
+      WHERE r.table_id = orders
+        AND EXISTS (SELECT 1 FROM app.values_enum ve
+                    WHERE ve.row_id = r.id AND ve.column_id = stat AND ve.value = 'OPEN')
+    ),
+    ids AS (
+      SELECT f.id, f.created_at, f.k FROM filtered f
+      ORDER BY f.k DESC NULLS LAST, f.created_at DESC
+      LIMIT 10
+    )
+    SELECT jsonb_agg(j.data ORDER BY p.k DESC NULLS LAST, p.created_at DESC) INTO set_row
+    FROM ids p
+    JOIN app.rows_to_json(orders, ARRAY(SELECT id FROM ids)) j ON j.row_id = p.id;
+  END LOOP;
+  t_new := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  IF per_row IS DISTINCT FROM set_row THEN RAISE EXCEPTION 'search: pages differ'; END IF;
+  RAISE NOTICE 'search   row_to_json % ms   rows_to_json % ms', round(t_old::numeric, 1), round(t_new::numeric, 1);
+
+  -- full
+  started := clock_timestamp();
+  SELECT jsonb_agg(app.row_to_json(r.id) ORDER BY r.id) INTO per_row FROM app.rows r WHERE r.table_id = orders;
+  t_old := extract(epoch FROM clock_timestamp() - started) * 1000;
+  started := clock_timestamp();
+  SELECT jsonb_agg(j.data ORDER BY j.row_id) INTO set_row
+  FROM app.rows_to_json(orders, ARRAY(SELECT id FROM app.rows WHERE table_id = orders)) j;
+  t_new := extract(epoch FROM clock_timestamp() - started) * 1000;
+  IF per_row IS DISTINCT FROM set_row THEN RAISE EXCEPTION 'full: JSON differs'; END IF;
+  RAISE NOTICE 'full     row_to_json % ms   rows_to_json % ms', round(t_old::numeric, 1), round(t_new::numeric, 1);
+
+  -- rollup
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    SELECT jsonb_agg(app.row_to_json(c.id) ORDER BY c.id) INTO per_row
+    FROM app.referencing_rows(via, parent) c(id);
+  END LOOP;
+  t_old := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  started := clock_timestamp();
+  FOR i IN 1..iterations LOOP
+    SELECT jsonb_agg(j.data ORDER BY j.row_id) INTO set_row
+    FROM app.rows_to_json(orders, ARRAY(SELECT app.referencing_rows(via, parent))) j;
+  END LOOP;
+  t_new := extract(epoch FROM clock_timestamp() - started) * 1000 / iterations;
+  IF per_row IS DISTINCT FROM set_row THEN RAISE EXCEPTION 'rollup: JSON differs'; END IF;
+  RAISE NOTICE 'rollup   row_to_json % ms   rows_to_json % ms', round(t_old::numeric, 1), round(t_new::numeric, 1);
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,257 @@
+-- name: ListAutomations :many
+SELECT a.id,
+       a.name,
+       a.table_id,
+       t.slug AS table_slug,
+       a.trigger,
+       a.trigger_field,
+       a.trigger_to,
+       a.condition_expression,
+       a.actions,
+       a.refs,
+       a.mode,
+       a.active,
+       a.created_at,
+       a.updated_at
+FROM app.automations a
+JOIN app.tables t ON t.id = a.table_id
+WHERE a.org_id = sqlc.arg(org_id)::uuid
+ORDER BY t.slug, a.created_at, a.id;
+
+-- name: GetAutomation :one
+SELECT a.id,
+       a.name,
+       a.table_id,
+       t.slug AS table_slug,
+       a.trigger,
+       a.trigger_field,
+       a.trigger_to,
+       a.condition_expression,
+       a.actions,
+       a.refs,
+       a.mode,
+       a.active,
+       a.created_at,
+       a.updated_at
+FROM app.automations a
+JOIN app.tables t ON t.id = a.table_id
+WHERE a.id = sqlc.arg(id)::uuid
+  AND a.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertAutomation :one
+INSERT INTO app.automations (
+  org_id, table_id, name, trigger, trigger_field, trigger_to,
+  condition_expression, condition_sql, actions, refs, mode, active
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(table_id)::bigint,
+  sqlc.arg(name)::text,
+  sqlc.arg(trigger)::text,
+  sqlc.narg(trigger_field)::text,
+  sqlc.narg(trigger_to)::text,
+  sqlc.narg(condition_expression)::text,
+  sqlc.narg(condition_sql)::text,
+  sqlc.arg(actions)::jsonb,
+  sqlc.arg(refs)::text[],
+  sqlc.arg(mode)::text,
+  sqlc.arg(active)::boolean
+)
+RETURNING id;
+
+-- name: UpdateAutomation :execrows
+UPDATE app.automations
+SET table_id = sqlc.arg(table_id)::bigint,
+    name = sqlc.arg(name)::text,
+    trigger = sqlc.arg(trigger)::text,
+    trigger_field = sqlc.narg(trigger_field)::text,
+    trigger_to = sqlc.narg(trigger_to)::text,
+    condition_expression = sqlc.narg(condition_expression)::text,
+    condition_sql = sqlc.narg(condition_sql)::text,
+    actions = sqlc.arg(actions)::jsonb,
+    refs = sqlc.arg(refs)::text[],
+    mode = sqlc.arg(mode)::text,
+    active = sqlc.arg(active)::boolean,
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: DeleteAutomation :execrows
+DELETE FROM app.automations
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: AutomationsUsingColumn :many
+SELECT a.name
+FROM app.automations a
+WHERE a.org_id = sqlc.arg(org_id)::uuid
+  AND sqlc.arg(table_id)::bigint::text || '.' || lower(sqlc.arg(column_name)::text) = ANY(a.refs)
+ORDER BY a.created_at, a.id;
+
+-- name: AutomationsUsingTable :many
+SELECT a.name
+FROM app.automations a
+WHERE a.org_id = sqlc.arg(org_id)::uuid
+  AND a.table_id <> sqlc.arg(table_id)::bigint
+  AND EXISTS (
+    SELECT 1 FROM unnest(a.refs) ref
+    WHERE ref LIKE sqlc.arg(table_id)::bigint::text || '.%'
+  )
+ORDER BY a.created_at, a.id;
+
+-- name: MatchAutomations :many
+SELECT m.id,
+       m.name,
+       m.table_id,
+       t.slug AS table_slug,
+       m.actions,
+       m.mode
+FROM app.match_automations(sqlc.arg(event_id)::bigint) m
+JOIN app.tables t ON t.id = m.table_id;
+
+-- name: EvalAutomationValues :one
+SELECT app.eval_automation_values(
+  sqlc.arg(event_id)::bigint,
+  sqlc.arg(exprs)::jsonb
+) AS values;
+
+-- name: SetActingUser :exec
+SELECT set_config('app.user_id', sqlc.arg(user_id)::text, true);
+
+-- name: InsertAutomationRun :one
+INSERT INTO app.automation_runs (
+  org_id, automation_id, event_id, row_id, mode, status, depth, error, finished_at
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(automation_id)::uuid,
+  sqlc.narg(event_id)::bigint,
+  sqlc.narg(row_id)::uuid,
+  sqlc.arg(mode)::text,
+  sqlc.arg(status)::text,
+  sqlc.arg(depth)::int,
+  sqlc.narg(error)::text,
+  CASE WHEN sqlc.arg(status)::text <> 'pending' THEN now() END
+)
+RETURNING id;
+
+-- name: FinishAutomationRun :exec
+UPDATE app.automation_runs
+SET status = sqlc.arg(status)::text,
+    error = sqlc.narg(error)::text,
+    result = sqlc.narg(result)::jsonb,
+    next_attempt_at = sqlc.arg(next_attempt_at)::timestamptz,
+    finished_at = CASE WHEN sqlc.arg(status)::text <> 'pending' THEN now() END
+WHERE id = sqlc.arg(id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: ListAutomationRuns :many
+SELECT r.id,
+       r.automation_id,
+       r.event_id,
+       r.row_id,
+       r.mode,
+       r.status,
+       r.depth,
+       r.attempts,
+       r.error,
+       r.result,
+       r.created_at,
+       r.finished_at
+FROM app.automation_runs r
+WHERE r.automation_id = sqlc.arg(automation_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(status)::text IS NULL OR r.status = sqlc.narg(status)::text)
+ORDER BY r.id DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: RetryAutomationRun :execrows
+UPDATE app.automation_runs
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = now(),
+    error = NULL,
+    result = NULL,
+    finished_at = NULL
+WHERE id = sqlc.arg(id)::bigint
+  AND automation_id = sqlc.arg(automation_id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid
+  AND mode = 'async'
+  AND status = 'failed'
+  AND event_id IS NOT NULL;
+
+-- name: ClaimAutomationRuns :many
+SELECT c.id::bigint AS id, c.org_id::uuid AS org_id
+FROM app.claim_automation_runs(
+  sqlc.arg(limit_count)::int,
+  make_interval(secs => sqlc.arg(lease_seconds)::int)
+) AS c(id, org_id);
+
+-- name: GetAutomationJob :one
+SELECT r.id AS run_id,
+       r.attempts,
+       r.depth,
+       r.event_id,
+       r.row_id,
+       a.id,
+       a.name,
+       a.table_id,
+       t.slug AS table_slug,
+       a.actions,
+       a.mode,
+       a.active
+FROM app.automation_runs r
+JOIN app.automations a ON a.id = r.automation_id
+JOIN app.tables t ON t.id = a.table_id
+WHERE r.id = sqlc.arg(id)::bigint
+  AND r.org_id = sqlc.arg(org_id)::uuid
+  AND r.status = 'pending';
+
+-- name: QueueWebhookDelivery :execrows
+INSERT INTO app.webhook_deliveries (org_id, webhook_id, event_id)
+SELECT w.org_id, w.id, sqlc.arg(event_id)::bigint
+FROM app.webhooks w
+WHERE w.id = sqlc.arg(webhook_id)::uuid
+  AND w.org_id = sqlc.arg(org_id)::uuid
+  AND w.active
+  AND NOT EXISTS (
+    SELECT 1 FROM app.webhook_deliveries d
+    WHERE d.webhook_id = w.id AND d.event_id = sqlc.arg(event_id)::bigint
+  );
+
+-- name: QueueEmail :exec
+INSERT INTO app.outbound_emails (org_id, run_id, recipients, subject, body)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.narg(run_id)::bigint,
+  sqlc.arg(recipients)::text[],
+  sqlc.arg(subject)::text,
+  sqlc.arg(body)::text
+);
+
+-- name: ClaimOutboundEmails :many
+SELECT c.id::bigint AS id, c.org_id::uuid AS org_id
+FROM app.claim_outbound_emails(
+  sqlc.arg(limit_count)::int,
+  make_interval(secs => sqlc.arg(lease_seconds)::int)
+) AS c(id, org_id);
+
+-- name: GetOutboundEmail :one
+SELECT m.id,
+       m.recipients,
+       m.subject,
+       m.body,
+       m.attempts
+FROM app.outbound_emails m
+WHERE m.id = sqlc.arg(id)::bigint
+  AND m.org_id = sqlc.arg(org_id)::uuid
+  AND m.status = 'pending';
+
+-- name: RecordEmailAttempt :exec
+UPDATE app.outbound_emails
+SET status = sqlc.arg(status)::text,
+    last_error = sqlc.narg(last_error)::text,
+    next_attempt_at = sqlc.arg(next_attempt_at)::timestamptz,
+    sent_at = CASE WHEN sqlc.arg(status)::text = 'sent' THEN now() END
+WHERE id = sqlc.arg(id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
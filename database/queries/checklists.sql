@@ -0,0 +1,173 @@
+-- name: ListChecklistTemplates :many
+SELECT t.id,
+       t.name,
+       t.description,
+       (SELECT count(*) FROM app.checklist_template_items i WHERE i.template_id = t.id)::int AS item_count,
+       t.created_by,
+       t.created_at,
+       t.updated_at
+FROM app.checklist_templates t
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+ORDER BY lower(t.name), t.id;
+
+-- name: GetChecklistTemplate :one
+SELECT t.id,
+       t.name,
+       t.description,
+       (SELECT count(*) FROM app.checklist_template_items i WHERE i.template_id = t.id)::int AS item_count,
+       t.created_by,
+       t.created_at,
+       t.updated_at
+FROM app.checklist_templates t
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+  AND t.id = sqlc.arg(id)::uuid;
+
+-- name: CreateChecklistTemplate :one
+INSERT INTO app.checklist_templates (org_id, name, description, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(name)::text,
+  sqlc.narg(description)::text,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id;
+
+-- name: UpdateChecklistTemplate :execrows
+UPDATE app.checklist_templates
+SET name = sqlc.arg(name)::text,
+    description = sqlc.narg(description)::text,
+    updated_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: DeleteChecklistTemplate :execrows
+DELETE FROM app.checklist_templates
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: ClearChecklistTemplateItems :exec
+DELETE FROM app.checklist_template_items
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND template_id = sqlc.arg(template_id)::uuid;
+
+-- name: InsertChecklistTemplateItem :exec
+INSERT INTO app.checklist_template_items (org_id, template_id, position, label, kind, required,
+                                          min_value, max_value, unit, follow_up, help)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(template_id)::uuid,
+  sqlc.arg(position)::int,
+  sqlc.arg(label)::text,
+  sqlc.arg(kind)::text,
+  sqlc.arg(required)::boolean,
+  sqlc.narg(min_value)::float8,
+  sqlc.narg(max_value)::float8,
+  sqlc.narg(unit)::text,
+  sqlc.arg(follow_up)::boolean,
+  sqlc.narg(help)::text
+);
+
+-- name: ListChecklistTemplateItems :many
+SELECT i.id,
+       i.position,
+       i.label,
+       i.kind,
+       i.required,
+       i.min_value,
+       i.max_value,
+       i.unit,
+       i.follow_up,
+       i.help
+FROM app.checklist_template_items i
+WHERE i.org_id = sqlc.arg(org_id)::uuid
+  AND i.template_id = sqlc.arg(template_id)::uuid
+ORDER BY i.position;
+
+-- name: CopyChecklist :one
+-- NULL when the template does not exist.
+SELECT app.copy_checklist(sqlc.arg(work_order_id)::uuid, sqlc.arg(template_id)::uuid, sqlc.narg(created_by)::uuid)::uuid AS id;
+
+-- name: ListWorkOrderChecklists :many
+SELECT c.id,
+       c.work_order_id,
+       c.template_id,
+       c.name,
+       c.created_by,
+       c.created_at
+FROM app.checklists c
+WHERE c.org_id = sqlc.arg(org_id)::uuid
+  AND c.work_order_id = sqlc.arg(work_order_id)::uuid
+ORDER BY c.created_at, c.id;
+
+-- name: DeleteChecklist :execrows
+DELETE FROM app.checklists
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND work_order_id = sqlc.arg(work_order_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: ListChecklistItems :many
+-- The items of the checklists of a work order, or of one checklist when
+-- set, with who answered them.
+SELECT i.id,
+       i.checklist_id,
+       i.position,
+       i.label,
+       i.kind,
+       i.required,
+       i.min_value,
+       i.max_value,
+       i.unit,
+       i.follow_up,
+       i.help,
+       i.result,
+       i.reading,
+       i.text_value,
+       i.file,
+       i.note,
+       i.completed_by,
+       u.email AS completed_by_email,
+       i.completed_at,
+       i.follow_up_work_order_id
+FROM app.checklist_items i
+JOIN app.checklists c ON c.id = i.checklist_id
+LEFT JOIN users u ON u.id = i.completed_by
+WHERE i.org_id = sqlc.arg(org_id)::uuid
+  AND c.work_order_id = sqlc.arg(work_order_id)::uuid
+  AND (sqlc.narg(checklist_id)::uuid IS NULL OR i.checklist_id = sqlc.narg(checklist_id)::uuid)
+ORDER BY c.created_at, c.id, i.position;
+
+-- name: AnswerChecklistItem :execrows
+UPDATE app.checklist_items
+SET result = sqlc.arg(result)::text,
+    reading = sqlc.narg(reading)::float8,
+    text_value = sqlc.narg(text_value)::text,
+    file = sqlc.narg(file)::text,
+    note = sqlc.narg(note)::text,
+    completed_by = sqlc.narg(completed_by)::uuid,
+    completed_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND checklist_id = sqlc.arg(checklist_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: ClearChecklistItem :execrows
+-- Unanswers an item; a follow-up work order it created stays linked.
+UPDATE app.checklist_items
+SET result = NULL,
+    reading = NULL,
+    text_value = NULL,
+    file = NULL,
+    note = NULL,
+    completed_by = NULL,
+    completed_at = NULL
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND checklist_id = sqlc.arg(checklist_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: SetChecklistItemFollowUp :exec
+UPDATE app.checklist_items
+SET follow_up_work_order_id = sqlc.arg(work_order_id)::uuid
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: WorkOrderChecklistOpen :one
+SELECT app.work_order_checklist_open(sqlc.arg(work_order_id)::uuid)::int AS open;
@@ -0,0 +1,73 @@
+-- name: GetFile :one
+SELECT f.id, f.name, f.content_type, f.size, f.sha256, f.width, f.height, f.thumbnail,
+       f.latitude, f.longitude, f.taken_at, f.created_by, f.created_at
+FROM app.files f
+WHERE f.org_id = sqlc.arg(org_id)::uuid
+  AND f.id = sqlc.arg(id)::uuid;
+
+-- name: GetFileBySHA256 :one
+SELECT f.id, f.name, f.content_type, f.size, f.sha256, f.width, f.height, f.thumbnail,
+       f.latitude, f.longitude, f.taken_at, f.created_by, f.created_at
+FROM app.files f
+WHERE f.org_id = sqlc.arg(org_id)::uuid
+  AND f.sha256 = sqlc.arg(sha256)::text;
+
+-- name: InsertFile :one
+-- Returns the file already stored with the same content, if any, so
+-- concurrent uploads of one file end up with one row.
+INSERT INTO app.files (org_id, name, content_type, size, sha256, width, height, thumbnail,
+                       latitude, longitude, taken_at, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(name)::text,
+  sqlc.arg(content_type)::text,
+  sqlc.arg(size)::bigint,
+  sqlc.arg(sha256)::text,
+  sqlc.narg(width)::int,
+  sqlc.narg(height)::int,
+  sqlc.arg(thumbnail)::boolean,
+  sqlc.narg(latitude)::float8,
+  sqlc.narg(longitude)::float8,
+  sqlc.narg(taken_at)::timestamptz,
+  sqlc.narg(created_by)::uuid
+)
+ON CONFLICT (org_id, sha256) DO UPDATE SET sha256 = EXCLUDED.sha256
+RETURNING id, (xmax = 0)::boolean AS created;
+
+-- name: ListFiles :many
+-- The org's files, newest first, or those linked to a row when set.
+SELECT f.id, f.name, f.content_type, f.size, f.sha256, f.width, f.height, f.thumbnail,
+       f.latitude, f.longitude, f.taken_at, f.created_by, f.created_at
+FROM app.files f
+WHERE f.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(row_id)::uuid IS NULL
+       OR EXISTS (SELECT 1 FROM app.file_links l WHERE l.file_id = f.id AND l.row_id = sqlc.narg(row_id)::uuid))
+ORDER BY f.created_at DESC, f.id
+LIMIT sqlc.arg(lim)::int;
+
+-- name: DeleteFile :execrows
+DELETE FROM app.files
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: LinkFile :exec
+INSERT INTO app.file_links (org_id, file_id, row_id, created_by)
+VALUES (sqlc.arg(org_id)::uuid, sqlc.arg(file_id)::uuid, sqlc.arg(row_id)::uuid, sqlc.narg(created_by)::uuid)
+ON CONFLICT (file_id, row_id) DO NOTHING;
+
+-- name: UnlinkFile :execrows
+DELETE FROM app.file_links
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND file_id = sqlc.arg(file_id)::uuid
+  AND row_id = sqlc.arg(row_id)::uuid;
+
+-- name: ListFileLinks :many
+-- The rows a file is linked to that the user sees.
+SELECT l.row_id, r.table_id, t.slug AS table_slug, l.created_by, l.created_at
+FROM app.file_links l
+JOIN app.rows r ON r.id = l.row_id
+JOIN app.tables t ON t.id = r.table_id
+WHERE l.org_id = sqlc.arg(org_id)::uuid
+  AND l.file_id = sqlc.arg(file_id)::uuid
+  AND app.row_visible(l.row_id)
+ORDER BY l.created_at, l.row_id;
@@ -0,0 +1,112 @@
+-- name: GetHierarchy :many
+SELECT h.table_id,
+       t.slug AS table_slug,
+       h.column_id,
+       c.name AS column_name,
+       h.created_at
+FROM app.hierarchies h
+JOIN app.tables t ON t.id = h.table_id
+JOIN app.columns c ON c.id = h.column_id
+WHERE h.table_id = sqlc.arg(table_id)::bigint
+  AND h.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: PutHierarchy :one
+WITH col AS (
+  SELECT c.id
+  FROM app.columns c
+  WHERE c.table_id = sqlc.arg(table_id)::bigint
+    AND lower(c.name) = lower(sqlc.arg(column_name)::text)
+    AND c.kind = 'value'
+    AND c.type = 'uuid'
+    AND c.is_reference
+    AND c.reference_table_id = c.table_id
+),
+cycle AS (
+  SELECT app.hierarchy_cycle(col.id) AS row_id FROM col
+),
+ins AS (
+  INSERT INTO app.hierarchies (table_id, org_id, column_id)
+  SELECT sqlc.arg(table_id)::bigint, sqlc.arg(org_id)::uuid, col.id
+  FROM col
+  WHERE (SELECT row_id FROM cycle) IS NULL
+  ON CONFLICT (table_id) DO UPDATE
+  SET column_id = EXCLUDED.column_id,
+      created_at = now()
+  RETURNING column_id
+)
+SELECT EXISTS (SELECT 1 FROM col) AS valid,
+       (SELECT row_id FROM cycle) AS cycle_row;
+
+-- name: DeleteHierarchy :execrows
+DELETE FROM app.hierarchies
+WHERE table_id = sqlc.arg(table_id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: RowSubtree :many
+WITH walk AS (
+  SELECT s.id::uuid AS id, s.parent_id::uuid AS parent_id, s.depth::int AS depth,
+         row_number() OVER (ORDER BY s.depth) AS n
+  FROM app.row_subtree(sqlc.arg(column_id)::bigint, sqlc.arg(root)::uuid, sqlc.narg(max_depth)::int) AS s(id, parent_id, depth)
+),
+nodes AS (
+  SELECT w.id, w.parent_id, w.depth
+  FROM walk w
+  WHERE w.n <= sqlc.arg(max_nodes)::bigint
+),
+visible AS (
+  SELECT app.visible_rows(sqlc.arg(table_id)::bigint, ARRAY(SELECT id FROM nodes)) AS id
+),
+label_col AS (
+  SELECT c.id
+  FROM app.columns c
+  WHERE c.table_id = sqlc.arg(table_id)::bigint
+    AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
+  ORDER BY
+    CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
+    CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
+    c.id
+  LIMIT 1
+)
+SELECT n.id,
+       n.parent_id,
+       n.depth,
+       label,
+       EXISTS (SELECT 1 FROM walk w WHERE w.n > sqlc.arg(max_nodes)::bigint) AS truncated
+FROM nodes n
+JOIN visible v ON v.id = n.id
+CROSS JOIN LATERAL app.cell_text(n.id, (SELECT id FROM label_col)) AS label
+ORDER BY n.depth, label ASC NULLS LAST, n.id;
+
+-- name: RowAncestors :many
+WITH chain AS (
+  SELECT sqlc.arg(row_id)::uuid AS id, 0 AS depth
+  UNION ALL
+  SELECT a.id::uuid, a.depth::int
+  FROM app.row_ancestors(sqlc.arg(column_id)::bigint, sqlc.arg(row_id)::uuid) AS a(id, depth)
+),
+visible AS (
+  SELECT app.visible_rows(sqlc.arg(table_id)::bigint, ARRAY(SELECT id FROM chain)) AS id
+),
+label_col AS (
+  SELECT c.id
+  FROM app.columns c
+  WHERE c.table_id = sqlc.arg(table_id)::bigint
+    AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
+  ORDER BY
+    CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
+    CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
+    c.id
+  LIMIT 1
+)
+SELECT ch.id,
+       ch.depth,
+       (v.id IS NOT NULL)::boolean AS visible,
+       label
+FROM chain ch
+LEFT JOIN visible v ON v.id = ch.id
+LEFT JOIN LATERAL app.cell_text(ch.id, (SELECT id FROM label_col)) AS label ON v.id IS NOT NULL
+ORDER BY ch.depth;
@@ -0,0 +1,271 @@
+-- name: InsertStockMovement :one
+INSERT INTO app.stock_movements (
+  org_id, part_id, kind, quantity, from_bin_id, to_bin_id, lot, serial, expires_on,
+  work_order_id, order_id, unit_cost, note, created_by
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(part_id)::uuid,
+  sqlc.arg(kind)::text,
+  sqlc.arg(quantity)::float8,
+  sqlc.narg(from_bin_id)::uuid,
+  sqlc.narg(to_bin_id)::uuid,
+  sqlc.arg(lot)::text,
+  sqlc.arg(serial)::text,
+  sqlc.narg(expires_on)::date,
+  sqlc.narg(work_order_id)::uuid,
+  sqlc.narg(order_id)::uuid,
+  sqlc.narg(unit_cost)::float8,
+  sqlc.narg(note)::text,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id, expires_on, created_at;
+
+-- name: ListStockMovements :many
+-- Latest first, below before_id when set; only movements of parts the
+-- caller sees.
+SELECT m.id,
+       m.part_id,
+       m.kind,
+       m.quantity::float8 AS quantity,
+       m.from_bin_id,
+       m.to_bin_id,
+       m.lot,
+       m.serial,
+       m.expires_on,
+       m.work_order_id,
+       m.order_id,
+       m.unit_cost,
+       m.note,
+       m.created_by,
+       m.created_at
+FROM app.stock_movements m
+WHERE m.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(part_id)::uuid IS NULL OR m.part_id = sqlc.narg(part_id)::uuid)
+  AND (sqlc.narg(bin_id)::uuid IS NULL OR sqlc.narg(bin_id)::uuid IN (m.from_bin_id, m.to_bin_id))
+  AND (sqlc.narg(work_order_id)::uuid IS NULL OR m.work_order_id = sqlc.narg(work_order_id)::uuid)
+  AND (sqlc.narg(before_id)::bigint IS NULL OR m.id < sqlc.narg(before_id)::bigint)
+  AND m.part_id IN (SELECT app.visible_rows(sqlc.arg(parts_table_id)::bigint))
+ORDER BY m.id DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: ListStockLevels :many
+-- Levels with stock, of parts the caller sees.
+SELECT l.part_id,
+       l.bin_id,
+       l.lot,
+       l.serial,
+       l.expires_on,
+       l.quantity::float8 AS quantity,
+       l.received_at
+FROM app.stock_levels l
+WHERE l.org_id = sqlc.arg(org_id)::uuid
+  AND l.quantity > 0
+  AND (sqlc.narg(part_id)::uuid IS NULL OR l.part_id = sqlc.narg(part_id)::uuid)
+  AND (sqlc.narg(bin_id)::uuid IS NULL OR l.bin_id = sqlc.narg(bin_id)::uuid)
+  AND l.part_id IN (SELECT app.visible_rows(sqlc.arg(parts_table_id)::bigint))
+ORDER BY l.part_id, l.bin_id, l.expires_on NULLS LAST, l.lot, l.serial;
+
+-- name: AllocatableStock :many
+-- Levels of a part to take stock from, in the order to take it: the
+-- earliest expiry first when fefo is set, then first in, first out. Locked
+-- until the movements taking from them are stored.
+SELECT l.bin_id,
+       l.lot,
+       l.serial,
+       l.expires_on,
+       l.quantity::float8 AS quantity
+FROM app.stock_levels l
+WHERE l.org_id = sqlc.arg(org_id)::uuid
+  AND l.part_id = sqlc.arg(part_id)::uuid
+  AND l.quantity > 0
+  AND (sqlc.narg(bin_id)::uuid IS NULL OR l.bin_id = sqlc.narg(bin_id)::uuid)
+  AND (sqlc.narg(lot)::text IS NULL OR l.lot = sqlc.narg(lot)::text)
+  AND (sqlc.narg(serial)::text IS NULL OR l.serial = sqlc.narg(serial)::text)
+  AND (NOT sqlc.arg(skip_expired)::boolean OR l.expires_on IS NULL OR l.expires_on >= current_date)
+ORDER BY CASE WHEN sqlc.arg(fefo)::boolean THEN l.expires_on END NULLS LAST,
+         l.received_at,
+         l.bin_id,
+         l.lot,
+         l.serial
+FOR UPDATE;
+
+-- name: PartStock :many
+SELECT s.part_id::uuid AS part_id,
+       s.on_hand::float8 AS on_hand,
+       s.reserved::float8 AS reserved,
+       s.on_order::float8 AS on_order
+FROM app.part_stock(sqlc.arg(part_ids)::uuid[]) AS s(part_id, on_hand, reserved, on_order);
+
+-- name: LowStockParts :many
+-- Parts of the parts table the caller sees, other than non-stock parts,
+-- whose stock on hand and on order, less reservations, is at or below their
+-- reorder point (min_quantity when they have none).
+WITH cols AS (
+  SELECT max(c.id) FILTER (WHERE c.name = 'name' AND c.type = 'text') AS name_col,
+         max(c.id) FILTER (WHERE c.name = 'part_number' AND c.type = 'text') AS number_col,
+         max(c.id) FILTER (WHERE c.name = 'unit' AND c.type = 'text') AS unit_col,
+         max(c.id) FILTER (WHERE c.name = 'reorder_point' AND c.type = 'float') AS reorder_col,
+         max(c.id) FILTER (WHERE c.name = 'min_quantity' AND c.type = 'float') AS min_col,
+         max(c.id) FILTER (WHERE c.name = 'safety_stock' AND c.type = 'float') AS safety_col,
+         max(c.id) FILTER (WHERE c.name = 'max_quantity' AND c.type = 'float') AS max_col,
+         max(c.id) FILTER (WHERE c.name = 'non_stock' AND c.type = 'bool') AS non_stock_col
+  FROM app.columns c
+  WHERE c.table_id = sqlc.arg(parts_table_id)::bigint
+    AND c.kind = 'value'
+),
+parts AS (
+  SELECT v.id::uuid AS id,
+         COALESCE(app.cell_float(v.id, cols.reorder_col), app.cell_float(v.id, cols.min_col)) AS reorder_point,
+         safety_stock,
+         max_quantity
+  FROM app.visible_rows(sqlc.arg(parts_table_id)::bigint) AS v(id)
+  CROSS JOIN cols
+  CROSS JOIN LATERAL app.cell_float(v.id, cols.safety_col) AS safety_stock
+  CROSS JOIN LATERAL app.cell_float(v.id, cols.max_col) AS max_quantity
+  WHERE NOT COALESCE(app.cell_bool(v.id, cols.non_stock_col), false)
+),
+stock AS (
+  SELECT s.*
+  FROM app.part_stock(ARRAY(SELECT id FROM parts WHERE reorder_point IS NOT NULL))
+       AS s(part_id, on_hand, reserved, on_order)
+)
+SELECT p.id AS part_id,
+       name,
+       part_number,
+       unit,
+       p.reorder_point::float8 AS reorder_point,
+       p.safety_stock,
+       p.max_quantity,
+       s.on_hand::float8 AS on_hand,
+       s.reserved::float8 AS reserved,
+       s.on_order::float8 AS on_order
+FROM parts p
+JOIN stock s ON s.part_id = p.id
+CROSS JOIN cols
+CROSS JOIN LATERAL app.cell_text(p.id, cols.name_col) AS name
+CROSS JOIN LATERAL app.cell_text(p.id, cols.number_col) AS part_number
+CROSS JOIN LATERAL app.cell_text(p.id, cols.unit_col) AS unit
+WHERE s.on_hand + s.on_order - s.reserved <= p.reorder_point
+ORDER BY (s.on_hand + s.on_order - s.reserved) - p.reorder_point, name, p.id;
+
+-- name: CreateStockReservation :one
+INSERT INTO app.stock_reservations (org_id, part_id, work_order_id, bin_id, quantity, needed_on, note, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(part_id)::uuid,
+  sqlc.arg(work_order_id)::uuid,
+  sqlc.narg(bin_id)::uuid,
+  sqlc.arg(quantity)::float8,
+  sqlc.narg(needed_on)::date,
+  sqlc.narg(note)::text,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id;
+
+-- name: GetStockReservation :one
+SELECT r.id,
+       r.part_id,
+       r.work_order_id,
+       r.bin_id,
+       r.quantity::float8 AS quantity,
+       r.issued::float8 AS issued,
+       r.needed_on,
+       r.status,
+       r.note,
+       r.created_by,
+       r.created_at,
+       r.updated_at
+FROM app.stock_reservations r
+WHERE r.id = sqlc.arg(id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: ListStockReservations :many
+-- Oldest first; only reservations of parts the caller sees.
+SELECT r.id,
+       r.part_id,
+       r.work_order_id,
+       r.bin_id,
+       r.quantity::float8 AS quantity,
+       r.issued::float8 AS issued,
+       r.needed_on,
+       r.status,
+       r.note,
+       r.created_by,
+       r.created_at,
+       r.updated_at
+FROM app.stock_reservations r
+WHERE r.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(part_id)::uuid IS NULL OR r.part_id = sqlc.narg(part_id)::uuid)
+  AND (sqlc.narg(work_order_id)::uuid IS NULL OR r.work_order_id = sqlc.narg(work_order_id)::uuid)
+  AND (sqlc.narg(status)::text IS NULL OR r.status = sqlc.narg(status)::text)
+  AND r.part_id IN (SELECT app.visible_rows(sqlc.arg(parts_table_id)::bigint))
+ORDER BY r.needed_on NULLS LAST, r.created_at, r.id
+LIMIT 1000;
+
+-- name: ReleaseStockReservation :execrows
+UPDATE app.stock_reservations
+SET status = 'released',
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid
+  AND status = 'active';
+
+-- name: CreatePartOrder :one
+INSERT INTO app.part_orders (org_id, part_id, quantity, supplier, reference, expected_on, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(part_id)::uuid,
+  sqlc.arg(quantity)::float8,
+  sqlc.narg(supplier)::text,
+  sqlc.narg(reference)::text,
+  sqlc.narg(expected_on)::date,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id;
+
+-- name: GetPartOrder :one
+SELECT o.id,
+       o.part_id,
+       o.quantity::float8 AS quantity,
+       o.received::float8 AS received,
+       o.supplier,
+       o.reference,
+       o.expected_on,
+       o.status,
+       o.created_by,
+       o.created_at,
+       o.updated_at
+FROM app.part_orders o
+WHERE o.id = sqlc.arg(id)::uuid
+  AND o.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: ListPartOrders :many
+-- Open orders by expected date, then the others latest first; only orders
+-- of parts the caller sees.
+SELECT o.id,
+       o.part_id,
+       o.quantity::float8 AS quantity,
+       o.received::float8 AS received,
+       o.supplier,
+       o.reference,
+       o.expected_on,
+       o.status,
+       o.created_by,
+       o.created_at,
+       o.updated_at
+FROM app.part_orders o
+WHERE o.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(part_id)::uuid IS NULL OR o.part_id = sqlc.narg(part_id)::uuid)
+  AND (sqlc.narg(status)::text IS NULL OR o.status = sqlc.narg(status)::text)
+  AND o.part_id IN (SELECT app.visible_rows(sqlc.arg(parts_table_id)::bigint))
+ORDER BY o.status <> 'open', o.expected_on NULLS LAST, o.created_at DESC, o.id
+LIMIT 1000;
+
+-- name: CancelPartOrder :execrows
+UPDATE app.part_orders
+SET status = 'cancelled',
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid
+  AND status = 'open';
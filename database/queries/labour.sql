@@ -0,0 +1,156 @@
+-- name: StartTimer :one
+INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, note, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(work_order_id)::uuid,
+  sqlc.arg(user_id)::uuid,
+  'timer',
+  now(),
+  sqlc.narg(note)::text,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id;
+
+-- name: InsertTimeEntry :one
+INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, ended_at, note, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(work_order_id)::uuid,
+  sqlc.arg(user_id)::uuid,
+  'manual',
+  sqlc.arg(started_at)::timestamptz,
+  sqlc.arg(ended_at)::timestamptz,
+  sqlc.narg(note)::text,
+  sqlc.narg(created_by)::uuid
+)
+RETURNING id;
+
+-- name: RunningTimeEntry :one
+SELECT e.id
+FROM app.time_entries e
+WHERE e.org_id = sqlc.arg(org_id)::uuid
+  AND e.user_id = sqlc.arg(user_id)::uuid
+  AND e.ended_at IS NULL;
+
+-- name: StopTimeEntry :execrows
+UPDATE app.time_entries
+SET ended_at = now(),
+    updated_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid
+  AND ended_at IS NULL;
+
+-- name: UpdateTimeEntry :execrows
+-- Sets the period and note of an entry; a running timer given an end is
+-- stopped.
+UPDATE app.time_entries
+SET started_at = sqlc.arg(started_at)::timestamptz,
+    ended_at = sqlc.arg(ended_at)::timestamptz,
+    note = sqlc.narg(note)::text,
+    updated_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: DeleteTimeEntry :execrows
+DELETE FROM app.time_entries
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
+
+-- name: GetTimeEntry :one
+-- Hours run to now while the timer runs.
+SELECT e.id,
+       e.work_order_id,
+       e.user_id,
+       u.email AS user_email,
+       u.name AS user_name,
+       e.source,
+       e.started_at,
+       e.ended_at,
+       (extract(epoch FROM COALESCE(e.ended_at, now()) - e.started_at) / 3600)::float8 AS hours,
+       e.hourly_rate,
+       e.note,
+       e.created_by,
+       e.created_at,
+       e.updated_at
+FROM app.time_entries e
+JOIN users u ON u.id = e.user_id
+WHERE e.org_id = sqlc.arg(org_id)::uuid
+  AND e.id = sqlc.arg(id)::uuid;
+
+-- name: ListTimeEntries :many
+-- Entries on the work orders the caller sees, of a work order and of a user
+-- when set, started in [from_time, to_time) when set, in the order they
+-- started, with the title of their work order.
+SELECT e.id,
+       e.work_order_id,
+       (SELECT title
+        FROM app.columns c
+        CROSS JOIN LATERAL app.cell_text(e.work_order_id, c.id) AS title
+        WHERE c.table_id = sqlc.arg(work_orders_table_id)::bigint
+          AND c.name = 'title' AND c.kind = 'value' AND c.type = 'text') AS work_order_title,
+       e.user_id,
+       u.email AS user_email,
+       u.name AS user_name,
+       e.source,
+       e.started_at,
+       e.ended_at,
+       (extract(epoch FROM COALESCE(e.ended_at, now()) - e.started_at) / 3600)::float8 AS hours,
+       e.hourly_rate,
+       e.note,
+       e.created_by,
+       e.created_at,
+       e.updated_at
+FROM app.time_entries e
+JOIN users u ON u.id = e.user_id
+WHERE e.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(work_order_id)::uuid IS NULL OR e.work_order_id = sqlc.narg(work_order_id)::uuid)
+  AND (sqlc.narg(user_id)::uuid IS NULL OR e.user_id = sqlc.narg(user_id)::uuid)
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR e.started_at >= sqlc.narg(from_time)::timestamptz)
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR e.started_at < sqlc.narg(to_time)::timestamptz)
+  AND e.work_order_id IN (SELECT app.visible_rows(sqlc.arg(work_orders_table_id)::bigint))
+ORDER BY e.started_at, e.id
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: WorkOrderLabour :one
+SELECT l.hours::float8 AS hours,
+       l.cost::float8 AS cost
+FROM app.work_order_labour(sqlc.arg(work_order_id)::uuid) l;
+
+-- name: ListLabourRates :many
+-- User rates first, by email, then team rates, with the team's name.
+SELECT lr.id,
+       lr.user_id,
+       u.email AS user_email,
+       lr.team_id,
+       (SELECT team_name
+        FROM app.rows r
+        JOIN app.columns c ON c.table_id = r.table_id AND c.name = 'name' AND c.kind = 'value' AND c.type = 'text'
+        CROSS JOIN LATERAL app.cell_text(r.id, c.id) AS team_name
+        WHERE r.id = lr.team_id) AS team_name,
+       lr.hourly_rate::float8 AS hourly_rate,
+       lr.updated_at
+FROM app.labour_rates lr
+LEFT JOIN users u ON u.id = lr.user_id
+WHERE lr.org_id = sqlc.arg(org_id)::uuid
+ORDER BY lr.user_id IS NULL, u.email, team_name, lr.id;
+
+-- name: SetUserLabourRate :one
+INSERT INTO app.labour_rates (org_id, user_id, hourly_rate)
+VALUES (sqlc.arg(org_id)::uuid, sqlc.arg(user_id)::uuid, sqlc.arg(hourly_rate)::float8)
+ON CONFLICT (org_id, user_id) WHERE user_id IS NOT NULL DO UPDATE
+SET hourly_rate = EXCLUDED.hourly_rate,
+    updated_at = now()
+RETURNING id;
+
+-- name: SetTeamLabourRate :one
+INSERT INTO app.labour_rates (org_id, team_id, hourly_rate)
+VALUES (sqlc.arg(org_id)::uuid, sqlc.arg(team_id)::uuid, sqlc.arg(hourly_rate)::float8)
+ON CONFLICT (team_id) WHERE team_id IS NOT NULL DO UPDATE
+SET hourly_rate = EXCLUDED.hourly_rate,
+    updated_at = now()
+RETURNING id;
+
+-- name: DeleteLabourRate :execrows
+DELETE FROM app.labour_rates
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND id = sqlc.arg(id)::uuid;
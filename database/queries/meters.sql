@@ -0,0 +1,191 @@
+-- name: InsertMeterReading :one
+INSERT INTO app.meter_readings (org_id, meter_id, value, read_at, created_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(meter_id)::uuid,
+  sqlc.arg(value)::float8,
+  sqlc.arg(read_at)::timestamptz,
+  sqlc.narg(created_by)::uuid
+)
+ON CONFLICT DO NOTHING
+RETURNING id, created_at;
+
+-- name: LatestMeterReading :one
+SELECT r.id,
+       r.meter_id,
+       r.value,
+       r.read_at,
+       r.created_by,
+       r.created_at
+FROM app.meter_readings r
+WHERE r.meter_id = sqlc.arg(meter_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid
+ORDER BY r.read_at DESC
+LIMIT 1;
+
+-- name: ListMeterReadings :many
+SELECT r.id,
+       r.meter_id,
+       r.value,
+       r.read_at,
+       r.created_by,
+       r.created_at
+FROM app.meter_readings r
+WHERE r.meter_id = sqlc.arg(meter_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid
+  AND r.read_at >= sqlc.arg(from_at)::timestamptz
+  AND r.read_at < sqlc.arg(to_at)::timestamptz
+ORDER BY r.read_at DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: MeterReadingSeries :many
+-- Buckets start on Mondays at 00:00 UTC (date_bin's origin is one), or on
+-- the first of the month.
+SELECT b.bucket::timestamptz AS bucket,
+       min(b.value)::float8 AS min_value,
+       max(b.value)::float8 AS max_value,
+       avg(b.value)::float8 AS avg_value,
+       count(*)::bigint AS readings
+FROM (
+  SELECT CASE WHEN sqlc.arg(months)::boolean
+              THEN date_trunc('month', r.read_at, 'UTC')
+              ELSE date_bin(make_interval(secs => sqlc.arg(bin_seconds)::float8), r.read_at,
+                            TIMESTAMPTZ '2001-01-01 00:00:00+00')
+         END AS bucket,
+         r.value
+  FROM app.meter_readings r
+  WHERE r.meter_id = sqlc.arg(meter_id)::uuid
+    AND r.org_id = sqlc.arg(org_id)::uuid
+    AND r.read_at >= sqlc.arg(from_at)::timestamptz
+    AND r.read_at < sqlc.arg(to_at)::timestamptz
+) b
+GROUP BY b.bucket
+ORDER BY b.bucket;
+
+-- name: ListMeterRules :many
+SELECT m.id,
+       m.meter_id,
+       m.name,
+       m.kind,
+       m.value,
+       m.action,
+       m.wo_title,
+       m.wo_description,
+       m.wo_priority,
+       m.active,
+       m.last_triggered_at,
+       m.created_at,
+       m.updated_at
+FROM app.meter_rules m
+WHERE m.meter_id = sqlc.arg(meter_id)::uuid
+  AND m.org_id = sqlc.arg(org_id)::uuid
+ORDER BY m.created_at, m.id;
+
+-- name: GetMeterRule :one
+SELECT m.id,
+       m.meter_id,
+       m.name,
+       m.kind,
+       m.value,
+       m.action,
+       m.wo_title,
+       m.wo_description,
+       m.wo_priority,
+       m.active,
+       m.last_triggered_at,
+       m.created_at,
+       m.updated_at
+FROM app.meter_rules m
+WHERE m.id = sqlc.arg(id)::uuid
+  AND m.meter_id = sqlc.arg(meter_id)::uuid
+  AND m.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertMeterRule :one
+INSERT INTO app.meter_rules (
+  org_id, meter_id, name, kind, value, action,
+  wo_title, wo_description, wo_priority, active
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(meter_id)::uuid,
+  sqlc.arg(name)::text,
+  sqlc.arg(kind)::text,
+  sqlc.arg(value)::float8,
+  sqlc.arg(action)::text,
+  sqlc.narg(wo_title)::text,
+  sqlc.narg(wo_description)::text,
+  sqlc.narg(wo_priority)::text,
+  sqlc.arg(active)::boolean
+)
+RETURNING id;
+
+-- name: UpdateMeterRule :execrows
+UPDATE app.meter_rules
+SET name = sqlc.arg(name)::text,
+    kind = sqlc.arg(kind)::text,
+    value = sqlc.arg(value)::float8,
+    action = sqlc.arg(action)::text,
+    wo_title = sqlc.narg(wo_title)::text,
+    wo_description = sqlc.narg(wo_description)::text,
+    wo_priority = sqlc.narg(wo_priority)::text,
+    active = sqlc.arg(active)::boolean,
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND meter_id = sqlc.arg(meter_id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: DeleteMeterRule :execrows
+DELETE FROM app.meter_rules
+WHERE id = sqlc.arg(id)::uuid
+  AND meter_id = sqlc.arg(meter_id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertMeterAlert :one
+WITH fired AS (
+  UPDATE app.meter_rules
+  SET last_triggered_at = now()
+  WHERE id = sqlc.arg(rule_id)::uuid
+    AND org_id = sqlc.arg(org_id)::uuid
+)
+INSERT INTO app.meter_alerts (org_id, rule_id, meter_id, reading_id, value, previous, action, work_order_ids)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(rule_id)::uuid,
+  sqlc.arg(meter_id)::uuid,
+  sqlc.arg(reading_id)::bigint,
+  sqlc.arg(value)::float8,
+  sqlc.narg(previous)::float8,
+  sqlc.arg(action)::text,
+  sqlc.arg(work_order_ids)::uuid[]
+)
+RETURNING id, created_at;
+
+-- name: ListMeterAlerts :many
+SELECT a.id,
+       a.rule_id,
+       m.name AS rule_name,
+       a.meter_id,
+       a.reading_id,
+       a.value,
+       a.previous,
+       a.action,
+       a.work_order_ids,
+       a.created_at
+FROM app.meter_alerts a
+JOIN app.meter_rules m ON m.id = a.rule_id
+WHERE a.meter_id = sqlc.arg(meter_id)::uuid
+  AND a.org_id = sqlc.arg(org_id)::uuid
+ORDER BY a.id DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: LastMeterRuleWorkOrder :one
+-- The latest work order a rule created that still exists.
+SELECT w.id::uuid AS id
+FROM app.meter_alerts a
+CROSS JOIN LATERAL unnest(a.work_order_ids) w(id)
+JOIN app.rows r ON r.id = w.id
+WHERE a.rule_id = sqlc.arg(rule_id)::uuid
+  AND a.org_id = sqlc.arg(org_id)::uuid
+  AND a.action = 'create_work_order'
+ORDER BY a.id DESC
+LIMIT 1;
@@ -0,0 +1,108 @@
+-- name: ListTablePermissions :many
+SELECT t.id AS table_id,
+       COALESCE(p.can_read, false)::boolean   AS can_read,
+       COALESCE(p.can_create, false)::boolean AS can_create,
+       COALESCE(p.can_edit, false)::boolean   AS can_edit,
+       COALESCE(p.can_delete, false)::boolean AS can_delete,
+       COALESCE(p.can_manage, false)::boolean AS can_manage
+FROM app.tables t
+LEFT JOIN LATERAL app.table_rights(t.id, sqlc.arg(user_id)::uuid)
+  AS p(can_read, can_create, can_edit, can_delete, can_manage) ON true
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+ORDER BY t.id;
+
+-- name: GetTablePermissions :one
+SELECT t.id AS table_id,
+       COALESCE(p.can_read, false)::boolean   AS can_read,
+       COALESCE(p.can_create, false)::boolean AS can_create,
+       COALESCE(p.can_edit, false)::boolean   AS can_edit,
+       COALESCE(p.can_delete, false)::boolean AS can_delete,
+       COALESCE(p.can_manage, false)::boolean AS can_manage
+FROM app.tables t
+LEFT JOIN LATERAL app.table_rights(t.id, sqlc.arg(user_id)::uuid)
+  AS p(can_read, can_create, can_edit, can_delete, can_manage) ON true
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+  AND (t.slug = lower(sqlc.arg(table_name)::text)
+       OR lower(t.name) = lower(sqlc.arg(table_name)::text))
+LIMIT 1;
+
+-- name: GetRowPermissions :one
+SELECT r.table_id,
+       COALESCE(p.can_read, false)::boolean   AS can_read,
+       COALESCE(p.can_create, false)::boolean AS can_create,
+       COALESCE(p.can_edit, false)::boolean   AS can_edit,
+       COALESCE(p.can_delete, false)::boolean AS can_delete,
+       COALESCE(p.can_manage, false)::boolean AS can_manage
+FROM app.rows r
+LEFT JOIN LATERAL app.table_rights(r.table_id, sqlc.arg(user_id)::uuid)
+  AS p(can_read, can_create, can_edit, can_delete, can_manage) ON true
+WHERE r.id = sqlc.arg(row_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: ListTableGrants :many
+SELECT g.id,
+       COALESCE(g.role::text, '')::text AS role,
+       g.user_id,
+       u.email      AS user_email,
+       g.team_id,
+       g.can_read,
+       g.can_create,
+       g.can_edit,
+       g.can_delete,
+       g.can_manage
+FROM app.table_grants g
+LEFT JOIN users u ON u.id = g.user_id
+WHERE g.table_id = sqlc.arg(table_id)::bigint
+  AND g.org_id = sqlc.arg(org_id)::uuid
+ORDER BY g.role NULLS LAST, u.email NULLS LAST, g.team_id;
+
+-- name: DeleteTableGrants :exec
+DELETE FROM app.table_grants
+WHERE table_id = sqlc.arg(table_id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertTableGrant :exec
+INSERT INTO app.table_grants (
+  org_id, table_id, role, user_id, team_id,
+  can_read, can_create, can_edit, can_delete, can_manage
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(table_id)::bigint,
+  sqlc.narg(role)::text::org_role,
+  sqlc.narg(user_id)::uuid,
+  sqlc.narg(team_id)::uuid,
+  sqlc.arg(can_read)::boolean,
+  sqlc.arg(can_create)::boolean,
+  sqlc.arg(can_edit)::boolean,
+  sqlc.arg(can_delete)::boolean,
+  sqlc.arg(can_manage)::boolean
+);
+
+-- name: TeamRowExists :one
+SELECT EXISTS (
+  SELECT 1 FROM app.rows r
+  WHERE r.id = sqlc.arg(team_id)::uuid
+    AND r.org_id = sqlc.arg(org_id)::uuid
+) AS found;
+
+-- name: ListTeamMembers :many
+SELECT u.id, u.email, u.name
+FROM app.team_members tm
+JOIN users u ON u.id = tm.user_id
+WHERE tm.team_id = sqlc.arg(team_id)::uuid
+  AND tm.org_id = sqlc.arg(org_id)::uuid
+ORDER BY u.email;
+
+-- name: DeleteTeamMembers :exec
+DELETE FROM app.team_members
+WHERE team_id = sqlc.arg(team_id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: AddTeamMembers :execrows
+INSERT INTO app.team_members (org_id, team_id, user_id)
+SELECT om.org_id, sqlc.arg(team_id)::uuid, om.user_id
+FROM org_memberships om
+WHERE om.org_id = sqlc.arg(org_id)::uuid
+  AND om.user_id = ANY(sqlc.arg(user_ids)::uuid[])
+ON CONFLICT DO NOTHING;
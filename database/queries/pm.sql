@@ -0,0 +1,77 @@
+-- name: ClaimPMScans :many
+SELECT c.org_id::uuid AS org_id
+FROM app.claim_pm_scans(
+  sqlc.arg(limit_count)::int,
+  make_interval(secs => sqlc.arg(lease_seconds)::int)
+) AS c(org_id);
+
+-- name: FinishPMScan :exec
+UPDATE app.pm_scans
+SET next_scan_at = sqlc.arg(next_scan_at)::timestamptz,
+    last_scan_at = now(),
+    last_error = sqlc.narg(last_error)::text
+WHERE org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertPMOccurrence :one
+INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_on, due_reading, work_order_id, status, note)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(pm_id)::uuid,
+  sqlc.arg(trigger)::text,
+  sqlc.narg(due_on)::date,
+  sqlc.narg(due_reading)::float8,
+  sqlc.narg(work_order_id)::uuid,
+  sqlc.arg(status)::text,
+  sqlc.narg(note)::text
+)
+ON CONFLICT DO NOTHING
+RETURNING id, created_at;
+
+-- name: LastPMOccurrence :one
+SELECT o.id,
+       o.pm_id,
+       o.trigger,
+       o.due_on,
+       o.due_reading,
+       o.work_order_id,
+       o.status,
+       o.note,
+       o.created_at
+FROM app.pm_occurrences o
+WHERE o.pm_id = sqlc.arg(pm_id)::uuid
+  AND o.org_id = sqlc.arg(org_id)::uuid
+  AND o.trigger = sqlc.arg(trigger)::text
+ORDER BY o.due_on DESC NULLS LAST, o.due_reading DESC NULLS LAST
+LIMIT 1;
+
+-- name: LastPMWorkOrder :one
+SELECT o.work_order_id
+FROM app.pm_occurrences o
+WHERE o.pm_id = sqlc.arg(pm_id)::uuid
+  AND o.org_id = sqlc.arg(org_id)::uuid
+  AND o.work_order_id IS NOT NULL
+ORDER BY o.id DESC
+LIMIT 1;
+
+-- name: ListPMOccurrences :many
+SELECT o.id,
+       o.pm_id,
+       o.trigger,
+       o.due_on,
+       o.due_reading,
+       o.work_order_id,
+       o.status,
+       o.note,
+       o.created_at
+FROM app.pm_occurrences o
+WHERE o.pm_id = sqlc.arg(pm_id)::uuid
+  AND o.org_id = sqlc.arg(org_id)::uuid
+ORDER BY o.id DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: RequestPMScan :exec
+-- Brings the next scan of an org forward, e.g. when a meter reading changes.
+UPDATE app.pm_scans
+SET next_scan_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid
+  AND next_scan_at > now();
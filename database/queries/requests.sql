@@ -0,0 +1,50 @@
+-- name: GetRequestPortal :one
+SELECT p.key, p.enabled, p.title, p.intro, p.captcha, p.photos, p.default_priority,
+       p.updated_by, p.updated_at
+FROM app.request_portals p
+WHERE p.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: SaveRequestPortal :one
+-- key only applies to a new portal; an existing one keeps its key.
+INSERT INTO app.request_portals (org_id, key, enabled, title, intro, captcha, photos, default_priority, updated_by)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(key)::text,
+  sqlc.arg(enabled)::boolean,
+  sqlc.arg(title)::text,
+  sqlc.narg(intro)::text,
+  sqlc.arg(captcha)::boolean,
+  sqlc.arg(photos)::boolean,
+  sqlc.narg(default_priority)::text,
+  sqlc.narg(updated_by)::uuid
+)
+ON CONFLICT (org_id) DO UPDATE
+SET enabled = EXCLUDED.enabled,
+    title = EXCLUDED.title,
+    intro = EXCLUDED.intro,
+    captcha = EXCLUDED.captcha,
+    photos = EXCLUDED.photos,
+    default_priority = EXCLUDED.default_priority,
+    updated_by = EXCLUDED.updated_by,
+    updated_at = now()
+RETURNING key, enabled, title, intro, captcha, photos, default_priority, updated_by, updated_at;
+
+-- name: SetRequestPortalKey :execrows
+UPDATE app.request_portals
+SET key = sqlc.arg(key)::text,
+    updated_by = sqlc.narg(updated_by)::uuid,
+    updated_at = now()
+WHERE org_id = sqlc.arg(org_id)::uuid;
+
+-- name: RequestPortalOrg :one
+-- The org of the enabled portal with a key; no org scope is needed.
+SELECT app.request_portal_org(sqlc.arg(key)::text)::uuid AS org_id;
+
+-- name: InsertRequestToken :exec
+INSERT INTO app.request_tokens (token_hash, org_id, row_id)
+VALUES (sqlc.arg(token_hash)::text, sqlc.arg(org_id)::uuid, sqlc.arg(row_id)::uuid);
+
+-- name: RequestTokenRow :one
+-- The request of a token; no org scope is needed.
+SELECT t.org_id::uuid AS org_id, t.row_id::uuid AS row_id, t.created_at::timestamptz AS created_at
+FROM app.request_token_row(sqlc.arg(token_hash)::text) AS t(org_id, row_id, created_at);
@@ -0,0 +1,26 @@
+-- name: StreamRowEvents :many
+SELECT e.id::bigint AS id,
+       e.txid::bigint AS txid,
+       e.type::text AS type,
+       e.row_id::uuid AS row_id,
+       e.data::jsonb AS data,
+       e.previous::jsonb AS previous,
+       e.created_at::timestamptz AS created_at
+FROM app.stream_row_events(
+  sqlc.arg(table_id)::bigint,
+  sqlc.arg(after_txid)::bigint,
+  sqlc.arg(after_id)::bigint,
+  sqlc.arg(limit_count)::int
+) AS e(id, txid, type, row_id, data, previous, created_at);
+
+-- name: RowEventHorizon :one
+-- The event horizon, and whether committed events of the table wait above
+-- it for older transactions to end.
+SELECT h.horizon::bigint AS horizon,
+       EXISTS (
+         SELECT 1 FROM app.events e
+         WHERE e.table_id = sqlc.arg(table_id)::bigint
+           AND e.type IN ('row.created', 'row.updated', 'row.deleted')
+           AND e.txid >= h.horizon
+       )::boolean AS held
+FROM (SELECT app.event_horizon() AS horizon) h;
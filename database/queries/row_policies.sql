@@ -0,0 +1,46 @@
+-- name: ListRowPolicies :many
+SELECT p.id,
+       p.name,
+       COALESCE(p.role::text, '')::text AS role,
+       p.user_id,
+       u.email      AS user_email,
+       p.team_id,
+       p.expression,
+       p.refs
+FROM app.row_policies p
+LEFT JOIN users u ON u.id = p.user_id
+WHERE p.table_id = sqlc.arg(table_id)::bigint
+  AND p.org_id = sqlc.arg(org_id)::uuid
+ORDER BY p.id;
+
+-- name: DeleteRowPolicies :exec
+DELETE FROM app.row_policies
+WHERE table_id = sqlc.arg(table_id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertRowPolicy :exec
+INSERT INTO app.row_policies (
+  org_id, table_id, name, role, user_id, team_id,
+  expression, expression_sql, refs
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(table_id)::bigint,
+  sqlc.arg(name)::text,
+  sqlc.narg(role)::text::org_role,
+  sqlc.narg(user_id)::uuid,
+  sqlc.narg(team_id)::uuid,
+  sqlc.arg(expression)::text,
+  sqlc.arg(expression_sql)::text,
+  sqlc.arg(refs)::text[]
+);
+
+-- name: RowPoliciesUsingColumn :many
+SELECT p.name
+FROM app.row_policies p
+JOIN app.tables t ON t.id = p.table_id
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+  AND (t.slug = lower(sqlc.arg(table_name)::text)
+       OR lower(t.name) = lower(sqlc.arg(table_name)::text))
+  AND lower(sqlc.arg(column_name)::text) = ANY(p.refs)
+ORDER BY p.id;
@@ -0,0 +1,106 @@
+-- name: SearchOrgRows :many
+WITH params AS (
+  SELECT
+    sqlc.arg(org_id)::uuid AS org_id,
+    sqlc.arg(q)::text      AS q,
+    app.like_contains(sqlc.arg(q)::text) AS pattern,
+    websearch_to_tsquery('english', sqlc.arg(q)::text) AS tsq,
+    GREATEST(1, LEAST(sqlc.arg(per_table)::int, 50))  AS per_table
+),
+org_columns AS (
+  SELECT c.id AS column_id, c.name AS column_name,
+         t.id AS table_id, t.slug AS table_slug, t.name AS table_name
+  FROM app.columns c
+  JOIN app.tables t ON t.id = c.table_id
+  WHERE t.org_id = (SELECT org_id FROM params)
+    AND c.kind = 'value'
+    AND c.type IN ('text','enum')
+    AND app.field_visible(c.read_role)
+),
+hits AS (
+  SELECT vt.row_id, vt.column_id, vt.value,
+         vt.tsv @@ p.tsq AS ts_match,
+         ts_rank_cd(vt.tsv, p.tsq) AS ts_rank,
+         similarity(vt.value, p.q) AS sim
+  FROM app.values_text vt
+  CROSS JOIN params p
+  WHERE vt.column_id IN (SELECT column_id FROM org_columns)
+    AND (vt.tsv @@ p.tsq OR vt.value ILIKE p.pattern OR vt.value % p.q)
+  UNION ALL
+  SELECT ve.row_id, ve.column_id, ve.value,
+         ve.tsv @@ p.tsq AS ts_match,
+         ts_rank_cd(ve.tsv, p.tsq) AS ts_rank,
+         similarity(ve.value, p.q) AS sim
+  FROM app.values_enum ve
+  CROSS JOIN params p
+  WHERE ve.column_id IN (SELECT column_id FROM org_columns)
+    AND (ve.tsv @@ p.tsq OR ve.value ILIKE p.pattern OR ve.value % p.q)
+  UNION ALL
+  -- Relational tables have no stored tsvector; it is computed on the fly
+  SELECT pv.row_id, oc.column_id, pv.value,
+         to_tsvector('english', pv.value) @@ p.tsq AS ts_match,
+         ts_rank_cd(to_tsvector('english', pv.value), p.tsq) AS ts_rank,
+         similarity(pv.value, p.q) AS sim
+  FROM org_columns oc
+  CROSS JOIN params p
+  CROSS JOIN LATERAL app.physical_text_values(oc.column_id, p.q, p.tsq) pv
+),
+best AS (
+  -- One hit per row: word matches outrank substring/fuzzy ones
+  SELECT DISTINCT ON (h.row_id)
+    h.row_id, h.column_id, h.value,
+    ((CASE WHEN h.ts_match THEN 1 + h.ts_rank ELSE 0 END) + h.sim)::float8 AS rank
+  FROM hits h
+  ORDER BY h.row_id, ((CASE WHEN h.ts_match THEN 1 + h.ts_rank ELSE 0 END) + h.sim) DESC
+),
+  -- Tables whose row policies apply to the caller, and their visible rows
+restricted AS (
+  SELECT t.table_id
+  FROM (SELECT DISTINCT table_id FROM org_columns) t
+  WHERE app.rows_restricted(t.table_id)
+),
+visible AS (
+  SELECT v.row_id
+  FROM restricted rt
+  CROSS JOIN LATERAL app.visible_rows(rt.table_id) v(row_id)
+),
+ranked AS (
+  SELECT b.row_id, b.value, b.rank,
+         oc.table_id, oc.table_slug, oc.table_name, oc.column_name,
+         row_number() OVER (PARTITION BY oc.table_id ORDER BY b.rank DESC, b.row_id) AS rn,
+         max(b.rank)  OVER (PARTITION BY oc.table_id) AS table_rank,
+         count(*)     OVER (PARTITION BY oc.table_id) AS table_total
+  FROM best b
+  JOIN org_columns oc ON oc.column_id = b.column_id
+  WHERE oc.table_id NOT IN (SELECT table_id FROM restricted)
+     OR b.row_id IN (SELECT row_id FROM visible)
+),
+label_col AS (
+  SELECT DISTINCT ON (c.table_id) c.table_id, c.id AS column_id
+  FROM app.columns c
+  WHERE c.table_id IN (SELECT table_id FROM ranked)
+    AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
+  ORDER BY c.table_id,
+    (lower(c.name) = 'title') DESC,
+    c.is_indexed DESC,
+    c.id
+)
+SELECT
+  r.table_id,
+  r.table_slug,
+  r.table_name,
+  r.table_total,
+  r.row_id,
+  label,
+  r.column_name AS matched_column,
+  snippet,
+  r.rank
+FROM ranked r
+CROSS JOIN params p
+LEFT JOIN label_col lc ON lc.table_id = r.table_id
+CROSS JOIN LATERAL app.cell_text(r.row_id, lc.column_id) AS label
+CROSS JOIN LATERAL app.search_snippet(r.value, p.q, p.tsq) AS snippet
+WHERE r.rn <= p.per_table
+ORDER BY r.table_rank DESC, r.table_id, r.rank DESC;
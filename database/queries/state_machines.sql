@@ -0,0 +1,56 @@
+-- name: ListStateMachines :many
+SELECT m.id,
+       m.table_id,
+       t.slug AS table_slug,
+       m.column_name,
+       m.initial,
+       m.transitions,
+       m.states,
+       m.refs,
+       m.created_at,
+       m.updated_at
+FROM app.state_machines m
+JOIN app.tables t ON t.id = m.table_id
+WHERE m.table_id = sqlc.arg(table_id)::bigint
+  AND m.org_id = sqlc.arg(org_id)::uuid
+ORDER BY lower(m.column_name);
+
+-- name: UpsertStateMachine :exec
+INSERT INTO app.state_machines (org_id, table_id, column_name, initial, transitions, states, refs)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(table_id)::bigint,
+  sqlc.arg(column_name)::text,
+  sqlc.arg(initial)::text[],
+  sqlc.arg(transitions)::jsonb,
+  sqlc.arg(states)::jsonb,
+  sqlc.arg(refs)::text[]
+)
+ON CONFLICT (table_id, lower(column_name)) DO UPDATE
+SET column_name = EXCLUDED.column_name,
+    initial = EXCLUDED.initial,
+    transitions = EXCLUDED.transitions,
+    states = EXCLUDED.states,
+    refs = EXCLUDED.refs,
+    updated_at = now();
+
+-- name: DeleteStateMachine :execrows
+DELETE FROM app.state_machines
+WHERE table_id = sqlc.arg(table_id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid
+  AND lower(column_name) = lower(sqlc.arg(column_name)::text);
+
+-- name: StateMachinesUsingColumn :many
+SELECT m.column_name
+FROM app.state_machines m
+WHERE m.table_id = sqlc.arg(table_id)::bigint
+  AND m.org_id = sqlc.arg(org_id)::uuid
+  AND lower(sqlc.arg(column_name)::text) = ANY(m.refs)
+ORDER BY lower(m.column_name);
+
+-- name: EvalRowExprs :one
+SELECT app.eval_row_exprs(
+  sqlc.arg(data)::jsonb,
+  sqlc.narg(previous)::jsonb,
+  sqlc.arg(exprs)::jsonb
+) AS values;
@@ -0,0 +1,60 @@
+-- name: ListTableStorage :many
+SELECT t.id, t.name, t.slug, t.storage_mode, t.physical_table, t.migrated_at,
+       (SELECT count(*) FROM app.rows r WHERE r.table_id = t.id) AS row_count
+FROM app.tables t
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+ORDER BY t.name;
+
+-- name: GetTableStorage :one
+SELECT t.id, t.name, t.slug, t.storage_mode, t.physical_table, t.migrated_at,
+       (SELECT count(*) FROM app.rows r WHERE r.table_id = t.id) AS row_count
+FROM app.tables t
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+  AND (t.slug = lower(sqlc.arg(table_name)::text)
+       OR lower(t.name) = lower(sqlc.arg(table_name)::text))
+LIMIT 1;
+
+-- name: EnsurePhysicalTable :one
+-- Creates the physical table and switches the table to dual writes.
+SELECT app.ensure_physical_table(t.id)::text AS physical_table
+FROM app.tables t
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: BackfillPhysicalTable :one
+-- A batch size of 0 copies every missing row.
+SELECT app.backfill_physical_table(t.id, NULLIF(sqlc.arg(batch_size)::int, 0)) AS copied
+FROM app.tables t
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: ListPhysicalTableDrift :many
+SELECT d.row_id::uuid AS row_id
+FROM app.tables t
+CROSS JOIN LATERAL app.physical_table_drift(t.id, NULLIF(sqlc.arg(limit_count)::int, 0)) AS d(row_id)
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: SyncPhysicalRow :exec
+SELECT app.sync_physical_row(r.id)
+FROM app.rows r
+WHERE r.id = sqlc.arg(row_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: CutOverRelational :exec
+SELECT app.cut_over_relational(t.id)
+FROM app.tables t
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: RevertRelational :exec
+SELECT app.revert_relational(t.id)
+FROM app.tables t
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: DropPhysicalTable :exec
+SELECT app.drop_physical_table(t.id)
+FROM app.tables t
+WHERE t.id = sqlc.arg(table_id)::bigint
+  AND t.org_id = sqlc.arg(org_id)::uuid;
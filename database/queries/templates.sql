@@ -0,0 +1,14 @@
+-- name: ListTemplateInstalls :many
+SELECT org_id, template, version, installed_at, updated_at
+FROM app.template_installs
+WHERE org_id = sqlc.arg(org_id)::uuid
+ORDER BY template;
+
+-- name: RecordTemplateInstall :one
+INSERT INTO app.template_installs (org_id, template, version)
+VALUES (sqlc.arg(org_id)::uuid, sqlc.arg(template)::text, sqlc.arg(version)::int)
+ON CONFLICT (org_id, template) DO UPDATE
+  SET version    = GREATEST(app.template_installs.version, EXCLUDED.version),
+      updated_at = CASE WHEN EXCLUDED.version > app.template_installs.version
+                        THEN now() ELSE app.template_installs.updated_at END
+RETURNING org_id, template, version, installed_at, updated_at;
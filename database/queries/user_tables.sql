@@ -6,12 +6,11 @@ WITH params AS (
     sqlc.arg(org_id)::uuid     AS org_id
 ),
 table_id AS (
-  SELECT id
+  SELECT id, storage_mode
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
     AND t.org_id = (SELECT org_id FROM params)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
   LIMIT 1
 ),
 page AS (
@@ -25,14 +24,47 @@ ff AS (
   FROM params
   WHERE (p ? 'filterFields') AND jsonb_typeof(p->'filterFields') = 'array'
 ),
+  -- "under" filters match a row and, when its table has a hierarchy, the rows
+  -- below it; each set is computed once
+under AS (
+  SELECT ff.f,
+         ARRAY(SELECT app.row_and_descendants(c.reference_table_id, (ff.f->>'value')::uuid)) AS ids
+  FROM ff
+  JOIN app.columns c ON c.table_id = (SELECT id FROM table_id)
+    AND lower(c.name) = lower(ff.f->>'field')
+  WHERE c.type = 'uuid' AND ff.f->>'operation' = 'under'
+),
+sort AS (
+  SELECT
+    NULLIF(lower(p->>'sortField'), '')                AS field,
+    lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc' AS descending
+  FROM params
+),
+sort_col AS (
+  SELECT c.id
+  FROM app.columns c
+  WHERE c.table_id = (SELECT id FROM table_id)
+    AND c.name = (SELECT field FROM sort)
+),
+scope AS (
+  SELECT app.rows_restricted(id) AS restricted FROM table_id
+),
+  -- Rows are filtered and sorted on single cells; only the page is composed
 filtered AS (
   SELECT 
     b.id,
     b.created_at,
-    app.row_to_json(b.id) as data,
+    NULLIF(CASE
+      WHEN (SELECT field FROM sort) = 'id' THEN to_jsonb(b.id)
+      WHEN (SELECT field FROM sort) = 'created_at' THEN to_jsonb(b.created_at)
+      WHEN (SELECT id FROM sort_col) IS NOT NULL THEN app.cell_value(b.id, (SELECT id FROM sort_col))
+    END, 'null'::jsonb) AS sort_key,
     COUNT(*) OVER() AS total_count
   FROM app.rows b
   WHERE b.table_id = (SELECT id FROM table_id)
+  AND (SELECT storage_mode FROM table_id) <> 'relational'
+  AND (NOT (SELECT restricted FROM scope)
+       OR b.id IN (SELECT app.visible_rows((SELECT id FROM table_id))))
   AND (
     NOT EXISTS (SELECT 1 FROM ff) OR
     EXISTS (
@@ -42,6 +74,8 @@ filtered AS (
         AND lower(c.name) = lower(f->>'field')
       WHERE 
         CASE
+          WHEN c.kind IN ('computed', 'rollup') THEN
+            COALESCE(app.match_computed(app.cell_value(b.id, c.id), f), FALSE)
           WHEN c.type = 'text' THEN EXISTS (
             SELECT 1 FROM app.values_text vt
             WHERE vt.row_id = b.id AND vt.column_id = c.id AND (
@@ -68,19 +102,61 @@ filtered AS (
             WHERE vb.row_id = b.id AND vb.column_id = c.id 
             AND vb.value IS NOT DISTINCT FROM ((f->>'value')::boolean)
           )
+          WHEN c.type = 'uuid' THEN EXISTS (
+            SELECT 1 FROM app.values_uuid vu
+            WHERE vu.row_id = b.id AND vu.column_id = c.id AND (
+              CASE COALESCE(f->>'operation','eq')
+                WHEN 'eq' THEN vu.value = (f->>'value')::uuid
+                WHEN 'in' THEN vu.value = ANY(ARRAY(SELECT jsonb_array_elements_text(f->'values'))::uuid[])
+                WHEN 'under' THEN vu.value = ANY((SELECT u.ids FROM under u WHERE u.f = ff.f))
+                ELSE TRUE
+              END
+            )
+          )
           ELSE TRUE
         END
     )
   )
+),
+eav_ids AS (
+  SELECT f.id, f.created_at, f.total_count
+  FROM filtered f
+  ORDER BY
+    CASE WHEN NOT (SELECT descending FROM sort) THEN f.sort_key END ASC NULLS LAST,
+    CASE WHEN (SELECT descending FROM sort) THEN f.sort_key END DESC NULLS LAST,
+    f.created_at DESC
+  LIMIT (SELECT page_size FROM page)
+  OFFSET (SELECT page_size * page_num FROM page)
+),
+eav_page AS (
+  SELECT e.id AS row_id, e.created_at, j.data::jsonb AS data, e.total_count
+  FROM eav_ids e
+  JOIN app.rows_to_json((SELECT id FROM table_id), ARRAY(SELECT id FROM eav_ids)) AS j(row_id, data)
+    ON j.row_id = e.id
+),
+  -- Relational tables are filtered, sorted and paged by the engine itself
+relational_page AS (
+  SELECT s.row_id, s.created_at, s.data, s.total_count
+  FROM app.search_relational((SELECT id FROM table_id), (SELECT p FROM params))
+       AS s(row_id, created_at, data, total_count)
+  WHERE (SELECT storage_mode FROM table_id) = 'relational'
+),
+results AS (
+  SELECT * FROM eav_page
+  UNION ALL
+  SELECT * FROM relational_page
 )
 SELECT 
-  f.id AS row_id,
-  f.data,
-  f.total_count
-FROM filtered f
-ORDER BY f.created_at DESC
-LIMIT (SELECT page_size FROM page)
-OFFSET (SELECT page_size * page_num FROM page);
+  r.row_id,
+  app.mask_fields((SELECT id FROM table_id), r.data) AS data,
+  r.total_count
+FROM results r
+ORDER BY
+  CASE WHEN NOT (SELECT descending FROM sort)
+       THEN NULLIF(r.data -> (SELECT field FROM sort), 'null'::jsonb) END ASC NULLS LAST,
+  CASE WHEN (SELECT descending FROM sort)
+       THEN NULLIF(r.data -> (SELECT field FROM sort), 'null'::jsonb) END DESC NULLS LAST,
+  r.created_at DESC;
 
 -- name: GetUserTableSchema :many
 WITH params AS (
@@ -93,8 +169,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 )
 SELECT 
@@ -106,9 +181,28 @@ SELECT
   to_jsonb(c.enum_values) AS enum_values,
   c.is_reference,
   c.reference_table_id,
-  c.require_different_table
+  c.require_different_table,
+  c.kind,
+  c.expression,
+  c.rollup_aggregate,
+  rt.slug  AS rollup_table,
+  rv.name  AS rollup_via,
+  rtc.name AS rollup_target,
+  c.rollup_filter,
+  COALESCE(c.read_role::text, '')::text AS read_role,
+  COALESCE(c.edit_role::text, '')::text AS edit_role,
+  c.masked,
+  app.field_visible(c.read_role) AS visible,
+  app.field_editable(c.read_role, c.edit_role) AS editable
 FROM app.columns c
+LEFT JOIN app.columns rv  ON rv.id = c.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = c.rollup_target_column_id
 WHERE c.table_id = (SELECT id FROM table_id)
+  -- columns hidden from the caller are left out unless they are masked
+  AND (c.masked OR app.field_visible(c.read_role))
+  -- as are aggregates over rows the caller may not all see
+  AND NOT app.aggregate_restricted(c.id)
 ORDER BY c.id ASC;
 
 -- name: CreateUserTable :one
@@ -146,15 +240,21 @@ WITH params AS (
     sqlc.arg(enum_values)::jsonb   AS enum_values,
     sqlc.arg(is_reference)::boolean AS is_reference,
     sqlc.arg(reference_table)::text AS reference_table,
-    sqlc.arg(require_different_table)::boolean AS require_different_table
+    sqlc.arg(require_different_table)::boolean AS require_different_table,
+    sqlc.arg(kind)::text AS kind,
+    sqlc.narg(expression)::text AS expression,
+    sqlc.narg(expression_sql)::text AS expression_sql,
+    sqlc.narg(rollup_via_column_id)::bigint AS rollup_via_column_id,
+    sqlc.narg(rollup_target_column_id)::bigint AS rollup_target_column_id,
+    sqlc.narg(rollup_aggregate)::text AS rollup_aggregate,
+    sqlc.narg(rollup_filter)::jsonb AS rollup_filter
 ),
 table_id AS (
   SELECT id
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 cname AS (
@@ -169,14 +269,15 @@ ref_table_id AS (
     FROM app.tables t
     WHERE (t.slug = lower((SELECT ref FROM refname))
            OR lower(t.name) = lower((SELECT ref FROM refname)))
-      AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-    ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+      AND t.org_id = (SELECT org_id FROM params)
     LIMIT 1
   ) AS id
 ),
 ins AS (
   INSERT INTO app.columns (
-    table_id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table
+    table_id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table,
+    kind, expression, expression_sql,
+    rollup_via_column_id, rollup_target_column_id, rollup_aggregate, rollup_filter
   )
   SELECT 
     (SELECT id FROM table_id),
@@ -191,23 +292,40 @@ ins AS (
     ),
     (SELECT is_reference FROM params),
     (SELECT id FROM ref_table_id),
-    (SELECT require_different_table FROM params)
+    (SELECT require_different_table FROM params),
+    (SELECT kind FROM params),
+    (SELECT expression FROM params),
+    (SELECT expression_sql FROM params),
+    (SELECT rollup_via_column_id FROM params),
+    (SELECT rollup_target_column_id FROM params),
+    (SELECT rollup_aggregate FROM params),
+    (SELECT rollup_filter FROM params)
   ON CONFLICT (table_id, name) DO NOTHING
-  RETURNING id, table_id, name, type::text AS type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table
+  RETURNING id, table_id, name, type::text AS type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table,
+            kind, expression, rollup_via_column_id, rollup_target_column_id, rollup_aggregate, rollup_filter
 ),
 _ensure AS (
   SELECT CASE WHEN (SELECT is_indexed FROM params) THEN app.ensure_index(id) END FROM ins
 )
 SELECT true AS created,
-       id, table_id, name, type, is_required, is_indexed, to_jsonb(enum_values) AS enum_values,
-       is_reference, reference_table_id, require_different_table
+       ins.id, ins.table_id, ins.name, ins.type, ins.is_required, ins.is_indexed, to_jsonb(ins.enum_values) AS enum_values,
+       ins.is_reference, ins.reference_table_id, ins.require_different_table, ins.kind, ins.expression,
+       ins.rollup_aggregate, rt.slug AS rollup_table, rv.name AS rollup_via, rtc.name AS rollup_target, ins.rollup_filter
 FROM ins
+LEFT JOIN app.columns rv  ON rv.id = ins.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = ins.rollup_target_column_id
 UNION ALL
 SELECT false AS created,
        c.id, c.table_id, c.name, c.type::text AS type, c.is_required, c.is_indexed, to_jsonb(c.enum_values) AS enum_values,
-       c.is_reference, c.reference_table_id, c.require_different_table
-FROM app.columns c, cname
-WHERE c.table_id = (SELECT id FROM table_id) AND c.name = (SELECT name FROM cname)
+       c.is_reference, c.reference_table_id, c.require_different_table, c.kind, c.expression,
+       c.rollup_aggregate, rt.slug AS rollup_table, rv.name AS rollup_via, rtc.name AS rollup_target, c.rollup_filter
+FROM app.columns c
+CROSS JOIN cname
+LEFT JOIN app.columns rv  ON rv.id = c.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = c.rollup_target_column_id
+WHERE c.table_id = (SELECT id FROM table_id) AND c.name = cname.name
 LIMIT 1;
 
 -- name: InsertUserTableRow :one
@@ -222,17 +340,51 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 ins AS (
-  SELECT app.insert_row((SELECT id FROM table_id), (SELECT values FROM params)) AS row_id
+  SELECT app.insert_row(
+           (SELECT id FROM table_id),
+           app.check_field_writes((SELECT id FROM table_id), (SELECT values FROM params))
+         ) AS row_id
 )
 SELECT i.row_id,
-       app.row_to_json(i.row_id) AS data
+       app.mask_fields((SELECT id FROM table_id), app.row_to_json(i.row_id)) AS data
 FROM ins i;
 
+-- name: UpdateUserTableRow :one
+WITH params AS (
+  SELECT
+    sqlc.arg(org_id)::uuid     AS org_id,
+    sqlc.arg(table_name)::text AS table_name,
+    sqlc.arg(row_id)::uuid     AS row_id,
+    sqlc.arg(values)::jsonb    AS values
+),
+table_id AS (
+  SELECT id
+  FROM app.tables t
+  WHERE (t.slug = lower((SELECT table_name FROM params))
+         OR lower(t.name) = lower((SELECT table_name FROM params)))
+    AND t.org_id = (SELECT org_id FROM params)
+  LIMIT 1
+),
+target AS (
+  SELECT r.id
+  FROM app.rows r
+  WHERE r.id = (SELECT row_id FROM params)
+    AND r.table_id = (SELECT id FROM table_id)
+    AND app.row_visible(r.id)
+),
+upd AS (
+  SELECT t.id AS row_id,
+         app.update_row(t.id, app.check_field_writes((SELECT id FROM table_id), (SELECT values FROM params))) AS updated
+  FROM target t
+)
+SELECT u.row_id,
+       app.mask_fields((SELECT id FROM table_id), app.row_to_json(u.row_id)) AS data
+FROM upd u;
+
 -- name: DeleteUserTable :one
 WITH params AS (
   SELECT
@@ -261,15 +413,15 @@ SELECT (SELECT COUNT(*) > 0 FROM del) AS deleted,
 
 -- name: GetRowData :one
 WITH r AS (
-  SELECT r.id
+  SELECT r.id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   WHERE r.id = sqlc.arg(row_id)::uuid
-    AND t.org_id = sqlc.arg(org_id)::uuid
+    AND r.org_id = sqlc.arg(org_id)::uuid
+    AND app.row_visible(r.id)
 )
 SELECT EXISTS(SELECT 1 FROM r) AS found,
        CASE WHEN EXISTS(SELECT 1 FROM r)
-            THEN app.row_to_json(sqlc.arg(row_id)::uuid)
+            THEN app.mask_fields((SELECT table_id FROM r), app.row_to_json(sqlc.arg(row_id)::uuid))
             ELSE NULL
        END AS data;
 
@@ -287,8 +439,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 label_col AS (
@@ -296,6 +447,8 @@ label_col AS (
   FROM app.columns c
   WHERE c.table_id = (SELECT id FROM table_id)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
     AND ((SELECT field FROM params) IS NULL OR lower(c.name) = lower((SELECT field FROM params)))
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
@@ -319,9 +472,17 @@ results AS (
     AND ve.column_id = (SELECT id FROM label_col)
     AND r.table_id = (SELECT id FROM table_id)
     AND ((SELECT q FROM params) IS NULL OR ve.value ILIKE '%' || (SELECT q FROM params) || '%')
+  UNION ALL
+  SELECT pv.row_id, pv.value AS label
+  FROM app.physical_text_values((SELECT id FROM label_col), (SELECT q FROM params), NULL) pv
+),
+scope AS (
+  SELECT app.rows_restricted(id) AS restricted FROM table_id
 )
 SELECT row_id, label
 FROM results
+WHERE NOT (SELECT restricted FROM scope)
+   OR row_id IN (SELECT app.visible_rows((SELECT id FROM table_id)))
 ORDER BY label ASC NULLS LAST
 LIMIT (SELECT lim FROM params);
 
@@ -338,76 +499,58 @@ JOIN app.columns c ON c.table_id = t.id
 WHERE t.org_id = sqlc.arg(org_id)::uuid
   AND c.is_indexed
   AND c.type IN ('text','enum')
+  AND c.kind = 'value'
+  AND app.field_visible(c.read_role)
 ORDER BY t.name ASC, c.name ASC;
 
 -- name: GetRowLabel :one
-WITH label_col AS (
+WITH r AS (
+  SELECT r.id, r.table_id
+  FROM app.rows r
+  WHERE r.id = sqlc.arg(row_id)::uuid
+    AND r.table_id = sqlc.arg(table_id)::bigint
+    AND r.org_id = sqlc.arg(org_id)::uuid
+    AND app.row_visible(r.id)
+),
+label_col AS (
   SELECT c.id, c.name, c.type::text AS type
   FROM app.columns c
-  WHERE c.table_id = sqlc.arg(table_id)::bigint
+  WHERE c.table_id = (SELECT table_id FROM r)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
     c.id
   LIMIT 1
 )
-SELECT COALESCE(
-  (
-    SELECT vt.value
-    FROM app.values_text vt
-    JOIN app.rows r ON r.id = vt.row_id
-    JOIN app.tables t ON t.id = r.table_id
-    WHERE vt.row_id = sqlc.arg(row_id)::uuid
-      AND vt.column_id = (SELECT id FROM label_col)
-      AND r.table_id = sqlc.arg(table_id)::bigint
-      AND t.org_id = sqlc.arg(org_id)::uuid
-  ),
-  (
-    SELECT ve.value
-    FROM app.values_enum ve
-    JOIN app.rows r ON r.id = ve.row_id
-    JOIN app.tables t ON t.id = r.table_id
-    WHERE ve.row_id = sqlc.arg(row_id)::uuid
-      AND ve.column_id = (SELECT id FROM label_col)
-      AND r.table_id = sqlc.arg(table_id)::bigint
-      AND t.org_id = sqlc.arg(org_id)::uuid
-  )
-) AS label;
+SELECT label
+FROM app.cell_text((SELECT id FROM r), (SELECT id FROM label_col)) AS label;
 
 -- name: GetRowLabelAuto :one
 WITH r AS (
   SELECT r.id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   WHERE r.id = sqlc.arg(row_id)::uuid
-    AND t.org_id = sqlc.arg(org_id)::uuid
+    AND r.org_id = sqlc.arg(org_id)::uuid
+    AND app.row_visible(r.id)
 ),
 label_col AS (
   SELECT c.id, c.name, c.type::text AS type
   FROM app.columns c
   WHERE c.table_id = (SELECT table_id FROM r)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
     c.id
   LIMIT 1
 )
-SELECT COALESCE(
-  (
-    SELECT vt.value
-    FROM app.values_text vt
-    WHERE vt.row_id = (SELECT id FROM r)
-      AND vt.column_id = (SELECT id FROM label_col)
-  ),
-  (
-    SELECT ve.value
-    FROM app.values_enum ve
-    WHERE ve.row_id = (SELECT id FROM r)
-      AND ve.column_id = (SELECT id FROM label_col)
-  )
-) AS label;
+SELECT label
+FROM app.cell_text((SELECT id FROM r), (SELECT id FROM label_col)) AS label;
 
 -- name: BatchGetRowLabels :many
 WITH params AS (
@@ -424,6 +567,8 @@ label_col AS (
   FROM app.columns c
   WHERE c.table_id = (SELECT table_id FROM params)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
@@ -433,23 +578,23 @@ label_col AS (
 rows AS (
   SELECT r.id AS row_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   JOIN input i ON i.row_id = r.id
   WHERE r.table_id = (SELECT table_id FROM params)
-    AND t.org_id = (SELECT org_id FROM params)
+    AND r.org_id = (SELECT org_id FROM params)
+    AND r.id IN (SELECT app.visible_rows((SELECT table_id FROM params), ARRAY(SELECT row_id FROM input)))
 )
 SELECT 
   rows.row_id,
-  COALESCE(vt.value, ve.value) AS label
+  label
 FROM rows
-LEFT JOIN app.values_text vt ON vt.row_id = rows.row_id AND vt.column_id = (SELECT id FROM label_col)
-LEFT JOIN app.values_enum ve ON ve.row_id = rows.row_id AND ve.column_id = (SELECT id FROM label_col);
+CROSS JOIN LATERAL app.cell_text(rows.row_id, (SELECT id FROM label_col)) AS label;
 
 -- name: BatchGetRowLabelsAuto :many
 WITH params AS (
   SELECT
     sqlc.arg(org_id)::uuid AS org_id,
-    sqlc.arg(ids)::jsonb   AS ids
+    sqlc.arg(ids)::jsonb   AS ids,
+    sqlc.arg(table_ids)::bigint[] AS table_ids
 ),
 input AS (
   SELECT (jsonb_array_elements_text((SELECT ids FROM params)))::uuid AS row_id
@@ -457,13 +602,17 @@ input AS (
 rows AS (
   SELECT r.id AS row_id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id AND t.org_id = (SELECT org_id FROM params)
   JOIN input i ON i.row_id = r.id
+  WHERE r.org_id = (SELECT org_id FROM params)
+    AND r.table_id = ANY((SELECT table_ids FROM params))
+    AND app.row_visible(r.id)
 ),
 label_col AS (
   SELECT DISTINCT ON (c.table_id) c.table_id, c.id AS label_col_id
   FROM app.columns c
   WHERE c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY c.table_id,
     (lower(c.name) = 'title') DESC,
     c.is_indexed DESC,
@@ -471,11 +620,10 @@ label_col AS (
 )
 SELECT 
   rows.row_id,
-  COALESCE(vt.value, ve.value) AS label
+  label
 FROM rows
 LEFT JOIN label_col lc ON lc.table_id = rows.table_id
-LEFT JOIN app.values_text vt ON vt.row_id = rows.row_id AND vt.column_id = lc.label_col_id
-LEFT JOIN app.values_enum ve ON ve.row_id = rows.row_id AND ve.column_id = lc.label_col_id;
+CROSS JOIN LATERAL app.cell_text(rows.row_id, lc.label_col_id) AS label;
 
 -- name: DeleteUserTableRow :one
 WITH params AS (
@@ -497,6 +645,7 @@ target AS (
   FROM app.rows r
   WHERE r.id = (SELECT row_id FROM params)
     AND r.table_id = (SELECT id FROM table_id)
+    AND app.row_visible(r.id)
 ),
 del AS (
   DELETE FROM app.rows r
@@ -506,6 +655,43 @@ del AS (
 SELECT (SELECT COUNT(*) > 0 FROM del) AS deleted,
        (SELECT id FROM target) AS row_id;
 
+-- name: UpdateUserTableColumn :one
+-- Adjusts the attributes of a value column that can change without
+-- rewriting stored values. Only tables owned by the org are considered.
+WITH params AS (
+  SELECT
+    sqlc.arg(org_id)::uuid     AS org_id,
+    sqlc.arg(table_name)::text AS table_name,
+    sqlc.arg(column_name)::text AS column_name,
+    sqlc.arg(is_required)::boolean AS is_required,
+    sqlc.arg(is_indexed)::boolean  AS is_indexed,
+    sqlc.narg(enum_values)::jsonb  AS enum_values,
+    sqlc.arg(require_different_table)::boolean AS require_different_table
+),
+upd AS (
+  UPDATE app.columns c
+  SET is_required = p.is_required,
+      is_indexed  = p.is_indexed,
+      enum_values = CASE WHEN c.type = 'enum' AND p.enum_values IS NOT NULL
+                         THEN ARRAY(SELECT jsonb_array_elements_text(p.enum_values))
+                         ELSE c.enum_values END,
+      require_different_table = p.require_different_table
+  FROM params p, app.tables t
+  WHERE t.id = c.table_id
+    AND t.org_id = p.org_id
+    AND (t.slug = lower(p.table_name) OR lower(t.name) = lower(p.table_name))
+    AND c.name = lower(p.column_name)
+    AND c.kind = 'value'
+  RETURNING c.id, c.name, c.type::text AS type, c.is_required, c.is_indexed, to_jsonb(c.enum_values) AS enum_values,
+            c.is_reference, c.reference_table_id, c.require_different_table, c.kind, c.expression
+),
+ensured AS (
+  -- referenced below so the planner cannot skip it
+  SELECT count(CASE WHEN is_indexed THEN app.ensure_index(id) END) AS n FROM upd
+)
+SELECT id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table, kind, expression
+FROM upd, ensured;
+
 -- name: RemoveUserTableColumn :one
 WITH params AS (
   SELECT
@@ -518,8 +704,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 cname AS (
@@ -527,7 +712,8 @@ cname AS (
 ),
 target AS (
   SELECT c.id, c.table_id, c.name, c.type::text AS type, c.is_required, c.is_indexed,
-         c.enum_values, c.is_reference, c.reference_table_id, c.require_different_table
+         c.enum_values, c.is_reference, c.reference_table_id, c.require_different_table,
+         c.kind, c.expression
   FROM app.columns c
   WHERE c.table_id = (SELECT id FROM table_id) AND c.name = (SELECT name FROM cname)
   LIMIT 1
@@ -548,4 +734,26 @@ SELECT
   to_jsonb((SELECT enum_values FROM target)) AS enum_values,
   (SELECT is_reference FROM target) AS is_reference,
   (SELECT reference_table_id FROM target) AS reference_table_id,
-  (SELECT require_different_table FROM target) AS require_different_table;
+  (SELECT require_different_table FROM target) AS require_different_table,
+  (SELECT kind FROM target) AS kind,
+  (SELECT expression FROM target) AS expression;
+
+-- name: RefreshRollupColumn :exec
+SELECT app.refresh_rollup_column(sqlc.arg(column_id)::bigint);
+
+-- name: SetColumnAccess :one
+-- Replaces the field-level access rules of a column.
+UPDATE app.columns c
+SET read_role = sqlc.narg(read_role)::text::org_role,
+    edit_role = sqlc.narg(edit_role)::text::org_role,
+    masked    = sqlc.arg(masked)::boolean
+FROM app.tables t
+WHERE t.id = c.table_id
+  AND t.org_id = sqlc.arg(org_id)::uuid
+  AND (t.slug = lower(sqlc.arg(table_name)::text) OR lower(t.name) = lower(sqlc.arg(table_name)::text))
+  AND c.name = lower(sqlc.arg(column_name)::text)
+RETURNING c.id;
+
+-- name: ReferencingRows :many
+SELECT x.id::uuid AS id
+FROM app.referencing_rows(sqlc.arg(column_id)::bigint, sqlc.arg(target)::uuid) x(id);
@@ -0,0 +1,205 @@
+-- name: ListWebhooks :many
+SELECT w.id,
+       w.name,
+       w.url,
+       w.events,
+       w.table_id,
+       t.slug AS table_slug,
+       w.filter_expression,
+       w.filter_refs,
+       w.active,
+       w.created_at,
+       w.updated_at
+FROM app.webhooks w
+LEFT JOIN app.tables t ON t.id = w.table_id
+WHERE w.org_id = sqlc.arg(org_id)::uuid
+ORDER BY w.created_at, w.id;
+
+-- name: GetWebhook :one
+SELECT w.id,
+       w.name,
+       w.url,
+       w.events,
+       w.table_id,
+       t.slug AS table_slug,
+       w.filter_expression,
+       w.filter_refs,
+       w.active,
+       w.created_at,
+       w.updated_at
+FROM app.webhooks w
+LEFT JOIN app.tables t ON t.id = w.table_id
+WHERE w.id = sqlc.arg(id)::uuid
+  AND w.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: InsertWebhook :one
+INSERT INTO app.webhooks (
+  org_id, name, url, secret, events, table_id,
+  filter_expression, filter_sql, filter_refs, active
+)
+VALUES (
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(name)::text,
+  sqlc.arg(url)::text,
+  sqlc.arg(secret)::text,
+  sqlc.arg(events)::text[],
+  sqlc.narg(table_id)::bigint,
+  sqlc.narg(filter_expression)::text,
+  sqlc.narg(filter_sql)::text,
+  sqlc.arg(filter_refs)::text[],
+  sqlc.arg(active)::boolean
+)
+RETURNING id;
+
+-- name: UpdateWebhook :execrows
+UPDATE app.webhooks
+SET name = sqlc.arg(name)::text,
+    url = sqlc.arg(url)::text,
+    events = sqlc.arg(events)::text[],
+    table_id = sqlc.narg(table_id)::bigint,
+    filter_expression = sqlc.narg(filter_expression)::text,
+    filter_sql = sqlc.narg(filter_sql)::text,
+    filter_refs = sqlc.arg(filter_refs)::text[],
+    active = sqlc.arg(active)::boolean,
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM app.webhooks
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: SetWebhookSecret :execrows
+UPDATE app.webhooks
+SET secret = sqlc.arg(secret)::text,
+    updated_at = now()
+WHERE id = sqlc.arg(id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: WebhooksUsingColumn :many
+SELECT w.name
+FROM app.webhooks w
+JOIN app.tables t ON t.id = w.table_id
+WHERE t.org_id = sqlc.arg(org_id)::uuid
+  AND (t.slug = lower(sqlc.arg(table_name)::text)
+       OR lower(t.name) = lower(sqlc.arg(table_name)::text))
+  AND lower(sqlc.arg(column_name)::text) = ANY(w.filter_refs)
+ORDER BY w.created_at, w.id;
+
+-- name: ListWebhookDeliveries :many
+SELECT d.id,
+       d.event_id,
+       e.type AS event,
+       e.row_id,
+       d.status,
+       d.attempts,
+       d.next_attempt_at,
+       d.last_status,
+       d.last_error,
+       d.delivered_at,
+       d.created_at
+FROM app.webhook_deliveries d
+JOIN app.events e ON e.id = d.event_id
+WHERE d.webhook_id = sqlc.arg(webhook_id)::uuid
+  AND d.org_id = sqlc.arg(org_id)::uuid
+  AND (sqlc.narg(status)::text IS NULL OR d.status = sqlc.narg(status)::text)
+ORDER BY d.id DESC
+LIMIT sqlc.arg(limit_count)::int;
+
+-- name: RedeliverWebhookDelivery :execrows
+UPDATE app.webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = now(),
+    last_status = NULL,
+    last_error = NULL,
+    delivered_at = NULL
+WHERE id = sqlc.arg(id)::bigint
+  AND webhook_id = sqlc.arg(webhook_id)::uuid
+  AND org_id = sqlc.arg(org_id)::uuid;
+
+-- name: PingWebhook :one
+WITH w AS (
+  SELECT wh.id, wh.org_id
+  FROM app.webhooks wh
+  WHERE wh.id = sqlc.arg(webhook_id)::uuid
+    AND wh.org_id = sqlc.arg(org_id)::uuid
+), ev AS (
+  INSERT INTO app.events (id, org_id, type, actor_id, payload)
+  SELECT n.id, w.org_id, 'ping', app.current_user_id(),
+         jsonb_strip_nulls(jsonb_build_object(
+           'id', n.id::text,
+           'type', 'ping',
+           'created_at', now(),
+           'actor_id', app.current_user_id(),
+           'data', jsonb_build_object('webhook_id', w.id)
+         ))
+  FROM w, (SELECT nextval(pg_get_serial_sequence('app.events', 'id')) AS id) n
+  RETURNING id, org_id
+)
+INSERT INTO app.webhook_deliveries (org_id, webhook_id, event_id)
+SELECT ev.org_id, sqlc.arg(webhook_id)::uuid, ev.id
+FROM ev
+RETURNING id;
+
+-- name: GetRowSnapshot :one
+SELECT app.row_to_json(r.id) AS data
+FROM app.rows r
+WHERE r.id = sqlc.arg(row_id)::uuid
+  AND r.org_id = sqlc.arg(org_id)::uuid;
+
+-- name: EmitRowEvent :one
+SELECT app.emit_event(
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(type)::text,
+  sqlc.arg(table_id)::bigint,
+  sqlc.arg(row_id)::uuid,
+  CASE WHEN sqlc.arg(type)::text <> 'row.deleted'
+       THEN app.row_to_json(sqlc.arg(row_id)::uuid)
+  END,
+  sqlc.narg(previous)::jsonb
+) AS event_id;
+
+-- name: EmitSchemaEvent :one
+SELECT app.emit_event(
+  sqlc.arg(org_id)::uuid,
+  sqlc.arg(type)::text,
+  sqlc.arg(table_id)::bigint,
+  NULL,
+  sqlc.arg(data)::jsonb,
+  NULL
+) AS event_id;
+
+-- name: ClaimWebhookDeliveries :many
+SELECT c.id::bigint AS id, c.org_id::uuid AS org_id
+FROM app.claim_webhook_deliveries(
+  sqlc.arg(limit_count)::int,
+  make_interval(secs => sqlc.arg(lease_seconds)::int)
+) AS c(id, org_id);
+
+-- name: GetWebhookAttempt :one
+SELECT d.id AS delivery_id,
+       d.webhook_id,
+       d.attempts,
+       w.active,
+       w.url,
+       w.secret,
+       e.type AS event,
+       e.payload
+FROM app.webhook_deliveries d
+JOIN app.webhooks w ON w.id = d.webhook_id
+JOIN app.events e ON e.id = d.event_id
+WHERE d.id = sqlc.arg(id)::bigint
+  AND d.org_id = sqlc.arg(org_id)::uuid
+  AND d.status = 'pending';
+
+-- name: RecordWebhookAttempt :exec
+UPDATE app.webhook_deliveries
+SET status = sqlc.arg(status)::text,
+    last_status = sqlc.narg(last_status)::int,
+    last_error = sqlc.narg(last_error)::text,
+    next_attempt_at = sqlc.arg(next_attempt_at)::timestamptz,
+    delivered_at = CASE WHEN sqlc.arg(status)::text = 'delivered' THEN now() END
+WHERE id = sqlc.arg(id)::bigint
+  AND org_id = sqlc.arg(org_id)::uuid;
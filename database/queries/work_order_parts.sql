@@ -0,0 +1,75 @@
+-- name: WorkOrderPartLines :many
+-- The parts issued to a work order per part, lot and serial number, with
+-- what was returned of them, in the order they were first issued.
+SELECT m.part_id,
+       m.lot,
+       m.serial,
+       COALESCE(sum(m.quantity) FILTER (WHERE m.kind = 'issue'), 0)::float8 AS issued,
+       COALESCE(sum(m.quantity) FILTER (WHERE m.kind = 'return'), 0)::float8 AS returned,
+       COALESCE(sum(m.quantity * COALESCE(m.unit_cost, 0)) FILTER (WHERE m.kind = 'issue'), 0)::float8 AS issued_cost,
+       COALESCE(sum(m.quantity * COALESCE(m.unit_cost, 0)) FILTER (WHERE m.kind = 'return'), 0)::float8 AS returned_cost,
+       max(m.created_at)::timestamptz AS last_moved_at
+FROM app.stock_movements m
+WHERE m.org_id = sqlc.arg(org_id)::uuid
+  AND m.work_order_id = sqlc.arg(work_order_id)::uuid
+  AND m.kind IN ('issue', 'return')
+GROUP BY m.part_id, m.lot, m.serial
+ORDER BY min(m.id);
+
+-- name: WorkOrderPartsCost :one
+SELECT app.work_order_parts_cost(sqlc.arg(work_order_id)::uuid)::float8 AS parts_cost;
+
+-- name: PartsCostTotals :many
+-- The cost of parts used on the work orders the caller sees, issues less
+-- returns, between from_date and to_date (both inclusive, by the day of the
+-- movement) and grouped by the work orders' asset, site or month. Work
+-- orders without an asset or site are totalled under a NULL key. Names are
+-- given for the assets and sites the caller sees. Months come in order,
+-- assets and sites the most costly first.
+WITH moves AS (
+  SELECT m.work_order_id,
+         m.created_at,
+         CASE m.kind WHEN 'issue' THEN m.quantity * COALESCE(m.unit_cost, 0) ELSE 0 END AS issued_cost,
+         CASE m.kind WHEN 'return' THEN m.quantity * COALESCE(m.unit_cost, 0) ELSE 0 END AS returned_cost
+  FROM app.stock_movements m
+  WHERE m.org_id = sqlc.arg(org_id)::uuid
+    AND m.kind IN ('issue', 'return')
+    AND m.work_order_id IN (SELECT app.visible_rows(sqlc.arg(work_orders_table_id)::bigint))
+    AND (sqlc.narg(from_date)::date IS NULL OR m.created_at >= sqlc.narg(from_date)::date)
+    AND (sqlc.narg(to_date)::date IS NULL OR m.created_at < sqlc.narg(to_date)::date + 1)
+),
+keyed AS (
+  SELECT CASE sqlc.arg(group_by)::text
+           WHEN 'asset' THEN app.cell_uuid_by_name(mv.work_order_id, 'asset')::text
+           WHEN 'site'  THEN app.work_order_site(mv.work_order_id)::text
+           ELSE to_char(date_trunc('month', mv.created_at), 'YYYY-MM')
+         END AS key,
+         mv.work_order_id,
+         mv.issued_cost,
+         mv.returned_cost
+  FROM moves mv
+),
+totals AS (
+  SELECT k.key,
+         sum(k.issued_cost) AS issued_cost,
+         sum(k.returned_cost) AS returned_cost,
+         count(DISTINCT k.work_order_id) AS work_orders
+  FROM keyed k
+  GROUP BY k.key
+)
+SELECT t.key,
+       CASE WHEN sqlc.arg(group_by)::text IN ('asset', 'site') THEN (
+         SELECT app.cell_text(r.id, c.id)
+         FROM app.rows r
+         JOIN app.columns c ON c.table_id = r.table_id AND c.name = 'name' AND c.kind = 'value' AND c.type = 'text'
+         WHERE r.id = t.key::uuid
+           AND r.id IN (SELECT app.visible_rows(r.table_id, ARRAY[r.id]))
+       ) END AS name,
+       (t.issued_cost - t.returned_cost)::float8 AS cost,
+       t.issued_cost::float8 AS issued_cost,
+       t.returned_cost::float8 AS returned_cost,
+       t.work_orders
+FROM totals t
+ORDER BY CASE WHEN sqlc.arg(group_by)::text = 'month' THEN t.key END,
+         t.issued_cost - t.returned_cost DESC,
+         t.key NULLS LAST;
@@ -0,0 +1,286 @@
+-- Revert rollup columns.
+
+BEGIN;
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_text;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_text;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_text;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_float;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_float;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_float;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_date;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_date;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_date;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_bool;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_bool;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_bool;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_enum;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_enum;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_enum;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_uuid;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_uuid;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_uuid;
+
+DELETE FROM app.columns WHERE kind = 'rollup';
+
+CREATE OR REPLACE FUNCTION app.row_to_json(p_row_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    result jsonb := '{}'::jsonb;
+BEGIN
+    -- Add text values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_text v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add float values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_float v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add date values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_date v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add boolean values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_bool v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add enum values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_enum v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add UUID reference values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_uuid v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add metadata
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_build_object(
+        'id', r.id,
+        'created_at', r.created_at
+    ), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    WHERE r.id = p_row_id;
+
+    -- Evaluate computed columns over the stored values
+    RETURN app.apply_computed(
+        (SELECT r.table_id FROM app.rows r WHERE r.id = p_row_id),
+        COALESCE(result, '{}'::jsonb)
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+BEGIN
+  -- Computed columns are derived on read and never stored
+  SELECT c.name INTO bad_col
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind = 'computed' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION 'Computed column "%" cannot be written', bad_col;
+  END IF;
+
+  INSERT INTO app.rows(table_id)
+  VALUES (p_table_id)
+  RETURNING id INTO r_id;
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION app.update_row(p_row_id uuid, p_values jsonb)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t_id bigint;
+  rec record;
+  col app.columns;
+  bad_col text;
+BEGIN
+  SELECT table_id INTO t_id FROM app.rows WHERE id = p_row_id;
+  IF t_id IS NULL THEN RAISE EXCEPTION 'Unknown row_id %', p_row_id; END IF;
+
+  SELECT c.name INTO bad_col
+  FROM app.columns c
+  WHERE c.table_id = t_id AND c.kind = 'computed' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION 'Computed column "%" cannot be written', bad_col;
+  END IF;
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = t_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, t_id;
+    END IF;
+
+    -- Upsert into the right value table
+    IF col.type='text' THEN
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='date' THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::date)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='bool' THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::boolean)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='enum' THEN
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='uuid' THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::uuid)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+    END IF;
+
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+  END LOOP;
+END$$;
+
+DROP FUNCTION IF EXISTS app.rollup_values_changed();
+DROP FUNCTION IF EXISTS app.refresh_rollups_for_children(uuid[], app.values_uuid[]);
+DROP FUNCTION IF EXISTS app.refresh_rollup_column(bigint);
+DROP FUNCTION IF EXISTS app.refresh_rollup(bigint, uuid);
+DROP FUNCTION IF EXISTS app.compute_rollup(bigint, uuid);
+DROP FUNCTION IF EXISTS app.rollup_children(bigint, uuid);
+DROP TABLE IF EXISTS app.rollup_values;
+DROP INDEX IF EXISTS app.values_uuid_column_value_idx;
+DROP INDEX IF EXISTS app.columns_rollup_via_idx;
+
+ALTER TABLE app.columns
+  DROP CONSTRAINT IF EXISTS columns_rollup_target_check,
+  DROP CONSTRAINT IF EXISTS columns_rollup_aggregate_check,
+  DROP CONSTRAINT IF EXISTS columns_rollup_def_check,
+  DROP CONSTRAINT IF EXISTS columns_kind_check,
+  DROP CONSTRAINT IF EXISTS columns_rollup_target_fk,
+  DROP CONSTRAINT IF EXISTS columns_rollup_via_fk,
+  DROP COLUMN IF EXISTS rollup_filter,
+  DROP COLUMN IF EXISTS rollup_aggregate,
+  DROP COLUMN IF EXISTS rollup_target_column_id,
+  DROP COLUMN IF EXISTS rollup_via_column_id;
+
+ALTER TABLE app.columns
+  ADD CONSTRAINT columns_kind_check CHECK (kind IN ('value', 'computed'));
+
+COMMIT;
@@ -0,0 +1,583 @@
+-- Rollup columns: aggregate rows of another table that reference this row
+-- through a uuid column. Values are cached per parent row in app.rollup_values
+-- and refreshed by triggers whenever a child's values change.
+
+BEGIN;
+
+ALTER TABLE app.columns
+  ADD COLUMN IF NOT EXISTS rollup_via_column_id bigint,
+  ADD COLUMN IF NOT EXISTS rollup_target_column_id bigint,
+  ADD COLUMN IF NOT EXISTS rollup_aggregate text,
+  ADD COLUMN IF NOT EXISTS rollup_filter jsonb;
+
+-- NO ACTION (not RESTRICT) so deleting a table that rolls up over itself
+-- can cascade through both columns in one statement.
+ALTER TABLE app.columns
+  ADD CONSTRAINT columns_rollup_via_fk
+    FOREIGN KEY (rollup_via_column_id) REFERENCES app.columns(id),
+  ADD CONSTRAINT columns_rollup_target_fk
+    FOREIGN KEY (rollup_target_column_id) REFERENCES app.columns(id);
+
+ALTER TABLE app.columns DROP CONSTRAINT IF EXISTS columns_kind_check;
+ALTER TABLE app.columns
+  ADD CONSTRAINT columns_kind_check CHECK (kind IN ('value', 'computed', 'rollup')),
+  ADD CONSTRAINT columns_rollup_def_check CHECK (
+    (kind = 'rollup') = (rollup_via_column_id IS NOT NULL AND rollup_aggregate IS NOT NULL)
+  ),
+  ADD CONSTRAINT columns_rollup_aggregate_check CHECK (
+    rollup_aggregate IS NULL
+    OR rollup_aggregate IN ('count', 'sum', 'min', 'max', 'latest', 'any', 'all')
+  ),
+  ADD CONSTRAINT columns_rollup_target_check CHECK (
+    rollup_aggregate IS NULL OR rollup_aggregate = 'count' OR rollup_target_column_id IS NOT NULL
+  );
+
+CREATE INDEX IF NOT EXISTS columns_rollup_via_idx
+  ON app.columns (rollup_via_column_id) WHERE kind = 'rollup';
+
+-- Children are found by (via column, parent id)
+CREATE INDEX IF NOT EXISTS values_uuid_column_value_idx
+  ON app.values_uuid (column_id, value);
+
+CREATE TABLE IF NOT EXISTS app.rollup_values (
+  row_id     uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  column_id  bigint      NOT NULL REFERENCES app.columns(id) ON DELETE CASCADE,
+  value      jsonb,
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (row_id, column_id)
+);
+
+-- Child rows of p_parent that pass a rollup column's filters, with the target
+-- column's value (NULL for count). Filters use the search filterFields shape
+-- and must all match.
+CREATE OR REPLACE FUNCTION app.rollup_children(p_column_id bigint, p_parent uuid)
+RETURNS TABLE (created_at timestamptz, v jsonb)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT r.created_at,
+         NULLIF(d.data -> t.name, 'null'::jsonb) AS v
+  FROM app.columns c
+  JOIN app.values_uuid vu ON vu.column_id = c.rollup_via_column_id AND vu.value = p_parent
+  JOIN app.rows r ON r.id = vu.row_id
+  LEFT JOIN app.columns t ON t.id = c.rollup_target_column_id
+  CROSS JOIN LATERAL (SELECT app.row_to_json(r.id) AS data) d
+  WHERE c.id = p_column_id
+    AND c.kind = 'rollup'
+    AND NOT EXISTS (
+      SELECT 1
+      FROM jsonb_array_elements(COALESCE(c.rollup_filter, '[]'::jsonb)) f
+      WHERE NOT COALESCE(app.match_computed(d.data -> lower(f->>'field'), f), FALSE)
+    );
+$$;
+
+-- Aggregate the child rows of p_parent for one rollup column. Each aggregate
+-- runs on its own so only the cast matching the target type is evaluated.
+CREATE OR REPLACE FUNCTION app.compute_rollup(p_column_id bigint, p_parent uuid)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  col    app.columns;
+  target app.columns;
+  cast_to text;
+  result jsonb;
+BEGIN
+  SELECT * INTO col FROM app.columns WHERE id = p_column_id AND kind = 'rollup';
+  IF col.id IS NULL THEN
+    RETURN NULL;
+  END IF;
+  SELECT * INTO target FROM app.columns WHERE id = col.rollup_target_column_id;
+
+  IF col.rollup_aggregate = 'count' THEN
+    SELECT to_jsonb(count(*)) INTO result
+    FROM app.rollup_children(p_column_id, p_parent);
+
+  ELSIF col.rollup_aggregate = 'sum' THEN
+    SELECT to_jsonb(COALESCE(sum((v #>> '{}')::float8), 0)) INTO result
+    FROM app.rollup_children(p_column_id, p_parent);
+
+  ELSIF col.rollup_aggregate IN ('min', 'max') THEN
+    cast_to := CASE target.type WHEN 'float' THEN 'float8' WHEN 'date' THEN 'date' ELSE 'text' END;
+    EXECUTE format(
+      'SELECT to_jsonb(%s((v #>> ''{}'')::%s)) FROM app.rollup_children($1, $2)',
+      col.rollup_aggregate, cast_to
+    ) INTO result USING p_column_id, p_parent;
+
+  ELSIF col.rollup_aggregate = 'latest' THEN
+    -- The most recently created child, not the largest value ('max' is that)
+    SELECT v INTO result
+    FROM app.rollup_children(p_column_id, p_parent)
+    WHERE v IS NOT NULL
+    ORDER BY created_at DESC
+    LIMIT 1;
+
+  ELSIF col.rollup_aggregate = 'any' THEN
+    SELECT to_jsonb(COALESCE(bool_or((v #>> '{}')::boolean), FALSE)) INTO result
+    FROM app.rollup_children(p_column_id, p_parent);
+
+  ELSIF col.rollup_aggregate = 'all' THEN
+    -- Vacuously true when there are no matching children
+    SELECT to_jsonb(COALESCE(bool_and((v #>> '{}')::boolean), TRUE)) INTO result
+    FROM app.rollup_children(p_column_id, p_parent);
+  END IF;
+
+  RETURN result;
+END
+$$;
+
+-- Recompute and cache one rollup value. Ignores parents that are gone or that
+-- belong to a different table than the rollup column.
+CREATE OR REPLACE FUNCTION app.refresh_rollup(p_column_id bigint, p_parent uuid)
+RETURNS void
+LANGUAGE sql
+AS $$
+  INSERT INTO app.rollup_values (row_id, column_id, value, updated_at)
+  SELECT p_parent, p_column_id, app.compute_rollup(p_column_id, p_parent), now()
+  WHERE EXISTS (
+    SELECT 1
+    FROM app.rows r
+    JOIN app.columns c ON c.table_id = r.table_id
+    WHERE r.id = p_parent AND c.id = p_column_id
+  )
+  ON CONFLICT (row_id, column_id)
+  DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at;
+$$;
+
+-- Recompute a rollup column for every row of its table (used on creation).
+CREATE OR REPLACE FUNCTION app.refresh_rollup_column(p_column_id bigint)
+RETURNS void
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r record;
+BEGIN
+  FOR r IN
+    SELECT rw.id
+    FROM app.rows rw
+    JOIN app.columns c ON c.table_id = rw.table_id
+    WHERE c.id = p_column_id AND c.kind = 'rollup'
+  LOOP
+    PERFORM app.refresh_rollup(p_column_id, r.id);
+  END LOOP;
+END
+$$;
+
+-- Recompute every rollup over the given children, once per (rollup column,
+-- parent) pair: for the parents the children reference now and for the
+-- references in p_old, those they held before a change.
+CREATE OR REPLACE FUNCTION app.refresh_rollups_for_children(
+  p_children uuid[],
+  p_old app.values_uuid[] DEFAULT '{}'
+)
+RETURNS void
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  PERFORM app.refresh_rollup(p.column_id, p.parent)
+  FROM (
+    SELECT rc.id AS column_id, vu.value AS parent
+    FROM app.values_uuid vu
+    JOIN app.columns rc ON rc.rollup_via_column_id = vu.column_id AND rc.kind = 'rollup'
+    WHERE vu.row_id = ANY(p_children)
+      AND vu.value IS NOT NULL
+    UNION
+    SELECT rc.id, o.value
+    FROM unnest(p_old) o
+    JOIN app.columns rc ON rc.rollup_via_column_id = o.column_id AND rc.kind = 'rollup'
+    WHERE o.value IS NOT NULL
+  ) p;
+END
+$$;
+
+-- Statement-level, so a statement touching many cells refreshes each
+-- affected rollup value once. The transition tables differ per event (a
+-- trigger with transition tables can only have one), hence one trigger per
+-- event sharing this function. app.insert_row and app.update_row write a
+-- row one cell at a time; they set app.rollups_deferred while doing so and
+-- refresh once at the end.
+CREATE OR REPLACE FUNCTION app.rollup_values_changed()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF current_setting('app.rollups_deferred', true) = 'on' THEN
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP = 'INSERT' THEN
+    PERFORM app.refresh_rollups_for_children(ARRAY(SELECT DISTINCT row_id FROM new_rows));
+  ELSIF TG_OP = 'UPDATE' THEN
+    -- A child moved away from (or stopped referencing) a parent: refresh the
+    -- old parent too
+    IF TG_TABLE_NAME = 'values_uuid' THEN
+      PERFORM app.refresh_rollups_for_children(
+        ARRAY(SELECT DISTINCT row_id FROM new_rows),
+        ARRAY(SELECT o::app.values_uuid FROM old_rows o)
+      );
+    ELSE
+      PERFORM app.refresh_rollups_for_children(ARRAY(SELECT DISTINCT row_id FROM new_rows));
+    END IF;
+  ELSIF TG_TABLE_NAME = 'values_uuid' THEN
+    PERFORM app.refresh_rollups_for_children(
+      ARRAY(SELECT DISTINCT row_id FROM old_rows),
+      ARRAY(SELECT o::app.values_uuid FROM old_rows o)
+    );
+  ELSE
+    PERFORM app.refresh_rollups_for_children(ARRAY(SELECT DISTINCT row_id FROM old_rows));
+  END IF;
+  RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_text;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_text;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_text
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_text;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_text
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_text;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_text
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_float;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_float;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_float
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_float;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_float
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_float;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_float
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_date;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_date;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_date
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_date;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_date
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_date;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_date
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_bool;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_bool;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_bool
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_bool;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_bool
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_bool;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_bool
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_enum;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_enum;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_enum
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_enum;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_enum
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_enum;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_enum
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+DROP TRIGGER IF EXISTS trg_rollup_refresh ON app.values_uuid;
+DROP TRIGGER IF EXISTS trg_rollup_refresh_insert ON app.values_uuid;
+CREATE TRIGGER trg_rollup_refresh_insert
+AFTER INSERT ON app.values_uuid
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_update ON app.values_uuid;
+CREATE TRIGGER trg_rollup_refresh_update
+AFTER UPDATE ON app.values_uuid
+REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+DROP TRIGGER IF EXISTS trg_rollup_refresh_delete ON app.values_uuid;
+CREATE TRIGGER trg_rollup_refresh_delete
+AFTER DELETE ON app.values_uuid
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION app.rollup_values_changed();
+
+-- row_to_json now includes cached rollup values ahead of computed columns
+CREATE OR REPLACE FUNCTION app.row_to_json(p_row_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    result jsonb := '{}'::jsonb;
+BEGIN
+    -- Add text values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_text v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add float values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_float v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add date values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_date v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add boolean values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_bool v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add enum values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_enum v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add UUID reference values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_uuid v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add metadata
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_build_object(
+        'id', r.id,
+        'created_at', r.created_at
+    ), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    WHERE r.id = p_row_id;
+
+    -- Add cached rollup values (NULL until first refreshed)
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, rv.value), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    JOIN app.columns c ON c.table_id = r.table_id AND c.kind = 'rollup'
+    LEFT JOIN app.rollup_values rv ON rv.column_id = c.id AND rv.row_id = r.id
+    WHERE r.id = p_row_id;
+
+    -- Evaluate computed columns over the stored values
+    RETURN app.apply_computed(
+        (SELECT r.table_id FROM app.rows r WHERE r.id = p_row_id),
+        COALESCE(result, '{}'::jsonb)
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+BEGIN
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  INSERT INTO app.rows(table_id)
+  VALUES (p_table_id)
+  RETURNING id INTO r_id;
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION app.update_row(p_row_id uuid, p_values jsonb)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t_id bigint;
+  rec record;
+  col app.columns;
+  bad_col text;
+  bad_kind text;
+BEGIN
+  SELECT table_id INTO t_id FROM app.rows WHERE id = p_row_id;
+  IF t_id IS NULL THEN RAISE EXCEPTION 'Unknown row_id %', p_row_id; END IF;
+
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = t_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = t_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, t_id;
+    END IF;
+
+    -- Upsert into the right value table
+    IF col.type='text' THEN
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='date' THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::date)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='bool' THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::boolean)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='enum' THEN
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='uuid' THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::uuid)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+    END IF;
+
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+  END LOOP;
+END$$;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.search_snippet(text, text, tsquery);
+DROP FUNCTION IF EXISTS app.html_escape(text);
+DROP FUNCTION IF EXISTS app.like_contains(text);
+
+DROP INDEX IF EXISTS app.values_enum_trgm_idx;
+DROP INDEX IF EXISTS app.values_text_trgm_idx;
+DROP INDEX IF EXISTS app.values_enum_tsv_idx;
+DROP INDEX IF EXISTS app.values_text_tsv_idx;
+
+ALTER TABLE app.values_enum DROP COLUMN IF EXISTS tsv;
+ALTER TABLE app.values_text DROP COLUMN IF EXISTS tsv;
+
+COMMIT;
@@ -0,0 +1,83 @@
+-- Org-wide full-text search over text/enum values.
+-- Each value carries a generated tsvector (GIN indexed) for ranked word
+-- matches, and a trigram index backs substring/fuzzy fallback matching.
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE app.values_text
+  ADD COLUMN IF NOT EXISTS tsv tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', COALESCE(value, ''))) STORED;
+
+ALTER TABLE app.values_enum
+  ADD COLUMN IF NOT EXISTS tsv tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', COALESCE(value, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS values_text_tsv_idx  ON app.values_text USING gin (tsv);
+CREATE INDEX IF NOT EXISTS values_enum_tsv_idx  ON app.values_enum USING gin (tsv);
+CREATE INDEX IF NOT EXISTS values_text_trgm_idx ON app.values_text USING gin (value gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS values_enum_trgm_idx ON app.values_enum USING gin (value gin_trgm_ops);
+
+-- Escape user content before wrapping matches in <mark> so snippets are
+-- safe to render as HTML.
+CREATE OR REPLACE FUNCTION app.html_escape(p_text text)
+RETURNS text
+LANGUAGE sql
+IMMUTABLE
+AS $$
+  SELECT replace(replace(replace(replace(p_text,
+    '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;');
+$$;
+
+-- A pattern matching values that contain p_q, for LIKE/ILIKE. p_q's own
+-- wildcards (%, _) and the escape character match themselves.
+CREATE OR REPLACE FUNCTION app.like_contains(p_q text)
+RETURNS text
+LANGUAGE sql
+IMMUTABLE
+AS $$
+  SELECT '%' || replace(replace(replace(p_q,
+    '\', '\\'), '%', '\%'), '_', '\_') || '%';
+$$;
+
+-- Build a highlighted snippet for a matched value: ts_headline for word
+-- matches, otherwise a window around the first substring match.
+CREATE OR REPLACE FUNCTION app.search_snippet(p_value text, p_q text, p_tsq tsquery)
+RETURNS text
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  pos      int;
+  start_at int;
+  headline text;
+BEGIN
+  IF p_value IS NULL THEN
+    RETURN NULL;
+  END IF;
+
+  IF to_tsvector('english', p_value) @@ p_tsq THEN
+    -- Highlight the raw value between control characters, then escape it
+    -- and turn those into the markers, so the markers are never escaped
+    headline := ts_headline('english', translate(p_value, chr(2) || chr(3), ''), p_tsq,
+      format('StartSel=%s, StopSel=%s, MaxWords=24, MinWords=8, MaxFragments=2', chr(2), chr(3)));
+    RETURN replace(replace(app.html_escape(headline), chr(2), '<mark>'), chr(3), '</mark>');
+  END IF;
+
+  pos := strpos(lower(p_value), lower(p_q));
+  IF pos = 0 THEN
+    -- Fuzzy (trigram) match: no exact span to highlight
+    RETURN app.html_escape(left(p_value, 160));
+  END IF;
+
+  start_at := GREATEST(1, pos - 60);
+  RETURN CASE WHEN start_at > 1 THEN '…' ELSE '' END
+      || app.html_escape(substr(p_value, start_at, pos - start_at))
+      || '<mark>' || app.html_escape(substr(p_value, pos, length(p_q))) || '</mark>'
+      || app.html_escape(substr(p_value, pos + length(p_q), 100))
+      || CASE WHEN pos + length(p_q) + 100 <= length(p_value) THEN '…' ELSE '' END;
+END
+$$;
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Table templates: records which template (and version) has been provisioned
+-- into each org so re-provisioning can report upgrades and stay idempotent.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.template_installs (
+  org_id       uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  template     text        NOT NULL,
+  version      integer     NOT NULL CHECK (version > 0),
+  installed_at timestamptz NOT NULL DEFAULT now(),
+  updated_at   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, template)
+);
+
+COMMIT;
@@ -0,0 +1,50 @@
+BEGIN;
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['tables','template_installs','columns','rows','values_text','values_float','values_date','values_bool','values_enum','values_uuid','rollup_values'] LOOP
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format('ALTER TABLE app.%I NO FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I DISABLE ROW LEVEL SECURITY', tbl);
+  END LOOP;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col       app.columns;
+  src_table bigint;
+  tgt_table bigint;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF NEW.value IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO col FROM app.columns WHERE id = NEW.column_id;
+  IF col.type <> 'uuid' OR NOT col.is_reference THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT table_id INTO src_table FROM app.rows WHERE id = NEW.row_id;
+  SELECT table_id INTO tgt_table FROM app.rows WHERE id = NEW.value;
+
+  IF col.reference_table_id IS NOT NULL AND tgt_table <> col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      col.reference_table_id, NEW.value, tgt_table;
+  END IF;
+
+  IF col.require_different_table AND src_table = tgt_table THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src_table, tgt_table;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+DROP FUNCTION IF EXISTS app.current_org();
+
+COMMIT;
@@ -0,0 +1,101 @@
+-- Org isolation enforced by Postgres: row level security on every app.* table.
+--
+-- The API sets app.org_id per transaction (set_config(..., true)); rows of any
+-- other org, and legacy tables without an org, are invisible. Policies are
+-- FORCEd so they also apply to the table owner the API connects as.
+-- Migrations that need to read or backfill data across orgs must run as a
+-- role with BYPASSRLS (or temporarily ALTER TABLE ... NO FORCE ROW LEVEL SECURITY).
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION app.current_org()
+RETURNS uuid LANGUAGE sql STABLE AS $$
+  SELECT NULLIF(current_setting('app.org_id', true), '')::uuid
+$$;
+
+ALTER TABLE app.tables ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.tables FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.tables;
+CREATE POLICY org_isolation ON app.tables
+  USING (org_id = app.current_org())
+  WITH CHECK (org_id = app.current_org());
+
+ALTER TABLE app.template_installs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.template_installs FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.template_installs;
+CREATE POLICY org_isolation ON app.template_installs
+  USING (org_id = app.current_org())
+  WITH CHECK (org_id = app.current_org());
+
+-- Columns and rows belong to the org of their table; the subquery is itself
+-- filtered by the app.tables policy.
+ALTER TABLE app.columns ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.columns FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.columns;
+CREATE POLICY org_isolation ON app.columns
+  USING (EXISTS (SELECT 1 FROM app.tables t WHERE t.id = columns.table_id));
+
+ALTER TABLE app.rows ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.rows FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.rows;
+CREATE POLICY org_isolation ON app.rows
+  USING (EXISTS (SELECT 1 FROM app.tables t WHERE t.id = rows.table_id));
+
+-- Values (and cached rollups) belong to the org of their row.
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['values_text','values_float','values_date','values_bool','values_enum','values_uuid','rollup_values'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%1$I USING (EXISTS (SELECT 1 FROM app.rows r WHERE r.id = %1$I.row_id))',
+      tbl);
+  END LOOP;
+END$$;
+
+-- Foreign keys are checked without RLS, so a uuid value naming another org's
+-- row would pass the FK. The target lookup below runs under RLS: a row that
+-- is not visible is treated as missing.
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col       app.columns;
+  src_table bigint;
+  tgt_table bigint;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF NEW.value IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO col FROM app.columns WHERE id = NEW.column_id;
+  IF col.type <> 'uuid' OR NOT col.is_reference THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT table_id INTO src_table FROM app.rows WHERE id = NEW.row_id;
+  SELECT table_id INTO tgt_table FROM app.rows WHERE id = NEW.value;
+
+  IF tgt_table IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF col.reference_table_id IS NOT NULL AND tgt_table <> col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      col.reference_table_id, NEW.value, tgt_table;
+  END IF;
+
+  IF col.require_different_table AND src_table = tgt_table THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src_table, tgt_table;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+COMMIT;
@@ -0,0 +1,168 @@
+-- Revert org_id on app.rows.
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col       app.columns;
+  src_table bigint;
+  tgt_table bigint;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF NEW.value IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO col FROM app.columns WHERE id = NEW.column_id;
+  IF col.type <> 'uuid' OR NOT col.is_reference THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT table_id INTO src_table FROM app.rows WHERE id = NEW.row_id;
+  SELECT table_id INTO tgt_table FROM app.rows WHERE id = NEW.value;
+
+  IF tgt_table IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF col.reference_table_id IS NOT NULL AND tgt_table <> col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      col.reference_table_id, NEW.value, tgt_table;
+  END IF;
+
+  IF col.require_different_table AND src_table = tgt_table THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src_table, tgt_table;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+BEGIN
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  INSERT INTO app.rows(table_id)
+  VALUES (p_table_id)
+  RETURNING id INTO r_id;
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+DROP POLICY IF EXISTS org_isolation ON app.rows;
+CREATE POLICY org_isolation ON app.rows
+  USING (EXISTS (SELECT 1 FROM app.tables t WHERE t.id = rows.table_id));
+
+DROP TRIGGER IF EXISTS trg_rows_set_org ON app.rows;
+DROP FUNCTION IF EXISTS app.rows_set_org();
+
+DROP INDEX IF EXISTS app.app_rows_org_table_created_idx;
+ALTER TABLE app.rows DROP CONSTRAINT IF EXISTS rows_org_id_not_null;
+ALTER TABLE app.rows DROP CONSTRAINT IF EXISTS rows_org_table_fkey;
+ALTER TABLE app.tables DROP CONSTRAINT IF EXISTS tables_org_id_id_key;
+ALTER TABLE app.rows DROP COLUMN IF EXISTS org_id;
+
+COMMIT;
@@ -0,0 +1,223 @@
+-- Org scoping (phase 2): denormalise org_id onto app.rows.
+--
+-- Rows carry the org of their table, pinned by a composite FK to
+-- app.tables(org_id, id), so every uuid value can be checked against the org
+-- of the row it names without trusting RLS visibility alone. Rows of legacy
+-- tables without an org keep a NULL org_id and stay invisible.
+
+BEGIN;
+
+-- The backfill must see every org's rows.
+ALTER TABLE app.tables NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE app.rows   NO FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE app.rows ADD COLUMN IF NOT EXISTS org_id uuid;
+
+UPDATE app.rows r
+SET org_id = t.org_id
+FROM app.tables t
+WHERE t.id = r.table_id AND r.org_id IS DISTINCT FROM t.org_id;
+
+ALTER TABLE app.tables
+  ADD CONSTRAINT tables_org_id_id_key UNIQUE (org_id, id);
+
+ALTER TABLE app.rows
+  ADD CONSTRAINT rows_org_table_fkey FOREIGN KEY (org_id, table_id)
+  REFERENCES app.tables(org_id, id) ON DELETE CASCADE;
+
+-- New rows always have an org; legacy ones are grandfathered.
+ALTER TABLE app.rows
+  ADD CONSTRAINT rows_org_id_not_null CHECK (org_id IS NOT NULL) NOT VALID;
+
+CREATE INDEX IF NOT EXISTS app_rows_org_table_created_idx
+  ON app.rows(org_id, table_id, created_at DESC, id);
+
+-- Direct inserts (and table moves) pick up the org of the table. The lookup
+-- runs under RLS, so a table of another org yields NULL and the row is refused.
+CREATE OR REPLACE FUNCTION app.rows_set_org()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF NEW.org_id IS NULL OR (TG_OP = 'UPDATE' AND NEW.table_id <> OLD.table_id) THEN
+    NEW.org_id := (SELECT t.org_id FROM app.tables t WHERE t.id = NEW.table_id);
+  END IF;
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS trg_rows_set_org ON app.rows;
+CREATE TRIGGER trg_rows_set_org
+BEFORE INSERT OR UPDATE OF table_id, org_id ON app.rows
+FOR EACH ROW EXECUTE FUNCTION app.rows_set_org();
+
+DROP POLICY IF EXISTS org_isolation ON app.rows;
+CREATE POLICY org_isolation ON app.rows
+  USING (org_id = app.current_org())
+  WITH CHECK (org_id = app.current_org());
+
+ALTER TABLE app.tables FORCE ROW LEVEL SECURITY;
+ALTER TABLE app.rows   FORCE ROW LEVEL SECURITY;
+
+-- Every uuid value names a row (values_uuid_value_fkey), reference column or
+-- not, and that row must belong to the same org as the row holding the value.
+-- The org comparison does not rely on RLS, so it also holds for roles that
+-- bypass it.
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col       app.columns;
+  src       app.rows;
+  tgt       app.rows;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF NEW.value IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO src FROM app.rows WHERE id = NEW.row_id;
+  SELECT * INTO tgt FROM app.rows WHERE id = NEW.value;
+
+  IF tgt.id IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF tgt.org_id IS DISTINCT FROM src.org_id THEN
+    RAISE EXCEPTION 'Referenced row % belongs to another org', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  SELECT * INTO col FROM app.columns WHERE id = NEW.column_id;
+  IF col.type <> 'uuid' OR NOT col.is_reference THEN
+    RETURN NEW;
+  END IF;
+
+  IF col.reference_table_id IS NOT NULL AND tgt.table_id <> col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      col.reference_table_id, NEW.value, tgt.table_id;
+  END IF;
+
+  IF col.require_different_table AND src.table_id = tgt.table_id THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src.table_id, tgt.table_id;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+BEGIN
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  -- The row takes the org of its table; a table outside the current org is
+  -- not visible here, so nothing is inserted
+  INSERT INTO app.rows(table_id, org_id)
+  SELECT t.id, t.org_id FROM app.tables t WHERE t.id = p_table_id
+  RETURNING id INTO r_id;
+  IF r_id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+COMMIT;
@@ -0,0 +1,367 @@
+-- Revert the relational storage engine. Refuses while any table is
+-- relational (revert those to EAV first); physical tables of dual tables are
+-- dropped, EAV being authoritative for them.
+
+BEGIN;
+
+ALTER TABLE app.tables NO FORCE ROW LEVEL SECURITY;
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.tables WHERE storage_mode = 'relational') THEN
+    RAISE EXCEPTION 'Relational tables exist; revert them to EAV before rolling back';
+  END IF;
+END$$;
+ALTER TABLE app.tables FORCE ROW LEVEL SECURITY;
+
+DROP TRIGGER IF EXISTS trg_columns_physical ON app.columns;
+DROP TRIGGER IF EXISTS trg_tables_drop_physical ON app.tables;
+
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col       app.columns;
+  src       app.rows;
+  tgt       app.rows;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF NEW.value IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO src FROM app.rows WHERE id = NEW.row_id;
+  SELECT * INTO tgt FROM app.rows WHERE id = NEW.value;
+
+  IF tgt.id IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF tgt.org_id IS DISTINCT FROM src.org_id THEN
+    RAISE EXCEPTION 'Referenced row % belongs to another org', NEW.value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  SELECT * INTO col FROM app.columns WHERE id = NEW.column_id;
+  IF col.type <> 'uuid' OR NOT col.is_reference THEN
+    RETURN NEW;
+  END IF;
+
+  IF col.reference_table_id IS NOT NULL AND tgt.table_id <> col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      col.reference_table_id, NEW.value, tgt.table_id;
+  END IF;
+
+  IF col.require_different_table AND src.table_id = tgt.table_id THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src.table_id, tgt.table_id;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.row_to_json(p_row_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    result jsonb := '{}'::jsonb;
+BEGIN
+    -- Add text values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_text v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add float values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_float v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add date values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_date v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add boolean values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_bool v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add enum values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_enum v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add UUID reference values
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+    INTO result
+    FROM app.values_uuid v
+    JOIN app.columns c ON c.id = v.column_id
+    WHERE v.row_id = p_row_id;
+
+    -- Add metadata
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_build_object(
+        'id', r.id,
+        'created_at', r.created_at
+    ), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    WHERE r.id = p_row_id;
+
+    -- Add cached rollup values (NULL until first refreshed)
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, rv.value), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    JOIN app.columns c ON c.table_id = r.table_id AND c.kind = 'rollup'
+    LEFT JOIN app.rollup_values rv ON rv.column_id = c.id AND rv.row_id = r.id
+    WHERE r.id = p_row_id;
+
+    -- Evaluate computed columns over the stored values
+    RETURN app.apply_computed(
+        (SELECT r.table_id FROM app.rows r WHERE r.id = p_row_id),
+        COALESCE(result, '{}'::jsonb)
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION app.rollup_children(p_column_id bigint, p_parent uuid)
+RETURNS TABLE (created_at timestamptz, v jsonb)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT r.created_at,
+         NULLIF(d.data -> t.name, 'null'::jsonb) AS v
+  FROM app.columns c
+  JOIN app.values_uuid vu ON vu.column_id = c.rollup_via_column_id AND vu.value = p_parent
+  JOIN app.rows r ON r.id = vu.row_id
+  LEFT JOIN app.columns t ON t.id = c.rollup_target_column_id
+  CROSS JOIN LATERAL (SELECT app.row_to_json(r.id) AS data) d
+  WHERE c.id = p_column_id
+    AND c.kind = 'rollup'
+    AND NOT EXISTS (
+      SELECT 1
+      FROM jsonb_array_elements(COALESCE(c.rollup_filter, '[]'::jsonb)) f
+      WHERE NOT COALESCE(app.match_computed(d.data -> lower(f->>'field'), f), FALSE)
+    );
+$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+BEGIN
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  -- The row takes the org of its table; a table outside the current org is
+  -- not visible here, so nothing is inserted
+  INSERT INTO app.rows(table_id, org_id)
+  SELECT t.id, t.org_id FROM app.tables t WHERE t.id = p_table_id
+  RETURNING id INTO r_id;
+  IF r_id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION app.update_row(p_row_id uuid, p_values jsonb)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t_id bigint;
+  rec record;
+  col app.columns;
+  bad_col text;
+  bad_kind text;
+BEGIN
+  SELECT table_id INTO t_id FROM app.rows WHERE id = p_row_id;
+  IF t_id IS NULL THEN RAISE EXCEPTION 'Unknown row_id %', p_row_id; END IF;
+
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = t_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = t_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, t_id;
+    END IF;
+
+    -- Upsert into the right value table
+    IF col.type='text' THEN
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='date' THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::date)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='bool' THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::boolean)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='enum' THEN
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (p_row_id, col.id, rec.value::text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='uuid' THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (p_row_id, col.id, (rec.value)::uuid)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+    END IF;
+
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+  END LOOP;
+END$$;
+
+DROP FUNCTION IF EXISTS app.update_row_relational(uuid, jsonb);
+DROP FUNCTION IF EXISTS app.insert_row_relational(bigint, jsonb);
+DROP FUNCTION IF EXISTS app.search_relational(bigint, jsonb);
+DROP FUNCTION IF EXISTS app.physical_text_values(bigint, text, tsquery);
+DROP FUNCTION IF EXISTS app.cell_text(uuid, bigint);
+DROP FUNCTION IF EXISTS app.referencing_rows(bigint, uuid);
+DROP FUNCTION IF EXISTS app.drop_physical_table(bigint);
+DROP FUNCTION IF EXISTS app.revert_relational(bigint);
+DROP FUNCTION IF EXISTS app.cut_over_relational(bigint);
+DROP FUNCTION IF EXISTS app.physical_table_drift(bigint, int);
+DROP FUNCTION IF EXISTS app.backfill_physical_table(bigint, int);
+DROP FUNCTION IF EXISTS app.sync_physical_row(uuid);
+DROP FUNCTION IF EXISTS app.eav_physical_values(uuid);
+DROP FUNCTION IF EXISTS app.on_tables_delete_physical();
+DROP FUNCTION IF EXISTS app.on_columns_physical();
+DROP FUNCTION IF EXISTS app.ensure_physical_table(bigint);
+DROP FUNCTION IF EXISTS app.add_physical_column(bigint);
+
+DROP SCHEMA IF EXISTS app_data CASCADE;
+
+DROP FUNCTION IF EXISTS app.physical_rollup_refresh();
+DROP FUNCTION IF EXISTS app.physical_row_check();
+DROP FUNCTION IF EXISTS app.check_uuid_value(app.columns, uuid, uuid);
+DROP FUNCTION IF EXISTS app.physical_type(app.column_type);
+
+ALTER TABLE app.tables
+  DROP CONSTRAINT IF EXISTS tables_physical_table_check,
+  DROP CONSTRAINT IF EXISTS tables_storage_mode_check,
+  DROP COLUMN IF EXISTS migrated_at,
+  DROP COLUMN IF EXISTS physical_table,
+  DROP COLUMN IF EXISTS storage_mode;
+
+COMMIT;
@@ -0,0 +1,1164 @@
+-- Relational storage engine (see docs/table_per_collection_plan.md).
+--
+-- A user table may keep its values in a physical table app_data.t_<table_id>
+-- with one natively typed column c_<column_id> per value column, instead of
+-- the app.values_* tables. app.tables.storage_mode selects the engine:
+--
+--   eav         values live in app.values_* (the default)
+--   dual        EAV is still authoritative, but every write is mirrored into
+--               the physical table while existing rows are backfilled
+--   relational  the physical table is authoritative and EAV holds nothing
+--
+-- app.rows stays the registry of every row id whatever the engine, so uuid
+-- references, rollups, labels and RLS work across tables in different modes.
+-- The public entry points (insert_row, update_row, row_to_json, ...) dispatch
+-- on the mode; the API does not know which engine a table uses.
+
+BEGIN;
+
+CREATE SCHEMA IF NOT EXISTS app_data;
+
+ALTER TABLE app.tables
+  ADD COLUMN IF NOT EXISTS storage_mode text NOT NULL DEFAULT 'eav',
+  ADD COLUMN IF NOT EXISTS physical_table text,
+  ADD COLUMN IF NOT EXISTS migrated_at timestamptz;
+
+ALTER TABLE app.tables
+  ADD CONSTRAINT tables_storage_mode_check
+    CHECK (storage_mode IN ('eav', 'dual', 'relational')),
+  ADD CONSTRAINT tables_physical_table_check
+    CHECK (storage_mode = 'eav' OR physical_table IS NOT NULL);
+
+-- Native type of a physical column
+CREATE OR REPLACE FUNCTION app.physical_type(p_type app.column_type)
+RETURNS text LANGUAGE sql IMMUTABLE AS $$
+  SELECT CASE p_type
+    WHEN 'text'  THEN 'text'
+    WHEN 'enum'  THEN 'text'
+    WHEN 'date'  THEN 'date'
+    WHEN 'bool'  THEN 'boolean'
+    WHEN 'float' THEN 'double precision'
+    WHEN 'uuid'  THEN 'uuid'
+  END
+$$;
+
+-- Reference checks for a uuid value, shared by values_uuid and the uuid
+-- columns of physical tables.
+CREATE OR REPLACE FUNCTION app.check_uuid_value(p_col app.columns, p_row_id uuid, p_value uuid)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  src app.rows;
+  tgt app.rows;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF p_value IS NULL THEN
+    RETURN;
+  END IF;
+
+  SELECT * INTO src FROM app.rows WHERE id = p_row_id;
+  SELECT * INTO tgt FROM app.rows WHERE id = p_value;
+
+  IF tgt.id IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF tgt.org_id IS DISTINCT FROM src.org_id THEN
+    RAISE EXCEPTION 'Referenced row % belongs to another org', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF p_col.type <> 'uuid' OR NOT p_col.is_reference THEN
+    RETURN;
+  END IF;
+
+  IF p_col.reference_table_id IS NOT NULL AND tgt.table_id <> p_col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      p_col.reference_table_id, p_value, tgt.table_id;
+  END IF;
+
+  IF p_col.require_different_table AND src.table_id = tgt.table_id THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src.table_id, tgt.table_id;
+  END IF;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.enforce_uuid_reference()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM app.check_uuid_value(
+    (SELECT c FROM app.columns c WHERE c.id = NEW.column_id), NEW.row_id, NEW.value);
+  RETURN NEW;
+END$$;
+
+-- Enum and reference checks for a physical row; TG_ARGV[0] is the table id.
+-- Values an UPDATE leaves unchanged are not checked again.
+CREATE OR REPLACE FUNCTION app.physical_row_check()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  col     app.columns;
+  new_row jsonb := to_jsonb(NEW);
+  old_row jsonb := CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END;
+  v       jsonb;
+BEGIN
+  FOR col IN
+    SELECT * FROM app.columns c
+    WHERE c.table_id = TG_ARGV[0]::bigint
+      AND c.kind = 'value'
+      AND c.type IN ('enum', 'uuid')
+  LOOP
+    v := new_row -> ('c_' || col.id);
+    CONTINUE WHEN v IS NULL OR v = 'null'::jsonb;
+    CONTINUE WHEN old_row -> ('c_' || col.id) = v;
+
+    IF col.type = 'enum' AND NOT ((v #>> '{}') = ANY(col.enum_values)) THEN
+      RAISE EXCEPTION 'Enum value "%" not in % for column %', v #>> '{}', col.enum_values, col.id;
+    ELSIF col.type = 'uuid' THEN
+      PERFORM app.check_uuid_value(col, NEW.id, (v #>> '{}')::uuid);
+    END IF;
+  END LOOP;
+  RETURN NEW;
+END$$;
+
+-- Keep rollups over a relational child table current. While a table is dual
+-- the triggers on app.values_* already do this.
+CREATE OR REPLACE FUNCTION app.physical_rollup_refresh()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  rc         record;
+  old_row    jsonb := CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END;
+  new_row    jsonb := CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END;
+  old_parent uuid;
+  new_parent uuid;
+BEGIN
+  IF (SELECT storage_mode FROM app.tables WHERE id = TG_ARGV[0]::bigint) IS DISTINCT FROM 'relational' THEN
+    RETURN NULL;
+  END IF;
+
+  FOR rc IN
+    SELECT c.id, c.rollup_via_column_id AS via
+    FROM app.columns c
+    JOIN app.columns v ON v.id = c.rollup_via_column_id
+    WHERE c.kind = 'rollup' AND v.table_id = TG_ARGV[0]::bigint
+  LOOP
+    old_parent := (old_row ->> ('c_' || rc.via))::uuid;
+    new_parent := (new_row ->> ('c_' || rc.via))::uuid;
+    -- A child moved away from (or stopped referencing) a parent
+    IF old_parent IS NOT NULL AND old_parent IS DISTINCT FROM new_parent THEN
+      PERFORM app.refresh_rollup(rc.id, old_parent);
+    END IF;
+    IF new_parent IS NOT NULL THEN
+      PERFORM app.refresh_rollup(rc.id, new_parent);
+    END IF;
+  END LOOP;
+  RETURN NULL;
+END$$;
+
+-- Add (or adjust) the physical column of a value column. Idempotent; a no-op
+-- for tables without a physical table. NOT NULL is only enforced once the
+-- table is relational: while dual, rows written before a column became
+-- required may still lack a value.
+CREATE OR REPLACE FUNCTION app.add_physical_column(p_column_id bigint)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  col      app.columns;
+  t        app.tables;
+  cname    text;
+  rel      regclass;
+  not_null boolean;
+BEGIN
+  SELECT * INTO col FROM app.columns WHERE id = p_column_id;
+  SELECT * INTO t FROM app.tables WHERE id = col.table_id;
+  IF col.kind IS DISTINCT FROM 'value' OR t.physical_table IS NULL THEN
+    RETURN;
+  END IF;
+  rel := to_regclass(format('app_data.%I', t.physical_table));
+  IF rel IS NULL THEN
+    RETURN;
+  END IF;
+  cname := 'c_' || col.id;
+
+  SELECT a.attnotnull INTO not_null
+  FROM pg_attribute a
+  WHERE a.attrelid = rel AND a.attname = cname AND NOT a.attisdropped;
+
+  IF NOT FOUND THEN
+    EXECUTE format('ALTER TABLE app_data.%I ADD COLUMN %I %s',
+      t.physical_table, cname, app.physical_type(col.type));
+    IF col.type = 'uuid' THEN
+      EXECUTE format(
+        'ALTER TABLE app_data.%I ADD CONSTRAINT %I FOREIGN KEY (%I) REFERENCES app.rows(id) ON DELETE RESTRICT',
+        t.physical_table, t.physical_table || '_' || cname || '_fkey', cname);
+    END IF;
+    not_null := false;
+  END IF;
+
+  IF col.is_required AND t.storage_mode = 'relational' AND NOT not_null THEN
+    BEGIN
+      EXECUTE format('ALTER TABLE app_data.%I ALTER COLUMN %I SET NOT NULL', t.physical_table, cname);
+    EXCEPTION WHEN not_null_violation THEN
+      -- Existing rows predate the requirement; inserts still check it
+      RAISE NOTICE 'Column "%" of table % has NULL values; NOT NULL not enforced', col.name, t.slug;
+    END;
+  ELSIF not_null AND NOT (col.is_required AND t.storage_mode = 'relational') THEN
+    EXECUTE format('ALTER TABLE app_data.%I ALTER COLUMN %I DROP NOT NULL', t.physical_table, cname);
+  END IF;
+
+  -- References are always indexed: rollups and RESTRICT checks look them up
+  IF col.is_indexed OR col.type = 'uuid' THEN
+    IF col.type = 'text' THEN
+      EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON app_data.%I USING gin (%I gin_trgm_ops)',
+        t.physical_table || '_' || cname || '_idx', t.physical_table, cname);
+    ELSE
+      EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON app_data.%I (%I)',
+        t.physical_table || '_' || cname || '_idx', t.physical_table, cname);
+    END IF;
+  END IF;
+END$$;
+
+-- Create the physical table of a user table (with its RLS policy, triggers
+-- and a column per value column) and start mirroring writes into it.
+-- Returns the physical table name. Idempotent.
+CREATE OR REPLACE FUNCTION app.ensure_physical_table(p_table_id bigint)
+RETURNS text LANGUAGE plpgsql AS $$
+DECLARE
+  t   app.tables;
+  tbl text;
+  c   record;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id FOR UPDATE;
+  IF t.id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+  IF t.org_id IS NULL THEN
+    RAISE EXCEPTION 'Table % has no org', p_table_id;
+  END IF;
+  tbl := COALESCE(t.physical_table, 't_' || t.id);
+
+  EXECUTE format($ddl$
+    CREATE TABLE IF NOT EXISTS app_data.%1$I (
+      id         uuid PRIMARY KEY REFERENCES app.rows(id) ON DELETE CASCADE,
+      org_id     uuid NOT NULL,
+      table_id   bigint NOT NULL DEFAULT %2$s CHECK (table_id = %2$s),
+      created_at timestamptz NOT NULL DEFAULT now(),
+      FOREIGN KEY (org_id, table_id) REFERENCES app.tables(org_id, id) ON DELETE CASCADE
+    )$ddl$, tbl, t.id);
+
+  EXECUTE format('ALTER TABLE app_data.%I ENABLE ROW LEVEL SECURITY', tbl);
+  EXECUTE format('ALTER TABLE app_data.%I FORCE ROW LEVEL SECURITY', tbl);
+  EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app_data.%I', tbl);
+  EXECUTE format(
+    'CREATE POLICY org_isolation ON app_data.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+    tbl);
+
+  EXECUTE format('DROP TRIGGER IF EXISTS trg_physical_check ON app_data.%I', tbl);
+  EXECUTE format(
+    'CREATE TRIGGER trg_physical_check BEFORE INSERT OR UPDATE ON app_data.%I FOR EACH ROW EXECUTE FUNCTION app.physical_row_check(%L)',
+    tbl, t.id);
+  EXECUTE format('DROP TRIGGER IF EXISTS trg_physical_rollup ON app_data.%I', tbl);
+  EXECUTE format(
+    'CREATE TRIGGER trg_physical_rollup AFTER INSERT OR UPDATE OR DELETE ON app_data.%I FOR EACH ROW EXECUTE FUNCTION app.physical_rollup_refresh(%L)',
+    tbl, t.id);
+
+  UPDATE app.tables
+  SET physical_table = tbl,
+      storage_mode = CASE WHEN storage_mode = 'eav' THEN 'dual' ELSE storage_mode END
+  WHERE id = t.id;
+
+  FOR c IN SELECT id FROM app.columns WHERE table_id = t.id AND kind = 'value' ORDER BY id LOOP
+    PERFORM app.add_physical_column(c.id);
+  END LOOP;
+
+  RETURN tbl;
+END$$;
+
+-- Columns follow app.columns: added on insert, adjusted when required or
+-- indexed change, dropped on delete.
+CREATE OR REPLACE FUNCTION app.on_columns_physical()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  tbl text;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    SELECT physical_table INTO tbl FROM app.tables WHERE id = OLD.table_id;
+    IF tbl IS NOT NULL AND to_regclass(format('app_data.%I', tbl)) IS NOT NULL THEN
+      EXECUTE format('ALTER TABLE app_data.%I DROP COLUMN IF EXISTS %I', tbl, 'c_' || OLD.id);
+    END IF;
+    RETURN OLD;
+  END IF;
+
+  IF TG_OP = 'UPDATE'
+     AND NEW.is_required = OLD.is_required
+     AND NEW.is_indexed = OLD.is_indexed THEN
+    RETURN NEW;
+  END IF;
+  PERFORM app.add_physical_column(NEW.id);
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS trg_columns_physical ON app.columns;
+CREATE TRIGGER trg_columns_physical
+AFTER INSERT OR UPDATE OR DELETE ON app.columns
+FOR EACH ROW EXECUTE FUNCTION app.on_columns_physical();
+
+CREATE OR REPLACE FUNCTION app.on_tables_delete_physical()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF OLD.physical_table IS NOT NULL THEN
+    EXECUTE format('DROP TABLE IF EXISTS app_data.%I', OLD.physical_table);
+  END IF;
+  RETURN OLD;
+END$$;
+
+DROP TRIGGER IF EXISTS trg_tables_drop_physical ON app.tables;
+CREATE TRIGGER trg_tables_drop_physical
+BEFORE DELETE ON app.tables
+FOR EACH ROW EXECUTE FUNCTION app.on_tables_delete_physical();
+
+-- The EAV values of a row keyed like its physical columns; NULLs left out.
+CREATE OR REPLACE FUNCTION app.eav_physical_values(p_row_id uuid)
+RETURNS jsonb LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(jsonb_object_agg('c_' || v.column_id, v.value), '{}'::jsonb)
+  FROM (
+    SELECT column_id, to_jsonb(value) AS value FROM app.values_text  WHERE row_id = p_row_id
+    UNION ALL
+    SELECT column_id, to_jsonb(value) FROM app.values_float WHERE row_id = p_row_id
+    UNION ALL
+    SELECT column_id, to_jsonb(value) FROM app.values_date  WHERE row_id = p_row_id
+    UNION ALL
+    SELECT column_id, to_jsonb(value) FROM app.values_bool  WHERE row_id = p_row_id
+    UNION ALL
+    SELECT column_id, to_jsonb(value) FROM app.values_enum  WHERE row_id = p_row_id
+    UNION ALL
+    SELECT column_id, to_jsonb(value) FROM app.values_uuid  WHERE row_id = p_row_id
+  ) v
+  WHERE v.value IS NOT NULL
+$$;
+
+-- Copy one row's EAV values into the physical table (insert or overwrite).
+CREATE OR REPLACE FUNCTION app.sync_physical_row(p_row_id uuid)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  r    app.rows;
+  tbl  text;
+  sets text;
+BEGIN
+  SELECT * INTO r FROM app.rows WHERE id = p_row_id;
+  SELECT physical_table INTO tbl FROM app.tables WHERE id = r.table_id;
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+
+  SELECT string_agg(format('%1$I = EXCLUDED.%1$I', 'c_' || c.id), ', ' ORDER BY c.id)
+  INTO sets
+  FROM app.columns c
+  WHERE c.table_id = r.table_id AND c.kind = 'value';
+
+  EXECUTE format(
+    'INSERT INTO app_data.%1$I SELECT * FROM jsonb_populate_record(NULL::app_data.%1$I, $1) ON CONFLICT (id) DO %2$s',
+    tbl, CASE WHEN sets IS NULL THEN 'NOTHING' ELSE 'UPDATE SET ' || sets END)
+  USING app.eav_physical_values(r.id)
+        || jsonb_build_object('id', r.id, 'org_id', r.org_id, 'table_id', r.table_id, 'created_at', r.created_at);
+END$$;
+
+-- Copy up to p_batch rows (all when NULL) that are missing from the
+-- physical table of a dual table, oldest first. Returns the number copied.
+CREATE OR REPLACE FUNCTION app.backfill_physical_table(p_table_id bigint, p_batch int)
+RETURNS int LANGUAGE plpgsql AS $$
+DECLARE
+  t app.tables;
+  r record;
+  n int := 0;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id;
+  IF t.storage_mode IS DISTINCT FROM 'dual' THEN
+    RAISE EXCEPTION 'Table % is not being migrated (storage_mode %)', p_table_id, t.storage_mode;
+  END IF;
+
+  FOR r IN EXECUTE format(
+    'SELECT rw.id FROM app.rows rw
+     WHERE rw.table_id = $1
+       AND NOT EXISTS (SELECT 1 FROM app_data.%I p WHERE p.id = rw.id)
+     ORDER BY rw.created_at, rw.id
+     LIMIT $2', t.physical_table)
+  USING p_table_id, p_batch
+  LOOP
+    PERFORM app.sync_physical_row(r.id);
+    n := n + 1;
+  END LOOP;
+  RETURN n;
+END$$;
+
+-- Rows of a dual table whose physical copy is missing or differs from EAV,
+-- oldest first. Empty for tables in any other mode.
+CREATE OR REPLACE FUNCTION app.physical_table_drift(p_table_id bigint, p_limit int)
+RETURNS SETOF uuid LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id;
+  IF t.storage_mode IS DISTINCT FROM 'dual' THEN
+    RETURN;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT rw.id
+    FROM app.rows rw
+    LEFT JOIN app_data.%I p ON p.id = rw.id
+    WHERE rw.table_id = $1
+      AND (p.id IS NULL
+           OR jsonb_strip_nulls(to_jsonb(p) - 'id' - 'org_id' - 'table_id' - 'created_at')
+              IS DISTINCT FROM app.eav_physical_values(rw.id))
+    ORDER BY rw.created_at, rw.id
+    LIMIT $2$q$, t.physical_table)
+  USING p_table_id, p_limit;
+END$$;
+
+-- Make the physical table authoritative. Runs under a lock on the table row
+-- that waits for in-flight writes (they hold KEY SHARE) and holds off new
+-- ones, so the final resync cannot miss a write.
+CREATE OR REPLACE FUNCTION app.cut_over_relational(p_table_id bigint)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t    app.tables;
+  r_id uuid;
+  c    record;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id FOR UPDATE;
+  IF t.id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+  IF t.storage_mode = 'relational' THEN
+    RETURN;
+  END IF;
+  IF t.storage_mode <> 'dual' THEN
+    RAISE EXCEPTION 'Table % must be backfilled before cut-over (storage_mode %)', p_table_id, t.storage_mode;
+  END IF;
+
+  FOR r_id IN SELECT * FROM app.physical_table_drift(p_table_id, NULL) LOOP
+    PERFORM app.sync_physical_row(r_id);
+  END LOOP;
+
+  UPDATE app.tables SET storage_mode = 'relational', migrated_at = now() WHERE id = p_table_id;
+
+  DELETE FROM app.values_text  v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+  DELETE FROM app.values_float v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+  DELETE FROM app.values_date  v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+  DELETE FROM app.values_bool  v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+  DELETE FROM app.values_enum  v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+  DELETE FROM app.values_uuid  v USING app.rows r WHERE r.id = v.row_id AND r.table_id = p_table_id;
+
+  -- Required columns become NOT NULL now that EAV is gone
+  FOR c IN SELECT id FROM app.columns WHERE table_id = p_table_id AND kind = 'value' LOOP
+    PERFORM app.add_physical_column(c.id);
+  END LOOP;
+END$$;
+
+-- Copy a relational table back into EAV and return it to dual mode, where
+-- EAV is authoritative again and the physical table is still kept in sync.
+CREATE OR REPLACE FUNCTION app.revert_relational(p_table_id bigint)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t app.tables;
+  c record;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id FOR UPDATE;
+  IF t.id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+  IF t.storage_mode <> 'relational' THEN
+    RETURN;
+  END IF;
+
+  FOR c IN SELECT id, type FROM app.columns WHERE table_id = p_table_id AND kind = 'value' LOOP
+    EXECUTE format(
+      'INSERT INTO app.%1$I (row_id, column_id, value)
+       SELECT p.id, $1, p.%2$I FROM app_data.%3$I p WHERE p.%2$I IS NOT NULL
+       ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value',
+      'values_' || c.type, 'c_' || c.id, t.physical_table)
+    USING c.id;
+  END LOOP;
+
+  UPDATE app.tables SET storage_mode = 'dual', migrated_at = NULL WHERE id = p_table_id;
+
+  FOR c IN SELECT id FROM app.columns WHERE table_id = p_table_id AND kind = 'value' LOOP
+    PERFORM app.add_physical_column(c.id);
+  END LOOP;
+END$$;
+
+-- Stop mirroring a dual table and drop its physical table.
+CREATE OR REPLACE FUNCTION app.drop_physical_table(p_table_id bigint)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t app.tables;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id FOR UPDATE;
+  IF t.id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+  IF t.storage_mode = 'relational' THEN
+    RAISE EXCEPTION 'Table % is relational; revert it before dropping its physical table', p_table_id;
+  END IF;
+  IF t.physical_table IS NOT NULL THEN
+    EXECUTE format('DROP TABLE IF EXISTS app_data.%I', t.physical_table);
+  END IF;
+  UPDATE app.tables
+  SET storage_mode = 'eav', physical_table = NULL, migrated_at = NULL
+  WHERE id = p_table_id;
+END$$;
+
+-- Rows whose value in uuid column p_column_id is p_target, from whichever
+-- engine holds the column's table.
+CREATE OR REPLACE FUNCTION app.referencing_rows(p_column_id bigint, p_target uuid)
+RETURNS SETOF uuid LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+BEGIN
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    RETURN QUERY EXECUTE format('SELECT p.id FROM app_data.%I p WHERE p.%I = $1',
+      t.physical_table, 'c_' || p_column_id)
+    USING p_target;
+  ELSE
+    RETURN QUERY
+      SELECT vu.row_id FROM app.values_uuid vu
+      WHERE vu.column_id = p_column_id AND vu.value = p_target;
+  END IF;
+END$$;
+
+-- The text or enum value of one cell, from either engine (used for labels).
+CREATE OR REPLACE FUNCTION app.cell_text(p_row_id uuid, p_column_id bigint)
+RETURNS text LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+  v text;
+BEGIN
+  IF p_row_id IS NULL OR p_column_id IS NULL THEN
+    RETURN NULL;
+  END IF;
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    EXECUTE format('SELECT p.%I::text FROM app_data.%I p WHERE p.id = $1',
+      'c_' || p_column_id, t.physical_table)
+    INTO v
+    USING p_row_id;
+    RETURN v;
+  END IF;
+
+  RETURN COALESCE(
+    (SELECT vt.value FROM app.values_text vt WHERE vt.row_id = p_row_id AND vt.column_id = p_column_id),
+    (SELECT ve.value FROM app.values_enum ve WHERE ve.row_id = p_row_id AND ve.column_id = p_column_id)
+  );
+END$$;
+
+-- Non-NULL values of a text or enum column of a relational table; empty for
+-- other tables, whose values are read from app.values_* directly. Without
+-- p_tsq, values containing p_q (all when NULL); with it, values matching the
+-- org search (words, substring or trigram similarity).
+CREATE OR REPLACE FUNCTION app.physical_text_values(p_column_id bigint, p_q text, p_tsq tsquery)
+RETURNS TABLE (row_id uuid, value text) LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl   text;
+  cname text;
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.columns c
+  JOIN app.tables t ON t.id = c.table_id
+  WHERE c.id = p_column_id
+    AND c.kind = 'value'
+    AND c.type IN ('text', 'enum')
+    AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+  cname := 'c_' || p_column_id;
+
+  IF p_tsq IS NULL THEN
+    RETURN QUERY EXECUTE format(
+      $q$SELECT p.id, p.%1$I FROM app_data.%2$I p
+      WHERE p.%1$I IS NOT NULL
+        AND ($1 IS NULL OR p.%1$I ILIKE '%%' || $1 || '%%')$q$, cname, tbl)
+    USING p_q;
+  ELSE
+    RETURN QUERY EXECUTE format(
+      $q$SELECT p.id, p.%1$I FROM app_data.%2$I p
+      WHERE to_tsvector('english', COALESCE(p.%1$I, '')) @@ $2
+         OR p.%1$I ILIKE app.like_contains($1)
+         OR p.%1$I %% $1$q$, cname, tbl)
+    USING p_q, p_tsq;
+  END IF;
+END$$;
+
+-- SearchUserTable for a relational table: the same payload (filterFields,
+-- sortField/sortDirection, pageNum/pageSize) and matching semantics, run as
+-- one query over the physical table. Filters are OR-ed; unknown fields and
+-- unsupported types match everything.
+CREATE OR REPLACE FUNCTION app.search_relational(p_table_id bigint, p jsonb)
+RETURNS TABLE (row_id uuid, created_at timestamptz, data jsonb, total_count bigint)
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl        text;
+  page_num   int := GREATEST(0, COALESCE((p->>'pageNum')::int, 0));
+  page_size  int := GREATEST(1, LEAST(COALESCE((p->>'pageSize')::int, 10), 100));
+  sort_field text := NULLIF(lower(p->>'sortField'), '');
+  sort_desc  boolean := lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc';
+  f          jsonb;
+  col        app.columns;
+  cname      text;
+  pred       text;
+  preds      text[] := '{}';
+  sort_expr  text;
+  order_by   text := 'p.created_at DESC';
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.tables t
+  WHERE t.id = p_table_id AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+
+  IF jsonb_typeof(p->'filterFields') = 'array' THEN
+    FOR f IN SELECT jsonb_array_elements(p->'filterFields') LOOP
+      col := NULL;
+      SELECT * INTO col FROM app.columns c
+      WHERE c.table_id = p_table_id AND lower(c.name) = lower(f->>'field');
+      cname := 'p.' || quote_ident('c_' || col.id);
+
+      IF col.id IS NULL THEN
+        pred := 'TRUE';
+      ELSIF col.kind IN ('computed', 'rollup') THEN
+        pred := format('app.match_computed(app.row_to_json(p.id) -> %L, %L::jsonb)', col.name, f);
+      ELSIF col.type = 'text' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'cn' THEN format('%s ILIKE %L', cname, '%' || (f->>'value') || '%')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'enum' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'bool' THEN
+        pred := format('%s = %L::boolean', cname, f->>'value');
+      ELSE
+        pred := 'TRUE';
+      END IF;
+      preds := preds || format('COALESCE(%s, FALSE)', pred);
+    END LOOP;
+  END IF;
+
+  IF sort_field IS NOT NULL THEN
+    col := NULL;
+    SELECT * INTO col FROM app.columns c WHERE c.table_id = p_table_id AND c.name = sort_field;
+    IF sort_field = 'id' THEN
+      sort_expr := 'p.id';
+    ELSIF sort_field = 'created_at' THEN
+      sort_expr := 'p.created_at';
+    ELSIF col.kind = 'value' THEN
+      sort_expr := 'p.' || quote_ident('c_' || col.id);
+    ELSIF col.id IS NOT NULL THEN
+      sort_expr := format('NULLIF(app.row_to_json(p.id) -> %L, ''null''::jsonb)', col.name);
+    END IF;
+    IF sort_expr IS NOT NULL THEN
+      order_by := format('%s %s NULLS LAST, p.created_at DESC',
+        sort_expr, CASE WHEN sort_desc THEN 'DESC' ELSE 'ASC' END);
+    END IF;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT s.id, s.created_at, app.row_to_json(s.id), s.total_count
+    FROM (
+      SELECT p.id, p.created_at, count(*) OVER () AS total_count
+      FROM app_data.%1$I p
+      WHERE %2$s
+      ORDER BY %3$s
+      LIMIT %4$s OFFSET %5$s
+    ) s$q$,
+    tbl,
+    CASE WHEN cardinality(preds) = 0 THEN 'TRUE' ELSE array_to_string(preds, ' OR ') END,
+    order_by, page_size, page_size * page_num);
+END$$;
+
+-- Writes to a relational table: the row is registered in app.rows, then its
+-- values are inserted into the physical table in one statement.
+CREATE OR REPLACE FUNCTION app.insert_row_relational(p_table_id bigint, p_values jsonb)
+RETURNS uuid LANGUAGE plpgsql AS $$
+DECLARE
+  r        app.rows;
+  tbl      text;
+  rec      record;
+  col      app.columns;
+  val_text text;
+  bad_col  text;
+  bad_kind text;
+  phys     jsonb := '{}'::jsonb;
+BEGIN
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  INSERT INTO app.rows(table_id, org_id)
+  SELECT t.id, t.org_id FROM app.tables t WHERE t.id = p_table_id
+  RETURNING * INTO r;
+  IF r.id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+  SELECT physical_table INTO tbl FROM app.tables WHERE id = p_table_id;
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = p_table_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    val_text := rec.value #>> '{}';
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+    -- Cast to the column type by jsonb_populate_record below
+    phys := phys || jsonb_build_object('c_' || col.id, val_text);
+  END LOOP;
+
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.kind = 'value'
+    AND c.is_required
+    AND NOT phys ? ('c_' || c.id);
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  EXECUTE format(
+    'INSERT INTO app_data.%1$I SELECT * FROM jsonb_populate_record(NULL::app_data.%1$I, $1)', tbl)
+  USING phys || jsonb_build_object('id', r.id, 'org_id', r.org_id, 'table_id', r.table_id, 'created_at', r.created_at);
+
+  RETURN r.id;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.update_row_relational(p_row_id uuid, p_values jsonb)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t_id     bigint;
+  tbl      text;
+  rec      record;
+  col      app.columns;
+  val_text text;
+  bad_col  text;
+  bad_kind text;
+  phys     jsonb := '{}'::jsonb;
+  sets     text[] := '{}';
+BEGIN
+  SELECT t.id, t.physical_table INTO t_id, tbl
+  FROM app.rows r
+  JOIN app.tables t ON t.id = r.table_id
+  WHERE r.id = p_row_id;
+  IF t_id IS NULL THEN RAISE EXCEPTION 'Unknown row_id %', p_row_id; END IF;
+
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = t_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = t_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, t_id;
+    END IF;
+
+    val_text := rec.value #>> '{}';
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+    phys := phys || jsonb_build_object('c_' || col.id, val_text);
+    sets := sets || format('%1$I = v.%1$I', 'c_' || col.id);
+  END LOOP;
+
+  IF cardinality(sets) = 0 THEN
+    RETURN;
+  END IF;
+  EXECUTE format(
+    'UPDATE app_data.%1$I p SET %2$s FROM jsonb_populate_record(NULL::app_data.%1$I, $1) v WHERE p.id = $2',
+    tbl, array_to_string(sets, ', '))
+  USING phys, p_row_id;
+END$$;
+
+-- The public entry points dispatch on the table's storage mode.
+
+-- row_to_json reads values from the physical table of a relational table
+CREATE OR REPLACE FUNCTION app.row_to_json(p_row_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    result jsonb := '{}'::jsonb;
+    mode   text;
+    tbl    text;
+    tid    bigint;
+    phys   jsonb;
+BEGIN
+    SELECT t.storage_mode, t.physical_table, r.table_id
+    INTO mode, tbl, tid
+    FROM app.rows r
+    JOIN app.tables t ON t.id = r.table_id
+    WHERE r.id = p_row_id;
+
+    IF mode = 'relational' THEN
+        -- Values live in the physical table; NULL columns are left out
+        EXECUTE format('SELECT to_jsonb(p) FROM app_data.%I p WHERE p.id = $1', tbl)
+        INTO phys
+        USING p_row_id;
+
+        SELECT COALESCE(jsonb_object_agg(c.name, phys -> ('c_' || c.id)), '{}'::jsonb)
+        INTO result
+        FROM app.columns c
+        WHERE c.table_id = tid
+          AND c.kind = 'value'
+          AND phys -> ('c_' || c.id) <> 'null'::jsonb;
+    ELSE
+        -- Add text values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_text v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+
+        -- Add float values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_float v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+
+        -- Add date values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_date v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+
+        -- Add boolean values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_bool v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+
+        -- Add enum values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_enum v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+
+        -- Add UUID reference values
+        SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, v.value), '{}'::jsonb)
+        INTO result
+        FROM app.values_uuid v
+        JOIN app.columns c ON c.id = v.column_id
+        WHERE v.row_id = p_row_id;
+    END IF;
+
+    -- Add metadata
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_build_object(
+        'id', r.id,
+        'created_at', r.created_at
+    ), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    WHERE r.id = p_row_id;
+
+    -- Add cached rollup values (NULL until first refreshed)
+    SELECT COALESCE(result, '{}'::jsonb) || COALESCE(jsonb_object_agg(c.name, rv.value), '{}'::jsonb)
+    INTO result
+    FROM app.rows r
+    JOIN app.columns c ON c.table_id = r.table_id AND c.kind = 'rollup'
+    LEFT JOIN app.rollup_values rv ON rv.column_id = c.id AND rv.row_id = r.id
+    WHERE r.id = p_row_id;
+
+    -- Evaluate computed columns over the stored values
+    RETURN app.apply_computed(
+        (SELECT r.table_id FROM app.rows r WHERE r.id = p_row_id),
+        COALESCE(result, '{}'::jsonb)
+    );
+END;
+$$;
+
+-- Rollups find their children through either engine
+CREATE OR REPLACE FUNCTION app.rollup_children(p_column_id bigint, p_parent uuid)
+RETURNS TABLE (created_at timestamptz, v jsonb)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT r.created_at,
+         NULLIF(d.data -> t.name, 'null'::jsonb) AS v
+  FROM app.columns c
+  CROSS JOIN LATERAL app.referencing_rows(c.rollup_via_column_id, p_parent) child(id)
+  JOIN app.rows r ON r.id = child.id
+  LEFT JOIN app.columns t ON t.id = c.rollup_target_column_id
+  CROSS JOIN LATERAL (SELECT app.row_to_json(r.id) AS data) d
+  WHERE c.id = p_column_id
+    AND c.kind = 'rollup'
+    AND NOT EXISTS (
+      SELECT 1
+      FROM jsonb_array_elements(COALESCE(c.rollup_filter, '[]'::jsonb)) f
+      WHERE NOT COALESCE(app.match_computed(d.data -> lower(f->>'field'), f), FALSE)
+    );
+$$;
+
+CREATE OR REPLACE FUNCTION app.insert_row(p_table_id bigint, p_values jsonb)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  r_id uuid;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+  mode text;
+  deferred text := current_setting('app.rollups_deferred', true);
+BEGIN
+  -- KEY SHARE makes a storage cut-over wait for this write, and this write
+  -- wait for a cut-over in progress
+  SELECT t.storage_mode INTO mode FROM app.tables t WHERE t.id = p_table_id FOR KEY SHARE;
+  IF mode = 'relational' THEN
+    RETURN app.insert_row_relational(p_table_id, p_values);
+  END IF;
+
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = p_table_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  -- The row takes the org of its table; a table outside the current org is
+  -- not visible here, so nothing is inserted
+  INSERT INTO app.rows(table_id, org_id)
+  SELECT t.id, t.org_id FROM app.tables t WHERE t.id = p_table_id
+  RETURNING id INTO r_id;
+  IF r_id IS NULL THEN
+    RAISE EXCEPTION 'Unknown table_id %', p_table_id;
+  END IF;
+
+  -- Rollups over the row are refreshed once, after its last cell
+  PERFORM set_config('app.rollups_deferred', 'on', true);
+
+  -- For each key in p_values, route to the right values_* table
+  FOR rec IN
+    SELECT key AS col_name, value
+    FROM jsonb_each(p_values)
+  LOOP
+    SELECT *
+      INTO col
+    FROM app.columns
+    WHERE table_id = p_table_id
+      AND name      = rec.col_name;
+
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, p_table_id;
+    END IF;
+
+    -- Unwrap JSON scalar to text once (JSON null -> NULL)
+    val_text := rec.value #>> '{}';
+
+    -- Required check for an explicitly provided NULL (JSON null)
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Type-directed insert (cast from text)
+    IF col.type = 'text'::app.column_type THEN
+      -- val_text is already text (can be empty string if user passed "")
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'date'::app.column_type THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::date);
+
+    ELSIF col.type = 'bool'::app.column_type THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::boolean);
+    
+    ELSIF col.type = 'float'::app.column_type THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::float);
+
+    ELSIF col.type = 'enum'::app.column_type THEN
+      -- Store plain label (e.g., vip). Your enum validator should compare to col.enum_values text[]
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text);
+
+    ELSIF col.type = 'uuid'::app.column_type THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (r_id, col.id, val_text::uuid);
+
+    ELSE
+      RAISE EXCEPTION 'Unsupported column type "%" for column "%"', col.type, col.name;
+    END IF;
+
+    -- Ensure index if needed
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+
+  END LOOP;
+
+  PERFORM set_config('app.rollups_deferred', COALESCE(deferred, ''), true);
+  PERFORM app.refresh_rollups_for_children(ARRAY[r_id]);
+
+  -- Final pass: verify all required columns are present
+  PERFORM 1
+  FROM app.columns c
+  WHERE c.table_id = p_table_id
+    AND c.is_required
+    AND NOT EXISTS (
+      SELECT 1 FROM app.values_text vt WHERE vt.row_id = r_id AND vt.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_date vd WHERE vd.row_id = r_id AND vd.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_bool vb WHERE vb.row_id = r_id AND vb.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_enum ve WHERE ve.row_id = r_id AND ve.column_id = c.id
+      UNION ALL
+      SELECT 1 FROM app.values_uuid vu WHERE vu.row_id = r_id AND vu.column_id = c.id
+    );
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'Missing required columns for table_id %', p_table_id;
+  END IF;
+
+  IF mode = 'dual' THEN
+    PERFORM app.sync_physical_row(r_id);
+  END IF;
+
+  RETURN r_id;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION app.update_row(p_row_id uuid, p_values jsonb)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  t_id bigint;
+  rec record;
+  col app.columns;
+  val_text text;  -- unwrapped scalar from jsonb (NULL if JSON null)
+  bad_col text;
+  bad_kind text;
+  mode text;
+  deferred text := current_setting('app.rollups_deferred', true);
+  old_refs app.values_uuid[];
+BEGIN
+  SELECT r.table_id, t.storage_mode INTO t_id, mode
+  FROM app.rows r
+  JOIN app.tables t ON t.id = r.table_id
+  WHERE r.id = p_row_id
+  FOR KEY SHARE OF t;
+  IF t_id IS NULL THEN RAISE EXCEPTION 'Unknown row_id %', p_row_id; END IF;
+  IF mode = 'relational' THEN
+    PERFORM app.update_row_relational(p_row_id, p_values);
+    RETURN;
+  END IF;
+
+  -- Computed and rollup columns are derived and never written directly
+  SELECT c.name, c.kind INTO bad_col, bad_kind
+  FROM app.columns c
+  WHERE c.table_id = t_id AND c.kind <> 'value' AND p_values ? c.name
+  LIMIT 1;
+  IF bad_col IS NOT NULL THEN
+    RAISE EXCEPTION '% column "%" cannot be written', initcap(bad_kind), bad_col;
+  END IF;
+
+  -- Rollups over the row are refreshed once, after its last cell, for the
+  -- parents it references before and after
+  old_refs := ARRAY(SELECT vu FROM app.values_uuid vu WHERE vu.row_id = p_row_id);
+  PERFORM set_config('app.rollups_deferred', 'on', true);
+
+  FOR rec IN SELECT key AS col_name, value FROM jsonb_each(p_values)
+  LOOP
+    SELECT * INTO col FROM app.columns WHERE table_id = t_id AND name = rec.col_name;
+    IF col.id IS NULL THEN
+      RAISE EXCEPTION 'Unknown column "%" for table_id %', rec.col_name, t_id;
+    END IF;
+
+    val_text := rec.value #>> '{}';
+
+    -- A required column may not be cleared
+    IF col.is_required AND val_text IS NULL THEN
+      RAISE EXCEPTION 'Required column "%" cannot be null', col.name;
+    END IF;
+
+    -- Upsert into the right value table
+    IF col.type='text' THEN
+      INSERT INTO app.values_text(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='date' THEN
+      INSERT INTO app.values_date(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text::date)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='bool' THEN
+      INSERT INTO app.values_bool(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text::boolean)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='float' THEN
+      INSERT INTO app.values_float(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text::float)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='enum' THEN
+      INSERT INTO app.values_enum(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+
+    ELSIF col.type='uuid' THEN
+      INSERT INTO app.values_uuid(row_id, column_id, value)
+      VALUES (p_row_id, col.id, val_text::uuid)
+      ON CONFLICT (row_id, column_id) DO UPDATE SET value = EXCLUDED.value;
+    END IF;
+
+    IF col.is_indexed THEN
+      PERFORM app.ensure_index(col.id);
+    END IF;
+  END LOOP;
+
+  PERFORM set_config('app.rollups_deferred', COALESCE(deferred, ''), true);
+  PERFORM app.refresh_rollups_for_children(ARRAY[p_row_id], old_refs);
+
+  IF mode = 'dual' THEN
+    PERFORM app.sync_physical_row(p_row_id);
+  END IF;
+END$$;
+
+COMMIT;
@@ -0,0 +1,31 @@
+-- Revert set-based row materialisation: rollups compose their children one
+-- row at a time again.
+
+BEGIN;
+
+-- Restore the per-row rollup children of 027
+CREATE OR REPLACE FUNCTION app.rollup_children(p_column_id bigint, p_parent uuid)
+RETURNS TABLE (created_at timestamptz, v jsonb)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT r.created_at,
+         NULLIF(d.data -> t.name, 'null'::jsonb) AS v
+  FROM app.columns c
+  CROSS JOIN LATERAL app.referencing_rows(c.rollup_via_column_id, p_parent) child(id)
+  JOIN app.rows r ON r.id = child.id
+  LEFT JOIN app.columns t ON t.id = c.rollup_target_column_id
+  CROSS JOIN LATERAL (SELECT app.row_to_json(r.id) AS data) d
+  WHERE c.id = p_column_id
+    AND c.kind = 'rollup'
+    AND NOT EXISTS (
+      SELECT 1
+      FROM jsonb_array_elements(COALESCE(c.rollup_filter, '[]'::jsonb)) f
+      WHERE NOT COALESCE(app.match_computed(d.data -> lower(f->>'field'), f), FALSE)
+    );
+$$;
+
+DROP FUNCTION IF EXISTS app.cell_value(uuid, bigint);
+DROP FUNCTION IF EXISTS app.rows_to_json(bigint, uuid[]);
+
+COMMIT;
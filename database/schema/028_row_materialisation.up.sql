@@ -0,0 +1,159 @@
+-- Set-based row materialisation.
+--
+-- app.row_to_json composes one row with a query per values table, and search
+-- used to call it for every filtered row just to sort them. Search now sorts
+-- and filters on single cells (app.cell_value), pages the row ids and only
+-- then composes the page with app.rows_to_json, which reads each values table
+-- once for the whole set. Rollups compose their children the same way.
+-- database/bench/row_materialisation.sql compares both paths.
+
+BEGIN;
+
+-- The JSON of a set of rows of one table, as app.row_to_json builds it for
+-- each of them: stored values, id and created_at, cached rollups, then
+-- computed columns. Ids that are not rows of the table are skipped.
+CREATE OR REPLACE FUNCTION app.rows_to_json(p_table_id bigint, p_row_ids uuid[])
+RETURNS TABLE (row_id uuid, data jsonb)
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  t        app.tables;
+  stored   jsonb;
+  computed boolean;
+BEGIN
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id;
+  IF t.id IS NULL OR COALESCE(cardinality(p_row_ids), 0) = 0 THEN
+    RETURN;
+  END IF;
+
+  -- Stored values keyed by row id, in one pass over the engine's storage
+  IF t.storage_mode = 'relational' THEN
+    -- NULL columns are left out, as in row_to_json
+    EXECUTE format($q$
+      SELECT jsonb_object_agg(p.id::text, (
+               SELECT COALESCE(jsonb_object_agg(c.name, j.v), '{}'::jsonb)
+               FROM app.columns c
+               CROSS JOIN LATERAL (SELECT to_jsonb(p) -> ('c_' || c.id) AS v) j
+               WHERE c.table_id = $2
+                 AND c.kind = 'value'
+                 AND j.v <> 'null'::jsonb))
+      FROM app_data.%I p
+      WHERE p.id = ANY($1)$q$, t.physical_table)
+    INTO stored
+    USING p_row_ids, p_table_id;
+  ELSE
+    SELECT jsonb_object_agg(v.row_id::text, v.data)
+    INTO stored
+    FROM (
+      SELECT v.row_id, jsonb_object_agg(c.name, v.value) AS data
+      FROM (
+        SELECT vt.row_id, vt.column_id, to_jsonb(vt.value) AS value
+        FROM app.values_text vt WHERE vt.row_id = ANY(p_row_ids)
+        UNION ALL
+        SELECT vf.row_id, vf.column_id, to_jsonb(vf.value)
+        FROM app.values_float vf WHERE vf.row_id = ANY(p_row_ids)
+        UNION ALL
+        SELECT vd.row_id, vd.column_id, to_jsonb(vd.value)
+        FROM app.values_date vd WHERE vd.row_id = ANY(p_row_ids)
+        UNION ALL
+        SELECT vb.row_id, vb.column_id, to_jsonb(vb.value)
+        FROM app.values_bool vb WHERE vb.row_id = ANY(p_row_ids)
+        UNION ALL
+        SELECT ve.row_id, ve.column_id, to_jsonb(ve.value)
+        FROM app.values_enum ve WHERE ve.row_id = ANY(p_row_ids)
+        UNION ALL
+        SELECT vu.row_id, vu.column_id, to_jsonb(vu.value)
+        FROM app.values_uuid vu WHERE vu.row_id = ANY(p_row_ids)
+      ) v
+      JOIN app.columns c ON c.id = v.column_id
+      GROUP BY v.row_id
+    ) v;
+  END IF;
+
+  computed := EXISTS (
+    SELECT 1 FROM app.columns c WHERE c.table_id = p_table_id AND c.kind = 'computed'
+  );
+
+  RETURN QUERY
+  WITH base AS (
+    SELECT r.id,
+           COALESCE(stored -> r.id::text, '{}'::jsonb)
+             || jsonb_build_object('id', r.id, 'created_at', r.created_at) AS data
+    FROM app.rows r
+    WHERE r.id = ANY(p_row_ids)
+      AND r.table_id = p_table_id
+  ),
+  -- Cached rollup values (NULL until first refreshed)
+  rollups AS (
+    SELECT b.id, jsonb_object_agg(c.name, rv.value) AS data
+    FROM base b
+    JOIN app.columns c ON c.table_id = p_table_id AND c.kind = 'rollup'
+    LEFT JOIN app.rollup_values rv ON rv.column_id = c.id AND rv.row_id = b.id
+    GROUP BY b.id
+  )
+  SELECT b.id,
+         CASE WHEN computed
+              THEN app.apply_computed(p_table_id, b.data || COALESCE(ru.data, '{}'::jsonb))
+              ELSE b.data || COALESCE(ru.data, '{}'::jsonb)
+         END
+  FROM base b
+  LEFT JOIN rollups ru ON ru.id = b.id;
+END$$;
+
+-- One cell of an EAV (or dual) row as row_to_json shows it, without
+-- composing the rest of the row; computed cells still need the whole row.
+-- NULL when the cell is empty or the column does not exist.
+CREATE OR REPLACE FUNCTION app.cell_value(p_row_id uuid, p_column_id bigint)
+RETURNS jsonb
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT CASE
+    WHEN c.kind = 'rollup' THEN
+      (SELECT rv.value FROM app.rollup_values rv WHERE rv.row_id = p_row_id AND rv.column_id = c.id)
+    WHEN c.kind = 'computed' THEN
+      app.row_to_json(p_row_id) -> c.name
+    WHEN c.type = 'text' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_text v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+    WHEN c.type = 'float' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_float v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+    WHEN c.type = 'date' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_date v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+    WHEN c.type = 'bool' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_bool v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+    WHEN c.type = 'enum' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_enum v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+    WHEN c.type = 'uuid' THEN
+      (SELECT to_jsonb(v.value) FROM app.values_uuid v WHERE v.row_id = p_row_id AND v.column_id = c.id)
+  END
+  FROM app.columns c
+  WHERE c.id = p_column_id;
+$$;
+
+-- Rollups compose all children of a parent in one call
+CREATE OR REPLACE FUNCTION app.rollup_children(p_column_id bigint, p_parent uuid)
+RETURNS TABLE (created_at timestamptz, v jsonb)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT r.created_at,
+         NULLIF(d.data -> t.name, 'null'::jsonb) AS v
+  FROM app.columns c
+  JOIN app.columns via ON via.id = c.rollup_via_column_id
+  CROSS JOIN LATERAL app.rows_to_json(
+    via.table_id,
+    ARRAY(SELECT app.referencing_rows(c.rollup_via_column_id, p_parent))
+  ) d
+  JOIN app.rows r ON r.id = d.row_id
+  LEFT JOIN app.columns t ON t.id = c.rollup_target_column_id
+  WHERE c.id = p_column_id
+    AND c.kind = 'rollup'
+    AND NOT EXISTS (
+      SELECT 1
+      FROM jsonb_array_elements(COALESCE(c.rollup_filter, '[]'::jsonb)) f
+      WHERE NOT COALESCE(app.match_computed(d.data -> lower(f->>'field'), f), FALSE)
+    );
+$$;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.table_rights(bigint, uuid);
+DROP TABLE IF EXISTS app.table_grants;
+DROP TABLE IF EXISTS app.team_members;
+DROP FUNCTION IF EXISTS app.check_team_org();
+
+COMMIT;
@@ -0,0 +1,134 @@
+-- Per-table permissions.
+--
+-- A grant gives one principal rights on one user table: an org role (and
+-- every higher role), a user, or a team. Teams are rows of a user table,
+-- normally Teams, with their members listed in app.team_members. A table
+-- without grants falls back to role defaults: Viewers read, Members also
+-- create, edit and delete rows, Admins also manage the schema. Owners always
+-- hold every right, and any right implies read.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.team_members (
+  org_id  uuid NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  team_id uuid NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_members_user_idx ON app.team_members (org_id, user_id);
+
+CREATE TABLE IF NOT EXISTS app.table_grants (
+  id         bigserial   PRIMARY KEY,
+  org_id     uuid        NOT NULL,
+  table_id   bigint      NOT NULL,
+  role       org_role,
+  user_id    uuid        REFERENCES users(id) ON DELETE CASCADE,
+  team_id    uuid        REFERENCES app.rows(id) ON DELETE CASCADE,
+  can_read   boolean     NOT NULL DEFAULT false,
+  can_create boolean     NOT NULL DEFAULT false,
+  can_edit   boolean     NOT NULL DEFAULT false,
+  can_delete boolean     NOT NULL DEFAULT false,
+  can_manage boolean     NOT NULL DEFAULT false,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT table_grants_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE,
+  CONSTRAINT table_grants_principal_check CHECK (num_nonnulls(role, user_id, team_id) = 1)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS table_grants_role_key ON app.table_grants (table_id, role) WHERE role IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS table_grants_user_key ON app.table_grants (table_id, user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS table_grants_team_key ON app.table_grants (table_id, team_id) WHERE team_id IS NOT NULL;
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['team_members','table_grants'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- A team is a row of the same org; the FK alone would accept any org's row.
+CREATE OR REPLACE FUNCTION app.check_team_org()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF NEW.team_id IS NOT NULL
+     AND NOT EXISTS (SELECT 1 FROM app.rows r WHERE r.id = NEW.team_id AND r.org_id = NEW.org_id) THEN
+    RAISE EXCEPTION 'Team % not found', NEW.team_id
+      USING ERRCODE = 'foreign_key_violation';
+  END IF;
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS trg_team_members_org ON app.team_members;
+CREATE TRIGGER trg_team_members_org
+BEFORE INSERT OR UPDATE ON app.team_members
+FOR EACH ROW EXECUTE FUNCTION app.check_team_org();
+
+DROP TRIGGER IF EXISTS trg_table_grants_org ON app.table_grants;
+CREATE TRIGGER trg_table_grants_org
+BEFORE INSERT OR UPDATE ON app.table_grants
+FOR EACH ROW EXECUTE FUNCTION app.check_team_org();
+
+-- Rights of a user on a table. No row when the user is not a member of the
+-- table's org. org_role sorts Owner first, so "role or higher" is <=.
+CREATE OR REPLACE FUNCTION app.table_rights(p_table_id bigint, p_user_id uuid)
+RETURNS TABLE (
+  can_read   boolean,
+  can_create boolean,
+  can_edit   boolean,
+  can_delete boolean,
+  can_manage boolean
+)
+LANGUAGE sql
+STABLE
+AS $$
+  WITH m AS (
+    SELECT om.role
+    FROM app.tables t
+    JOIN org_memberships om ON om.org_id = t.org_id AND om.user_id = p_user_id
+    WHERE t.id = p_table_id
+  ),
+  grants AS (
+    SELECT g.role, g.user_id, g.team_id,
+           g.can_read, g.can_create, g.can_edit, g.can_delete, g.can_manage
+    FROM app.table_grants g
+    WHERE g.table_id = p_table_id
+    UNION ALL
+    SELECT d.role::org_role, NULL::uuid, NULL::uuid,
+           d.can_read, d.can_create, d.can_edit, d.can_delete, d.can_manage
+    FROM (VALUES
+      ('Viewer', true, false, false, false, false),
+      ('Member', true, true,  true,  true,  false),
+      ('Admin',  true, true,  true,  true,  true)
+    ) AS d(role, can_read, can_create, can_edit, can_delete, can_manage)
+    WHERE NOT EXISTS (SELECT 1 FROM app.table_grants g WHERE g.table_id = p_table_id)
+  ),
+  held AS (
+    SELECT
+      COALESCE(bool_or(g.can_read OR g.can_create OR g.can_edit OR g.can_delete OR g.can_manage), false) AS can_read,
+      COALESCE(bool_or(g.can_create), false) AS can_create,
+      COALESCE(bool_or(g.can_edit), false)   AS can_edit,
+      COALESCE(bool_or(g.can_delete), false) AS can_delete,
+      COALESCE(bool_or(g.can_manage), false) AS can_manage
+    FROM m
+    JOIN grants g
+      ON m.role <= g.role
+      OR g.user_id = p_user_id
+      OR g.team_id IN (SELECT tm.team_id FROM app.team_members tm WHERE tm.user_id = p_user_id)
+  )
+  SELECT m.role = 'Owner' OR h.can_read,
+         m.role = 'Owner' OR h.can_create,
+         m.role = 'Owner' OR h.can_edit,
+         m.role = 'Owner' OR h.can_delete,
+         m.role = 'Owner' OR h.can_manage
+  FROM m CROSS JOIN held h;
+$$;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.check_field_writes(bigint, jsonb);
+DROP FUNCTION IF EXISTS app.mask_fields(bigint, jsonb);
+DROP FUNCTION IF EXISTS app.mask_value(jsonb);
+DROP FUNCTION IF EXISTS app.field_editable(org_role, org_role);
+DROP FUNCTION IF EXISTS app.field_visible(org_role);
+DROP FUNCTION IF EXISTS app.role_at_least(org_role);
+DROP FUNCTION IF EXISTS app.current_org_role();
+DROP FUNCTION IF EXISTS app.current_user_id();
+
+ALTER TABLE app.columns DROP CONSTRAINT IF EXISTS columns_access_roles_chk;
+ALTER TABLE app.columns
+  DROP COLUMN IF EXISTS masked,
+  DROP COLUMN IF EXISTS edit_role,
+  DROP COLUMN IF EXISTS read_role;
+
+COMMIT;
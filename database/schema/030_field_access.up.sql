@@ -0,0 +1,125 @@
+-- Field-level access: per-column visibility and editability by org role.
+--
+-- read_role is the lowest role that sees a column's values; callers below it
+-- get the key omitted, or a masked value when masked is set. edit_role is the
+-- lowest role that may write the column (seeing it is required as well).
+-- NULL means no restriction. Rules stop at Admin so Admins and Owners always
+-- see the full schema they manage.
+--
+-- The API sets app.user_id next to app.org_id. Statements without a user
+-- (CLI tools, migrations) are not restricted. app.row_to_json and
+-- app.rows_to_json stay unrestricted because rollups and computed columns are
+-- composed from them; the queries serving rows apply app.mask_fields.
+
+BEGIN;
+
+ALTER TABLE app.columns
+  ADD COLUMN IF NOT EXISTS read_role org_role,
+  ADD COLUMN IF NOT EXISTS edit_role org_role,
+  ADD COLUMN IF NOT EXISTS masked    boolean NOT NULL DEFAULT false;
+
+ALTER TABLE app.columns DROP CONSTRAINT IF EXISTS columns_access_roles_chk;
+ALTER TABLE app.columns ADD CONSTRAINT columns_access_roles_chk
+  CHECK (read_role IS DISTINCT FROM 'Owner' AND edit_role IS DISTINCT FROM 'Owner');
+
+CREATE OR REPLACE FUNCTION app.current_user_id()
+RETURNS uuid LANGUAGE sql STABLE AS $$
+  SELECT NULLIF(current_setting('app.user_id', true), '')::uuid
+$$;
+
+-- The caller's role in the current org; NULL without a user or membership.
+CREATE OR REPLACE FUNCTION app.current_org_role()
+RETURNS org_role LANGUAGE sql STABLE AS $$
+  SELECT om.role
+  FROM org_memberships om
+  WHERE om.org_id = app.current_org()
+    AND om.user_id = app.current_user_id()
+$$;
+
+-- Whether the caller holds p_role or higher. Unrestricted (NULL) rules and
+-- statements without a user always pass.
+CREATE OR REPLACE FUNCTION app.role_at_least(p_role org_role)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT p_role IS NULL
+      OR app.current_user_id() IS NULL
+      OR COALESCE(app.current_org_role() <= p_role, false)
+$$;
+
+CREATE OR REPLACE FUNCTION app.field_visible(p_read_role org_role)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT app.role_at_least(p_read_role)
+$$;
+
+CREATE OR REPLACE FUNCTION app.field_editable(p_read_role org_role, p_edit_role org_role)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT app.role_at_least(p_read_role) AND app.role_at_least(p_edit_role)
+$$;
+
+-- Masked text keeps its last four characters, e.g. a phone number's
+-- extension; every other value becomes a fixed placeholder.
+CREATE OR REPLACE FUNCTION app.mask_value(p_value jsonb)
+RETURNS jsonb LANGUAGE sql IMMUTABLE AS $$
+  SELECT CASE
+    WHEN jsonb_typeof(p_value) = 'string' AND length(p_value #>> '{}') > 4
+      THEN to_jsonb(repeat('•', length(p_value #>> '{}') - 4) || right(p_value #>> '{}', 4))
+    ELSE to_jsonb('••••'::text)
+  END
+$$;
+
+-- Removes or masks the values of p_data the caller may not see.
+CREATE OR REPLACE FUNCTION app.mask_fields(p_table_id bigint, p_data jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  c record;
+BEGIN
+  IF p_data IS NULL OR app.current_user_id() IS NULL THEN
+    RETURN p_data;
+  END IF;
+  FOR c IN
+    SELECT col.name, col.masked
+    FROM app.columns col
+    WHERE col.table_id = p_table_id
+      AND col.read_role IS NOT NULL
+      AND NOT app.field_visible(col.read_role)
+  LOOP
+    IF c.masked AND jsonb_typeof(p_data -> c.name) <> 'null' THEN
+      p_data := jsonb_set(p_data, ARRAY[c.name], app.mask_value(p_data -> c.name));
+    ELSE
+      p_data := p_data - c.name;
+    END IF;
+  END LOOP;
+  RETURN p_data;
+END$$;
+
+-- Rejects writes to columns the caller may not edit and returns p_values
+-- unchanged, so it can wrap the values handed to insert_row/update_row.
+CREATE OR REPLACE FUNCTION app.check_field_writes(p_table_id bigint, p_values jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  bad text;
+BEGIN
+  IF p_values IS NULL OR app.current_user_id() IS NULL THEN
+    RETURN p_values;
+  END IF;
+  SELECT col.name INTO bad
+  FROM app.columns col
+  WHERE col.table_id = p_table_id
+    AND p_values ? col.name
+    AND (col.read_role IS NOT NULL OR col.edit_role IS NOT NULL)
+    AND NOT app.field_editable(col.read_role, col.edit_role)
+  ORDER BY col.id
+  LIMIT 1;
+  IF bad IS NOT NULL THEN
+    RAISE EXCEPTION 'Field "%" is read-only for your role', bad
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  RETURN p_values;
+END$$;
+
+COMMIT;
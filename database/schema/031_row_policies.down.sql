@@ -0,0 +1,134 @@
+-- Revert row-level sharing policies.
+
+BEGIN;
+
+-- Restore the mask_fields of 030
+CREATE OR REPLACE FUNCTION app.mask_fields(p_table_id bigint, p_data jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  c record;
+BEGIN
+  IF p_data IS NULL OR app.current_user_id() IS NULL THEN
+    RETURN p_data;
+  END IF;
+  FOR c IN
+    SELECT col.name, col.masked
+    FROM app.columns col
+    WHERE col.table_id = p_table_id
+      AND col.read_role IS NOT NULL
+      AND NOT app.field_visible(col.read_role)
+  LOOP
+    IF c.masked AND jsonb_typeof(p_data -> c.name) <> 'null' THEN
+      p_data := jsonb_set(p_data, ARRAY[c.name], app.mask_value(p_data -> c.name));
+    ELSE
+      p_data := p_data - c.name;
+    END IF;
+  END LOOP;
+  RETURN p_data;
+END$$;
+
+-- Restore the search_relational of 027
+CREATE OR REPLACE FUNCTION app.search_relational(p_table_id bigint, p jsonb)
+RETURNS TABLE (row_id uuid, created_at timestamptz, data jsonb, total_count bigint)
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl        text;
+  page_num   int := GREATEST(0, COALESCE((p->>'pageNum')::int, 0));
+  page_size  int := GREATEST(1, LEAST(COALESCE((p->>'pageSize')::int, 10), 100));
+  sort_field text := NULLIF(lower(p->>'sortField'), '');
+  sort_desc  boolean := lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc';
+  f          jsonb;
+  col        app.columns;
+  cname      text;
+  pred       text;
+  preds      text[] := '{}';
+  sort_expr  text;
+  order_by   text := 'p.created_at DESC';
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.tables t
+  WHERE t.id = p_table_id AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+
+  IF jsonb_typeof(p->'filterFields') = 'array' THEN
+    FOR f IN SELECT jsonb_array_elements(p->'filterFields') LOOP
+      col := NULL;
+      SELECT * INTO col FROM app.columns c
+      WHERE c.table_id = p_table_id AND lower(c.name) = lower(f->>'field');
+      cname := 'p.' || quote_ident('c_' || col.id);
+
+      IF col.id IS NULL THEN
+        pred := 'TRUE';
+      ELSIF col.kind IN ('computed', 'rollup') THEN
+        pred := format('app.match_computed(app.row_to_json(p.id) -> %L, %L::jsonb)', col.name, f);
+      ELSIF col.type = 'text' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'cn' THEN format('%s ILIKE %L', cname, '%' || (f->>'value') || '%')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'enum' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'bool' THEN
+        pred := format('%s = %L::boolean', cname, f->>'value');
+      ELSE
+        pred := 'TRUE';
+      END IF;
+      preds := preds || format('COALESCE(%s, FALSE)', pred);
+    END LOOP;
+  END IF;
+
+  IF sort_field IS NOT NULL THEN
+    col := NULL;
+    SELECT * INTO col FROM app.columns c WHERE c.table_id = p_table_id AND c.name = sort_field;
+    IF sort_field = 'id' THEN
+      sort_expr := 'p.id';
+    ELSIF sort_field = 'created_at' THEN
+      sort_expr := 'p.created_at';
+    ELSIF col.kind = 'value' THEN
+      sort_expr := 'p.' || quote_ident('c_' || col.id);
+    ELSIF col.id IS NOT NULL THEN
+      sort_expr := format('NULLIF(app.row_to_json(p.id) -> %L, ''null''::jsonb)', col.name);
+    END IF;
+    IF sort_expr IS NOT NULL THEN
+      order_by := format('%s %s NULLS LAST, p.created_at DESC',
+        sort_expr, CASE WHEN sort_desc THEN 'DESC' ELSE 'ASC' END);
+    END IF;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT s.id, s.created_at, app.row_to_json(s.id), s.total_count
+    FROM (
+      SELECT p.id, p.created_at, count(*) OVER () AS total_count
+      FROM app_data.%1$I p
+      WHERE %2$s
+      ORDER BY %3$s
+      LIMIT %4$s OFFSET %5$s
+    ) s$q$,
+    tbl,
+    CASE WHEN cardinality(preds) = 0 THEN 'TRUE' ELSE array_to_string(preds, ' OR ') END,
+    order_by, page_size, page_size * page_num);
+END$$;
+
+DROP FUNCTION IF EXISTS app.aggregate_restricted(bigint);
+DROP FUNCTION IF EXISTS app.row_visible(uuid);
+DROP FUNCTION IF EXISTS app.visible_rows(bigint, uuid[]);
+DROP FUNCTION IF EXISTS app.rows_restricted(bigint);
+DROP FUNCTION IF EXISTS app.row_policy_predicate(bigint);
+DROP FUNCTION IF EXISTS app.current_user_teams();
+
+DROP TABLE IF EXISTS app.row_policies;
+
+ALTER TABLE app.rows DROP COLUMN IF EXISTS created_by;
+
+COMMIT;
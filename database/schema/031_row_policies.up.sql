@@ -0,0 +1,296 @@
+-- Row-level sharing policies.
+--
+-- A policy restricts which rows of one table a principal sees: an org role
+-- (that role and every lower one), a user, or a team. Its condition is a
+-- formula over the row's columns and the current user, e.g.
+-- "team IN current_user.teams" or "created_by = current_user", compiled by
+-- the API (internal/formula) to expression_sql over the cells it references
+-- ("d", by name) and the app.rows row ("r"). Only the API writes
+-- expression_sql.
+--
+-- A caller matched by any policy of a table sees the rows passing at least
+-- one of them; callers no policy names see every row. Admins, Owners and
+-- statements without a user are never restricted. The queries serving rows,
+-- labels, lookups and org search filter through app.visible_rows; rollups
+-- over a table that is restricted for the caller are hidden rather than
+-- computed over rows the caller cannot see.
+
+BEGIN;
+
+ALTER TABLE app.rows
+  ADD COLUMN IF NOT EXISTS created_by uuid REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE app.rows
+  ALTER COLUMN created_by SET DEFAULT app.current_user_id();
+
+CREATE TABLE IF NOT EXISTS app.row_policies (
+  id             bigserial   PRIMARY KEY,
+  org_id         uuid        NOT NULL,
+  table_id       bigint      NOT NULL,
+  name           text        NOT NULL,
+  role           org_role,
+  user_id        uuid        REFERENCES users(id) ON DELETE CASCADE,
+  team_id        uuid        REFERENCES app.rows(id) ON DELETE CASCADE,
+  expression     text        NOT NULL,
+  expression_sql text        NOT NULL,
+  refs           text[]      NOT NULL DEFAULT '{}',
+  created_at     timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT row_policies_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE,
+  CONSTRAINT row_policies_principal_check CHECK (num_nonnulls(role, user_id, team_id) = 1),
+  CONSTRAINT row_policies_role_check CHECK (role IS NULL OR role IN ('Member', 'Viewer'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS row_policies_name_key ON app.row_policies (table_id, lower(name));
+
+ALTER TABLE app.row_policies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.row_policies FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.row_policies;
+CREATE POLICY org_isolation ON app.row_policies
+  USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org());
+
+DROP TRIGGER IF EXISTS trg_row_policies_org ON app.row_policies;
+CREATE TRIGGER trg_row_policies_org
+BEFORE INSERT OR UPDATE ON app.row_policies
+FOR EACH ROW EXECUTE FUNCTION app.check_team_org();
+
+-- Team row ids of the caller, as text to compare with uuid cells in "d".
+CREATE OR REPLACE FUNCTION app.current_user_teams()
+RETURNS text[] LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(array_agg(tm.team_id::text), '{}')
+  FROM app.team_members tm
+  WHERE tm.org_id = app.current_org()
+    AND tm.user_id = app.current_user_id()
+$$;
+
+-- The OR of the policies on a table that apply to the caller; NULL when the
+-- caller is not restricted. org_role sorts Owner first, so "role or lower"
+-- is >=.
+CREATE OR REPLACE FUNCTION app.row_policy_predicate(p_table_id bigint)
+RETURNS text LANGUAGE sql STABLE AS $$
+  SELECT string_agg('(' || p.expression_sql || ')', ' OR ' ORDER BY p.id)
+  FROM app.row_policies p
+  WHERE p.table_id = p_table_id
+    AND app.current_user_id() IS NOT NULL
+    AND COALESCE(app.current_org_role() > 'Admin', true)
+    AND (app.current_org_role() >= p.role
+         OR p.user_id = app.current_user_id()
+         OR p.team_id IN (SELECT tm.team_id FROM app.team_members tm
+                          WHERE tm.user_id = app.current_user_id()))
+$$;
+
+CREATE OR REPLACE FUNCTION app.rows_restricted(p_table_id bigint)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT app.row_policy_predicate(p_table_id) IS NOT NULL
+$$;
+
+-- Rows of a table the caller may see, optionally among p_row_ids. Only the
+-- cells the table's policies reference are read, from either engine.
+CREATE OR REPLACE FUNCTION app.visible_rows(p_table_id bigint, p_row_ids uuid[] DEFAULT NULL)
+RETURNS SETOF uuid
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  t     app.tables;
+  c     app.columns;
+  pred  text := app.row_policy_predicate(p_table_id);
+  src   text := 'app.rows r';
+  cells text[] := '{}';
+BEGIN
+  IF pred IS NULL THEN
+    RETURN QUERY
+      SELECT r.id FROM app.rows r
+      WHERE r.table_id = p_table_id
+        AND (p_row_ids IS NULL OR r.id = ANY(p_row_ids));
+    RETURN;
+  END IF;
+
+  SELECT * INTO t FROM app.tables WHERE id = p_table_id;
+  IF t.storage_mode = 'relational' THEN
+    src := format('app.rows r JOIN app_data.%I p ON p.id = r.id', t.physical_table);
+  END IF;
+  FOR c IN
+    SELECT col.*
+    FROM app.columns col
+    WHERE col.table_id = p_table_id
+      AND col.name IN (SELECT unnest(rp.refs) FROM app.row_policies rp WHERE rp.table_id = p_table_id)
+    ORDER BY col.id
+  LOOP
+    cells := cells || (quote_literal(c.name) || ', ' || CASE
+      WHEN t.storage_mode <> 'relational' THEN format('app.cell_value(r.id, %s)', c.id)
+      WHEN c.kind = 'value' THEN format('to_jsonb(p.%I)', 'c_' || c.id)
+      ELSE format('app.row_to_json(r.id) -> %L', c.name)
+    END);
+  END LOOP;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT r.id
+    FROM %1$s
+    CROSS JOIN LATERAL (SELECT jsonb_build_object(%2$s) AS d) x
+    WHERE r.table_id = $1
+      AND ($2 IS NULL OR r.id = ANY($2))
+      AND (%3$s)$q$,
+    src, array_to_string(cells, ', '), pred)
+  USING p_table_id, p_row_ids;
+END$$;
+
+CREATE OR REPLACE FUNCTION app.row_visible(p_row_id uuid)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT EXISTS (
+    SELECT 1
+    FROM app.rows r
+    CROSS JOIN LATERAL app.visible_rows(r.table_id, ARRAY[r.id]) v
+    WHERE r.id = p_row_id
+  )
+$$;
+
+-- Whether a column aggregates rows the caller may not all see: a rollup over
+-- a table restricted for the caller, or a computed column built on one.
+-- Computed SQL reads cells as (d->>'name'), which is what is looked for.
+CREATE OR REPLACE FUNCTION app.aggregate_restricted(p_column_id bigint)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT app.current_user_id() IS NOT NULL AND EXISTS (
+    SELECT 1
+    FROM app.columns c
+    JOIN app.columns ru ON ru.table_id = c.table_id AND ru.kind = 'rollup'
+    JOIN app.columns via ON via.id = ru.rollup_via_column_id
+    WHERE c.id = p_column_id
+      AND c.kind IN ('rollup', 'computed')
+      AND (ru.id = c.id
+           OR (c.kind = 'computed' AND position(format('(d->>%L)', ru.name) IN c.expression_sql) > 0))
+      AND app.rows_restricted(via.table_id)
+  )
+$$;
+
+-- mask_fields of 030, also dropping restricted aggregates.
+CREATE OR REPLACE FUNCTION app.mask_fields(p_table_id bigint, p_data jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  c record;
+BEGIN
+  IF p_data IS NULL OR app.current_user_id() IS NULL THEN
+    RETURN p_data;
+  END IF;
+  FOR c IN
+    SELECT col.name, col.masked
+    FROM app.columns col
+    WHERE col.table_id = p_table_id
+      AND col.read_role IS NOT NULL
+      AND NOT app.field_visible(col.read_role)
+  LOOP
+    IF c.masked AND jsonb_typeof(p_data -> c.name) <> 'null' THEN
+      p_data := jsonb_set(p_data, ARRAY[c.name], app.mask_value(p_data -> c.name));
+    ELSE
+      p_data := p_data - c.name;
+    END IF;
+  END LOOP;
+  FOR c IN
+    SELECT col.name
+    FROM app.columns col
+    WHERE col.table_id = p_table_id
+      AND col.kind IN ('rollup', 'computed')
+      AND app.aggregate_restricted(col.id)
+  LOOP
+    p_data := p_data - c.name;
+  END LOOP;
+  RETURN p_data;
+END$$;
+
+-- search_relational of 027, limited to the rows the caller may see.
+CREATE OR REPLACE FUNCTION app.search_relational(p_table_id bigint, p jsonb)
+RETURNS TABLE (row_id uuid, created_at timestamptz, data jsonb, total_count bigint)
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl        text;
+  page_num   int := GREATEST(0, COALESCE((p->>'pageNum')::int, 0));
+  page_size  int := GREATEST(1, LEAST(COALESCE((p->>'pageSize')::int, 10), 100));
+  sort_field text := NULLIF(lower(p->>'sortField'), '');
+  sort_desc  boolean := lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc';
+  f          jsonb;
+  col        app.columns;
+  cname      text;
+  pred       text;
+  preds      text[] := '{}';
+  sort_expr  text;
+  order_by   text := 'p.created_at DESC';
+  scope      text := 'TRUE';
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.tables t
+  WHERE t.id = p_table_id AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+  IF app.rows_restricted(p_table_id) THEN
+    scope := format('p.id IN (SELECT app.visible_rows(%s))', p_table_id);
+  END IF;
+
+  IF jsonb_typeof(p->'filterFields') = 'array' THEN
+    FOR f IN SELECT jsonb_array_elements(p->'filterFields') LOOP
+      col := NULL;
+      SELECT * INTO col FROM app.columns c
+      WHERE c.table_id = p_table_id AND lower(c.name) = lower(f->>'field');
+      cname := 'p.' || quote_ident('c_' || col.id);
+
+      IF col.id IS NULL THEN
+        pred := 'TRUE';
+      ELSIF col.kind IN ('computed', 'rollup') THEN
+        pred := format('app.match_computed(app.row_to_json(p.id) -> %L, %L::jsonb)', col.name, f);
+      ELSIF col.type = 'text' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'cn' THEN format('%s ILIKE %L', cname, '%' || (f->>'value') || '%')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'enum' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'bool' THEN
+        pred := format('%s = %L::boolean', cname, f->>'value');
+      ELSE
+        pred := 'TRUE';
+      END IF;
+      preds := preds || format('COALESCE(%s, FALSE)', pred);
+    END LOOP;
+  END IF;
+
+  IF sort_field IS NOT NULL THEN
+    col := NULL;
+    SELECT * INTO col FROM app.columns c WHERE c.table_id = p_table_id AND c.name = sort_field;
+    IF sort_field = 'id' THEN
+      sort_expr := 'p.id';
+    ELSIF sort_field = 'created_at' THEN
+      sort_expr := 'p.created_at';
+    ELSIF col.kind = 'value' THEN
+      sort_expr := 'p.' || quote_ident('c_' || col.id);
+    ELSIF col.id IS NOT NULL THEN
+      sort_expr := format('NULLIF(app.row_to_json(p.id) -> %L, ''null''::jsonb)', col.name);
+    END IF;
+    IF sort_expr IS NOT NULL THEN
+      order_by := format('%s %s NULLS LAST, p.created_at DESC',
+        sort_expr, CASE WHEN sort_desc THEN 'DESC' ELSE 'ASC' END);
+    END IF;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT s.id, s.created_at, app.row_to_json(s.id), s.total_count
+    FROM (
+      SELECT p.id, p.created_at, count(*) OVER () AS total_count
+      FROM app_data.%1$I p
+      WHERE (%2$s) AND %6$s
+      ORDER BY %3$s
+      LIMIT %4$s OFFSET %5$s
+    ) s$q$,
+    tbl,
+    CASE WHEN cardinality(preds) = 0 THEN 'TRUE' ELSE array_to_string(preds, ' OR ') END,
+    order_by, page_size, page_size * page_num, scope);
+END$$;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Revert webhooks.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.claim_webhook_deliveries(int, interval);
+DROP FUNCTION IF EXISTS app.emit_event(uuid, text, bigint, uuid, jsonb, jsonb);
+
+DROP TABLE IF EXISTS app.webhook_deliveries;
+DROP TABLE IF EXISTS app.webhooks;
+DROP TABLE IF EXISTS app.events;
+
+COMMIT;
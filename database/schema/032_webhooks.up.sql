@@ -0,0 +1,184 @@
+-- Webhooks for user-table row and schema events.
+--
+-- The API records every row and schema change in app.events in the same
+-- transaction as the change (app.emit_event). Emitting an event also queues
+-- one delivery per matching webhook in app.webhook_deliveries, which is the
+-- outbox: the dispatcher (internal/webhooks) claims due deliveries, POSTs
+-- them with an HMAC signature and records the outcome. Failed deliveries are
+-- retried with exponential backoff until they are marked dead, the
+-- dead-letter state; any delivery can be queued again by hand.
+--
+-- A webhook may name one table and carry a filter, a formula compiled by the
+-- API (internal/formula) to filter_sql over the row after the change ("d")
+-- and before it ("o"). Only the API writes filter_sql.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.events (
+  id         bigserial   PRIMARY KEY,
+  org_id     uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  type       text        NOT NULL,
+  table_id   bigint,
+  row_id     uuid,
+  actor_id   uuid,
+  payload    jsonb       NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS events_org_idx ON app.events (org_id, id);
+
+CREATE TABLE IF NOT EXISTS app.webhooks (
+  id                uuid        PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id            uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  name              text        NOT NULL,
+  url               text        NOT NULL,
+  secret            text        NOT NULL,
+  events            text[]      NOT NULL DEFAULT '{}',
+  table_id          bigint,
+  filter_expression text,
+  filter_sql        text,
+  filter_refs       text[]      NOT NULL DEFAULT '{}',
+  active            boolean     NOT NULL DEFAULT true,
+  created_at        timestamptz NOT NULL DEFAULT now(),
+  updated_at        timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT webhooks_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE,
+  CONSTRAINT webhooks_filter_check CHECK ((filter_expression IS NULL) = (filter_sql IS NULL)),
+  CONSTRAINT webhooks_filter_table_check CHECK (filter_sql IS NULL OR table_id IS NOT NULL),
+  CONSTRAINT webhooks_url_check CHECK (url ~* '^https?://')
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_org_idx ON app.webhooks (org_id);
+
+CREATE TABLE IF NOT EXISTS app.webhook_deliveries (
+  id              bigserial   PRIMARY KEY,
+  org_id          uuid        NOT NULL,
+  webhook_id      uuid        NOT NULL REFERENCES app.webhooks(id) ON DELETE CASCADE,
+  event_id        bigint      NOT NULL REFERENCES app.events(id) ON DELETE CASCADE,
+  status          text        NOT NULL DEFAULT 'pending',
+  attempts        int         NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  last_status     int,
+  last_error      text,
+  delivered_at    timestamptz,
+  created_at      timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+  ON app.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx
+  ON app.webhook_deliveries (webhook_id, id DESC);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['events','webhooks','webhook_deliveries'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- The dispatcher claims due deliveries of every org at once; only
+-- app.claim_webhook_deliveries turns this on, for its own statement.
+DROP POLICY IF EXISTS dispatcher ON app.webhook_deliveries;
+CREATE POLICY dispatcher ON app.webhook_deliveries
+  USING (current_setting('app.webhook_dispatch', true) = 'on');
+
+-- Records an event of the org and queues a delivery for every active
+-- webhook subscribed to it. Row events carry the row after the change (data)
+-- and before it (previous); deleted rows only have previous. Filters only
+-- apply to row events, and one that fails to evaluate does not match.
+CREATE OR REPLACE FUNCTION app.emit_event(
+  p_org_id   uuid,
+  p_type     text,
+  p_table_id bigint,
+  p_row_id   uuid,
+  p_data     jsonb,
+  p_previous jsonb
+)
+RETURNS bigint
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  ev_id   bigint := nextval(pg_get_serial_sequence('app.events', 'id'));
+  tbl     app.tables;
+  w       app.webhooks;
+  matched boolean;
+BEGIN
+  IF p_table_id IS NOT NULL THEN
+    SELECT * INTO tbl FROM app.tables t WHERE t.id = p_table_id AND t.org_id = p_org_id;
+  END IF;
+
+  INSERT INTO app.events (id, org_id, type, table_id, row_id, actor_id, payload)
+  VALUES (
+    ev_id, p_org_id, p_type, p_table_id, p_row_id, app.current_user_id(),
+    jsonb_strip_nulls(jsonb_build_object(
+      'id', ev_id::text,
+      'type', p_type,
+      'created_at', now(),
+      'actor_id', app.current_user_id(),
+      'table', CASE WHEN tbl.id IS NOT NULL THEN
+                 jsonb_build_object('id', tbl.id, 'name', tbl.name, 'slug', tbl.slug) END,
+      'row_id', p_row_id
+    )) || jsonb_build_object('data', p_data, 'previous', p_previous)
+  );
+
+  FOR w IN
+    SELECT * FROM app.webhooks wh
+    WHERE wh.org_id = p_org_id
+      AND wh.active
+      AND (cardinality(wh.events) = 0 OR p_type = ANY(wh.events))
+      AND (wh.table_id IS NULL OR wh.table_id = p_table_id)
+  LOOP
+    matched := true;
+    IF w.filter_sql IS NOT NULL AND p_row_id IS NOT NULL THEN
+      BEGIN
+        EXECUTE format('SELECT %s FROM (SELECT $1::jsonb AS d, $2::jsonb AS o) x', w.filter_sql)
+        INTO matched
+        USING COALESCE(p_data, p_previous), p_previous;
+      EXCEPTION WHEN OTHERS THEN
+        matched := false;
+      END;
+    END IF;
+    IF matched THEN
+      INSERT INTO app.webhook_deliveries (org_id, webhook_id, event_id)
+      VALUES (p_org_id, w.id, ev_id);
+    END IF;
+  END LOOP;
+
+  RETURN ev_id;
+END$$;
+
+-- Claims up to p_limit due deliveries of any org for one attempt: the
+-- attempt is counted and the delivery is hidden from other dispatchers for
+-- p_lease, after which it is due again unless its outcome was recorded.
+CREATE OR REPLACE FUNCTION app.claim_webhook_deliveries(p_limit int, p_lease interval)
+RETURNS TABLE (id bigint, org_id uuid)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  PERFORM set_config('app.webhook_dispatch', 'on', true);
+  RETURN QUERY
+    UPDATE app.webhook_deliveries d
+    SET attempts = d.attempts + 1,
+        next_attempt_at = now() + p_lease
+    WHERE d.id IN (
+      SELECT q.id
+      FROM app.webhook_deliveries q
+      WHERE q.status = 'pending'
+        AND q.next_attempt_at <= now()
+      ORDER BY q.next_attempt_at
+      LIMIT p_limit
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING d.id, d.org_id;
+  PERFORM set_config('app.webhook_dispatch', '', true);
+END$$;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Revert automations.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.claim_outbound_emails(int, interval);
+DROP FUNCTION IF EXISTS app.claim_automation_runs(int, interval);
+DROP FUNCTION IF EXISTS app.eval_automation_values(bigint, jsonb);
+DROP FUNCTION IF EXISTS app.match_automations(bigint);
+
+DROP TABLE IF EXISTS app.outbound_emails;
+DROP TABLE IF EXISTS app.automation_runs;
+DROP TABLE IF EXISTS app.automations;
+
+COMMIT;
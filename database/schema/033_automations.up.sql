@@ -0,0 +1,262 @@
+-- Automations: org-defined rules that react to row events of a table.
+--
+-- An automation has a trigger (a row was created, updated or deleted, or a
+-- field changed, optionally to a given value), an optional condition and a
+-- list of actions: set fields of the row, create a row in another table,
+-- queue a webhook delivery or send an email. Conditions and the expressions
+-- actions write are formulas the API compiles (internal/formula) over the
+-- row after the change ("d"), before it ("o") and the user who made it
+-- ("u"); only the API writes condition_sql and the compiled actions.
+--
+-- Matching happens in the transaction that emitted the event
+-- (app.match_automations). The API runs the actions of sync automations
+-- right there, so they commit or fail with the change; async ones are queued
+-- in app.automation_runs, which also logs every sync run, and picked up by
+-- the runner (internal/automations). Email actions only queue a message in
+-- app.outbound_emails, the mail outbox.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.automations (
+  id                   uuid        PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id               uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  table_id             bigint      NOT NULL,
+  name                 text        NOT NULL,
+  trigger              text        NOT NULL,
+  trigger_field        text,
+  trigger_to           text,
+  condition_expression text,
+  condition_sql        text,
+  actions              jsonb       NOT NULL DEFAULT '[]',
+  -- Columns the automation reads or writes, as "<table_id>.<column>"
+  refs                 text[]      NOT NULL DEFAULT '{}',
+  mode                 text        NOT NULL DEFAULT 'sync',
+  active               boolean     NOT NULL DEFAULT true,
+  created_at           timestamptz NOT NULL DEFAULT now(),
+  updated_at           timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT automations_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE,
+  CONSTRAINT automations_trigger_check CHECK (trigger IN ('created', 'updated', 'deleted', 'changed')),
+  CONSTRAINT automations_trigger_field_check CHECK ((trigger = 'changed') = (trigger_field IS NOT NULL)),
+  CONSTRAINT automations_trigger_to_check CHECK (trigger_to IS NULL OR trigger = 'changed'),
+  CONSTRAINT automations_condition_check CHECK ((condition_expression IS NULL) = (condition_sql IS NULL)),
+  CONSTRAINT automations_actions_check CHECK (jsonb_typeof(actions) = 'array'),
+  CONSTRAINT automations_mode_check CHECK (mode IN ('sync', 'async'))
+);
+
+CREATE INDEX IF NOT EXISTS automations_table_idx ON app.automations (table_id);
+CREATE UNIQUE INDEX IF NOT EXISTS automations_name_key ON app.automations (table_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS app.automation_runs (
+  id              bigserial   PRIMARY KEY,
+  org_id          uuid        NOT NULL,
+  automation_id   uuid        NOT NULL REFERENCES app.automations(id) ON DELETE CASCADE,
+  event_id        bigint      REFERENCES app.events(id) ON DELETE SET NULL,
+  row_id          uuid,
+  mode            text        NOT NULL,
+  status          text        NOT NULL DEFAULT 'pending',
+  -- How many automation-made changes led to the event; see MaxDepth
+  depth           int         NOT NULL DEFAULT 0,
+  attempts        int         NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  error           text,
+  result          jsonb,
+  created_at      timestamptz NOT NULL DEFAULT now(),
+  finished_at     timestamptz,
+  CONSTRAINT automation_runs_status_check CHECK (status IN ('pending', 'succeeded', 'failed', 'skipped'))
+);
+
+CREATE INDEX IF NOT EXISTS automation_runs_due_idx
+  ON app.automation_runs (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS automation_runs_automation_idx
+  ON app.automation_runs (automation_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS app.outbound_emails (
+  id              bigserial   PRIMARY KEY,
+  org_id          uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  run_id          bigint      REFERENCES app.automation_runs(id) ON DELETE SET NULL,
+  recipients      text[]      NOT NULL,
+  subject         text        NOT NULL,
+  body            text        NOT NULL,
+  status          text        NOT NULL DEFAULT 'pending',
+  attempts        int         NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  last_error      text,
+  sent_at         timestamptz,
+  created_at      timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT outbound_emails_recipients_check CHECK (cardinality(recipients) > 0),
+  CONSTRAINT outbound_emails_status_check CHECK (status IN ('pending', 'sent', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS outbound_emails_due_idx
+  ON app.outbound_emails (next_attempt_at) WHERE status = 'pending';
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['automations','automation_runs','outbound_emails'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- As for webhook deliveries, the runner and the mailer claim queued work of
+-- every org; only the claim functions below turn these on.
+DROP POLICY IF EXISTS dispatcher ON app.automation_runs;
+CREATE POLICY dispatcher ON app.automation_runs
+  USING (current_setting('app.automation_dispatch', true) = 'on');
+DROP POLICY IF EXISTS dispatcher ON app.outbound_emails;
+CREATE POLICY dispatcher ON app.outbound_emails
+  USING (current_setting('app.mail_dispatch', true) = 'on');
+
+-- Returns the active automations of the event's table whose trigger and
+-- condition match a row event, oldest first. A "changed" trigger matches
+-- creations and updates where the field's value differs from before (and
+-- equals trigger_to, compared as text, when set). A condition that fails to
+-- evaluate does not match.
+CREATE OR REPLACE FUNCTION app.match_automations(p_event_id bigint)
+RETURNS SETOF app.automations
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  ev      app.events;
+  d       jsonb;
+  o       jsonb;
+  a       app.automations;
+  matched boolean;
+BEGIN
+  SELECT * INTO ev FROM app.events e WHERE e.id = p_event_id;
+  IF ev.id IS NULL OR ev.row_id IS NULL THEN
+    RETURN;
+  END IF;
+  o := ev.payload -> 'previous';
+  IF jsonb_typeof(o) = 'null' THEN
+    o := NULL;
+  END IF;
+  d := COALESCE(NULLIF(ev.payload -> 'data', 'null'::jsonb), o);
+
+  FOR a IN
+    SELECT * FROM app.automations au
+    WHERE au.org_id = ev.org_id
+      AND au.table_id = ev.table_id
+      AND au.active
+      AND CASE au.trigger
+            WHEN 'created' THEN ev.type = 'row.created'
+            WHEN 'updated' THEN ev.type = 'row.updated'
+            WHEN 'deleted' THEN ev.type = 'row.deleted'
+            WHEN 'changed' THEN ev.type IN ('row.created', 'row.updated')
+              AND NULLIF(d -> au.trigger_field, 'null') IS DISTINCT FROM NULLIF(o -> au.trigger_field, 'null')
+              AND (au.trigger_to IS NULL OR d ->> au.trigger_field = au.trigger_to)
+          END
+    ORDER BY au.created_at, au.id
+  LOOP
+    matched := true;
+    IF a.condition_sql IS NOT NULL THEN
+      BEGIN
+        EXECUTE format('SELECT %s FROM (SELECT $1::jsonb AS d, $2::jsonb AS o, $3::uuid AS u) x', a.condition_sql)
+        INTO matched
+        USING d, o, ev.actor_id;
+      EXCEPTION WHEN OTHERS THEN
+        matched := false;
+      END;
+    END IF;
+    IF matched THEN
+      RETURN NEXT a;
+    END IF;
+  END LOOP;
+END$$;
+
+-- Evaluates compiled action expressions ({"name": "<sql>"}) against a row
+-- event as for conditions and returns {"name": value}.
+CREATE OR REPLACE FUNCTION app.eval_automation_values(p_event_id bigint, p_exprs jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  ev  app.events;
+  d   jsonb;
+  o   jsonb;
+  k   text;
+  s   text;
+  v   jsonb;
+  out jsonb := '{}';
+BEGIN
+  SELECT * INTO ev FROM app.events e WHERE e.id = p_event_id;
+  IF ev.id IS NULL THEN
+    RAISE EXCEPTION 'event % not found', p_event_id USING ERRCODE = 'no_data_found';
+  END IF;
+  o := ev.payload -> 'previous';
+  IF jsonb_typeof(o) = 'null' THEN
+    o := NULL;
+  END IF;
+  d := COALESCE(NULLIF(ev.payload -> 'data', 'null'::jsonb), o);
+
+  FOR k, s IN SELECT key, value FROM jsonb_each_text(COALESCE(p_exprs, '{}')) LOOP
+    EXECUTE format('SELECT to_jsonb(%s) FROM (SELECT $1::jsonb AS d, $2::jsonb AS o, $3::uuid AS u) x', s)
+    INTO v
+    USING d, o, ev.actor_id;
+    out := out || jsonb_build_object(k, v);
+  END LOOP;
+  RETURN out;
+END$$;
+
+-- Claims up to p_limit due async runs of any org, like
+-- app.claim_webhook_deliveries. Sync runs are only pending while their
+-- transaction executes them.
+CREATE OR REPLACE FUNCTION app.claim_automation_runs(p_limit int, p_lease interval)
+RETURNS TABLE (id bigint, org_id uuid)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  PERFORM set_config('app.automation_dispatch', 'on', true);
+  RETURN QUERY
+    UPDATE app.automation_runs r
+    SET attempts = r.attempts + 1,
+        next_attempt_at = now() + p_lease
+    WHERE r.id IN (
+      SELECT q.id
+      FROM app.automation_runs q
+      WHERE q.status = 'pending'
+        AND q.mode = 'async'
+        AND q.next_attempt_at <= now()
+      ORDER BY q.next_attempt_at
+      LIMIT p_limit
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING r.id, r.org_id;
+  PERFORM set_config('app.automation_dispatch', '', true);
+END$$;
+
+-- Claims up to p_limit due emails of any org, like
+-- app.claim_webhook_deliveries.
+CREATE OR REPLACE FUNCTION app.claim_outbound_emails(p_limit int, p_lease interval)
+RETURNS TABLE (id bigint, org_id uuid)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  PERFORM set_config('app.mail_dispatch', 'on', true);
+  RETURN QUERY
+    UPDATE app.outbound_emails m
+    SET attempts = m.attempts + 1,
+        next_attempt_at = now() + p_lease
+    WHERE m.id IN (
+      SELECT q.id
+      FROM app.outbound_emails q
+      WHERE q.status = 'pending'
+        AND q.next_attempt_at <= now()
+      ORDER BY q.next_attempt_at
+      LIMIT p_limit
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING m.id, m.org_id;
+  PERFORM set_config('app.mail_dispatch', '', true);
+END$$;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Revert live row event streams.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.stream_row_events(bigint, bigint, bigint, int);
+DROP FUNCTION IF EXISTS app.event_horizon();
+DROP TRIGGER IF EXISTS trg_events_notify ON app.events;
+DROP FUNCTION IF EXISTS app.notify_row_event();
+DROP INDEX IF EXISTS app.events_table_idx;
+ALTER TABLE app.events DROP COLUMN IF EXISTS txid;
+
+COMMIT;
@@ -0,0 +1,135 @@
+-- Live row event streams.
+--
+-- Every committed row event of app.events is announced on the
+-- app_row_events channel as {"id", "org_id", "table_id"}; NOTIFY is only
+-- delivered on commit, so rolled-back changes are never announced. Each API
+-- process LISTENs once (internal/stream) and wakes the streams of that
+-- table, which read the events through app.stream_row_events as their
+-- caller. Reconnecting clients replay what they missed from app.events.
+--
+-- Event ids are taken when the event is written, not when it commits, so a
+-- stream reading "after id N" would miss an event with a lower id that
+-- commits later. Events therefore record their transaction, and streams
+-- read them in (txid, id) order only below the xmin of the current
+-- snapshot: every transaction below it has ended, so no event can later
+-- appear before a position already read. Events of newer transactions are
+-- held back until the transactions before them end.
+
+BEGIN;
+
+ALTER TABLE app.events ADD COLUMN IF NOT EXISTS txid bigint NOT NULL DEFAULT pg_current_xact_id()::text::bigint;
+
+CREATE INDEX IF NOT EXISTS events_table_idx ON app.events (table_id, txid, id) WHERE table_id IS NOT NULL;
+
+-- The transaction below which every transaction has ended.
+CREATE OR REPLACE FUNCTION app.event_horizon()
+RETURNS bigint
+LANGUAGE sql
+VOLATILE
+AS $$
+  SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+$$;
+
+CREATE OR REPLACE FUNCTION app.notify_row_event()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  PERFORM pg_notify('app_row_events',
+    json_build_object('id', NEW.id, 'org_id', NEW.org_id, 'table_id', NEW.table_id)::text);
+  RETURN NULL;
+END$$;
+
+DROP TRIGGER IF EXISTS trg_events_notify ON app.events;
+CREATE TRIGGER trg_events_notify
+AFTER INSERT ON app.events
+FOR EACH ROW
+WHEN (NEW.type IN ('row.created', 'row.updated', 'row.deleted'))
+EXECUTE FUNCTION app.notify_row_event();
+
+-- Row events of a table as the caller may see them: the first p_limit
+-- visible ones after the position (p_after_txid, p_after_id), in (txid, id)
+-- order, of transactions below app.event_horizon(). Nothing is returned
+-- once the caller lost read access to the table. Row policies are evaluated
+-- on the row after the change and before it, and data and previous are only
+-- returned where the caller could see the row, masked like rows; deletions
+-- of rows the caller never saw still list the row id. created_by is read
+-- from the row while it exists, so after a deletion policies on it fail.
+CREATE OR REPLACE FUNCTION app.stream_row_events(
+  p_table_id   bigint,
+  p_after_txid bigint,
+  p_after_id   bigint,
+  p_limit      int
+)
+RETURNS TABLE (
+  id         bigint,
+  txid       bigint,
+  type       text,
+  row_id     uuid,
+  data       jsonb,
+  previous   jsonb,
+  created_at timestamptz
+)
+LANGUAGE plpgsql
+VOLATILE
+AS $$
+DECLARE
+  horizon bigint := app.event_horizon();
+  pred    text := app.row_policy_predicate(p_table_id);
+  ev      app.events;
+  d       jsonb;
+  o       jsonb;
+  creator uuid;
+  see_d   boolean;
+  see_o   boolean;
+  n       int := 0;
+BEGIN
+  IF app.current_user_id() IS NOT NULL AND NOT COALESCE(
+       (SELECT tr.can_read FROM app.table_rights(p_table_id, app.current_user_id()) tr), false) THEN
+    RETURN;
+  END IF;
+
+  FOR ev IN
+    SELECT * FROM app.events e
+    WHERE e.table_id = p_table_id
+      AND e.type IN ('row.created', 'row.updated', 'row.deleted')
+      AND (e.txid, e.id) > (p_after_txid, p_after_id)
+      AND e.txid < horizon
+    ORDER BY e.txid, e.id
+  LOOP
+    d := NULLIF(ev.payload -> 'data', 'null'::jsonb);
+    o := NULLIF(ev.payload -> 'previous', 'null'::jsonb);
+    see_d := d IS NOT NULL;
+    see_o := o IS NOT NULL;
+    IF pred IS NOT NULL THEN
+      SELECT r.created_by INTO creator FROM app.rows r WHERE r.id = ev.row_id;
+      BEGIN
+        IF see_d THEN
+          EXECUTE format('SELECT COALESCE(%s, false) FROM (SELECT $1::jsonb AS d) x, (SELECT $2::uuid AS created_by) r', pred)
+          INTO see_d USING d, creator;
+        END IF;
+        IF see_o THEN
+          EXECUTE format('SELECT COALESCE(%s, false) FROM (SELECT $1::jsonb AS d) x, (SELECT $2::uuid AS created_by) r', pred)
+          INTO see_o USING o, creator;
+        END IF;
+      EXCEPTION WHEN OTHERS THEN
+        see_d := false;
+        see_o := false;
+      END;
+    END IF;
+    IF see_d OR see_o OR ev.type = 'row.deleted' THEN
+      id := ev.id;
+      txid := ev.txid;
+      type := ev.type;
+      row_id := ev.row_id;
+      data := CASE WHEN see_d THEN app.mask_fields(p_table_id, d) END;
+      previous := CASE WHEN see_o THEN app.mask_fields(p_table_id, o) END;
+      created_at := ev.created_at;
+      RETURN NEXT;
+      n := n + 1;
+      EXIT WHEN n >= p_limit;
+    END IF;
+  END LOOP;
+END$$;
+
+COMMIT;
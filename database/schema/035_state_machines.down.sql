@@ -0,0 +1,8 @@
+-- Revert state machines.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.eval_row_exprs(jsonb, jsonb, jsonb);
+DROP TABLE IF EXISTS app.state_machines;
+
+COMMIT;
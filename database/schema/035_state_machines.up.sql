@@ -0,0 +1,69 @@
+-- State machines: the lifecycle of an enum column of a user table, e.g. the
+-- status of work orders.
+--
+-- A machine lists the states rows may be created in, the allowed
+-- transitions (from which states to which, and the lowest org role that may
+-- make each) and per state what entering it requires: fields that must have
+-- a value, optionally only when a condition holds, and fields stamped with a
+-- value such as today() or current_user. Conditions and stamps are formulas
+-- the API compiles (internal/formula) over the row after the change ("d"),
+-- before it ("o") and the user making it ("u"), as for automations; the
+-- compiled SQL is kept next to each in "states" and only the API writes it.
+--
+-- The API enforces machines on the row writes of its callers
+-- (internal/workflow); automations, imports and templates are not bound by
+-- them.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.state_machines (
+  id          uuid        PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id      uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  table_id    bigint      NOT NULL,
+  column_name text        NOT NULL,
+  initial     text[]      NOT NULL DEFAULT '{}',
+  transitions jsonb       NOT NULL DEFAULT '[]',
+  states      jsonb       NOT NULL DEFAULT '{}',
+  -- Columns the machine reads or writes, lower-cased, its own included
+  refs        text[]      NOT NULL DEFAULT '{}',
+  created_at  timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT state_machines_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE,
+  CONSTRAINT state_machines_transitions_check CHECK (jsonb_typeof(transitions) = 'array'),
+  CONSTRAINT state_machines_states_check CHECK (jsonb_typeof(states) = 'object')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS state_machines_column_key
+  ON app.state_machines (table_id, lower(column_name));
+
+ALTER TABLE app.state_machines ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.state_machines FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.state_machines;
+CREATE POLICY org_isolation ON app.state_machines
+  USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org());
+
+-- Evaluates compiled expressions ({"name": "<sql>"}) over a row as it would
+-- be after a change (p_data) and before it (p_previous, NULL for new rows)
+-- for the current user, and returns {"name": value}.
+CREATE OR REPLACE FUNCTION app.eval_row_exprs(p_data jsonb, p_previous jsonb, p_exprs jsonb)
+RETURNS jsonb
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+  k   text;
+  s   text;
+  v   jsonb;
+  out jsonb := '{}';
+BEGIN
+  FOR k, s IN SELECT key, value FROM jsonb_each_text(COALESCE(p_exprs, '{}')) LOOP
+    EXECUTE format('SELECT to_jsonb(%s) FROM (SELECT $1::jsonb AS d, $2::jsonb AS o, $3::uuid AS u) x', s)
+    INTO v
+    USING p_data, p_previous, app.current_user_id();
+    out := out || jsonb_build_object(k, v);
+  END LOOP;
+  RETURN out;
+END$$;
+
+COMMIT;
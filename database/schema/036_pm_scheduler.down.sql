@@ -0,0 +1,9 @@
+-- Revert PM scheduling.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.claim_pm_scans(int, interval);
+DROP TABLE IF EXISTS app.pm_scans;
+DROP TABLE IF EXISTS app.pm_occurrences;
+
+COMMIT;
@@ -0,0 +1,99 @@
+-- Preventive maintenance scheduling: turning the PM schedules of an org (rows
+-- of the table provisioned from the pm_schedules template) into work orders.
+--
+-- The scheduler (internal/pm) scans each org in turn. app.pm_scans paces the
+-- scans: one row per org, claimed by a scheduler when next_scan_at is due,
+-- like queued webhook deliveries. app.pm_occurrences records every
+-- occurrence of a schedule the scheduler handled, by the date it falls on or
+-- the meter reading it falls due at, with the work order generated for it or
+-- why it was skipped. Its unique keys make generation idempotent: whichever
+-- scheduler records an occurrence first creates its work order, and the
+-- others roll back theirs.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.pm_occurrences (
+  id            bigserial   PRIMARY KEY,
+  org_id        uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  pm_id         uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  trigger       text        NOT NULL,
+  -- Calendar occurrences: the date the occurrence falls on
+  due_on        date,
+  -- Meter occurrences: the reading the occurrence falls due at
+  due_reading   float8,
+  work_order_id uuid        REFERENCES app.rows(id) ON DELETE SET NULL,
+  status        text        NOT NULL,
+  note          text,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT pm_occurrences_trigger_check CHECK (trigger IN ('calendar', 'meter')),
+  CONSTRAINT pm_occurrences_due_check CHECK (
+    (trigger = 'calendar' AND due_on IS NOT NULL AND due_reading IS NULL) OR
+    (trigger = 'meter' AND due_reading IS NOT NULL AND due_on IS NULL)),
+  CONSTRAINT pm_occurrences_status_check CHECK (status IN ('created', 'skipped'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS pm_occurrences_calendar_key
+  ON app.pm_occurrences (pm_id, due_on) WHERE trigger = 'calendar';
+CREATE UNIQUE INDEX IF NOT EXISTS pm_occurrences_meter_key
+  ON app.pm_occurrences (pm_id, due_reading) WHERE trigger = 'meter';
+CREATE INDEX IF NOT EXISTS pm_occurrences_pm_idx
+  ON app.pm_occurrences (pm_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS app.pm_scans (
+  org_id       uuid        PRIMARY KEY REFERENCES organisations(id) ON DELETE CASCADE,
+  next_scan_at timestamptz NOT NULL DEFAULT now(),
+  last_scan_at timestamptz,
+  last_error   text
+);
+
+CREATE INDEX IF NOT EXISTS pm_scans_due_idx ON app.pm_scans (next_scan_at);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['pm_occurrences','pm_scans'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- Schedulers claim the scans of every org; only app.claim_pm_scans turns
+-- this on.
+DROP POLICY IF EXISTS dispatcher ON app.pm_scans;
+CREATE POLICY dispatcher ON app.pm_scans
+  USING (current_setting('app.pm_dispatch', true) = 'on');
+
+-- Claims up to p_limit orgs whose scan is due, hiding them from other
+-- schedulers for p_lease; the scheduler sets the next scan when done. Orgs
+-- without a scan row yet get one, due right away.
+CREATE OR REPLACE FUNCTION app.claim_pm_scans(p_limit int, p_lease interval)
+RETURNS TABLE (org_id uuid)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  PERFORM set_config('app.pm_dispatch', 'on', true);
+  INSERT INTO app.pm_scans (org_id)
+  SELECT o.id FROM organisations o
+  ON CONFLICT DO NOTHING;
+  RETURN QUERY
+    UPDATE app.pm_scans s
+    SET next_scan_at = now() + p_lease
+    WHERE s.org_id IN (
+      SELECT q.org_id
+      FROM app.pm_scans q
+      WHERE q.next_scan_at <= now()
+      ORDER BY q.next_scan_at
+      LIMIT p_limit
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING s.org_id;
+  PERFORM set_config('app.pm_dispatch', '', true);
+END$$;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Revert meter readings and rules.
+
+BEGIN;
+
+DROP TABLE IF EXISTS app.meter_alerts;
+DROP TABLE IF EXISTS app.meter_rules;
+DROP TABLE IF EXISTS app.meter_readings;
+
+COMMIT;
@@ -0,0 +1,83 @@
+-- Meter readings and condition-based maintenance: the readings of meters
+-- (rows of the table provisioned from the meters template) and the rules
+-- that act on them.
+--
+-- app.meter_readings keeps every reading of a meter, one per instant, so a
+-- reading sent twice is stored once. The meter row itself only holds the
+-- latest one (its reading and read_on columns), which meter-based PM
+-- schedules follow. app.meter_rules are thresholds and deltas checked on
+-- each new latest reading; app.meter_alerts records every time one fired,
+-- with the work orders it created or flagged.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.meter_readings (
+  id         bigserial   PRIMARY KEY,
+  org_id     uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  meter_id   uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  value      float8      NOT NULL,
+  read_at    timestamptz NOT NULL,
+  created_by uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT meter_readings_value_check CHECK (value NOT IN ('NaN', 'Infinity', '-Infinity')),
+  CONSTRAINT meter_readings_meter_read_at_key UNIQUE (meter_id, read_at)
+);
+
+CREATE TABLE IF NOT EXISTS app.meter_rules (
+  id                uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id            uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  meter_id          uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  name              text        NOT NULL,
+  -- above/below: the reading crosses value; delta: it moves by value or more
+  -- from the previous reading
+  kind              text        NOT NULL,
+  value             float8      NOT NULL,
+  action            text        NOT NULL,
+  -- create_work_order: what the work order gets; the title may use {meter},
+  -- {rule}, {value} and {unit}
+  wo_title          text,
+  wo_description    text,
+  wo_priority       text,
+  active            boolean     NOT NULL DEFAULT TRUE,
+  last_triggered_at timestamptz,
+  created_at        timestamptz NOT NULL DEFAULT now(),
+  updated_at        timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT meter_rules_kind_check CHECK (kind IN ('above', 'below', 'delta')),
+  CONSTRAINT meter_rules_action_check CHECK (action IN ('create_work_order', 'flag_work_orders')),
+  CONSTRAINT meter_rules_value_check CHECK (value NOT IN ('NaN', 'Infinity', '-Infinity')),
+  CONSTRAINT meter_rules_delta_check CHECK (kind <> 'delta' OR value > 0),
+  CONSTRAINT meter_rules_meter_name_key UNIQUE (meter_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS app.meter_alerts (
+  id             bigserial   PRIMARY KEY,
+  org_id         uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  rule_id        uuid        NOT NULL REFERENCES app.meter_rules(id) ON DELETE CASCADE,
+  meter_id       uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  reading_id     bigint      NOT NULL REFERENCES app.meter_readings(id) ON DELETE CASCADE,
+  value          float8      NOT NULL,
+  previous       float8,
+  action         text        NOT NULL,
+  -- Created or flagged; kept when the work orders are deleted
+  work_order_ids uuid[]      NOT NULL DEFAULT '{}',
+  created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS meter_alerts_meter_idx ON app.meter_alerts (meter_id, id DESC);
+CREATE INDEX IF NOT EXISTS meter_alerts_rule_idx ON app.meter_alerts (rule_id, id DESC);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['meter_readings','meter_rules','meter_alerts'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+COMMIT;
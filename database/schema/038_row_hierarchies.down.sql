@@ -0,0 +1,149 @@
+-- Revert row hierarchies.
+
+BEGIN;
+
+-- Restore the search_relational of 031
+CREATE OR REPLACE FUNCTION app.search_relational(p_table_id bigint, p jsonb)
+RETURNS TABLE (row_id uuid, created_at timestamptz, data jsonb, total_count bigint)
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl        text;
+  page_num   int := GREATEST(0, COALESCE((p->>'pageNum')::int, 0));
+  page_size  int := GREATEST(1, LEAST(COALESCE((p->>'pageSize')::int, 10), 100));
+  sort_field text := NULLIF(lower(p->>'sortField'), '');
+  sort_desc  boolean := lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc';
+  f          jsonb;
+  col        app.columns;
+  cname      text;
+  pred       text;
+  preds      text[] := '{}';
+  sort_expr  text;
+  order_by   text := 'p.created_at DESC';
+  scope      text := 'TRUE';
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.tables t
+  WHERE t.id = p_table_id AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+  IF app.rows_restricted(p_table_id) THEN
+    scope := format('p.id IN (SELECT app.visible_rows(%s))', p_table_id);
+  END IF;
+
+  IF jsonb_typeof(p->'filterFields') = 'array' THEN
+    FOR f IN SELECT jsonb_array_elements(p->'filterFields') LOOP
+      col := NULL;
+      SELECT * INTO col FROM app.columns c
+      WHERE c.table_id = p_table_id AND lower(c.name) = lower(f->>'field');
+      cname := 'p.' || quote_ident('c_' || col.id);
+
+      IF col.id IS NULL THEN
+        pred := 'TRUE';
+      ELSIF col.kind IN ('computed', 'rollup') THEN
+        pred := format('app.match_computed(app.row_to_json(p.id) -> %L, %L::jsonb)', col.name, f);
+      ELSIF col.type = 'text' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'cn' THEN format('%s ILIKE %L', cname, '%' || (f->>'value') || '%')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'enum' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'bool' THEN
+        pred := format('%s = %L::boolean', cname, f->>'value');
+      ELSE
+        pred := 'TRUE';
+      END IF;
+      preds := preds || format('COALESCE(%s, FALSE)', pred);
+    END LOOP;
+  END IF;
+
+  IF sort_field IS NOT NULL THEN
+    col := NULL;
+    SELECT * INTO col FROM app.columns c WHERE c.table_id = p_table_id AND c.name = sort_field;
+    IF sort_field = 'id' THEN
+      sort_expr := 'p.id';
+    ELSIF sort_field = 'created_at' THEN
+      sort_expr := 'p.created_at';
+    ELSIF col.kind = 'value' THEN
+      sort_expr := 'p.' || quote_ident('c_' || col.id);
+    ELSIF col.id IS NOT NULL THEN
+      sort_expr := format('NULLIF(app.row_to_json(p.id) -> %L, ''null''::jsonb)', col.name);
+    END IF;
+    IF sort_expr IS NOT NULL THEN
+      order_by := format('%s %s NULLS LAST, p.created_at DESC',
+        sort_expr, CASE WHEN sort_desc THEN 'DESC' ELSE 'ASC' END);
+    END IF;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT s.id, s.created_at, app.row_to_json(s.id), s.total_count
+    FROM (
+      SELECT p.id, p.created_at, count(*) OVER () AS total_count
+      FROM app_data.%1$I p
+      WHERE (%2$s) AND %6$s
+      ORDER BY %3$s
+      LIMIT %4$s OFFSET %5$s
+    ) s$q$,
+    tbl,
+    CASE WHEN cardinality(preds) = 0 THEN 'TRUE' ELSE array_to_string(preds, ' OR ') END,
+    order_by, page_size, page_size * page_num, scope);
+END$$;
+
+-- Restore the check_uuid_value of 027
+CREATE OR REPLACE FUNCTION app.check_uuid_value(p_col app.columns, p_row_id uuid, p_value uuid)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  src app.rows;
+  tgt app.rows;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF p_value IS NULL THEN
+    RETURN;
+  END IF;
+
+  SELECT * INTO src FROM app.rows WHERE id = p_row_id;
+  SELECT * INTO tgt FROM app.rows WHERE id = p_value;
+
+  IF tgt.id IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF tgt.org_id IS DISTINCT FROM src.org_id THEN
+    RAISE EXCEPTION 'Referenced row % belongs to another org', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF p_col.type <> 'uuid' OR NOT p_col.is_reference THEN
+    RETURN;
+  END IF;
+
+  IF p_col.reference_table_id IS NOT NULL AND tgt.table_id <> p_col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      p_col.reference_table_id, p_value, tgt.table_id;
+  END IF;
+
+  IF p_col.require_different_table AND src.table_id = tgt.table_id THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src.table_id, tgt.table_id;
+  END IF;
+END$$;
+
+DROP FUNCTION IF EXISTS app.hierarchy_cycle(bigint);
+DROP FUNCTION IF EXISTS app.row_and_descendants(bigint, uuid);
+DROP FUNCTION IF EXISTS app.row_subtree(bigint, uuid, int);
+DROP FUNCTION IF EXISTS app.row_ancestors(bigint, uuid);
+DROP FUNCTION IF EXISTS app.column_uuids(bigint);
+DROP FUNCTION IF EXISTS app.cell_uuid(uuid, bigint);
+
+DROP TABLE IF EXISTS app.hierarchies;
+
+COMMIT;
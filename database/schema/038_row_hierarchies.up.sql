@@ -0,0 +1,294 @@
+-- Row hierarchies: a uuid column of a table that references the table
+-- itself, such as the parent_asset of assets, declared as the parent of each
+-- row. The rows then form a forest: a write that would make a row its own
+-- ancestor is refused whichever engine stores the table, and the subtree and
+-- ancestors of a row are read with recursive queries over the column.
+--
+-- Search filters on uuid columns gain an "under" operation matching a row
+-- and, when its table has a hierarchy, every row below it, e.g. the work
+-- orders of an asset or any of its parts.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.hierarchies (
+  table_id   bigint      PRIMARY KEY,
+  org_id     uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  column_id  bigint      NOT NULL UNIQUE REFERENCES app.columns(id) ON DELETE CASCADE,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT hierarchies_table_fkey FOREIGN KEY (org_id, table_id)
+    REFERENCES app.tables (org_id, id) ON DELETE CASCADE
+);
+
+ALTER TABLE app.hierarchies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.hierarchies FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS org_isolation ON app.hierarchies;
+CREATE POLICY org_isolation ON app.hierarchies
+  USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org());
+
+-- The value of one uuid cell, from either engine.
+CREATE OR REPLACE FUNCTION app.cell_uuid(p_row_id uuid, p_column_id bigint)
+RETURNS uuid LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+  v uuid;
+BEGIN
+  IF p_row_id IS NULL OR p_column_id IS NULL THEN
+    RETURN NULL;
+  END IF;
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    EXECUTE format('SELECT p.%I FROM app_data.%I p WHERE p.id = $1',
+      'c_' || p_column_id, t.physical_table)
+    INTO v
+    USING p_row_id;
+    RETURN v;
+  END IF;
+
+  RETURN (SELECT vu.value FROM app.values_uuid vu WHERE vu.row_id = p_row_id AND vu.column_id = p_column_id);
+END$$;
+
+-- Every non-NULL value of a uuid column, from either engine.
+CREATE OR REPLACE FUNCTION app.column_uuids(p_column_id bigint)
+RETURNS TABLE (row_id uuid, value uuid) LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+BEGIN
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    RETURN QUERY EXECUTE format('SELECT p.id, p.%I FROM app_data.%I p WHERE p.%1$I IS NOT NULL',
+      'c_' || p_column_id, t.physical_table);
+  ELSE
+    RETURN QUERY
+      SELECT vu.row_id, vu.value FROM app.values_uuid vu
+      WHERE vu.column_id = p_column_id AND vu.value IS NOT NULL;
+  END IF;
+END$$;
+
+-- The ancestors of a row along parent column p_column_id, its parent first
+-- at depth 1. The walk ends early on a cycle, which only data written before
+-- the hierarchy was declared can hold.
+CREATE OR REPLACE FUNCTION app.row_ancestors(p_column_id bigint, p_row_id uuid)
+RETURNS TABLE (id uuid, depth int) LANGUAGE sql STABLE AS $$
+  WITH RECURSIVE up AS (
+    SELECT app.cell_uuid(p_row_id, p_column_id) AS id, 1 AS depth, ARRAY[p_row_id] AS path
+    UNION ALL
+    SELECT app.cell_uuid(up.id, p_column_id), up.depth + 1, up.path || up.id
+    FROM up
+    WHERE up.id IS NOT NULL AND NOT up.id = ANY(up.path)
+  )
+  SELECT up.id, up.depth
+  FROM up
+  WHERE up.id IS NOT NULL AND NOT up.id = ANY(up.path)
+$$;
+
+-- A row and the rows below it along parent column p_column_id, down to
+-- p_max_depth levels (all when NULL). The row itself has depth 0 and no
+-- parent_id.
+CREATE OR REPLACE FUNCTION app.row_subtree(p_column_id bigint, p_root uuid, p_max_depth int DEFAULT NULL)
+RETURNS TABLE (id uuid, parent_id uuid, depth int) LANGUAGE sql STABLE AS $$
+  WITH RECURSIVE down AS (
+    SELECT p_root AS id, NULL::uuid AS parent_id, 0 AS depth, ARRAY[p_root] AS path
+    UNION ALL
+    SELECT c.id, down.id, down.depth + 1, down.path || c.id
+    FROM down
+    CROSS JOIN LATERAL app.referencing_rows(p_column_id, down.id) AS c(id)
+    WHERE NOT c.id = ANY(down.path)
+      AND (p_max_depth IS NULL OR down.depth < p_max_depth)
+  )
+  SELECT down.id, down.parent_id, down.depth FROM down
+$$;
+
+-- What an "under" search filter matches: p_root and, when table p_table_id
+-- has a hierarchy, every row below it.
+CREATE OR REPLACE FUNCTION app.row_and_descendants(p_table_id bigint, p_root uuid)
+RETURNS SETOF uuid LANGUAGE sql STABLE AS $$
+  SELECT p_root
+  WHERE NOT EXISTS (SELECT 1 FROM app.hierarchies h WHERE h.table_id = p_table_id)
+  UNION ALL
+  SELECT s.id
+  FROM app.hierarchies h
+  CROSS JOIN LATERAL app.row_subtree(h.column_id, p_root) s
+  WHERE h.table_id = p_table_id
+$$;
+
+-- A row of a parent column's table that is its own ancestor, or NULL when
+-- the column's values form a forest. Checked before declaring a hierarchy.
+CREATE OR REPLACE FUNCTION app.hierarchy_cycle(p_column_id bigint)
+RETURNS uuid LANGUAGE sql STABLE AS $$
+  WITH RECURSIVE edges AS (
+    SELECT * FROM app.column_uuids(p_column_id)
+  ),
+  walk AS (
+    SELECT e.row_id AS start, e.value AS id, ARRAY[e.row_id] AS path
+    FROM edges e
+    UNION ALL
+    SELECT w.start, e.value, w.path || w.id
+    FROM walk w
+    JOIN edges e ON e.row_id = w.id
+    WHERE NOT w.id = ANY(w.path)
+  )
+  SELECT w.start FROM walk w WHERE w.id = w.start LIMIT 1
+$$;
+
+-- check_uuid_value of 027, refusing values that would make a row of a
+-- hierarchy its own ancestor. Writes to one hierarchy are serialised on its
+-- app.hierarchies row so that two concurrent moves cannot close a cycle.
+CREATE OR REPLACE FUNCTION app.check_uuid_value(p_col app.columns, p_row_id uuid, p_value uuid)
+RETURNS void LANGUAGE plpgsql AS $$
+DECLARE
+  src app.rows;
+  tgt app.rows;
+BEGIN
+  -- Allow NULLs; required-ness is handled elsewhere
+  IF p_value IS NULL THEN
+    RETURN;
+  END IF;
+
+  SELECT * INTO src FROM app.rows WHERE id = p_row_id;
+  SELECT * INTO tgt FROM app.rows WHERE id = p_value;
+
+  IF tgt.id IS NULL THEN
+    RAISE EXCEPTION 'Referenced row % not found', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF tgt.org_id IS DISTINCT FROM src.org_id THEN
+    RAISE EXCEPTION 'Referenced row % belongs to another org', p_value
+      USING ERRCODE = 'foreign_key_violation', CONSTRAINT = 'values_uuid_value_fkey';
+  END IF;
+
+  IF p_col.type <> 'uuid' OR NOT p_col.is_reference THEN
+    RETURN;
+  END IF;
+
+  IF p_col.reference_table_id IS NOT NULL AND tgt.table_id <> p_col.reference_table_id THEN
+    RAISE EXCEPTION
+      'UUID reference must target table_id=%, but row % is in table_id=%',
+      p_col.reference_table_id, p_value, tgt.table_id;
+  END IF;
+
+  IF p_col.require_different_table AND src.table_id = tgt.table_id THEN
+    RAISE EXCEPTION 'UUID reference must target a different table (src=% = tgt=%)',
+      src.table_id, tgt.table_id;
+  END IF;
+
+  PERFORM 1 FROM app.hierarchies h WHERE h.column_id = p_col.id FOR UPDATE;
+  IF FOUND AND (p_value = p_row_id OR EXISTS (
+      SELECT 1 FROM app.row_ancestors(p_col.id, p_value) a WHERE a.id = p_row_id)) THEN
+    RAISE EXCEPTION 'Row % cannot be placed under % in %', p_row_id, p_value, p_col.name
+      USING ERRCODE = 'check_violation',
+            DETAIL = format('%s: a row cannot be placed under itself or one of its descendants', p_col.name);
+  END IF;
+END$$;
+
+-- search_relational of 031, with eq, in and under filters on uuid columns.
+CREATE OR REPLACE FUNCTION app.search_relational(p_table_id bigint, p jsonb)
+RETURNS TABLE (row_id uuid, created_at timestamptz, data jsonb, total_count bigint)
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  tbl        text;
+  page_num   int := GREATEST(0, COALESCE((p->>'pageNum')::int, 0));
+  page_size  int := GREATEST(1, LEAST(COALESCE((p->>'pageSize')::int, 10), 100));
+  sort_field text := NULLIF(lower(p->>'sortField'), '');
+  sort_desc  boolean := lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc';
+  f          jsonb;
+  col        app.columns;
+  cname      text;
+  pred       text;
+  preds      text[] := '{}';
+  sort_expr  text;
+  order_by   text := 'p.created_at DESC';
+  scope      text := 'TRUE';
+BEGIN
+  SELECT t.physical_table INTO tbl
+  FROM app.tables t
+  WHERE t.id = p_table_id AND t.storage_mode = 'relational';
+  IF tbl IS NULL THEN
+    RETURN;
+  END IF;
+  IF app.rows_restricted(p_table_id) THEN
+    scope := format('p.id IN (SELECT app.visible_rows(%s))', p_table_id);
+  END IF;
+
+  IF jsonb_typeof(p->'filterFields') = 'array' THEN
+    FOR f IN SELECT jsonb_array_elements(p->'filterFields') LOOP
+      col := NULL;
+      SELECT * INTO col FROM app.columns c
+      WHERE c.table_id = p_table_id AND lower(c.name) = lower(f->>'field');
+      cname := 'p.' || quote_ident('c_' || col.id);
+
+      IF col.id IS NULL THEN
+        pred := 'TRUE';
+      ELSIF col.kind IN ('computed', 'rollup') THEN
+        pred := format('app.match_computed(app.row_to_json(p.id) -> %L, %L::jsonb)', col.name, f);
+      ELSIF col.type = 'text' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'cn' THEN format('%s ILIKE %L', cname, '%' || (f->>'value') || '%')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'enum' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::text[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSIF col.type = 'bool' THEN
+        pred := format('%s = %L::boolean', cname, f->>'value');
+      ELSIF col.type = 'uuid' THEN
+        pred := CASE COALESCE(f->>'operation', 'eq')
+          WHEN 'eq' THEN format('%s = %L::uuid', cname, f->>'value')
+          WHEN 'in' THEN format('%s = ANY(%L::uuid[])', cname, ARRAY(SELECT jsonb_array_elements_text(f->'values')))
+          WHEN 'under' THEN format('%s IN (SELECT app.row_and_descendants(%L::bigint, %L::uuid))',
+            cname, col.reference_table_id, f->>'value')
+          ELSE format('%s IS NOT NULL', cname)
+        END;
+      ELSE
+        pred := 'TRUE';
+      END IF;
+      preds := preds || format('COALESCE(%s, FALSE)', pred);
+    END LOOP;
+  END IF;
+
+  IF sort_field IS NOT NULL THEN
+    col := NULL;
+    SELECT * INTO col FROM app.columns c WHERE c.table_id = p_table_id AND c.name = sort_field;
+    IF sort_field = 'id' THEN
+      sort_expr := 'p.id';
+    ELSIF sort_field = 'created_at' THEN
+      sort_expr := 'p.created_at';
+    ELSIF col.kind = 'value' THEN
+      sort_expr := 'p.' || quote_ident('c_' || col.id);
+    ELSIF col.id IS NOT NULL THEN
+      sort_expr := format('NULLIF(app.row_to_json(p.id) -> %L, ''null''::jsonb)', col.name);
+    END IF;
+    IF sort_expr IS NOT NULL THEN
+      order_by := format('%s %s NULLS LAST, p.created_at DESC',
+        sort_expr, CASE WHEN sort_desc THEN 'DESC' ELSE 'ASC' END);
+    END IF;
+  END IF;
+
+  RETURN QUERY EXECUTE format(
+    $q$SELECT s.id, s.created_at, app.row_to_json(s.id), s.total_count
+    FROM (
+      SELECT p.id, p.created_at, count(*) OVER () AS total_count
+      FROM app_data.%1$I p
+      WHERE (%2$s) AND %6$s
+      ORDER BY %3$s
+      LIMIT %4$s OFFSET %5$s
+    ) s$q$,
+    tbl,
+    CASE WHEN cardinality(preds) = 0 THEN 'TRUE' ELSE array_to_string(preds, ' OR ') END,
+    order_by, page_size, page_size * page_num, scope);
+END$$;
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- Revert spare parts inventory.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.part_stock(uuid[]);
+DROP FUNCTION IF EXISTS app.work_order_open(uuid);
+DROP FUNCTION IF EXISTS app.cell_bool(uuid, bigint);
+DROP FUNCTION IF EXISTS app.cell_float(uuid, bigint);
+
+DROP TABLE IF EXISTS app.stock_reservations;
+DROP TABLE IF EXISTS app.stock_levels;
+DROP TABLE IF EXISTS app.stock_movements;
+DROP TABLE IF EXISTS app.part_orders;
+
+DROP FUNCTION IF EXISTS app.stock_movements_append_only();
+DROP FUNCTION IF EXISTS app.apply_stock_movement();
+
+COMMIT;
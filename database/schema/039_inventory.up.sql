@@ -0,0 +1,341 @@
+-- Spare parts inventory: the stock of parts (rows of the table provisioned
+-- from the parts template) in bins (rows of the bins template), changed only
+-- through an append-only ledger of movements.
+--
+-- app.stock_movements records every receipt, issue, transfer, adjustment and
+-- return; a trigger applies each one to app.stock_levels, the quantity on
+-- hand per part, bin, lot and serial number, and refuses movements that
+-- would take a level below zero. Movements are never updated or deleted: a
+-- mistake is corrected by another movement. app.stock_reservations hold
+-- stock for planned work orders and app.part_orders track what is on order;
+-- app.part_stock weighs them together for the low-stock report.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.part_orders (
+  id          uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id      uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  part_id     uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  quantity    numeric     NOT NULL,
+  -- Received so far, kept by receipts referencing the order
+  received    numeric     NOT NULL DEFAULT 0,
+  supplier    text,
+  reference   text,
+  expected_on date,
+  status      text        NOT NULL DEFAULT 'open',
+  created_by  uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at  timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT part_orders_quantity_check CHECK (quantity > 0),
+  CONSTRAINT part_orders_received_check CHECK (received >= 0),
+  CONSTRAINT part_orders_status_check CHECK (status IN ('open', 'received', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS part_orders_part_idx ON app.part_orders (part_id) WHERE status = 'open';
+
+-- References to rows default to NO ACTION: parts, bins and work orders with
+-- movements cannot be deleted, while deleting the org still removes all.
+CREATE TABLE IF NOT EXISTS app.stock_movements (
+  id            bigserial   PRIMARY KEY,
+  org_id        uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  part_id       uuid        NOT NULL CONSTRAINT stock_movements_part_id_fkey REFERENCES app.rows(id),
+  -- receive: into to_bin; issue: out of from_bin; transfer: from_bin to
+  -- to_bin; adjust: into to_bin or out of from_bin after a count; return:
+  -- back into to_bin from a work order
+  kind          text        NOT NULL,
+  quantity      numeric     NOT NULL,
+  from_bin_id   uuid        CONSTRAINT stock_movements_from_bin_id_fkey REFERENCES app.rows(id),
+  to_bin_id     uuid        CONSTRAINT stock_movements_to_bin_id_fkey REFERENCES app.rows(id),
+  lot           text        NOT NULL DEFAULT '',
+  serial        text        NOT NULL DEFAULT '',
+  -- Of the lot; taken from the stock level on the way out
+  expires_on    date,
+  work_order_id uuid        CONSTRAINT stock_movements_work_order_id_fkey REFERENCES app.rows(id),
+  order_id      uuid        REFERENCES app.part_orders(id),
+  -- Per unit: the price paid on receipts, the part's cost on issues
+  unit_cost     numeric,
+  note          text,
+  created_by    uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT stock_movements_kind_check CHECK (kind IN ('receive', 'issue', 'transfer', 'adjust', 'return')),
+  CONSTRAINT stock_movements_quantity_check CHECK (quantity > 0),
+  CONSTRAINT stock_movements_bins_check CHECK (CASE kind
+    WHEN 'receive'  THEN from_bin_id IS NULL AND to_bin_id IS NOT NULL
+    WHEN 'return'   THEN from_bin_id IS NULL AND to_bin_id IS NOT NULL AND work_order_id IS NOT NULL
+    WHEN 'issue'    THEN from_bin_id IS NOT NULL AND to_bin_id IS NULL
+    WHEN 'transfer' THEN from_bin_id IS NOT NULL AND to_bin_id IS NOT NULL AND from_bin_id <> to_bin_id
+    WHEN 'adjust'   THEN (from_bin_id IS NULL) <> (to_bin_id IS NULL)
+  END),
+  CONSTRAINT stock_movements_order_check CHECK (order_id IS NULL OR kind = 'receive'),
+  CONSTRAINT stock_movements_serial_check CHECK (serial = '' OR quantity = 1),
+  CONSTRAINT stock_movements_unit_cost_check CHECK (unit_cost IS NULL OR unit_cost >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS stock_movements_part_idx ON app.stock_movements (part_id, id DESC);
+CREATE INDEX IF NOT EXISTS stock_movements_work_order_idx ON app.stock_movements (work_order_id) WHERE work_order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS stock_movements_from_bin_idx ON app.stock_movements (from_bin_id) WHERE from_bin_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS stock_movements_to_bin_idx ON app.stock_movements (to_bin_id) WHERE to_bin_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS stock_movements_order_idx ON app.stock_movements (order_id) WHERE order_id IS NOT NULL;
+
+-- Written only by app.apply_stock_movement. Levels that run out are kept at
+-- zero; received_at orders the levels of a part first in, first out.
+CREATE TABLE IF NOT EXISTS app.stock_levels (
+  org_id      uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  part_id     uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  bin_id      uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  lot         text        NOT NULL DEFAULT '',
+  serial      text        NOT NULL DEFAULT '',
+  expires_on  date,
+  quantity    numeric     NOT NULL,
+  received_at timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (part_id, bin_id, lot, serial),
+  CONSTRAINT stock_levels_quantity_check CHECK (quantity >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS stock_levels_bin_idx ON app.stock_levels (bin_id) WHERE quantity > 0;
+-- A serial number is in stock in one bin at a time
+CREATE UNIQUE INDEX IF NOT EXISTS stock_levels_serial_key
+  ON app.stock_levels (part_id, serial) WHERE serial <> '' AND quantity > 0;
+
+CREATE TABLE IF NOT EXISTS app.stock_reservations (
+  id            uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id        uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  part_id       uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  work_order_id uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  -- Where the stock is expected to come from, if it matters
+  bin_id        uuid        REFERENCES app.rows(id) ON DELETE SET NULL,
+  quantity      numeric     NOT NULL,
+  -- Issued to the work order since; the reservation is fulfilled once it
+  -- reaches quantity
+  issued        numeric     NOT NULL DEFAULT 0,
+  needed_on     date,
+  status        text        NOT NULL DEFAULT 'active',
+  note          text,
+  created_by    uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  updated_at    timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT stock_reservations_quantity_check CHECK (quantity > 0),
+  CONSTRAINT stock_reservations_issued_check CHECK (issued >= 0),
+  CONSTRAINT stock_reservations_status_check CHECK (status IN ('active', 'fulfilled', 'released'))
+);
+
+CREATE INDEX IF NOT EXISTS stock_reservations_part_idx ON app.stock_reservations (part_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS stock_reservations_work_order_idx ON app.stock_reservations (work_order_id);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['part_orders','stock_movements','stock_levels','stock_reservations'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- Applies a movement to the stock levels before it is stored: out of
+-- from_bin first, then into to_bin. A receipt against an order counts
+-- towards it, and an issue to a work order fulfils its reservations of the
+-- part, oldest first.
+CREATE OR REPLACE FUNCTION app.apply_stock_movement()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  lvl     app.stock_levels;
+  res     app.stock_reservations;
+  left_q  numeric;
+  take    numeric;
+  expires date;
+BEGIN
+  IF NEW.from_bin_id IS NOT NULL THEN
+    UPDATE app.stock_levels l
+    SET quantity = l.quantity - NEW.quantity,
+        updated_at = now()
+    WHERE l.part_id = NEW.part_id
+      AND l.bin_id = NEW.from_bin_id
+      AND l.lot = NEW.lot
+      AND l.serial = NEW.serial
+      AND l.quantity >= NEW.quantity
+    RETURNING l.* INTO lvl;
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'not enough stock'
+        USING ERRCODE = 'check_violation',
+              DETAIL = 'not enough stock in the bin' ||
+                CASE WHEN NEW.lot <> '' THEN ' for lot ' || NEW.lot ELSE '' END ||
+                CASE WHEN NEW.serial <> '' THEN ' for serial ' || NEW.serial ELSE '' END;
+    END IF;
+    NEW.expires_on := lvl.expires_on;
+  END IF;
+
+  IF NEW.to_bin_id IS NOT NULL THEN
+    IF NEW.lot <> '' AND NEW.expires_on IS NOT NULL THEN
+      SELECT l.expires_on INTO expires
+      FROM app.stock_levels l
+      WHERE l.part_id = NEW.part_id
+        AND l.lot = NEW.lot
+        AND l.expires_on IS NOT NULL
+        AND l.expires_on <> NEW.expires_on
+      LIMIT 1;
+      IF FOUND THEN
+        RAISE EXCEPTION 'lot expiry mismatch'
+          USING ERRCODE = 'check_violation',
+                DETAIL = 'lot ' || NEW.lot || ' expires on ' || expires;
+      END IF;
+    END IF;
+    INSERT INTO app.stock_levels AS l (org_id, part_id, bin_id, lot, serial, expires_on, quantity)
+    VALUES (NEW.org_id, NEW.part_id, NEW.to_bin_id, NEW.lot, NEW.serial, NEW.expires_on, NEW.quantity)
+    ON CONFLICT (part_id, bin_id, lot, serial) DO UPDATE
+    SET quantity = l.quantity + EXCLUDED.quantity,
+        expires_on = COALESCE(l.expires_on, EXCLUDED.expires_on),
+        received_at = CASE WHEN l.quantity = 0 THEN now() ELSE l.received_at END,
+        updated_at = now();
+  END IF;
+
+  IF NEW.order_id IS NOT NULL THEN
+    UPDATE app.part_orders o
+    SET received = o.received + NEW.quantity,
+        status = CASE WHEN o.received + NEW.quantity >= o.quantity THEN 'received' ELSE o.status END,
+        updated_at = now()
+    WHERE o.id = NEW.order_id
+      AND o.part_id = NEW.part_id
+      AND o.status = 'open';
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'order not open'
+        USING ERRCODE = 'check_violation',
+              DETAIL = 'order is not an open order of the part';
+    END IF;
+  END IF;
+
+  IF NEW.kind = 'issue' AND NEW.work_order_id IS NOT NULL THEN
+    left_q := NEW.quantity;
+    FOR res IN
+      SELECT * FROM app.stock_reservations sr
+      WHERE sr.part_id = NEW.part_id
+        AND sr.work_order_id = NEW.work_order_id
+        AND sr.status = 'active'
+      ORDER BY sr.created_at, sr.id
+      FOR UPDATE
+    LOOP
+      EXIT WHEN left_q <= 0;
+      take := LEAST(left_q, res.quantity - res.issued);
+      UPDATE app.stock_reservations
+      SET issued = issued + take,
+          status = CASE WHEN issued + take >= quantity THEN 'fulfilled' ELSE status END,
+          updated_at = now()
+      WHERE id = res.id;
+      left_q := left_q - take;
+    END LOOP;
+  END IF;
+
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS stock_movements_apply ON app.stock_movements;
+CREATE TRIGGER stock_movements_apply
+BEFORE INSERT ON app.stock_movements
+FOR EACH ROW EXECUTE FUNCTION app.apply_stock_movement();
+
+-- The ledger is append-only; only deleting the org removes movements.
+CREATE OR REPLACE FUNCTION app.stock_movements_append_only()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND NOT EXISTS (SELECT 1 FROM organisations o WHERE o.id = OLD.org_id) THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'stock movements are append-only'
+    USING ERRCODE = 'check_violation',
+          DETAIL = 'stock movements cannot be changed; record a correcting movement';
+END$$;
+
+DROP TRIGGER IF EXISTS stock_movements_append_only ON app.stock_movements;
+CREATE TRIGGER stock_movements_append_only
+BEFORE UPDATE OR DELETE ON app.stock_movements
+FOR EACH ROW EXECUTE FUNCTION app.stock_movements_append_only();
+
+-- The value of one float cell, from either engine.
+CREATE OR REPLACE FUNCTION app.cell_float(p_row_id uuid, p_column_id bigint)
+RETURNS float8 LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+  v float8;
+BEGIN
+  IF p_row_id IS NULL OR p_column_id IS NULL THEN
+    RETURN NULL;
+  END IF;
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    EXECUTE format('SELECT p.%I FROM app_data.%I p WHERE p.id = $1',
+      'c_' || p_column_id, t.physical_table)
+    INTO v
+    USING p_row_id;
+    RETURN v;
+  END IF;
+
+  RETURN (SELECT vf.value FROM app.values_float vf WHERE vf.row_id = p_row_id AND vf.column_id = p_column_id);
+END$$;
+
+-- The value of one bool cell, from either engine.
+CREATE OR REPLACE FUNCTION app.cell_bool(p_row_id uuid, p_column_id bigint)
+RETURNS boolean LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  t app.tables;
+  v boolean;
+BEGIN
+  IF p_row_id IS NULL OR p_column_id IS NULL THEN
+    RETURN NULL;
+  END IF;
+  SELECT tb.* INTO t
+  FROM app.columns c
+  JOIN app.tables tb ON tb.id = c.table_id
+  WHERE c.id = p_column_id;
+
+  IF t.storage_mode = 'relational' THEN
+    EXECUTE format('SELECT p.%I FROM app_data.%I p WHERE p.id = $1',
+      'c_' || p_column_id, t.physical_table)
+    INTO v
+    USING p_row_id;
+    RETURN v;
+  END IF;
+
+  RETURN (SELECT vb.value FROM app.values_bool vb WHERE vb.row_id = p_row_id AND vb.column_id = p_column_id);
+END$$;
+
+-- Whether a work order is still to be done: not COMPLETED or CANCELLED, and
+-- not archived. Work order tables without those columns are always open.
+CREATE OR REPLACE FUNCTION app.work_order_open(p_row_id uuid)
+RETURNS boolean LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(app.cell_text(r.id, s.id), '') NOT IN ('COMPLETED', 'CANCELLED')
+     AND NOT COALESCE(app.cell_bool(r.id, a.id), false)
+  FROM app.rows r
+  LEFT JOIN app.columns s ON s.table_id = r.table_id AND s.name = 'status' AND s.kind = 'value' AND s.type = 'enum'
+  LEFT JOIN app.columns a ON a.table_id = r.table_id AND a.name = 'archived' AND a.kind = 'value' AND a.type = 'bool'
+  WHERE r.id = p_row_id
+$$;
+
+-- Stock of parts: on hand in all bins, reserved by active reservations of
+-- open work orders (less what was issued to them) and still on order.
+CREATE OR REPLACE FUNCTION app.part_stock(p_part_ids uuid[])
+RETURNS TABLE (part_id uuid, on_hand numeric, reserved numeric, on_order numeric)
+LANGUAGE sql STABLE AS $$
+  SELECT p.id,
+         COALESCE((SELECT sum(l.quantity) FROM app.stock_levels l WHERE l.part_id = p.id), 0),
+         COALESCE((SELECT sum(GREATEST(sr.quantity - sr.issued, 0))
+                   FROM app.stock_reservations sr
+                   WHERE sr.part_id = p.id
+                     AND sr.status = 'active'
+                     AND app.work_order_open(sr.work_order_id)), 0),
+         COALESCE((SELECT sum(GREATEST(o.quantity - o.received, 0))
+                   FROM app.part_orders o
+                   WHERE o.part_id = p.id
+                     AND o.status = 'open'), 0)
+  FROM unnest(p_part_ids) AS p(id)
+$$;
+
+COMMIT;
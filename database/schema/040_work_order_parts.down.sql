@@ -0,0 +1,12 @@
+-- Revert parts used on work orders.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.work_order_site(uuid);
+DROP FUNCTION IF EXISTS app.cell_uuid_by_name(uuid, text);
+DROP FUNCTION IF EXISTS app.work_order_parts_cost(uuid);
+
+DROP TRIGGER IF EXISTS stock_movements_return_check ON app.stock_movements;
+DROP FUNCTION IF EXISTS app.check_stock_return();
+
+COMMIT;
@@ -0,0 +1,96 @@
+-- Parts used on work orders: the issues of the stock ledger to a work order,
+-- less the returns of what was not used, make its part lines.
+--
+-- A return may only bring back what was issued to its work order, of the
+-- same part, lot and serial number, and is valued at the cost it was issued
+-- at unless given one. app.work_order_parts_cost rolls the lines up into
+-- the cost of parts of a work order; app.work_order_site finds the site
+-- (the top of the locations hierarchy) a work order's costs are reported
+-- under.
+
+BEGIN;
+
+-- Checks a return against what was issued to its work order. The work
+-- order row is locked so concurrent returns cannot bring back more than
+-- was issued between them.
+CREATE OR REPLACE FUNCTION app.check_stock_return()
+RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  issued   numeric;
+  returned numeric;
+  cost     numeric;
+BEGIN
+  PERFORM 1 FROM app.rows r WHERE r.id = NEW.work_order_id FOR UPDATE;
+
+  SELECT COALESCE(sum(m.quantity) FILTER (WHERE m.kind = 'issue'), 0),
+         COALESCE(sum(m.quantity) FILTER (WHERE m.kind = 'return'), 0),
+         sum(m.quantity * m.unit_cost) FILTER (WHERE m.kind = 'issue' AND m.unit_cost IS NOT NULL)
+           / NULLIF(sum(m.quantity) FILTER (WHERE m.kind = 'issue' AND m.unit_cost IS NOT NULL), 0)
+  INTO issued, returned, cost
+  FROM app.stock_movements m
+  WHERE m.work_order_id = NEW.work_order_id
+    AND m.part_id = NEW.part_id
+    AND m.lot = NEW.lot
+    AND m.serial = NEW.serial
+    AND m.kind IN ('issue', 'return');
+
+  IF NEW.quantity > issued - returned THEN
+    RAISE EXCEPTION 'return exceeds issues'
+      USING ERRCODE = 'check_violation',
+            DETAIL = 'only ' || trim_scale(issued - returned) || ' of the part' ||
+              CASE WHEN NEW.lot <> '' THEN ' from lot ' || NEW.lot ELSE '' END ||
+              CASE WHEN NEW.serial <> '' THEN ' with serial ' || NEW.serial ELSE '' END ||
+              ' issued to the work order can be returned';
+  END IF;
+  IF NEW.unit_cost IS NULL THEN
+    NEW.unit_cost := cost;
+  END IF;
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS stock_movements_return_check ON app.stock_movements;
+CREATE TRIGGER stock_movements_return_check
+BEFORE INSERT ON app.stock_movements
+FOR EACH ROW WHEN (NEW.kind = 'return')
+EXECUTE FUNCTION app.check_stock_return();
+
+-- The cost of the parts used on a work order: its issues less its returns.
+-- Movements without a unit cost count as free.
+CREATE OR REPLACE FUNCTION app.work_order_parts_cost(p_work_order_id uuid)
+RETURNS numeric LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(sum(CASE m.kind WHEN 'issue' THEN 1 ELSE -1 END * m.quantity * COALESCE(m.unit_cost, 0)), 0)
+  FROM app.stock_movements m
+  WHERE m.work_order_id = p_work_order_id
+    AND m.kind IN ('issue', 'return')
+$$;
+
+-- The value of the uuid column named p_name of a row's table, if it has one.
+CREATE OR REPLACE FUNCTION app.cell_uuid_by_name(p_row_id uuid, p_name text)
+RETURNS uuid LANGUAGE sql STABLE AS $$
+  SELECT app.cell_uuid(r.id, c.id)
+  FROM app.rows r
+  JOIN app.columns c ON c.table_id = r.table_id AND c.name = p_name AND c.kind = 'value' AND c.type = 'uuid'
+  WHERE r.id = p_row_id
+$$;
+
+-- The site of a work order: the top of the locations hierarchy above its
+-- location, or above its asset's location when it has none.
+CREATE OR REPLACE FUNCTION app.work_order_site(p_work_order_id uuid)
+RETURNS uuid LANGUAGE sql STABLE AS $$
+  WITH loc AS (
+    SELECT COALESCE(app.cell_uuid_by_name(p_work_order_id, 'location'),
+                    app.cell_uuid_by_name(app.cell_uuid_by_name(p_work_order_id, 'asset'), 'location')) AS id
+  )
+  SELECT COALESCE(
+           (SELECT a.id
+            FROM app.rows r
+            JOIN app.hierarchies h ON h.table_id = r.table_id
+            CROSS JOIN LATERAL app.row_ancestors(h.column_id, r.id) a
+            WHERE r.id = loc.id
+            ORDER BY a.depth DESC
+            LIMIT 1),
+           loc.id)
+  FROM loc
+$$;
+
+COMMIT;
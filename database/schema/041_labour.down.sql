@@ -0,0 +1,13 @@
+-- Revert labour time on work orders.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.work_order_labour(uuid);
+DROP FUNCTION IF EXISTS app.labour_rate(uuid, uuid);
+
+DROP TABLE IF EXISTS app.time_entries;
+DROP TABLE IF EXISTS app.labour_rates;
+
+DROP FUNCTION IF EXISTS app.time_entry_rate();
+
+COMMIT;
@@ -0,0 +1,113 @@
+-- Labour time on work orders: time entries per work order and user, from
+-- start/stop timers or entered by hand, valued at hourly rates per user or
+-- team.
+--
+-- An entry without ended_at is a running timer; a user has one at most. The
+-- entries of a user never overlap, running timers included (they run to
+-- infinity until stopped). The hourly rate is captured when the entry is
+-- created, so later rate changes leave past costs alone: the user's own
+-- rate, else that of the work order's team when the user is in it, else the
+-- highest of the user's teams.
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS app.labour_rates (
+  id          uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id      uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  user_id     uuid        REFERENCES users(id) ON DELETE CASCADE,
+  team_id     uuid        REFERENCES app.rows(id) ON DELETE CASCADE,
+  hourly_rate numeric     NOT NULL,
+  created_at  timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT labour_rates_principal_check CHECK (num_nonnulls(user_id, team_id) = 1),
+  CONSTRAINT labour_rates_hourly_rate_check CHECK (hourly_rate >= 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS labour_rates_user_key ON app.labour_rates (org_id, user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS labour_rates_team_key ON app.labour_rates (team_id) WHERE team_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS app.time_entries (
+  id            uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id        uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  work_order_id uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  user_id       uuid        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  -- timer: started and stopped live; manual: entered afterwards
+  source        text        NOT NULL,
+  started_at    timestamptz NOT NULL,
+  ended_at      timestamptz,
+  hourly_rate   numeric,
+  note          text,
+  created_by    uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  updated_at    timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT time_entries_source_check CHECK (source IN ('timer', 'manual')),
+  CONSTRAINT time_entries_period_check CHECK (ended_at IS NULL OR ended_at > started_at),
+  CONSTRAINT time_entries_manual_check CHECK (source = 'timer' OR ended_at IS NOT NULL),
+  CONSTRAINT time_entries_hourly_rate_check CHECK (hourly_rate IS NULL OR hourly_rate >= 0),
+  CONSTRAINT time_entries_no_overlap EXCLUDE USING gist (
+    org_id WITH =, user_id WITH =, tstzrange(started_at, ended_at) WITH &&
+  )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_key ON app.time_entries (org_id, user_id) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS time_entries_work_order_idx ON app.time_entries (work_order_id);
+CREATE INDEX IF NOT EXISTS time_entries_user_idx ON app.time_entries (org_id, user_id, started_at);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['labour_rates','time_entries'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- The hourly rate of a user's time on a work order; NULL when none applies.
+CREATE OR REPLACE FUNCTION app.labour_rate(p_user_id uuid, p_work_order_id uuid)
+RETURNS numeric LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(
+    (SELECT lr.hourly_rate FROM app.labour_rates lr WHERE lr.user_id = p_user_id),
+    (SELECT lr.hourly_rate
+     FROM app.labour_rates lr
+     JOIN app.team_members tm ON tm.team_id = lr.team_id AND tm.user_id = p_user_id
+     WHERE lr.team_id = app.cell_uuid_by_name(p_work_order_id, 'team')),
+    (SELECT max(lr.hourly_rate)
+     FROM app.labour_rates lr
+     JOIN app.team_members tm ON tm.team_id = lr.team_id AND tm.user_id = p_user_id)
+  )
+$$;
+
+-- Captures the rate of a new entry unless given one.
+CREATE OR REPLACE FUNCTION app.time_entry_rate()
+RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF NEW.hourly_rate IS NULL THEN
+    NEW.hourly_rate := app.labour_rate(NEW.user_id, NEW.work_order_id);
+  END IF;
+  RETURN NEW;
+END$$;
+
+DROP TRIGGER IF EXISTS time_entries_rate ON app.time_entries;
+CREATE TRIGGER time_entries_rate
+BEFORE INSERT ON app.time_entries
+FOR EACH ROW EXECUTE FUNCTION app.time_entry_rate();
+
+-- The hours and cost of the finished entries of a work order. Entries
+-- without a rate count their hours at no cost.
+CREATE OR REPLACE FUNCTION app.work_order_labour(p_work_order_id uuid)
+RETURNS TABLE (hours numeric, cost numeric) LANGUAGE sql STABLE AS $$
+  SELECT COALESCE(sum(extract(epoch FROM e.ended_at - e.started_at) / 3600), 0),
+         COALESCE(sum(extract(epoch FROM e.ended_at - e.started_at) / 3600 * COALESCE(e.hourly_rate, 0)), 0)
+  FROM app.time_entries e
+  WHERE e.work_order_id = p_work_order_id
+    AND e.ended_at IS NOT NULL
+$$;
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Revert checklists.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.work_order_checklist_open(uuid);
+DROP FUNCTION IF EXISTS app.copy_checklist(uuid, uuid, uuid);
+
+DROP TABLE IF EXISTS app.checklist_items;
+DROP TABLE IF EXISTS app.checklists;
+DROP TABLE IF EXISTS app.checklist_template_items;
+DROP TABLE IF EXISTS app.checklist_templates;
+
+COMMIT;
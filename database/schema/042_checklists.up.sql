@@ -0,0 +1,137 @@
+-- Checklists: templates of the steps of a procedure, copied onto work
+-- orders where each item is answered with who answered it and when.
+--
+-- A checklist on a work order is a copy of its template's items at the time
+-- it was added, so later edits of the template leave it alone. Item kinds:
+-- checkbox (done), pass_fail (pass, fail or na), reading (a number, passing
+-- within min_value and max_value), text, photo and signature (a file). An
+-- item is answered when completed_at is set; a required item must be before
+-- its work order is completed.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.checklist_templates (
+  id          uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id      uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  name        text        NOT NULL,
+  description text,
+  created_by  uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at  timestamptz NOT NULL DEFAULT now(),
+  updated_at  timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT checklist_templates_name_check CHECK (btrim(name) <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS checklist_templates_name_key ON app.checklist_templates (org_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS app.checklist_template_items (
+  id          uuid    PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id      uuid    NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  template_id uuid    NOT NULL REFERENCES app.checklist_templates(id) ON DELETE CASCADE,
+  position    int     NOT NULL,
+  label       text    NOT NULL,
+  kind        text    NOT NULL,
+  required    boolean NOT NULL DEFAULT true,
+  min_value   numeric,
+  max_value   numeric,
+  unit        text,
+  -- a failed answer creates a corrective work order
+  follow_up   boolean NOT NULL DEFAULT false,
+  help        text,
+  CONSTRAINT checklist_template_items_kind_check
+    CHECK (kind IN ('checkbox', 'pass_fail', 'reading', 'text', 'photo', 'signature')),
+  CONSTRAINT checklist_template_items_limits_check
+    CHECK ((kind = 'reading' OR (min_value IS NULL AND max_value IS NULL)) AND (min_value IS NULL OR max_value IS NULL OR min_value <= max_value)),
+  CONSTRAINT checklist_template_items_position_key UNIQUE (template_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS app.checklists (
+  id            uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id        uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  work_order_id uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  template_id   uuid        REFERENCES app.checklist_templates(id) ON DELETE SET NULL,
+  name          text        NOT NULL,
+  created_by    uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at    timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS checklists_work_order_idx ON app.checklists (work_order_id, created_at);
+
+CREATE TABLE IF NOT EXISTS app.checklist_items (
+  id                      uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id                  uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  checklist_id            uuid        NOT NULL REFERENCES app.checklists(id) ON DELETE CASCADE,
+  position                int         NOT NULL,
+  label                   text        NOT NULL,
+  kind                    text        NOT NULL,
+  required                boolean     NOT NULL,
+  min_value               numeric,
+  max_value               numeric,
+  unit                    text,
+  follow_up               boolean     NOT NULL,
+  help                    text,
+  -- the answer
+  result                  text,
+  reading                 numeric,
+  text_value              text,
+  file                    text,
+  note                    text,
+  completed_by            uuid        REFERENCES users(id) ON DELETE SET NULL,
+  completed_at            timestamptz,
+  follow_up_work_order_id uuid        REFERENCES app.rows(id) ON DELETE SET NULL,
+  CONSTRAINT checklist_items_kind_check
+    CHECK (kind IN ('checkbox', 'pass_fail', 'reading', 'text', 'photo', 'signature')),
+  CONSTRAINT checklist_items_result_check CHECK (result IN ('done', 'pass', 'fail', 'na')),
+  CONSTRAINT checklist_items_answered_check CHECK ((result IS NULL) = (completed_at IS NULL)),
+  CONSTRAINT checklist_items_position_key UNIQUE (checklist_id, position)
+);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['checklist_templates','checklist_template_items','checklists','checklist_items'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+-- Copies a template onto a work order and returns the new checklist, NULL
+-- when the template does not exist.
+CREATE OR REPLACE FUNCTION app.copy_checklist(p_work_order_id uuid, p_template_id uuid, p_created_by uuid)
+RETURNS uuid LANGUAGE plpgsql AS $$
+DECLARE
+  t  app.checklist_templates;
+  id uuid;
+BEGIN
+  SELECT * INTO t FROM app.checklist_templates WHERE checklist_templates.id = p_template_id;
+  IF NOT FOUND THEN
+    RETURN NULL;
+  END IF;
+  INSERT INTO app.checklists (org_id, work_order_id, template_id, name, created_by)
+  VALUES (t.org_id, p_work_order_id, t.id, t.name, p_created_by)
+  RETURNING checklists.id INTO id;
+  INSERT INTO app.checklist_items (org_id, checklist_id, position, label, kind, required,
+                                   min_value, max_value, unit, follow_up, help)
+  SELECT i.org_id, id, i.position, i.label, i.kind, i.required,
+         i.min_value, i.max_value, i.unit, i.follow_up, i.help
+  FROM app.checklist_template_items i
+  WHERE i.template_id = t.id;
+  RETURN id;
+END$$;
+
+-- The required items of a work order's checklists not answered yet.
+CREATE OR REPLACE FUNCTION app.work_order_checklist_open(p_work_order_id uuid)
+RETURNS int LANGUAGE sql STABLE AS $$
+  SELECT count(*)::int
+  FROM app.checklist_items i
+  JOIN app.checklists c ON c.id = i.checklist_id
+  WHERE c.work_order_id = p_work_order_id
+    AND i.required
+    AND i.completed_at IS NULL
+$$;
+
+COMMIT;
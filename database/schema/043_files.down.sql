@@ -0,0 +1,8 @@
+-- Revert files. Blobs already stored are left in the blob store.
+
+BEGIN;
+
+DROP TABLE IF EXISTS app.file_links;
+DROP TABLE IF EXISTS app.files;
+
+COMMIT;
@@ -0,0 +1,61 @@
+-- Files: uploaded content kept in a blob store, and the rows it is linked
+-- to.
+--
+-- A file's content is stored once per org under its SHA-256, so uploading
+-- the same content again returns the file already stored. Images keep their
+-- size, whether a thumbnail was stored, and the place and time they were
+-- taken when their EXIF data has them. Files are linked to rows of any
+-- table; deleting a row or a file removes its links.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.files (
+  id           uuid        PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id       uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  name         text        NOT NULL,
+  content_type text        NOT NULL,
+  size         bigint      NOT NULL,
+  sha256       text        NOT NULL,
+  width        int,
+  height       int,
+  thumbnail    boolean     NOT NULL DEFAULT false,
+  latitude     float8,
+  longitude    float8,
+  taken_at     timestamptz,
+  created_by   uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT files_size_check CHECK (size >= 0),
+  CONSTRAINT files_sha256_check CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+  CONSTRAINT files_geotag_check
+    CHECK ((latitude IS NULL) = (longitude IS NULL) AND latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180),
+  CONSTRAINT files_sha256_key UNIQUE (org_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS files_org_created_idx ON app.files (org_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS app.file_links (
+  org_id     uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  file_id    uuid        NOT NULL REFERENCES app.files(id) ON DELETE CASCADE,
+  row_id     uuid        NOT NULL REFERENCES app.rows(id) ON DELETE CASCADE,
+  created_by uuid        REFERENCES users(id) ON DELETE SET NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (file_id, row_id)
+);
+
+CREATE INDEX IF NOT EXISTS file_links_row_idx ON app.file_links (row_id, created_at);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['files','file_links'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+  END LOOP;
+END$$;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Revert the request portal. Requests already submitted stay in the
+-- requests table.
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS app.request_token_row(text);
+DROP FUNCTION IF EXISTS app.request_portal_org(text);
+
+DROP TABLE IF EXISTS app.request_tokens;
+DROP TABLE IF EXISTS app.request_portals;
+
+COMMIT;
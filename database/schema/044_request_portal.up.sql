@@ -0,0 +1,80 @@
+-- Request portal: a public form through which people without an account
+-- raise maintenance requests, and the tokens they follow them with.
+--
+-- Each org has at most one portal, reached by an unguessable key. A request
+-- submitted through it is a row of the org's requests table; its requester
+-- gets a token, of which only the SHA-256 is kept, to follow its status.
+--
+-- Portal keys and tokens arrive without an org, so they are looked up across
+-- orgs; only app.request_portal_org and app.request_token_row turn that on.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS app.request_portals (
+  org_id           uuid        PRIMARY KEY REFERENCES organisations(id) ON DELETE CASCADE,
+  key              text        NOT NULL,
+  enabled          boolean     NOT NULL DEFAULT false,
+  title            text        NOT NULL DEFAULT 'Report a problem',
+  intro            text,
+  captcha          boolean     NOT NULL DEFAULT false,
+  photos           boolean     NOT NULL DEFAULT true,
+  default_priority text,
+  updated_by       uuid        REFERENCES users(id) ON DELETE SET NULL,
+  updated_at       timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT request_portals_key_check CHECK (key ~ '^[A-Za-z0-9_-]{16,64}$'),
+  CONSTRAINT request_portals_key_key UNIQUE (key)
+);
+
+CREATE TABLE IF NOT EXISTS app.request_tokens (
+  token_hash text        PRIMARY KEY,
+  org_id     uuid        NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+  row_id     uuid        NOT NULL UNIQUE REFERENCES app.rows(id) ON DELETE CASCADE,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT request_tokens_hash_check CHECK (token_hash ~ '^[0-9a-f]{64}$')
+);
+
+DO $$
+DECLARE
+  tbl text;
+BEGIN
+  FOREACH tbl IN ARRAY ARRAY['request_portals','request_tokens'] LOOP
+    EXECUTE format('ALTER TABLE app.%I ENABLE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('ALTER TABLE app.%I FORCE ROW LEVEL SECURITY', tbl);
+    EXECUTE format('DROP POLICY IF EXISTS org_isolation ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY org_isolation ON app.%I USING (org_id = app.current_org()) WITH CHECK (org_id = app.current_org())',
+      tbl);
+    EXECUTE format('DROP POLICY IF EXISTS portal_lookup ON app.%I', tbl);
+    EXECUTE format(
+      'CREATE POLICY portal_lookup ON app.%I FOR SELECT USING (current_setting(''app.portal_lookup'', true) = ''on'')',
+      tbl);
+  END LOOP;
+END$$;
+
+-- The org of an enabled portal, NULL when no enabled portal has the key.
+CREATE OR REPLACE FUNCTION app.request_portal_org(p_key text)
+RETURNS uuid
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  org uuid;
+BEGIN
+  PERFORM set_config('app.portal_lookup', 'on', true);
+  SELECT p.org_id INTO org FROM app.request_portals p WHERE p.key = p_key AND p.enabled;
+  PERFORM set_config('app.portal_lookup', '', true);
+  RETURN org;
+END$$;
+
+-- The request of a token, given its SHA-256; no row when unknown.
+CREATE OR REPLACE FUNCTION app.request_token_row(p_hash text)
+RETURNS TABLE (org_id uuid, row_id uuid, created_at timestamptz)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  PERFORM set_config('app.portal_lookup', 'on', true);
+  RETURN QUERY SELECT t.org_id, t.row_id, t.created_at FROM app.request_tokens t WHERE t.token_hash = p_hash;
+  PERFORM set_config('app.portal_lookup', '', true);
+END$$;
+
+COMMIT;
@@ -0,0 +1,157 @@
+-- Automation checks (033): trigger and condition matching, action values,
+-- claiming only async runs, and org isolation of automations, runs and
+-- queued emails.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/automations.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000ea', 'auto-probe', 'Automation probe'),
+  ('00000000-0000-4000-8000-0000000000eb', 'auto-other', 'Automation other');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000ea', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, col, 'text' FROM t, unnest(ARRAY['title', 'priority', 'status']) col
+  RETURNING table_id
+)
+SELECT set_config('auto_test.orders', (SELECT min(table_id)::text FROM c), true);
+
+-- Any change of priority to HIGH; created orders whose title mentions a
+-- leak, as compiled by formula.CompileAutomationCondition; an async one on
+-- deletion; and an inactive one.
+INSERT INTO app.automations (id, org_id, table_id, name, trigger, trigger_field, trigger_to,
+                             condition_expression, condition_sql, actions, refs, mode, active)
+VALUES
+  ('00000000-0000-4000-8000-0000000000e1', app.current_org(), current_setting('auto_test.orders')::bigint,
+   'escalate', 'changed', 'priority', 'HIGH', NULL, NULL,
+   '[{"type":"set_fields","values":{"status":"''ESCALATED''"},"sql":{"status":"CAST(''ESCALATED'' AS text)"}}]',
+   ARRAY[current_setting('auto_test.orders') || '.priority', current_setting('auto_test.orders') || '.status'],
+   'sync', true),
+  ('00000000-0000-4000-8000-0000000000e2', app.current_org(), current_setting('auto_test.orders')::bigint,
+   'leaks', 'created', NULL, NULL, 'title = ''Leak''',
+   'COALESCE(((d->>''title'') = ''Leak''), FALSE)',
+   '[{"type":"email","to":["ops@example.com"],"subject":"''New: '' & title","sql":{"subject":"CAST(concat(''New: '', (d->>''title'')) AS text)"}}]',
+   ARRAY[current_setting('auto_test.orders') || '.title'], 'sync', true),
+  ('00000000-0000-4000-8000-0000000000e3', app.current_org(), current_setting('auto_test.orders')::bigint,
+   'archive', 'deleted', NULL, NULL, NULL, NULL,
+   '[{"type":"webhook","webhook_id":"00000000-0000-4000-8000-0000000000e9"}]', '{}', 'async', true),
+  ('00000000-0000-4000-8000-0000000000e4', app.current_org(), current_setting('auto_test.orders')::bigint,
+   'off', 'created', NULL, NULL, NULL, NULL,
+   '[{"type":"webhook","webhook_id":"00000000-0000-4000-8000-0000000000e9"}]', '{}', 'sync', false);
+
+DO $$
+DECLARE
+  orders bigint := current_setting('auto_test.orders')::bigint;
+  ord    uuid;
+  ev     bigint;
+  prev   jsonb;
+  ids    uuid[];
+  v      jsonb;
+BEGIN
+  ord := app.insert_row(orders, '{"title":"Leak","priority":"LOW"}');
+  ev := app.emit_event(app.current_org(), 'row.created', orders, ord, app.row_to_json(ord), NULL);
+  SELECT array_agg(id ORDER BY created_at, id) INTO ids FROM app.match_automations(ev);
+  IF ids IS DISTINCT FROM ARRAY['00000000-0000-4000-8000-0000000000e2'::uuid] THEN
+    RAISE EXCEPTION 'a created leak should only match the leaks automation, got %', ids;
+  END IF;
+
+  v := app.eval_automation_values(ev, '{"subject":"CAST(concat(''New: '', (d->>''title'')) AS text)"}');
+  IF v->>'subject' <> 'New: Leak' THEN
+    RAISE EXCEPTION 'unexpected values %', v;
+  END IF;
+
+  -- An update leaving priority alone does not match the changed trigger
+  prev := app.row_to_json(ord);
+  PERFORM app.update_row(ord, '{"title":"Leak in hall B"}');
+  ev := app.emit_event(app.current_org(), 'row.updated', orders, ord, app.row_to_json(ord), prev);
+  IF EXISTS (SELECT 1 FROM app.match_automations(ev)) THEN
+    RAISE EXCEPTION 'an update without a priority change matched';
+  END IF;
+
+  -- LOW -> MEDIUM changes priority, but not to HIGH
+  prev := app.row_to_json(ord);
+  PERFORM app.update_row(ord, '{"priority":"MEDIUM"}');
+  ev := app.emit_event(app.current_org(), 'row.updated', orders, ord, app.row_to_json(ord), prev);
+  IF EXISTS (SELECT 1 FROM app.match_automations(ev)) THEN
+    RAISE EXCEPTION 'priority MEDIUM matched the HIGH trigger';
+  END IF;
+
+  -- MEDIUM -> HIGH does
+  prev := app.row_to_json(ord);
+  PERFORM app.update_row(ord, '{"priority":"HIGH"}');
+  ev := app.emit_event(app.current_org(), 'row.updated', orders, ord, app.row_to_json(ord), prev);
+  SELECT array_agg(id) INTO ids FROM app.match_automations(ev);
+  IF ids IS DISTINCT FROM ARRAY['00000000-0000-4000-8000-0000000000e1'::uuid] THEN
+    RAISE EXCEPTION 'priority HIGH should match escalate, got %', ids;
+  END IF;
+
+  -- Deleted rows match on the row before the change
+  prev := app.row_to_json(ord);
+  ev := app.emit_event(app.current_org(), 'row.deleted', orders, ord, NULL, prev);
+  SELECT array_agg(id) INTO ids FROM app.match_automations(ev);
+  IF ids IS DISTINCT FROM ARRAY['00000000-0000-4000-8000-0000000000e3'::uuid] THEN
+    RAISE EXCEPTION 'a deleted order should match archive, got %', ids;
+  END IF;
+
+  INSERT INTO app.automation_runs (org_id, automation_id, event_id, row_id, mode, status, depth)
+  VALUES (app.current_org(), '00000000-0000-4000-8000-0000000000e3', ev, ord, 'async', 'pending', 0),
+         (app.current_org(), '00000000-0000-4000-8000-0000000000e1', ev, ord, 'sync', 'pending', 0);
+  INSERT INTO app.outbound_emails (org_id, recipients, subject, body)
+  VALUES (app.current_org(), '{ops@example.com}', 'New: Leak', '');
+END$$;
+
+-- Another org sees none of it.
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000eb', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.automations) OR EXISTS (SELECT 1 FROM app.automation_runs)
+     OR EXISTS (SELECT 1 FROM app.outbound_emails) THEN
+    RAISE EXCEPTION 'automation data leaked across orgs';
+  END IF;
+END$$;
+
+-- The runner claims async runs only, without an org and once per lease;
+-- the mailer likewise claims emails.
+SELECT set_config('app.org_id', '', true);
+DO $$
+DECLARE
+  claimed int;
+  again   int;
+BEGIN
+  SELECT count(*) INTO claimed FROM app.claim_automation_runs(100, interval '1 minute');
+  IF claimed < 1 THEN
+    RAISE EXCEPTION 'the queued async run was not claimed';
+  END IF;
+  SELECT count(*) INTO again FROM app.claim_automation_runs(100, interval '1 minute');
+  IF again <> 0 THEN
+    RAISE EXCEPTION 'leased runs were claimed again';
+  END IF;
+  SELECT count(*) INTO claimed FROM app.claim_outbound_emails(100, interval '1 minute');
+  IF claimed < 1 THEN
+    RAISE EXCEPTION 'the queued email was not claimed';
+  END IF;
+  IF EXISTS (SELECT 1 FROM app.automation_runs) OR EXISTS (SELECT 1 FROM app.outbound_emails) THEN
+    RAISE EXCEPTION 'runs or emails are visible without an org outside the claim';
+  END IF;
+END$$;
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000ea', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.automation_runs WHERE mode = 'sync' AND attempts > 0) THEN
+    RAISE EXCEPTION 'a sync run was claimed';
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM app.automation_runs WHERE mode = 'async' AND attempts = 1) THEN
+    RAISE EXCEPTION 'the async run was not leased';
+  END IF;
+END$$;
+
+ROLLBACK;
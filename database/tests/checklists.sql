@@ -0,0 +1,97 @@
+-- Checklist checks (042): templates copied onto work orders, copies that
+-- outlive template edits, the required items left open, and the item
+-- constraints.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/checklists.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f4', 'checklist-probe', 'Checklist probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f4', true);
+
+DO $$
+DECLARE
+  org    uuid := app.current_org();
+  orders bigint;
+  wo     uuid;
+  tpl    uuid;
+  cl     uuid;
+  n      int;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Work Orders', 'probe-work-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'title', 'text');
+  wo := app.insert_row(orders, '{"title":"Boiler inspection"}');
+
+  INSERT INTO app.checklist_templates (org_id, name) VALUES (org, 'Boiler') RETURNING id INTO tpl;
+  INSERT INTO app.checklist_template_items (org_id, template_id, position, label, kind, required, min_value, max_value, follow_up)
+  VALUES (org, tpl, 1, 'Isolate supply', 'checkbox', true, NULL, NULL, false),
+         (org, tpl, 2, 'Flue temperature', 'reading', true, 120, 180, true),
+         (org, tpl, 3, 'Remarks', 'text', false, NULL, NULL, false);
+
+  -- A missing template copies nothing
+  IF app.copy_checklist(wo, gen_random_uuid(), NULL) IS NOT NULL THEN
+    RAISE EXCEPTION 'copied a template that does not exist';
+  END IF;
+
+  cl := app.copy_checklist(wo, tpl, NULL);
+  SELECT count(*) INTO n FROM app.checklist_items WHERE checklist_id = cl;
+  IF n <> 3 THEN RAISE EXCEPTION 'copied % items, expected 3', n; END IF;
+
+  -- Editing the template leaves the copy alone
+  DELETE FROM app.checklist_template_items WHERE template_id = tpl AND position = 3;
+  SELECT count(*) INTO n FROM app.checklist_items WHERE checklist_id = cl;
+  IF n <> 3 THEN RAISE EXCEPTION 'a template edit changed the copy to % items', n; END IF;
+
+  -- Required items not answered yet
+  n := app.work_order_checklist_open(wo);
+  IF n <> 2 THEN RAISE EXCEPTION '% required items open, expected 2', n; END IF;
+  UPDATE app.checklist_items SET result = 'done', completed_at = now() WHERE checklist_id = cl AND position = 1;
+  n := app.work_order_checklist_open(wo);
+  IF n <> 1 THEN RAISE EXCEPTION '% required items open after one answer, expected 1', n; END IF;
+
+  -- An answer comes with its time
+  BEGIN
+    UPDATE app.checklist_items SET result = 'pass' WHERE checklist_id = cl AND position = 2;
+    RAISE EXCEPTION 'stored an answer without completed_at';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Only readings have limits, and min is not above max
+  BEGIN
+    INSERT INTO app.checklist_template_items (org_id, template_id, position, label, kind, min_value)
+    VALUES (org, tpl, 10, 'Door closed', 'checkbox', 1);
+    RAISE EXCEPTION 'stored limits on a checkbox';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.checklist_template_items (org_id, template_id, position, label, kind, min_value, max_value)
+    VALUES (org, tpl, 11, 'Pressure', 'reading', 3, 1);
+    RAISE EXCEPTION 'stored a reading with min above max';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Template names are unique per org, whatever their case
+  BEGIN
+    INSERT INTO app.checklist_templates (org_id, name) VALUES (org, 'BOILER');
+    RAISE EXCEPTION 'stored a second template named boiler';
+  EXCEPTION WHEN unique_violation THEN
+    NULL;
+  END;
+
+  -- Deleting the template keeps the checklist; deleting the work order drops it
+  DELETE FROM app.checklist_templates WHERE id = tpl;
+  IF NOT EXISTS (SELECT 1 FROM app.checklists WHERE id = cl AND template_id IS NULL) THEN
+    RAISE EXCEPTION 'deleting the template dropped its copy';
+  END IF;
+  DELETE FROM app.rows WHERE id = wo;
+  IF EXISTS (SELECT 1 FROM app.checklists WHERE id = cl) THEN
+    RAISE EXCEPTION 'deleting the work order kept its checklist';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,133 @@
+-- Computed column checks (021): app.apply_computed evaluates formulas in
+-- column order over the row's values, values that do not evaluate read as
+-- NULL, and computed values are never written.
+--
+-- The expression_sql values are what internal/formula compiles the
+-- expressions to (see formula_test.go).
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/computed_columns.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000c7', 'computed-probe', 'Computed probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000c7', true);
+
+DO $$
+DECLARE
+  org   uuid := app.current_org();
+  items bigint;
+  data  jsonb;
+  r     uuid;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Items', 'probe-items') RETURNING id INTO items;
+  INSERT INTO app.columns (table_id, name, type) VALUES
+    (items, 'title', 'text'),
+    (items, 'status', 'text'),
+    (items, 'quantity', 'float'),
+    (items, 'unit_price', 'float'),
+    (items, 'due_date', 'date');
+
+  -- In column order, so total_with_tax builds on total
+  INSERT INTO app.columns (table_id, name, type, kind, expression, expression_sql) VALUES
+    (items, 'total', 'float', 'computed', 'quantity * unit_price',
+     'CAST(((d->>''quantity'')::float8 * (d->>''unit_price'')::float8) AS float8)'),
+    (items, 'total_with_tax', 'float', 'computed', 'round(total * 1.2, 2)',
+     'CAST(round(((d->>''total'')::float8 * (1.2::float8))::numeric, round((2::float8))::int)::float8 AS float8)'),
+    (items, 'overdue', 'bool', 'computed', 'due_date < today() AND status != ''COMPLETED''',
+     'CAST((((d->>''due_date'')::date < CURRENT_DATE) AND ((d->>''status'') <> ''COMPLETED'')) AS boolean)'),
+    (items, 'code', 'text', 'computed', '''WO-'' & title',
+     'CAST(concat(''WO-'', (d->>''title'')) AS text)'),
+    (items, 'due_next_week', 'date', 'computed', 'add_days(due_date, 7)',
+     'CAST(((d->>''due_date'')::date + round((7::float8))::int) AS date)');
+
+  -- Each type of result, and a formula over an earlier formula
+  data := app.apply_computed(items, jsonb_build_object(
+    'title', 'Pump', 'status', 'OPEN', 'quantity', 3, 'unit_price', 2.5,
+    'due_date', (CURRENT_DATE - 1)::text));
+  IF (data->>'total')::float8 IS DISTINCT FROM 7.5 THEN
+    RAISE EXCEPTION 'total = %, expected 7.5', data->'total';
+  END IF;
+  IF (data->>'total_with_tax')::float8 IS DISTINCT FROM 9 THEN
+    RAISE EXCEPTION 'total_with_tax = %, expected 9', data->'total_with_tax';
+  END IF;
+  IF data->'overdue' IS DISTINCT FROM 'true'::jsonb THEN
+    RAISE EXCEPTION 'overdue = %, expected true', data->'overdue';
+  END IF;
+  IF data->>'code' IS DISTINCT FROM 'WO-Pump' THEN
+    RAISE EXCEPTION 'code = %, expected WO-Pump', data->'code';
+  END IF;
+  IF (data->>'due_next_week')::date IS DISTINCT FROM CURRENT_DATE + 6 THEN
+    RAISE EXCEPTION 'due_next_week = %, expected %', data->'due_next_week', CURRENT_DATE + 6;
+  END IF;
+  IF data->>'title' IS DISTINCT FROM 'Pump' THEN
+    RAISE EXCEPTION 'stored values were not kept: %', data;
+  END IF;
+
+  -- Missing inputs give NULL, present as a key
+  data := app.apply_computed(items, '{"title":"Empty"}');
+  IF NOT data ? 'total' OR data->'total' <> 'null'::jsonb THEN
+    RAISE EXCEPTION 'total without inputs = %, expected null', data->'total';
+  END IF;
+  IF data->'overdue' <> 'null'::jsonb THEN
+    RAISE EXCEPTION 'overdue without inputs = %, expected null', data->'overdue';
+  END IF;
+  IF data->>'code' IS DISTINCT FROM 'WO-Empty' THEN
+    RAISE EXCEPTION 'code = %, expected WO-Empty', data->'code';
+  END IF;
+
+  -- A value that does not evaluate reads as NULL instead of failing
+  data := app.apply_computed(items, '{"quantity":1e308,"unit_price":1e308}');
+  IF data->'total' <> 'null'::jsonb THEN
+    RAISE EXCEPTION 'overflowing total = %, expected null', data->'total';
+  END IF;
+
+  -- Stored rows read with their computed values
+  r := app.insert_row(items, '{"title":"Valve","status":"COMPLETED","quantity":4,"unit_price":10}');
+  data := app.row_to_json(r);
+  IF (data->>'total')::float8 IS DISTINCT FROM 40 OR (data->>'total_with_tax')::float8 IS DISTINCT FROM 48 THEN
+    RAISE EXCEPTION 'row totals = %, %; expected 40, 48', data->'total', data->'total_with_tax';
+  END IF;
+  PERFORM app.update_row(r, '{"quantity":5}');
+  data := app.row_to_json(r);
+  IF (data->>'total')::float8 IS DISTINCT FROM 50 THEN
+    RAISE EXCEPTION 'total after update = %, expected 50', data->'total';
+  END IF;
+
+  -- Computed values are never written
+  BEGIN
+    PERFORM app.insert_row(items, '{"title":"Bad","total":1}');
+    RAISE EXCEPTION 'wrote a computed column on insert';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Computed column "total" cannot be written%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    PERFORM app.update_row(r, '{"total":1}');
+    RAISE EXCEPTION 'wrote a computed column on update';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Computed column "total" cannot be written%' THEN RAISE; END IF;
+  END;
+
+  -- Computed columns cannot be required, indexed or references
+  BEGIN
+    INSERT INTO app.columns (table_id, name, type, kind, expression, expression_sql, is_required)
+    VALUES (items, 'bad', 'float', 'computed', 'quantity', 'CAST((d->>''quantity'')::float8 AS float8)', true);
+    RAISE EXCEPTION 'stored a required computed column';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Search filters on computed values
+  IF NOT app.match_computed('7.5', '{"operation":"eq","value":"7.5"}') THEN
+    RAISE EXCEPTION 'eq did not match a number';
+  END IF;
+  IF NOT app.match_computed('"WO-Pump"', '{"operation":"cn","value":"pump"}') THEN
+    RAISE EXCEPTION 'cn did not match case-insensitively';
+  END IF;
+  IF app.match_computed('true', '{"operation":"eq","value":"false"}') THEN
+    RAISE EXCEPTION 'eq matched the wrong bool';
+  END IF;
+END$$;
+
+ROLLBACK;
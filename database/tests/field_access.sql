@@ -0,0 +1,97 @@
+-- Field-level access checks (030): hidden and masked values, read-only
+-- fields, and statements without a user.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/field_access.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000fa', 'field-probe', 'Field probe');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000f1', 'viewer@field-probe.test'),
+  ('00000000-0000-4000-8000-0000000000f2', 'member@field-probe.test'),
+  ('00000000-0000-4000-8000-0000000000f3', 'admin@field-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000fa', '00000000-0000-4000-8000-0000000000f1', 'Viewer'),
+  ('00000000-0000-4000-8000-0000000000fa', '00000000-0000-4000-8000-0000000000f2', 'Member'),
+  ('00000000-0000-4000-8000-0000000000fa', '00000000-0000-4000-8000-0000000000f3', 'Admin');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000fa', true);
+
+-- Customers: phone is masked below Member, hourly_rate hidden below Member
+-- and editable by Admins only.
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Customers', 'probe-customers')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type, read_role, edit_role, masked)
+  SELECT id, 'name', 'text', NULL::org_role, NULL::org_role, false FROM t
+  UNION ALL
+  SELECT id, 'phone', 'text', 'Member', NULL, true FROM t
+  UNION ALL
+  SELECT id, 'hourly_rate', 'float', 'Member', 'Admin', false FROM t
+  RETURNING table_id
+)
+SELECT set_config('field_test.table', (SELECT min(table_id)::text FROM c), true);
+SELECT set_config('field_test.row',
+  app.insert_row(current_setting('field_test.table')::bigint,
+                 '{"name":"Acme","phone":"+1 555 0100","hourly_rate":95}')::text, true);
+
+DO $$
+DECLARE
+  t    bigint := current_setting('field_test.table')::bigint;
+  r    uuid   := current_setting('field_test.row')::uuid;
+  data jsonb;
+BEGIN
+  -- Without a user nothing is restricted.
+  data := app.mask_fields(t, app.row_to_json(r));
+  IF data->>'phone' <> '+1 555 0100' OR (data->>'hourly_rate')::float <> 95 THEN
+    RAISE EXCEPTION 'statements without a user must see every field: %', data;
+  END IF;
+
+  -- Viewer: phone masked to its last four characters, hourly_rate omitted.
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000f1', true);
+  data := app.mask_fields(t, app.row_to_json(r));
+  IF data->>'phone' <> '•••••••0100' THEN
+    RAISE EXCEPTION 'viewer should see a masked phone, got %', data->'phone';
+  END IF;
+  IF data ? 'hourly_rate' THEN
+    RAISE EXCEPTION 'viewer must not see hourly_rate: %', data;
+  END IF;
+  IF data->>'name' <> 'Acme' THEN
+    RAISE EXCEPTION 'viewer should see unrestricted fields: %', data;
+  END IF;
+  BEGIN
+    PERFORM app.check_field_writes(t, '{"phone":"x"}');
+    RAISE EXCEPTION 'viewer wrote a masked field';
+  EXCEPTION WHEN insufficient_privilege THEN NULL;
+  END;
+
+  -- Member: sees both fields, may edit phone but not hourly_rate.
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000f2', true);
+  data := app.mask_fields(t, app.row_to_json(r));
+  IF data->>'phone' <> '+1 555 0100' OR NOT data ? 'hourly_rate' THEN
+    RAISE EXCEPTION 'member should see phone and hourly_rate: %', data;
+  END IF;
+  PERFORM app.check_field_writes(t, '{"name":"Acme Ltd","phone":"+1 555 0101"}');
+  BEGIN
+    PERFORM app.check_field_writes(t, '{"hourly_rate":120}');
+    RAISE EXCEPTION 'member wrote an Admin-only field';
+  EXCEPTION WHEN insufficient_privilege THEN NULL;
+  END;
+
+  -- Admin: edits everything.
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000f3', true);
+  PERFORM app.check_field_writes(t, '{"hourly_rate":120}');
+
+  -- Rules cannot reach past Admin.
+  BEGIN
+    UPDATE app.columns SET read_role = 'Owner' WHERE table_id = t AND name = 'phone';
+    RAISE EXCEPTION 'read_role Owner was accepted';
+  EXCEPTION WHEN check_violation THEN NULL;
+  END;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,83 @@
+-- File checks (043): content stored once per org, geotags, and links to
+-- rows removed with the row or the file.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/files.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f5', 'files-probe', 'Files probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f5', true);
+
+DO $$
+DECLARE
+  org    uuid := app.current_org();
+  sha    text := repeat('ab', 32);
+  orders bigint;
+  wo     uuid;
+  f      uuid;
+  n      int;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Work Orders', 'probe-work-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'title', 'text');
+  wo := app.insert_row(orders, '{"title":"Leaking valve"}');
+
+  INSERT INTO app.files (org_id, name, content_type, size, sha256, latitude, longitude)
+  VALUES (org, 'valve.jpg', 'image/jpeg', 1024, sha, 51.5, -0.125) RETURNING id INTO f;
+
+  -- The same content is stored once per org
+  BEGIN
+    INSERT INTO app.files (org_id, name, content_type, size, sha256) VALUES (org, 'copy.jpg', 'image/jpeg', 1024, sha);
+    RAISE EXCEPTION 'stored the same content twice';
+  EXCEPTION WHEN unique_violation THEN
+    NULL;
+  END;
+
+  -- A digest is 64 lower-case hex digits
+  BEGIN
+    INSERT INTO app.files (org_id, name, content_type, size, sha256) VALUES (org, 'x', 'text/plain', 1, 'ABC');
+    RAISE EXCEPTION 'stored a malformed sha256';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- A position has both coordinates, within range
+  BEGIN
+    INSERT INTO app.files (org_id, name, content_type, size, sha256, latitude) VALUES (org, 'x', 'image/jpeg', 1, repeat('cd', 32), 10);
+    RAISE EXCEPTION 'stored a latitude without a longitude';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.files (org_id, name, content_type, size, sha256, latitude, longitude) VALUES (org, 'x', 'image/jpeg', 1, repeat('cd', 32), 91, 0);
+    RAISE EXCEPTION 'stored a latitude out of range';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Linking twice keeps one link
+  INSERT INTO app.file_links (org_id, file_id, row_id) VALUES (org, f, wo);
+  INSERT INTO app.file_links (org_id, file_id, row_id) VALUES (org, f, wo) ON CONFLICT DO NOTHING;
+  SELECT count(*) INTO n FROM app.file_links WHERE file_id = f;
+  IF n <> 1 THEN RAISE EXCEPTION '% links, expected 1', n; END IF;
+
+  -- Deleting the row removes its links and keeps the file
+  DELETE FROM app.rows WHERE id = wo;
+  IF EXISTS (SELECT 1 FROM app.file_links WHERE file_id = f) THEN
+    RAISE EXCEPTION 'deleting the row kept its link';
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM app.files WHERE id = f) THEN
+    RAISE EXCEPTION 'deleting the row deleted the file';
+  END IF;
+
+  -- Deleting the file removes its links
+  wo := app.insert_row(orders, '{"title":"Second valve"}');
+  INSERT INTO app.file_links (org_id, file_id, row_id) VALUES (org, f, wo);
+  DELETE FROM app.files WHERE id = f;
+  IF EXISTS (SELECT 1 FROM app.file_links WHERE row_id = wo) THEN
+    RAISE EXCEPTION 'deleting the file kept its link';
+  END IF;
+END$$;
+
+ROLLBACK;
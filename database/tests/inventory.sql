@@ -0,0 +1,189 @@
+-- Inventory checks (039): movements applied to stock levels, stock never
+-- below zero, lot expiry and serial numbers kept consistent, receipts
+-- counted against orders, issues fulfilling reservations, the ledger being
+-- append-only, and the stock sums of the low-stock report.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/inventory.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f1', 'inventory-probe', 'Inventory probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f1', true);
+
+DO $$
+DECLARE
+  org     uuid := app.current_org();
+  parts   bigint;
+  bins    bigint;
+  orders  bigint;
+  filter  uuid;
+  bearing uuid;
+  shelf   uuid;
+  van     uuid;
+  wo      uuid;
+  po      uuid;
+  res     uuid;
+  q       numeric;
+  s       record;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Parts', 'probe-parts') RETURNING id INTO parts;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Bins', 'probe-bins') RETURNING id INTO bins;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Work Orders', 'probe-work-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type, is_required) VALUES (parts, 'name', 'text', true);
+  INSERT INTO app.columns (table_id, name, type) VALUES (parts, 'reorder_point', 'float'), (parts, 'non_stock', 'bool');
+  INSERT INTO app.columns (table_id, name, type) VALUES (bins, 'name', 'text');
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type, enum_values)
+  VALUES (orders, 'status', 'enum', ARRAY['OPEN','COMPLETED','CANCELLED']);
+
+  filter  := app.insert_row(parts, '{"name":"Oil filter","reorder_point":10}');
+  bearing := app.insert_row(parts, '{"name":"Main bearing"}');
+  shelf   := app.insert_row(bins, '{"name":"Shelf A"}');
+  van     := app.insert_row(bins, '{"name":"Van 3"}');
+  wo      := app.insert_row(orders, '{"title":"Gearbox service","status":"OPEN"}');
+
+  -- Receipts, issues and transfers move the levels
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, lot, expires_on)
+  VALUES (org, filter, 'receive', 8, shelf, 'L1', DATE '2027-01-31');
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, to_bin_id, lot)
+  VALUES (org, filter, 'transfer', 3, shelf, van, 'L1');
+  SELECT quantity, expires_on INTO s FROM app.stock_levels WHERE part_id = filter AND bin_id = van AND lot = 'L1';
+  IF s.quantity <> 3 OR s.expires_on IS DISTINCT FROM DATE '2027-01-31' THEN
+    RAISE EXCEPTION 'transfer left % expiring %, expected 3 expiring 2027-01-31', s.quantity, s.expires_on;
+  END IF;
+  SELECT quantity INTO q FROM app.stock_levels WHERE part_id = filter AND bin_id = shelf AND lot = 'L1';
+  IF q <> 5 THEN RAISE EXCEPTION 'shelf holds % after the transfer, expected 5', q; END IF;
+
+  -- Stock never goes below zero
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, lot)
+    VALUES (org, filter, 'issue', 6, shelf, 'L1');
+    RAISE EXCEPTION 'issued more than the bin holds';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- A lot keeps one expiry
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, lot, expires_on)
+    VALUES (org, filter, 'receive', 1, van, 'L1', DATE '2027-06-30');
+    RAISE EXCEPTION 'lot L1 received with a second expiry';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Malformed movements are refused by constraints
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, to_bin_id)
+    VALUES (org, filter, 'transfer', 1, shelf, shelf);
+    RAISE EXCEPTION 'transfer within one bin accepted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id)
+    VALUES (org, filter, 'return', 1, shelf);
+    RAISE EXCEPTION 'return without a work order accepted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- A serial number is in stock in one bin at a time
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, serial)
+  VALUES (org, bearing, 'receive', 1, shelf, 'SN-1');
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, serial)
+    VALUES (org, bearing, 'receive', 1, van, 'SN-1');
+    RAISE EXCEPTION 'serial SN-1 in stock twice';
+  EXCEPTION WHEN unique_violation THEN
+    NULL;
+  END;
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, to_bin_id, serial)
+  VALUES (org, bearing, 'transfer', 1, shelf, van, 'SN-1');
+
+  -- Receipts count towards their order until it is received
+  INSERT INTO app.part_orders (org_id, part_id, quantity) VALUES (org, filter, 10) RETURNING id INTO po;
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, order_id)
+  VALUES (org, filter, 'receive', 4, shelf, po);
+  SELECT * INTO s FROM app.part_stock(ARRAY[filter]);
+  IF s.on_hand <> 12 OR s.on_order <> 6 THEN
+    RAISE EXCEPTION 'filter stock on hand %, on order %, expected 12 and 6', s.on_hand, s.on_order;
+  END IF;
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, order_id)
+  VALUES (org, filter, 'receive', 6, shelf, po);
+  IF (SELECT status FROM app.part_orders WHERE id = po) <> 'received' THEN
+    RAISE EXCEPTION 'order not received in full';
+  END IF;
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, order_id)
+    VALUES (org, filter, 'receive', 1, shelf, po);
+    RAISE EXCEPTION 'received against a closed order';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Issues to a work order fulfil its reservations; closed work orders hold nothing
+  INSERT INTO app.stock_reservations (org_id, part_id, work_order_id, quantity)
+  VALUES (org, filter, wo, 5) RETURNING id INTO res;
+  IF (SELECT reserved FROM app.part_stock(ARRAY[filter])) <> 5 THEN
+    RAISE EXCEPTION 'reservation not counted';
+  END IF;
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, work_order_id)
+  VALUES (org, filter, 'issue', 2, shelf, wo);
+  SELECT issued, status INTO s FROM app.stock_reservations WHERE id = res;
+  IF s.issued <> 2 OR s.status <> 'active' THEN
+    RAISE EXCEPTION 'reservation after issuing 2: issued %, %', s.issued, s.status;
+  END IF;
+  IF (SELECT reserved FROM app.part_stock(ARRAY[filter])) <> 3 THEN
+    RAISE EXCEPTION 'what was issued is still reserved';
+  END IF;
+  PERFORM app.update_row(wo, '{"status":"COMPLETED"}');
+  IF app.work_order_open(wo) OR (SELECT reserved FROM app.part_stock(ARRAY[filter])) <> 0 THEN
+    RAISE EXCEPTION 'a completed work order still reserves stock';
+  END IF;
+
+  -- The ledger is append-only
+  BEGIN
+    UPDATE app.stock_movements SET quantity = 100 WHERE part_id = filter;
+    RAISE EXCEPTION 'a movement was changed';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    DELETE FROM app.stock_movements WHERE part_id = filter;
+    RAISE EXCEPTION 'a movement was deleted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Parts and bins with movements cannot be deleted
+  BEGIN
+    DELETE FROM app.rows WHERE id = shelf;
+    RAISE EXCEPTION 'a bin with movements was deleted';
+  EXCEPTION WHEN foreign_key_violation THEN
+    NULL;
+  END;
+
+  -- Cell helpers read either engine
+  IF app.cell_float(filter, (SELECT id FROM app.columns WHERE table_id = parts AND name = 'reorder_point')) <> 10 THEN
+    RAISE EXCEPTION 'reorder point not read';
+  END IF;
+  PERFORM app.ensure_physical_table(parts);
+  PERFORM app.cut_over_relational(parts);
+  IF app.cell_float(filter, (SELECT id FROM app.columns WHERE table_id = parts AND name = 'reorder_point')) <> 10 THEN
+    RAISE EXCEPTION 'reorder point not read from the physical table';
+  END IF;
+END$$;
+
+-- Deleting the org removes its ledger with it
+DELETE FROM organisations WHERE id = '00000000-0000-4000-8000-0000000000f1';
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.stock_movements WHERE org_id = '00000000-0000-4000-8000-0000000000f1') THEN
+    RAISE EXCEPTION 'movements outlived their org';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,112 @@
+-- Labour checks (041): one running timer per user, no overlapping entries,
+-- the hourly rate captured per entry, and the labour totals of a work
+-- order.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/labour.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f3', 'labour-probe', 'Labour probe');
+INSERT INTO users (id, email, name) VALUES
+  ('00000000-0000-4000-8000-0000000000a1', 'tech-a@labour.probe', 'Tech A'),
+  ('00000000-0000-4000-8000-0000000000a2', 'tech-b@labour.probe', 'Tech B'),
+  ('00000000-0000-4000-8000-0000000000a3', 'tech-c@labour.probe', 'Tech C');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f3', true);
+
+DO $$
+DECLARE
+  org    uuid := app.current_org();
+  a      uuid := '00000000-0000-4000-8000-0000000000a1';
+  b      uuid := '00000000-0000-4000-8000-0000000000a2';
+  c      uuid := '00000000-0000-4000-8000-0000000000a3';
+  teams  bigint;
+  orders bigint;
+  crew   uuid;
+  night  uuid;
+  wo     uuid;
+  other  uuid;
+  rate   numeric;
+  t      timestamptz := date_trunc('hour', now()) - interval '1 day';
+  hours  numeric;
+  cost   numeric;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Teams', 'probe-teams') RETURNING id INTO teams;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Work Orders', 'probe-work-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type) VALUES (teams, 'name', 'text'), (orders, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (orders, 'team', 'uuid', true, teams);
+
+  crew  := app.insert_row(teams, '{"name":"Crew"}');
+  night := app.insert_row(teams, '{"name":"Night shift"}');
+  wo    := app.insert_row(orders, jsonb_build_object('title', 'Pump service', 'team', crew));
+  other := app.insert_row(orders, '{"title":"Unrelated"}');
+  INSERT INTO app.team_members (org_id, team_id, user_id) VALUES (org, crew, b), (org, night, b), (org, night, c);
+  INSERT INTO app.labour_rates (org_id, user_id, hourly_rate) VALUES (org, a, 50);
+  INSERT INTO app.labour_rates (org_id, team_id, hourly_rate) VALUES (org, crew, 30), (org, night, 40);
+
+  -- The user's rate, else the work order's team's, else the highest of the user's teams
+  rate := app.labour_rate(a, wo);
+  IF rate <> 50 THEN RAISE EXCEPTION 'rate of a user with their own rate is %, expected 50', rate; END IF;
+  rate := app.labour_rate(b, wo);
+  IF rate <> 30 THEN RAISE EXCEPTION 'rate of a member of the work order team is %, expected 30', rate; END IF;
+  rate := app.labour_rate(b, other);
+  IF rate <> 40 THEN RAISE EXCEPTION 'rate of a user off the work order team is %, expected 40', rate; END IF;
+  rate := app.labour_rate(c, wo);
+  IF rate <> 40 THEN RAISE EXCEPTION 'rate of a non-member of the work order team is %, expected 40', rate; END IF;
+
+  -- Entries capture the rate when created
+  INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, ended_at)
+  VALUES (org, wo, a, 'manual', t, t + interval '2 hours'),
+         (org, wo, b, 'manual', t, t + interval '90 minutes');
+  UPDATE app.labour_rates SET hourly_rate = 80 WHERE user_id = a;
+  IF (SELECT hourly_rate FROM app.time_entries WHERE user_id = a) <> 50 THEN
+    RAISE EXCEPTION 'a rate change repriced an existing entry';
+  END IF;
+
+  -- Entries of a user never overlap; those of different users may
+  BEGIN
+    INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, ended_at)
+    VALUES (org, other, a, 'manual', t + interval '1 hour', t + interval '3 hours');
+    RAISE EXCEPTION 'stored an entry overlapping another of the user';
+  EXCEPTION WHEN exclusion_violation THEN
+    NULL;
+  END;
+  INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, ended_at)
+  VALUES (org, other, a, 'manual', t + interval '2 hours', t + interval '3 hours');
+
+  -- One running timer per user, which blocks entries after it starts
+  INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at)
+  VALUES (org, wo, c, 'timer', now() - interval '10 minutes');
+  BEGIN
+    INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at)
+    VALUES (org, other, c, 'timer', now() + interval '1 hour');
+    RAISE EXCEPTION 'started a second timer for the user';
+  EXCEPTION WHEN unique_violation OR exclusion_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at, ended_at)
+    VALUES (org, other, c, 'manual', now() - interval '5 minutes', now() - interval '1 minute');
+    RAISE EXCEPTION 'stored an entry overlapping a running timer';
+  EXCEPTION WHEN exclusion_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.time_entries (org_id, work_order_id, user_id, source, started_at)
+    VALUES (org, other, c, 'manual', now() - interval '1 day');
+    RAISE EXCEPTION 'stored a manual entry without an end';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Totals count finished entries only
+  SELECT l.hours, l.cost INTO hours, cost FROM app.work_order_labour(wo) l;
+  IF hours <> 3.5 THEN RAISE EXCEPTION 'labour hours %, expected 2 + 1.5 = 3.5', hours; END IF;
+  IF cost <> 145 THEN RAISE EXCEPTION 'labour cost %, expected 100 + 45 = 145', cost; END IF;
+  SELECT l.hours, l.cost INTO hours, cost FROM app.work_order_labour(other) l;
+  IF hours <> 1 OR cost <> 50 THEN RAISE EXCEPTION 'labour of the other work order is % h, %', hours, cost; END IF;
+END$$;
+
+ROLLBACK;
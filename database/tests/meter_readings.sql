@@ -0,0 +1,122 @@
+-- Meter reading checks (037): one reading per meter and instant, finite
+-- values, rule constraints, series buckets aligned on Mondays, alerts
+-- going with their rule, and org isolation.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/meter_readings.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000da', 'meter-probe', 'Meter probe'),
+  ('00000000-0000-4000-8000-0000000000db', 'meter-other', 'Meter other');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000da', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Meters', 'probe-meters')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'name', 'text' FROM t
+  RETURNING table_id
+)
+SELECT set_config('meter_test.meters', (SELECT table_id::text FROM c), true);
+
+DO $$
+DECLARE
+  meter uuid := app.insert_row(current_setting('meter_test.meters')::bigint, '{"name":"Gearbox hours"}');
+  rule  uuid;
+  rid   bigint;
+  n     int;
+  b     record;
+BEGIN
+  PERFORM set_config('meter_test.meter', meter::text, true);
+
+  -- Monday 2026-10-12 and the Sunday and Monday after
+  INSERT INTO app.meter_readings (org_id, meter_id, value, read_at) VALUES
+    (app.current_org(), meter, 100, TIMESTAMPTZ '2026-10-12 06:00:00+00'),
+    (app.current_org(), meter, 140, TIMESTAMPTZ '2026-10-18 23:00:00+00'),
+    (app.current_org(), meter, 150, TIMESTAMPTZ '2026-10-19 01:00:00+00');
+  INSERT INTO app.meter_readings (org_id, meter_id, value, read_at)
+  VALUES (app.current_org(), meter, 999, TIMESTAMPTZ '2026-10-12 06:00:00+00')
+  ON CONFLICT DO NOTHING;
+  SELECT count(*) INTO n FROM app.meter_readings WHERE meter_id = meter;
+  IF n <> 3 THEN
+    RAISE EXCEPTION 'a reading at the same instant was stored twice: % rows', n;
+  END IF;
+
+  BEGIN
+    INSERT INTO app.meter_readings (org_id, meter_id, value, read_at)
+    VALUES (app.current_org(), meter, 'NaN', now());
+    RAISE EXCEPTION 'a NaN reading was accepted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Weekly buckets as MeterReadingSeries computes them
+  n := 0;
+  FOR b IN
+    SELECT date_bin(interval '7 days', r.read_at, TIMESTAMPTZ '2001-01-01 00:00:00+00') AS bucket,
+           min(r.value) AS lo, max(r.value) AS hi, count(*) AS readings
+    FROM app.meter_readings r
+    WHERE r.meter_id = meter
+    GROUP BY 1 ORDER BY 1
+  LOOP
+    n := n + 1;
+    IF extract(isodow FROM b.bucket AT TIME ZONE 'UTC') <> 1 OR (b.bucket AT TIME ZONE 'UTC')::time <> '00:00' THEN
+      RAISE EXCEPTION 'weekly bucket % does not start on a Monday at midnight UTC', b.bucket;
+    END IF;
+    IF n = 1 AND (b.lo, b.hi, b.readings) IS DISTINCT FROM (100::float8, 140::float8, 2::bigint) THEN
+      RAISE EXCEPTION 'first week should hold 100..140 in 2 readings, got %..% in %', b.lo, b.hi, b.readings;
+    END IF;
+  END LOOP;
+  IF n <> 2 THEN
+    RAISE EXCEPTION 'expected 2 weekly buckets, got %', n;
+  END IF;
+
+  BEGIN
+    INSERT INTO app.meter_rules (org_id, meter_id, name, kind, value, action)
+    VALUES (app.current_org(), meter, 'Jump', 'delta', 0, 'flag_work_orders');
+    RAISE EXCEPTION 'a delta rule of 0 was accepted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  INSERT INTO app.meter_rules (org_id, meter_id, name, kind, value, action)
+  VALUES (app.current_org(), meter, 'Service due', 'above', 120, 'create_work_order')
+  RETURNING id INTO rule;
+  BEGIN
+    INSERT INTO app.meter_rules (org_id, meter_id, name, kind, value, action)
+    VALUES (app.current_org(), meter, 'Service due', 'below', 10, 'flag_work_orders');
+    RAISE EXCEPTION 'two rules of a meter share a name';
+  EXCEPTION WHEN unique_violation THEN
+    NULL;
+  END;
+
+  SELECT id INTO rid FROM app.meter_readings WHERE meter_id = meter AND value = 140;
+  INSERT INTO app.meter_alerts (org_id, rule_id, meter_id, reading_id, value, previous, action)
+  VALUES (app.current_org(), rule, meter, rid, 140, 100, 'create_work_order');
+  DELETE FROM app.meter_rules WHERE id = rule;
+  IF EXISTS (SELECT 1 FROM app.meter_alerts WHERE meter_id = meter) THEN
+    RAISE EXCEPTION 'deleting a rule should delete its alerts';
+  END IF;
+END$$;
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000db', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.meter_readings) OR EXISTS (SELECT 1 FROM app.meter_rules) THEN
+    RAISE EXCEPTION 'another org''s readings or rules are visible';
+  END IF;
+  BEGIN
+    INSERT INTO app.meter_readings (org_id, meter_id, value, read_at)
+    VALUES ('00000000-0000-4000-8000-0000000000da', current_setting('meter_test.meter')::uuid, 1, now());
+    RAISE EXCEPTION 'a reading was stored for another org';
+  EXCEPTION WHEN insufficient_privilege THEN
+    NULL;
+  END;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,95 @@
+-- PM scheduler checks (036): one recorded occurrence per date or reading,
+-- occurrences outliving their deleted work orders, claiming the scans of
+-- every org, and org isolation of occurrences and scans.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/pm_scheduler.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000ca', 'pm-probe', 'PM probe'),
+  ('00000000-0000-4000-8000-0000000000cb', 'pm-other', 'PM other');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000ca', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Schedules', 'probe-schedules'),
+         (app.current_org(), 'Probe Orders', 'probe-orders')
+  RETURNING id, slug
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'title', 'text' FROM t
+  RETURNING table_id
+)
+SELECT set_config('pm_test.schedules', (SELECT id::text FROM t WHERE slug = 'probe-schedules'), true),
+       set_config('pm_test.orders', (SELECT id::text FROM t WHERE slug = 'probe-orders'), true),
+       (SELECT count(*) FROM c);
+
+DO $$
+DECLARE
+  pm uuid := app.insert_row(current_setting('pm_test.schedules')::bigint, '{"title":"Grease bearings"}');
+  wo uuid := app.insert_row(current_setting('pm_test.orders')::bigint, '{"title":"Grease bearings"}');
+  n  int;
+BEGIN
+  INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_on, work_order_id, status)
+  VALUES (app.current_org(), pm, 'calendar', DATE '2026-11-02', wo, 'created');
+  INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_on, status)
+  VALUES (app.current_org(), pm, 'calendar', DATE '2026-11-02', 'skipped')
+  ON CONFLICT DO NOTHING;
+  INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_reading, status, note)
+  VALUES (app.current_org(), pm, 'meter', 500, 'skipped', 'still open');
+  INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_reading, status)
+  VALUES (app.current_org(), pm, 'meter', 500, 'created')
+  ON CONFLICT DO NOTHING;
+  SELECT count(*) INTO n FROM app.pm_occurrences WHERE pm_id = pm;
+  IF n <> 2 THEN
+    RAISE EXCEPTION 'an occurrence was recorded twice: % rows', n;
+  END IF;
+
+  BEGIN
+    INSERT INTO app.pm_occurrences (org_id, pm_id, trigger, due_on, due_reading, status)
+    VALUES (app.current_org(), pm, 'meter', DATE '2026-11-02', 750, 'created');
+    RAISE EXCEPTION 'a meter occurrence with a date was accepted';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  DELETE FROM app.rows WHERE id = wo;
+  IF NOT EXISTS (SELECT 1 FROM app.pm_occurrences WHERE pm_id = pm AND trigger = 'calendar' AND work_order_id IS NULL) THEN
+    RAISE EXCEPTION 'deleting the work order should keep its occurrence';
+  END IF;
+END$$;
+
+-- The scans of every org are claimed, once per lease.
+SELECT set_config('app.org_id', '', true);
+DO $$
+DECLARE
+  orgs uuid[];
+BEGIN
+  SELECT array_agg(org_id) INTO orgs FROM app.claim_pm_scans(100000, interval '10 minutes');
+  IF NOT orgs @> ARRAY['00000000-0000-4000-8000-0000000000ca'::uuid, '00000000-0000-4000-8000-0000000000cb'::uuid] THEN
+    RAISE EXCEPTION 'the scans of both probe orgs should be claimed, got %', orgs;
+  END IF;
+  SELECT array_agg(org_id) INTO orgs FROM app.claim_pm_scans(100000, interval '10 minutes');
+  IF orgs && ARRAY['00000000-0000-4000-8000-0000000000ca'::uuid, '00000000-0000-4000-8000-0000000000cb'::uuid] THEN
+    RAISE EXCEPTION 'leased scans were claimed again';
+  END IF;
+  IF EXISTS (SELECT 1 FROM app.pm_scans) OR EXISTS (SELECT 1 FROM app.pm_occurrences) THEN
+    RAISE EXCEPTION 'scans or occurrences are visible without an org outside the claim';
+  END IF;
+END$$;
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000cb', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.pm_occurrences) THEN
+    RAISE EXCEPTION 'another org''s occurrences are visible';
+  END IF;
+  IF (SELECT count(*) FROM app.pm_scans) <> 1 THEN
+    RAISE EXCEPTION 'an org should see its own scan only';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,150 @@
+-- Parity checks for the relational storage engine (027): a table migrated
+-- from EAV returns the same rows, search results, labels and rollups, and
+-- keeps enforcing its constraints.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/relational_storage.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000c1', 'storage-probe', 'Storage probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000c1', true);
+
+DO $$
+DECLARE
+  assets  bigint;
+  orders  bigint;
+  pump    uuid;
+  fan     uuid;
+  wo      uuid;
+  before  jsonb;
+  after   jsonb;
+  search  jsonb := '{"filterFields":[{"field":"status","operation":"eq","value":"OPEN"}],"sortField":"hours","sortDirection":"desc"}';
+  n       bigint;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Assets', 'probe-assets') RETURNING id INTO assets;
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders') RETURNING id INTO orders;
+
+  INSERT INTO app.columns (table_id, name, type, is_required, is_indexed) VALUES (assets, 'title', 'text', true, true);
+  INSERT INTO app.columns (table_id, name, type, enum_values) VALUES (orders, 'status', 'enum', ARRAY['OPEN', 'DONE']);
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'hours', 'float');
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'due', 'date');
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (orders, 'asset', 'uuid', true, assets);
+  INSERT INTO app.columns (table_id, name, type, kind, rollup_via_column_id, rollup_aggregate)
+  SELECT assets, 'order_count', 'float', 'rollup', c.id, 'count'
+  FROM app.columns c WHERE c.table_id = orders AND c.name = 'asset';
+
+  pump := app.insert_row(assets, '{"title":"Pump"}');
+  fan  := app.insert_row(assets, '{"title":"Fan"}');
+  PERFORM app.insert_row(orders, jsonb_build_object('status', 'OPEN', 'hours', 2.5, 'due', '2030-01-31', 'asset', pump));
+  PERFORM app.insert_row(orders, jsonb_build_object('status', 'DONE', 'hours', 1, 'asset', pump));
+  PERFORM app.insert_row(orders, jsonb_build_object('status', 'OPEN', 'hours', 4));
+  BEGIN
+    PERFORM app.update_row(pump, '{"title":null}');
+    RAISE EXCEPTION 'required column cleared in EAV';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Required column "title" cannot be null%' THEN RAISE; END IF;
+  END;
+
+  -- Dual: rows written before and after the physical table exists both arrive.
+  PERFORM app.ensure_physical_table(orders);
+  PERFORM app.insert_row(orders, jsonb_build_object('status', 'OPEN', 'hours', 3, 'asset', fan));
+  SELECT jsonb_agg(app.row_to_json(r.id) ORDER BY r.id) INTO before FROM app.rows r WHERE r.table_id IN (assets, orders);
+  n := app.backfill_physical_table(orders, 2);
+  IF n <> 2 THEN RAISE EXCEPTION 'backfill copied % rows, expected 2', n; END IF;
+  n := app.backfill_physical_table(orders, NULL);
+  IF n <> 1 THEN RAISE EXCEPTION 'backfill copied % rows, expected 1', n; END IF;
+  SELECT count(*) INTO n FROM app.physical_table_drift(orders, NULL);
+  IF n <> 0 THEN RAISE EXCEPTION '% rows drifted after backfill', n; END IF;
+
+  -- Relational: same JSON for every row, EAV emptied.
+  PERFORM app.cut_over_relational(orders);
+  PERFORM app.ensure_physical_table(assets);
+  PERFORM app.cut_over_relational(assets);  -- cut-over alone resyncs unbackfilled rows
+  SELECT jsonb_agg(app.row_to_json(r.id) ORDER BY r.id) INTO after FROM app.rows r WHERE r.table_id IN (assets, orders);
+  IF after IS DISTINCT FROM before THEN
+    RAISE EXCEPTION 'row_to_json changed after cut-over: % vs %', before, after;
+  END IF;
+  SELECT count(*) INTO n FROM app.values_enum v JOIN app.rows r ON r.id = v.row_id WHERE r.table_id = orders;
+  IF n <> 0 THEN RAISE EXCEPTION 'EAV values left after cut-over'; END IF;
+
+  -- Search filters, sorts and counts like EAV.
+  SELECT jsonb_agg(s.data->'hours' ORDER BY s.ord), min(s.total_count)
+  INTO after, n
+  FROM app.search_relational(orders, search) WITH ORDINALITY AS s(row_id, created_at, data, total_count, ord);
+  IF after <> '[4, 3, 2.5]'::jsonb OR n <> 3 THEN
+    RAISE EXCEPTION 'unexpected search result % (total %)', after, n;
+  END IF;
+
+  -- Labels and rollups read through the physical tables.
+  IF app.cell_text(pump, (SELECT id FROM app.columns WHERE table_id = assets AND name = 'title')) <> 'Pump' THEN
+    RAISE EXCEPTION 'label not read from physical table';
+  END IF;
+  IF (app.row_to_json(pump)->>'order_count')::int <> 2 THEN
+    RAISE EXCEPTION 'rollup after cut-over: %', app.row_to_json(pump);
+  END IF;
+  wo := app.insert_row(orders, jsonb_build_object('status', 'OPEN', 'asset', pump));
+  IF (app.row_to_json(pump)->>'order_count')::int <> 3 THEN
+    RAISE EXCEPTION 'rollup not refreshed by a relational insert';
+  END IF;
+  PERFORM app.update_row(wo, jsonb_build_object('asset', fan));
+  IF (app.row_to_json(pump)->>'order_count')::int <> 2 OR (app.row_to_json(fan)->>'order_count')::int <> 2 THEN
+    RAISE EXCEPTION 'rollup not refreshed by a relational update';
+  END IF;
+
+  -- Constraints still hold.
+  BEGIN
+    PERFORM app.insert_row(orders, '{"status":"LOST"}');
+    RAISE EXCEPTION 'enum value outside the list accepted';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Enum value%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    PERFORM app.insert_row(assets, '{}');
+    RAISE EXCEPTION 'missing required column accepted';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Missing required columns%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    PERFORM app.update_row(pump, '{"title":null}');
+    RAISE EXCEPTION 'required column cleared';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Required column "title" cannot be null%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    PERFORM app.insert_row(orders, jsonb_build_object('asset', wo));
+    RAISE EXCEPTION 'reference to the wrong table accepted';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'UUID reference must target%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    DELETE FROM app.rows WHERE id = fan;
+    RAISE EXCEPTION 'referenced row deleted';
+  EXCEPTION WHEN foreign_key_violation THEN
+    NULL;
+  END;
+
+  -- Columns follow app.columns.
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'notes', 'text');
+  PERFORM app.update_row(wo, '{"notes":"late"}');
+  IF app.row_to_json(wo)->>'notes' <> 'late' THEN RAISE EXCEPTION 'added column not writable'; END IF;
+  DELETE FROM app.columns WHERE table_id = orders AND name = 'notes';
+  IF app.row_to_json(wo) ? 'notes' THEN RAISE EXCEPTION 'removed column still read'; END IF;
+
+  -- Reverting restores EAV with the same values.
+  SELECT jsonb_agg(app.row_to_json(r.id) ORDER BY r.id) INTO before FROM app.rows r WHERE r.table_id = orders;
+  PERFORM app.revert_relational(orders);
+  PERFORM app.drop_physical_table(orders);
+  SELECT jsonb_agg(app.row_to_json(r.id) ORDER BY r.id) INTO after FROM app.rows r WHERE r.table_id = orders;
+  IF after IS DISTINCT FROM before THEN
+    RAISE EXCEPTION 'row_to_json changed after revert: % vs %', before, after;
+  END IF;
+
+  RAISE NOTICE 'relational_storage: all checks passed';
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,84 @@
+-- Request portal checks (044): portals are found by key only while enabled,
+-- tokens find their request across orgs and go with it.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/request_portal.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f6', 'portal-probe', 'Portal probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f6', true);
+
+DO $$
+DECLARE
+  org      uuid := app.current_org();
+  key      text := 'probe-portal-key-0001';
+  hash     text := repeat('cd', 32);
+  requests bigint;
+  req      uuid;
+  found    uuid;
+  n        int;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Requests', 'probe-requests') RETURNING id INTO requests;
+  INSERT INTO app.columns (table_id, name, type) VALUES (requests, 'title', 'text');
+  req := app.insert_row(requests, '{"title":"Broken window"}');
+
+  -- A disabled portal is not found by its key
+  INSERT INTO app.request_portals (org_id, key) VALUES (org, key);
+  IF app.request_portal_org(key) IS NOT NULL THEN
+    RAISE EXCEPTION 'found a disabled portal';
+  END IF;
+  UPDATE app.request_portals SET enabled = true WHERE org_id = org;
+  found := app.request_portal_org(key);
+  IF found IS DISTINCT FROM org THEN
+    RAISE EXCEPTION 'portal key found org %, expected %', found, org;
+  END IF;
+  IF app.request_portal_org('probe-portal-key-0002') IS NOT NULL THEN
+    RAISE EXCEPTION 'found a portal by an unknown key';
+  END IF;
+
+  -- The lookup leaves no cross-org access behind
+  IF current_setting('app.portal_lookup', true) = 'on' THEN
+    RAISE EXCEPTION 'the portal lookup left app.portal_lookup on';
+  END IF;
+
+  -- Keys are at least 16 URL-safe characters
+  BEGIN
+    UPDATE app.request_portals SET key = 'short' WHERE org_id = org;
+    RAISE EXCEPTION 'accepted a short key';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    UPDATE app.request_portals SET key = 'has spaces in the key' WHERE org_id = org;
+    RAISE EXCEPTION 'accepted a key with spaces';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- A token finds its request
+  INSERT INTO app.request_tokens (token_hash, org_id, row_id) VALUES (hash, org, req);
+  SELECT t.row_id INTO found FROM app.request_token_row(hash) t WHERE t.org_id = org;
+  IF found IS DISTINCT FROM req THEN
+    RAISE EXCEPTION 'token found row %, expected %', found, req;
+  END IF;
+  SELECT count(*) INTO n FROM app.request_token_row(repeat('ef', 32));
+  IF n <> 0 THEN RAISE EXCEPTION 'an unknown token found % rows', n; END IF;
+
+  -- Only the SHA-256 of a token is kept
+  BEGIN
+    INSERT INTO app.request_tokens (token_hash, org_id, row_id) VALUES ('plain-token', org, req);
+    RAISE EXCEPTION 'stored a token that is not a digest';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Deleting the request removes its token
+  DELETE FROM app.rows WHERE id = req;
+  IF EXISTS (SELECT 1 FROM app.request_tokens WHERE token_hash = hash) THEN
+    RAISE EXCEPTION 'deleting the request kept its token';
+  END IF;
+END$$;
+
+ROLLBACK;
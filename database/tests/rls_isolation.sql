@@ -0,0 +1,135 @@
+-- Org isolation checks for the row level security policies (025) and the
+-- org_id carried by app.rows (026).
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/rls_isolation.sql
+
+BEGIN;
+
+-- Superusers and BYPASSRLS roles skip policies, so the checks run as a plain role.
+CREATE ROLE rls_probe NOLOGIN NOSUPERUSER NOBYPASSRLS;
+GRANT USAGE ON SCHEMA app TO rls_probe;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA app TO rls_probe;
+GRANT USAGE ON ALL SEQUENCES IN SCHEMA app TO rls_probe;
+GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA app TO rls_probe;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-00000000000a', 'rls-probe-a', 'RLS probe A'),
+  ('00000000-0000-4000-8000-00000000000b', 'rls-probe-b', 'RLS probe B');
+
+SET LOCAL ROLE rls_probe;
+
+-- Org A: an assets table with one row.
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-00000000000a', true);
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Assets', 'probe-assets')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type, is_indexed)
+  SELECT id, 'name', 'text', true FROM t
+  RETURNING table_id
+)
+SELECT set_config('rls_test.table_a', (SELECT table_id::text FROM c), true);
+SELECT set_config('rls_test.row_a',
+  app.insert_row(current_setting('rls_test.table_a')::bigint, '{"name":"Probe pump"}')::text, true);
+
+-- Org B: a work orders table with a reference column that accepts any table
+-- and a plain uuid column.
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-00000000000b', true);
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Work Orders', 'probe-work-orders')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type, is_reference)
+  SELECT id, 'asset', 'uuid', true FROM t
+  UNION ALL
+  SELECT id, 'related', 'uuid', false FROM t
+  RETURNING table_id
+)
+SELECT set_config('rls_test.table_b', (SELECT min(table_id)::text FROM c), true);
+
+DO $$
+DECLARE
+  row_a   uuid   := current_setting('rls_test.row_a')::uuid;
+  row_b   uuid;
+  table_a bigint := current_setting('rls_test.table_a')::bigint;
+  table_b bigint := current_setting('rls_test.table_b')::bigint;
+  n       bigint;
+  data    jsonb;
+BEGIN
+  -- Org A sees its own row.
+  PERFORM set_config('app.org_id', '00000000-0000-4000-8000-00000000000a', true);
+  SELECT count(*) INTO n FROM app.rows WHERE id = row_a;
+  IF n <> 1 THEN RAISE EXCEPTION 'org A cannot read its own row'; END IF;
+
+  -- Org B cannot read org A's table, columns, row or values...
+  PERFORM set_config('app.org_id', '00000000-0000-4000-8000-00000000000b', true);
+  SELECT count(*) INTO n FROM app.tables WHERE id = table_a;
+  IF n <> 0 THEN RAISE EXCEPTION 'cross-org table visible'; END IF;
+  SELECT count(*) INTO n FROM app.columns WHERE table_id = table_a;
+  IF n <> 0 THEN RAISE EXCEPTION 'cross-org columns visible'; END IF;
+  SELECT count(*) INTO n FROM app.rows WHERE id = row_a;
+  IF n <> 0 THEN RAISE EXCEPTION 'cross-org row readable'; END IF;
+  SELECT count(*) INTO n FROM app.values_text WHERE row_id = row_a;
+  IF n <> 0 THEN RAISE EXCEPTION 'cross-org values readable'; END IF;
+  data := app.row_to_json(row_a);
+  IF data ? 'name' THEN RAISE EXCEPTION 'cross-org row_to_json leaked %', data; END IF;
+
+  -- ...so it cannot be labelled (labels come from text/enum values)...
+  SELECT count(*) INTO n
+  FROM app.values_text vt JOIN app.columns c ON c.id = vt.column_id
+  WHERE vt.row_id = row_a AND c.type IN ('text', 'enum');
+  IF n <> 0 THEN RAISE EXCEPTION 'cross-org row can be labelled'; END IF;
+
+  -- ...or referenced from org B's rows.
+  BEGIN
+    PERFORM app.insert_row(table_b, jsonb_build_object('asset', row_a));
+    RAISE EXCEPTION 'cross-org reference accepted';
+  EXCEPTION WHEN foreign_key_violation THEN
+    NULL;
+  END;
+
+  -- A plain uuid column cannot point at another org's row either.
+  BEGIN
+    PERFORM app.insert_row(table_b, jsonb_build_object('related', row_a));
+    RAISE EXCEPTION 'cross-org uuid value accepted';
+  EXCEPTION WHEN foreign_key_violation THEN
+    NULL;
+  END;
+
+  -- Org B cannot add rows to org A's table...
+  BEGIN
+    INSERT INTO app.rows (table_id) VALUES (table_a);
+    RAISE EXCEPTION 'cross-org row insert accepted';
+  EXCEPTION WHEN insufficient_privilege THEN
+    NULL;
+  END;
+
+  -- ...nor label its own row with org A.
+  BEGIN
+    INSERT INTO app.rows (table_id, org_id)
+    VALUES (table_b, '00000000-0000-4000-8000-00000000000a');
+    RAISE EXCEPTION 'row with a foreign org_id accepted';
+  EXCEPTION WHEN insufficient_privilege OR foreign_key_violation THEN
+    NULL;
+  END;
+
+  -- Rows take the org of their table.
+  row_b := app.insert_row(table_b, '{}');
+  SELECT count(*) INTO n
+  FROM app.rows
+  WHERE id = row_b
+    AND org_id = '00000000-0000-4000-8000-00000000000b';
+  IF n <> 1 THEN RAISE EXCEPTION 'insert_row did not set org_id'; END IF;
+
+  -- Without an org nothing is visible.
+  PERFORM set_config('app.org_id', '', true);
+  SELECT count(*) INTO n FROM app.tables WHERE id IN (table_a, table_b);
+  IF n <> 0 THEN RAISE EXCEPTION 'tables visible without app.org_id'; END IF;
+
+  RAISE NOTICE 'rls_isolation: all checks passed';
+END$$;
+
+ROLLBACK;
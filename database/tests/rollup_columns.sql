@@ -0,0 +1,175 @@
+-- Rollup column checks (022): each aggregate over a parent's children,
+-- filtered rollups, and refreshes when a child is written, moves to another
+-- parent or is deleted, once per statement.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/rollup_columns.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000c8', 'rollup-probe', 'Rollup probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000c8', true);
+
+DO $$
+DECLARE
+  org        uuid := app.current_org();
+  orders     bigint;
+  lines      bigint;
+  via        bigint;
+  amount     bigint;
+  shipped_on bigint;
+  sku        bigint;
+  urgent     bigint;
+  a          uuid;
+  b          uuid;
+  l1         uuid;
+  l2         uuid;
+  l3         uuid;
+  data       jsonb;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Orders', 'probe-orders') RETURNING id INTO orders;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Lines', 'probe-lines') RETURNING id INTO lines;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type) VALUES (lines, 'order', 'uuid') RETURNING id INTO via;
+  INSERT INTO app.columns (table_id, name, type) VALUES (lines, 'amount', 'float') RETURNING id INTO amount;
+  INSERT INTO app.columns (table_id, name, type) VALUES (lines, 'shipped_on', 'date') RETURNING id INTO shipped_on;
+  INSERT INTO app.columns (table_id, name, type) VALUES (lines, 'sku', 'text') RETURNING id INTO sku;
+  INSERT INTO app.columns (table_id, name, type) VALUES (lines, 'urgent', 'bool') RETURNING id INTO urgent;
+
+  INSERT INTO app.columns (table_id, name, type, kind, rollup_via_column_id, rollup_target_column_id, rollup_aggregate, rollup_filter) VALUES
+    (orders, 'line_count', 'float', 'rollup', via, NULL, 'count', NULL),
+    (orders, 'total', 'float', 'rollup', via, amount, 'sum', NULL),
+    (orders, 'smallest', 'float', 'rollup', via, amount, 'min', NULL),
+    (orders, 'last_shipped', 'date', 'rollup', via, shipped_on, 'max', NULL),
+    (orders, 'latest_sku', 'text', 'rollup', via, sku, 'latest', NULL),
+    (orders, 'any_urgent', 'bool', 'rollup', via, urgent, 'any', NULL),
+    (orders, 'all_urgent', 'bool', 'rollup', via, urgent, 'all', NULL),
+    (orders, 'urgent_total', 'float', 'rollup', via, amount, 'sum',
+     '[{"field":"urgent","operation":"eq","value":"true"}]');
+
+  a := app.insert_row(orders, '{"title":"A"}');
+  b := app.insert_row(orders, '{"title":"B"}');
+  PERFORM app.refresh_rollup_column(c.id) FROM app.columns c WHERE c.table_id = orders AND c.kind = 'rollup';
+
+  -- A parent without children
+  data := app.row_to_json(a);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 0 OR (data->>'total')::float8 IS DISTINCT FROM 0 THEN
+    RAISE EXCEPTION 'empty count, sum = %, %; expected 0, 0', data->'line_count', data->'total';
+  END IF;
+  IF data->'any_urgent' IS DISTINCT FROM 'false'::jsonb OR data->'all_urgent' IS DISTINCT FROM 'true'::jsonb THEN
+    RAISE EXCEPTION 'empty any, all = %, %; expected false, true', data->'any_urgent', data->'all_urgent';
+  END IF;
+  IF COALESCE(data->'latest_sku', 'null'::jsonb) <> 'null'::jsonb OR COALESCE(data->'smallest', 'null'::jsonb) <> 'null'::jsonb THEN
+    RAISE EXCEPTION 'empty latest, min = %, %; expected null', data->'latest_sku', data->'smallest';
+  END IF;
+
+  -- Each aggregate, refreshed as children are inserted
+  l1 := app.insert_row(lines, jsonb_build_object('order', a, 'amount', 10, 'shipped_on', '2026-03-01', 'sku', 'ZETA', 'urgent', true));
+  l2 := app.insert_row(lines, jsonb_build_object('order', a, 'amount', 5, 'shipped_on', '2026-05-01', 'sku', 'ALPHA', 'urgent', false));
+  l3 := app.insert_row(lines, jsonb_build_object('order', a, 'amount', 20, 'sku', 'MID', 'urgent', true));
+  IF current_setting('app.rollups_deferred', true) = 'on' THEN
+    RAISE EXCEPTION 'insert_row left rollups deferred';
+  END IF;
+  data := app.row_to_json(a);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 3 THEN
+    RAISE EXCEPTION 'count = %, expected 3', data->'line_count';
+  END IF;
+  IF (data->>'total')::float8 IS DISTINCT FROM 35 THEN
+    RAISE EXCEPTION 'sum = %, expected 35', data->'total';
+  END IF;
+  IF (data->>'smallest')::float8 IS DISTINCT FROM 5 THEN
+    RAISE EXCEPTION 'min = %, expected 5', data->'smallest';
+  END IF;
+  IF data->>'last_shipped' IS DISTINCT FROM '2026-05-01' THEN
+    RAISE EXCEPTION 'max = %, expected 2026-05-01', data->'last_shipped';
+  END IF;
+  IF data->'any_urgent' IS DISTINCT FROM 'true'::jsonb OR data->'all_urgent' IS DISTINCT FROM 'false'::jsonb THEN
+    RAISE EXCEPTION 'any, all = %, %; expected true, false', data->'any_urgent', data->'all_urgent';
+  END IF;
+
+  -- Filtered: only urgent lines
+  IF (data->>'urgent_total')::float8 IS DISTINCT FROM 30 THEN
+    RAISE EXCEPTION 'filtered sum = %, expected 30', data->'urgent_total';
+  END IF;
+
+  -- latest follows the children's creation, not the value
+  UPDATE app.rows SET created_at = now() - interval '3 days' WHERE id = l1;
+  UPDATE app.rows SET created_at = now() - interval '1 day' WHERE id = l2;
+  UPDATE app.rows SET created_at = now() - interval '2 days' WHERE id = l3;
+  PERFORM app.refresh_rollup_column(c.id) FROM app.columns c WHERE c.table_id = orders AND c.name = 'latest_sku';
+  data := app.row_to_json(a);
+  IF data->>'latest_sku' IS DISTINCT FROM 'ALPHA' THEN
+    RAISE EXCEPTION 'latest = %, expected ALPHA', data->'latest_sku';
+  END IF;
+
+  -- Updating a child's value
+  PERFORM app.update_row(l2, '{"amount":7,"urgent":true}');
+  data := app.row_to_json(a);
+  IF (data->>'total')::float8 IS DISTINCT FROM 37 OR (data->>'urgent_total')::float8 IS DISTINCT FROM 37 THEN
+    RAISE EXCEPTION 'after update sum, filtered sum = %, %; expected 37, 37', data->'total', data->'urgent_total';
+  END IF;
+  IF data->'all_urgent' IS DISTINCT FROM 'true'::jsonb THEN
+    RAISE EXCEPTION 'after update all = %, expected true', data->'all_urgent';
+  END IF;
+
+  -- Re-parenting refreshes the old parent and the new one
+  PERFORM app.update_row(l3, jsonb_build_object('order', b));
+  data := app.row_to_json(a);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 2 OR (data->>'total')::float8 IS DISTINCT FROM 17 THEN
+    RAISE EXCEPTION 'old parent count, sum = %, %; expected 2, 17', data->'line_count', data->'total';
+  END IF;
+  data := app.row_to_json(b);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 1 OR (data->>'total')::float8 IS DISTINCT FROM 20 THEN
+    RAISE EXCEPTION 'new parent count, sum = %, %; expected 1, 20', data->'line_count', data->'total';
+  END IF;
+
+  -- Clearing the reference
+  PERFORM app.update_row(l3, '{"order":null}');
+  data := app.row_to_json(b);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 0 THEN
+    RAISE EXCEPTION 'count after clearing = %, expected 0', data->'line_count';
+  END IF;
+
+  -- Rollups are derived and never written directly
+  BEGIN
+    PERFORM app.update_row(a, '{"total":1}');
+    RAISE EXCEPTION 'wrote a rollup column on update';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Rollup column "total" cannot be written%' THEN RAISE; END IF;
+  END;
+  BEGIN
+    PERFORM app.insert_row(orders, '{"title":"C","line_count":1}');
+    RAISE EXCEPTION 'wrote a rollup column on insert';
+  EXCEPTION WHEN raise_exception THEN
+    IF SQLERRM NOT LIKE 'Rollup column "line_count" cannot be written%' THEN RAISE; END IF;
+  END;
+
+  -- Deleting a child
+  DELETE FROM app.rows WHERE id = l1;
+  data := app.row_to_json(a);
+  IF (data->>'line_count')::float8 IS DISTINCT FROM 1 OR (data->>'total')::float8 IS DISTINCT FROM 7 THEN
+    RAISE EXCEPTION 'after delete count, sum = %, %; expected 1, 7', data->'line_count', data->'total';
+  END IF;
+  IF data->>'last_shipped' IS DISTINCT FROM '2026-05-01' OR data->>'latest_sku' IS DISTINCT FROM 'ALPHA' THEN
+    RAISE EXCEPTION 'after delete max, latest = %, %', data->'last_shipped', data->'latest_sku';
+  END IF;
+
+  -- A statement over many cells refreshes through the statement triggers
+  l1 := app.insert_row(lines, jsonb_build_object('order', b, 'amount', 1));
+  l3 := app.insert_row(lines, jsonb_build_object('order', b, 'amount', 2));
+  UPDATE app.values_float SET value = value * 10 WHERE column_id = amount;
+  IF (app.row_to_json(a)->>'total')::float8 IS DISTINCT FROM 70 THEN
+    RAISE EXCEPTION 'bulk update sum on A = %, expected 70', app.row_to_json(a)->'total';
+  END IF;
+  IF (app.row_to_json(b)->>'total')::float8 IS DISTINCT FROM 30 THEN
+    RAISE EXCEPTION 'bulk update sum on B = %, expected 30', app.row_to_json(b)->'total';
+  END IF;
+  UPDATE app.values_uuid SET value = a WHERE column_id = via AND value = b;
+  IF (app.row_to_json(a)->>'line_count')::float8 IS DISTINCT FROM 3 OR (app.row_to_json(b)->>'line_count')::float8 IS DISTINCT FROM 0 THEN
+    RAISE EXCEPTION 'bulk re-parent counts = %, %; expected 3, 0',
+      app.row_to_json(a)->'line_count', app.row_to_json(b)->'line_count';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,174 @@
+-- Row event stream checks (034): what app.stream_row_events returns to
+-- callers restricted by row policies and field access, reads after a
+-- position in (txid, id) order, events held back above the event horizon,
+-- and callers without read access.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/row_event_stream.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000da', 'stream-probe', 'Stream probe');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000d1', 'contractor@stream-probe.test'),
+  ('00000000-0000-4000-8000-0000000000d2', 'member@stream-probe.test'),
+  ('00000000-0000-4000-8000-0000000000d3', 'outsider@stream-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000da', '00000000-0000-4000-8000-0000000000d1', 'Viewer'),
+  ('00000000-0000-4000-8000-0000000000da', '00000000-0000-4000-8000-0000000000d2', 'Member');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000da', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'title', 'text' FROM t
+  UNION ALL
+  SELECT id, 'crew', 'text' FROM t
+  RETURNING table_id
+)
+SELECT set_config('stream_test.orders', (SELECT min(table_id)::text FROM c), true);
+
+INSERT INTO app.columns (table_id, name, type, read_role)
+VALUES (current_setting('stream_test.orders')::bigint, 'cost', 'float', 'Admin');
+
+-- Viewers only see the partner crew's orders.
+INSERT INTO app.row_policies (org_id, table_id, name, role, expression, expression_sql, refs)
+VALUES (app.current_org(), current_setting('stream_test.orders')::bigint, 'partner crew', 'Viewer',
+        'crew = ''partner''', 'COALESCE(((d->>''crew'') = ''partner''), FALSE)', '{crew}');
+
+DO $$
+DECLARE
+  orders  bigint := current_setting('stream_test.orders')::bigint;
+  partner uuid;
+  inhouse uuid;
+  prev    jsonb;
+  first   bigint;
+BEGIN
+  partner := app.insert_row(orders, '{"title":"Partner job","crew":"partner","cost":120}');
+  first := app.emit_event(app.current_org(), 'row.created', orders, partner, app.row_to_json(partner), NULL);
+  inhouse := app.insert_row(orders, '{"title":"In-house job","crew":"inhouse","cost":80}');
+  PERFORM app.emit_event(app.current_org(), 'row.created', orders, inhouse, app.row_to_json(inhouse), NULL);
+
+  -- The partner job moves in-house.
+  prev := app.row_to_json(partner);
+  PERFORM app.update_row(partner, '{"crew":"inhouse"}');
+  PERFORM app.emit_event(app.current_org(), 'row.updated', orders, partner, app.row_to_json(partner), prev);
+
+  prev := app.row_to_json(inhouse);
+  DELETE FROM app.rows WHERE id = inhouse;
+  PERFORM app.emit_event(app.current_org(), 'row.deleted', orders, inhouse, NULL, prev);
+
+  -- Events of this transaction stay above the horizon until it ends, so
+  -- they are moved below it to be read.
+  UPDATE app.events e SET txid = app.event_horizon() - 1 WHERE e.table_id = orders;
+  PERFORM set_config('stream_test.first', (first - 1)::text, true);
+  PERFORM set_config('stream_test.txid', (SELECT e.txid FROM app.events e WHERE e.id = first)::text, true);
+END$$;
+
+-- Without a user every event comes in full.
+DO $$
+DECLARE
+  orders bigint := current_setting('stream_test.orders')::bigint;
+  n      int;
+BEGIN
+  SELECT count(*) INTO n
+  FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, current_setting('stream_test.first')::bigint, 100) e
+  WHERE (e.data IS NOT NULL OR e.type = 'row.deleted') AND (e.previous IS NOT NULL OR e.type = 'row.created');
+  IF n <> 4 THEN
+    RAISE EXCEPTION 'expected 4 full events without a user, got %', n;
+  END IF;
+  SELECT count(*) INTO n FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, current_setting('stream_test.first')::bigint, 2);
+  IF n <> 2 THEN
+    RAISE EXCEPTION 'p_limit was not applied, got %', n;
+  END IF;
+END$$;
+
+-- The viewer sees the partner job created, then leaving their view, and
+-- the in-house deletion without its data.
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000d1', true);
+DO $$
+DECLARE
+  orders bigint := current_setting('stream_test.orders')::bigint;
+  evs    text[];
+  e      record;
+BEGIN
+  SELECT array_agg(x.type || ':' || (x.data IS NOT NULL)::text || ':' || (x.previous IS NOT NULL)::text ORDER BY x.id)
+  INTO evs
+  FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, current_setting('stream_test.first')::bigint, 100) x;
+  IF evs IS DISTINCT FROM ARRAY['row.created:true:false', 'row.updated:false:true', 'row.deleted:false:false'] THEN
+    RAISE EXCEPTION 'unexpected events for the viewer: %', evs;
+  END IF;
+  FOR e IN SELECT * FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, current_setting('stream_test.first')::bigint, 100) LOOP
+    IF e.data ? 'cost' OR e.previous ? 'cost' THEN
+      RAISE EXCEPTION 'a hidden field reached the viewer: %', e;
+    END IF;
+  END LOOP;
+END$$;
+
+-- The member is not restricted by the policy, but cost stays hidden.
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000d2', true);
+DO $$
+DECLARE
+  orders bigint := current_setting('stream_test.orders')::bigint;
+  ids    bigint[];
+  n      int;
+BEGIN
+  SELECT array_agg(e.id ORDER BY e.id) INTO ids
+  FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, current_setting('stream_test.first')::bigint, 100) e
+  WHERE NOT (COALESCE(e.data, '{}') ? 'cost') AND NOT (COALESCE(e.previous, '{}') ? 'cost');
+  IF cardinality(ids) <> 4 THEN
+    RAISE EXCEPTION 'expected 4 events without cost for the member, got %', ids;
+  END IF;
+  SELECT count(*) INTO n
+  FROM app.stream_row_events(orders, current_setting('stream_test.txid')::bigint, ids[2], 100);
+  IF n <> 2 THEN
+    RAISE EXCEPTION 'reading after the second event returned % events', n;
+  END IF;
+END$$;
+
+-- Someone outside the org gets nothing.
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000d3', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.stream_row_events(current_setting('stream_test.orders')::bigint, 0, 0, 100)) THEN
+    RAISE EXCEPTION 'a caller without read access got events';
+  END IF;
+END$$;
+
+-- Events are read in (txid, id) order: an event with a lower id written by
+-- a transaction with a higher txid comes after, and events at or above the
+-- horizon wait. Transactions can't be interleaved here, so the probe events
+-- are given their txids.
+RESET app.user_id;
+DO $$
+DECLARE
+  orders  bigint := current_setting('stream_test.orders')::bigint;
+  horizon bigint := app.event_horizon();
+  late    bigint;
+  early   bigint;
+  held    bigint;
+  got     bigint[];
+BEGIN
+  late := app.emit_event(app.current_org(), 'row.created', orders, gen_random_uuid(), '{}', NULL);
+  early := app.emit_event(app.current_org(), 'row.created', orders, gen_random_uuid(), '{}', NULL);
+  held := app.emit_event(app.current_org(), 'row.created', orders, gen_random_uuid(), '{}', NULL);
+  UPDATE app.events SET txid = horizon - 1 WHERE id = late;
+  UPDATE app.events SET txid = horizon - 2 WHERE id = early;
+  UPDATE app.events SET txid = horizon WHERE id = held;
+  SELECT array_agg(e.id ORDER BY e.txid, e.id) INTO got
+  FROM app.stream_row_events(orders, horizon - 2, 0, 100) e
+  WHERE e.id IN (late, early, held);
+  IF got IS DISTINCT FROM ARRAY[early, late] THEN
+    RAISE EXCEPTION 'expected % then % with % held back, got %', early, late, held, got;
+  END IF;
+  IF EXISTS (SELECT 1 FROM app.stream_row_events(orders, horizon - 2, early, 100) e WHERE e.id = early) THEN
+    RAISE EXCEPTION 'reading after an event returned it again';
+  END IF;
+END$$;
+
+ROLLBACK;
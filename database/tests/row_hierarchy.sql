@@ -0,0 +1,123 @@
+-- Row hierarchy checks (038): cycles refused on both engines, subtrees and
+-- ancestors walked through the parent column, cycles in existing data
+-- found before a hierarchy is declared, and "under" search filters.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/row_hierarchy.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000e1', 'hierarchy-probe', 'Hierarchy probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000e1', true);
+
+DO $$
+DECLARE
+  assets  bigint;
+  orders  bigint;
+  parent  bigint;
+  site    uuid;
+  wtg     uuid;
+  nacelle uuid;
+  gearbox uuid;
+  other   uuid;
+  ids     uuid[];
+  n       bigint;
+  under   jsonb;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Assets', 'probe-assets') RETURNING id INTO assets;
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type, is_required, is_indexed) VALUES (assets, 'name', 'text', true, true);
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (assets, 'parent_asset', 'uuid', true, assets) RETURNING id INTO parent;
+  INSERT INTO app.columns (table_id, name, type) VALUES (orders, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (orders, 'asset', 'uuid', true, assets);
+
+  site    := app.insert_row(assets, '{"name":"Site"}');
+  wtg     := app.insert_row(assets, jsonb_build_object('name', 'WTG 1', 'parent_asset', site));
+  nacelle := app.insert_row(assets, jsonb_build_object('name', 'Nacelle', 'parent_asset', wtg));
+  gearbox := app.insert_row(assets, jsonb_build_object('name', 'Gearbox', 'parent_asset', nacelle));
+  other   := app.insert_row(assets, '{"name":"Other site"}');
+
+  -- Without a hierarchy nothing stops a cycle, and it is found before declaring one
+  PERFORM app.update_row(site, jsonb_build_object('parent_asset', gearbox));
+  IF app.hierarchy_cycle(parent) IS NULL THEN
+    RAISE EXCEPTION 'a cycle through parent_asset was not found';
+  END IF;
+  PERFORM app.update_row(site, '{"parent_asset":null}');
+  IF app.hierarchy_cycle(parent) IS NOT NULL THEN
+    RAISE EXCEPTION 'a forest was reported as a cycle at %', app.hierarchy_cycle(parent);
+  END IF;
+  INSERT INTO app.hierarchies (table_id, org_id, column_id) VALUES (assets, app.current_org(), parent);
+
+  -- Subtrees and ancestors
+  SELECT array_agg(s.id ORDER BY s.depth) INTO ids FROM app.row_subtree(parent, wtg) s;
+  IF ids IS DISTINCT FROM ARRAY[wtg, nacelle, gearbox] THEN
+    RAISE EXCEPTION 'subtree of the WTG: %', ids;
+  END IF;
+  SELECT count(*) INTO n FROM app.row_subtree(parent, site, 1);
+  IF n <> 2 THEN RAISE EXCEPTION 'subtree of depth 1 has % rows, expected 2', n; END IF;
+  SELECT array_agg(a.id ORDER BY a.depth) INTO ids FROM app.row_ancestors(parent, gearbox) a;
+  IF ids IS DISTINCT FROM ARRAY[nacelle, wtg, site] THEN
+    RAISE EXCEPTION 'ancestors of the gearbox: %', ids;
+  END IF;
+
+  -- Cycles are refused, on EAV ...
+  BEGIN
+    PERFORM app.update_row(site, jsonb_build_object('parent_asset', gearbox));
+    RAISE EXCEPTION 'a row was placed under its own descendant';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    PERFORM app.update_row(wtg, jsonb_build_object('parent_asset', wtg));
+    RAISE EXCEPTION 'a row was made its own parent';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  PERFORM app.update_row(wtg, jsonb_build_object('parent_asset', other));
+
+  -- ... and on relational tables
+  PERFORM app.ensure_physical_table(assets);
+  PERFORM app.cut_over_relational(assets);
+  IF app.cell_uuid(nacelle, parent) IS DISTINCT FROM wtg THEN
+    RAISE EXCEPTION 'parent not read from the physical table';
+  END IF;
+  BEGIN
+    PERFORM app.update_row(other, jsonb_build_object('parent_asset', gearbox));
+    RAISE EXCEPTION 'a relational row was placed under its own descendant';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  SELECT array_agg(s.id ORDER BY s.depth) INTO ids FROM app.row_subtree(parent, other) s;
+  IF ids IS DISTINCT FROM ARRAY[other, wtg, nacelle, gearbox] THEN
+    RAISE EXCEPTION 'relational subtree after the move: %', ids;
+  END IF;
+
+  -- Work orders under the WTG: its own and those of its parts
+  PERFORM app.insert_row(orders, jsonb_build_object('title', 'Yaw check', 'asset', wtg));
+  PERFORM app.insert_row(orders, jsonb_build_object('title', 'Oil change', 'asset', gearbox));
+  PERFORM app.insert_row(orders, jsonb_build_object('title', 'Fence', 'asset', site));
+  under := jsonb_build_object('filterFields', jsonb_build_array(
+    jsonb_build_object('field', 'asset', 'operation', 'under', 'value', wtg)));
+  SELECT count(*) INTO n FROM app.rows r
+  WHERE r.table_id = orders
+    AND app.cell_uuid(r.id, (SELECT id FROM app.columns WHERE table_id = orders AND name = 'asset'))
+        IN (SELECT app.row_and_descendants(assets, wtg));
+  IF n <> 2 THEN RAISE EXCEPTION '% work orders under the WTG, expected 2', n; END IF;
+  PERFORM app.ensure_physical_table(orders);
+  PERFORM app.cut_over_relational(orders);
+  SELECT count(*) INTO n FROM app.search_relational(orders, under);
+  IF n <> 2 THEN RAISE EXCEPTION 'relational search under the WTG found % rows, expected 2', n; END IF;
+
+  -- Dropping the parent column drops the hierarchy
+  DELETE FROM app.columns WHERE id = parent;
+  IF EXISTS (SELECT 1 FROM app.hierarchies WHERE table_id = assets) THEN
+    RAISE EXCEPTION 'hierarchy outlived its column';
+  END IF;
+END$$;
+
+ROLLBACK;
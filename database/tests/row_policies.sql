@@ -0,0 +1,147 @@
+-- Row policy checks (031): team and creator policies, exempt roles,
+-- statements without a user, and rollups over restricted rows.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/row_policies.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000ea', 'policy-probe', 'Policy probe');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000e1', 'contractor@policy-probe.test'),
+  ('00000000-0000-4000-8000-0000000000e2', 'member@policy-probe.test'),
+  ('00000000-0000-4000-8000-0000000000e3', 'admin@policy-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000ea', '00000000-0000-4000-8000-0000000000e1', 'Viewer'),
+  ('00000000-0000-4000-8000-0000000000ea', '00000000-0000-4000-8000-0000000000e2', 'Member'),
+  ('00000000-0000-4000-8000-0000000000ea', '00000000-0000-4000-8000-0000000000e3', 'Admin');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000ea', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Teams', 'probe-teams')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'name', 'text' FROM t
+  RETURNING table_id
+)
+SELECT set_config('policy_test.teams', (SELECT min(table_id)::text FROM c), true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'title', 'text' FROM t
+  UNION ALL
+  SELECT id, 'team', 'uuid' FROM t
+  RETURNING table_id
+)
+SELECT set_config('policy_test.orders', (SELECT min(table_id)::text FROM c), true);
+
+SELECT set_config('policy_test.partner',
+  app.insert_row(current_setting('policy_test.teams')::bigint, '{"name":"Partner crew"}')::text, true);
+SELECT set_config('policy_test.inhouse',
+  app.insert_row(current_setting('policy_test.teams')::bigint, '{"name":"In-house"}')::text, true);
+
+INSERT INTO app.team_members (org_id, team_id, user_id) VALUES
+  (app.current_org(), current_setting('policy_test.partner')::uuid, '00000000-0000-4000-8000-0000000000e1');
+
+-- Orders: one for each team, one without a team created by the contractor.
+SELECT set_config('policy_test.partner_order',
+  app.insert_row(current_setting('policy_test.orders')::bigint,
+    jsonb_build_object('title', 'Partner job', 'team', current_setting('policy_test.partner')))::text, true);
+SELECT set_config('policy_test.inhouse_order',
+  app.insert_row(current_setting('policy_test.orders')::bigint,
+    jsonb_build_object('title', 'In-house job', 'team', current_setting('policy_test.inhouse')))::text, true);
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000e1', true);
+SELECT set_config('policy_test.own_order',
+  app.insert_row(current_setting('policy_test.orders')::bigint, '{"title":"Own request"}')::text, true);
+SELECT set_config('app.user_id', '', true);
+
+-- Viewers see their teams' orders and the ones they created, as compiled by
+-- formula.CompilePolicy.
+INSERT INTO app.row_policies (org_id, table_id, name, role, expression, expression_sql, refs)
+VALUES
+  (app.current_org(), current_setting('policy_test.orders')::bigint, 'own team', 'Viewer',
+   'team IN current_user.teams',
+   'COALESCE(((d->>''team'') = ANY(app.current_user_teams())), FALSE)', '{team}'),
+  (app.current_org(), current_setting('policy_test.orders')::bigint, 'own requests', 'Viewer',
+   'created_by = current_user',
+   'COALESCE(((r.created_by::text) = (app.current_user_id()::text)), FALSE)', '{}');
+
+DO $$
+DECLARE
+  orders  bigint := current_setting('policy_test.orders')::bigint;
+  partner uuid   := current_setting('policy_test.partner_order')::uuid;
+  inhouse uuid   := current_setting('policy_test.inhouse_order')::uuid;
+  own     uuid   := current_setting('policy_test.own_order')::uuid;
+  seen    uuid[];
+BEGIN
+  -- Without a user nothing is restricted.
+  IF app.rows_restricted(orders) OR (SELECT count(*) FROM app.visible_rows(orders)) <> 3 THEN
+    RAISE EXCEPTION 'statements without a user must see every row';
+  END IF;
+
+  -- Contractor: their team's order and their own request only.
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000e1', true);
+  seen := ARRAY(SELECT app.visible_rows(orders) ORDER BY 1);
+  IF NOT (seen @> ARRAY[partner, own] AND cardinality(seen) = 2) THEN
+    RAISE EXCEPTION 'contractor should see the partner order and their own request, got %', seen;
+  END IF;
+  IF app.row_visible(inhouse) THEN
+    RAISE EXCEPTION 'contractor can read the in-house order by id';
+  END IF;
+  IF (SELECT count(*) FROM app.visible_rows(orders, ARRAY[inhouse, partner])) <> 1 THEN
+    RAISE EXCEPTION 'visible_rows must honour the id list';
+  END IF;
+
+  -- Members are not named by the Viewer policies; Admins are exempt.
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000e2', true);
+  IF app.rows_restricted(orders) OR NOT app.row_visible(inhouse) THEN
+    RAISE EXCEPTION 'member should see every order';
+  END IF;
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000e3', true);
+  IF app.rows_restricted(orders) THEN
+    RAISE EXCEPTION 'admins must never be restricted';
+  END IF;
+
+  -- Policies stop at Member.
+  BEGIN
+    INSERT INTO app.row_policies (org_id, table_id, name, role, expression, expression_sql)
+    VALUES (app.current_org(), orders, 'admins', 'Admin', 'TRUE', 'TRUE');
+    RAISE EXCEPTION 'an Admin policy was accepted';
+  EXCEPTION WHEN check_violation THEN NULL;
+  END;
+END$$;
+
+-- A rollup counting orders per team is hidden from the restricted contractor.
+INSERT INTO app.columns (table_id, name, type, kind, rollup_via_column_id, rollup_aggregate)
+SELECT current_setting('policy_test.teams')::bigint, 'orders', 'float', 'rollup', c.id, 'count'
+FROM app.columns c
+WHERE c.table_id = current_setting('policy_test.orders')::bigint AND c.name = 'team';
+
+DO $$
+DECLARE
+  teams   bigint := current_setting('policy_test.teams')::bigint;
+  partner uuid   := current_setting('policy_test.partner')::uuid;
+  data    jsonb;
+BEGIN
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000e2', true);
+  data := app.mask_fields(teams, app.row_to_json(partner));
+  IF NOT data ? 'orders' THEN
+    RAISE EXCEPTION 'member should see the rollup: %', data;
+  END IF;
+
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000e1', true);
+  data := app.mask_fields(teams, app.row_to_json(partner));
+  IF data ? 'orders' THEN
+    RAISE EXCEPTION 'contractor must not see a rollup over restricted rows: %', data;
+  END IF;
+END$$;
+
+ROLLBACK;
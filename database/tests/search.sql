@@ -0,0 +1,173 @@
+-- Org search checks (023): SearchOrgRows ranks word matches above substring
+-- and fuzzy ones, groups hits per table, leaves out columns and rows the
+-- caller cannot read, and treats LIKE wildcards in the query literally.
+--
+-- The query is read from database/queries/search.sql, with its sqlc
+-- arguments as $1 (org_id), $2 (q) and $3 (per_table).
+--
+-- Run from the repository root against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/search.sql
+
+\set search_query `sed -e '/^ *--/d' -e 's/sqlc\.arg(org_id)/$1/g' -e 's/sqlc\.arg(q)/$2/g' -e 's/sqlc\.arg(per_table)/$3/g' -e 's/;$//' database/queries/search.sql`
+
+BEGIN;
+
+PREPARE search_org_rows(uuid, text, int) AS :search_query;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000c9', 'search-probe', 'Search probe');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000f1', 'admin@search-probe.test'),
+  ('00000000-0000-4000-8000-0000000000f2', 'viewer@search-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000c9', '00000000-0000-4000-8000-0000000000f1', 'Admin'),
+  ('00000000-0000-4000-8000-0000000000c9', '00000000-0000-4000-8000-0000000000f2', 'Viewer');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000c9', true);
+
+DO $$
+DECLARE
+  org    uuid := app.current_org();
+  assets bigint;
+  orders bigint;
+  notes  bigint;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Assets', 'probe-assets') RETURNING id INTO assets;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Orders', 'probe-orders') RETURNING id INTO orders;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Notes', 'probe-notes') RETURNING id INTO notes;
+  INSERT INTO app.columns (table_id, name, type) VALUES (assets, 'title', 'text'), (orders, 'title', 'text'), (notes, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type, read_role) VALUES (assets, 'serial', 'text', 'Admin');
+
+  -- Word matches, a substring-only match, and one matching on a column
+  -- only Admins read
+  PERFORM set_config('search_test.housing', app.insert_row(assets, '{"title":"Gearbox housing"}')::text, true);
+  PERFORM set_config('search_test.spares', app.insert_row(assets, '{"title":"Gearboxes spare kit"}')::text, true);
+  PERFORM set_config('search_test.unit', app.insert_row(assets, '{"title":"Megagearboxunit"}')::text, true);
+  PERFORM set_config('search_test.pump', app.insert_row(assets, '{"title":"Pump","serial":"GEARBOX-7781"}')::text, true);
+  PERFORM app.insert_row(assets, '{"title":"Conveyor belt"}');
+
+  -- Viewers only read the orders they created
+  PERFORM set_config('app.user_id', '00000000-0000-4000-8000-0000000000f2', true);
+  PERFORM set_config('search_test.own_order', app.insert_row(orders, '{"title":"Gearbox inspection"}')::text, true);
+  PERFORM set_config('app.user_id', '', true);
+  PERFORM app.insert_row(orders, '{"title":"Replace gearbox seal"}');
+  INSERT INTO app.row_policies (org_id, table_id, name, role, expression, expression_sql, refs)
+  VALUES (org, orders, 'own orders', 'Viewer', 'created_by = current_user',
+          'COALESCE(((r.created_by::text) = (app.current_user_id()::text)), FALSE)', '{}');
+
+  -- % in the query is not a wildcard
+  PERFORM set_config('search_test.torque', app.insert_row(notes, '{"title":"Torque 100%"}')::text, true);
+  PERFORM app.insert_row(notes, '{"title":"1000 rpm spindle motor"}');
+
+  PERFORM set_config('search_test.assets', assets::text, true);
+  PERFORM set_config('search_test.orders', orders::text, true);
+  PERFORM set_config('search_test.notes', notes::text, true);
+END$$;
+
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000f1', true);
+CREATE TEMP TABLE admin_hits ON COMMIT DROP AS
+  EXECUTE search_org_rows('00000000-0000-4000-8000-0000000000c9', 'gearbox', 5);
+CREATE TEMP TABLE admin_top ON COMMIT DROP AS
+  EXECUTE search_org_rows('00000000-0000-4000-8000-0000000000c9', 'gearbox', 1);
+CREATE TEMP TABLE percent_hits ON COMMIT DROP AS
+  EXECUTE search_org_rows('00000000-0000-4000-8000-0000000000c9', '100%', 5);
+
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000f2', true);
+CREATE TEMP TABLE viewer_hits ON COMMIT DROP AS
+  EXECUTE search_org_rows('00000000-0000-4000-8000-0000000000c9', 'gearbox', 5);
+SELECT set_config('app.user_id', '', true);
+
+DO $$
+DECLARE
+  assets  bigint := current_setting('search_test.assets')::bigint;
+  orders  bigint := current_setting('search_test.orders')::bigint;
+  housing uuid   := current_setting('search_test.housing')::uuid;
+  spares  uuid   := current_setting('search_test.spares')::uuid;
+  unit    uuid   := current_setting('search_test.unit')::uuid;
+  pump    uuid   := current_setting('search_test.pump')::uuid;
+  own     uuid   := current_setting('search_test.own_order')::uuid;
+  torque  uuid   := current_setting('search_test.torque')::uuid;
+  h       record;
+  seen    uuid[];
+  shown   text;
+BEGIN
+  -- Grouping: one group per table, totals count every matching row
+  IF (SELECT count(DISTINCT table_id) FROM admin_hits) <> 2 THEN
+    RAISE EXCEPTION 'admin hits span % tables, expected 2', (SELECT count(DISTINCT table_id) FROM admin_hits);
+  END IF;
+  IF (SELECT count(*) FROM admin_hits WHERE table_id = assets) <> 4
+     OR (SELECT DISTINCT table_total FROM admin_hits WHERE table_id = assets) <> 4 THEN
+    RAISE EXCEPTION 'admin asset hits = %, expected 4', ARRAY(SELECT row_id FROM admin_hits WHERE table_id = assets);
+  END IF;
+  IF (SELECT DISTINCT table_total FROM admin_hits WHERE table_id = orders) <> 2 THEN
+    RAISE EXCEPTION 'admin order total = %, expected 2', (SELECT DISTINCT table_total FROM admin_hits WHERE table_id = orders);
+  END IF;
+
+  -- Ranking: word matches (stemmed, so "Gearboxes" counts) above the
+  -- substring-only match
+  IF (SELECT rank FROM admin_hits WHERE row_id = unit) >= 1 THEN
+    RAISE EXCEPTION 'substring match ranked %, expected below 1', (SELECT rank FROM admin_hits WHERE row_id = unit);
+  END IF;
+  IF (SELECT min(rank) FROM admin_hits WHERE row_id IN (housing, spares)) <= (SELECT rank FROM admin_hits WHERE row_id = unit) THEN
+    RAISE EXCEPTION 'word matches must outrank the substring match';
+  END IF;
+
+  -- The hit on an Admin-only column is labelled with the title
+  SELECT * INTO h FROM admin_hits WHERE row_id = pump;
+  IF h.matched_column IS DISTINCT FROM 'serial' OR h.label IS DISTINCT FROM 'Pump' THEN
+    RAISE EXCEPTION 'pump hit = %, %; expected serial, Pump', h.matched_column, h.label;
+  END IF;
+  IF (SELECT snippet FROM admin_hits WHERE row_id = housing) NOT LIKE '%<mark>Gearbox</mark>%' THEN
+    RAISE EXCEPTION 'snippet = %', (SELECT snippet FROM admin_hits WHERE row_id = housing);
+  END IF;
+
+  -- Tables are ordered by their best hit, rows by rank within a table
+  IF EXISTS (
+    SELECT 1 FROM (
+      SELECT table_id, rank,
+             lag(table_id) OVER w AS prev_table, lag(rank) OVER w AS prev_rank
+      FROM (SELECT *, row_number() OVER () AS n FROM admin_hits) x
+      WINDOW w AS (ORDER BY n)
+    ) o
+    WHERE o.table_id = o.prev_table AND o.rank > o.prev_rank
+  ) THEN
+    RAISE EXCEPTION 'hits are not ordered by rank within their table';
+  END IF;
+
+  -- per_table limits the hits, not the totals
+  IF (SELECT count(*) FROM admin_top) <> 2 OR (SELECT table_total FROM admin_top WHERE table_id = assets) <> 4 THEN
+    RAISE EXCEPTION 'per_table 1: % hits, asset total %; expected 2, 4',
+      (SELECT count(*) FROM admin_top), (SELECT table_total FROM admin_top WHERE table_id = assets);
+  END IF;
+  IF (SELECT rank FROM admin_top WHERE table_id = assets) <> (SELECT max(rank) FROM admin_hits WHERE table_id = assets) THEN
+    RAISE EXCEPTION 'per_table 1 must keep the best asset hit';
+  END IF;
+
+  -- Viewers: no Admin-only column, only their own orders
+  seen := ARRAY(SELECT row_id FROM viewer_hits WHERE table_id = assets);
+  IF pump = ANY(seen) OR cardinality(seen) <> 3 THEN
+    RAISE EXCEPTION 'viewer asset hits = %, expected 3 without the pump', seen;
+  END IF;
+  seen := ARRAY(SELECT row_id FROM viewer_hits WHERE table_id = orders);
+  IF seen <> ARRAY[own] OR (SELECT DISTINCT table_total FROM viewer_hits WHERE table_id = orders) <> 1 THEN
+    RAISE EXCEPTION 'viewer order hits = %, expected only their own', seen;
+  END IF;
+
+  -- Wildcards match themselves
+  seen := ARRAY(SELECT row_id FROM percent_hits);
+  IF seen <> ARRAY[torque] THEN
+    RAISE EXCEPTION '"100%%" hits = %, expected only "Torque 100%%"', seen;
+  END IF;
+  IF 'a_c' NOT ILIKE app.like_contains('a_c') OR 'abc' ILIKE app.like_contains('a_c')
+     OR 'C:\tmp' NOT ILIKE app.like_contains('c:\t') THEN
+    RAISE EXCEPTION 'like_contains does not escape wildcards';
+  END IF;
+
+  -- Word-match snippets escape the value once, around the markers
+  shown := app.search_snippet('Seal kit & "gasket" for 2<3 gearboxes', 'gasket', plainto_tsquery('english', 'gasket'));
+  IF shown NOT LIKE '%&amp; &quot;<mark>gasket</mark>&quot; for 2&lt;3%' THEN
+    RAISE EXCEPTION 'word-match snippet = %', shown;
+  END IF;
+END$$;
+
+ROLLBACK;
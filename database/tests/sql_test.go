@@ -0,0 +1,43 @@
+// Package tests holds the SQL checks of the schema: one script per
+// feature, each raising on the first failed check and rolling everything
+// back at the end. TestSQL runs them with psql, as some use psql variables,
+// against the fully migrated database named by TEST_DATABASE_URL:
+//
+//	TEST_DATABASE_URL=postgres://... go test -count=1 ./database/tests
+//
+// Without it they are skipped.
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQL(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	psql, err := exec.LookPath("psql")
+	if err != nil {
+		t.Fatal("TEST_DATABASE_URL is set but psql is not installed")
+	}
+	scripts, err := filepath.Glob("*.sql")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no scripts: %v", err)
+	}
+	// Not in parallel: the scripts insert probe orgs and users with fixed ids
+	for _, script := range scripts {
+		t.Run(strings.TrimSuffix(script, ".sql"), func(t *testing.T) {
+			cmd := exec.Command(psql, url, "--no-psqlrc", "--quiet", "-v", "ON_ERROR_STOP=1", "-f", filepath.Join("database", "tests", script))
+			// Scripts read queries relative to the repository root
+			cmd.Dir = filepath.Join("..", "..")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+-- State machine checks (035): evaluating stamps and conditions with
+-- app.eval_row_exprs for the acting user, and org isolation of machines.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/state_machines.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000fa', 'states-probe', 'State machine probe'),
+  ('00000000-0000-4000-8000-0000000000fb', 'states-other', 'State machine other');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000f1', 'tech@states-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000fa', '00000000-0000-4000-8000-0000000000f1', 'Member');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000fa', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Orders', 'probe-orders')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type, enum_values)
+  SELECT id, 'status', 'enum', ARRAY['OPEN', 'COMPLETED'] FROM t
+  RETURNING table_id
+)
+SELECT set_config('states_test.orders', (SELECT min(table_id)::text FROM c), true);
+
+-- As compiled by workflow.Compile for the work_orders template.
+INSERT INTO app.state_machines (org_id, table_id, column_name, initial, transitions, states, refs)
+VALUES (app.current_org(), current_setting('states_test.orders')::bigint, 'status', '{OPEN}',
+        '[{"from":["OPEN"],"to":"COMPLETED"}]',
+        '{"COMPLETED":{"required":[{"field":"feedback","when":"required_signature","sql":"COALESCE((d->>''required_signature'')::boolean, FALSE)"}],"set":{"completed_on":"today()","completed_by":"current_user"},"sql":{"completed_on":"CAST(CURRENT_DATE AS date)","completed_by":"CAST((u::text) AS text)"}}}',
+        '{status,feedback,required_signature,completed_on,completed_by}');
+
+-- Stamps and conditions see the row after the change, the row before it
+-- and the acting user.
+SELECT set_config('app.user_id', '00000000-0000-4000-8000-0000000000f1', true);
+DO $$
+DECLARE
+  v jsonb;
+BEGIN
+  v := app.eval_row_exprs(
+    '{"status":"COMPLETED","required_signature":true}',
+    '{"status":"OPEN","required_signature":true}',
+    '{"by":"CAST((u::text) AS text)","on":"CAST(CURRENT_DATE AS date)","was":"(o->>''status'')","sig":"COALESCE((d->>''required_signature'')::boolean, FALSE)"}');
+  IF v->>'by' <> '00000000-0000-4000-8000-0000000000f1' OR (v->>'on')::date <> CURRENT_DATE
+     OR v->>'was' <> 'OPEN' OR v->'sig' <> 'true'::jsonb THEN
+    RAISE EXCEPTION 'unexpected values %', v;
+  END IF;
+
+  -- New rows have no previous data, and the system no user.
+  PERFORM set_config('app.user_id', '', true);
+  v := app.eval_row_exprs('{"status":"OPEN"}', NULL, '{"was":"(o->>''status'')","by":"CAST((u::text) AS text)"}');
+  IF v <> '{"was":null,"by":null}'::jsonb THEN
+    RAISE EXCEPTION 'unexpected values for a new row without a user: %', v;
+  END IF;
+
+  IF app.eval_row_exprs('{}', NULL, '{}') <> '{}'::jsonb THEN
+    RAISE EXCEPTION 'no expressions should give an empty object';
+  END IF;
+END$$;
+
+-- One machine per column, whatever its case.
+DO $$
+BEGIN
+  BEGIN
+    INSERT INTO app.state_machines (org_id, table_id, column_name, transitions)
+    VALUES (app.current_org(), current_setting('states_test.orders')::bigint, 'Status', '[]');
+    RAISE EXCEPTION 'a second machine for status was accepted';
+  EXCEPTION WHEN unique_violation THEN
+    NULL;
+  END;
+END$$;
+
+-- Another org sees none of it.
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000fb', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.state_machines) THEN
+    RAISE EXCEPTION 'state machines leaked across orgs';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,149 @@
+-- Table permission checks (029): role defaults, role, user and team grants,
+-- the union of several grants, revoking back to the defaults, and the Owner
+-- override.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/table_permissions.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000b1', 'rights-probe', 'Rights probe');
+INSERT INTO users (id, email) VALUES
+  ('00000000-0000-4000-8000-0000000000b2', 'owner@rights-probe.test'),
+  ('00000000-0000-4000-8000-0000000000b3', 'admin@rights-probe.test'),
+  ('00000000-0000-4000-8000-0000000000b4', 'member@rights-probe.test'),
+  ('00000000-0000-4000-8000-0000000000b5', 'viewer@rights-probe.test'),
+  ('00000000-0000-4000-8000-0000000000b6', 'crew@rights-probe.test'),
+  ('00000000-0000-4000-8000-0000000000b7', 'outsider@rights-probe.test');
+INSERT INTO org_memberships (org_id, user_id, role) VALUES
+  ('00000000-0000-4000-8000-0000000000b1', '00000000-0000-4000-8000-0000000000b2', 'Owner'),
+  ('00000000-0000-4000-8000-0000000000b1', '00000000-0000-4000-8000-0000000000b3', 'Admin'),
+  ('00000000-0000-4000-8000-0000000000b1', '00000000-0000-4000-8000-0000000000b4', 'Member'),
+  ('00000000-0000-4000-8000-0000000000b1', '00000000-0000-4000-8000-0000000000b5', 'Viewer'),
+  ('00000000-0000-4000-8000-0000000000b1', '00000000-0000-4000-8000-0000000000b6', 'Viewer');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000b1', true);
+
+-- Rights as one string (read, create, edit, delete, manage), e.g. 'rcedm',
+-- with '-' for each right not held; NULL for non-members.
+CREATE FUNCTION pg_temp.rights(p_table_id bigint, p_user_id uuid)
+RETURNS text LANGUAGE sql AS $$
+  SELECT CASE WHEN can_read   THEN 'r' ELSE '-' END
+      || CASE WHEN can_create THEN 'c' ELSE '-' END
+      || CASE WHEN can_edit   THEN 'e' ELSE '-' END
+      || CASE WHEN can_delete THEN 'd' ELSE '-' END
+      || CASE WHEN can_manage THEN 'm' ELSE '-' END
+  FROM app.table_rights(p_table_id, p_user_id);
+$$;
+
+DO $$
+DECLARE
+  org      uuid := app.current_org();
+  owner    uuid := '00000000-0000-4000-8000-0000000000b2';
+  admin    uuid := '00000000-0000-4000-8000-0000000000b3';
+  member   uuid := '00000000-0000-4000-8000-0000000000b4';
+  viewer   uuid := '00000000-0000-4000-8000-0000000000b5';
+  crew     uuid := '00000000-0000-4000-8000-0000000000b6';
+  outsider uuid := '00000000-0000-4000-8000-0000000000b7';
+  teams    bigint;
+  orders   bigint;
+  partner  uuid;
+  got      text;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Teams', 'probe-teams') RETURNING id INTO teams;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Probe Orders', 'probe-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type) VALUES (teams, 'name', 'text'), (orders, 'title', 'text');
+  partner := app.insert_row(teams, '{"name":"Partner crew"}');
+  INSERT INTO app.team_members (org_id, team_id, user_id) VALUES (org, partner, crew);
+
+  -- Role defaults on a table without grants
+  IF pg_temp.rights(orders, owner) <> 'rcedm' THEN
+    RAISE EXCEPTION 'default owner rights = %, expected rcedm', pg_temp.rights(orders, owner);
+  END IF;
+  IF pg_temp.rights(orders, admin) <> 'rcedm' THEN
+    RAISE EXCEPTION 'default admin rights = %, expected rcedm', pg_temp.rights(orders, admin);
+  END IF;
+  IF pg_temp.rights(orders, member) <> 'rced-' THEN
+    RAISE EXCEPTION 'default member rights = %, expected rced-', pg_temp.rights(orders, member);
+  END IF;
+  IF pg_temp.rights(orders, viewer) <> 'r----' THEN
+    RAISE EXCEPTION 'default viewer rights = %, expected r----', pg_temp.rights(orders, viewer);
+  END IF;
+  IF pg_temp.rights(orders, outsider) IS NOT NULL THEN
+    RAISE EXCEPTION 'non-member rights = %, expected no row', pg_temp.rights(orders, outsider);
+  END IF;
+
+  -- Any grant replaces the defaults: a role grant applies to that role and
+  -- higher, and any right implies read
+  INSERT INTO app.table_grants (org_id, table_id, role, can_edit) VALUES (org, orders, 'Member', true);
+  IF pg_temp.rights(orders, member) <> 'r-e--' THEN
+    RAISE EXCEPTION 'member grant rights = %, expected r-e--', pg_temp.rights(orders, member);
+  END IF;
+  IF pg_temp.rights(orders, admin) <> 'r-e--' THEN
+    RAISE EXCEPTION 'member grant on admin = %, expected r-e--', pg_temp.rights(orders, admin);
+  END IF;
+  IF pg_temp.rights(orders, viewer) <> '-----' THEN
+    RAISE EXCEPTION 'member grant on viewer = %, expected -----', pg_temp.rights(orders, viewer);
+  END IF;
+  IF pg_temp.rights(teams, viewer) <> 'r----' THEN
+    RAISE EXCEPTION 'grants leaked to another table: viewer on teams = %', pg_temp.rights(teams, viewer);
+  END IF;
+
+  -- The Owner holds every right whatever the grants say
+  IF pg_temp.rights(orders, owner) <> 'rcedm' THEN
+    RAISE EXCEPTION 'owner with grants = %, expected rcedm', pg_temp.rights(orders, owner);
+  END IF;
+
+  -- User and team grants, unioned with the role grant
+  INSERT INTO app.table_grants (org_id, table_id, user_id, can_read) VALUES (org, orders, viewer, true);
+  INSERT INTO app.table_grants (org_id, table_id, user_id, can_delete) VALUES (org, orders, member, true);
+  INSERT INTO app.table_grants (org_id, table_id, team_id, can_create) VALUES (org, orders, partner, true);
+  IF pg_temp.rights(orders, viewer) <> 'r----' THEN
+    RAISE EXCEPTION 'user grant rights = %, expected r----', pg_temp.rights(orders, viewer);
+  END IF;
+  IF pg_temp.rights(orders, member) <> 'r-ed-' THEN
+    RAISE EXCEPTION 'role and user grant rights = %, expected r-ed-', pg_temp.rights(orders, member);
+  END IF;
+  IF pg_temp.rights(orders, crew) <> 'rc---' THEN
+    RAISE EXCEPTION 'team grant rights = %, expected rc---', pg_temp.rights(orders, crew);
+  END IF;
+  IF pg_temp.rights(orders, outsider) IS NOT NULL THEN
+    RAISE EXCEPTION 'grants reached a non-member: %', pg_temp.rights(orders, outsider);
+  END IF;
+
+  -- Leaving the team revokes its grant
+  DELETE FROM app.team_members WHERE team_id = partner AND user_id = crew;
+  IF pg_temp.rights(orders, crew) <> '-----' THEN
+    RAISE EXCEPTION 'rights after leaving the team = %, expected -----', pg_temp.rights(orders, crew);
+  END IF;
+
+  -- Revoking one grant keeps the others
+  DELETE FROM app.table_grants WHERE table_id = orders AND user_id = member;
+  IF pg_temp.rights(orders, member) <> 'r-e--' THEN
+    RAISE EXCEPTION 'rights after revoking the user grant = %, expected r-e--', pg_temp.rights(orders, member);
+  END IF;
+
+  -- Revoking every grant restores the role defaults
+  DELETE FROM app.table_grants WHERE table_id = orders;
+  got := pg_temp.rights(orders, admin) || ' ' || pg_temp.rights(orders, member) || ' ' || pg_temp.rights(orders, viewer);
+  IF got <> 'rcedm rced- r----' THEN
+    RAISE EXCEPTION 'rights after revoking all = %, expected rcedm rced- r----', got;
+  END IF;
+
+  -- Grants name exactly one principal, and teams must be rows of the org
+  BEGIN
+    INSERT INTO app.table_grants (org_id, table_id, role, user_id, can_read) VALUES (org, orders, 'Viewer', viewer, true);
+    RAISE EXCEPTION 'stored a grant with two principals';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.table_grants (org_id, table_id, team_id, can_read) VALUES (org, orders, gen_random_uuid(), true);
+    RAISE EXCEPTION 'stored a grant for an unknown team';
+  EXCEPTION WHEN foreign_key_violation THEN
+    NULL;
+  END;
+END$$;
+
+ROLLBACK;
@@ -0,0 +1,116 @@
+-- Webhook outbox checks (032): event fan-out by type, table and filter,
+-- claiming across orgs, and org isolation of deliveries.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/webhooks.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000fa', 'hook-probe', 'Hook probe'),
+  ('00000000-0000-4000-8000-0000000000fb', 'hook-other', 'Hook other');
+
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000fa', true);
+
+WITH t AS (
+  INSERT INTO app.tables (org_id, name, slug)
+  VALUES (app.current_org(), 'Probe Jobs', 'probe-jobs')
+  RETURNING id
+), c AS (
+  INSERT INTO app.columns (table_id, name, type)
+  SELECT id, 'status', 'text' FROM t
+  RETURNING table_id
+)
+SELECT set_config('hook_test.jobs', (SELECT min(table_id)::text FROM c), true);
+
+-- Every event; row updates of jobs that just got completed, as compiled by
+-- formula.CompileEventFilter; and an inactive one.
+INSERT INTO app.webhooks (id, org_id, name, url, secret, events, table_id, filter_expression, filter_sql, filter_refs, active)
+VALUES
+  ('00000000-0000-4000-8000-0000000000f1', app.current_org(), 'all', 'http://127.0.0.1:9000/', 'whsec_a',
+   '{}', NULL, NULL, NULL, '{}', true),
+  ('00000000-0000-4000-8000-0000000000f2', app.current_org(), 'completed', 'http://127.0.0.1:9000/', 'whsec_b',
+   '{row.updated}', current_setting('hook_test.jobs')::bigint,
+   'status = ''COMPLETED'' AND coalesce(old.status, ''OPEN'') != ''COMPLETED''',
+   'COALESCE((((d->>''status'') = ''COMPLETED'') AND (COALESCE((o->>''status''), ''OPEN'') <> ''COMPLETED'')), FALSE)',
+   '{status}', true),
+  ('00000000-0000-4000-8000-0000000000f3', app.current_org(), 'off', 'http://127.0.0.1:9000/', 'whsec_c',
+   '{}', NULL, NULL, NULL, '{}', false);
+
+DO $$
+DECLARE
+  jobs  bigint := current_setting('hook_test.jobs')::bigint;
+  job   uuid;
+  ev    bigint;
+  prev  jsonb;
+  n     int;
+  p     jsonb;
+BEGIN
+  job := app.insert_row(jobs, '{"status":"OPEN"}');
+  ev := app.emit_event(app.current_org(), 'row.created', jobs, job, app.row_to_json(job), NULL);
+  SELECT count(*) INTO n FROM app.webhook_deliveries WHERE event_id = ev;
+  IF n <> 1 OR NOT EXISTS (SELECT 1 FROM app.webhook_deliveries
+                           WHERE event_id = ev AND webhook_id = '00000000-0000-4000-8000-0000000000f1') THEN
+    RAISE EXCEPTION 'row.created should only reach the catch-all webhook, got % deliveries', n;
+  END IF;
+  SELECT payload INTO p FROM app.events WHERE id = ev;
+  IF p->>'id' <> ev::text OR p->'table'->>'slug' <> 'probe-jobs' OR p->'data'->>'status' <> 'OPEN'
+     OR NOT p ? 'previous' THEN
+    RAISE EXCEPTION 'unexpected payload %', p;
+  END IF;
+
+  -- OPEN -> IN_PROGRESS does not match the filter
+  prev := app.row_to_json(job);
+  PERFORM app.update_row(job, '{"status":"IN_PROGRESS"}');
+  ev := app.emit_event(app.current_org(), 'row.updated', jobs, job, app.row_to_json(job), prev);
+  IF EXISTS (SELECT 1 FROM app.webhook_deliveries
+             WHERE event_id = ev AND webhook_id = '00000000-0000-4000-8000-0000000000f2') THEN
+    RAISE EXCEPTION 'filter matched a job that was not completed';
+  END IF;
+
+  -- IN_PROGRESS -> COMPLETED does
+  prev := app.row_to_json(job);
+  PERFORM app.update_row(job, '{"status":"COMPLETED"}');
+  ev := app.emit_event(app.current_org(), 'row.updated', jobs, job, app.row_to_json(job), prev);
+  IF NOT EXISTS (SELECT 1 FROM app.webhook_deliveries
+                 WHERE event_id = ev AND webhook_id = '00000000-0000-4000-8000-0000000000f2') THEN
+    RAISE EXCEPTION 'filter missed the completed job';
+  END IF;
+
+  -- Inactive webhooks get nothing
+  IF EXISTS (SELECT 1 FROM app.webhook_deliveries WHERE webhook_id = '00000000-0000-4000-8000-0000000000f3') THEN
+    RAISE EXCEPTION 'inactive webhook received a delivery';
+  END IF;
+END$$;
+
+-- Another org sees none of it.
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000fb', true);
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM app.webhook_deliveries) OR EXISTS (SELECT 1 FROM app.events)
+     OR EXISTS (SELECT 1 FROM app.webhooks) THEN
+    RAISE EXCEPTION 'webhook data leaked across orgs';
+  END IF;
+END$$;
+
+-- The dispatcher claims without an org, once per lease.
+SELECT set_config('app.org_id', '', true);
+DO $$
+DECLARE
+  claimed int;
+  again   int;
+BEGIN
+  SELECT count(*) INTO claimed FROM app.claim_webhook_deliveries(100, interval '1 minute');
+  IF claimed < 4 THEN
+    RAISE EXCEPTION 'expected at least 4 due deliveries, claimed %', claimed;
+  END IF;
+  SELECT count(*) INTO again FROM app.claim_webhook_deliveries(100, interval '1 minute');
+  IF again <> 0 THEN
+    RAISE EXCEPTION 'leased deliveries were claimed again';
+  END IF;
+  IF EXISTS (SELECT 1 FROM app.webhook_deliveries) THEN
+    RAISE EXCEPTION 'deliveries are visible without an org outside the claim';
+  END IF;
+END$$;
+
+ROLLBACK;
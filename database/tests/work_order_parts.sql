@@ -0,0 +1,97 @@
+-- Work order parts checks (040): returns limited to what was issued and
+-- valued at the issue cost, the parts cost of a work order, and the site a
+-- work order's costs are reported under.
+--
+-- Run against a fully migrated database:
+--   psql "$DATABASE_URL" -v ON_ERROR_STOP=1 -f database/tests/work_order_parts.sql
+
+BEGIN;
+
+INSERT INTO organisations (id, slug, name) VALUES
+  ('00000000-0000-4000-8000-0000000000f2', 'wo-parts-probe', 'Work order parts probe');
+SELECT set_config('app.org_id', '00000000-0000-4000-8000-0000000000f2', true);
+
+DO $$
+DECLARE
+  org       uuid := app.current_org();
+  parts     bigint;
+  bins      bigint;
+  locations bigint;
+  assets    bigint;
+  orders    bigint;
+  parent    bigint;
+  filter    uuid;
+  shelf     uuid;
+  site      uuid;
+  hall      uuid;
+  pump      uuid;
+  wo        uuid;
+  other     uuid;
+  cost      numeric;
+BEGIN
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Parts', 'probe-parts') RETURNING id INTO parts;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Bins', 'probe-bins') RETURNING id INTO bins;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Locations', 'probe-locations') RETURNING id INTO locations;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Assets', 'probe-assets') RETURNING id INTO assets;
+  INSERT INTO app.tables (org_id, name, slug) VALUES (org, 'Work Orders', 'probe-work-orders') RETURNING id INTO orders;
+  INSERT INTO app.columns (table_id, name, type) VALUES (parts, 'name', 'text'), (bins, 'name', 'text'),
+    (locations, 'name', 'text'), (assets, 'name', 'text'), (orders, 'title', 'text');
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (locations, 'parent_location', 'uuid', true, locations) RETURNING id INTO parent;
+  INSERT INTO app.hierarchies (table_id, org_id, column_id) VALUES (locations, org, parent);
+  INSERT INTO app.columns (table_id, name, type, is_reference, reference_table_id)
+  VALUES (assets, 'location', 'uuid', true, locations), (orders, 'asset', 'uuid', true, assets),
+         (orders, 'location', 'uuid', true, locations);
+
+  filter := app.insert_row(parts, '{"name":"Oil filter"}');
+  shelf  := app.insert_row(bins, '{"name":"Shelf A"}');
+  site   := app.insert_row(locations, '{"name":"Plant"}');
+  hall   := app.insert_row(locations, jsonb_build_object('name', 'Hall 2', 'parent_location', site));
+  pump   := app.insert_row(assets, jsonb_build_object('name', 'Pump', 'location', hall));
+  wo     := app.insert_row(orders, jsonb_build_object('title', 'Pump service', 'asset', pump));
+  other  := app.insert_row(orders, '{"title":"Unrelated"}');
+
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, unit_cost)
+  VALUES (org, filter, 'receive', 10, shelf, 4);
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, from_bin_id, work_order_id, unit_cost)
+  VALUES (org, filter, 'issue', 2, shelf, wo, 4), (org, filter, 'issue', 2, shelf, wo, 6);
+
+  -- Returns bring back at most what was issued, at the issue cost
+  INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, work_order_id)
+  VALUES (org, filter, 'return', 1, shelf, wo)
+  RETURNING unit_cost INTO cost;
+  IF cost <> 5 THEN RAISE EXCEPTION 'return valued at %, expected the issue average 5', cost; END IF;
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, work_order_id)
+    VALUES (org, filter, 'return', 4, shelf, wo);
+    RAISE EXCEPTION 'returned more than was issued';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+  BEGIN
+    INSERT INTO app.stock_movements (org_id, part_id, kind, quantity, to_bin_id, work_order_id)
+    VALUES (org, filter, 'return', 1, shelf, other);
+    RAISE EXCEPTION 'returned from a work order that was issued nothing';
+  EXCEPTION WHEN check_violation THEN
+    NULL;
+  END;
+
+  -- Issues less returns
+  cost := app.work_order_parts_cost(wo);
+  IF cost <> 15 THEN RAISE EXCEPTION 'parts cost %, expected 8 + 12 - 5 = 15', cost; END IF;
+  IF app.work_order_parts_cost(other) <> 0 THEN RAISE EXCEPTION 'a work order without parts has a cost'; END IF;
+
+  -- The site is the top location above the asset's location
+  IF app.work_order_site(wo) IS DISTINCT FROM site THEN
+    RAISE EXCEPTION 'site of the work order is %, expected %', app.work_order_site(wo), site;
+  END IF;
+  PERFORM app.update_row(wo, jsonb_build_object('location', site));
+  IF app.work_order_site(wo) IS DISTINCT FROM site THEN
+    RAISE EXCEPTION 'a top location is not its own site';
+  END IF;
+  IF app.work_order_site(other) IS NOT NULL THEN
+    RAISE EXCEPTION 'a work order without location or asset has a site';
+  END IF;
+END$$;
+
+ROLLBACK;
@@ -19,6 +19,7 @@ import (
 	"yourapp/internal/models"
 	"yourapp/internal/repo"
 	"yourapp/internal/session"
+	"yourapp/internal/templates"
 
 	//"github.com/google/uuid"
 	"github.com/pquerna/otp"
@@ -29,15 +30,17 @@ import (
 // ---------- Public handlers (mount under /auth) ----------
 
 // POST /auth/signup
-// Body: { "email": "...", "username": "...", "name": "...", "password": "...", "org_slug": "acme" }
+// Body: { "email": "...", "username": "...", "name": "...", "password": "...", "org_slug": "acme", "templates": ["cmms"] }
+// templates defaults to the CMMS set; pass [] to start with no tables.
 func SignupHandler(r repo.Repo) http.HandlerFunc {
     return func(w http.ResponseWriter, req *http.Request) {
         var body struct {
-            Email    string `json:"email"`
-            Username string `json:"username"`
-            Name     string `json:"name"`
-            Password string `json:"password"`
-            OrgSlug  string `json:"org_slug"`
+            Email     string    `json:"email"`
+            Username  string    `json:"username"`
+            Name      string    `json:"name"`
+            Password  string    `json:"password"`
+            OrgSlug   string    `json:"org_slug"`
+            Templates *[]string `json:"templates"`
         }
         if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
             http.Error(w, "bad json", http.StatusBadRequest)
@@ -62,6 +65,14 @@ func SignupHandler(r repo.Repo) http.HandlerFunc {
             http.Error(w, "invalid org_slug (use 3-32 chars: lowercase letters, digits, hyphens; cannot start/end with '-')", http.StatusBadRequest)
             return
         }
+        tmpls := []string{templates.DefaultSet}
+        if body.Templates != nil {
+            tmpls = *body.Templates
+        }
+        if _, err := templates.Resolve(tmpls...); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
 
         u, err := r.UpsertUserByVerifiedEmail(req.Context(), email, strings.TrimSpace(body.Name))
         if err != nil {
@@ -100,6 +111,13 @@ func SignupHandler(r repo.Repo) http.HandlerFunc {
             fmt.Println("membership failed:", err)
             return
         }
+        // New orgs get their starter tables; a failure here is not fatal since
+        // provisioning can be re-run from /templates/provision.
+        if len(tmpls) > 0 {
+            if _, err := templates.Provision(req.Context(), r, org.ID, tmpls...); err != nil {
+                log.Println("template provisioning failed:", err)
+            }
+        }
 
         SetSessionCookie(w, models.Session{
             UserID:    u.ID,
@@ -9,6 +9,7 @@ import (
     "strings"
 
     "yourapp/internal/models"
+    "yourapp/internal/repo"
     "yourapp/internal/session"
 
     "github.com/google/uuid"
@@ -97,12 +98,16 @@ func SessionFromContext(ctx context.Context) (*models.Session, bool) {
 	return val.(*models.Session), true
 }
 
+// WithUser sets the authenticated user, who is also the user repo calls
+// (and so field-level access rules) act for.
 func WithUser(ctx context.Context, u *models.User) context.Context {
-	return context.WithValue(ctx, ctxKeyUser{}, u)
+	return context.WithValue(repo.WithUser(ctx, u.ID), ctxKeyUser{}, u)
 }
 
+// WithOrg sets the active org and scopes repo (and so Postgres row level
+// security) to it for the rest of the request.
 func WithOrg(ctx context.Context, id uuid.UUID) context.Context {
-	return context.WithValue(ctx, ctxOrg, id)
+	return context.WithValue(repo.WithOrg(ctx, id), ctxOrg, id)
 }
 
 func GetUserFromContext(ctx context.Context) (*models.User, bool) {
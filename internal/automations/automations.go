@@ -0,0 +1,316 @@
+// Package automations runs the org-defined automations of user tables
+// (app.automations) on row events.
+//
+// Row writes made by the API go through InsertRow, UpdateRow and DeleteRow,
+// which record the row event (queueing its webhook deliveries) and then run
+// the table's matching automations in the same transaction: sync ones
+// execute right away, so a failing action fails the change, and async ones
+// are queued for the Runner. Actions act for no user, so field access rules
+// and row policies do not apply to them, and the changes they make are row
+// events of their own, which may trigger further automations up to
+// MaxDepth.
+package automations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// MaxDepth bounds chains of automations triggering automations. The changes
+// made by an automation run for a user's change are at depth 1, the changes
+// those trigger at depth 2 and so on; automations matching a change at
+// MaxDepth are not run but logged as skipped.
+const MaxDepth = 5
+
+// Error reports a sync automation that failed, which fails the change that
+// triggered it.
+type Error struct {
+	AutomationID uuid.UUID
+	Name         string
+	RowID        uuid.UUID
+	Depth        int
+	Err          error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("automation %q failed: %v", e.Name, e.Err) }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// chain is the state of one cascade of automations, carried in the context
+// of the writes it makes.
+type chain struct {
+	depth  int
+	system bool            // the transaction already acts for no user
+	seen   map[string]bool // automation and row pairs run so far
+}
+
+type chainKey struct{}
+
+func chainFrom(ctx context.Context) chain {
+	if c, ok := ctx.Value(chainKey{}).(chain); ok {
+		return c
+	}
+	return chain{seen: map[string]bool{}}
+}
+
+func withChain(ctx context.Context, c chain) context.Context {
+	return context.WithValue(ctx, chainKey{}, c)
+}
+
+func seenKey(automationID, rowID uuid.UUID) string {
+	return automationID.String() + "/" + rowID.String()
+}
+
+// InsertRow inserts a row into a table, identified by id and slug, and runs
+// the automations of the row.created event. The returned data reflects what
+// sync automations changed. Call it inside InTx.
+func InsertRow(ctx context.Context, tx repo.Repo, orgID uuid.UUID, tableID int64, table string, values []byte) (models.TableRow, error) {
+	row, err := tx.InsertUserTableRow(ctx, orgID, table, values)
+	if err != nil {
+		return row, err
+	}
+	ran, err := afterWrite(ctx, tx, orgID, models.EventRowCreated, tableID, row.RowID, nil)
+	if err != nil || !ran {
+		return row, err
+	}
+	return reload(ctx, tx, orgID, row)
+}
+
+// UpdateRow sets values on a row of a table and runs the automations of the
+// row.updated event; found is false when the row is not in that table.
+// Call it inside InTx.
+func UpdateRow(ctx context.Context, tx repo.Repo, orgID uuid.UUID, tableID int64, table string, rowID uuid.UUID, values []byte) (models.TableRow, bool, error) {
+	previous, exists, err := tx.RowSnapshot(ctx, orgID, rowID)
+	if err != nil || !exists {
+		return models.TableRow{}, false, err
+	}
+	row, found, err := tx.UpdateUserTableRow(ctx, orgID, table, rowID, values)
+	if err != nil || !found {
+		return row, found, err
+	}
+	ran, err := afterWrite(ctx, tx, orgID, models.EventRowUpdated, tableID, rowID, previous)
+	if err != nil || !ran {
+		return row, true, err
+	}
+	row, err = reload(ctx, tx, orgID, row)
+	return row, true, err
+}
+
+// DeleteRow deletes a row of a table and runs the automations of the
+// row.deleted event; deleted is false when the row is not in that table.
+// Call it inside InTx.
+func DeleteRow(ctx context.Context, tx repo.Repo, orgID uuid.UUID, tableID int64, table string, rowID uuid.UUID) (bool, error) {
+	previous, exists, err := tx.RowSnapshot(ctx, orgID, rowID)
+	if err != nil || !exists {
+		return false, err
+	}
+	deleted, err := tx.DeleteUserTableRow(ctx, orgID, table, rowID)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	_, err = afterWrite(ctx, tx, orgID, models.EventRowDeleted, tableID, rowID, previous)
+	return true, err
+}
+
+// reload reads a row again, as the caller may see it, after automations
+// ran for it. Within an automation nobody looks at the result.
+func reload(ctx context.Context, tx repo.Repo, orgID uuid.UUID, row models.TableRow) (models.TableRow, error) {
+	if chainFrom(ctx).system {
+		return row, nil
+	}
+	data, found, err := tx.GetRowData(ctx, orgID, row.RowID)
+	if err != nil || !found {
+		return row, err
+	}
+	row.Data = data
+	return row, nil
+}
+
+// afterWrite records a row event and runs or queues the automations it
+// matches; ran reports whether a sync automation ran.
+func afterWrite(ctx context.Context, tx repo.Repo, orgID uuid.UUID, event string, tableID int64, rowID uuid.UUID, previous []byte) (ran bool, err error) {
+	eventID, err := tx.EmitRowEvent(ctx, orgID, event, tableID, rowID, previous)
+	if err != nil {
+		return false, err
+	}
+	matches, err := tx.MatchAutomations(ctx, orgID, eventID)
+	if err != nil || len(matches) == 0 {
+		return false, err
+	}
+
+	c := chainFrom(ctx)
+	top := !c.system
+	defer func() {
+		// Act for the caller again once the actions ran; after an error
+		// the transaction is rolled back anyway.
+		if top && c.system && err == nil {
+			err = tx.SetActingUser(ctx, callerID(ctx))
+		}
+	}()
+	for _, a := range matches {
+		run := models.AutomationRun{
+			AutomationID: a.ID,
+			EventID:      &eventID,
+			RowID:        &rowID,
+			Mode:         a.Mode,
+			Status:       models.RunPending,
+			Depth:        c.depth,
+		}
+		key := seenKey(a.ID, rowID)
+		switch {
+		case c.depth >= MaxDepth:
+			run.Status = models.RunSkipped
+			run.Error = fmt.Sprintf("loop protection: more than %d automations triggered in a row", MaxDepth)
+		case c.seen[key]:
+			run.Status = models.RunSkipped
+			run.Error = "loop protection: the automation already ran for this row in this chain"
+		}
+		if run.Status == models.RunSkipped {
+			slog.WarnContext(ctx, "automation skipped", "automation_id", a.ID.String(), "row_id", rowID.String(), "reason", run.Error)
+		}
+		runID, err := tx.InsertAutomationRun(ctx, orgID, run)
+		if err != nil {
+			return ran, err
+		}
+		if run.Status != models.RunPending || a.Mode == models.AutomationAsync {
+			continue
+		}
+
+		if !c.system {
+			if err := tx.SetActingUser(ctx, uuid.Nil); err != nil {
+				return ran, err
+			}
+			c.system = true
+		}
+		c.seen[key] = true
+		result, err := execute(withChain(ctx, c), tx, orgID, a, eventID, rowID, runID)
+		if err != nil {
+			return ran, &Error{AutomationID: a.ID, Name: a.Name, RowID: rowID, Depth: c.depth, Err: err}
+		}
+		if err := tx.FinishAutomationRun(ctx, orgID, runID, models.RunSucceeded, "", result, time.Now()); err != nil {
+			return ran, err
+		}
+		ran = true
+	}
+	return ran, nil
+}
+
+// callerID returns the user the request acts for, uuid.Nil for none.
+func callerID(ctx context.Context) uuid.UUID {
+	if u, ok := auth.UserFromContext(ctx); ok && u != nil {
+		return u.ID
+	}
+	return uuid.Nil
+}
+
+// execute runs the actions of a for a row event and returns what each did,
+// as the run's result. Writes it makes are one level deeper in the chain.
+func execute(ctx context.Context, tx repo.Repo, orgID uuid.UUID, a models.Automation, eventID int64, rowID uuid.UUID, runID int64) ([]byte, error) {
+	c := chainFrom(ctx)
+	c.depth++
+	nested := withChain(ctx, c)
+
+	results := make([]map[string]any, 0, len(a.Actions))
+	for i, act := range a.Actions {
+		out := map[string]any{"type": act.Type}
+		var values map[string]any
+		if len(act.SQL) > 0 {
+			var err error
+			if values, err = tx.EvalAutomationValues(ctx, eventID, act.SQL); err != nil {
+				return nil, fmt.Errorf("action %d (%s): %w", i+1, act.Type, err)
+			}
+		}
+		var err error
+		switch act.Type {
+		case models.ActionSetFields:
+			err = setFields(nested, tx, orgID, a, rowID, values, out)
+		case models.ActionCreateRow:
+			var b []byte
+			if b, err = json.Marshal(values); err == nil {
+				var row models.TableRow
+				if row, err = InsertRow(nested, tx, orgID, act.TableID, act.Table, b); err == nil {
+					out["table"] = act.Table
+					out["row_id"] = row.RowID
+				}
+			}
+		case models.ActionWebhook:
+			var queued bool
+			if act.WebhookID != nil {
+				queued, err = tx.QueueWebhookDelivery(ctx, orgID, *act.WebhookID, eventID)
+			}
+			out["webhook_id"] = act.WebhookID
+			out["queued"] = queued
+		case models.ActionEmail:
+			subject, body := text(values["subject"]), text(values["body"])
+			if err = tx.QueueEmail(ctx, orgID, runID, act.To, subject, body); err == nil {
+				out["to"] = act.To
+				out["subject"] = subject
+			}
+		default:
+			err = fmt.Errorf("unknown action type %q", act.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("action %d (%s): %w", i+1, act.Type, err)
+		}
+		results = append(results, out)
+	}
+	return json.Marshal(results)
+}
+
+// setFields writes the values that differ from the row's current ones, so
+// an automation setting a field to what it already is changes nothing and
+// triggers nothing.
+func setFields(ctx context.Context, tx repo.Repo, orgID uuid.UUID, a models.Automation, rowID uuid.UUID, values map[string]any, out map[string]any) error {
+	current, exists, err := tx.RowSnapshot(ctx, orgID, rowID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		out["skipped"] = "row no longer exists"
+		return nil
+	}
+	var data map[string]any
+	if err := json.Unmarshal(current, &data); err != nil {
+		return err
+	}
+	changed := map[string]any{}
+	for name, v := range values {
+		if !reflect.DeepEqual(data[name], v) {
+			changed[name] = v
+		}
+	}
+	out["changed"] = changed
+	if len(changed) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+	_, _, err = UpdateRow(ctx, tx, orgID, a.TableID, a.Table, rowID, b)
+	return err
+}
+
+// text renders an evaluated value for an email.
+func text(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return fmt.Sprint(x)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,345 @@
+package automations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+const (
+	ordersID = 1
+	partsID  = 2
+)
+
+// rowEvent is an event recorded by chainRepo.
+type rowEvent struct {
+	event   string
+	tableID int64
+	rowID   uuid.UUID
+}
+
+// chainRepo keeps rows, events, automations and their runs in memory.
+// Automations match events of their table by trigger alone, and the
+// formulas of actions are JSON literals. Any other method panics through
+// the nil embedded Repo.
+type chainRepo struct {
+	repo.Repo
+	automations []models.Automation
+	rows        map[uuid.UUID]map[string]any
+	tables      map[uuid.UUID]int64
+	events      []rowEvent
+	runs        []models.AutomationRun
+	acting      []uuid.UUID                    // SetActingUser calls
+	jobs        map[int64]models.AutomationJob // queued runs, by run id
+}
+
+var triggers = map[string]string{
+	models.EventRowCreated: models.TriggerCreated,
+	models.EventRowUpdated: models.TriggerUpdated,
+	models.EventRowDeleted: models.TriggerDeleted,
+}
+
+func tableID(slug string) int64 {
+	if slug == "parts" {
+		return partsID
+	}
+	return ordersID
+}
+
+func (m *chainRepo) InsertUserTableRow(_ context.Context, _ uuid.UUID, table string, values []byte) (models.TableRow, error) {
+	data := map[string]any{}
+	if err := json.Unmarshal(values, &data); err != nil {
+		return models.TableRow{}, err
+	}
+	id := uuid.New()
+	m.rows[id], m.tables[id] = data, tableID(table)
+	return models.TableRow{RowID: id, Data: data}, nil
+}
+
+func (m *chainRepo) UpdateUserTableRow(_ context.Context, _ uuid.UUID, table string, rowID uuid.UUID, values []byte) (models.TableRow, bool, error) {
+	data, ok := m.rows[rowID]
+	if !ok || m.tables[rowID] != tableID(table) {
+		return models.TableRow{}, false, nil
+	}
+	if err := json.Unmarshal(values, &data); err != nil {
+		return models.TableRow{}, false, err
+	}
+	return models.TableRow{RowID: rowID, Data: data}, true, nil
+}
+
+func (m *chainRepo) RowSnapshot(_ context.Context, _, rowID uuid.UUID) ([]byte, bool, error) {
+	data, ok := m.rows[rowID]
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := json.Marshal(data)
+	return b, true, err
+}
+
+func (m *chainRepo) GetRowData(_ context.Context, _ uuid.UUID, rowID uuid.UUID) (map[string]any, bool, error) {
+	data, ok := m.rows[rowID]
+	return data, ok, nil
+}
+
+func (m *chainRepo) EmitRowEvent(_ context.Context, _ uuid.UUID, event string, tableID int64, rowID uuid.UUID, _ []byte) (int64, error) {
+	m.events = append(m.events, rowEvent{event, tableID, rowID})
+	return int64(len(m.events)), nil
+}
+
+func (m *chainRepo) MatchAutomations(_ context.Context, _ uuid.UUID, eventID int64) ([]models.Automation, error) {
+	ev := m.events[eventID-1]
+	var out []models.Automation
+	for _, a := range m.automations {
+		if a.Active && a.TableID == ev.tableID && a.Trigger.On == triggers[ev.event] {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (m *chainRepo) EvalAutomationValues(_ context.Context, _ int64, exprs map[string]string) (map[string]any, error) {
+	values := map[string]any{}
+	for col, expr := range exprs {
+		var v any
+		if err := json.Unmarshal([]byte(expr), &v); err != nil {
+			return nil, err
+		}
+		values[col] = v
+	}
+	return values, nil
+}
+
+func (m *chainRepo) SetActingUser(_ context.Context, userID uuid.UUID) error {
+	m.acting = append(m.acting, userID)
+	return nil
+}
+
+func (m *chainRepo) InsertAutomationRun(_ context.Context, _ uuid.UUID, run models.AutomationRun) (int64, error) {
+	run.ID = int64(len(m.runs) + 1)
+	m.runs = append(m.runs, run)
+	return run.ID, nil
+}
+
+func (m *chainRepo) FinishAutomationRun(_ context.Context, _ uuid.UUID, runID int64, status, errMsg string, _ []byte, _ time.Time) error {
+	m.runs[runID-1].Status, m.runs[runID-1].Error = status, errMsg
+	return nil
+}
+
+func (m *chainRepo) ClaimAutomationRuns(context.Context, int, time.Duration) ([]models.ClaimedJob, error) {
+	var out []models.ClaimedJob
+	for id := range m.jobs {
+		out = append(out, models.ClaimedJob{ID: id})
+	}
+	return out, nil
+}
+
+func (m *chainRepo) GetAutomationJob(_ context.Context, _ uuid.UUID, runID int64) (models.AutomationJob, bool, error) {
+	j, ok := m.jobs[runID]
+	delete(m.jobs, runID)
+	return j, ok, nil
+}
+
+func (m *chainRepo) InTx(_ context.Context, fn func(repo.Repo) error) error { return fn(m) }
+
+// describeRuns describes the runs as "<automation> <depth> <status>", in
+// the order they were recorded.
+func (m *chainRepo) describeRuns() []string {
+	names := map[uuid.UUID]string{}
+	for _, a := range m.automations {
+		names[a.ID] = a.Name
+	}
+	var out []string
+	for _, r := range m.runs {
+		out = append(out, fmt.Sprintf("%s %d %s", names[r.AutomationID], r.Depth, r.Status))
+	}
+	return out
+}
+
+// count returns the number of rows of a table.
+func (m *chainRepo) count(tableID int64) int {
+	n := 0
+	for _, t := range m.tables {
+		if t == tableID {
+			n++
+		}
+	}
+	return n
+}
+
+// automation is an active automation of a table on a trigger.
+func automation(name, table, on, mode string, actions ...models.AutomationAction) models.Automation {
+	return models.Automation{
+		ID: uuid.New(), Name: name, Table: table, TableID: tableID(table),
+		Trigger: models.AutomationTrigger{On: on}, Actions: actions, Mode: mode, Active: true,
+	}
+}
+
+func setAction(values map[string]string) models.AutomationAction {
+	return models.AutomationAction{Type: models.ActionSetFields, SQL: values}
+}
+
+func createAction(table string, values map[string]string) models.AutomationAction {
+	return models.AutomationAction{Type: models.ActionCreateRow, Table: table, TableID: tableID(table), SQL: values}
+}
+
+func TestLoopProtection(t *testing.T) {
+	orgID, caller := uuid.New(), uuid.New()
+	chained := func(n int, status string) []string {
+		var out []string
+		for depth := range n {
+			out = append(out, fmt.Sprintf("A %d %s", depth, status))
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		automations []models.Automation
+		update      bool // the user updates an order, instead of creating one
+		wantRuns    []string
+		wantOrders  int
+		wantParts   int
+		wantErr     string
+	}{
+		{
+			name: "rows creating rows stop at MaxDepth",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerCreated, models.AutomationSync, createAction("orders", map[string]string{"title": `"again"`})),
+			},
+			wantRuns:   append(chained(MaxDepth, models.RunSucceeded), fmt.Sprintf("A %d %s", MaxDepth, models.RunSkipped)),
+			wantOrders: 1 + MaxDepth,
+		},
+		{
+			name: "updating its own row runs once",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerUpdated, models.AutomationSync, setAction(map[string]string{"status": `"open"`})),
+			},
+			update:     true,
+			wantRuns:   []string{"A 0 succeeded", "A 1 skipped"},
+			wantOrders: 1,
+		},
+		{
+			// A sets the status, B sets it back, each runs once for the row
+			name: "two automations updating a row in turn",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerUpdated, models.AutomationSync, setAction(map[string]string{"status": `"open"`})),
+				automation("B", "orders", models.TriggerUpdated, models.AutomationSync, setAction(map[string]string{"status": `"closed"`})),
+			},
+			update:     true,
+			wantRuns:   []string{"A 0 succeeded", "A 1 skipped", "B 1 succeeded", "A 2 skipped", "B 2 skipped", "B 0 skipped"},
+			wantOrders: 1,
+		},
+		{
+			name: "setting a field to its value triggers nothing",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerUpdated, models.AutomationSync, setAction(map[string]string{"status": `"new"`})),
+			},
+			update:     true,
+			wantRuns:   []string{"A 0 succeeded"},
+			wantOrders: 1,
+		},
+		{
+			name: "rows of another table are created once each",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerCreated, models.AutomationSync, createAction("parts", map[string]string{"name": `"seal"`})),
+				automation("B", "parts", models.TriggerCreated, models.AutomationSync, createAction("orders", map[string]string{"title": `"reorder"`})),
+			},
+			wantRuns: []string{
+				"A 0 succeeded", "B 1 succeeded", "A 2 succeeded", "B 3 succeeded", "A 4 succeeded", "B 5 skipped",
+			},
+			wantOrders: 3,
+			wantParts:  3,
+		},
+		{
+			name: "async automations are queued at their depth",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerCreated, models.AutomationSync, createAction("parts", map[string]string{"name": `"seal"`})),
+				automation("B", "parts", models.TriggerCreated, models.AutomationAsync, createAction("parts", map[string]string{"name": `"gasket"`})),
+			},
+			wantRuns:   []string{"A 0 succeeded", "B 1 pending"},
+			wantOrders: 1,
+			wantParts:  1,
+		},
+		{
+			name: "a failing nested action fails the change",
+			automations: []models.Automation{
+				automation("A", "orders", models.TriggerCreated, models.AutomationSync, createAction("parts", map[string]string{"name": `"seal"`})),
+				automation("B", "parts", models.TriggerCreated, models.AutomationSync, models.AutomationAction{Type: "teleport"}),
+			},
+			wantRuns:   []string{"A 0 pending", "B 1 pending"},
+			wantOrders: 1,
+			wantParts:  1,
+			wantErr:    `automation "A" failed: action 1 (create_row): automation "B" failed: action 1 (teleport): unknown action type "teleport"`,
+		},
+	}
+	for _, tt := range tests {
+		m := &chainRepo{automations: tt.automations, rows: map[uuid.UUID]map[string]any{}, tables: map[uuid.UUID]int64{}}
+		ctx := auth.WithUser(context.Background(), &models.User{ID: caller})
+		var err error
+		if tt.update {
+			order := uuid.New()
+			m.rows[order], m.tables[order] = map[string]any{"title": "Leak", "status": "new"}, ordersID
+			_, _, err = UpdateRow(ctx, m, orgID, ordersID, "orders", order, []byte(`{"status":"new"}`))
+		} else {
+			_, err = InsertRow(ctx, m, orgID, ordersID, "orders", []byte(`{"title":"Leak"}`))
+		}
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := m.describeRuns(); !slices.Equal(got, tt.wantRuns) {
+			t.Errorf("%s: runs\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.wantRuns, "\n"))
+		}
+		if m.count(ordersID) != tt.wantOrders || m.count(partsID) != tt.wantParts {
+			t.Errorf("%s: %d orders and %d parts, want %d and %d", tt.name, m.count(ordersID), m.count(partsID), tt.wantOrders, tt.wantParts)
+		}
+		// Actions act for no user, and the change for the caller again after
+		if tt.wantErr == "" && !slices.Equal(m.acting, []uuid.UUID{uuid.Nil, caller}) {
+			t.Errorf("%s: acting users = %v, want nobody then the caller", tt.name, m.acting)
+		}
+	}
+}
+
+// A queued run continues the chain it was queued in.
+func TestRunnerLoopProtection(t *testing.T) {
+	a := automation("A", "orders", models.TriggerCreated, models.AutomationAsync, createAction("orders", map[string]string{"title": `"again"`}))
+	b := automation("B", "orders", models.TriggerCreated, models.AutomationSync, createAction("parts", map[string]string{"name": `"seal"`}))
+	m := &chainRepo{automations: []models.Automation{a, b}, rows: map[uuid.UUID]map[string]any{}, tables: map[uuid.UUID]int64{}}
+	order := uuid.New()
+	m.rows[order], m.tables[order] = map[string]any{"title": "Leak"}, ordersID
+	m.runs = []models.AutomationRun{{ID: 1, AutomationID: a.ID, Mode: a.Mode, Status: models.RunPending, Depth: MaxDepth - 1}}
+	m.jobs = map[int64]models.AutomationJob{1: {RunID: 1, Attempts: 1, Depth: MaxDepth - 1, EventID: 1, RowID: order, Automation: a}}
+	m.events = []rowEvent{{models.EventRowCreated, ordersID, order}}
+
+	n, err := NewRunner(m, Options{}).RunDue(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("RunDue = %d, %v", n, err)
+	}
+	want := []string{
+		fmt.Sprintf("A %d succeeded", MaxDepth-1),
+		fmt.Sprintf("A %d skipped", MaxDepth),
+		fmt.Sprintf("B %d skipped", MaxDepth),
+	}
+	if got := m.describeRuns(); !slices.Equal(got, want) {
+		t.Errorf("runs\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if m.count(ordersID) != 2 || m.count(partsID) != 0 {
+		t.Errorf("%d orders and %d parts, want 2 and 0", m.count(ordersID), m.count(partsID))
+	}
+	// The runner acts for no user throughout
+	if len(m.acting) != 0 {
+		t.Errorf("acting users = %v, want none set", m.acting)
+	}
+}
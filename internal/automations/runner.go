@@ -0,0 +1,138 @@
+package automations
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// Defaults of Options fields left zero.
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultMaxAttempts  = 3
+	DefaultBatchSize    = 20
+)
+
+// runLease is how long a claimed run is hidden from other runners; actions
+// only touch the database, so a run taking longer has hung.
+const runLease = 5 * time.Minute
+
+// Options tune a Runner.
+type Options struct {
+	PollInterval time.Duration // how often to look for queued runs
+	MaxAttempts  int           // attempts before a run fails
+	BatchSize    int           // runs claimed, and executed concurrently, at once
+}
+
+// Runner executes the queued runs of async automations of every org.
+type Runner struct {
+	repo repo.Repo
+	opts Options
+}
+
+// NewRunner returns a Runner using r, which must not be bound to an org.
+func NewRunner(r repo.Repo, opts Options) *Runner {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Runner{repo: r, opts: opts}
+}
+
+// Run executes queued runs every PollInterval until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	slog.InfoContext(ctx, "automation runner started", "poll_interval", r.opts.PollInterval.String())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := r.RunDue(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "automation runs failed", "err", err)
+				}
+				if err != nil || n < r.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// RunDue claims one batch of queued runs, executes them and reports how
+// many were claimed.
+func (r *Runner) RunDue(ctx context.Context) (int, error) {
+	claimed, err := r.repo.ClaimAutomationRuns(ctx, r.opts.BatchSize, runLease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func(c models.ClaimedJob) {
+			defer wg.Done()
+			r.execute(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+	return len(claimed), nil
+}
+
+// execute runs one claimed run in its own transaction, which also records
+// its success; a failure is recorded afterwards.
+func (r *Runner) execute(ctx context.Context, c models.ClaimedJob) {
+	ctx = repo.WithOrg(ctx, c.OrgID)
+	var job models.AutomationJob
+	err := r.repo.InTx(ctx, func(tx repo.Repo) error {
+		var found bool
+		var err error
+		if job, found, err = tx.GetAutomationJob(ctx, c.OrgID, c.ID); err != nil || !found {
+			return err
+		}
+		if !job.Automation.Active {
+			return tx.FinishAutomationRun(ctx, c.OrgID, c.ID, models.RunSkipped, "automation is disabled", nil, time.Now())
+		}
+		a := job.Automation
+		chained := withChain(ctx, chain{
+			depth:  job.Depth,
+			system: true,
+			seen:   map[string]bool{seenKey(a.ID, job.RowID): true},
+		})
+		result, err := execute(chained, tx, c.OrgID, a, job.EventID, job.RowID, c.ID)
+		if err != nil {
+			return err
+		}
+		return tx.FinishAutomationRun(ctx, c.OrgID, c.ID, models.RunSucceeded, "", result, time.Now())
+	})
+	if err == nil {
+		return
+	}
+
+	slog.WarnContext(ctx, "automation run failed", "run_id", c.ID, "automation_id", job.Automation.ID.String(),
+		"attempt", job.Attempts, "err", err)
+	msg := err.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	status, next := models.RunPending, time.Now().Add(time.Duration(max(job.Attempts, 1))*time.Minute)
+	if job.Attempts >= r.opts.MaxAttempts {
+		status, next = models.RunFailed, time.Now()
+	}
+	// Record even when ctx was cancelled mid-run, so the attempt counts.
+	ctx = context.WithoutCancel(ctx)
+	if err := r.repo.FinishAutomationRun(ctx, c.OrgID, c.ID, status, msg, nil, next); err != nil {
+		slog.ErrorContext(ctx, "record automation run failed", "run_id", c.ID, "err", err)
+	}
+}
@@ -0,0 +1,334 @@
+// Package checklists answers the checklists of work orders.
+//
+// A checklist template lists the steps of a procedure; adding it to a work
+// order, by hand or from a PM schedule's checklist_template, copies its
+// items, so later edits of the template leave the work order alone. Each
+// item is answered according to its kind and records who answered it and
+// when:
+//
+//   - checkbox, text, photo and signature items are done, with the text or
+//     the file (photo or signature) they take
+//   - pass_fail items pass, fail or are not applicable (na)
+//   - reading items take a number and pass within their min and max, fail
+//     outside; they can be na too
+//
+// Items that are not required can always be na. A failed item whose
+// follow_up is set, or answered with follow_up, creates a corrective work
+// order for the asset, location and team of its work order, linked back by
+// parent_work_order. A work order cannot be completed while required items
+// of its checklists are not answered.
+package checklists
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+// MaxItems bounds the items of a template.
+const MaxItems = 200
+
+// Error is a change refused for what it asks, answered with 400, or with
+// 422 when it is the completion of a work order.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func refuse(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Answer is the answer to an item. FollowUp overrides the item's follow_up
+// when set.
+type Answer struct {
+	Result   string   `json:"result"`
+	Reading  *float64 `json:"reading"`
+	Text     string   `json:"text"`
+	File     string   `json:"file"`
+	Note     string   `json:"note"`
+	FollowUp *bool    `json:"follow_up"`
+}
+
+// CheckTemplate validates a template and tidies its name and items.
+func CheckTemplate(t *models.ChecklistTemplate) error {
+	t.Name, t.Description = strings.TrimSpace(t.Name), strings.TrimSpace(t.Description)
+	if t.Name == "" {
+		return refuse("name is required")
+	}
+	if len(t.Items) == 0 || len(t.Items) > MaxItems {
+		return refuse("items must hold 1 to %d items", MaxItems)
+	}
+	for i := range t.Items {
+		it := &t.Items[i]
+		where := "item " + strconv.Itoa(i+1)
+		it.Label, it.Unit, it.Help = strings.TrimSpace(it.Label), strings.TrimSpace(it.Unit), strings.TrimSpace(it.Help)
+		if it.Label == "" {
+			return refuse("%s: label is required", where)
+		}
+		switch it.Kind {
+		case models.ChecklistCheckbox, models.ChecklistText, models.ChecklistPhoto, models.ChecklistSignature:
+			if it.FollowUp {
+				return refuse("%s: only pass_fail and reading items can fail and take follow_up", where)
+			}
+		case models.ChecklistPassFail, models.ChecklistReading:
+		default:
+			return refuse("%s: kind must be checkbox, pass_fail, reading, text, photo or signature", where)
+		}
+		if it.Kind != models.ChecklistReading && (it.Min != nil || it.Max != nil || it.Unit != "") {
+			return refuse("%s: only reading items take min, max and unit", where)
+		}
+		if bad(it.Min) || bad(it.Max) {
+			return refuse("%s: min and max must be numbers", where)
+		}
+		if it.Min != nil && it.Max != nil && *it.Min > *it.Max {
+			return refuse("%s: min must not be above max", where)
+		}
+	}
+	return nil
+}
+
+func bad(v *float64) bool {
+	return v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0))
+}
+
+// answer checks an answer to an item and returns the item answered.
+func answer(item models.ChecklistItem, a Answer) (models.ChecklistItem, error) {
+	a.Result, a.Text, a.File, a.Note = strings.TrimSpace(a.Result), strings.TrimSpace(a.Text), strings.TrimSpace(a.File), strings.TrimSpace(a.Note)
+	out := item
+	out.Result, out.Reading, out.Text, out.File, out.Note = "", nil, "", "", a.Note
+	if a.Result == models.ChecklistNA {
+		if item.Required && item.Kind != models.ChecklistPassFail && item.Kind != models.ChecklistReading {
+			return item, refuse("a required %s item cannot be na", item.Kind)
+		}
+		out.Result = models.ChecklistNA
+		return out, nil
+	}
+	switch item.Kind {
+	case models.ChecklistCheckbox:
+		if a.Result != "" && a.Result != models.ChecklistDone {
+			return item, refuse("result must be done or na")
+		}
+		out.Result = models.ChecklistDone
+	case models.ChecklistPassFail:
+		if a.Result != models.ChecklistPass && a.Result != models.ChecklistFail {
+			return item, refuse("result must be pass, fail or na")
+		}
+		out.Result = a.Result
+	case models.ChecklistReading:
+		if a.Reading == nil || bad(a.Reading) {
+			return item, refuse("reading must be a number")
+		}
+		out.Reading, out.Result = a.Reading, models.ChecklistPass
+		if (item.Min != nil && *a.Reading < *item.Min) || (item.Max != nil && *a.Reading > *item.Max) {
+			out.Result = models.ChecklistFail
+		}
+	case models.ChecklistText:
+		if a.Text == "" {
+			return item, refuse("text is required")
+		}
+		out.Text, out.Result = a.Text, models.ChecklistDone
+	case models.ChecklistPhoto, models.ChecklistSignature:
+		if a.File == "" {
+			return item, refuse("file is required")
+		}
+		out.File, out.Result = a.File, models.ChecklistDone
+	}
+	return out, nil
+}
+
+// Save checks a template and stores it with its items, creating it when
+// its ID is nil, and returns it as stored; false when the template to
+// update does not exist.
+func Save(ctx context.Context, r repo.Repo, orgID uuid.UUID, t models.ChecklistTemplate) (models.ChecklistTemplate, bool, error) {
+	if err := CheckTemplate(&t); err != nil {
+		return t, false, err
+	}
+	ctx = repo.WithOrg(ctx, orgID)
+	found := true
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		var err error
+		if t.ID == uuid.Nil {
+			t.ID, err = tx.CreateChecklistTemplate(ctx, orgID, t)
+		} else {
+			found, err = tx.UpdateChecklistTemplate(ctx, orgID, t)
+		}
+		if err != nil || !found {
+			return err
+		}
+		if err := tx.SetChecklistTemplateItems(ctx, orgID, t.ID, t.Items); err != nil {
+			return err
+		}
+		t, _, err = tx.GetChecklistTemplate(ctx, orgID, t.ID)
+		return err
+	})
+	return t, found, err
+}
+
+// Add copies a template onto a work order and returns its checklists.
+// Callers check that the work order is a row the user may edit and is
+// still open.
+func Add(ctx context.Context, r repo.Repo, orgID, userID, workOrderID, templateID uuid.UUID) ([]models.Checklist, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	var out []models.Checklist
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		_, found, err := tx.CopyChecklist(ctx, workOrderID, templateID, &userID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return refuse("checklist template not found")
+		}
+		out, err = tx.ListWorkOrderChecklists(ctx, orgID, workOrderID)
+		return err
+	})
+	return out, err
+}
+
+// Record answers an item of a work order's checklist for userID and, when
+// it fails and takes a follow-up, creates the corrective work order, all in
+// one transaction. wo holds the values of the work order workOrderID. It
+// returns the item's checklist as answered. Like the PM scheduler the
+// follow-up is created for the system.
+func Record(ctx context.Context, r repo.Repo, orgID, userID, workOrderID uuid.UUID, wo map[string]any, item models.ChecklistItem, a Answer) (models.Checklist, error) {
+	out, err := answer(item, a)
+	if err != nil {
+		return models.Checklist{}, err
+	}
+	out.CompletedBy = &userID
+	followUp := item.FollowUp
+	if a.FollowUp != nil {
+		followUp = *a.FollowUp
+	}
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	var c models.Checklist
+	err = r.InTx(ctx, func(tx repo.Repo) error {
+		if _, err := tx.AnswerChecklistItem(ctx, orgID, out); err != nil {
+			return err
+		}
+		if out.Result == models.ChecklistFail && followUp && item.FollowUpWorkOrderID == nil {
+			id, created, err := pm.CreateWorkOrder(ctx, tx, orgID, followUpValues(workOrderID, wo, out))
+			if err != nil {
+				return err
+			}
+			if created {
+				if err := tx.SetChecklistItemFollowUp(ctx, orgID, item.ID, id); err != nil {
+					return err
+				}
+			}
+		}
+		c, err = checklist(ctx, tx, orgID, workOrderID, item.ChecklistID)
+		return err
+	})
+	return c, err
+}
+
+// Clear unanswers an item and returns its checklist. A follow-up work order
+// the item created stays linked.
+func Clear(ctx context.Context, r repo.Repo, orgID, workOrderID uuid.UUID, item models.ChecklistItem) (models.Checklist, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	var c models.Checklist
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		if _, err := tx.ClearChecklistItem(ctx, orgID, item.ChecklistID, item.ID); err != nil {
+			return err
+		}
+		var err error
+		c, err = checklist(ctx, tx, orgID, workOrderID, item.ChecklistID)
+		return err
+	})
+	return c, err
+}
+
+// checklist returns a checklist of a work order.
+func checklist(ctx context.Context, tx repo.Repo, orgID, workOrderID, id uuid.UUID) (models.Checklist, error) {
+	all, err := tx.ListWorkOrderChecklists(ctx, orgID, workOrderID)
+	if err != nil {
+		return models.Checklist{}, err
+	}
+	for _, c := range all {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return models.Checklist{}, refuse("checklist not found")
+}
+
+// followUpValues returns the values of the corrective work order of a
+// failed item.
+func followUpValues(workOrderID uuid.UUID, wo map[string]any, item models.ChecklistItem) map[string]any {
+	title, _ := wo["title"].(string)
+	reason := fmt.Sprintf("Failed check on work order %q: %s", title, item.Label)
+	if item.Reading != nil {
+		reason += " (" + strconv.FormatFloat(*item.Reading, 'f', -1, 64)
+		if item.Unit != "" {
+			reason += " " + item.Unit
+		}
+		reason += " is outside " + limits(item) + ")"
+	}
+	if item.Note != "" {
+		reason += "\n\n" + item.Note
+	}
+	values := map[string]any{
+		"title":             "Follow-up: " + item.Label,
+		"description":       reason,
+		"parent_work_order": workOrderID.String(),
+	}
+	for _, col := range []string{"priority", "asset", "location", "team", "category"} {
+		if v := wo[col]; v != nil && v != "" {
+			values[col] = v
+		}
+	}
+	return values
+}
+
+// limits describes the passing range of a reading item.
+func limits(item models.ChecklistItem) string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	switch {
+	case item.Min != nil && item.Max != nil:
+		return f(*item.Min) + " to " + f(*item.Max)
+	case item.Min != nil:
+		return "at least " + f(*item.Min)
+	case item.Max != nil:
+		return "at most " + f(*item.Max)
+	}
+	return "its limits"
+}
+
+// Completable refuses a change of a work order that completes it while
+// required items of its checklists are not answered. values are those the
+// change writes. Call it inside InTx, after workflow.Apply.
+func Completable(ctx context.Context, tx repo.Repo, orgID, workOrderID uuid.UUID, values map[string]any) error {
+	if values["status"] != "COMPLETED" {
+		return nil
+	}
+	b, found, err := tx.RowSnapshot(ctx, orgID, workOrderID)
+	if err != nil || !found {
+		return err
+	}
+	var current map[string]any
+	if err := json.Unmarshal(b, &current); err != nil {
+		return err
+	}
+	if current["status"] == "COMPLETED" {
+		return nil
+	}
+	open, err := tx.WorkOrderChecklistOpen(ctx, workOrderID)
+	if err != nil || open == 0 {
+		return err
+	}
+	if open == 1 {
+		return refuse("1 required checklist item is not answered")
+	}
+	return refuse("%d required checklist items are not answered", open)
+}
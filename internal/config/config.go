@@ -44,6 +44,57 @@ type Config struct {
 			Enabled bool `mapstructure:"enabled"`
 		} `mapstructure:"denylist"`
 	} `mapstructure:"security"`
+	Webhooks struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		Timeout      time.Duration `mapstructure:"timeout"`
+		MaxAttempts  int           `mapstructure:"max_attempts"`
+	} `mapstructure:"webhooks"`
+	Automations struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		MaxAttempts  int           `mapstructure:"max_attempts"`
+	} `mapstructure:"automations"`
+	PM struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		ScanInterval time.Duration `mapstructure:"scan_interval"`
+	} `mapstructure:"pm"`
+	Files struct {
+		Backend   string        `mapstructure:"backend"` // local or s3
+		Dir       string        `mapstructure:"dir"`
+		MaxSize   int64         `mapstructure:"max_size"`
+		URLSecret string        `mapstructure:"url_secret"`
+		URLTTL    time.Duration `mapstructure:"url_ttl"`
+		S3        struct {
+			Endpoint  string `mapstructure:"endpoint"`
+			Region    string `mapstructure:"region"`
+			Bucket    string `mapstructure:"bucket"`
+			AccessKey string `mapstructure:"access_key"`
+			SecretKey string `mapstructure:"secret_key"`
+		} `mapstructure:"s3"`
+	} `mapstructure:"files"`
+	Portal struct {
+		RateLimit struct {
+			RequestsPerMinute int           `mapstructure:"rpm"`
+			Burst             int           `mapstructure:"burst"`
+			TTL               time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"rate_limit"`
+		Captcha struct {
+			VerifyURL string `mapstructure:"verify_url"`
+			SiteKey   string `mapstructure:"site_key"`
+			Secret    string `mapstructure:"secret"`
+		} `mapstructure:"captcha"`
+	} `mapstructure:"portal"`
+	Mail struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		MaxAttempts  int           `mapstructure:"max_attempts"`
+		SMTPAddr     string        `mapstructure:"smtp_addr"`
+		From         string        `mapstructure:"from"`
+		Username     string        `mapstructure:"username"`
+		Password     string        `mapstructure:"password"`
+	} `mapstructure:"mail"`
 	Microsoft struct {
 		ClientID     string `mapstructure:"client_id"`
 		ClientSecret string `mapstructure:"client_secret"`
@@ -82,6 +133,33 @@ func Load() Config {
 	viper.SetDefault("security.rate_limit.burst", 60)
 	viper.SetDefault("security.rate_limit.ttl", "30m")
 	viper.SetDefault("security.denylist.enabled", true)
+	// Webhook delivery defaults
+	viper.SetDefault("webhooks.enabled", true)
+	viper.SetDefault("webhooks.poll_interval", "5s")
+	viper.SetDefault("webhooks.timeout", "10s")
+	viper.SetDefault("webhooks.max_attempts", 8)
+	// Async automation and mail outbox defaults
+	viper.SetDefault("automations.enabled", true)
+	viper.SetDefault("automations.poll_interval", "5s")
+	viper.SetDefault("automations.max_attempts", 3)
+	viper.SetDefault("mail.enabled", true)
+	viper.SetDefault("mail.poll_interval", "10s")
+	viper.SetDefault("mail.max_attempts", 5)
+	viper.SetDefault("mail.from", "no-reply@localhost")
+	// PM scheduler defaults
+	viper.SetDefault("pm.enabled", true)
+	viper.SetDefault("pm.poll_interval", "1m")
+	viper.SetDefault("pm.scan_interval", "15m")
+	// File store defaults
+	viper.SetDefault("files.backend", "local")
+	viper.SetDefault("files.dir", "./data/files")
+	viper.SetDefault("files.max_size", 25<<20)
+	viper.SetDefault("files.url_ttl", "15m")
+	viper.SetDefault("files.s3.region", "us-east-1")
+	// Public request portal defaults
+	viper.SetDefault("portal.rate_limit.rpm", 10)
+	viper.SetDefault("portal.rate_limit.burst", 5)
+	viper.SetDefault("portal.rate_limit.ttl", "30m")
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -110,6 +188,36 @@ func Load() Config {
 	_ = viper.BindEnv("security.rate_limit.burst", "RATE_LIMIT_BURST")
 	_ = viper.BindEnv("security.rate_limit.ttl", "RATE_LIMIT_TTL")
 	_ = viper.BindEnv("security.denylist.enabled", "DENYLIST_ENABLED")
+	_ = viper.BindEnv("webhooks.enabled", "WEBHOOKS_ENABLED")
+	_ = viper.BindEnv("webhooks.poll_interval", "WEBHOOKS_POLL_INTERVAL")
+	_ = viper.BindEnv("webhooks.timeout", "WEBHOOKS_TIMEOUT")
+	_ = viper.BindEnv("webhooks.max_attempts", "WEBHOOKS_MAX_ATTEMPTS")
+	_ = viper.BindEnv("automations.enabled", "AUTOMATIONS_ENABLED")
+	_ = viper.BindEnv("automations.poll_interval", "AUTOMATIONS_POLL_INTERVAL")
+	_ = viper.BindEnv("automations.max_attempts", "AUTOMATIONS_MAX_ATTEMPTS")
+	_ = viper.BindEnv("files.backend", "FILES_BACKEND")
+	_ = viper.BindEnv("files.dir", "FILES_DIR")
+	_ = viper.BindEnv("files.max_size", "FILES_MAX_SIZE")
+	_ = viper.BindEnv("files.url_secret", "FILES_URL_SECRET")
+	_ = viper.BindEnv("files.url_ttl", "FILES_URL_TTL")
+	_ = viper.BindEnv("files.s3.endpoint", "FILES_S3_ENDPOINT")
+	_ = viper.BindEnv("files.s3.region", "FILES_S3_REGION")
+	_ = viper.BindEnv("files.s3.bucket", "FILES_S3_BUCKET")
+	_ = viper.BindEnv("files.s3.access_key", "FILES_S3_ACCESS_KEY")
+	_ = viper.BindEnv("files.s3.secret_key", "FILES_S3_SECRET_KEY")
+	_ = viper.BindEnv("portal.rate_limit.rpm", "PORTAL_RATE_LIMIT_RPM")
+	_ = viper.BindEnv("portal.rate_limit.burst", "PORTAL_RATE_LIMIT_BURST")
+	_ = viper.BindEnv("portal.rate_limit.ttl", "PORTAL_RATE_LIMIT_TTL")
+	_ = viper.BindEnv("portal.captcha.verify_url", "PORTAL_CAPTCHA_VERIFY_URL")
+	_ = viper.BindEnv("portal.captcha.site_key", "PORTAL_CAPTCHA_SITE_KEY")
+	_ = viper.BindEnv("portal.captcha.secret", "PORTAL_CAPTCHA_SECRET")
+	_ = viper.BindEnv("mail.enabled", "MAIL_ENABLED")
+	_ = viper.BindEnv("mail.poll_interval", "MAIL_POLL_INTERVAL")
+	_ = viper.BindEnv("mail.max_attempts", "MAIL_MAX_ATTEMPTS")
+	_ = viper.BindEnv("mail.smtp_addr", "MAIL_SMTP_ADDR")
+	_ = viper.BindEnv("mail.from", "MAIL_FROM")
+	_ = viper.BindEnv("mail.username", "MAIL_USERNAME")
+	_ = viper.BindEnv("mail.password", "MAIL_PASSWORD")
 	_ = viper.BindEnv("microsoft.client_id", "MICROSOFT_CLIENT_ID")
 	_ = viper.BindEnv("microsoft.client_secret", "MICROSOFT_CLIENT_SECRET")
 	_ = viper.BindEnv("microsoft.tenant_id", "MICROSOFT_TENANT_ID")
@@ -134,5 +242,14 @@ func Load() Config {
 	if c.BaseURL == "" {
 		panic("config error: base_url/BASE_URL required")
 	}
+	switch c.Files.Backend {
+	case "local":
+	case "s3":
+		if c.Files.S3.Endpoint == "" || c.Files.S3.Bucket == "" {
+			panic("config error: files.s3.endpoint and files.s3.bucket required for the s3 backend")
+		}
+	default:
+		panic("config error: files.backend must be local or s3")
+	}
 	return c
 }
@@ -58,6 +58,99 @@ func (ns NullAppColumnType) Value() (driver.Value, error) {
 	return string(ns.AppColumnType), nil
 }
 
+type AppAutomation struct {
+	ID                  pgtype.UUID        `db:"id" json:"id"`
+	OrgID               pgtype.UUID        `db:"org_id" json:"org_id"`
+	TableID             int64              `db:"table_id" json:"table_id"`
+	Name                string             `db:"name" json:"name"`
+	Trigger             string             `db:"trigger" json:"trigger"`
+	TriggerField        pgtype.Text        `db:"trigger_field" json:"trigger_field"`
+	TriggerTo           pgtype.Text        `db:"trigger_to" json:"trigger_to"`
+	ConditionExpression pgtype.Text        `db:"condition_expression" json:"condition_expression"`
+	ConditionSql        pgtype.Text        `db:"condition_sql" json:"condition_sql"`
+	Actions             []byte             `db:"actions" json:"actions"`
+	Refs                []string           `db:"refs" json:"refs"`
+	Mode                string             `db:"mode" json:"mode"`
+	Active              bool               `db:"active" json:"active"`
+	CreatedAt           pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppAutomationRun struct {
+	ID            int64              `db:"id" json:"id"`
+	OrgID         pgtype.UUID        `db:"org_id" json:"org_id"`
+	AutomationID  pgtype.UUID        `db:"automation_id" json:"automation_id"`
+	EventID       pgtype.Int8        `db:"event_id" json:"event_id"`
+	RowID         pgtype.UUID        `db:"row_id" json:"row_id"`
+	Mode          string             `db:"mode" json:"mode"`
+	Status        string             `db:"status" json:"status"`
+	Depth         int32              `db:"depth" json:"depth"`
+	Attempts      int32              `db:"attempts" json:"attempts"`
+	NextAttemptAt pgtype.Timestamptz `db:"next_attempt_at" json:"next_attempt_at"`
+	Error         pgtype.Text        `db:"error" json:"error"`
+	Result        []byte             `db:"result" json:"result"`
+	CreatedAt     pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	FinishedAt    pgtype.Timestamptz `db:"finished_at" json:"finished_at"`
+}
+
+type AppChecklist struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	WorkOrderID pgtype.UUID        `db:"work_order_id" json:"work_order_id"`
+	TemplateID  pgtype.UUID        `db:"template_id" json:"template_id"`
+	Name        string             `db:"name" json:"name"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppChecklistItem struct {
+	ID                  pgtype.UUID        `db:"id" json:"id"`
+	OrgID               pgtype.UUID        `db:"org_id" json:"org_id"`
+	ChecklistID         pgtype.UUID        `db:"checklist_id" json:"checklist_id"`
+	Position            int32              `db:"position" json:"position"`
+	Label               string             `db:"label" json:"label"`
+	Kind                string             `db:"kind" json:"kind"`
+	Required            bool               `db:"required" json:"required"`
+	MinValue            pgtype.Numeric     `db:"min_value" json:"min_value"`
+	MaxValue            pgtype.Numeric     `db:"max_value" json:"max_value"`
+	Unit                pgtype.Text        `db:"unit" json:"unit"`
+	FollowUp            bool               `db:"follow_up" json:"follow_up"`
+	Help                pgtype.Text        `db:"help" json:"help"`
+	Result              pgtype.Text        `db:"result" json:"result"`
+	Reading             pgtype.Numeric     `db:"reading" json:"reading"`
+	TextValue           pgtype.Text        `db:"text_value" json:"text_value"`
+	File                pgtype.Text        `db:"file" json:"file"`
+	Note                pgtype.Text        `db:"note" json:"note"`
+	CompletedBy         pgtype.UUID        `db:"completed_by" json:"completed_by"`
+	CompletedAt         pgtype.Timestamptz `db:"completed_at" json:"completed_at"`
+	FollowUpWorkOrderID pgtype.UUID        `db:"follow_up_work_order_id" json:"follow_up_work_order_id"`
+}
+
+type AppChecklistTemplate struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	Name        string             `db:"name" json:"name"`
+	Description pgtype.Text        `db:"description" json:"description"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppChecklistTemplateItem struct {
+	ID         pgtype.UUID    `db:"id" json:"id"`
+	OrgID      pgtype.UUID    `db:"org_id" json:"org_id"`
+	TemplateID pgtype.UUID    `db:"template_id" json:"template_id"`
+	Position   int32          `db:"position" json:"position"`
+	Label      string         `db:"label" json:"label"`
+	Kind       string         `db:"kind" json:"kind"`
+	Required   bool           `db:"required" json:"required"`
+	MinValue   pgtype.Numeric `db:"min_value" json:"min_value"`
+	MaxValue   pgtype.Numeric `db:"max_value" json:"max_value"`
+	Unit       pgtype.Text    `db:"unit" json:"unit"`
+	FollowUp   bool           `db:"follow_up" json:"follow_up"`
+	Help       pgtype.Text    `db:"help" json:"help"`
+}
+
 type AppColumn struct {
 	ID                    int64         `db:"id" json:"id"`
 	TableID               int64         `db:"table_id" json:"table_id"`
@@ -69,20 +162,324 @@ type AppColumn struct {
 	IsReference           bool          `db:"is_reference" json:"is_reference"`
 	ReferenceTableID      pgtype.Int8   `db:"reference_table_id" json:"reference_table_id"`
 	RequireDifferentTable bool          `db:"require_different_table" json:"require_different_table"`
+	Kind                  string        `db:"kind" json:"kind"`
+	Expression            pgtype.Text   `db:"expression" json:"expression"`
+	ExpressionSql         pgtype.Text   `db:"expression_sql" json:"expression_sql"`
+	RollupViaColumnID     pgtype.Int8   `db:"rollup_via_column_id" json:"rollup_via_column_id"`
+	RollupTargetColumnID  pgtype.Int8   `db:"rollup_target_column_id" json:"rollup_target_column_id"`
+	RollupAggregate       pgtype.Text   `db:"rollup_aggregate" json:"rollup_aggregate"`
+	RollupFilter          []byte        `db:"rollup_filter" json:"rollup_filter"`
+	ReadRole              interface{}   `db:"read_role" json:"read_role"`
+	EditRole              interface{}   `db:"edit_role" json:"edit_role"`
+	Masked                bool          `db:"masked" json:"masked"`
+}
+
+type AppEvent struct {
+	ID        int64              `db:"id" json:"id"`
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	Type      string             `db:"type" json:"type"`
+	TableID   pgtype.Int8        `db:"table_id" json:"table_id"`
+	RowID     pgtype.UUID        `db:"row_id" json:"row_id"`
+	ActorID   pgtype.UUID        `db:"actor_id" json:"actor_id"`
+	Payload   []byte             `db:"payload" json:"payload"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	Txid      int64              `db:"txid" json:"txid"`
+}
+
+type AppFile struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	Name        string             `db:"name" json:"name"`
+	ContentType string             `db:"content_type" json:"content_type"`
+	Size        int64              `db:"size" json:"size"`
+	Sha256      string             `db:"sha256" json:"sha256"`
+	Width       pgtype.Int4        `db:"width" json:"width"`
+	Height      pgtype.Int4        `db:"height" json:"height"`
+	Thumbnail   bool               `db:"thumbnail" json:"thumbnail"`
+	Latitude    pgtype.Float8      `db:"latitude" json:"latitude"`
+	Longitude   pgtype.Float8      `db:"longitude" json:"longitude"`
+	TakenAt     pgtype.Timestamptz `db:"taken_at" json:"taken_at"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppFileLink struct {
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	FileID    pgtype.UUID        `db:"file_id" json:"file_id"`
+	RowID     pgtype.UUID        `db:"row_id" json:"row_id"`
+	CreatedBy pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppHierarchy struct {
+	TableID   int64              `db:"table_id" json:"table_id"`
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	ColumnID  int64              `db:"column_id" json:"column_id"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppLabourRate struct {
+	ID         pgtype.UUID        `db:"id" json:"id"`
+	OrgID      pgtype.UUID        `db:"org_id" json:"org_id"`
+	UserID     pgtype.UUID        `db:"user_id" json:"user_id"`
+	TeamID     pgtype.UUID        `db:"team_id" json:"team_id"`
+	HourlyRate pgtype.Numeric     `db:"hourly_rate" json:"hourly_rate"`
+	CreatedAt  pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt  pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppMeterAlert struct {
+	ID           int64              `db:"id" json:"id"`
+	OrgID        pgtype.UUID        `db:"org_id" json:"org_id"`
+	RuleID       pgtype.UUID        `db:"rule_id" json:"rule_id"`
+	MeterID      pgtype.UUID        `db:"meter_id" json:"meter_id"`
+	ReadingID    int64              `db:"reading_id" json:"reading_id"`
+	Value        float64            `db:"value" json:"value"`
+	Previous     pgtype.Float8      `db:"previous" json:"previous"`
+	Action       string             `db:"action" json:"action"`
+	WorkOrderIds []pgtype.UUID      `db:"work_order_ids" json:"work_order_ids"`
+	CreatedAt    pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppMeterReading struct {
+	ID        int64              `db:"id" json:"id"`
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	MeterID   pgtype.UUID        `db:"meter_id" json:"meter_id"`
+	Value     float64            `db:"value" json:"value"`
+	ReadAt    pgtype.Timestamptz `db:"read_at" json:"read_at"`
+	CreatedBy pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppMeterRule struct {
+	ID              pgtype.UUID        `db:"id" json:"id"`
+	OrgID           pgtype.UUID        `db:"org_id" json:"org_id"`
+	MeterID         pgtype.UUID        `db:"meter_id" json:"meter_id"`
+	Name            string             `db:"name" json:"name"`
+	Kind            string             `db:"kind" json:"kind"`
+	Value           float64            `db:"value" json:"value"`
+	Action          string             `db:"action" json:"action"`
+	WoTitle         pgtype.Text        `db:"wo_title" json:"wo_title"`
+	WoDescription   pgtype.Text        `db:"wo_description" json:"wo_description"`
+	WoPriority      pgtype.Text        `db:"wo_priority" json:"wo_priority"`
+	Active          bool               `db:"active" json:"active"`
+	LastTriggeredAt pgtype.Timestamptz `db:"last_triggered_at" json:"last_triggered_at"`
+	CreatedAt       pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppOutboundEmail struct {
+	ID            int64              `db:"id" json:"id"`
+	OrgID         pgtype.UUID        `db:"org_id" json:"org_id"`
+	RunID         pgtype.Int8        `db:"run_id" json:"run_id"`
+	Recipients    []string           `db:"recipients" json:"recipients"`
+	Subject       string             `db:"subject" json:"subject"`
+	Body          string             `db:"body" json:"body"`
+	Status        string             `db:"status" json:"status"`
+	Attempts      int32              `db:"attempts" json:"attempts"`
+	NextAttemptAt pgtype.Timestamptz `db:"next_attempt_at" json:"next_attempt_at"`
+	LastError     pgtype.Text        `db:"last_error" json:"last_error"`
+	SentAt        pgtype.Timestamptz `db:"sent_at" json:"sent_at"`
+	CreatedAt     pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppPartOrder struct {
+	ID         pgtype.UUID        `db:"id" json:"id"`
+	OrgID      pgtype.UUID        `db:"org_id" json:"org_id"`
+	PartID     pgtype.UUID        `db:"part_id" json:"part_id"`
+	Quantity   pgtype.Numeric     `db:"quantity" json:"quantity"`
+	Received   pgtype.Numeric     `db:"received" json:"received"`
+	Supplier   pgtype.Text        `db:"supplier" json:"supplier"`
+	Reference  pgtype.Text        `db:"reference" json:"reference"`
+	ExpectedOn pgtype.Date        `db:"expected_on" json:"expected_on"`
+	Status     string             `db:"status" json:"status"`
+	CreatedBy  pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt  pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt  pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppPmOccurrence struct {
+	ID          int64              `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	PmID        pgtype.UUID        `db:"pm_id" json:"pm_id"`
+	Trigger     string             `db:"trigger" json:"trigger"`
+	DueOn       pgtype.Date        `db:"due_on" json:"due_on"`
+	DueReading  pgtype.Float8      `db:"due_reading" json:"due_reading"`
+	WorkOrderID pgtype.UUID        `db:"work_order_id" json:"work_order_id"`
+	Status      string             `db:"status" json:"status"`
+	Note        pgtype.Text        `db:"note" json:"note"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppPmScan struct {
+	OrgID      pgtype.UUID        `db:"org_id" json:"org_id"`
+	NextScanAt pgtype.Timestamptz `db:"next_scan_at" json:"next_scan_at"`
+	LastScanAt pgtype.Timestamptz `db:"last_scan_at" json:"last_scan_at"`
+	LastError  pgtype.Text        `db:"last_error" json:"last_error"`
+}
+
+type AppRequestPortal struct {
+	OrgID           pgtype.UUID        `db:"org_id" json:"org_id"`
+	Key             string             `db:"key" json:"key"`
+	Enabled         bool               `db:"enabled" json:"enabled"`
+	Title           string             `db:"title" json:"title"`
+	Intro           pgtype.Text        `db:"intro" json:"intro"`
+	Captcha         bool               `db:"captcha" json:"captcha"`
+	Photos          bool               `db:"photos" json:"photos"`
+	DefaultPriority pgtype.Text        `db:"default_priority" json:"default_priority"`
+	UpdatedBy       pgtype.UUID        `db:"updated_by" json:"updated_by"`
+	UpdatedAt       pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppRequestToken struct {
+	TokenHash string             `db:"token_hash" json:"token_hash"`
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	RowID     pgtype.UUID        `db:"row_id" json:"row_id"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppRollupValue struct {
+	RowID     pgtype.UUID        `db:"row_id" json:"row_id"`
+	ColumnID  int64              `db:"column_id" json:"column_id"`
+	Value     []byte             `db:"value" json:"value"`
+	UpdatedAt pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
 }
 
 type AppRow struct {
 	ID        pgtype.UUID        `db:"id" json:"id"`
 	TableID   int64              `db:"table_id" json:"table_id"`
 	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	CreatedBy pgtype.UUID        `db:"created_by" json:"created_by"`
+}
+
+type AppRowPolicy struct {
+	ID            int64              `db:"id" json:"id"`
+	OrgID         pgtype.UUID        `db:"org_id" json:"org_id"`
+	TableID       int64              `db:"table_id" json:"table_id"`
+	Name          string             `db:"name" json:"name"`
+	Role          interface{}        `db:"role" json:"role"`
+	UserID        pgtype.UUID        `db:"user_id" json:"user_id"`
+	TeamID        pgtype.UUID        `db:"team_id" json:"team_id"`
+	Expression    string             `db:"expression" json:"expression"`
+	ExpressionSql string             `db:"expression_sql" json:"expression_sql"`
+	Refs          []string           `db:"refs" json:"refs"`
+	CreatedAt     pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppStateMachine struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	TableID     int64              `db:"table_id" json:"table_id"`
+	ColumnName  string             `db:"column_name" json:"column_name"`
+	Initial     []string           `db:"initial" json:"initial"`
+	Transitions []byte             `db:"transitions" json:"transitions"`
+	States      []byte             `db:"states" json:"states"`
+	Refs        []string           `db:"refs" json:"refs"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppStockLevel struct {
+	OrgID      pgtype.UUID        `db:"org_id" json:"org_id"`
+	PartID     pgtype.UUID        `db:"part_id" json:"part_id"`
+	BinID      pgtype.UUID        `db:"bin_id" json:"bin_id"`
+	Lot        string             `db:"lot" json:"lot"`
+	Serial     string             `db:"serial" json:"serial"`
+	ExpiresOn  pgtype.Date        `db:"expires_on" json:"expires_on"`
+	Quantity   pgtype.Numeric     `db:"quantity" json:"quantity"`
+	ReceivedAt pgtype.Timestamptz `db:"received_at" json:"received_at"`
+	UpdatedAt  pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppStockMovement struct {
+	ID          int64              `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	PartID      pgtype.UUID        `db:"part_id" json:"part_id"`
+	Kind        string             `db:"kind" json:"kind"`
+	Quantity    pgtype.Numeric     `db:"quantity" json:"quantity"`
+	FromBinID   pgtype.UUID        `db:"from_bin_id" json:"from_bin_id"`
+	ToBinID     pgtype.UUID        `db:"to_bin_id" json:"to_bin_id"`
+	Lot         string             `db:"lot" json:"lot"`
+	Serial      string             `db:"serial" json:"serial"`
+	ExpiresOn   pgtype.Date        `db:"expires_on" json:"expires_on"`
+	WorkOrderID pgtype.UUID        `db:"work_order_id" json:"work_order_id"`
+	OrderID     pgtype.UUID        `db:"order_id" json:"order_id"`
+	UnitCost    pgtype.Numeric     `db:"unit_cost" json:"unit_cost"`
+	Note        pgtype.Text        `db:"note" json:"note"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppStockReservation struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	PartID      pgtype.UUID        `db:"part_id" json:"part_id"`
+	WorkOrderID pgtype.UUID        `db:"work_order_id" json:"work_order_id"`
+	BinID       pgtype.UUID        `db:"bin_id" json:"bin_id"`
+	Quantity    pgtype.Numeric     `db:"quantity" json:"quantity"`
+	Issued      pgtype.Numeric     `db:"issued" json:"issued"`
+	NeededOn    pgtype.Date        `db:"needed_on" json:"needed_on"`
+	Status      string             `db:"status" json:"status"`
+	Note        pgtype.Text        `db:"note" json:"note"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
 }
 
 type AppTable struct {
+	ID            int64              `db:"id" json:"id"`
+	Name          string             `db:"name" json:"name"`
+	Slug          string             `db:"slug" json:"slug"`
+	CreatedAt     pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	OrgID         pgtype.UUID        `db:"org_id" json:"org_id"`
+	StorageMode   string             `db:"storage_mode" json:"storage_mode"`
+	PhysicalTable pgtype.Text        `db:"physical_table" json:"physical_table"`
+	MigratedAt    pgtype.Timestamptz `db:"migrated_at" json:"migrated_at"`
+}
+
+type AppTableGrant struct {
 	ID        int64              `db:"id" json:"id"`
-	Name      string             `db:"name" json:"name"`
-	Slug      string             `db:"slug" json:"slug"`
-	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
 	OrgID     pgtype.UUID        `db:"org_id" json:"org_id"`
+	TableID   int64              `db:"table_id" json:"table_id"`
+	Role      interface{}        `db:"role" json:"role"`
+	UserID    pgtype.UUID        `db:"user_id" json:"user_id"`
+	TeamID    pgtype.UUID        `db:"team_id" json:"team_id"`
+	CanRead   bool               `db:"can_read" json:"can_read"`
+	CanCreate bool               `db:"can_create" json:"can_create"`
+	CanEdit   bool               `db:"can_edit" json:"can_edit"`
+	CanDelete bool               `db:"can_delete" json:"can_delete"`
+	CanManage bool               `db:"can_manage" json:"can_manage"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
+type AppTeamMember struct {
+	OrgID  pgtype.UUID `db:"org_id" json:"org_id"`
+	TeamID pgtype.UUID `db:"team_id" json:"team_id"`
+	UserID pgtype.UUID `db:"user_id" json:"user_id"`
+}
+
+type AppTemplateInstall struct {
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	Template    string             `db:"template" json:"template"`
+	Version     int32              `db:"version" json:"version"`
+	InstalledAt pgtype.Timestamptz `db:"installed_at" json:"installed_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppTimeEntry struct {
+	ID          pgtype.UUID        `db:"id" json:"id"`
+	OrgID       pgtype.UUID        `db:"org_id" json:"org_id"`
+	WorkOrderID pgtype.UUID        `db:"work_order_id" json:"work_order_id"`
+	UserID      pgtype.UUID        `db:"user_id" json:"user_id"`
+	Source      string             `db:"source" json:"source"`
+	StartedAt   pgtype.Timestamptz `db:"started_at" json:"started_at"`
+	EndedAt     pgtype.Timestamptz `db:"ended_at" json:"ended_at"`
+	HourlyRate  pgtype.Numeric     `db:"hourly_rate" json:"hourly_rate"`
+	Note        pgtype.Text        `db:"note" json:"note"`
+	CreatedBy   pgtype.UUID        `db:"created_by" json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
 }
 
 type AppValuesBool struct {
@@ -101,6 +498,7 @@ type AppValuesEnum struct {
 	RowID    pgtype.UUID `db:"row_id" json:"row_id"`
 	ColumnID int64       `db:"column_id" json:"column_id"`
 	Value    pgtype.Text `db:"value" json:"value"`
+	Tsv      interface{} `db:"tsv" json:"tsv"`
 }
 
 type AppValuesFloat struct {
@@ -113,6 +511,7 @@ type AppValuesText struct {
 	RowID    pgtype.UUID `db:"row_id" json:"row_id"`
 	ColumnID int64       `db:"column_id" json:"column_id"`
 	Value    pgtype.Text `db:"value" json:"value"`
+	Tsv      interface{} `db:"tsv" json:"tsv"`
 }
 
 type AppValuesUuid struct {
@@ -121,6 +520,36 @@ type AppValuesUuid struct {
 	Value    pgtype.UUID `db:"value" json:"value"`
 }
 
+type AppWebhook struct {
+	ID               pgtype.UUID        `db:"id" json:"id"`
+	OrgID            pgtype.UUID        `db:"org_id" json:"org_id"`
+	Name             string             `db:"name" json:"name"`
+	Url              string             `db:"url" json:"url"`
+	Secret           string             `db:"secret" json:"secret"`
+	Events           []string           `db:"events" json:"events"`
+	TableID          pgtype.Int8        `db:"table_id" json:"table_id"`
+	FilterExpression pgtype.Text        `db:"filter_expression" json:"filter_expression"`
+	FilterSql        pgtype.Text        `db:"filter_sql" json:"filter_sql"`
+	FilterRefs       []string           `db:"filter_refs" json:"filter_refs"`
+	Active           bool               `db:"active" json:"active"`
+	CreatedAt        pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type AppWebhookDelivery struct {
+	ID            int64              `db:"id" json:"id"`
+	OrgID         pgtype.UUID        `db:"org_id" json:"org_id"`
+	WebhookID     pgtype.UUID        `db:"webhook_id" json:"webhook_id"`
+	EventID       int64              `db:"event_id" json:"event_id"`
+	Status        string             `db:"status" json:"status"`
+	Attempts      int32              `db:"attempts" json:"attempts"`
+	NextAttemptAt pgtype.Timestamptz `db:"next_attempt_at" json:"next_attempt_at"`
+	LastStatus    pgtype.Int4        `db:"last_status" json:"last_status"`
+	LastError     pgtype.Text        `db:"last_error" json:"last_error"`
+	DeliveredAt   pgtype.Timestamptz `db:"delivered_at" json:"delivered_at"`
+	CreatedAt     pgtype.Timestamptz `db:"created_at" json:"created_at"`
+}
+
 type Identity struct {
 	ID       pgtype.UUID `db:"id" json:"id"`
 	UserID   pgtype.UUID `db:"user_id" json:"user_id"`
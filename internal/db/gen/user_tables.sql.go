@@ -23,15 +23,21 @@ WITH params AS (
     $7::jsonb   AS enum_values,
     $8::boolean AS is_reference,
     $9::text AS reference_table,
-    $10::boolean AS require_different_table
+    $10::boolean AS require_different_table,
+    $11::text AS kind,
+    $12::text AS expression,
+    $13::text AS expression_sql,
+    $14::bigint AS rollup_via_column_id,
+    $15::bigint AS rollup_target_column_id,
+    $16::text AS rollup_aggregate,
+    $17::jsonb AS rollup_filter
 ),
 table_id AS (
   SELECT id
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 cname AS (
@@ -46,14 +52,15 @@ ref_table_id AS (
     FROM app.tables t
     WHERE (t.slug = lower((SELECT ref FROM refname))
            OR lower(t.name) = lower((SELECT ref FROM refname)))
-      AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-    ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+      AND t.org_id = (SELECT org_id FROM params)
     LIMIT 1
   ) AS id
 ),
 ins AS (
   INSERT INTO app.columns (
-    table_id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table
+    table_id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table,
+    kind, expression, expression_sql,
+    rollup_via_column_id, rollup_target_column_id, rollup_aggregate, rollup_filter
   )
   SELECT 
     (SELECT id FROM table_id),
@@ -68,23 +75,40 @@ ins AS (
     ),
     (SELECT is_reference FROM params),
     (SELECT id FROM ref_table_id),
-    (SELECT require_different_table FROM params)
+    (SELECT require_different_table FROM params),
+    (SELECT kind FROM params),
+    (SELECT expression FROM params),
+    (SELECT expression_sql FROM params),
+    (SELECT rollup_via_column_id FROM params),
+    (SELECT rollup_target_column_id FROM params),
+    (SELECT rollup_aggregate FROM params),
+    (SELECT rollup_filter FROM params)
   ON CONFLICT (table_id, name) DO NOTHING
-  RETURNING id, table_id, name, type::text AS type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table
+  RETURNING id, table_id, name, type::text AS type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table,
+            kind, expression, rollup_via_column_id, rollup_target_column_id, rollup_aggregate, rollup_filter
 ),
 _ensure AS (
   SELECT CASE WHEN (SELECT is_indexed FROM params) THEN app.ensure_index(id) END FROM ins
 )
 SELECT true AS created,
-       id, table_id, name, type, is_required, is_indexed, to_jsonb(enum_values) AS enum_values,
-       is_reference, reference_table_id, require_different_table
+       ins.id, ins.table_id, ins.name, ins.type, ins.is_required, ins.is_indexed, to_jsonb(ins.enum_values) AS enum_values,
+       ins.is_reference, ins.reference_table_id, ins.require_different_table, ins.kind, ins.expression,
+       ins.rollup_aggregate, rt.slug AS rollup_table, rv.name AS rollup_via, rtc.name AS rollup_target, ins.rollup_filter
 FROM ins
+LEFT JOIN app.columns rv  ON rv.id = ins.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = ins.rollup_target_column_id
 UNION ALL
 SELECT false AS created,
        c.id, c.table_id, c.name, c.type::text AS type, c.is_required, c.is_indexed, to_jsonb(c.enum_values) AS enum_values,
-       c.is_reference, c.reference_table_id, c.require_different_table
-FROM app.columns c, cname
-WHERE c.table_id = (SELECT id FROM table_id) AND c.name = (SELECT name FROM cname)
+       c.is_reference, c.reference_table_id, c.require_different_table, c.kind, c.expression,
+       c.rollup_aggregate, rt.slug AS rollup_table, rv.name AS rollup_via, rtc.name AS rollup_target, c.rollup_filter
+FROM app.columns c
+CROSS JOIN cname
+LEFT JOIN app.columns rv  ON rv.id = c.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = c.rollup_target_column_id
+WHERE c.table_id = (SELECT id FROM table_id) AND c.name = cname.name
 LIMIT 1
 `
 
@@ -99,6 +123,13 @@ type AddUserTableColumnParams struct {
 	IsReference           bool        `db:"is_reference" json:"is_reference"`
 	ReferenceTable        string      `db:"reference_table" json:"reference_table"`
 	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+	Kind                  string      `db:"kind" json:"kind"`
+	Expression            pgtype.Text `db:"expression" json:"expression"`
+	ExpressionSql         pgtype.Text `db:"expression_sql" json:"expression_sql"`
+	RollupViaColumnID     pgtype.Int8 `db:"rollup_via_column_id" json:"rollup_via_column_id"`
+	RollupTargetColumnID  pgtype.Int8 `db:"rollup_target_column_id" json:"rollup_target_column_id"`
+	RollupAggregate       pgtype.Text `db:"rollup_aggregate" json:"rollup_aggregate"`
+	RollupFilter          []byte      `db:"rollup_filter" json:"rollup_filter"`
 }
 
 type AddUserTableColumnRow struct {
@@ -113,6 +144,13 @@ type AddUserTableColumnRow struct {
 	IsReference           bool        `db:"is_reference" json:"is_reference"`
 	ReferenceTableID      pgtype.Int8 `db:"reference_table_id" json:"reference_table_id"`
 	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+	Kind                  string      `db:"kind" json:"kind"`
+	Expression            pgtype.Text `db:"expression" json:"expression"`
+	RollupAggregate       pgtype.Text `db:"rollup_aggregate" json:"rollup_aggregate"`
+	RollupTable           pgtype.Text `db:"rollup_table" json:"rollup_table"`
+	RollupVia             pgtype.Text `db:"rollup_via" json:"rollup_via"`
+	RollupTarget          pgtype.Text `db:"rollup_target" json:"rollup_target"`
+	RollupFilter          []byte      `db:"rollup_filter" json:"rollup_filter"`
 }
 
 func (q *Queries) AddUserTableColumn(ctx context.Context, arg AddUserTableColumnParams) (AddUserTableColumnRow, error) {
@@ -127,6 +165,13 @@ func (q *Queries) AddUserTableColumn(ctx context.Context, arg AddUserTableColumn
 		arg.IsReference,
 		arg.ReferenceTable,
 		arg.RequireDifferentTable,
+		arg.Kind,
+		arg.Expression,
+		arg.ExpressionSql,
+		arg.RollupViaColumnID,
+		arg.RollupTargetColumnID,
+		arg.RollupAggregate,
+		arg.RollupFilter,
 	)
 	var i AddUserTableColumnRow
 	err := row.Scan(
@@ -141,6 +186,13 @@ func (q *Queries) AddUserTableColumn(ctx context.Context, arg AddUserTableColumn
 		&i.IsReference,
 		&i.ReferenceTableID,
 		&i.RequireDifferentTable,
+		&i.Kind,
+		&i.Expression,
+		&i.RollupAggregate,
+		&i.RollupTable,
+		&i.RollupVia,
+		&i.RollupTarget,
+		&i.RollupFilter,
 	)
 	return i, err
 }
@@ -160,6 +212,8 @@ label_col AS (
   FROM app.columns c
   WHERE c.table_id = (SELECT table_id FROM params)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
@@ -169,17 +223,16 @@ label_col AS (
 rows AS (
   SELECT r.id AS row_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   JOIN input i ON i.row_id = r.id
   WHERE r.table_id = (SELECT table_id FROM params)
-    AND t.org_id = (SELECT org_id FROM params)
+    AND r.org_id = (SELECT org_id FROM params)
+    AND r.id IN (SELECT app.visible_rows((SELECT table_id FROM params), ARRAY(SELECT row_id FROM input)))
 )
 SELECT 
   rows.row_id,
-  COALESCE(vt.value, ve.value) AS label
+  label
 FROM rows
-LEFT JOIN app.values_text vt ON vt.row_id = rows.row_id AND vt.column_id = (SELECT id FROM label_col)
-LEFT JOIN app.values_enum ve ON ve.row_id = rows.row_id AND ve.column_id = (SELECT id FROM label_col)
+CROSS JOIN LATERAL app.cell_text(rows.row_id, (SELECT id FROM label_col)) AS label
 `
 
 type BatchGetRowLabelsParams struct {
@@ -217,7 +270,8 @@ const batchGetRowLabelsAuto = `-- name: BatchGetRowLabelsAuto :many
 WITH params AS (
   SELECT
     $1::uuid AS org_id,
-    $2::jsonb   AS ids
+    $2::jsonb   AS ids,
+    $3::bigint[] AS table_ids
 ),
 input AS (
   SELECT (jsonb_array_elements_text((SELECT ids FROM params)))::uuid AS row_id
@@ -225,13 +279,17 @@ input AS (
 rows AS (
   SELECT r.id AS row_id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id AND t.org_id = (SELECT org_id FROM params)
   JOIN input i ON i.row_id = r.id
+  WHERE r.org_id = (SELECT org_id FROM params)
+    AND r.table_id = ANY((SELECT table_ids FROM params))
+    AND app.row_visible(r.id)
 ),
 label_col AS (
   SELECT DISTINCT ON (c.table_id) c.table_id, c.id AS label_col_id
   FROM app.columns c
   WHERE c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY c.table_id,
     (lower(c.name) = 'title') DESC,
     c.is_indexed DESC,
@@ -239,16 +297,16 @@ label_col AS (
 )
 SELECT 
   rows.row_id,
-  COALESCE(vt.value, ve.value) AS label
+  label
 FROM rows
 LEFT JOIN label_col lc ON lc.table_id = rows.table_id
-LEFT JOIN app.values_text vt ON vt.row_id = rows.row_id AND vt.column_id = lc.label_col_id
-LEFT JOIN app.values_enum ve ON ve.row_id = rows.row_id AND ve.column_id = lc.label_col_id
+CROSS JOIN LATERAL app.cell_text(rows.row_id, lc.label_col_id) AS label
 `
 
 type BatchGetRowLabelsAutoParams struct {
-	OrgID pgtype.UUID `db:"org_id" json:"org_id"`
-	Ids   []byte      `db:"ids" json:"ids"`
+	OrgID    pgtype.UUID `db:"org_id" json:"org_id"`
+	Ids      []byte      `db:"ids" json:"ids"`
+	TableIds []int64     `db:"table_ids" json:"table_ids"`
 }
 
 type BatchGetRowLabelsAutoRow struct {
@@ -257,7 +315,7 @@ type BatchGetRowLabelsAutoRow struct {
 }
 
 func (q *Queries) BatchGetRowLabelsAuto(ctx context.Context, arg BatchGetRowLabelsAutoParams) ([]BatchGetRowLabelsAutoRow, error) {
-	rows, err := q.db.Query(ctx, batchGetRowLabelsAuto, arg.OrgID, arg.Ids)
+	rows, err := q.db.Query(ctx, batchGetRowLabelsAuto, arg.OrgID, arg.Ids, arg.TableIds)
 	if err != nil {
 		return nil, err
 	}
@@ -393,6 +451,7 @@ target AS (
   FROM app.rows r
   WHERE r.id = (SELECT row_id FROM params)
     AND r.table_id = (SELECT id FROM table_id)
+    AND app.row_visible(r.id)
 ),
 del AS (
   DELETE FROM app.rows r
@@ -423,15 +482,15 @@ func (q *Queries) DeleteUserTableRow(ctx context.Context, arg DeleteUserTableRow
 
 const getRowData = `-- name: GetRowData :one
 WITH r AS (
-  SELECT r.id
+  SELECT r.id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   WHERE r.id = $1::uuid
-    AND t.org_id = $2::uuid
+    AND r.org_id = $2::uuid
+    AND app.row_visible(r.id)
 )
 SELECT EXISTS(SELECT 1 FROM r) AS found,
        CASE WHEN EXISTS(SELECT 1 FROM r)
-            THEN app.row_to_json($1::uuid)
+            THEN app.mask_fields((SELECT table_id FROM r), app.row_to_json($1::uuid))
             ELSE NULL
        END AS data
 `
@@ -454,39 +513,29 @@ func (q *Queries) GetRowData(ctx context.Context, arg GetRowDataParams) (GetRowD
 }
 
 const getRowLabel = `-- name: GetRowLabel :one
-WITH label_col AS (
+WITH r AS (
+  SELECT r.id, r.table_id
+  FROM app.rows r
+  WHERE r.id = $1::uuid
+    AND r.table_id = $2::bigint
+    AND r.org_id = $3::uuid
+    AND app.row_visible(r.id)
+),
+label_col AS (
   SELECT c.id, c.name, c.type::text AS type
   FROM app.columns c
-  WHERE c.table_id = $2::bigint
+  WHERE c.table_id = (SELECT table_id FROM r)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
     c.id
   LIMIT 1
 )
-SELECT COALESCE(
-  (
-    SELECT vt.value
-    FROM app.values_text vt
-    JOIN app.rows r ON r.id = vt.row_id
-    JOIN app.tables t ON t.id = r.table_id
-    WHERE vt.row_id = $1::uuid
-      AND vt.column_id = (SELECT id FROM label_col)
-      AND r.table_id = $2::bigint
-      AND t.org_id = $3::uuid
-  ),
-  (
-    SELECT ve.value
-    FROM app.values_enum ve
-    JOIN app.rows r ON r.id = ve.row_id
-    JOIN app.tables t ON t.id = r.table_id
-    WHERE ve.row_id = $1::uuid
-      AND ve.column_id = (SELECT id FROM label_col)
-      AND r.table_id = $2::bigint
-      AND t.org_id = $3::uuid
-  )
-) AS label
+SELECT label
+FROM app.cell_text((SELECT id FROM r), (SELECT id FROM label_col)) AS label
 `
 
 type GetRowLabelParams struct {
@@ -495,9 +544,9 @@ type GetRowLabelParams struct {
 	OrgID   pgtype.UUID `db:"org_id" json:"org_id"`
 }
 
-func (q *Queries) GetRowLabel(ctx context.Context, arg GetRowLabelParams) (interface{}, error) {
+func (q *Queries) GetRowLabel(ctx context.Context, arg GetRowLabelParams) (pgtype.Text, error) {
 	row := q.db.QueryRow(ctx, getRowLabel, arg.RowID, arg.TableID, arg.OrgID)
-	var label interface{}
+	var label pgtype.Text
 	err := row.Scan(&label)
 	return label, err
 }
@@ -506,35 +555,25 @@ const getRowLabelAuto = `-- name: GetRowLabelAuto :one
 WITH r AS (
   SELECT r.id, r.table_id
   FROM app.rows r
-  JOIN app.tables t ON t.id = r.table_id
   WHERE r.id = $1::uuid
-    AND t.org_id = $2::uuid
+    AND r.org_id = $2::uuid
+    AND app.row_visible(r.id)
 ),
 label_col AS (
   SELECT c.id, c.name, c.type::text AS type
   FROM app.columns c
   WHERE c.table_id = (SELECT table_id FROM r)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
     CASE WHEN c.is_indexed THEN 0 ELSE 1 END,
     c.id
   LIMIT 1
 )
-SELECT COALESCE(
-  (
-    SELECT vt.value
-    FROM app.values_text vt
-    WHERE vt.row_id = (SELECT id FROM r)
-      AND vt.column_id = (SELECT id FROM label_col)
-  ),
-  (
-    SELECT ve.value
-    FROM app.values_enum ve
-    WHERE ve.row_id = (SELECT id FROM r)
-      AND ve.column_id = (SELECT id FROM label_col)
-  )
-) AS label
+SELECT label
+FROM app.cell_text((SELECT id FROM r), (SELECT id FROM label_col)) AS label
 `
 
 type GetRowLabelAutoParams struct {
@@ -542,9 +581,9 @@ type GetRowLabelAutoParams struct {
 	OrgID pgtype.UUID `db:"org_id" json:"org_id"`
 }
 
-func (q *Queries) GetRowLabelAuto(ctx context.Context, arg GetRowLabelAutoParams) (interface{}, error) {
+func (q *Queries) GetRowLabelAuto(ctx context.Context, arg GetRowLabelAutoParams) (pgtype.Text, error) {
 	row := q.db.QueryRow(ctx, getRowLabelAuto, arg.RowID, arg.OrgID)
-	var label interface{}
+	var label pgtype.Text
 	err := row.Scan(&label)
 	return label, err
 }
@@ -560,8 +599,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 )
 SELECT 
@@ -573,9 +611,28 @@ SELECT
   to_jsonb(c.enum_values) AS enum_values,
   c.is_reference,
   c.reference_table_id,
-  c.require_different_table
+  c.require_different_table,
+  c.kind,
+  c.expression,
+  c.rollup_aggregate,
+  rt.slug  AS rollup_table,
+  rv.name  AS rollup_via,
+  rtc.name AS rollup_target,
+  c.rollup_filter,
+  COALESCE(c.read_role::text, '')::text AS read_role,
+  COALESCE(c.edit_role::text, '')::text AS edit_role,
+  c.masked,
+  app.field_visible(c.read_role) AS visible,
+  app.field_editable(c.read_role, c.edit_role) AS editable
 FROM app.columns c
+LEFT JOIN app.columns rv  ON rv.id = c.rollup_via_column_id
+LEFT JOIN app.tables rt   ON rt.id = rv.table_id
+LEFT JOIN app.columns rtc ON rtc.id = c.rollup_target_column_id
 WHERE c.table_id = (SELECT id FROM table_id)
+  -- columns hidden from the caller are left out unless they are masked
+  AND (c.masked OR app.field_visible(c.read_role))
+  -- as are aggregates over rows the caller may not all see
+  AND NOT app.aggregate_restricted(c.id)
 ORDER BY c.id ASC
 `
 
@@ -594,6 +651,18 @@ type GetUserTableSchemaRow struct {
 	IsReference           bool        `db:"is_reference" json:"is_reference"`
 	ReferenceTableID      pgtype.Int8 `db:"reference_table_id" json:"reference_table_id"`
 	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+	Kind                  string      `db:"kind" json:"kind"`
+	Expression            pgtype.Text `db:"expression" json:"expression"`
+	RollupAggregate       pgtype.Text `db:"rollup_aggregate" json:"rollup_aggregate"`
+	RollupTable           pgtype.Text `db:"rollup_table" json:"rollup_table"`
+	RollupVia             pgtype.Text `db:"rollup_via" json:"rollup_via"`
+	RollupTarget          pgtype.Text `db:"rollup_target" json:"rollup_target"`
+	RollupFilter          []byte      `db:"rollup_filter" json:"rollup_filter"`
+	ReadRole              string      `db:"read_role" json:"read_role"`
+	EditRole              string      `db:"edit_role" json:"edit_role"`
+	Masked                bool        `db:"masked" json:"masked"`
+	Visible               bool        `db:"visible" json:"visible"`
+	Editable              bool        `db:"editable" json:"editable"`
 }
 
 func (q *Queries) GetUserTableSchema(ctx context.Context, arg GetUserTableSchemaParams) ([]GetUserTableSchemaRow, error) {
@@ -615,6 +684,18 @@ func (q *Queries) GetUserTableSchema(ctx context.Context, arg GetUserTableSchema
 			&i.IsReference,
 			&i.ReferenceTableID,
 			&i.RequireDifferentTable,
+			&i.Kind,
+			&i.Expression,
+			&i.RollupAggregate,
+			&i.RollupTable,
+			&i.RollupVia,
+			&i.RollupTarget,
+			&i.RollupFilter,
+			&i.ReadRole,
+			&i.EditRole,
+			&i.Masked,
+			&i.Visible,
+			&i.Editable,
 		); err != nil {
 			return nil, err
 		}
@@ -638,15 +719,17 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 ins AS (
-  SELECT app.insert_row((SELECT id FROM table_id), (SELECT values FROM params)) AS row_id
+  SELECT app.insert_row(
+           (SELECT id FROM table_id),
+           app.check_field_writes((SELECT id FROM table_id), (SELECT values FROM params))
+         ) AS row_id
 )
 SELECT i.row_id,
-       app.row_to_json(i.row_id) AS data
+       app.mask_fields((SELECT id FROM table_id), app.row_to_json(i.row_id)) AS data
 FROM ins i
 `
 
@@ -681,6 +764,8 @@ JOIN app.columns c ON c.table_id = t.id
 WHERE t.org_id = $1::uuid
   AND c.is_indexed
   AND c.type IN ('text','enum')
+  AND c.kind = 'value'
+  AND app.field_visible(c.read_role)
 ORDER BY t.name ASC, c.name ASC
 `
 
@@ -773,8 +858,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 label_col AS (
@@ -782,6 +866,8 @@ label_col AS (
   FROM app.columns c
   WHERE c.table_id = (SELECT id FROM table_id)
     AND c.type IN ('text','enum')
+    AND c.kind = 'value'
+    AND app.field_visible(c.read_role)
     AND ((SELECT field FROM params) IS NULL OR lower(c.name) = lower((SELECT field FROM params)))
   ORDER BY 
     CASE WHEN lower(c.name) = 'title' THEN 0 ELSE 1 END,
@@ -805,9 +891,17 @@ results AS (
     AND ve.column_id = (SELECT id FROM label_col)
     AND r.table_id = (SELECT id FROM table_id)
     AND ((SELECT q FROM params) IS NULL OR ve.value ILIKE '%' || (SELECT q FROM params) || '%')
+  UNION ALL
+  SELECT pv.row_id, pv.value AS label
+  FROM app.physical_text_values((SELECT id FROM label_col), (SELECT q FROM params), NULL) pv
+),
+scope AS (
+  SELECT app.rows_restricted(id) AS restricted FROM table_id
 )
 SELECT row_id, label
 FROM results
+WHERE NOT (SELECT restricted FROM scope)
+   OR row_id IN (SELECT app.visible_rows((SELECT id FROM table_id)))
 ORDER BY label ASC NULLS LAST
 LIMIT (SELECT lim FROM params)
 `
@@ -851,6 +945,45 @@ func (q *Queries) LookupIndexedRows(ctx context.Context, arg LookupIndexedRowsPa
 	return items, nil
 }
 
+const referencingRows = `-- name: ReferencingRows :many
+SELECT x.id::uuid AS id
+FROM app.referencing_rows($1::bigint, $2::uuid) x(id)
+`
+
+type ReferencingRowsParams struct {
+	ColumnID int64       `db:"column_id" json:"column_id"`
+	Target   pgtype.UUID `db:"target" json:"target"`
+}
+
+func (q *Queries) ReferencingRows(ctx context.Context, arg ReferencingRowsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, referencingRows, arg.ColumnID, arg.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const refreshRollupColumn = `-- name: RefreshRollupColumn :exec
+SELECT app.refresh_rollup_column($1::bigint)
+`
+
+func (q *Queries) RefreshRollupColumn(ctx context.Context, columnID int64) error {
+	_, err := q.db.Exec(ctx, refreshRollupColumn, columnID)
+	return err
+}
+
 const removeUserTableColumn = `-- name: RemoveUserTableColumn :one
 WITH params AS (
   SELECT
@@ -863,8 +996,7 @@ table_id AS (
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
-    AND (t.org_id = (SELECT org_id FROM params) OR t.org_id IS NULL)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
+    AND t.org_id = (SELECT org_id FROM params)
   LIMIT 1
 ),
 cname AS (
@@ -872,7 +1004,8 @@ cname AS (
 ),
 target AS (
   SELECT c.id, c.table_id, c.name, c.type::text AS type, c.is_required, c.is_indexed,
-         c.enum_values, c.is_reference, c.reference_table_id, c.require_different_table
+         c.enum_values, c.is_reference, c.reference_table_id, c.require_different_table,
+         c.kind, c.expression
   FROM app.columns c
   WHERE c.table_id = (SELECT id FROM table_id) AND c.name = (SELECT name FROM cname)
   LIMIT 1
@@ -893,7 +1026,9 @@ SELECT
   to_jsonb((SELECT enum_values FROM target)) AS enum_values,
   (SELECT is_reference FROM target) AS is_reference,
   (SELECT reference_table_id FROM target) AS reference_table_id,
-  (SELECT require_different_table FROM target) AS require_different_table
+  (SELECT require_different_table FROM target) AS require_different_table,
+  (SELECT kind FROM target) AS kind,
+  (SELECT expression FROM target) AS expression
 `
 
 type RemoveUserTableColumnParams struct {
@@ -914,6 +1049,8 @@ type RemoveUserTableColumnRow struct {
 	IsReference           bool        `db:"is_reference" json:"is_reference"`
 	ReferenceTableID      pgtype.Int8 `db:"reference_table_id" json:"reference_table_id"`
 	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+	Kind                  string      `db:"kind" json:"kind"`
+	Expression            pgtype.Text `db:"expression" json:"expression"`
 }
 
 func (q *Queries) RemoveUserTableColumn(ctx context.Context, arg RemoveUserTableColumnParams) (RemoveUserTableColumnRow, error) {
@@ -931,6 +1068,8 @@ func (q *Queries) RemoveUserTableColumn(ctx context.Context, arg RemoveUserTable
 		&i.IsReference,
 		&i.ReferenceTableID,
 		&i.RequireDifferentTable,
+		&i.Kind,
+		&i.Expression,
 	)
 	return i, err
 }
@@ -943,12 +1082,11 @@ WITH params AS (
     $3::uuid     AS org_id
 ),
 table_id AS (
-  SELECT id
+  SELECT id, storage_mode
   FROM app.tables t
   WHERE (t.slug = lower((SELECT table_name FROM params))
          OR lower(t.name) = lower((SELECT table_name FROM params)))
     AND t.org_id = (SELECT org_id FROM params)
-  ORDER BY CASE WHEN t.org_id = (SELECT org_id FROM params) THEN 0 ELSE 1 END
   LIMIT 1
 ),
 page AS (
@@ -962,14 +1100,47 @@ ff AS (
   FROM params
   WHERE (p ? 'filterFields') AND jsonb_typeof(p->'filterFields') = 'array'
 ),
+  -- "under" filters match a row and, when its table has a hierarchy, the rows
+  -- below it; each set is computed once
+under AS (
+  SELECT ff.f,
+         ARRAY(SELECT app.row_and_descendants(c.reference_table_id, (ff.f->>'value')::uuid)) AS ids
+  FROM ff
+  JOIN app.columns c ON c.table_id = (SELECT id FROM table_id)
+    AND lower(c.name) = lower(ff.f->>'field')
+  WHERE c.type = 'uuid' AND ff.f->>'operation' = 'under'
+),
+sort AS (
+  SELECT
+    NULLIF(lower(p->>'sortField'), '')                AS field,
+    lower(COALESCE(p->>'sortDirection', 'asc')) = 'desc' AS descending
+  FROM params
+),
+sort_col AS (
+  SELECT c.id
+  FROM app.columns c
+  WHERE c.table_id = (SELECT id FROM table_id)
+    AND c.name = (SELECT field FROM sort)
+),
+scope AS (
+  SELECT app.rows_restricted(id) AS restricted FROM table_id
+),
+  -- Rows are filtered and sorted on single cells; only the page is composed
 filtered AS (
   SELECT 
     b.id,
     b.created_at,
-    app.row_to_json(b.id) as data,
+    NULLIF(CASE
+      WHEN (SELECT field FROM sort) = 'id' THEN to_jsonb(b.id)
+      WHEN (SELECT field FROM sort) = 'created_at' THEN to_jsonb(b.created_at)
+      WHEN (SELECT id FROM sort_col) IS NOT NULL THEN app.cell_value(b.id, (SELECT id FROM sort_col))
+    END, 'null'::jsonb) AS sort_key,
     COUNT(*) OVER() AS total_count
   FROM app.rows b
   WHERE b.table_id = (SELECT id FROM table_id)
+  AND (SELECT storage_mode FROM table_id) <> 'relational'
+  AND (NOT (SELECT restricted FROM scope)
+       OR b.id IN (SELECT app.visible_rows((SELECT id FROM table_id))))
   AND (
     NOT EXISTS (SELECT 1 FROM ff) OR
     EXISTS (
@@ -979,6 +1150,8 @@ filtered AS (
         AND lower(c.name) = lower(f->>'field')
       WHERE 
         CASE
+          WHEN c.kind IN ('computed', 'rollup') THEN
+            COALESCE(app.match_computed(app.cell_value(b.id, c.id), f), FALSE)
           WHEN c.type = 'text' THEN EXISTS (
             SELECT 1 FROM app.values_text vt
             WHERE vt.row_id = b.id AND vt.column_id = c.id AND (
@@ -1005,19 +1178,61 @@ filtered AS (
             WHERE vb.row_id = b.id AND vb.column_id = c.id 
             AND vb.value IS NOT DISTINCT FROM ((f->>'value')::boolean)
           )
+          WHEN c.type = 'uuid' THEN EXISTS (
+            SELECT 1 FROM app.values_uuid vu
+            WHERE vu.row_id = b.id AND vu.column_id = c.id AND (
+              CASE COALESCE(f->>'operation','eq')
+                WHEN 'eq' THEN vu.value = (f->>'value')::uuid
+                WHEN 'in' THEN vu.value = ANY(ARRAY(SELECT jsonb_array_elements_text(f->'values'))::uuid[])
+                WHEN 'under' THEN vu.value = ANY((SELECT u.ids FROM under u WHERE u.f = ff.f))
+                ELSE TRUE
+              END
+            )
+          )
           ELSE TRUE
         END
     )
   )
+),
+eav_ids AS (
+  SELECT f.id, f.created_at, f.total_count
+  FROM filtered f
+  ORDER BY
+    CASE WHEN NOT (SELECT descending FROM sort) THEN f.sort_key END ASC NULLS LAST,
+    CASE WHEN (SELECT descending FROM sort) THEN f.sort_key END DESC NULLS LAST,
+    f.created_at DESC
+  LIMIT (SELECT page_size FROM page)
+  OFFSET (SELECT page_size * page_num FROM page)
+),
+eav_page AS (
+  SELECT e.id AS row_id, e.created_at, j.data::jsonb AS data, e.total_count
+  FROM eav_ids e
+  JOIN app.rows_to_json((SELECT id FROM table_id), ARRAY(SELECT id FROM eav_ids)) AS j(row_id, data)
+    ON j.row_id = e.id
+),
+  -- Relational tables are filtered, sorted and paged by the engine itself
+relational_page AS (
+  SELECT s.row_id, s.created_at, s.data, s.total_count
+  FROM app.search_relational((SELECT id FROM table_id), (SELECT p FROM params))
+       AS s(row_id, created_at, data, total_count)
+  WHERE (SELECT storage_mode FROM table_id) = 'relational'
+),
+results AS (
+  SELECT row_id, created_at, data, total_count FROM eav_page
+  UNION ALL
+  SELECT row_id, created_at, data, total_count FROM relational_page
 )
 SELECT 
-  f.id AS row_id,
-  f.data,
-  f.total_count
-FROM filtered f
-ORDER BY f.created_at DESC
-LIMIT (SELECT page_size FROM page)
-OFFSET (SELECT page_size * page_num FROM page)
+  r.row_id,
+  app.mask_fields((SELECT id FROM table_id), r.data) AS data,
+  r.total_count
+FROM results r
+ORDER BY
+  CASE WHEN NOT (SELECT descending FROM sort)
+       THEN NULLIF(r.data -> (SELECT field FROM sort), 'null'::jsonb) END ASC NULLS LAST,
+  CASE WHEN (SELECT descending FROM sort)
+       THEN NULLIF(r.data -> (SELECT field FROM sort), 'null'::jsonb) END DESC NULLS LAST,
+  r.created_at DESC
 `
 
 type SearchUserTableParams struct {
@@ -1051,3 +1266,186 @@ func (q *Queries) SearchUserTable(ctx context.Context, arg SearchUserTableParams
 	}
 	return items, nil
 }
+
+const setColumnAccess = `-- name: SetColumnAccess :one
+UPDATE app.columns c
+SET read_role = $1::text::org_role,
+    edit_role = $2::text::org_role,
+    masked    = $3::boolean
+FROM app.tables t
+WHERE t.id = c.table_id
+  AND t.org_id = $4::uuid
+  AND (t.slug = lower($5::text) OR lower(t.name) = lower($5::text))
+  AND c.name = lower($6::text)
+RETURNING c.id
+`
+
+type SetColumnAccessParams struct {
+	ReadRole   pgtype.Text `db:"read_role" json:"read_role"`
+	EditRole   pgtype.Text `db:"edit_role" json:"edit_role"`
+	Masked     bool        `db:"masked" json:"masked"`
+	OrgID      pgtype.UUID `db:"org_id" json:"org_id"`
+	TableName  string      `db:"table_name" json:"table_name"`
+	ColumnName string      `db:"column_name" json:"column_name"`
+}
+
+// Replaces the field-level access rules of a column.
+func (q *Queries) SetColumnAccess(ctx context.Context, arg SetColumnAccessParams) (int64, error) {
+	row := q.db.QueryRow(ctx, setColumnAccess,
+		arg.ReadRole,
+		arg.EditRole,
+		arg.Masked,
+		arg.OrgID,
+		arg.TableName,
+		arg.ColumnName,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const updateUserTableColumn = `-- name: UpdateUserTableColumn :one
+WITH params AS (
+  SELECT
+    $1::uuid     AS org_id,
+    $2::text AS table_name,
+    $3::text AS column_name,
+    $4::boolean AS is_required,
+    $5::boolean  AS is_indexed,
+    $6::jsonb  AS enum_values,
+    $7::boolean AS require_different_table
+),
+upd AS (
+  UPDATE app.columns c
+  SET is_required = p.is_required,
+      is_indexed  = p.is_indexed,
+      enum_values = CASE WHEN c.type = 'enum' AND p.enum_values IS NOT NULL
+                         THEN ARRAY(SELECT jsonb_array_elements_text(p.enum_values))
+                         ELSE c.enum_values END,
+      require_different_table = p.require_different_table
+  FROM params p, app.tables t
+  WHERE t.id = c.table_id
+    AND t.org_id = p.org_id
+    AND (t.slug = lower(p.table_name) OR lower(t.name) = lower(p.table_name))
+    AND c.name = lower(p.column_name)
+    AND c.kind = 'value'
+  RETURNING c.id, c.name, c.type::text AS type, c.is_required, c.is_indexed, to_jsonb(c.enum_values) AS enum_values,
+            c.is_reference, c.reference_table_id, c.require_different_table, c.kind, c.expression
+),
+ensured AS (
+  -- referenced below so the planner cannot skip it
+  SELECT count(CASE WHEN is_indexed THEN app.ensure_index(id) END) AS n FROM upd
+)
+SELECT id, name, type, is_required, is_indexed, enum_values, is_reference, reference_table_id, require_different_table, kind, expression
+FROM upd, ensured
+`
+
+type UpdateUserTableColumnParams struct {
+	OrgID                 pgtype.UUID `db:"org_id" json:"org_id"`
+	TableName             string      `db:"table_name" json:"table_name"`
+	ColumnName            string      `db:"column_name" json:"column_name"`
+	IsRequired            bool        `db:"is_required" json:"is_required"`
+	IsIndexed             bool        `db:"is_indexed" json:"is_indexed"`
+	EnumValues            []byte      `db:"enum_values" json:"enum_values"`
+	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+}
+
+type UpdateUserTableColumnRow struct {
+	ID                    int64       `db:"id" json:"id"`
+	Name                  string      `db:"name" json:"name"`
+	Type                  string      `db:"type" json:"type"`
+	IsRequired            bool        `db:"is_required" json:"is_required"`
+	IsIndexed             bool        `db:"is_indexed" json:"is_indexed"`
+	EnumValues            []byte      `db:"enum_values" json:"enum_values"`
+	IsReference           bool        `db:"is_reference" json:"is_reference"`
+	ReferenceTableID      pgtype.Int8 `db:"reference_table_id" json:"reference_table_id"`
+	RequireDifferentTable bool        `db:"require_different_table" json:"require_different_table"`
+	Kind                  string      `db:"kind" json:"kind"`
+	Expression            pgtype.Text `db:"expression" json:"expression"`
+}
+
+// Adjusts the attributes of a value column that can change without
+// rewriting stored values. Only tables owned by the org are considered.
+func (q *Queries) UpdateUserTableColumn(ctx context.Context, arg UpdateUserTableColumnParams) (UpdateUserTableColumnRow, error) {
+	row := q.db.QueryRow(ctx, updateUserTableColumn,
+		arg.OrgID,
+		arg.TableName,
+		arg.ColumnName,
+		arg.IsRequired,
+		arg.IsIndexed,
+		arg.EnumValues,
+		arg.RequireDifferentTable,
+	)
+	var i UpdateUserTableColumnRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Type,
+		&i.IsRequired,
+		&i.IsIndexed,
+		&i.EnumValues,
+		&i.IsReference,
+		&i.ReferenceTableID,
+		&i.RequireDifferentTable,
+		&i.Kind,
+		&i.Expression,
+	)
+	return i, err
+}
+
+const updateUserTableRow = `-- name: UpdateUserTableRow :one
+WITH params AS (
+  SELECT
+    $1::uuid     AS org_id,
+    $2::text AS table_name,
+    $3::uuid     AS row_id,
+    $4::jsonb    AS values
+),
+table_id AS (
+  SELECT id
+  FROM app.tables t
+  WHERE (t.slug = lower((SELECT table_name FROM params))
+         OR lower(t.name) = lower((SELECT table_name FROM params)))
+    AND t.org_id = (SELECT org_id FROM params)
+  LIMIT 1
+),
+target AS (
+  SELECT r.id
+  FROM app.rows r
+  WHERE r.id = (SELECT row_id FROM params)
+    AND r.table_id = (SELECT id FROM table_id)
+    AND app.row_visible(r.id)
+),
+upd AS (
+  SELECT t.id AS row_id,
+         app.update_row(t.id, app.check_field_writes((SELECT id FROM table_id), (SELECT values FROM params))) AS updated
+  FROM target t
+)
+SELECT u.row_id,
+       app.mask_fields((SELECT id FROM table_id), app.row_to_json(u.row_id)) AS data
+FROM upd u
+`
+
+type UpdateUserTableRowParams struct {
+	OrgID     pgtype.UUID `db:"org_id" json:"org_id"`
+	TableName string      `db:"table_name" json:"table_name"`
+	RowID     pgtype.UUID `db:"row_id" json:"row_id"`
+	Values    []byte      `db:"values" json:"values"`
+}
+
+type UpdateUserTableRowRow struct {
+	RowID pgtype.UUID `db:"row_id" json:"row_id"`
+	Data  []byte      `db:"data" json:"data"`
+}
+
+func (q *Queries) UpdateUserTableRow(ctx context.Context, arg UpdateUserTableRowParams) (UpdateUserTableRowRow, error) {
+	row := q.db.QueryRow(ctx, updateUserTableRow,
+		arg.OrgID,
+		arg.TableName,
+		arg.RowID,
+		arg.Values,
+	)
+	var i UpdateUserTableRowRow
+	err := row.Scan(&i.RowID, &i.Data)
+	return i, err
+}
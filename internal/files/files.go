@@ -0,0 +1,299 @@
+// Package files stores uploaded files in a pluggable blob store and keeps
+// their metadata in app.files.
+//
+// Uploads are spooled to a temporary file while their SHA-256 is computed,
+// refused above the size limit, and typed by sniffing their content rather
+// than trusting the client. Content is stored once per org under
+// "<org id>/<sha256>", so uploading the same content again returns the file
+// already stored. Images get a JPEG thumbnail under "<org id>/<sha256>.thumb"
+// and their size; JPEG photos keep the GPS position and time of their EXIF
+// data.
+//
+// Files are downloaded by members of their org, or by anyone holding a
+// signed URL: an HMAC over the org, the file and an expiry, so a URL opens
+// one file of one org for a limited time.
+package files
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// Defaults of Options.
+const (
+	DefaultMaxSize = 25 << 20
+	DefaultURLTTL  = 15 * time.Minute
+)
+
+// exifWindow is how much of the start of a JPEG is searched for EXIF data,
+// which sits in the first 64 KiB segment.
+const exifWindow = 128 << 10
+
+// ErrTooLarge refuses an upload above the size limit.
+var ErrTooLarge = errors.New("file too large")
+
+// Error is an upload refused for its content, answered with 400.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func refuse(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// allowed lists the content types accepted, as sniffed. HTML, SVG and
+// scripts are left out so downloads cannot run in the app's origin.
+var allowed = map[string]bool{
+	"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true, "image/bmp": true,
+	"application/pdf": true, "text/plain": true, "text/csv": true,
+	"application/zip": true, "application/x-gzip": true,
+	"audio/mpeg": true, "audio/wave": true, "video/mp4": true, "video/webm": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+}
+
+// officeTypes refine zip archives by extension: Office documents are zips.
+var officeTypes = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// Sniff returns the content type of a file from its first bytes, refined
+// by its name where the content alone is ambiguous.
+func Sniff(head []byte, name string) string {
+	ct, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case ct == "application/zip" && officeTypes[ext] != "":
+		return officeTypes[ext]
+	case ct == "text/plain" && ext == ".csv":
+		return "text/csv"
+	}
+	return ct
+}
+
+// Options configure a Service.
+type Options struct {
+	MaxSize int64         // bytes per file; DefaultMaxSize when 0
+	Secret  []byte        // key of signed URLs; random, so URLs die with the process, when empty
+	URLTTL  time.Duration // life of signed URLs; DefaultURLTTL when 0
+	BaseURL string        // prefix of signed URLs, e.g. https://api.example.com
+}
+
+// Service stores files and serves their content.
+type Service struct {
+	repo  repo.Repo
+	store Store
+	opts  Options
+}
+
+func NewService(r repo.Repo, store Store, opts Options) *Service {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.URLTTL <= 0 {
+		opts.URLTTL = DefaultURLTTL
+	}
+	if len(opts.Secret) == 0 {
+		opts.Secret = make([]byte, 32)
+		_, _ = rand.Read(opts.Secret)
+		slog.Warn("files: no url secret configured; signed URLs will not survive a restart or work across servers")
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	return &Service{repo: r, store: store, opts: opts}
+}
+
+// MaxSize returns the size limit of uploads.
+func (s *Service) MaxSize() int64 { return s.opts.MaxSize }
+
+func blobKey(orgID uuid.UUID, sha string) string { return orgID.String() + "/" + sha }
+
+func thumbKey(orgID uuid.UUID, sha string) string { return blobKey(orgID, sha) + ".thumb" }
+
+// Upload stores a file read from body for userID, uuid.Nil for uploads
+// without an account, and returns it; false when the org already had a
+// file with the same content, which is returned instead.
+func (s *Service) Upload(ctx context.Context, orgID, userID uuid.UUID, name string, body io.Reader) (models.File, bool, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	name = cleanName(name)
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return models.File{}, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, s.opts.MaxSize+1))
+	if err != nil {
+		return models.File{}, false, err
+	}
+	if size > s.opts.MaxSize {
+		return models.File{}, false, ErrTooLarge
+	}
+	if size == 0 {
+		return models.File{}, false, refuse("the file is empty")
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+	if f, found, err := s.repo.GetFileBySHA256(ctx, orgID, sha); err != nil || found {
+		return f, false, err
+	}
+
+	head := make([]byte, min(size, exifWindow))
+	if _, err := tmp.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return models.File{}, false, err
+	}
+	f := models.File{Name: name, ContentType: Sniff(head, name), Size: size, SHA256: sha}
+	if userID != uuid.Nil {
+		f.CreatedBy = &userID
+	}
+	if !allowed[f.ContentType] {
+		return models.File{}, false, refuse("files of type %s are not accepted", f.ContentType)
+	}
+
+	turn := 0
+	if f.ContentType == "image/jpeg" {
+		g := readGeotag(head)
+		f.Latitude, f.Longitude, f.TakenAt = g.Latitude, g.Longitude, g.TakenAt
+		turn = orientation(head)
+	}
+	if strings.HasPrefix(f.ContentType, "image/") {
+		if w, ht, ok := imageSize(io.NewSectionReader(tmp, 0, size)); ok {
+			// The size of the photo as shown, upright
+			if turn >= 5 {
+				w, ht = ht, w
+			}
+			f.Width, f.Height = &w, &ht
+		}
+	}
+	if thumbnailable[f.ContentType] && f.Width != nil && *f.Width**f.Height <= maxPixels {
+		thumb, err := thumbnail(io.NewSectionReader(tmp, 0, size), turn)
+		if err != nil {
+			slog.WarnContext(ctx, "files: no thumbnail", "sha256", sha, "err", err)
+		} else if err := s.store.Put(ctx, thumbKey(orgID, sha), bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+			return models.File{}, false, err
+		} else {
+			f.Thumbnail = true
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return models.File{}, false, err
+	}
+	if err := s.store.Put(ctx, blobKey(orgID, sha), tmp, size, f.ContentType); err != nil {
+		return models.File{}, false, err
+	}
+	id, created, err := s.repo.InsertFile(ctx, orgID, f)
+	if err != nil {
+		return models.File{}, false, err
+	}
+	// created is false when a concurrent upload of the same content won.
+	f, _, err = s.repo.GetFile(ctx, orgID, id)
+	return f, created, err
+}
+
+// cleanName keeps the base name of an uploaded file, without control
+// characters, and at most 255 bytes long.
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, path.Base(strings.ReplaceAll(name, `\`, "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	for len(name) > 255 {
+		_, n := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-n]
+	}
+	return name
+}
+
+// Open returns the content of a file, or of its thumbnail.
+func (s *Service) Open(ctx context.Context, orgID uuid.UUID, f models.File, thumb bool) (io.ReadCloser, error) {
+	key := blobKey(orgID, f.SHA256)
+	if thumb {
+		if !f.Thumbnail {
+			return nil, ErrNotFound
+		}
+		key = thumbKey(orgID, f.SHA256)
+	}
+	return s.store.Get(ctx, key)
+}
+
+// Delete deletes a file, its links and its blobs.
+func (s *Service) Delete(ctx context.Context, orgID uuid.UUID, f models.File) (bool, error) {
+	deleted, err := s.repo.DeleteFile(repo.WithOrg(ctx, orgID), orgID, f.ID)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	for _, key := range []string{blobKey(orgID, f.SHA256), thumbKey(orgID, f.SHA256)} {
+		if err := s.store.Delete(ctx, key); err != nil {
+			slog.WarnContext(ctx, "files: blob left behind", "key", key, "err", err)
+		}
+	}
+	return true, nil
+}
+
+// Signed URL variants.
+const (
+	VariantContent   = "content"
+	VariantThumbnail = "thumbnail"
+)
+
+// SignedURL returns a URL downloading a file, or its thumbnail, without a
+// session until it expires.
+func (s *Service) SignedURL(orgID, fileID uuid.UUID, variant string, now time.Time) (string, time.Time) {
+	expires := now.Add(s.opts.URLTTL).Truncate(time.Second)
+	q := url.Values{}
+	q.Set("org", orgID.String())
+	q.Set("variant", variant)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", s.sign(orgID, fileID, variant, expires.Unix()))
+	return s.opts.BaseURL + "/files/signed/" + fileID.String() + "?" + q.Encode(), expires
+}
+
+// Verify reports whether a signed URL's parameters are genuine and not
+// expired.
+func (s *Service) Verify(orgID, fileID uuid.UUID, variant string, expires int64, sig string, now time.Time) bool {
+	if now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(orgID, fileID, variant, expires)))
+}
+
+func (s *Service) sign(orgID, fileID uuid.UUID, variant string, expires int64) string {
+	m := hmac.New(sha256.New, s.opts.Secret)
+	fmt.Fprintf(m, "%s\n%s\n%s\n%d", orgID, fileID, variant, expires)
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
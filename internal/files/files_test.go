@@ -0,0 +1,69 @@
+package files
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerify(t *testing.T) {
+	s := NewService(nil, LocalStore{}, Options{Secret: []byte("secret"), URLTTL: time.Minute, BaseURL: "https://api.example.com/"})
+	org, file := uuid.New(), uuid.New()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	raw, expires := s.SignedURL(org, file, VariantThumbnail, now)
+	if !strings.HasPrefix(raw, "https://api.example.com/files/signed/"+file.String()+"?") {
+		t.Fatalf("SignedURL = %s", raw)
+	}
+	if want := now.Add(time.Minute); !expires.Equal(want) {
+		t.Errorf("expires = %s, want %s", expires, want)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	exp, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := q.Get("sig")
+	if q.Get("org") != org.String() || q.Get("variant") != VariantThumbnail {
+		t.Fatalf("query = %v", q)
+	}
+
+	tampered := []byte(sig)
+	tampered[0] ^= 1
+	other := NewService(nil, LocalStore{}, Options{Secret: []byte("other secret")})
+	tests := []struct {
+		name    string
+		s       *Service
+		org     uuid.UUID
+		file    uuid.UUID
+		variant string
+		expires int64
+		sig     string
+		now     time.Time
+		want    bool
+	}{
+		{"genuine", s, org, file, VariantThumbnail, exp, sig, now, true},
+		{"at the expiry", s, org, file, VariantThumbnail, exp, sig, expires, true},
+		{"expired", s, org, file, VariantThumbnail, exp, sig, expires.Add(time.Second), false},
+		{"expiry moved", s, org, file, VariantThumbnail, exp + 3600, sig, now, false},
+		{"other org", s, uuid.New(), file, VariantThumbnail, exp, sig, now, false},
+		{"other file", s, org, uuid.New(), VariantThumbnail, exp, sig, now, false},
+		{"other variant", s, org, file, VariantContent, exp, sig, now, false},
+		{"tampered signature", s, org, file, VariantThumbnail, exp, string(tampered), now, false},
+		{"empty signature", s, org, file, VariantThumbnail, exp, "", now, false},
+		{"other secret", other, org, file, VariantThumbnail, exp, sig, now, false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Verify(tt.org, tt.file, tt.variant, tt.expires, tt.sig, tt.now); got != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/gif" // decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ThumbnailSize bounds the width and height of thumbnails.
+const ThumbnailSize = 320
+
+// maxPixels bounds the images decoded for thumbnails, so a small file
+// claiming a huge size cannot exhaust memory.
+const maxPixels = 50_000_000
+
+// thumbnailable lists the content types thumbnails are made of.
+var thumbnailable = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+// imageSize returns the width and height of an image, false when it cannot
+// be read.
+func imageSize(r io.Reader) (int, int, bool) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// thumbnail returns a JPEG of the image scaled down to fit ThumbnailSize,
+// or the image itself re-encoded when it is smaller, turned upright by its
+// EXIF orientation.
+func thumbnail(r io.Reader, orientation int) ([]byte, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		f := math.Min(float64(ThumbnailSize)/float64(w), float64(ThumbnailSize)/float64(h))
+		w, h = max(1, int(float64(w)*f)), max(1, int(float64(h)*f))
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(scale(src, w, h), orientation), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale resizes an image to w by h by averaging the source pixels falling
+// into each target pixel, drawing transparent areas on white.
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*sw/w, b.Min.X+max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Composite on white: c + (1 - alpha) * white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// orient turns an image as its EXIF orientation says: 2-4 mirror or turn
+// it half way, 5-8 turn it a quarter and swap its width and height.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	var dst *image.RGBA
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewRGBA(src.Rect)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror
+				dx, dy = w-1-x, y
+			case 3: // turn half way
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // turn clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // turn counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// Geotag is where and when a photo was taken, from its EXIF data.
+type Geotag struct {
+	Latitude, Longitude *float64
+	TakenAt             *time.Time
+}
+
+// EXIF tags read.
+const (
+	tagOrientation        = 0x0112
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+// readGeotag returns the GPS position and the time a JPEG photo was taken,
+// as far as its EXIF data has them. Photos without EXIF data, or with data
+// that cannot be read, have none.
+func readGeotag(jpg []byte) Geotag {
+	var g Geotag
+	tiff := exifSegment(jpg)
+	if tiff == nil {
+		return g
+	}
+	t, ok := newTIFF(tiff)
+	if !ok {
+		return g
+	}
+	ifd0 := t.ifd(t.u32(4))
+	if off, ok := ifd0[tagExifIFD]; ok {
+		exif := t.ifd(t.u32(off.valueAt))
+		if e, ok := exif[tagDateTimeOriginal]; ok {
+			loc := time.UTC
+			if o, ok := exif[tagOffsetTimeOriginal]; ok {
+				if z, err := time.Parse("-07:00", t.ascii(o)); err == nil {
+					loc = z.Location()
+				}
+			}
+			if at, err := time.ParseInLocation("2006:01:02 15:04:05", t.ascii(e), loc); err == nil {
+				g.TakenAt = &at
+			}
+		}
+	}
+	if off, ok := ifd0[tagGPSIFD]; ok {
+		gps := t.ifd(t.u32(off.valueAt))
+		lat, latOK := t.degrees(gps[tagGPSLatitude], gps[tagGPSLatitudeRef], "S")
+		lon, lonOK := t.degrees(gps[tagGPSLongitude], gps[tagGPSLongitudeRef], "W")
+		if latOK && lonOK && math.Abs(lat) <= 90 && math.Abs(lon) <= 180 && (lat != 0 || lon != 0) {
+			g.Latitude, g.Longitude = &lat, &lon
+		}
+	}
+	return g
+}
+
+// orientation returns the EXIF orientation of a JPEG photo, 1 to 8, or 0
+// when it has none.
+func orientation(jpg []byte) int {
+	t, ok := newTIFF(exifSegment(jpg))
+	if !ok {
+		return 0
+	}
+	e, ok := t.ifd(t.u32(4))[tagOrientation]
+	if !ok || e.typ != 3 || e.count != 1 {
+		return 0
+	}
+	if o := int(t.order.Uint16(t.b[e.valueAt:])); o >= 1 && o <= 8 {
+		return o
+	}
+	return 0
+}
+
+// exifSegment returns the TIFF data of the Exif APP1 segment of a JPEG.
+func exifSegment(jpg []byte) []byte {
+	if len(jpg) < 4 || jpg[0] != 0xff || jpg[1] != 0xd8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(jpg); {
+		if jpg[i] != 0xff {
+			return nil
+		}
+		marker := jpg[i+1]
+		if marker == 0xd9 || marker == 0xda { // end of image, start of scan
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(jpg[i+2:]))
+		if n < 2 || i+2+n > len(jpg) {
+			return nil
+		}
+		seg := jpg[i+4 : i+2+n]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// tiff reads the IFDs of TIFF data.
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// entry is an IFD entry: its type, count and the offset of its value,
+// which is the entry itself for values of up to 4 bytes.
+type entry struct {
+	typ     uint16
+	count   uint32
+	valueAt uint32
+}
+
+func newTIFF(b []byte) (tiff, bool) {
+	if len(b) < 8 {
+		return tiff{}, false
+	}
+	t := tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return tiff{}, false
+	}
+	return t, t.order.Uint16(b[2:]) == 42
+}
+
+func (t tiff) u32(off uint32) uint32 {
+	if uint64(off)+4 > uint64(len(t.b)) {
+		return 0
+	}
+	return t.order.Uint32(t.b[off:])
+}
+
+// typeSizes are the sizes of the TIFF field types read.
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// ifd returns the entries of the IFD at off by tag.
+func (t tiff) ifd(off uint32) map[uint16]entry {
+	out := map[uint16]entry{}
+	if off < 8 || uint64(off)+2 > uint64(len(t.b)) {
+		return out
+	}
+	n := uint32(t.order.Uint16(t.b[off:]))
+	for i := uint32(0); i < n; i++ {
+		at := off + 2 + 12*i
+		if uint64(at)+12 > uint64(len(t.b)) {
+			break
+		}
+		e := entry{typ: t.order.Uint16(t.b[at+2:]), count: t.order.Uint32(t.b[at+4:]), valueAt: at + 8}
+		size, ok := typeSizes[e.typ]
+		if !ok || e.count > 1<<16 {
+			continue
+		}
+		if size*e.count > 4 {
+			e.valueAt = t.order.Uint32(t.b[at+8:])
+		}
+		if uint64(e.valueAt)+uint64(size*e.count) > uint64(len(t.b)) {
+			continue
+		}
+		out[t.order.Uint16(t.b[at:])] = e
+	}
+	return out
+}
+
+func (t tiff) ascii(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimRight(string(t.b[e.valueAt:e.valueAt+e.count]), "\x00 ")
+}
+
+// degrees reads degrees, minutes and seconds as RATIONALs and negates them
+// when the reference is neg (S or W).
+func (t tiff) degrees(e entry, ref entry, neg string) (float64, bool) {
+	if e.typ != 5 || e.count != 3 {
+		return 0, false
+	}
+	var v float64
+	for i, div := range []float64{1, 60, 3600} {
+		at := e.valueAt + uint32(i)*8
+		num, den := t.order.Uint32(t.b[at:]), t.order.Uint32(t.b[at+4:])
+		if den == 0 {
+			return 0, false
+		}
+		v += float64(num) / float64(den) / div
+	}
+	if strings.EqualFold(t.ascii(ref), neg) {
+		v = -v
+	}
+	return v, true
+}
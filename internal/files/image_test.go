@@ -0,0 +1,352 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// field is an IFD entry of a test TIFF; data holds its value, count items
+// of type typ.
+type field struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// order writes the integers of a test TIFF.
+type order interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+func short(o order, v uint16) field {
+	return field{typ: 3, count: 1, data: o.AppendUint16(nil, v)}
+}
+
+func ascii(s string) field {
+	return field{typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+// rationals are numerator, denominator pairs.
+func rationals(o order, v ...uint32) field {
+	var b []byte
+	for _, n := range v {
+		b = o.AppendUint32(b, n)
+	}
+	return field{typ: 5, count: uint32(len(v) / 2), data: b}
+}
+
+func tagged(tag uint16, f field) field {
+	f.tag = tag
+	return f
+}
+
+// exifTIFF lays out TIFF data: the header, IFD0 with pointers to the Exif
+// and GPS IFDs when they have entries, those IFDs and then the values that
+// do not fit their entries.
+func exifTIFF(o order, ifd0, exif, gps []field) []byte {
+	size := func(fs []field) uint32 {
+		if len(fs) == 0 {
+			return 0
+		}
+		return 2 + 12*uint32(len(fs)) + 4
+	}
+	n0 := len(ifd0)
+	if len(exif) > 0 {
+		n0++
+	}
+	if len(gps) > 0 {
+		n0++
+	}
+	at0 := uint32(8)
+	atExif := at0 + 2 + 12*uint32(n0) + 4
+	atGPS := atExif + size(exif)
+	data := atGPS + size(gps)
+	ifd0 = append([]field(nil), ifd0...)
+	if len(exif) > 0 {
+		ifd0 = append(ifd0, field{tag: tagExifIFD, typ: 4, count: 1, data: o.AppendUint32(nil, atExif)})
+	}
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, field{tag: tagGPSIFD, typ: 4, count: 1, data: o.AppendUint32(nil, atGPS)})
+	}
+
+	b := []byte("II")
+	if o == binary.BigEndian {
+		b = []byte("MM")
+	}
+	b = o.AppendUint16(b, 42)
+	b = o.AppendUint32(b, at0)
+	var values []byte
+	for _, fs := range [][]field{ifd0, exif, gps} {
+		if len(fs) == 0 {
+			continue
+		}
+		b = o.AppendUint16(b, uint16(len(fs)))
+		for _, f := range fs {
+			b = o.AppendUint16(b, f.tag)
+			b = o.AppendUint16(b, f.typ)
+			b = o.AppendUint32(b, f.count)
+			if len(f.data) <= 4 {
+				b = append(b, f.data...)
+				b = append(b, make([]byte, 4-len(f.data))...)
+			} else {
+				b = o.AppendUint32(b, data+uint32(len(values)))
+				values = append(values, f.data...)
+			}
+		}
+		b = o.AppendUint32(b, 0)
+	}
+	return append(b, values...)
+}
+
+// withExif returns a JPEG with an Exif APP1 segment holding tiff, after
+// the SOI marker of jpg.
+func withExif(jpg, tiff []byte) []byte {
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(2+len(seg)))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+// emptyJPEG is the smallest JPEG readGeotag looks into.
+var emptyJPEG = []byte{0xff, 0xd8, 0xff, 0xd9}
+
+// describe formats a geotag as "lat,lon taken", "-" for what is missing.
+func describe(g Geotag) string {
+	pos, at := "-", "-"
+	if g.Latitude != nil && g.Longitude != nil {
+		pos = fmt.Sprintf("%.4f,%.4f", *g.Latitude, *g.Longitude)
+	}
+	if g.TakenAt != nil {
+		at = g.TakenAt.Format(time.RFC3339)
+	}
+	return pos + " " + at
+}
+
+func TestReadGeotag(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	london := []field{
+		tagged(tagGPSLatitudeRef, ascii("N")),
+		tagged(tagGPSLatitude, rationals(le, 51, 1, 30, 1, 0, 1)),
+		tagged(tagGPSLongitudeRef, ascii("W")),
+		tagged(tagGPSLongitude, rationals(le, 0, 1, 7, 1, 30, 1)),
+	}
+	sydney := []field{
+		tagged(tagGPSLatitudeRef, ascii("S")),
+		tagged(tagGPSLatitude, rationals(be, 33, 1, 5197, 100, 0, 1)),
+		tagged(tagGPSLongitudeRef, ascii("E")),
+		tagged(tagGPSLongitude, rationals(be, 151, 1, 12, 1, 3600, 100)),
+	}
+	taken := []field{
+		tagged(tagDateTimeOriginal, ascii("2026:03:01 09:15:00")),
+		tagged(tagOffsetTimeOriginal, ascii("+11:00")),
+	}
+	valid := withExif(emptyJPEG, exifTIFF(le, nil, nil, london))
+
+	tests := []struct {
+		name string
+		jpg  []byte
+		want string
+	}{
+		{"no EXIF", emptyJPEG, "- -"},
+		{"little endian GPS", valid, "51.5000,-0.1250 -"},
+		{"big endian GPS and time", withExif(emptyJPEG, exifTIFF(be, nil, taken, sydney)), "-33.8662,151.2100 2026-03-01T09:15:00+11:00"},
+		{"time without offset is UTC", withExif(emptyJPEG, exifTIFF(le, nil, taken[:1], nil)), "- 2026-03-01T09:15:00Z"},
+		{"invalid offset is UTC", withExif(emptyJPEG, exifTIFF(le, nil, []field{taken[0], tagged(tagOffsetTimeOriginal, ascii("local"))}, nil)), "- 2026-03-01T09:15:00Z"},
+		{"invalid time", withExif(emptyJPEG, exifTIFF(le, nil, []field{tagged(tagDateTimeOriginal, ascii("yesterday"))}, nil)), "- -"},
+		{"after other segments", append([]byte{0xff, 0xd8, 0xff, 0xe0, 0, 4, 'J', 'F'}, valid[2:]...), "51.5000,-0.1250 -"},
+		{"latitude out of range", withExif(emptyJPEG, exifTIFF(le, nil, nil, []field{
+			london[0], tagged(tagGPSLatitude, rationals(le, 91, 1, 0, 1, 0, 1)), london[2], london[3],
+		})), "- -"},
+		{"null island", withExif(emptyJPEG, exifTIFF(le, nil, nil, []field{
+			london[0], tagged(tagGPSLatitude, rationals(le, 0, 1, 0, 1, 0, 1)),
+			london[2], tagged(tagGPSLongitude, rationals(le, 0, 1, 0, 1, 0, 1)),
+		})), "- -"},
+		{"zero denominator", withExif(emptyJPEG, exifTIFF(le, nil, nil, []field{
+			london[0], tagged(tagGPSLatitude, rationals(le, 51, 0, 30, 1, 0, 1)), london[2], london[3],
+		})), "- -"},
+		{"latitude as SHORT", withExif(emptyJPEG, exifTIFF(le, nil, nil, []field{
+			london[0], tagged(tagGPSLatitude, short(le, 51)), london[2], london[3],
+		})), "- -"},
+		{"latitude without longitude", withExif(emptyJPEG, exifTIFF(le, nil, nil, london[:2])), "- -"},
+		{"not a JPEG", valid[2:], "- -"},
+		{"not Exif", bytes.Replace(valid, []byte("Exif"), []byte("XMP "), 1), "- -"},
+		{"unknown byte order", bytes.Replace(valid, []byte("II*"), []byte("XX*"), 1), "- -"},
+		{"not TIFF", bytes.Replace(valid, []byte("II*"), []byte("II+"), 1), "- -"},
+		{"truncated segment", valid[:len(valid)-10], "- -"},
+		{"segment length too short", append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, 1}, valid[6:]...), "- -"},
+		{"start of scan first", append([]byte{0xff, 0xd8, 0xff, 0xda, 0, 2}, valid[2:]...), "- -"},
+		{"garbage between segments", append([]byte{0xff, 0xd8, 0x00}, valid[2:]...), "- -"},
+	}
+	for _, tt := range tests {
+		if got := describe(readGeotag(tt.jpg)); got != tt.want {
+			t.Errorf("%s: readGeotag = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestReadGeotagMalformed feeds TIFF data whose offsets and counts point
+// past its end; readGeotag must not panic and finds nothing.
+func TestReadGeotagMalformed(t *testing.T) {
+	le := binary.LittleEndian
+	valid := exifTIFF(le, nil, nil, []field{
+		tagged(tagGPSLatitudeRef, ascii("N")),
+		tagged(tagGPSLatitude, rationals(le, 51, 1, 30, 1, 0, 1)),
+		tagged(tagGPSLongitudeRef, ascii("W")),
+		tagged(tagGPSLongitude, rationals(le, 0, 1, 7, 1, 30, 1)),
+	})
+	// IFD0 holds one entry, the pointer to the GPS IFD at 26
+	const gpsAt = 8 + 2 + 12 + 4
+	patch := func(at int, v uint32) []byte {
+		b := bytes.Clone(valid)
+		le.PutUint32(b[at:], v)
+		return b
+	}
+	tests := map[string][]byte{
+		"IFD0 past the end":        patch(4, 1<<30),
+		"IFD0 inside the header":   patch(4, 2),
+		"GPS IFD past the end":     patch(8+2+8, 1<<30),
+		"entry count too large":    append(bytes.Clone(valid[:gpsAt]), 0xff, 0xff),
+		"value past the end":       patch(gpsAt+2+12+8, uint32(len(valid))),
+		"count past the end":       patch(gpsAt+2+12+4, 1<<20),
+		"header only":              valid[:8],
+		"cut inside the GPS IFD":   valid[:gpsAt+2+12*2+5],
+		"cut inside the rationals": valid[:len(valid)-4],
+	}
+	for name, tiff := range tests {
+		if got := describe(readGeotag(withExif(emptyJPEG, tiff))); got != "- -" {
+			t.Errorf("%s: readGeotag = %s, want nothing", name, got)
+		}
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	tests := []struct {
+		name string
+		jpg  []byte
+		want int
+	}{
+		{"no EXIF", emptyJPEG, 0},
+		{"upright", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 1))}, nil, nil)), 1},
+		{"little endian", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 6))}, nil, nil)), 6},
+		{"big endian", withExif(emptyJPEG, exifTIFF(be, []field{tagged(tagOrientation, short(be, 8))}, nil, nil)), 8},
+		{"out of range", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 9))}, nil, nil)), 0},
+		{"zero", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 0))}, nil, nil)), 0},
+		{"as LONG", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, field{typ: 4, count: 1, data: le.AppendUint32(nil, 6)})}, nil, nil)), 0},
+		{"two values", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, field{typ: 3, count: 2, data: []byte{6, 0, 6, 0}})}, nil, nil)), 0},
+		{"next to GPS", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 3))}, nil, []field{tagged(tagGPSLatitudeRef, ascii("N"))})), 3},
+		{"truncated", withExif(emptyJPEG, exifTIFF(le, []field{tagged(tagOrientation, short(le, 6))}, nil, nil)[:12]), 0},
+	}
+	for _, tt := range tests {
+		if got := orientation(tt.jpg); got != tt.want {
+			t.Errorf("%s: orientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// letters returns the red channel of an image as rows of letters.
+func letters(img *image.RGBA) string {
+	var b []byte
+	for y := 0; y < img.Rect.Dy(); y++ {
+		if y > 0 {
+			b = append(b, '/')
+		}
+		for x := 0; x < img.Rect.Dx(); x++ {
+			b = append(b, img.Pix[img.PixOffset(x, y)])
+		}
+	}
+	return string(b)
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i, c := range "ABCD" {
+		src.Set(i%2, i/2, color.RGBA{R: uint8(c), A: 0xff})
+	}
+	// The letters as they are shown, for each EXIF orientation
+	want := []string{"AB/CD", "AB/CD", "BA/DC", "DC/BA", "CD/AB", "AC/BD", "CA/DB", "DB/CA", "BD/AC", "AB/CD"}
+	for o, w := range want {
+		if got := letters(orient(src, o)); got != w {
+			t.Errorf("orient(%d) = %s, want %s", o, got, w)
+		}
+	}
+	if r := orient(image.NewRGBA(image.Rect(0, 0, 3, 1)), 6).Rect; r.Dx() != 1 || r.Dy() != 3 {
+		t.Errorf("orient(6) of 3x1 = %dx%d, want 1x3", r.Dx(), r.Dy())
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	encode := func(w, h int, jpg bool) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		var buf bytes.Buffer
+		var err error
+		if jpg {
+			err = jpeg.Encode(&buf, img, nil)
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name        string
+		w, h        int
+		jpg         bool
+		orientation int
+		want        string
+	}{
+		{"landscape", 640, 480, true, 0, "320x240"},
+		{"portrait", 480, 640, false, 0, "240x320"},
+		{"square", 1000, 1000, false, 1, "320x320"},
+		{"smaller", 100, 50, true, 0, "100x50"},
+		{"exactly the size", 320, 200, false, 0, "320x200"},
+		{"thin", 3000, 2, false, 0, "320x1"},
+		{"tall", 9, 1000, false, 0, "2x320"},
+		{"turned clockwise", 640, 480, true, 6, "240x320"},
+		{"turned counter-clockwise", 640, 480, true, 8, "240x320"},
+		{"upside down", 640, 480, true, 3, "320x240"},
+		{"small and turned", 40, 20, true, 5, "20x40"},
+	}
+	for _, tt := range tests {
+		thumb, err := thumbnail(bytes.NewReader(encode(tt.w, tt.h, tt.jpg)), tt.orientation)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil || format != "jpeg" {
+			t.Errorf("%s: thumbnail is %s: %v", tt.name, format, err)
+			continue
+		}
+		if got := fmt.Sprintf("%dx%d", cfg.Width, cfg.Height); got != tt.want {
+			t.Errorf("%s: thumbnail of %dx%d = %s, want %s", tt.name, tt.w, tt.h, got, tt.want)
+		}
+	}
+	if _, err := thumbnail(bytes.NewReader([]byte("not an image")), 0); err == nil {
+		t.Error("thumbnail of garbage succeeded")
+	}
+}
+
+func TestScaleWhiteBackground(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	src.Set(0, 0, color.NRGBA{R: 0, G: 0, B: 0, A: 0xff})
+	dst := scale(src, 2, 2)
+	if got := dst.RGBAAt(1, 1); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("transparent area = %v, want white", got)
+	}
+	if got := dst.RGBAAt(0, 0); got.R != 0xbf || got.A != 0xff {
+		t.Errorf("average of one black and three transparent pixels = %v, want 0xbf grey", got)
+	}
+}
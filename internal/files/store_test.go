@@ -0,0 +1,75 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreKeys(t *testing.T) {
+	dir := t.TempDir()
+	s := LocalStore{Dir: filepath.Join(dir, "blobs")}
+	ctx := context.Background()
+	for _, key := range []string{
+		"",
+		"../outside",
+		"org/../../outside",
+		"org/..",
+		"..",
+		"/etc/passwd",
+		`org\..\outside`,
+	} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := s.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want an invalid key", key, err)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a blob was written outside the store: %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	s := LocalStore{Dir: t.TempDir()}
+	ctx := context.Background()
+	const key = "org/3f2a.thumb"
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put error = %v, want ErrNotFound", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		r, err := s.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != body {
+			t.Errorf("Get = %q, want %q", got, body)
+		}
+	}
+	tmps, _ := filepath.Glob(filepath.Join(s.Dir, "org", ".upload-*"))
+	if len(tmps) != 0 {
+		t.Errorf("temporary files left behind: %v", tmps)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+}
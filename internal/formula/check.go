@@ -0,0 +1,387 @@
+package formula
+
+import (
+	"time"
+)
+
+// Type is the static type of an expression.
+type Type int
+
+const (
+	TypeNull Type = iota
+	TypeNumber
+	TypeText
+	TypeBool
+	TypeDate
+	// TypeList is a list of text values; only variables such as
+	// current_user.teams have it, as the right side of IN.
+	TypeList
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNumber:
+		return "number"
+	case TypeText:
+		return "text"
+	case TypeBool:
+		return "bool"
+	case TypeDate:
+		return "date"
+	case TypeList:
+		return "list"
+	}
+	return "null"
+}
+
+// ColumnType returns the user-table column type a value of t is stored as.
+func (t Type) ColumnType() string {
+	switch t {
+	case TypeNumber:
+		return "float"
+	case TypeText:
+		return "text"
+	case TypeBool:
+		return "bool"
+	case TypeDate:
+		return "date"
+	}
+	return ""
+}
+
+// TypeOfColumn maps a user-table column type to the formula type used when
+// the column is referenced from an expression.
+func TypeOfColumn(colType string) (Type, bool) {
+	switch colType {
+	case "text", "enum", "uuid":
+		return TypeText, true
+	case "float":
+		return TypeNumber, true
+	case "bool":
+		return TypeBool, true
+	case "date":
+		return TypeDate, true
+	}
+	return TypeNull, false
+}
+
+// variable is a name bound by the context an expression runs in rather
+// than by a column, e.g. the current user in row policies. ref names the
+// column a variable reads, if any, so it is still listed in Refs.
+type variable struct {
+	typ Type
+	sql string
+	ref string
+}
+
+type checker struct {
+	cols  map[string]Type
+	vars  map[string]variable
+	types map[Node]Type
+	refs  []string
+	seen  map[string]bool
+}
+
+func (c *checker) set(n Node, t Type) Type { c.types[n] = t; return t }
+
+// ref records that the expression reads the named column.
+func (c *checker) ref(name string) {
+	if !c.seen[name] {
+		c.seen[name] = true
+		c.refs = append(c.refs, name)
+	}
+}
+
+// unify returns the common type of a and b, treating NULL as compatible with anything.
+func unify(a, b Type) (Type, bool) {
+	switch {
+	case a == TypeNull:
+		return b, true
+	case b == TypeNull:
+		return a, true
+	case a == b:
+		return a, true
+	}
+	return TypeNull, false
+}
+
+// settle pushes a resolved type down onto bare NULL literals so they compile
+// with an explicit cast.
+func (c *checker) settle(n Node, t Type) {
+	if _, ok := n.(*NullLit); ok {
+		c.types[n] = t
+	}
+}
+
+func (c *checker) check(n Node) (Type, error) {
+	switch x := n.(type) {
+	case *NumberLit:
+		return c.set(n, TypeNumber), nil
+	case *StringLit:
+		return c.set(n, TypeText), nil
+	case *BoolLit:
+		return c.set(n, TypeBool), nil
+	case *NullLit:
+		return c.set(n, TypeNull), nil
+	case *Ident:
+		if v, ok := c.vars[x.Name]; ok {
+			if v.ref != "" {
+				c.ref(v.ref)
+			}
+			return c.set(n, v.typ), nil
+		}
+		t, ok := c.cols[x.Name]
+		if !ok {
+			return TypeNull, errorf(x.At, "unknown column %q", x.Name)
+		}
+		c.ref(x.Name)
+		return c.set(n, t), nil
+	case *Unary:
+		t, err := c.check(x.X)
+		if err != nil {
+			return TypeNull, err
+		}
+		switch x.Op {
+		case "NOT":
+			if t != TypeBool && t != TypeNull {
+				return TypeNull, errorf(x.At, "NOT expects bool, got %s", t)
+			}
+			c.settle(x.X, TypeBool)
+			return c.set(n, TypeBool), nil
+		case "-":
+			if t != TypeNumber && t != TypeNull {
+				return TypeNull, errorf(x.At, "unary - expects number, got %s", t)
+			}
+			c.settle(x.X, TypeNumber)
+			return c.set(n, TypeNumber), nil
+		}
+	case *Binary:
+		return c.checkBinary(x)
+	case *Call:
+		return c.checkCall(x)
+	case *List:
+		return TypeNull, errorf(x.At, "a list is only allowed after IN")
+	}
+	return TypeNull, errorf(n.pos(), "unsupported expression")
+}
+
+func (c *checker) checkBinary(x *Binary) (Type, error) {
+	if x.Op == "IN" || x.Op == "NOT IN" {
+		return c.checkIn(x)
+	}
+	lt, err := c.check(x.L)
+	if err != nil {
+		return TypeNull, err
+	}
+	rt, err := c.check(x.R)
+	if err != nil {
+		return TypeNull, err
+	}
+	switch x.Op {
+	case "AND", "OR":
+		for _, t := range []Type{lt, rt} {
+			if t != TypeBool && t != TypeNull {
+				return TypeNull, errorf(x.At, "%s expects bool operands, got %s", x.Op, t)
+			}
+		}
+		c.settle(x.L, TypeBool)
+		c.settle(x.R, TypeBool)
+		return c.set(x, TypeBool), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		t, ok := unify(lt, rt)
+		if !ok {
+			return TypeNull, errorf(x.At, "cannot compare %s with %s", lt, rt)
+		}
+		if x.Op != "=" && x.Op != "!=" && t == TypeBool {
+			return TypeNull, errorf(x.At, "operator %s does not apply to bool", x.Op)
+		}
+		c.settle(x.L, t)
+		c.settle(x.R, t)
+		return c.set(x, TypeBool), nil
+	case "&":
+		if lt == TypeList || rt == TypeList {
+			return TypeNull, errorf(x.At, "operator & does not apply to list")
+		}
+		c.settle(x.L, TypeText)
+		c.settle(x.R, TypeText)
+		return c.set(x, TypeText), nil
+	case "+", "-":
+		switch {
+		case x.Op == "-" && lt == TypeDate && rt == TypeDate:
+			return c.set(x, TypeNumber), nil
+		case lt == TypeDate && (rt == TypeNumber || rt == TypeNull):
+			c.settle(x.R, TypeNumber)
+			return c.set(x, TypeDate), nil
+		case x.Op == "+" && rt == TypeDate && (lt == TypeNumber || lt == TypeNull):
+			c.settle(x.L, TypeNumber)
+			return c.set(x, TypeDate), nil
+		}
+		fallthrough
+	case "*", "/":
+		for _, t := range []Type{lt, rt} {
+			if t != TypeNumber && t != TypeNull {
+				return TypeNull, errorf(x.At, "operator %s expects numbers, got %s", x.Op, t)
+			}
+		}
+		c.settle(x.L, TypeNumber)
+		c.settle(x.R, TypeNumber)
+		return c.set(x, TypeNumber), nil
+	}
+	return TypeNull, errorf(x.At, "unsupported operator %s", x.Op)
+}
+
+// checkIn checks x IN (a, b, ...) against the common type of its values,
+// and x IN list against a list of text.
+func (c *checker) checkIn(x *Binary) (Type, error) {
+	lt, err := c.check(x.L)
+	if err != nil {
+		return TypeNull, err
+	}
+	list, ok := x.R.(*List)
+	if !ok {
+		rt, err := c.check(x.R)
+		if err != nil {
+			return TypeNull, err
+		}
+		if rt != TypeList {
+			return TypeNull, errorf(x.At, "%s expects a list, got %s", x.Op, rt)
+		}
+		if lt != TypeText && lt != TypeNull {
+			return TypeNull, errorf(x.At, "cannot look up %s in a list of text", lt)
+		}
+		c.settle(x.L, TypeText)
+		return c.set(x, TypeBool), nil
+	}
+	t := lt
+	for _, item := range list.Items {
+		it, err := c.check(item)
+		if err != nil {
+			return TypeNull, err
+		}
+		u, ok := unify(t, it)
+		if !ok || u == TypeList {
+			return TypeNull, errorf(item.pos(), "%s values must share a type (%s vs %s)", x.Op, t, it)
+		}
+		t = u
+	}
+	c.settle(x.L, t)
+	for _, item := range list.Items {
+		c.settle(item, t)
+	}
+	return c.set(x, TypeBool), nil
+}
+
+// signature describes a whitelisted function: fixed argument types (or
+// variadic "any") and a fixed result type. Functions whose result depends on
+// their arguments (coalesce, if) are handled in checkCall directly.
+type signature struct {
+	args     []Type
+	optional int // number of trailing args that may be omitted
+	result   Type
+}
+
+var functions = map[string]signature{
+	"today":        {result: TypeDate},
+	"days_between": {args: []Type{TypeDate, TypeDate}, result: TypeNumber},
+	"add_days":     {args: []Type{TypeDate, TypeNumber}, result: TypeDate},
+	"year":         {args: []Type{TypeDate}, result: TypeNumber},
+	"month":        {args: []Type{TypeDate}, result: TypeNumber},
+	"day":          {args: []Type{TypeDate}, result: TypeNumber},
+	"upper":        {args: []Type{TypeText}, result: TypeText},
+	"lower":        {args: []Type{TypeText}, result: TypeText},
+	"trim":         {args: []Type{TypeText}, result: TypeText},
+	"length":       {args: []Type{TypeText}, result: TypeNumber},
+	"abs":          {args: []Type{TypeNumber}, result: TypeNumber},
+	"floor":        {args: []Type{TypeNumber}, result: TypeNumber},
+	"ceil":         {args: []Type{TypeNumber}, result: TypeNumber},
+	"round":        {args: []Type{TypeNumber, TypeNumber}, optional: 1, result: TypeNumber},
+}
+
+func (c *checker) checkCall(x *Call) (Type, error) {
+	argTypes := make([]Type, len(x.Args))
+	for i, a := range x.Args {
+		t, err := c.check(a)
+		if err != nil {
+			return TypeNull, err
+		}
+		argTypes[i] = t
+	}
+	switch x.Name {
+	case "coalesce":
+		if len(x.Args) < 2 {
+			return TypeNull, errorf(x.At, "coalesce expects at least 2 arguments")
+		}
+		t := TypeNull
+		for i, at := range argTypes {
+			u, ok := unify(t, at)
+			if !ok {
+				return TypeNull, errorf(x.Args[i].pos(), "coalesce arguments must share a type (%s vs %s)", t, at)
+			}
+			t = u
+		}
+		for _, a := range x.Args {
+			c.settle(a, t)
+		}
+		return c.set(x, t), nil
+	case "if":
+		if len(x.Args) != 3 {
+			return TypeNull, errorf(x.At, "if expects 3 arguments (condition, then, else)")
+		}
+		if argTypes[0] != TypeBool && argTypes[0] != TypeNull {
+			return TypeNull, errorf(x.Args[0].pos(), "if condition must be bool, got %s", argTypes[0])
+		}
+		c.settle(x.Args[0], TypeBool)
+		t, ok := unify(argTypes[1], argTypes[2])
+		if !ok {
+			return TypeNull, errorf(x.At, "if branches must share a type (%s vs %s)", argTypes[1], argTypes[2])
+		}
+		c.settle(x.Args[1], t)
+		c.settle(x.Args[2], t)
+		return c.set(x, t), nil
+	case "concat":
+		if len(x.Args) == 0 {
+			return TypeNull, errorf(x.At, "concat expects at least 1 argument")
+		}
+		for i, at := range argTypes {
+			if at == TypeList {
+				return TypeNull, errorf(x.Args[i].pos(), "concat does not accept a list")
+			}
+		}
+		for _, a := range x.Args {
+			c.settle(a, TypeText)
+		}
+		return c.set(x, TypeText), nil
+	case "is_null":
+		if len(x.Args) != 1 {
+			return TypeNull, errorf(x.At, "is_null expects 1 argument")
+		}
+		c.settle(x.Args[0], TypeText)
+		return c.set(x, TypeBool), nil
+	case "date":
+		if len(x.Args) != 1 {
+			return TypeNull, errorf(x.At, "date expects 1 argument")
+		}
+		lit, ok := x.Args[0].(*StringLit)
+		if !ok {
+			return TypeNull, errorf(x.At, "date expects a 'YYYY-MM-DD' string literal")
+		}
+		if _, err := time.Parse("2006-01-02", lit.Value); err != nil {
+			return TypeNull, errorf(lit.At, "invalid date %q (want YYYY-MM-DD)", lit.Value)
+		}
+		return c.set(x, TypeDate), nil
+	}
+	sig, ok := functions[x.Name]
+	if !ok {
+		return TypeNull, errorf(x.At, "unknown function %q", x.Name)
+	}
+	if len(x.Args) > len(sig.args) || len(x.Args) < len(sig.args)-sig.optional {
+		return TypeNull, errorf(x.At, "%s expects %d argument(s), got %d", x.Name, len(sig.args), len(x.Args))
+	}
+	for i, at := range argTypes {
+		if at != sig.args[i] && at != TypeNull {
+			return TypeNull, errorf(x.Args[i].pos(), "%s argument %d must be %s, got %s", x.Name, i+1, sig.args[i], at)
+		}
+		c.settle(x.Args[i], sig.args[i])
+	}
+	return c.set(x, sig.result), nil
+}
@@ -0,0 +1,391 @@
+package formula
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compiled is a validated expression ready to be stored on a column.
+type Compiled struct {
+	Type Type
+	// SQL is a scalar SQL expression over the jsonb row data bound as "d".
+	SQL string
+	// Refs lists the column names the expression reads, in first-use order.
+	Refs []string
+}
+
+// Compile parses src, checks it against the available columns (name -> type)
+// and compiles it to SQL. The resulting SQL only ever contains server-generated
+// fragments and quoted literals, never raw user text.
+func Compile(src string, cols map[string]Type) (Compiled, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return Compiled{}, err
+	}
+	c := &checker{cols: cols, types: map[Node]Type{}, seen: map[string]bool{}}
+	t, err := c.check(n)
+	if err != nil {
+		return Compiled{}, err
+	}
+	if t == TypeNull {
+		return Compiled{}, errorf(-1, "expression always evaluates to NULL")
+	}
+	sql := "CAST(" + c.sql(n) + " AS " + sqlType(t) + ")"
+	return Compiled{Type: t, SQL: sql, Refs: c.refs}, nil
+}
+
+// policyVars are the names row policies can use besides the table's
+// columns. They take precedence over columns of the same name. The SQL reads
+// the row being checked as "r" (an app.rows row).
+var policyVars = map[string]variable{
+	"current_user":       {typ: TypeText, sql: "(app.current_user_id()::text)"},
+	"current_user.teams": {typ: TypeList, sql: "app.current_user_teams()"},
+	"current_user.role":  {typ: TypeText, sql: "(app.current_org_role()::text)"},
+	"created_by":         {typ: TypeText, sql: "(r.created_by::text)"},
+}
+
+// CompilePolicy compiles a row policy condition, a bool expression over the
+// row's columns and the current user, e.g. "team IN current_user.teams". The
+// SQL is FALSE where the condition is NULL, so unset values hide the row.
+func CompilePolicy(src string, cols map[string]Type) (Compiled, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return Compiled{}, err
+	}
+	c := &checker{cols: cols, vars: policyVars, types: map[Node]Type{}, seen: map[string]bool{}}
+	t, err := c.check(n)
+	if err != nil {
+		return Compiled{}, err
+	}
+	if t != TypeBool {
+		return Compiled{}, errorf(-1, "a policy must be a condition (bool), got %s", t)
+	}
+	sql := "COALESCE(" + c.sql(n) + ", FALSE)"
+	return Compiled{Type: t, SQL: sql, Refs: c.refs}, nil
+}
+
+// CompileEventFilter compiles a webhook filter, a bool expression over a
+// row event. Column names read the row after the change, bound as "d", and
+// old.<column> reads it before the change, bound as "o"; on creation every
+// old value is NULL. The SQL is FALSE where the condition is NULL. E.g.
+// "status = 'COMPLETED' AND coalesce(old.status, 'OPEN') != 'COMPLETED'".
+func CompileEventFilter(src string, cols map[string]Type) (Compiled, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return Compiled{}, err
+	}
+	c := &checker{cols: cols, vars: eventVars(cols), types: map[Node]Type{}, seen: map[string]bool{}}
+	t, err := c.check(n)
+	if err != nil {
+		return Compiled{}, err
+	}
+	if t != TypeBool {
+		return Compiled{}, errorf(-1, "a filter must be a condition (bool), got %s", t)
+	}
+	sql := "COALESCE(" + c.sql(n) + ", FALSE)"
+	return Compiled{Type: t, SQL: sql, Refs: c.refs}, nil
+}
+
+// eventVars binds old.<column> to the row before the change, bound as "o".
+func eventVars(cols map[string]Type) map[string]variable {
+	vars := make(map[string]variable, len(cols)+1)
+	for name, t := range cols {
+		vars["old."+name] = variable{typ: t, sql: fieldSQL("o", name, t), ref: name}
+	}
+	return vars
+}
+
+// automationVars are the event filter names plus current_user, the user
+// who made the change, bound as "u"; it is NULL for changes made by
+// automations.
+func automationVars(cols map[string]Type) map[string]variable {
+	vars := eventVars(cols)
+	vars["current_user"] = variable{typ: TypeText, sql: "(u::text)"}
+	return vars
+}
+
+// CompileAutomationCondition compiles the condition of an automation, a
+// bool expression over a row event like a webhook filter that may also use
+// current_user. The SQL is FALSE where the condition is NULL.
+func CompileAutomationCondition(src string, cols map[string]Type) (Compiled, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return Compiled{}, err
+	}
+	c := &checker{cols: cols, vars: automationVars(cols), types: map[Node]Type{}, seen: map[string]bool{}}
+	t, err := c.check(n)
+	if err != nil {
+		return Compiled{}, err
+	}
+	if t != TypeBool {
+		return Compiled{}, errorf(-1, "a condition must be a bool, got %s", t)
+	}
+	sql := "COALESCE(" + c.sql(n) + ", FALSE)"
+	return Compiled{Type: t, SQL: sql, Refs: c.refs}, nil
+}
+
+// CompileAutomationValue compiles a value an automation action writes, an
+// expression over the same names as CompileAutomationCondition, e.g.
+// "today()" or "'Follow up: ' & title". Unlike Compile it accepts a bare
+// NULL, with Type TypeNull, to clear a field.
+func CompileAutomationValue(src string, cols map[string]Type) (Compiled, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return Compiled{}, err
+	}
+	c := &checker{cols: cols, vars: automationVars(cols), types: map[Node]Type{}, seen: map[string]bool{}}
+	t, err := c.check(n)
+	if err != nil {
+		return Compiled{}, err
+	}
+	if t == TypeList {
+		return Compiled{}, errorf(-1, "a value cannot be a list")
+	}
+	sql := "CAST(" + c.sql(n) + " AS " + sqlType(t) + ")"
+	return Compiled{Type: t, SQL: sql, Refs: c.refs}, nil
+}
+
+// References returns the column names an expression reads without type
+// checking it; used to guard column removal.
+func References(src string) []string {
+	n, err := Parse(src)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	var walk func(Node)
+	walk = func(n Node) {
+		switch x := n.(type) {
+		case *Ident:
+			if !seen[x.Name] {
+				seen[x.Name] = true
+				out = append(out, x.Name)
+			}
+		case *Unary:
+			walk(x.X)
+		case *Binary:
+			walk(x.L)
+			walk(x.R)
+		case *Call:
+			for _, a := range x.Args {
+				walk(a)
+			}
+		case *List:
+			for _, a := range x.Items {
+				walk(a)
+			}
+		}
+	}
+	walk(n)
+	return out
+}
+
+// Order returns the names of computed columns, given as name -> expression,
+// by name except that each comes after the computed columns it reads, the
+// order they can be added in. It fails when expressions read each other in
+// a cycle.
+func Order(exprs map[string]string) ([]string, error) {
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var out, path []string
+	var visit func(string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			i := slices.Index(path, name)
+			return errorf(-1, "computed columns read each other: %s", strings.Join(append(slices.Clone(path[i:]), name), " -> "))
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, ref := range References(exprs[name]) {
+			if _, ok := exprs[ref]; ok {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		out = append(out, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func sqlType(t Type) string {
+	switch t {
+	case TypeNumber:
+		return "float8"
+	case TypeBool:
+		return "boolean"
+	case TypeDate:
+		return "date"
+	}
+	return "text"
+}
+
+// fieldSQL reads a column of type t from the jsonb row data bound as bind.
+func fieldSQL(bind, name string, t Type) string {
+	ref := "(" + bind + "->>" + quoteLiteral(name) + ")"
+	switch t {
+	case TypeNumber:
+		return ref + "::float8"
+	case TypeBool:
+		return ref + "::boolean"
+	case TypeDate:
+		return ref + "::date"
+	}
+	return ref
+}
+
+// quoteLiteral renders s as a standard-conforming SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (c *checker) sql(n Node) string {
+	switch x := n.(type) {
+	case *NumberLit:
+		return "(" + strconv.FormatFloat(x.Value, 'g', -1, 64) + "::float8)"
+	case *StringLit:
+		return quoteLiteral(x.Value)
+	case *BoolLit:
+		if x.Value {
+			return "TRUE"
+		}
+		return "FALSE"
+	case *NullLit:
+		return "NULL::" + sqlType(c.types[n])
+	case *Ident:
+		if v, ok := c.vars[x.Name]; ok {
+			return v.sql
+		}
+		return fieldSQL("d", x.Name, c.types[n])
+	case *Unary:
+		if x.Op == "NOT" {
+			return "(NOT " + c.sql(x.X) + ")"
+		}
+		return "(-" + c.sql(x.X) + ")"
+	case *Binary:
+		return c.binarySQL(x)
+	case *Call:
+		return c.callSQL(x)
+	}
+	return "NULL"
+}
+
+func (c *checker) binarySQL(x *Binary) string {
+	l, r := c.sql(x.L), c.sql(x.R)
+	lt, rt := c.types[x.L], c.types[x.R]
+	switch x.Op {
+	case "AND", "OR":
+		return "(" + l + " " + x.Op + " " + r + ")"
+	case "IN", "NOT IN":
+		if list, ok := x.R.(*List); ok {
+			items := make([]string, len(list.Items))
+			for i, item := range list.Items {
+				items[i] = c.sql(item)
+			}
+			return "(" + l + " " + x.Op + " (" + strings.Join(items, ", ") + "))"
+		}
+		if x.Op == "IN" {
+			return "(" + l + " = ANY(" + r + "))"
+		}
+		return "(NOT (" + l + " = ANY(" + r + ")))"
+	case "=", "!=":
+		// Comparing against a literal NULL reads naturally as an IS [NOT] NULL test.
+		_, lNull := x.L.(*NullLit)
+		_, rNull := x.R.(*NullLit)
+		if lNull || rNull {
+			operand := l
+			if lNull {
+				operand = r
+			}
+			if x.Op == "=" {
+				return "(" + operand + " IS NULL)"
+			}
+			return "(" + operand + " IS NOT NULL)"
+		}
+		if x.Op == "!=" {
+			return "(" + l + " <> " + r + ")"
+		}
+		return "(" + l + " = " + r + ")"
+	case "<", "<=", ">", ">=":
+		return "(" + l + " " + x.Op + " " + r + ")"
+	case "&":
+		return "concat(" + l + ", " + r + ")"
+	case "+", "-":
+		switch {
+		case lt == TypeDate && rt == TypeDate:
+			return "((" + l + " - " + r + ")::float8)"
+		case lt == TypeDate:
+			return "(" + l + " " + x.Op + " round(" + r + ")::int)"
+		case rt == TypeDate:
+			return "(" + r + " + round(" + l + ")::int)"
+		}
+		return "(" + l + " " + x.Op + " " + r + ")"
+	case "*":
+		return "(" + l + " * " + r + ")"
+	case "/":
+		return "(" + l + " / NULLIF(" + r + ", 0))"
+	}
+	return "NULL"
+}
+
+func (c *checker) callSQL(x *Call) string {
+	args := make([]string, len(x.Args))
+	for i, a := range x.Args {
+		args[i] = c.sql(a)
+	}
+	switch x.Name {
+	case "today":
+		return "CURRENT_DATE"
+	case "date":
+		return "(" + quoteLiteral(x.Args[0].(*StringLit).Value) + "::date)"
+	case "days_between":
+		return "((" + args[1] + " - " + args[0] + ")::float8)"
+	case "add_days":
+		return "(" + args[0] + " + round(" + args[1] + ")::int)"
+	case "year", "month", "day":
+		return "EXTRACT(" + strings.ToUpper(x.Name) + " FROM " + args[0] + ")::float8"
+	case "upper", "lower", "abs", "floor", "ceil":
+		return x.Name + "(" + args[0] + ")"
+	case "trim":
+		return "btrim(" + args[0] + ")"
+	case "length":
+		return "length(" + args[0] + ")::float8"
+	case "round":
+		if len(args) == 2 {
+			return "round(" + args[0] + "::numeric, round(" + args[1] + ")::int)::float8"
+		}
+		return "round(" + args[0] + ")"
+	case "coalesce":
+		return "COALESCE(" + strings.Join(args, ", ") + ")"
+	case "concat":
+		return "concat(" + strings.Join(args, ", ") + ")"
+	case "if":
+		return "(CASE WHEN " + args[0] + " THEN " + args[1] + " ELSE " + args[2] + " END)"
+	case "is_null":
+		return "(" + args[0] + " IS NULL)"
+	}
+	return "NULL"
+}
@@ -0,0 +1,285 @@
+package formula
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// cols is the schema the tests compile against.
+var cols = map[string]Type{
+	"title":      TypeText,
+	"status":     TypeText,
+	"quantity":   TypeNumber,
+	"unit_price": TypeNumber,
+	"due_date":   TypeDate,
+	"done":       TypeBool,
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		src  string
+		typ  Type
+		sql  string
+		refs []string
+	}{
+		{
+			src:  "quantity * unit_price",
+			typ:  TypeNumber,
+			sql:  "CAST(((d->>'quantity')::float8 * (d->>'unit_price')::float8) AS float8)",
+			refs: []string{"quantity", "unit_price"},
+		},
+		{
+			src:  "due_date < today() AND status != 'COMPLETED'",
+			typ:  TypeBool,
+			sql:  "CAST((((d->>'due_date')::date < CURRENT_DATE) AND ((d->>'status') <> 'COMPLETED')) AS boolean)",
+			refs: []string{"due_date", "status"},
+		},
+		{
+			src:  "quantity / unit_price",
+			typ:  TypeNumber,
+			sql:  "CAST(((d->>'quantity')::float8 / NULLIF((d->>'unit_price')::float8, 0)) AS float8)",
+			refs: []string{"quantity", "unit_price"},
+		},
+		{
+			src:  "'WO-' & Title",
+			typ:  TypeText,
+			sql:  "CAST(concat('WO-', (d->>'title')) AS text)",
+			refs: []string{"title"},
+		},
+		{
+			src:  "'it''s ' & title",
+			typ:  TypeText,
+			sql:  "CAST(concat('it''s ', (d->>'title')) AS text)",
+			refs: []string{"title"},
+		},
+		{
+			src:  "if(quantity > 10, 'bulk', NULL)",
+			typ:  TypeText,
+			sql:  "CAST((CASE WHEN ((d->>'quantity')::float8 > (10::float8)) THEN 'bulk' ELSE NULL::text END) AS text)",
+			refs: []string{"quantity"},
+		},
+		{
+			src:  "add_days(due_date, 7)",
+			typ:  TypeDate,
+			sql:  "CAST(((d->>'due_date')::date + round((7::float8))::int) AS date)",
+			refs: []string{"due_date"},
+		},
+		{
+			src:  "due_date - date('2026-01-01')",
+			typ:  TypeNumber,
+			sql:  "CAST((((d->>'due_date')::date - ('2026-01-01'::date))::float8) AS float8)",
+			refs: []string{"due_date"},
+		},
+		{
+			src:  "status IN ('OPEN', 'ON_HOLD')",
+			typ:  TypeBool,
+			sql:  "CAST(((d->>'status') IN ('OPEN', 'ON_HOLD')) AS boolean)",
+			refs: []string{"status"},
+		},
+		{
+			src:  "title = NULL OR NOT done",
+			typ:  TypeBool,
+			sql:  "CAST((((d->>'title') IS NULL) OR (NOT (d->>'done')::boolean)) AS boolean)",
+			refs: []string{"title", "done"},
+		},
+		{
+			src:  "coalesce(quantity, 0) * -1",
+			typ:  TypeNumber,
+			sql:  "CAST((COALESCE((d->>'quantity')::float8, (0::float8)) * (-(1::float8))) AS float8)",
+			refs: []string{"quantity"},
+		},
+		{
+			src:  "round(unit_price, 2)",
+			typ:  TypeNumber,
+			sql:  "CAST(round((d->>'unit_price')::float8::numeric, round((2::float8))::int)::float8 AS float8)",
+			refs: []string{"unit_price"},
+		},
+		{
+			src:  "year(due_date) = 2026",
+			typ:  TypeBool,
+			sql:  "CAST((EXTRACT(YEAR FROM (d->>'due_date')::date)::float8 = (2026::float8)) AS boolean)",
+			refs: []string{"due_date"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := Compile(tt.src, cols)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got.Type != tt.typ {
+				t.Errorf("type = %s, want %s", got.Type, tt.typ)
+			}
+			if got.SQL != tt.sql {
+				t.Errorf("sql =\n  %s\nwant\n  %s", got.SQL, tt.sql)
+			}
+			if !slices.Equal(got.Refs, tt.refs) {
+				t.Errorf("refs = %v, want %v", got.Refs, tt.refs)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		// Syntax
+		{"", "expression is empty"},
+		{"quantity *", "unexpected end of expression"},
+		{"(quantity + 1", "expected )"},
+		{"'open", "unterminated string"},
+		{"quantity # 2", "unexpected character '#'"},
+		{"status IN ('A', 'B'", "expected ) after IN list"},
+		{strings.Repeat("1+", 600) + "1", "expression is too long"},
+
+		// Unknown names
+		{"total * 2", `unknown column "total"`},
+		{"quantity + missing", `unknown column "missing"`},
+		{"current_user = title", `unknown column "current_user"`},
+		{"sqrt(quantity)", `unknown function "sqrt"`},
+
+		// Types
+		{"title + 1", "operator + expects numbers, got text"},
+		{"quantity = 'ten'", "cannot compare number with text"},
+		{"done < TRUE", "operator < does not apply to bool"},
+		{"quantity AND done", "AND expects bool operands, got number"},
+		{"NOT title", "NOT expects bool, got text"},
+		{"-status", "unary - expects number, got text"},
+		{"status IN ('OPEN', 2)", "IN values must share a type (text vs number)"},
+		{"if(quantity, 1, 2)", "if condition must be bool, got number"},
+		{"if(done, 1, 'two')", "if branches must share a type (number vs text)"},
+		{"coalesce(title, 0)", "coalesce arguments must share a type (text vs number)"},
+		{"upper(quantity)", "upper argument 1 must be text, got number"},
+		{"round(1, 2, 3)", "round expects 2 argument(s), got 3"},
+		{"date(title)", "date expects a 'YYYY-MM-DD' string literal"},
+		{"date('2026-02-30')", `invalid date "2026-02-30"`},
+		{"NULL", "expression always evaluates to NULL"},
+		{"('a', 'b')", "expected )"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src, cols)
+			if err == nil {
+				t.Fatalf("Compile succeeded, want error containing %q", tt.err)
+			}
+			var ferr *Error
+			if !errors.As(err, &ferr) {
+				t.Fatalf("error %T is not a *formula.Error", err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	_, err := Compile("quantity + missing", cols)
+	if err == nil || err.Error() != `unknown column "missing" (at position 12)` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestCompilePolicy(t *testing.T) {
+	got, err := CompilePolicy("status IN current_user.teams OR created_by = current_user", cols)
+	if err != nil {
+		t.Fatalf("CompilePolicy: %v", err)
+	}
+	want := "COALESCE((((d->>'status') = ANY(app.current_user_teams())) OR ((r.created_by::text) = (app.current_user_id()::text))), FALSE)"
+	if got.SQL != want {
+		t.Errorf("sql =\n  %s\nwant\n  %s", got.SQL, want)
+	}
+	if _, err := CompilePolicy("quantity + 1", cols); err == nil || !strings.Contains(err.Error(), "must be a condition") {
+		t.Errorf("non-bool policy: error = %v", err)
+	}
+}
+
+func TestCompileEventFilter(t *testing.T) {
+	got, err := CompileEventFilter("status = 'COMPLETED' AND old.status != 'COMPLETED'", cols)
+	if err != nil {
+		t.Fatalf("CompileEventFilter: %v", err)
+	}
+	want := "COALESCE((((d->>'status') = 'COMPLETED') AND ((o->>'status') <> 'COMPLETED')), FALSE)"
+	if got.SQL != want {
+		t.Errorf("sql =\n  %s\nwant\n  %s", got.SQL, want)
+	}
+	if !slices.Equal(got.Refs, []string{"status"}) {
+		t.Errorf("refs = %v, want [status]", got.Refs)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	got := References("if(done, quantity * unit_price, coalesce(quantity, 0)) > 0")
+	if want := []string{"done", "quantity", "unit_price"}; !slices.Equal(got, want) {
+		t.Errorf("References = %v, want %v", got, want)
+	}
+	if got := References("quantity +"); got != nil {
+		t.Errorf("References of invalid source = %v, want nil", got)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		exprs map[string]string
+		want  []string
+		err   string
+	}{
+		{
+			name:  "independent columns by name",
+			exprs: map[string]string{"b": "quantity + 1", "a": "quantity * 2"},
+			want:  []string{"a", "b"},
+		},
+		{
+			name: "dependencies first",
+			exprs: map[string]string{
+				"a_total":    "subtotal + tax",
+				"subtotal":   "quantity * unit_price",
+				"tax":        "subtotal * 0.2",
+				"is_overdue": "due_date < today()",
+			},
+			want: []string{"subtotal", "tax", "a_total", "is_overdue"},
+		},
+		{
+			name:  "self reference",
+			exprs: map[string]string{"total": "total + 1"},
+			err:   "computed columns read each other: total -> total",
+		},
+		{
+			name:  "two-column cycle",
+			exprs: map[string]string{"a": "b + 1", "b": "a + 1"},
+			err:   "computed columns read each other: a -> b -> a",
+		},
+		{
+			name: "cycle behind a dependency",
+			exprs: map[string]string{
+				"a": "b * 2",
+				"b": "c + d",
+				"c": "quantity",
+				"d": "b - 1",
+			},
+			err: "computed columns read each other: b -> d -> b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Order(tt.exprs)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Order: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
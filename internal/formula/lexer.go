@@ -0,0 +1,140 @@
+// Package formula implements the small expression language used by computed
+// columns and row policies on user tables. Expressions are parsed and
+// type-checked in Go and compiled to a SQL fragment over the composed row
+// JSON (bound as "d").
+package formula
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Error is returned for any parse or type error so callers can surface the
+// message to API clients as a validation failure.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Pos < 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s (at position %d)", e.Msg, e.Pos+1)
+}
+
+func errorf(pos int, format string, args ...any) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// maxLength bounds expression source size to keep compiled SQL reasonable.
+const maxLength = 1000
+
+func lex(src string) ([]token, error) {
+	if len(src) > maxLength {
+		return nil, errorf(-1, "expression is too long (max %d characters)", maxLength)
+	}
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			seenDot := false
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || (src[i] == '.' && !seenDot)) {
+				if src[i] == '.' {
+					seenDot = true
+				}
+				i++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], pos: start})
+		case c == '\'' || c == '"':
+			quote := src[i]
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(src) {
+				if src[i] == quote {
+					if i+1 < len(src) && src[i+1] == quote {
+						sb.WriteByte(quote)
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				if src[i] == 0 {
+					return nil, errorf(i, "invalid character in string")
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if !closed {
+				return nil, errorf(start, "unterminated string")
+			}
+			toks = append(toks, token{kind: tokString, text: sb.String(), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			// A dot joins qualified names such as current_user.teams.
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) ||
+				src[i] == '.' && i+1 < len(src) && (src[i+1] == '_' || unicode.IsLetter(rune(src[i+1])))) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			toks = append(toks, token{kind: tokComma, text: ",", pos: i})
+			i++
+		default:
+			two := ""
+			if i+1 < len(src) {
+				two = src[i : i+2]
+			}
+			switch two {
+			case "<=", ">=", "!=", "<>", "==":
+				toks = append(toks, token{kind: tokOp, text: two, pos: i})
+				i += 2
+				continue
+			}
+			switch c {
+			case '+', '-', '*', '/', '<', '>', '=', '&':
+				toks = append(toks, token{kind: tokOp, text: string(c), pos: i})
+				i++
+			default:
+				return nil, errorf(i, "unexpected character %q", c)
+			}
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(src)})
+	return toks, nil
+}
@@ -0,0 +1,349 @@
+package formula
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is an expression tree node.
+type Node interface{ pos() int }
+
+type (
+	// NumberLit is a numeric literal.
+	NumberLit struct {
+		Value float64
+		At    int
+	}
+	// StringLit is a quoted string literal.
+	StringLit struct {
+		Value string
+		At    int
+	}
+	// BoolLit is TRUE or FALSE.
+	BoolLit struct {
+		Value bool
+		At    int
+	}
+	// NullLit is NULL.
+	NullLit struct{ At int }
+	// Ident references a sibling column by name.
+	Ident struct {
+		Name string
+		At   int
+	}
+	// Unary is a prefix operator (NOT, -).
+	Unary struct {
+		Op string
+		X  Node
+		At int
+	}
+	// Binary is an infix operator.
+	Binary struct {
+		Op   string
+		L, R Node
+		At   int
+	}
+	// Call is a whitelisted function call.
+	Call struct {
+		Name string
+		Args []Node
+		At   int
+	}
+	// List is a parenthesised list of values, the right side of IN.
+	List struct {
+		Items []Node
+		At    int
+	}
+)
+
+func (n *NumberLit) pos() int { return n.At }
+func (n *StringLit) pos() int { return n.At }
+func (n *BoolLit) pos() int   { return n.At }
+func (n *NullLit) pos() int   { return n.At }
+func (n *Ident) pos() int     { return n.At }
+func (n *Unary) pos() int     { return n.At }
+func (n *Binary) pos() int    { return n.At }
+func (n *Call) pos() int      { return n.At }
+func (n *List) pos() int      { return n.At }
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+// Parse turns expression source into a tree. It does not validate column
+// references or types; see Check.
+func Parse(src string) (Node, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errorf(-1, "expression is empty")
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+func (p *parser) next() token { t := p.toks[p.i]; p.i++; return t }
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) op(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return t, false
+	}
+	for _, o := range ops {
+		if t.text == o {
+			return t, true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		t := p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{Op: "OR", L: l, R: r, At: t.pos}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		t := p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{Op: "AND", L: l, R: r, At: t.pos}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.keyword("not") {
+		t := p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: "NOT", X: x, At: t.pos}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *parser) parseCmp() (Node, error) {
+	l, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("in") || p.keyword("not") && p.toks[p.i+1].kind == tokIdent && strings.EqualFold(p.toks[p.i+1].text, "in") {
+		t := p.next()
+		op := "IN"
+		if strings.EqualFold(t.text, "not") {
+			p.next()
+			op = "NOT IN"
+		}
+		r, err := p.parseSet()
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: op, L: l, R: r, At: t.pos}, nil
+	}
+	if t, ok := p.op("=", "==", "!=", "<>", "<", "<=", ">", ">="); ok {
+		p.next()
+		r, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		op := t.text
+		switch op {
+		case "==":
+			op = "="
+		case "<>":
+			op = "!="
+		}
+		return &Binary{Op: op, L: l, R: r, At: t.pos}, nil
+	}
+	return l, nil
+}
+
+// parseSet reads the right side of IN: a list of values in parentheses, or
+// a single operand such as current_user.teams.
+func (p *parser) parseSet() (Node, error) {
+	if p.peek().kind != tokLParen {
+		return p.parseConcat()
+	}
+	t := p.next()
+	list := &List{At: t.pos}
+	for {
+		item, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, item)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if c := p.next(); c.kind != tokRParen {
+		return nil, errorf(c.pos, "expected ) after IN list")
+	}
+	return list, nil
+}
+
+func (p *parser) parseConcat() (Node, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.op("&")
+		if !ok {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{Op: "&", L: l, R: r, At: t.pos}
+	}
+}
+
+func (p *parser) parseAdd() (Node, error) {
+	l, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.op("+", "-")
+		if !ok {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{Op: t.text, L: l, R: r, At: t.pos}
+	}
+}
+
+func (p *parser) parseMul() (Node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.op("*", "/")
+		if !ok {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &Binary{Op: t.text, L: l, R: r, At: t.pos}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t, ok := p.op("-"); ok {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: "-", X: x, At: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		return &NumberLit{Value: v, At: t.pos}, nil
+	case tokString:
+		return &StringLit{Value: t.text, At: t.pos}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, errorf(c.pos, "expected )")
+		}
+		return n, nil
+	case tokIdent:
+		word := strings.ToLower(t.text)
+		switch word {
+		case "true":
+			return &BoolLit{Value: true, At: t.pos}, nil
+		case "false":
+			return &BoolLit{Value: false, At: t.pos}, nil
+		case "null":
+			return &NullLit{At: t.pos}, nil
+		case "and", "or", "not", "in":
+			return nil, errorf(t.pos, "unexpected %q", t.text)
+		}
+		if p.peek().kind == tokLParen {
+			p.next()
+			var args []Node
+			if p.peek().kind != tokRParen {
+				for {
+					a, err := p.parseOr()
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, a)
+					if p.peek().kind == tokComma {
+						p.next()
+						continue
+					}
+					break
+				}
+			}
+			if c := p.next(); c.kind != tokRParen {
+				return nil, errorf(c.pos, "expected ) after arguments to %s", word)
+			}
+			return &Call{Name: word, Args: args, At: t.pos}, nil
+		}
+		return &Ident{Name: word, At: t.pos}, nil
+	case tokEOF:
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %q", t.text)
+}
@@ -0,0 +1,483 @@
+// Package automations manages the org's automations and their run logs.
+// Running them happens in internal/automations.
+package automations
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"yourapp/internal/formula"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/mail"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// triggers are the values of trigger.on.
+var triggers = map[string]bool{
+	models.TriggerCreated: true,
+	models.TriggerUpdated: true,
+	models.TriggerDeleted: true,
+	models.TriggerChanged: true,
+}
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// input is the request body of Create and Update.
+type input struct {
+	Name      string                    `json:"name"`
+	Table     string                    `json:"table"` // name or slug
+	Trigger   models.AutomationTrigger  `json:"trigger"`
+	Condition string                    `json:"condition"` // e.g. "priority = 'HIGH'"
+	Actions   []models.AutomationAction `json:"actions"`
+	Mode      string                    `json:"mode"`   // sync (default) or async
+	Active    *bool                     `json:"active"` // default true
+}
+
+// table is a user table with the formula types of its columns.
+type table struct {
+	id       int64
+	slug     string
+	cols     map[string]formula.Type       // by lower-case name, every column
+	writable map[string]models.TableColumn // by lower-case name, value columns only
+}
+
+// List handles GET /automations
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListAutomations(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"automations": list})
+}
+
+// Get handles GET /automations/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	a, found, err := h.repo.GetAutomation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "automation not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"automation": a})
+}
+
+// Create handles POST /automations with body
+// {"name":"Escalate","table":"work_orders","trigger":{"on":"changed","field":"priority","to":"HIGH"},
+// "actions":[{"type":"set_fields","values":{"due_date":"today() + 1"}}]}.
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	a, ok := h.decode(w, r, orgID)
+	if !ok {
+		return
+	}
+	id, err := h.repo.CreateAutomation(r.Context(), orgID, a)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "create failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created, _, err := h.repo.GetAutomation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"automation": created})
+}
+
+// Update handles PUT /automations/{id} with the same body as Create and
+// replaces the automation. Queued runs execute the new actions.
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	a, ok := h.decode(w, r, orgID)
+	if !ok {
+		return
+	}
+	a.ID = id
+	found, err := h.repo.UpdateAutomation(r.Context(), orgID, a)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "automation not found"})
+		return
+	}
+	updated, _, err := h.repo.GetAutomation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"automation": updated})
+}
+
+// Delete handles DELETE /automations/{id}; its run log and queued runs go
+// with it.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteAutomation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "automation not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"deleted": true, "id": id})
+}
+
+// Runs handles GET /automations/{id}/runs?status=failed&limit=50, the
+// automation's run log, newest first.
+func (h *Handler) Runs(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.RunPending, models.RunSucceeded, models.RunFailed, models.RunSkipped:
+	default:
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "status must be pending, succeeded, failed or skipped"})
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+	_, found, err := h.repo.GetAutomation(r.Context(), orgID, id)
+	if err != nil {
+		code, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "automation not found"})
+		return
+	}
+	list, err := h.repo.ListAutomationRuns(r.Context(), orgID, id, status, limit)
+	if err != nil {
+		code, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"runs": list})
+}
+
+// Retry handles POST /automations/{id}/runs/{run_id}/retry and queues a
+// failed async run again with a fresh retry budget. Failed sync runs are
+// not retried: the change that triggered them was rolled back.
+func (h *Handler) Retry(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	runID, err := strconv.ParseInt(chi.URLParam(r, "run_id"), 10, 64)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid run_id"})
+		return
+	}
+	found, err := h.repo.RetryAutomationRun(r.Context(), orgID, id, runID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "retry failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "no failed async run with that id"})
+		return
+	}
+	httpserver.JSON(w, http.StatusAccepted, map[string]any{"run_id": runID, "status": models.RunPending})
+}
+
+// decode reads and validates a Create or Update body, resolving its tables
+// and compiling its condition and values. It writes the error response
+// when invalid.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (models.Automation, bool) {
+	defer r.Body.Close()
+	var in input
+	if !httpserver.Decode(w, r, &in) {
+		return models.Automation{}, false
+	}
+	a := models.Automation{
+		Name:      strings.TrimSpace(in.Name),
+		Trigger:   in.Trigger,
+		Condition: strings.TrimSpace(in.Condition),
+		Mode:      in.Mode,
+		Active:    in.Active == nil || *in.Active,
+	}
+	if a.Mode == "" {
+		a.Mode = models.AutomationSync
+	}
+	if msg := checkAutomation(&a, in.Actions); msg != "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return models.Automation{}, false
+	}
+
+	tables, err := h.repo.ListUserTables(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.Automation{}, false
+	}
+	// resolve finds a table by name or slug and loads its columns.
+	resolve := func(name string) (table, string, error) {
+		name = strings.TrimSpace(name)
+		for _, t := range tables {
+			if t.Slug == strings.ToLower(name) || strings.EqualFold(t.Name, name) {
+				schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, t.Slug)
+				if err != nil {
+					return table{}, "", err
+				}
+				tb := table{id: t.ID, slug: t.Slug, cols: map[string]formula.Type{}, writable: map[string]models.TableColumn{}}
+				for _, c := range schema {
+					typ, ok := formula.TypeOfColumn(c.Type)
+					if !ok {
+						continue
+					}
+					tb.cols[strings.ToLower(c.Name)] = typ
+					if c.Kind != "computed" && c.Kind != "rollup" {
+						tb.writable[strings.ToLower(c.Name)] = c
+					}
+				}
+				return tb, "", nil
+			}
+		}
+		return table{}, "table " + strconv.Quote(name) + " not found", nil
+	}
+	fail := func(err error, msg string) (models.Automation, bool) {
+		if err != nil {
+			status, m := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": m})
+		} else {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		}
+		return models.Automation{}, false
+	}
+
+	src, msg, err := resolve(in.Table)
+	if err != nil || msg != "" {
+		return fail(err, msg)
+	}
+	a.TableID, a.Table = src.id, src.slug
+	refs := newRefs()
+	if a.Trigger.On == models.TriggerChanged {
+		field := strings.ToLower(a.Trigger.Field)
+		if _, ok := src.cols[field]; !ok {
+			return fail(nil, "trigger field "+strconv.Quote(a.Trigger.Field)+" is not a column of "+src.slug)
+		}
+		refs.add(src.id, field)
+	}
+	if a.Condition != "" {
+		compiled, err := formula.CompileAutomationCondition(a.Condition, src.cols)
+		if err != nil {
+			return fail(nil, "invalid condition: "+err.Error())
+		}
+		a.ConditionSQL = compiled.SQL
+		refs.add(src.id, compiled.Refs...)
+	}
+
+	for i := range a.Actions {
+		act := &a.Actions[i]
+		prefix := fmt.Sprintf("action %d (%s): ", i+1, act.Type)
+		switch act.Type {
+		case models.ActionSetFields, models.ActionCreateRow:
+			target := src
+			if act.Type == models.ActionCreateRow {
+				if target, msg, err = resolve(act.Table); err != nil || msg != "" {
+					return fail(err, prefix+msg)
+				}
+				act.TableID, act.Table = target.id, target.slug
+			}
+			values := make(map[string]string, len(act.Values))
+			act.SQL = make(map[string]string, len(act.Values))
+			for name, expr := range act.Values {
+				col, ok := target.writable[strings.ToLower(name)]
+				if !ok {
+					return fail(nil, prefix+strconv.Quote(name)+" is not a value column of "+target.slug)
+				}
+				compiled, err := formula.CompileAutomationValue(expr, src.cols)
+				if err != nil {
+					return fail(nil, prefix+"invalid value for "+col.Name+": "+err.Error())
+				}
+				if want := target.cols[strings.ToLower(name)]; compiled.Type != want && compiled.Type != formula.TypeNull {
+					return fail(nil, fmt.Sprintf("%s%s is a %s column, the value is a %s", prefix, col.Name, want, compiled.Type))
+				}
+				values[col.Name] = strings.TrimSpace(expr)
+				act.SQL[col.Name] = compiled.SQL
+				refs.add(target.id, strings.ToLower(col.Name))
+				refs.add(src.id, compiled.Refs...)
+			}
+			act.Values = values
+		case models.ActionWebhook:
+			_, found, err := h.repo.GetWebhook(r.Context(), orgID, *act.WebhookID)
+			if err != nil || !found {
+				return fail(err, prefix+"webhook not found")
+			}
+		case models.ActionEmail:
+			act.SQL = make(map[string]string, 2)
+			for key, expr := range map[string]string{"subject": act.Subject, "body": act.Body} {
+				if expr == "" {
+					continue
+				}
+				compiled, err := formula.CompileAutomationValue(expr, src.cols)
+				if err != nil {
+					return fail(nil, prefix+"invalid "+key+": "+err.Error())
+				}
+				act.SQL[key] = compiled.SQL
+				refs.add(src.id, compiled.Refs...)
+			}
+		}
+	}
+	a.Refs = refs.list
+	return a, true
+}
+
+// checkAutomation validates what of an automation needs no lookups: its
+// name, trigger, mode and the shape of its actions, which it normalises.
+// It returns a message for the client when invalid.
+func checkAutomation(a *models.Automation, actions []models.AutomationAction) string {
+	if a.Name == "" || len(a.Name) > 100 {
+		return "name is required (at most 100 characters)"
+	}
+	if !triggers[a.Trigger.On] {
+		return "trigger.on must be created, updated, deleted or changed"
+	}
+	a.Trigger.Field = strings.TrimSpace(a.Trigger.Field)
+	if a.Trigger.On == models.TriggerChanged {
+		if a.Trigger.Field == "" {
+			return "a changed trigger needs a field"
+		}
+	} else if a.Trigger.Field != "" || a.Trigger.To != nil {
+		return "trigger field and to are only for the changed trigger"
+	}
+	if a.Mode != models.AutomationSync && a.Mode != models.AutomationAsync {
+		return "mode must be sync or async"
+	}
+	if len(actions) == 0 || len(actions) > 20 {
+		return "between 1 and 20 actions are required"
+	}
+	a.Actions = make([]models.AutomationAction, 0, len(actions))
+	for i, in := range actions {
+		prefix := fmt.Sprintf("action %d (%s): ", i+1, in.Type)
+		act := models.AutomationAction{Type: in.Type}
+		switch in.Type {
+		case models.ActionSetFields:
+			if a.Trigger.On == models.TriggerDeleted {
+				return prefix + "a deleted row has no fields to set"
+			}
+			if len(in.Values) == 0 {
+				return prefix + "values are required"
+			}
+			act.Values = in.Values
+		case models.ActionCreateRow:
+			if strings.TrimSpace(in.Table) == "" {
+				return prefix + "table is required"
+			}
+			act.Table, act.Values = in.Table, in.Values
+		case models.ActionWebhook:
+			if in.WebhookID == nil {
+				return prefix + "webhook_id is required"
+			}
+			act.WebhookID = in.WebhookID
+		case models.ActionEmail:
+			if len(in.To) == 0 {
+				return prefix + "to is required"
+			}
+			for _, addr := range in.To {
+				if !mail.ValidAddress(addr) {
+					return prefix + "invalid address " + strconv.Quote(addr)
+				}
+			}
+			if strings.TrimSpace(in.Subject) == "" {
+				return prefix + "subject is required"
+			}
+			act.To = in.To
+			act.Subject, act.Body = strings.TrimSpace(in.Subject), strings.TrimSpace(in.Body)
+		default:
+			return "action " + strconv.Itoa(i+1) + ": type must be set_fields, create_row, webhook or email"
+		}
+		a.Actions = append(a.Actions, act)
+	}
+	return ""
+}
+
+// refs collects the "<table_id>.<column>" references of an automation,
+// which guard the columns and tables it uses against removal.
+type refs struct {
+	list []string
+	seen map[string]bool
+}
+
+func newRefs() *refs { return &refs{seen: map[string]bool{}} }
+
+func (r *refs) add(tableID int64, columns ...string) {
+	for _, c := range columns {
+		ref := strconv.FormatInt(tableID, 10) + "." + strings.ToLower(c)
+		if !r.seen[ref] {
+			r.seen[ref] = true
+			r.list = append(r.list, ref)
+		}
+	}
+}
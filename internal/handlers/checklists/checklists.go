@@ -0,0 +1,240 @@
+// Package checklists serves checklist templates and the checklists copied
+// onto work orders, answered item by item. Answers are checked and recorded
+// by internal/checklists.
+package checklists
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	check "yourapp/internal/checklists"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// workOrder returns the values of the work order of the {id} parameter,
+// writing 404 unless the caller sees it. When edit is set it writes 403
+// unless the caller may edit it and 409 when it is completed, cancelled or
+// archived.
+func (h *Handler) workOrder(w http.ResponseWriter, r *http.Request, orgID, userID uuid.UUID, edit bool) (uuid.UUID, map[string]any, bool) {
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, nil, false
+	}
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, userID, pm.WorkOrderTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, nil, false
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work orders table not found"})
+		return uuid.Nil, nil, false
+	}
+	rowTable, rowPerms, found, err := h.repo.GetRowPermissions(r.Context(), orgID, userID, id)
+	var data map[string]any
+	if err == nil && found && rowTable == tableID {
+		data, found, err = h.repo.GetRowData(r.Context(), orgID, id)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, nil, false
+	}
+	if !found || rowTable != tableID || data == nil {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work order not found"})
+		return uuid.Nil, nil, false
+	}
+	if !edit {
+		return id, data, true
+	}
+	if !rowPerms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return uuid.Nil, nil, false
+	}
+	if !pm.Open(data) {
+		httpserver.JSON(w, http.StatusConflict, map[string]string{"error": "the work order is closed"})
+		return uuid.Nil, nil, false
+	}
+	return id, data, true
+}
+
+// checklists returns the checklists of a work order, writing 500 on error.
+func (h *Handler) checklists(w http.ResponseWriter, r *http.Request, orgID, woID uuid.UUID) ([]models.Checklist, bool) {
+	list, err := h.repo.ListWorkOrderChecklists(r.Context(), orgID, woID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return nil, false
+	}
+	if list == nil {
+		list = []models.Checklist{}
+	}
+	return list, true
+}
+
+// item returns the work order and the item of the {checklist_id} and
+// {item_id} parameters for a caller who may edit the work order, writing
+// 404 when the work order has no such item.
+func (h *Handler) item(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, uuid.UUID, map[string]any, models.ChecklistItem, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+	}
+	woID, data, ok := h.workOrder(w, r, orgID, sess.UserID, true)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+	}
+	checklistID, ok := httpserver.PathID(w, r, "checklist_id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+	}
+	itemID, ok := httpserver.PathID(w, r, "item_id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+	}
+	list, ok := h.checklists(w, r, orgID, woID)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+	}
+	for _, c := range list {
+		if c.ID != checklistID {
+			continue
+		}
+		for _, it := range c.Items {
+			if it.ID == itemID {
+				return orgID, sess.UserID, woID, data, it, true
+			}
+		}
+	}
+	httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "checklist item not found"})
+	return uuid.Nil, uuid.Nil, uuid.Nil, nil, models.ChecklistItem{}, false
+}
+
+// WorkOrderChecklists handles GET /work-orders/{id}/checklists: the
+// checklists of the work order with their items and answers, and how many
+// required items are not answered yet.
+func (h *Handler) WorkOrderChecklists(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, _, ok := h.workOrder(w, r, orgID, sess.UserID, false)
+	if !ok {
+		return
+	}
+	list, ok := h.checklists(w, r, orgID, woID)
+	if !ok {
+		return
+	}
+	open := 0
+	for _, c := range list {
+		open += c.Open
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"checklists": list, "open": open})
+}
+
+// AddChecklist handles POST /work-orders/{id}/checklists with body
+// {"template_id":"..."}: copies the template's items onto the work order,
+// which must be open. It answers the checklists of the work order.
+func (h *Handler) AddChecklist(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, _, ok := h.workOrder(w, r, orgID, sess.UserID, true)
+	if !ok {
+		return
+	}
+	var in struct {
+		TemplateID string `json:"template_id"`
+	}
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	templateID, err := uuid.Parse(strings.TrimSpace(in.TemplateID))
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid template_id"})
+		return
+	}
+	list, err := check.Add(r.Context(), h.repo, orgID, sess.UserID, woID, templateID)
+	if err != nil {
+		httpserver.WriteError(w, err, "add failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"checklists": list})
+}
+
+// DeleteChecklist handles DELETE /work-orders/{id}/checklists/{checklist_id}:
+// removes a checklist, answers included, from an open work order.
+func (h *Handler) DeleteChecklist(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, _, ok := h.workOrder(w, r, orgID, sess.UserID, true)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "checklist_id")
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteChecklist(r.Context(), orgID, woID, id)
+	if err != nil {
+		httpserver.WriteError(w, err, "delete failed")
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "checklist not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AnswerItem handles PUT /work-orders/{id}/checklists/{checklist_id}/items/{item_id}
+// with body {"result":"...","reading":1.5,"text":"...","file":"...","note":"...","follow_up":true}:
+// answers an item as the caller, replacing an earlier answer. A failed item
+// taking a follow-up creates a corrective work order once. It answers the
+// item's checklist.
+func (h *Handler) AnswerItem(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, woID, data, item, ok := h.item(w, r)
+	if !ok {
+		return
+	}
+	var in check.Answer
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	c, err := check.Record(r.Context(), h.repo, orgID, userID, woID, data, item, in)
+	if err != nil {
+		httpserver.WriteError(w, err, "answer failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, c)
+}
+
+// ClearItem handles DELETE /work-orders/{id}/checklists/{checklist_id}/items/{item_id}/result:
+// unanswers an item. It answers the item's checklist.
+func (h *Handler) ClearItem(w http.ResponseWriter, r *http.Request) {
+	orgID, _, woID, _, item, ok := h.item(w, r)
+	if !ok {
+		return
+	}
+	c, err := check.Clear(r.Context(), h.repo, orgID, woID, item)
+	if err != nil {
+		httpserver.WriteError(w, err, "clear failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, c)
+}
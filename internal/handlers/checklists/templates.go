@@ -0,0 +1,158 @@
+package checklists
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	check "yourapp/internal/checklists"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+)
+
+// templateInput is the request body of CreateTemplate and UpdateTemplate.
+// Items are numbered in order; required defaults to true.
+type templateInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Items       []struct {
+		Label    string   `json:"label"`
+		Kind     string   `json:"kind"`
+		Required *bool    `json:"required"`
+		Min      *float64 `json:"min"`
+		Max      *float64 `json:"max"`
+		Unit     string   `json:"unit"`
+		FollowUp bool     `json:"follow_up"`
+		Help     string   `json:"help"`
+	} `json:"items"`
+}
+
+func (in templateInput) template(id uuid.UUID) models.ChecklistTemplate {
+	t := models.ChecklistTemplate{ID: id, Name: in.Name, Description: in.Description}
+	for _, it := range in.Items {
+		t.Items = append(t.Items, models.ChecklistTemplateItem{
+			Label:    it.Label,
+			Kind:     it.Kind,
+			Required: it.Required == nil || *it.Required,
+			Min:      it.Min,
+			Max:      it.Max,
+			Unit:     it.Unit,
+			FollowUp: it.FollowUp,
+			Help:     it.Help,
+		})
+	}
+	return t
+}
+
+// Templates handles GET /checklists/templates: the org's checklist
+// templates by name, with their item counts.
+func (h *Handler) Templates(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListChecklistTemplates(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, list)
+}
+
+// Template handles GET /checklists/templates/{id}: a template with its
+// items.
+func (h *Handler) Template(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	t, found, err := h.repo.GetChecklistTemplate(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "checklist template not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, t)
+}
+
+// CreateTemplate handles POST /checklists/templates with body
+// {"name":"...","description":"...","items":[{"label":"...","kind":"reading","min":0,"max":80,"unit":"°C","follow_up":true}]}.
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	var in templateInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	t := in.template(uuid.Nil)
+	t.CreatedBy = &sess.UserID
+	t, _, err := check.Save(r.Context(), h.repo, orgID, t)
+	if err != nil {
+		httpserver.WriteError(w, err, "create failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, t)
+}
+
+// UpdateTemplate handles PUT /checklists/templates/{id} with the body of
+// CreateTemplate, replacing the template's items. Checklists already on
+// work orders keep the items they were copied with.
+func (h *Handler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var in templateInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	t, found, err := check.Save(r.Context(), h.repo, orgID, in.template(id))
+	if err != nil {
+		httpserver.WriteError(w, err, "update failed")
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "checklist template not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, t)
+}
+
+// DeleteTemplate handles DELETE /checklists/templates/{id}. Checklists
+// copied from it stay on their work orders; PM schedules naming it stop
+// adding it.
+func (h *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteChecklistTemplate(r.Context(), orgID, id)
+	if err != nil {
+		httpserver.WriteError(w, err, "delete failed")
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "checklist template not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
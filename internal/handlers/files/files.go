@@ -0,0 +1,405 @@
+// Package files serves uploads, downloads and signed download URLs of
+// files, and their links to rows of any table. Content is stored by
+// internal/files.
+package files
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	blobs "yourapp/internal/files"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// maxList bounds the files answered by List.
+const maxList = 500
+
+type Handler struct {
+	repo  repo.Repo
+	files *blobs.Service
+}
+
+func New(repo repo.Repo, files *blobs.Service) *Handler { return &Handler{repo: repo, files: files} }
+
+// file returns the file of the {id} parameter, writing 404 when the org
+// has none.
+func (h *Handler) file(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (models.File, bool) {
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return models.File{}, false
+	}
+	f, found, err := h.repo.GetFile(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.File{}, false
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return models.File{}, false
+	}
+	return f, true
+}
+
+// row checks the row a request names, writing 404 unless the caller sees it
+// and 403 when edit is set and the caller may not edit it.
+func (h *Handler) row(w http.ResponseWriter, r *http.Request, orgID, userID, rowID uuid.UUID, edit bool) bool {
+	_, perms, found, err := h.repo.GetRowPermissions(r.Context(), orgID, userID, rowID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return false
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return false
+	}
+	if edit && !perms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return false
+	}
+	return true
+}
+
+// rowParam parses the optional row_id query parameter, writing 400 when
+// invalid.
+func rowParam(w http.ResponseWriter, r *http.Request) (*uuid.UUID, bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("row_id"))
+	if raw == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid row_id"})
+		return nil, false
+	}
+	return &id, true
+}
+
+// List handles GET /files?row_id=&limit=100: the org's files, newest
+// first, or those linked to a row the caller sees.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	rowID, ok := rowParam(w, r)
+	if !ok {
+		return
+	}
+	if rowID != nil && !h.row(w, r, orgID, sess.UserID, *rowID, false) {
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxList {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be 1 to " + strconv.Itoa(maxList)})
+			return
+		}
+		limit = n
+	}
+	list, err := h.repo.ListFiles(r.Context(), orgID, rowID, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"files": list})
+}
+
+// Upload handles POST /files?row_id= with a multipart/form-data body whose
+// "file" part is the file: stores it and links it to the row when named,
+// which the caller must be able to edit. 201 with the file, or 200 with
+// the file the org already had with the same content.
+func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	rowID, ok := rowParam(w, r)
+	if !ok {
+		return
+	}
+	if rowID != nil && !h.row(w, r, orgID, sess.UserID, *rowID, true) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.files.MaxSize()+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "expected a multipart/form-data body"})
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "the file part is missing"})
+			return
+		}
+		if err != nil {
+			httpserver.WriteError(w, err, "invalid multipart body")
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		f, created, err := h.files.Upload(r.Context(), orgID, sess.UserID, part.FileName(), part)
+		part.Close()
+		if err == nil && rowID != nil {
+			err = h.repo.LinkFile(r.Context(), orgID, f.ID, *rowID, &sess.UserID)
+		}
+		if err != nil {
+			httpserver.WriteError(w, err, "upload failed")
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		httpserver.JSON(w, status, f)
+		return
+	}
+}
+
+// Get handles GET /files/{id}: the file with the rows it is linked to that
+// the caller sees.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.file(w, r, orgID)
+	if !ok {
+		return
+	}
+	links, err := h.repo.ListFileLinks(r.Context(), orgID, f.ID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"file": f, "links": links})
+}
+
+// Content handles GET /files/{id}/content: the file's content.
+func (h *Handler) Content(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	if f, ok := h.file(w, r, orgID); ok {
+		h.serve(w, r, orgID, f, false)
+	}
+}
+
+// Thumbnail handles GET /files/{id}/thumbnail: a JPEG of an image scaled
+// to fit 320 pixels; 404 for files without one.
+func (h *Handler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	if f, ok := h.file(w, r, orgID); ok {
+		h.serve(w, r, orgID, f, true)
+	}
+}
+
+// serve writes the content of a file, or of its thumbnail. Files are
+// content-addressed, so their SHA-256 is a strong ETag.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, f models.File, thumb bool) {
+	etag := `"` + f.SHA256 + `"`
+	if thumb {
+		etag = `"` + f.SHA256 + `.thumb"`
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, err := h.files.Open(r.Context(), orgID, f, thumb)
+	if errors.Is(err, blobs.ErrNotFound) {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "content not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "files: open failed", "file_id", f.ID.String(), "err", err)
+		httpserver.JSON(w, http.StatusBadGateway, map[string]string{"error": "the file store failed"})
+		return
+	}
+	defer body.Close()
+	ct, disposition := f.ContentType, "attachment"
+	if strings.HasPrefix(ct, "image/") {
+		disposition = "inline"
+	}
+	if thumb {
+		ct = "image/jpeg"
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(f.Size, 10))
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": f.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		slog.WarnContext(r.Context(), "files: download interrupted", "file_id", f.ID.String(), "err", err)
+	}
+}
+
+// URL handles GET /files/{id}/url?variant=content|thumbnail: a signed URL
+// downloading the file without a session until it expires,
+// {"url":"...","expires_at":"..."}.
+func (h *Handler) URL(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.file(w, r, orgID)
+	if !ok {
+		return
+	}
+	variant := r.URL.Query().Get("variant")
+	switch variant {
+	case "", blobs.VariantContent:
+		variant = blobs.VariantContent
+	case blobs.VariantThumbnail:
+		if !f.Thumbnail {
+			httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "the file has no thumbnail"})
+			return
+		}
+	default:
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "variant must be content or thumbnail"})
+		return
+	}
+	url, expires := h.files.SignedURL(orgID, f.ID, variant, time.Now())
+	httpserver.JSON(w, http.StatusOK, map[string]any{"url": url, "expires_at": expires})
+}
+
+// Signed handles GET /files/signed/{id}?org=&variant=&expires=&sig=, the
+// URLs made by URL; no session is needed. 403 when the signature does not
+// match or has expired.
+func (h *Handler) Signed(w http.ResponseWriter, r *http.Request) {
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	orgID, err := uuid.Parse(q.Get("org"))
+	expires, err2 := strconv.ParseInt(q.Get("expires"), 10, 64)
+	variant := q.Get("variant")
+	if err != nil || err2 != nil || !h.files.Verify(orgID, id, variant, expires, q.Get("sig"), time.Now()) {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "invalid or expired signature"})
+		return
+	}
+	ctx := repo.WithOrg(r.Context(), orgID)
+	f, found, err := h.repo.GetFile(ctx, orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return
+	}
+	h.serve(w, r.WithContext(ctx), orgID, f, variant == blobs.VariantThumbnail)
+}
+
+// Delete handles DELETE /files/{id}: deletes a file, its links and its
+// content. Only its uploader and admins may.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.file(w, r, orgID)
+	if !ok {
+		return
+	}
+	if f.CreatedBy == nil || *f.CreatedBy != sess.UserID {
+		role, err := h.repo.GetRole(r.Context(), orgID, sess.UserID)
+		if err != nil || (role != models.RoleAdmin && role != models.RoleOwner) {
+			httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "only the uploader and admins may delete a file"})
+			return
+		}
+	}
+	if _, err := h.files.Delete(r.Context(), orgID, f); err != nil {
+		httpserver.WriteError(w, err, "delete failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Link handles POST /files/{id}/links with body {"row_id":"..."}: links the
+// file to a row the caller may edit. Linking it again is a no-op.
+func (h *Handler) Link(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.file(w, r, orgID)
+	if !ok {
+		return
+	}
+	var in struct {
+		RowID string `json:"row_id"`
+	}
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	rowID, err := uuid.Parse(strings.TrimSpace(in.RowID))
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid row_id"})
+		return
+	}
+	if !h.row(w, r, orgID, sess.UserID, rowID, true) {
+		return
+	}
+	if err := h.repo.LinkFile(r.Context(), orgID, f.ID, rowID, &sess.UserID); err != nil {
+		httpserver.WriteError(w, err, "link failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unlink handles DELETE /files/{id}/links/{row_id}: removes the link of the
+// file to a row the caller may edit. The file stays.
+func (h *Handler) Unlink(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.file(w, r, orgID)
+	if !ok {
+		return
+	}
+	rowID, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	if !h.row(w, r, orgID, sess.UserID, rowID, true) {
+		return
+	}
+	removed, err := h.repo.UnlinkFile(r.Context(), orgID, f.ID, rowID)
+	if err != nil {
+		httpserver.WriteError(w, err, "unlink failed")
+		return
+	}
+	if !removed {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "the file is not linked to the row"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
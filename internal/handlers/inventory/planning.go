@@ -0,0 +1,297 @@
+package inventory
+
+import (
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	stock "yourapp/internal/inventory"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+)
+
+// reservationInput is the request body of Reserve.
+type reservationInput struct {
+	PartID      string   `json:"part_id"`
+	WorkOrderID string   `json:"work_order_id"`
+	BinID       string   `json:"bin_id"`
+	Quantity    *float64 `json:"quantity"`
+	NeededOn    string   `json:"needed_on"` // YYYY-MM-DD
+	Note        string   `json:"note"`
+}
+
+// orderInput is the request body of CreateOrder.
+type orderInput struct {
+	PartID     string   `json:"part_id"`
+	Quantity   *float64 `json:"quantity"`
+	Supplier   string   `json:"supplier"`
+	Reference  string   `json:"reference"`
+	ExpectedOn string   `json:"expected_on"` // YYYY-MM-DD
+}
+
+// positive reports whether q is a positive number, writing 400 when not.
+func positive(w http.ResponseWriter, q *float64) bool {
+	if q == nil || math.IsNaN(*q) || math.IsInf(*q, 0) || *q <= 0 {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "quantity must be a positive number"})
+		return false
+	}
+	return true
+}
+
+// statusParam parses the status query parameter, one of allowed or empty.
+func statusParam(w http.ResponseWriter, r *http.Request, allowed ...string) (string, bool) {
+	s := r.URL.Query().Get("status")
+	if s == "" {
+		return "", true
+	}
+	for _, a := range allowed {
+		if s == a {
+			return s, true
+		}
+	}
+	httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "status must be one of " + strings.Join(allowed, ", ")})
+	return "", false
+}
+
+// Reservations handles GET
+// /inventory/reservations?part_id=&work_order_id=&status=: reservations,
+// the soonest needed first.
+func (h *Handler) Reservations(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	f, ok := filter(w, r)
+	if !ok {
+		return
+	}
+	st, ok := statusParam(w, r, models.ReservationActive, models.ReservationFulfilled, models.ReservationReleased)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListStockReservations(r.Context(), orgID, tableID, f, st)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"reservations": list})
+}
+
+// Reserve handles POST /inventory/reservations with body
+// {"part_id":"...","work_order_id":"...","quantity":2,"needed_on":"2026-11-02"}:
+// holds stock of a part for a planned work order until it is issued to it
+// or released. Reserving more than is available is allowed; the low-stock
+// report shows the shortfall.
+func (h *Handler) Reserve(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := h.parts(w, r, true)
+	if !ok {
+		return
+	}
+	var in reservationInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	if !positive(w, in.Quantity) {
+		return
+	}
+	if !validDate(in.NeededOn) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "needed_on must be a date (YYYY-MM-DD)"})
+		return
+	}
+	res := models.StockReservation{
+		Quantity:  *in.Quantity,
+		NeededOn:  in.NeededOn,
+		Note:      strings.TrimSpace(in.Note),
+		CreatedBy: &userID,
+	}
+	var partID, woID *uuid.UUID
+	if !h.resolve(w, r, orgID, userID,
+		ref{"part", stock.PartTable, in.PartID, &partID},
+		ref{"work_order", pm.WorkOrderTable, in.WorkOrderID, &woID},
+		ref{"bin", stock.BinTable, in.BinID, &res.BinID},
+	) {
+		return
+	}
+	if partID == nil || woID == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "part_id and work_order_id are required"})
+		return
+	}
+	res.PartID, res.WorkOrderID = *partID, *woID
+	id, err := h.repo.CreateStockReservation(r.Context(), orgID, res)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "create failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created, _, err := h.repo.GetStockReservation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"reservation": created})
+}
+
+// Release handles POST /inventory/reservations/{id}/release: the reserved
+// stock becomes available again.
+func (h *Handler) Release(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := h.parts(w, r, true)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	res, found, err := h.repo.GetStockReservation(r.Context(), orgID, id)
+	if err == nil && found {
+		found, err = h.visible(r, orgID, userID, stock.PartTable, res.PartID)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "reservation not found"})
+		return
+	}
+	released, err := h.repo.ReleaseStockReservation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !released {
+		httpserver.JSON(w, http.StatusConflict, map[string]string{"error": "reservation is " + res.Status})
+		return
+	}
+	res, _, err = h.repo.GetStockReservation(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"reservation": res})
+}
+
+// Orders handles GET /inventory/orders?part_id=&status=: open orders by
+// expected date, then the others latest first.
+func (h *Handler) Orders(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	f, ok := filter(w, r)
+	if !ok {
+		return
+	}
+	st, ok := statusParam(w, r, models.PartOrderOpen, models.PartOrderReceived, models.PartOrderCancelled)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListPartOrders(r.Context(), orgID, tableID, f.PartID, st)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"orders": list})
+}
+
+// CreateOrder handles POST /inventory/orders with body
+// {"part_id":"...","quantity":10,"supplier":"...","expected_on":"2026-12-01"}:
+// stock on order, counted by the low-stock report until it is received
+// (receipts with its order_id) or cancelled.
+func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := h.parts(w, r, true)
+	if !ok {
+		return
+	}
+	var in orderInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	if !positive(w, in.Quantity) {
+		return
+	}
+	if !validDate(in.ExpectedOn) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "expected_on must be a date (YYYY-MM-DD)"})
+		return
+	}
+	var partID *uuid.UUID
+	if !h.resolve(w, r, orgID, userID, ref{"part", stock.PartTable, in.PartID, &partID}) {
+		return
+	}
+	if partID == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "part_id is required"})
+		return
+	}
+	id, err := h.repo.CreatePartOrder(r.Context(), orgID, models.PartOrder{
+		PartID:     *partID,
+		Quantity:   *in.Quantity,
+		Supplier:   strings.TrimSpace(in.Supplier),
+		Reference:  strings.TrimSpace(in.Reference),
+		ExpectedOn: in.ExpectedOn,
+		CreatedBy:  &userID,
+	})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "create failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created, _, err := h.repo.GetPartOrder(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"order": created})
+}
+
+// CancelOrder handles POST /inventory/orders/{id}/cancel: what is still
+// outstanding no longer counts as on order; receipts stay in stock.
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := h.parts(w, r, true)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	order, found, err := h.repo.GetPartOrder(r.Context(), orgID, id)
+	if err == nil && found {
+		found, err = h.visible(r, orgID, userID, stock.PartTable, order.PartID)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "order not found"})
+		return
+	}
+	cancelled, err := h.repo.CancelPartOrder(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !cancelled {
+		httpserver.JSON(w, http.StatusConflict, map[string]string{"error": "order is " + order.Status})
+		return
+	}
+	order, _, err = h.repo.GetPartOrder(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"order": order})
+}
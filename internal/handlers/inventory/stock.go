@@ -0,0 +1,331 @@
+// Package inventory serves the stock of spare parts: stock levels, the
+// movement ledger, reservations for work orders, part orders and the
+// low-stock report, and the parts used on work orders with their cost.
+// Movements are allocated and stored by internal/inventory.
+package inventory
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	stock "yourapp/internal/inventory"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// movementInput is the request body of Move.
+type movementInput struct {
+	Kind        string   `json:"kind"`
+	PartID      string   `json:"part_id"`
+	Quantity    *float64 `json:"quantity"`
+	FromBinID   string   `json:"from_bin_id"`
+	ToBinID     string   `json:"to_bin_id"`
+	Lot         string   `json:"lot"`
+	Serial      string   `json:"serial"`
+	ExpiresOn   string   `json:"expires_on"` // YYYY-MM-DD, stock coming in
+	WorkOrderID string   `json:"work_order_id"`
+	OrderID     string   `json:"order_id"`
+	UnitCost    *float64 `json:"unit_cost"`
+	Note        string   `json:"note"`
+}
+
+// parts returns the org and caller of a request, with the parts table and
+// the caller's permissions on it, writing 404 when the org has none the
+// caller can read and 403 when edit is set and the caller may not edit its
+// rows.
+func (h *Handler) parts(w http.ResponseWriter, r *http.Request, edit bool) (uuid.UUID, uuid.UUID, int64, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, 0, false
+	}
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, sess.UserID, stock.PartTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, uuid.Nil, 0, false
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "parts table not found"})
+		return uuid.Nil, uuid.Nil, 0, false
+	}
+	if edit && !perms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return uuid.Nil, uuid.Nil, 0, false
+	}
+	return orgID, sess.UserID, tableID, true
+}
+
+// visible reports whether id is a row of the table with slug the caller
+// sees.
+func (h *Handler) visible(r *http.Request, orgID, userID uuid.UUID, slug string, id uuid.UUID) (bool, error) {
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, userID, slug)
+	if err != nil || !found || !perms.Read {
+		return false, err
+	}
+	rowTable, _, found, err := h.repo.GetRowPermissions(r.Context(), orgID, userID, id)
+	if err != nil || !found || rowTable != tableID {
+		return false, err
+	}
+	data, found, err := h.repo.GetRowData(r.Context(), orgID, id)
+	return found && data != nil, err
+}
+
+// ref is a row id of a request body and the table it must be a row of.
+type ref struct {
+	field string
+	slug  string
+	raw   string
+	dst   **uuid.UUID
+}
+
+// resolve parses the non-empty ids of refs into their destinations, writing
+// 400 unless each is a row of its table the caller sees.
+func (h *Handler) resolve(w http.ResponseWriter, r *http.Request, orgID, userID uuid.UUID, refs ...ref) bool {
+	for _, f := range refs {
+		s := strings.TrimSpace(f.raw)
+		if s == "" {
+			continue
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + f.field})
+			return false
+		}
+		ok, err := h.visible(r, orgID, userID, f.slug, id)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return false
+		}
+		if !ok {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": f.field + " not found"})
+			return false
+		}
+		*f.dst = &id
+	}
+	return true
+}
+
+// filter parses the part_id, bin_id and work_order_id query parameters.
+func filter(w http.ResponseWriter, r *http.Request) (models.StockFilter, bool) {
+	var f models.StockFilter
+	for name, dst := range map[string]**uuid.UUID{"part_id": &f.PartID, "bin_id": &f.BinID, "work_order_id": &f.WorkOrderID} {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			continue
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+			return f, false
+		}
+		*dst = &id
+	}
+	return f, true
+}
+
+// validDate reports whether s is empty or a YYYY-MM-DD date.
+func validDate(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := time.Parse(time.DateOnly, s)
+	return err == nil
+}
+
+// Stock handles GET /inventory/stock?part_id=&bin_id=: the stock on hand
+// per part, bin, lot and serial number.
+func (h *Handler) Stock(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	f, ok := filter(w, r)
+	if !ok {
+		return
+	}
+	levels, err := h.repo.ListStockLevels(r.Context(), orgID, tableID, f)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"levels": levels})
+}
+
+// PartStock handles GET /inventory/parts/{id}/stock: the part's stock on
+// hand, reserved, on order and available, with its levels.
+func (h *Handler) PartStock(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	var partID *uuid.UUID
+	if !h.resolve(w, r, orgID, userID, ref{"part", stock.PartTable, chi.URLParam(r, "id"), &partID}) {
+		return
+	}
+	if partID == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid part"})
+		return
+	}
+	sums, err := h.repo.PartStock(r.Context(), []uuid.UUID{*partID})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	levels, err := h.repo.ListStockLevels(r.Context(), orgID, tableID, models.StockFilter{PartID: partID})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"stock": sums[0], "levels": levels})
+}
+
+// Movements handles GET
+// /inventory/movements?part_id=&bin_id=&work_order_id=&before=&limit=100:
+// the ledger, latest first; before is the id of the last movement of the
+// previous page.
+func (h *Handler) Movements(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	f, ok := filter(w, r)
+	if !ok {
+		return
+	}
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "before must be a movement id"})
+			return
+		}
+		before = n
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+	list, err := h.repo.ListStockMovements(r.Context(), orgID, tableID, f, before, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"movements": list})
+}
+
+// Move handles POST /inventory/movements with body
+// {"kind":"issue","part_id":"...","quantity":2,"work_order_id":"..."}: one
+// receipt, issue, transfer, adjustment or return, stored as one movement
+// per level it takes from.
+func (h *Handler) Move(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, _, ok := h.parts(w, r, true)
+	if !ok {
+		return
+	}
+	var in movementInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	if in.Quantity == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "quantity is required"})
+		return
+	}
+	if !validDate(in.ExpiresOn) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "expires_on must be a date (YYYY-MM-DD)"})
+		return
+	}
+	m := models.StockMovement{
+		Kind:      strings.ToLower(strings.TrimSpace(in.Kind)),
+		Quantity:  *in.Quantity,
+		Lot:       strings.TrimSpace(in.Lot),
+		Serial:    strings.TrimSpace(in.Serial),
+		ExpiresOn: in.ExpiresOn,
+		UnitCost:  in.UnitCost,
+		Note:      strings.TrimSpace(in.Note),
+	}
+	var partID *uuid.UUID
+	if !h.resolve(w, r, orgID, userID,
+		ref{"part", stock.PartTable, in.PartID, &partID},
+		ref{"from_bin", stock.BinTable, in.FromBinID, &m.FromBinID},
+		ref{"to_bin", stock.BinTable, in.ToBinID, &m.ToBinID},
+		ref{"work_order", pm.WorkOrderTable, in.WorkOrderID, &m.WorkOrderID},
+	) {
+		return
+	}
+	if partID == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "part_id is required"})
+		return
+	}
+	m.PartID = *partID
+	if s := strings.TrimSpace(in.OrderID); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid order_id"})
+			return
+		}
+		order, found, err := h.repo.GetPartOrder(r.Context(), orgID, id)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		if !found || order.PartID != m.PartID {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "order not found for this part"})
+			return
+		}
+		m.OrderID = &id
+	}
+
+	moves, err := stock.Move(r.Context(), h.repo, orgID, userID, m)
+	if err != nil {
+		httpserver.WriteError(w, err, "movement failed")
+		return
+	}
+	sums, err := h.repo.PartStock(r.Context(), []uuid.UUID{m.PartID})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"movements": moves, "stock": sums[0]})
+}
+
+// LowStock handles GET /inventory/low-stock: the parts whose stock on hand
+// and on order, less reservations, is at or below their reorder point, with
+// the quantity to order.
+func (h *Handler) LowStock(w http.ResponseWriter, r *http.Request) {
+	_, _, tableID, ok := h.parts(w, r, false)
+	if !ok {
+		return
+	}
+	list, err := h.repo.LowStockParts(r.Context(), tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"parts": list})
+}
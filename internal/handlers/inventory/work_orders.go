@@ -0,0 +1,227 @@
+package inventory
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	stock "yourapp/internal/inventory"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+)
+
+// maxPartLines bounds the lines of one request.
+const maxPartLines = 100
+
+// partLinesInput is the request body of IssueParts and ReturnParts.
+type partLinesInput struct {
+	Lines []partLineInput `json:"lines"`
+}
+
+// partLineInput is a part used on a work order or returned from it. BinID
+// is the bin taken from (any, in allocation order, when empty) or returned
+// to (required).
+type partLineInput struct {
+	PartID   string   `json:"part_id"`
+	Quantity *float64 `json:"quantity"`
+	BinID    string   `json:"bin_id"`
+	Lot      string   `json:"lot"`
+	Serial   string   `json:"serial"`
+	UnitCost *float64 `json:"unit_cost"`
+	Note     string   `json:"note"`
+}
+
+// workOrder returns the org and caller of a request with the work order of
+// its {id} parameter, writing 404 unless the caller sees it and 403 when
+// edit is set and the caller may not edit it.
+func (h *Handler) workOrder(w http.ResponseWriter, r *http.Request, edit bool) (uuid.UUID, uuid.UUID, uuid.UUID, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, sess.UserID, pm.WorkOrderTable)
+	var rowTable int64
+	var rowPerms models.TablePermissions
+	if err == nil && found && perms.Read {
+		rowTable, rowPerms, found, err = h.repo.GetRowPermissions(r.Context(), orgID, sess.UserID, id)
+	}
+	var data map[string]any
+	if err == nil && found && rowTable == tableID {
+		data, found, err = h.repo.GetRowData(r.Context(), orgID, id)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	if !found || !perms.Read || rowTable != tableID || data == nil {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work order not found"})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	if edit && !rowPerms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	return orgID, sess.UserID, id, true
+}
+
+// writeLines answers with the part lines and parts cost of a work order,
+// and the movements just stored when there are any.
+func (h *Handler) writeLines(w http.ResponseWriter, r *http.Request, orgID, woID uuid.UUID, status int, moves []models.StockMovement) {
+	lines, err := h.repo.WorkOrderPartLines(r.Context(), orgID, woID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	cost, err := h.repo.WorkOrderPartsCost(r.Context(), woID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	out := map[string]any{"lines": lines, "parts_cost": cost}
+	if moves != nil {
+		out["movements"] = moves
+	}
+	httpserver.JSON(w, status, out)
+}
+
+// WorkOrderParts handles GET /work-orders/{id}/parts: the parts used on the
+// work order per part, lot and serial number, with their cost.
+func (h *Handler) WorkOrderParts(w http.ResponseWriter, r *http.Request) {
+	orgID, _, woID, ok := h.workOrder(w, r, false)
+	if !ok {
+		return
+	}
+	h.writeLines(w, r, orgID, woID, http.StatusOK, nil)
+}
+
+// IssueParts handles POST /work-orders/{id}/parts with body
+// {"lines":[{"part_id":"...","quantity":2,"bin_id":"...","serial":"..."}]}:
+// the parts used on the work order, issued from stock all or none, each at
+// the part's cost unless unit_cost is given.
+func (h *Handler) IssueParts(w http.ResponseWriter, r *http.Request) {
+	h.partLines(w, r, models.StockIssue)
+}
+
+// ReturnParts handles POST /work-orders/{id}/parts/return with body
+// {"lines":[{"part_id":"...","quantity":1,"bin_id":"..."}]}: parts issued
+// to the work order but not used, back into stock at the cost they were
+// issued at. Without a lot or serial number the last issued are returned
+// first.
+func (h *Handler) ReturnParts(w http.ResponseWriter, r *http.Request) {
+	h.partLines(w, r, models.StockReturn)
+}
+
+// partLines stores lines of a work order as movements of kind.
+func (h *Handler) partLines(w http.ResponseWriter, r *http.Request, kind string) {
+	if _, _, _, ok := h.parts(w, r, true); !ok {
+		return
+	}
+	orgID, userID, woID, ok := h.workOrder(w, r, true)
+	if !ok {
+		return
+	}
+	var in partLinesInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	if len(in.Lines) == 0 || len(in.Lines) > maxPartLines {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "lines must hold 1 to 100 parts"})
+		return
+	}
+	ms := make([]models.StockMovement, 0, len(in.Lines))
+	for _, l := range in.Lines {
+		if !positive(w, l.Quantity) {
+			return
+		}
+		m := models.StockMovement{
+			Kind:        kind,
+			Quantity:    *l.Quantity,
+			Lot:         strings.TrimSpace(l.Lot),
+			Serial:      strings.TrimSpace(l.Serial),
+			WorkOrderID: &woID,
+			UnitCost:    l.UnitCost,
+			Note:        strings.TrimSpace(l.Note),
+		}
+		bin := &m.FromBinID
+		if kind == models.StockReturn {
+			bin = &m.ToBinID
+		}
+		var partID *uuid.UUID
+		if !h.resolve(w, r, orgID, userID,
+			ref{"part", stock.PartTable, l.PartID, &partID},
+			ref{"bin", stock.BinTable, l.BinID, bin},
+		) {
+			return
+		}
+		if partID == nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "part_id is required"})
+			return
+		}
+		if kind == models.StockReturn && m.ToBinID == nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "bin_id is required to return parts"})
+			return
+		}
+		m.PartID = *partID
+		ms = append(ms, m)
+	}
+
+	moves, err := stock.MoveAll(r.Context(), h.repo, orgID, userID, ms)
+	if err != nil {
+		httpserver.WriteError(w, err, "movement failed")
+		return
+	}
+	h.writeLines(w, r, orgID, woID, http.StatusCreated, moves)
+}
+
+// PartsCost handles GET /work-orders/parts-cost?by=asset|site|month&from=&to=:
+// the cost of parts used on the work orders the caller sees, issues less
+// returns, per asset, site (the top location above the work order's
+// location, or its asset's) or month, over the days from and to
+// (YYYY-MM-DD, inclusive).
+func (h *Handler) PartsCost(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, sess.UserID, pm.WorkOrderTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work orders table not found"})
+		return
+	}
+	q := r.URL.Query()
+	by := q.Get("by")
+	switch by {
+	case "":
+		by = models.PartsCostByMonth
+	case models.PartsCostByAsset, models.PartsCostBySite, models.PartsCostByMonth:
+	default:
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "by must be asset, site or month"})
+		return
+	}
+	from, to := q.Get("from"), q.Get("to")
+	if !validDate(from) || !validDate(to) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "from and to must be dates (YYYY-MM-DD)"})
+		return
+	}
+	totals, err := h.repo.PartsCostTotals(r.Context(), orgID, tableID, by, from, to)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"by": by, "totals": totals})
+}
@@ -0,0 +1,366 @@
+// Package labour serves the time users spend on work orders: timers,
+// entries entered by hand, the labour summary of a work order, timesheets
+// and hourly rates. Entries are stored by internal/labour.
+package labour
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	times "yourapp/internal/labour"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+// maxEntries bounds the entries of a work order or timesheet answered.
+const maxEntries = 5000
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// entryInput is the request body of Record, Start and UpdateEntry. UserID
+// names another user than the caller, which only admins may.
+type entryInput struct {
+	UserID    string     `json:"user_id"`
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Note      string     `json:"note"`
+}
+
+// isAdmin reports whether the user is an admin or owner of the org.
+func (h *Handler) isAdmin(r *http.Request, orgID, userID uuid.UUID) bool {
+	role, err := h.repo.GetRole(r.Context(), orgID, userID)
+	return err == nil && (role == models.RoleAdmin || role == models.RoleOwner)
+}
+
+// subject returns the user a request acts for: the caller unless raw names
+// another member of the org, which only admins may, writing 403 or 400
+// when they may not or it is not one.
+func (h *Handler) subject(w http.ResponseWriter, r *http.Request, orgID, callerID uuid.UUID, raw string) (uuid.UUID, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return callerID, true
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return uuid.Nil, false
+	}
+	if id == callerID {
+		return id, true
+	}
+	if !h.isAdmin(r, orgID, callerID) {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "only admins may act for other users"})
+		return uuid.Nil, false
+	}
+	if _, err := h.repo.GetRole(r.Context(), orgID, id); err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "user is not a member of the org"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// workOrders returns the id of the work orders table, writing 404 unless
+// the caller can read it.
+func (h *Handler) workOrders(w http.ResponseWriter, r *http.Request, orgID, userID uuid.UUID) (int64, bool) {
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, userID, pm.WorkOrderTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return 0, false
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work orders table not found"})
+		return 0, false
+	}
+	return tableID, true
+}
+
+// workOrder returns the values of the work order id, writing 404 unless
+// the caller sees it and 403 when edit is set and the caller may not edit
+// it.
+func (h *Handler) workOrder(w http.ResponseWriter, r *http.Request, orgID, userID, id uuid.UUID, edit bool) (map[string]any, bool) {
+	tableID, ok := h.workOrders(w, r, orgID, userID)
+	if !ok {
+		return nil, false
+	}
+	rowTable, rowPerms, found, err := h.repo.GetRowPermissions(r.Context(), orgID, userID, id)
+	var data map[string]any
+	if err == nil && found && rowTable == tableID {
+		data, found, err = h.repo.GetRowData(r.Context(), orgID, id)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return nil, false
+	}
+	if !found || rowTable != tableID || data == nil {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "work order not found"})
+		return nil, false
+	}
+	if edit && !rowPerms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return nil, false
+	}
+	return data, true
+}
+
+// entry returns the time entry of the {id} parameter, writing 404 unless
+// the caller sees its work order and 403 unless it is the caller's or the
+// caller is an admin.
+func (h *Handler) entry(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, models.TimeEntry, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	e, found, err := h.repo.GetTimeEntry(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "time entry not found"})
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	if _, ok := h.workOrder(w, r, orgID, sess.UserID, e.WorkOrderID, false); !ok {
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	if e.UserID != sess.UserID && !h.isAdmin(r, orgID, sess.UserID) {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "only admins may change entries of other users"})
+		return uuid.Nil, uuid.Nil, models.TimeEntry{}, false
+	}
+	return orgID, sess.UserID, e, true
+}
+
+// WorkOrderLabour handles GET /work-orders/{id}/labour: the time entries of
+// the work order, running timers included, and the totals of the finished
+// ones per user and against its estimated_duration_hours.
+func (h *Handler) WorkOrderLabour(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	data, ok := h.workOrder(w, r, orgID, sess.UserID, woID, false)
+	if !ok {
+		return
+	}
+	tableID, ok := h.workOrders(w, r, orgID, sess.UserID)
+	if !ok {
+		return
+	}
+	entries, err := h.repo.ListTimeEntries(r.Context(), orgID, tableID, models.TimeEntryFilter{WorkOrderID: &woID}, maxEntries)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	var estimated *float64
+	if v, ok := data["estimated_duration_hours"].(float64); ok {
+		estimated = &v
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{
+		"entries": entries,
+		"summary": times.Summarise(entries, estimated),
+	})
+}
+
+// Record handles POST /work-orders/{id}/labour with body
+// {"started_at":"...","ended_at":"...","note":"...","user_id":"..."}: time
+// spent on the work order entered by hand, by the caller unless user_id
+// names another user (admins only).
+func (h *Handler) Record(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, ok := h.workOrder(w, r, orgID, sess.UserID, woID, true); !ok {
+		return
+	}
+	var in entryInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	userID, ok := h.subject(w, r, orgID, sess.UserID, in.UserID)
+	if !ok {
+		return
+	}
+	if in.StartedAt == nil || in.EndedAt == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "started_at and ended_at are required"})
+		return
+	}
+	e, err := times.Record(r.Context(), h.repo, orgID, models.TimeEntry{
+		WorkOrderID: woID,
+		UserID:      userID,
+		Source:      models.TimeEntryManual,
+		StartedAt:   *in.StartedAt,
+		EndedAt:     in.EndedAt,
+		Note:        strings.TrimSpace(in.Note),
+		CreatedBy:   &sess.UserID,
+	})
+	if err != nil {
+		httpserver.WriteError(w, err, "record failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, e)
+}
+
+// Start handles POST /work-orders/{id}/labour/start with body
+// {"note":"...","user_id":"..."} (optional): starts a timer on the work
+// order for the caller, or another user (admins only). A user has one
+// timer running at most; 409 when one already runs.
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	woID, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, ok := h.workOrder(w, r, orgID, sess.UserID, woID, true); !ok {
+		return
+	}
+	var in entryInput
+	if r.ContentLength != 0 && !httpserver.Decode(w, r, &in) {
+		return
+	}
+	userID, ok := h.subject(w, r, orgID, sess.UserID, in.UserID)
+	if !ok {
+		return
+	}
+	e, err := times.Start(r.Context(), h.repo, orgID, woID, userID, sess.UserID, strings.TrimSpace(in.Note))
+	if err != nil {
+		httpserver.WriteError(w, err, "start failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, e)
+}
+
+// running returns the timer running for the user the user_id query
+// parameter (or body field) names, the caller by default.
+func (h *Handler) running(w http.ResponseWriter, r *http.Request, orgID, callerID uuid.UUID, raw string) (models.TimeEntry, bool, bool) {
+	userID, ok := h.subject(w, r, orgID, callerID, raw)
+	if !ok {
+		return models.TimeEntry{}, false, false
+	}
+	id, found, err := h.repo.RunningTimeEntry(r.Context(), orgID, userID)
+	var e models.TimeEntry
+	if err == nil && found {
+		e, found, err = h.repo.GetTimeEntry(r.Context(), orgID, id)
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.TimeEntry{}, false, false
+	}
+	return e, found, true
+}
+
+// Timer handles GET /labour/timer?user_id=: the timer running for the
+// caller, or another user (admins only); null when none runs.
+func (h *Handler) Timer(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	e, found, ok := h.running(w, r, orgID, sess.UserID, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusOK, map[string]any{"timer": nil})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"timer": e})
+}
+
+// StopTimer handles POST /labour/timer/stop with body {"user_id":"..."}
+// (optional): stops the timer running for the caller, or another user
+// (admins only). 404 when none runs.
+func (h *Handler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	var in entryInput
+	if r.ContentLength != 0 && !httpserver.Decode(w, r, &in) {
+		return
+	}
+	e, found, ok := h.running(w, r, orgID, sess.UserID, in.UserID)
+	if !ok {
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "no timer is running"})
+		return
+	}
+	e, err := times.Stop(r.Context(), h.repo, orgID, e)
+	if err != nil {
+		httpserver.WriteError(w, err, "stop failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, e)
+}
+
+// UpdateEntry handles PUT /labour/entries/{id} with body
+// {"started_at":"...","ended_at":"...","note":"..."}: corrects an entry of
+// the caller's, or any entry for admins. Omitted times are kept; giving a
+// running timer an end stops it.
+func (h *Handler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	orgID, _, e, ok := h.entry(w, r)
+	if !ok {
+		return
+	}
+	in := entryInput{Note: e.Note}
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	startedAt, endedAt := e.StartedAt, e.EndedAt
+	if in.StartedAt != nil {
+		startedAt = *in.StartedAt
+	}
+	if in.EndedAt != nil {
+		endedAt = in.EndedAt
+	}
+	e, err := times.Update(r.Context(), h.repo, orgID, e, startedAt, endedAt, strings.TrimSpace(in.Note))
+	if err != nil {
+		httpserver.WriteError(w, err, "update failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, e)
+}
+
+// DeleteEntry handles DELETE /labour/entries/{id}: deletes an entry of the
+// caller's, or any entry for admins.
+func (h *Handler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	orgID, _, e, ok := h.entry(w, r)
+	if !ok {
+		return
+	}
+	if err := times.Delete(r.Context(), h.repo, orgID, e); err != nil {
+		httpserver.WriteError(w, err, "delete failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
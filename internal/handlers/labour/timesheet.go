@@ -0,0 +1,254 @@
+package labour
+
+import (
+	"encoding/csv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+)
+
+// maxTimesheetDays bounds the period of one timesheet.
+const maxTimesheetDays = 366
+
+// rateInput is the request body of SetRate.
+type rateInput struct {
+	UserID     *uuid.UUID `json:"user_id"`
+	TeamID     *uuid.UUID `json:"team_id"`
+	HourlyRate *float64   `json:"hourly_rate"`
+}
+
+// timesheetDay is the finished time of a timesheet started on one day.
+type timesheetDay struct {
+	Date  string  `json:"date"`
+	Hours float64 `json:"hours"`
+	Cost  float64 `json:"cost"`
+}
+
+// Timesheet handles GET
+// /labour/timesheet?user_id=&from=&to=&tz=&format=: the finished entries
+// of the caller, or another user (admins only), started on the days from
+// to to (YYYY-MM-DD, inclusive) in the time zone tz (UTC by default), on
+// the work orders the caller sees, with totals per day. format=csv answers
+// the entries as a CSV download.
+func (h *Handler) Timesheet(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	userID, ok := h.subject(w, r, orgID, sess.UserID, q.Get("user_id"))
+	if !ok {
+		return
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+		return
+	}
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid tz"})
+			return
+		}
+	}
+	from, errFrom := time.ParseInLocation(time.DateOnly, q.Get("from"), loc)
+	to, errTo := time.ParseInLocation(time.DateOnly, q.Get("to"), loc)
+	if errFrom != nil || errTo != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "from and to must be dates (YYYY-MM-DD)"})
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+	if !end.After(from) || end.After(from.AddDate(0, 0, maxTimesheetDays)) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "from must not be after to, and the period at most 366 days"})
+		return
+	}
+	tableID, ok := h.workOrders(w, r, orgID, sess.UserID)
+	if !ok {
+		return
+	}
+	all, err := h.repo.ListTimeEntries(r.Context(), orgID, tableID, models.TimeEntryFilter{UserID: &userID, From: &from, To: &end}, maxEntries)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	entries := make([]models.TimeEntry, 0, len(all))
+	for _, e := range all {
+		if e.EndedAt != nil {
+			entries = append(entries, e)
+		}
+	}
+	if format == "csv" {
+		writeTimesheetCSV(w, entries, loc, "timesheet-"+userID.String()+"-"+q.Get("from")+"-"+q.Get("to")+".csv")
+		return
+	}
+	var days []timesheetDay
+	var hours, cost float64
+	for _, e := range entries {
+		date := e.StartedAt.In(loc).Format(time.DateOnly)
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, timesheetDay{Date: date})
+		}
+		d := &days[len(days)-1]
+		d.Hours += e.Hours
+		hours += e.Hours
+		if e.Cost != nil {
+			d.Cost += *e.Cost
+			cost += *e.Cost
+		}
+	}
+	for i := range days {
+		days[i].Hours, days[i].Cost = round(days[i].Hours), round(days[i].Cost)
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{
+		"user_id": userID,
+		"from":    q.Get("from"),
+		"to":      q.Get("to"),
+		"tz":      loc.String(),
+		"hours":   round(hours),
+		"cost":    round(cost),
+		"days":    days,
+		"entries": entries,
+	})
+}
+
+// writeTimesheetCSV answers entries as a CSV attachment, times in loc.
+func writeTimesheetCSV(w http.ResponseWriter, entries []models.TimeEntry, loc *time.Location, filename string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"date", "work_order_id", "work_order", "started_at", "ended_at", "hours", "hourly_rate", "cost", "source", "note"})
+	for _, e := range entries {
+		started := e.StartedAt.In(loc)
+		_ = cw.Write([]string{
+			started.Format(time.DateOnly),
+			e.WorkOrderID.String(),
+			safeCell(e.WorkOrderTitle),
+			started.Format(time.RFC3339),
+			e.EndedAt.In(loc).Format(time.RFC3339),
+			strconv.FormatFloat(round(e.Hours), 'f', 2, 64),
+			optFloat(e.HourlyRate),
+			optFloat(e.Cost),
+			e.Source,
+			safeCell(e.Note),
+		})
+	}
+	cw.Flush()
+}
+
+// optFloat formats an optional amount with two decimals, or "".
+func optFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(round(*v), 'f', 2, 64)
+}
+
+// safeCell keeps free text from being read as a formula by spreadsheets.
+func safeCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// round rounds hours and costs to hundredths.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Rates handles GET /labour/rates: the hourly rates of users and teams.
+func (h *Handler) Rates(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	rates, err := h.repo.ListLabourRates(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"rates": rates})
+}
+
+// SetRate handles PUT /labour/rates with body
+// {"user_id":"...","hourly_rate":45} or {"team_id":"...","hourly_rate":40}:
+// sets the hourly rate of a member of the org or of a team, for entries
+// created from now on.
+func (h *Handler) SetRate(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	var in rateInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	if (in.UserID == nil) == (in.TeamID == nil) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "exactly one of user_id and team_id is required"})
+		return
+	}
+	if in.HourlyRate == nil || math.IsNaN(*in.HourlyRate) || math.IsInf(*in.HourlyRate, 0) || *in.HourlyRate < 0 {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "hourly_rate must be a number of at least 0"})
+		return
+	}
+	if in.UserID != nil {
+		if _, err := h.repo.GetRole(r.Context(), orgID, *in.UserID); err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "user is not a member of the org"})
+			return
+		}
+	} else {
+		_, found, err := h.repo.ListTeamMembers(r.Context(), orgID, *in.TeamID)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		if !found {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "team not found"})
+			return
+		}
+	}
+	id, err := h.repo.SetLabourRate(r.Context(), orgID, models.LabourRate{UserID: in.UserID, TeamID: in.TeamID, HourlyRate: *in.HourlyRate})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "save failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"id": id})
+}
+
+// DeleteRate handles DELETE /labour/rates/{id}. Entries keep the rate they
+// were created with.
+func (h *Handler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteLabourRate(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "rate not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
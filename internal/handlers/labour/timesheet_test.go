@@ -0,0 +1,157 @@
+package labour
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+var (
+	labourOrg = uuid.MustParse("00000000-0000-4000-8000-0000000000c1")
+	tech      = uuid.MustParse("00000000-0000-4000-8000-0000000000c2")
+)
+
+// sheetRepo holds the time entries of work orders the caller sees, and
+// lists them like ListTimeEntries: by user and start, in start order. Any
+// other method panics through the nil embedded Repo.
+type sheetRepo struct {
+	repo.Repo
+	entries []models.TimeEntry
+}
+
+func (m *sheetRepo) GetTablePermissions(context.Context, uuid.UUID, uuid.UUID, string) (int64, models.TablePermissions, bool, error) {
+	return 5, models.TablePermissions{Read: true}, true, nil
+}
+
+func (m *sheetRepo) ListTimeEntries(_ context.Context, _ uuid.UUID, _ int64, f models.TimeEntryFilter, limit int) ([]models.TimeEntry, error) {
+	var out []models.TimeEntry
+	for _, e := range m.entries {
+		if e.UserID == *f.UserID && !e.StartedAt.Before(*f.From) && e.StartedAt.Before(*f.To) && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.TimeEntry) int { return a.StartedAt.Compare(b.StartedAt) })
+	return out, nil
+}
+
+// entry is a finished entry of tech from start, in UTC, lasting hours.
+func entry(start string, hours float64, cost *float64) models.TimeEntry {
+	at, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		panic(err)
+	}
+	end := at.Add(time.Duration(hours * float64(time.Hour)))
+	return models.TimeEntry{ID: uuid.New(), UserID: tech, StartedAt: at, EndedAt: &end, Hours: hours, Cost: cost}
+}
+
+func amount(v float64) *float64 { return &v }
+
+// Entries count whole on the day they started in the timesheet's time
+// zone, so each is in exactly one day and one week. Europe/Paris is UTC+2
+// until 2026-10-25 03:00, UTC+1 after.
+func TestTimesheetTotals(t *testing.T) {
+	running := entry("2026-10-22T07:00:00Z", 1, nil)
+	running.EndedAt = nil
+	m := &sheetRepo{entries: []models.TimeEntry{
+		entry("2026-10-18T21:30:00Z", 2, nil),        // Sun 23:30 to Mon 01:30 in Paris
+		entry("2026-10-19T06:00:00Z", 2, amount(80)), // Mon 08:00
+		entry("2026-10-19T22:30:00Z", 2, amount(90)), // Tue 00:30 in Paris, Mon in UTC
+		running,
+		entry("2026-10-25T00:30:00Z", 1.25, nil), // Sun 02:30, before the clocks go back
+		entry("2026-10-25T22:00:00Z", 1.5, nil),  // Sun 23:00 to Mon 00:30, after
+		entry("2026-10-25T23:15:00Z", 0.5, nil),  // Mon 00:15 in Paris, Sun in UTC
+		{ID: uuid.New(), UserID: uuid.New(), StartedAt: time.Date(2026, 10, 21, 8, 0, 0, 0, time.UTC), Hours: 3}, // another user's
+	}}
+	h := New(m)
+
+	tests := []struct {
+		name      string
+		from, to  string
+		tz        string
+		wantDays  []timesheetDay
+		wantHours float64
+		wantCost  float64
+	}{
+		{
+			name: "week in Paris", from: "2026-10-19", to: "2026-10-25", tz: "Europe/Paris",
+			wantDays:  []timesheetDay{{"2026-10-19", 2, 80}, {"2026-10-20", 2, 90}, {"2026-10-25", 2.75, 0}},
+			wantHours: 6.75, wantCost: 170,
+		},
+		{
+			name: "same week in UTC", from: "2026-10-19", to: "2026-10-25",
+			wantDays:  []timesheetDay{{"2026-10-19", 4, 170}, {"2026-10-25", 3.25, 0}},
+			wantHours: 7.25, wantCost: 170,
+		},
+		{
+			name: "week before in Paris, with the entry over midnight", from: "2026-10-12", to: "2026-10-18", tz: "Europe/Paris",
+			wantDays:  []timesheetDay{{"2026-10-18", 2, 0}},
+			wantHours: 2,
+		},
+		{
+			name: "week after in Paris", from: "2026-10-26", to: "2026-11-01", tz: "Europe/Paris",
+			wantDays:  []timesheetDay{{"2026-10-26", 0.5, 0}},
+			wantHours: 0.5,
+		},
+		{
+			name: "both weeks in Paris add up", from: "2026-10-12", to: "2026-10-25", tz: "Europe/Paris",
+			wantDays:  []timesheetDay{{"2026-10-18", 2, 0}, {"2026-10-19", 2, 80}, {"2026-10-20", 2, 90}, {"2026-10-25", 2.75, 0}},
+			wantHours: 8.75, wantCost: 170,
+		},
+		{
+			name: "the 25-hour day in Paris", from: "2026-10-25", to: "2026-10-25", tz: "Europe/Paris",
+			wantDays:  []timesheetDay{{"2026-10-25", 2.75, 0}},
+			wantHours: 2.75,
+		},
+		{
+			name: "a day in New York", from: "2026-10-19", to: "2026-10-19", tz: "America/New_York",
+			wantDays:  []timesheetDay{{"2026-10-19", 4, 170}},
+			wantHours: 4, wantCost: 170,
+		},
+		{
+			name: "only a running entry", from: "2026-10-21", to: "2026-10-24", tz: "Europe/Paris",
+		},
+	}
+	for _, tt := range tests {
+		url := "/labour/timesheet?from=" + tt.from + "&to=" + tt.to
+		if tt.tz != "" {
+			url += "&tz=" + tt.tz
+		}
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		ctx := auth.WithOrg(r.Context(), labourOrg)
+		ctx = auth.WithSession(ctx, &models.Session{UserID: tech, ActiveOrg: labourOrg})
+		w := httptest.NewRecorder()
+		h.Timesheet(w, r.WithContext(ctx))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+		}
+		var out struct {
+			Hours   float64            `json:"hours"`
+			Cost    float64            `json:"cost"`
+			Days    []timesheetDay     `json:"days"`
+			Entries []models.TimeEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out.Days, tt.wantDays) || out.Hours != tt.wantHours || out.Cost != tt.wantCost {
+			t.Errorf("%s: %v hours, %v cost, days %+v; want %v, %v, %+v", tt.name, out.Hours, out.Cost, out.Days, tt.wantHours, tt.wantCost, tt.wantDays)
+		}
+		for _, e := range out.Entries {
+			if e.EndedAt == nil {
+				t.Errorf("%s: running entry %s in the timesheet", tt.name, e.ID)
+			}
+		}
+	}
+}
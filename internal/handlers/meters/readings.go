@@ -0,0 +1,418 @@
+// Package meters serves the readings of meters, their time series and the
+// rules that act on them. Ingestion and rule runs happen in
+// internal/meters.
+package meters
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	httpserver "yourapp/internal/http"
+	ingest "yourapp/internal/meters"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// maxSkew is how far in the future a reading may be taken, for clocks of
+// devices running ahead.
+const maxSkew = 5 * time.Minute
+
+// maxBuckets bounds the intervals of a time series.
+const maxBuckets = 10000
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// readingInput is one reading of a request body.
+type readingInput struct {
+	MeterID string   `json:"meter_id"` // bulk ingestion only
+	Unit    string   `json:"unit"`     // bulk ingestion only; the meter's unit when given
+	Value   *float64 `json:"value"`
+	ReadAt  string   `json:"read_at"` // RFC 3339; now when empty
+}
+
+// meterPerms returns the meter table and the caller's permissions on it,
+// writing 404 when the org has none.
+func (h *Handler) meterPerms(w http.ResponseWriter, r *http.Request, orgID, userID uuid.UUID) (int64, models.TablePermissions, bool) {
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, userID, ingest.MeterTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return 0, perms, false
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "meter table not found"})
+		return 0, perms, false
+	}
+	return tableID, perms, true
+}
+
+// visible returns the data of the meter id, reporting whether it is a row
+// of the meter table the caller sees.
+func (h *Handler) visible(r *http.Request, orgID, userID uuid.UUID, tableID int64, id uuid.UUID) (map[string]any, bool, error) {
+	rowTable, _, found, err := h.repo.GetRowPermissions(r.Context(), orgID, userID, id)
+	if err != nil || !found || rowTable != tableID {
+		return nil, false, err
+	}
+	data, found, err := h.repo.GetRowData(r.Context(), orgID, id)
+	return data, found && data != nil, err
+}
+
+// meter resolves the {id} meter of a request as the caller sees it, with
+// the caller's permissions on the meter table. Meters the caller cannot
+// read, or hidden by row policies, are not found.
+func (h *Handler) meter(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, models.TablePermissions, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, models.TablePermissions{}, false
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, models.TablePermissions{}, false
+	}
+	tableID, perms, ok := h.meterPerms(w, r, orgID, sess.UserID)
+	if !ok {
+		return uuid.Nil, uuid.Nil, perms, false
+	}
+	_, visible, err := h.visible(r, orgID, sess.UserID, tableID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, uuid.Nil, perms, false
+	}
+	if !visible {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "meter not found"})
+		return uuid.Nil, uuid.Nil, perms, false
+	}
+	return orgID, id, perms, true
+}
+
+// Record handles POST /meters/{id}/readings with {"value":1234.5,
+// "read_at":"2026-10-18T08:00:00Z"}, or {"readings":[...]} of those.
+func (h *Handler) Record(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, perms, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	if !perms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	var body struct {
+		readingInput
+		Readings []readingInput `json:"readings"`
+	}
+	if !httpserver.DecodeLimit(w, r, &body, 8<<20) {
+		return
+	}
+	inputs := body.Readings
+	if inputs == nil {
+		inputs = []readingInput{body.readingInput}
+	}
+	if !counted(w, len(inputs)) {
+		return
+	}
+	now := time.Now()
+	readings := make([]models.MeterReading, 0, len(inputs))
+	for i := range inputs {
+		inputs[i].MeterID = meterID.String()
+		m, err := parseReading(inputs[i], now)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reading %d: %v", i+1, err)})
+			return
+		}
+		readings = append(readings, m)
+	}
+	h.store(w, r, orgID, readings)
+}
+
+// Import handles POST /meters/readings: readings of any meters, as
+// {"readings":[{"meter_id":"...","value":1234.5,"read_at":"...",
+// "unit":"h"}]} or, with Content-Type text/csv, rows of
+// meter_id,value,read_at,unit under that header. A unit given must be the
+// meter's, so readings in another unit are not taken as they are.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	tableID, perms, ok := h.meterPerms(w, r, orgID, sess.UserID)
+	if !ok {
+		return
+	}
+	if !perms.EditRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, 8<<20)
+	var inputs []readingInput
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		inputs, err = readCSV(body)
+	} else {
+		var doc struct {
+			Readings []readingInput `json:"readings"`
+		}
+		if err = json.NewDecoder(body).Decode(&doc); err != nil {
+			err = errors.New("invalid JSON body")
+		}
+		inputs = doc.Readings
+	}
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !counted(w, len(inputs)) {
+		return
+	}
+
+	now := time.Now()
+	readings := make([]models.MeterReading, 0, len(inputs))
+	units := map[uuid.UUID]string{} // of the meters checked
+	for i, in := range inputs {
+		m, err := parseReading(in, now)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reading %d: %v", i+1, err)})
+			return
+		}
+		unit, checked := units[m.MeterID]
+		if !checked {
+			meter, visible, err := h.visible(r, orgID, sess.UserID, tableID, m.MeterID)
+			if err != nil {
+				status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+				httpserver.JSON(w, status, map[string]string{"error": msg})
+				return
+			}
+			if !visible {
+				httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reading %d: meter %s not found", i+1, m.MeterID)})
+				return
+			}
+			unit, _ = meter["unit"].(string)
+			units[m.MeterID] = unit
+		}
+		if u := strings.TrimSpace(in.Unit); u != "" && u != strings.TrimSpace(unit) {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reading %d: unit %q is not the meter's unit %q", i+1, u, unit)})
+			return
+		}
+		readings = append(readings, m)
+	}
+	h.store(w, r, orgID, readings)
+}
+
+// counted writes 400 unless a request has between 1 and MaxReadings
+// readings.
+func counted(w http.ResponseWriter, n int) bool {
+	if n == 0 {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "no readings"})
+		return false
+	}
+	if n > ingest.MaxReadings {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d readings at once", ingest.MaxReadings)})
+		return false
+	}
+	return true
+}
+
+// store ingests checked readings and writes the result.
+func (h *Handler) store(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, readings []models.MeterReading) {
+	sess, _ := auth.SessionFromContext(r.Context())
+	res, err := ingest.Ingest(r.Context(), h.repo, orgID, sess.UserID, readings)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "ingest failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, res)
+}
+
+// readCSV reads the rows of a meter_id,value,read_at,unit CSV; the header
+// names the columns, in any order, and read_at and unit may be left out.
+func readCSV(body io.Reader) ([]readingInput, error) {
+	cr := csv.NewReader(body)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("invalid CSV: missing header")
+	}
+	col := map[string]int{"read_at": -1, "unit": -1}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := col["meter_id"]; !ok {
+		return nil, errors.New("invalid CSV: the header needs meter_id and value")
+	}
+	if _, ok := col["value"]; !ok {
+		return nil, errors.New("invalid CSV: the header needs meter_id and value")
+	}
+	cr.FieldsPerRecord = len(header)
+	var out []readingInput
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(out) == ingest.MaxReadings {
+			return nil, fmt.Errorf("at most %d readings at once", ingest.MaxReadings)
+		}
+		in := readingInput{MeterID: rec[col["meter_id"]]}
+		if v := strings.TrimSpace(rec[col["value"]]); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", line, v)
+			}
+			in.Value = &f
+		}
+		if i := col["read_at"]; i >= 0 {
+			in.ReadAt = rec[i]
+		}
+		if i := col["unit"]; i >= 0 {
+			in.Unit = rec[i]
+		}
+		out = append(out, in)
+	}
+}
+
+// parseReading validates one reading; read_at defaults to now.
+func parseReading(in readingInput, now time.Time) (models.MeterReading, error) {
+	id, err := uuid.Parse(strings.TrimSpace(in.MeterID))
+	if err != nil {
+		return models.MeterReading{}, errors.New("invalid meter_id")
+	}
+	if in.Value == nil || math.IsNaN(*in.Value) || math.IsInf(*in.Value, 0) {
+		return models.MeterReading{}, errors.New("value must be a number")
+	}
+	readAt := now
+	if s := strings.TrimSpace(in.ReadAt); s != "" {
+		if readAt, err = time.Parse(time.RFC3339, s); err != nil {
+			return models.MeterReading{}, errors.New("read_at must be an RFC 3339 time")
+		}
+	}
+	if readAt.After(now.Add(maxSkew)) {
+		return models.MeterReading{}, errors.New("read_at is in the future")
+	}
+	return models.MeterReading{MeterID: id, Value: *in.Value, ReadAt: readAt.UTC()}, nil
+}
+
+// window parses the from and to parameters: RFC 3339 times or dates (UTC),
+// to defaulting to now and from to 30 days before to.
+func window(r *http.Request) (time.Time, time.Time, error) {
+	parse := func(name string, def time.Time) (time.Time, error) {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			return def, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(time.DateOnly, s); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a date", name)
+	}
+	to, err := parse("to", time.Now())
+	if err != nil {
+		return to, to, err
+	}
+	from, err := parse("from", to.AddDate(0, 0, -30))
+	if err != nil {
+		return from, to, err
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// Readings handles GET /meters/{id}/readings?from=&to=&limit=500: the
+// readings taken in [from, to), latest first.
+func (h *Handler) Readings(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, _, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := window(r)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	limit := 500
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 5000 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 5000"})
+			return
+		}
+		limit = n
+	}
+	list, err := h.repo.ListMeterReadings(r.Context(), orgID, meterID, from, to, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"readings": list})
+}
+
+// Series handles GET /meters/{id}/readings/series?from=&to=&interval=day:
+// the min, max and average of the readings per interval, for charts.
+// interval is hour, day, week, month or a duration such as 15m or 6h.
+func (h *Handler) Series(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, _, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := window(r)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	name := r.URL.Query().Get("interval")
+	if name == "" {
+		name = "day"
+	}
+	var interval time.Duration
+	months := false
+	switch name {
+	case "hour":
+		interval = time.Hour
+	case "day":
+		interval = 24 * time.Hour
+	case "week":
+		interval = 7 * 24 * time.Hour
+	case "month":
+		months, interval = true, 28*24*time.Hour
+	default:
+		if interval, err = time.ParseDuration(name); err != nil || interval < time.Minute {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "interval must be hour, day, week, month or a duration of 1m or more"})
+			return
+		}
+	}
+	if to.Sub(from)/interval > maxBuckets {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d intervals at once", maxBuckets)})
+		return
+	}
+	buckets, err := h.repo.MeterReadingSeries(r.Context(), orgID, meterID, from, to, interval, months)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"interval": name, "buckets": buckets})
+}
@@ -0,0 +1,179 @@
+package meters
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+const meterTableID = 3
+
+var (
+	meterOrg    = uuid.MustParse("00000000-0000-4000-8000-0000000000d1")
+	gearbox     = uuid.MustParse("00000000-0000-4000-8000-0000000000d2") // in kWh
+	hourMeter   = uuid.MustParse("00000000-0000-4000-8000-0000000000d3") // without a unit
+	hiddenMeter = uuid.MustParse("00000000-0000-4000-8000-0000000000d4")
+)
+
+// meterRepo holds the meters the caller sees. Any other method panics
+// through the nil embedded Repo.
+type meterRepo struct {
+	repo.Repo
+	meters map[uuid.UUID]map[string]any
+}
+
+func (m *meterRepo) GetTablePermissions(context.Context, uuid.UUID, uuid.UUID, string) (int64, models.TablePermissions, bool, error) {
+	return meterTableID, models.TablePermissions{Read: true, EditRow: true}, true, nil
+}
+
+func (m *meterRepo) GetRowPermissions(_ context.Context, _, _, rowID uuid.UUID) (int64, models.TablePermissions, bool, error) {
+	_, ok := m.meters[rowID]
+	return meterTableID, models.TablePermissions{Read: true}, ok, nil
+}
+
+func (m *meterRepo) GetRowData(_ context.Context, _ uuid.UUID, rowID uuid.UUID) (map[string]any, bool, error) {
+	data, ok := m.meters[rowID]
+	return data, ok, nil
+}
+
+func value(f float64) *float64 { return &f }
+
+func TestReadCSV(t *testing.T) {
+	id := gearbox.String()
+	tests := []struct {
+		name    string
+		csv     string
+		want    []readingInput
+		wantErr string
+	}{
+		{"empty", "", nil, "invalid CSV: missing header"},
+		{"header without meter_id", "meter,value\n" + id + ",12\n", nil, "invalid CSV: the header needs meter_id and value"},
+		{"header without value", "meter_id,read_at\n" + id + ",2026-10-18T08:00:00Z\n", nil, "invalid CSV: the header needs meter_id and value"},
+		{"no header", id + ",12\n", nil, "invalid CSV: the header needs meter_id and value"},
+		{
+			"header in any order, case and spacing, after a byte order mark",
+			"\ufeffRead_At, VALUE ,Meter_ID\n2026-10-18T08:00:00Z,12.5," + id + "\n",
+			[]readingInput{{MeterID: id, Value: value(12.5), ReadAt: "2026-10-18T08:00:00Z"}},
+			"",
+		},
+		{
+			"unit column",
+			"meter_id,value,unit\n" + id + ",12,kWh\n" + id + ",13,\n",
+			[]readingInput{{MeterID: id, Value: value(12), Unit: "kWh"}, {MeterID: id, Value: value(13)}},
+			"",
+		},
+		{"header only", "meter_id,value\n", nil, ""},
+		{"empty value", "meter_id,value\n" + id + ",\n", []readingInput{{MeterID: id}}, ""},
+		{"value with its unit", "meter_id,value\n" + id + ",12\n" + id + ",12 kWh\n", nil, `line 3: invalid value "12 kWh"`},
+		{"decimal comma", "meter_id,value\n" + id + ",\"12,5\"\n", nil, `line 2: invalid value "12,5"`},
+		{"missing field", "meter_id,value,read_at\n" + id + ",12\n", nil, "invalid CSV: record on line 2: wrong number of fields"},
+		{"extra field", "meter_id,value\n" + id + ",12,kWh\n", nil, "invalid CSV: record on line 2: wrong number of fields"},
+		{"bare quote", "meter_id,value\n" + id + ",1\"2\n", nil, `invalid CSV: parse error on line 2, column 39: bare " in non-quoted-field`},
+	}
+	for _, tt := range tests {
+		got, err := readCSV(strings.NewReader(tt.csv))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: readCSV = %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseReading(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	id := gearbox.String()
+	tests := []struct {
+		name       string
+		in         readingInput
+		wantReadAt time.Time
+		wantErr    string
+	}{
+		{"read now", readingInput{MeterID: id, Value: value(1)}, now, ""},
+		{"blank read_at", readingInput{MeterID: id, Value: value(1), ReadAt: "  "}, now, ""},
+		{"offset turned to UTC", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T09:30:00+02:00"}, now.Add(-30 * time.Minute), ""},
+		{"fraction of a second", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T07:59:59.250Z"}, now.Add(-750 * time.Millisecond), ""},
+		{"clock slightly ahead", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T08:04:00Z"}, now.Add(4 * time.Minute), ""},
+		{"in the future", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T08:06:00Z"}, time.Time{}, "read_at is in the future"},
+		{"date only", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18"}, time.Time{}, "read_at must be an RFC 3339 time"},
+		{"without a zone", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T08:00:00"}, time.Time{}, "read_at must be an RFC 3339 time"},
+		{"with a space", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18 08:00:00Z"}, time.Time{}, "read_at must be an RFC 3339 time"},
+		{"unix time", readingInput{MeterID: id, Value: value(1), ReadAt: "1792310400"}, time.Time{}, "read_at must be an RFC 3339 time"},
+		{"no such hour", readingInput{MeterID: id, Value: value(1), ReadAt: "2026-10-18T25:00:00Z"}, time.Time{}, "read_at must be an RFC 3339 time"},
+		{"no value", readingInput{MeterID: id}, time.Time{}, "value must be a number"},
+		{"infinite value", readingInput{MeterID: id, Value: value(math.Inf(1))}, time.Time{}, "value must be a number"},
+		{"invalid meter_id", readingInput{MeterID: "gearbox", Value: value(1)}, time.Time{}, "invalid meter_id"},
+	}
+	for _, tt := range tests {
+		got, err := parseReading(tt.in, now)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !got.ReadAt.Equal(tt.wantReadAt) || got.ReadAt.Location() != time.UTC || got.MeterID != gearbox {
+			t.Errorf("%s: parseReading = %+v, %v; want read at %s UTC", tt.name, got, err, tt.wantReadAt)
+		}
+	}
+}
+
+// Import refuses the whole request, naming the reading, before anything is
+// ingested.
+func TestImportRefused(t *testing.T) {
+	h := New(&meterRepo{meters: map[uuid.UUID]map[string]any{
+		gearbox:   {"name": "Gearbox oil", "unit": "kWh"},
+		hourMeter: {"name": "Run hours"},
+	}})
+	g, hm := gearbox.String(), hourMeter.String()
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantError   string
+	}{
+		{"csv without header", "text/csv", "", "invalid CSV: missing header"},
+		{"csv header without value", "text/csv; charset=utf-8", "meter_id,reading\n" + g + ",12\n", "invalid CSV: the header needs meter_id and value"},
+		{"csv in another unit", "text/csv", "meter_id,value,unit\n" + g + ",12,kWh\n" + g + ",0.013,MWh\n", `reading 2: unit "MWh" is not the meter's unit "kWh"`},
+		{"csv unit in another case", "text/csv", "meter_id,value,unit\n" + g + ",12,KWH\n", `reading 1: unit "KWH" is not the meter's unit "kWh"`},
+		{"csv unit of a meter without one", "text/csv", "unit,meter_id,value\nh," + hm + ",12\n", `reading 1: unit "h" is not the meter's unit ""`},
+		{"json in another unit", "application/json", `{"readings":[{"meter_id":"` + g + `","value":12,"unit":"Wh"}]}`, `reading 1: unit "Wh" is not the meter's unit "kWh"`},
+		{"csv timestamp without zone", "text/csv", "meter_id,value,read_at\n" + g + ",12,2026-10-18T08:00:00Z\n" + g + ",13,2026-10-18 09:00\n", "reading 2: read_at must be an RFC 3339 time"},
+		{"json timestamp in the future", "application/json", `{"readings":[{"meter_id":"` + g + `","value":12,"read_at":"2999-01-01T00:00:00Z"}]}`, "reading 1: read_at is in the future"},
+		{"csv value with its unit", "text/csv", "meter_id,value\n" + g + ",12kWh\n", `line 2: invalid value "12kWh"`},
+		{"meter not seen", "text/csv", "meter_id,value\n" + g + ",12\n" + hiddenMeter.String() + ",3\n", "reading 2: meter " + hiddenMeter.String() + " not found"},
+		{"no readings", "text/csv", "meter_id,value\n", "no readings"},
+		{"invalid json", "application/json", `{"readings":[`, "invalid JSON body"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/meters/readings", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		ctx := auth.WithOrg(r.Context(), meterOrg)
+		ctx = auth.WithSession(ctx, &models.Session{UserID: uuid.New(), ActiveOrg: meterOrg})
+		w := httptest.NewRecorder()
+		h.Import(w, r.WithContext(ctx))
+		var out struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(w.Body).Decode(&out)
+		if w.Code != http.StatusBadRequest || out.Error != tt.wantError {
+			t.Errorf("%s: got %d %q, want 400 %q", tt.name, w.Code, out.Error, tt.wantError)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package meters
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+)
+
+// ruleInput is the request body of CreateRule and UpdateRule.
+type ruleInput struct {
+	Name          string   `json:"name"`
+	Kind          string   `json:"kind"` // above, below or delta
+	Value         *float64 `json:"value"`
+	Action        string   `json:"action"` // create_work_order or flag_work_orders
+	WOTitle       string   `json:"wo_title"`
+	WODescription string   `json:"wo_description"`
+	WOPriority    string   `json:"wo_priority"`
+	Active        *bool    `json:"active"` // default true
+}
+
+// Rules handles GET /meters/{id}/rules
+func (h *Handler) Rules(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, _, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListMeterRules(r.Context(), orgID, meterID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"rules": list})
+}
+
+// CreateRule handles POST /meters/{id}/rules with body
+// {"name":"Oil too hot","kind":"above","value":85,"action":"create_work_order",
+// "wo_title":"Check gearbox oil ({value} {unit})","wo_priority":"HIGH"}.
+func (h *Handler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, perms, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	if !perms.ManageSchema {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	rule, ok := h.decodeRule(w, r, orgID)
+	if !ok {
+		return
+	}
+	rule.MeterID = meterID
+	id, err := h.repo.CreateMeterRule(r.Context(), orgID, rule)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "create failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created, _, err := h.repo.GetMeterRule(r.Context(), orgID, meterID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"rule": created})
+}
+
+// UpdateRule handles PUT /meters/{id}/rules/{rule_id} with the same body as
+// CreateRule and replaces the rule.
+func (h *Handler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, perms, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	if !perms.ManageSchema {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	rule, ok := h.decodeRule(w, r, orgID)
+	if !ok {
+		return
+	}
+	rule.ID, rule.MeterID = id, meterID
+	found, err := h.repo.UpdateMeterRule(r.Context(), orgID, rule)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "rule not found"})
+		return
+	}
+	updated, _, err := h.repo.GetMeterRule(r.Context(), orgID, meterID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"rule": updated})
+}
+
+// DeleteRule handles DELETE /meters/{id}/rules/{rule_id}; the rule's alerts
+// go with it.
+func (h *Handler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, perms, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	if !perms.ManageSchema {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "rule_id")
+	if !ok {
+		return
+	}
+	found, err := h.repo.DeleteMeterRule(r.Context(), orgID, meterID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "rule not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Alerts handles GET /meters/{id}/alerts?limit=50: the times the meter's
+// rules fired, newest first, with the work orders they created or flagged.
+func (h *Handler) Alerts(w http.ResponseWriter, r *http.Request) {
+	orgID, meterID, _, ok := h.meter(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+	list, err := h.repo.ListMeterAlerts(r.Context(), orgID, meterID, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"alerts": list})
+}
+
+// decodeRule reads and validates a rule body, writing 400 when invalid.
+func (h *Handler) decodeRule(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (models.MeterRule, bool) {
+	var in ruleInput
+	if !httpserver.Decode(w, r, &in) {
+		return models.MeterRule{}, false
+	}
+	rule := models.MeterRule{
+		Name:          strings.TrimSpace(in.Name),
+		Kind:          strings.ToLower(strings.TrimSpace(in.Kind)),
+		Action:        strings.ToLower(strings.TrimSpace(in.Action)),
+		WOTitle:       strings.TrimSpace(in.WOTitle),
+		WODescription: strings.TrimSpace(in.WODescription),
+		WOPriority:    strings.TrimSpace(in.WOPriority),
+		Active:        in.Active == nil || *in.Active,
+	}
+	if in.Value != nil {
+		rule.Value = *in.Value
+	}
+	err := validateRule(rule, in.Value != nil)
+	if err == nil && rule.WOPriority != "" {
+		err = h.checkPriority(r, orgID, rule.WOPriority)
+	}
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return models.MeterRule{}, false
+	}
+	return rule, true
+}
+
+func validateRule(rule models.MeterRule, hasValue bool) error {
+	switch {
+	case rule.Name == "" || len(rule.Name) > 200:
+		return errors.New("name is required, up to 200 characters")
+	case rule.Kind != models.MeterRuleAbove && rule.Kind != models.MeterRuleBelow && rule.Kind != models.MeterRuleDelta:
+		return errors.New("kind must be above, below or delta")
+	case !hasValue || math.IsNaN(rule.Value) || math.IsInf(rule.Value, 0):
+		return errors.New("value must be a number")
+	case rule.Kind == models.MeterRuleDelta && rule.Value <= 0:
+		return errors.New("the value of a delta rule must be positive")
+	case rule.Action != models.MeterCreateWorkOrder && rule.Action != models.MeterFlagWorkOrders:
+		return errors.New("action must be create_work_order or flag_work_orders")
+	}
+	return nil
+}
+
+// checkPriority checks wo_priority against the priority values of the
+// org's work order table, so rules cannot fail when they fire.
+func (h *Handler) checkPriority(r *http.Request, orgID uuid.UUID, priority string) error {
+	cols, err := h.repo.GetUserTableSchema(r.Context(), orgID, pm.WorkOrderTable)
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if c.Name == "priority" && len(c.EnumValues) > 0 && !slices.Contains(c.EnumValues, priority) {
+			return errors.New("wo_priority must be one of " + strings.Join(c.EnumValues, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package pm serves the occurrence logs and forecasts of PM schedules and
+// lets admins scan the org's schedules on demand. Generating work orders
+// happens in internal/pm.
+package pm
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	sched "yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// schedule returns the {id} PM schedule as the caller sees it. Schedules of
+// a table the caller cannot read, or hidden by row policies, are not found.
+func (h *Handler) schedule(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, map[string]any, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, nil, false
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, uuid.Nil, nil, false
+	}
+	_, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, sess.UserID, sched.ScheduleTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, uuid.Nil, nil, false
+	}
+	var data map[string]any
+	if found && perms.Read {
+		if data, found, err = h.repo.GetRowData(r.Context(), orgID, id); err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return uuid.Nil, uuid.Nil, nil, false
+		}
+	}
+	if !found || !perms.Read || data == nil {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "pm schedule not found"})
+		return uuid.Nil, uuid.Nil, nil, false
+	}
+	return orgID, id, data, true
+}
+
+// Occurrences handles GET /pm-schedules/{id}/occurrences?limit=50: the
+// occurrences the scheduler handled, newest first, with the work orders
+// generated for them.
+func (h *Handler) Occurrences(w http.ResponseWriter, r *http.Request) {
+	orgID, id, _, ok := h.schedule(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+	list, err := h.repo.ListPMOccurrences(r.Context(), orgID, id, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"occurrences": list})
+}
+
+// Forecast handles GET /pm-schedules/{id}/forecast?count=10: the next dates
+// a calendar schedule falls on that were not handled yet, with the day each
+// work order will be generated.
+func (h *Handler) Forecast(w http.ResponseWriter, r *http.Request) {
+	orgID, id, data, ok := h.schedule(w, r)
+	if !ok {
+		return
+	}
+	count := 10
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "count must be between 1 and 100"})
+			return
+		}
+		count = n
+	}
+	s, err := sched.ParseSchedule(id, data)
+	if err != nil {
+		httpserver.JSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	if s.Meter {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "meter schedules fall due by reading, not by date"})
+		return
+	}
+	now := time.Now().UTC()
+	after := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+	last, found, err := h.repo.LastPMOccurrence(r.Context(), orgID, id, models.PMTriggerCalendar)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if found {
+		if d, err := time.Parse(time.DateOnly, last.DueOn); err == nil && d.After(after) {
+			after = d
+		}
+	}
+	type occurrence struct {
+		DueOn      string `json:"due_on"`
+		GenerateOn string `json:"generate_on"`
+	}
+	out := []occurrence{}
+	for _, d := range s.Upcoming(after, count) {
+		out = append(out, occurrence{
+			DueOn:      d.Format(time.DateOnly),
+			GenerateOn: d.AddDate(0, 0, -s.LeadDays).Format(time.DateOnly),
+		})
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"rule": s.Rule.String(), "occurrences": out})
+}
+
+// Scan handles POST /pm-schedules/scan: scans the org's PM schedules now
+// instead of waiting for the scheduler, and reports the occurrences handled
+// and the schedules that failed.
+func (h *Handler) Scan(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	res, err := sched.Generate(r.Context(), h.repo, orgID, time.Now())
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "scan failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,288 @@
+package requests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	blobs "yourapp/internal/files"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	intake "yourapp/internal/requests"
+)
+
+// captchaFields are the form fields a captcha answer is taken from: ours,
+// then those the hCaptcha, reCAPTCHA and Turnstile widgets fill in.
+var captchaFields = []string{"captcha", "h-captcha-response", "g-recaptcha-response", "cf-turnstile-response"}
+
+// portal returns the org and settings of the enabled portal named by the
+// {key} URL parameter, writing 404 when there is none.
+func (h *Handler) portal(w http.ResponseWriter, r *http.Request) (uuid.UUID, models.RequestPortal, bool) {
+	ctx := r.Context()
+	orgID, found, err := h.repo.RequestPortalOrg(ctx, chi.URLParam(r, "key"))
+	var p models.RequestPortal
+	if err == nil && found {
+		p, found, err = h.repo.GetRequestPortal(repo.WithOrg(ctx, orgID), orgID)
+	}
+	if err != nil {
+		httpserver.WriteError(w, err, "fetch failed")
+		return uuid.Nil, p, false
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "portal not found"})
+		return uuid.Nil, p, false
+	}
+	return orgID, p, true
+}
+
+// PublicPortal handles GET /portal/{key}: what the request form shows.
+func (h *Handler) PublicPortal(w http.ResponseWriter, r *http.Request) {
+	_, p, ok := h.portal(w, r)
+	if !ok {
+		return
+	}
+	out := map[string]any{
+		"title":   p.Title,
+		"intro":   p.Intro,
+		"captcha": p.Captcha,
+		"photos":  p.Photos,
+	}
+	if p.Captcha {
+		out["captcha_site_key"] = h.captcha.SiteKey
+	}
+	if p.Photos {
+		out["max_photos"] = intake.MaxPhotos
+		out["max_photo_size"] = h.files.MaxSize()
+	}
+	httpserver.JSON(w, http.StatusOK, out)
+}
+
+// Submit handles POST /portal/{key}/requests: submits a request without an
+// account. The body is JSON {"title":"...","description":"...","name":
+// "...","email":"...","phone":"...","captcha":"..."}, or a
+// multipart/form-data form with the same fields followed by up to
+// MaxPhotos "photos" parts; fields sent after the first photo are ignored.
+// Response 201 {"token":"...","status_url":"/portal/status/...",
+// "status":"PENDING"}. The token is only returned here.
+func (h *Handler) Submit(w http.ResponseWriter, r *http.Request) {
+	orgID, p, ok := h.portal(w, r)
+	if !ok {
+		return
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var s intake.Submission
+	// The photos this submission stored, deleted again unless it is taken
+	var stored []models.File
+	if ct == "multipart/form-data" {
+		if !h.readForm(w, r, orgID, p, &s, &stored) {
+			h.discard(r.Context(), orgID, stored)
+			return
+		}
+	} else {
+		var in struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			Name        string `json:"name"`
+			Email       string `json:"email"`
+			Phone       string `json:"phone"`
+			Captcha     string `json:"captcha"`
+		}
+		if !httpserver.Decode(w, r, &in) {
+			return
+		}
+		s = intake.Submission{Title: in.Title, Description: in.Description, Name: in.Name, Email: in.Email, Phone: in.Phone}
+		if !h.check(w, r, p, &s, in.Captcha) {
+			return
+		}
+	}
+
+	id, token, err := intake.Submit(r.Context(), h.repo, orgID, p, s)
+	if err != nil {
+		h.discard(r.Context(), orgID, stored)
+		httpserver.WriteError(w, err, "submit failed")
+		return
+	}
+	slog.InfoContext(r.Context(), "portal request submitted", "org_id", orgID, "row_id", id, "photos", len(s.Photos))
+	httpserver.JSON(w, http.StatusCreated, map[string]string{
+		"token":      token,
+		"status_url": "/portal/status/" + token,
+		"status":     "PENDING",
+	})
+}
+
+// check validates a submission and its captcha answer, writing 400 when
+// either is refused.
+func (h *Handler) check(w http.ResponseWriter, r *http.Request, p models.RequestPortal, s *intake.Submission, answer string) bool {
+	if err := s.Check(); err != nil {
+		httpserver.WriteError(w, err, "invalid request")
+		return false
+	}
+	if !p.Captcha {
+		return true
+	}
+	if !h.captcha.Configured() {
+		slog.ErrorContext(r.Context(), "portal asks for a captcha but none is configured")
+		httpserver.JSON(w, http.StatusServiceUnavailable, map[string]string{"error": "the captcha cannot be checked"})
+		return false
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	passed, err := h.captcha.Verify(r.Context(), answer, ip)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "captcha verify failed", "err", err)
+		httpserver.JSON(w, http.StatusBadGateway, map[string]string{"error": "the captcha cannot be checked"})
+		return false
+	}
+	if !passed {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "the captcha was not solved"})
+		return false
+	}
+	return true
+}
+
+// discard deletes the photos stored for a submission that was refused or
+// failed, so they don't linger unlinked.
+func (h *Handler) discard(ctx context.Context, orgID uuid.UUID, stored []models.File) {
+	// The client may be gone already
+	ctx = context.WithoutCancel(ctx)
+	for _, f := range stored {
+		if _, err := h.files.Delete(ctx, orgID, f); err != nil {
+			slog.WarnContext(ctx, "portal photo left behind", "org_id", orgID, "file_id", f.ID, "err", err)
+		}
+	}
+}
+
+// readForm reads a multipart submission into s, storing its photos and
+// adding those not stored before to stored. The fields and captcha are
+// checked before the first photo is stored.
+func (h *Handler) readForm(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, p models.RequestPortal, s *intake.Submission, stored *[]models.File) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, intake.MaxPhotos*h.files.MaxSize()+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart body"})
+		return false
+	}
+	fields := map[string]string{}
+	checked := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			httpserver.WriteError(w, err, "invalid multipart body")
+			return false
+		}
+		name := part.FormName()
+		if name != "photos" {
+			if !checked {
+				b, err := io.ReadAll(io.LimitReader(part, 64<<10))
+				if err != nil {
+					part.Close()
+					httpserver.WriteError(w, err, "invalid multipart body")
+					return false
+				}
+				fields[name] = string(b)
+			}
+			part.Close()
+			continue
+		}
+		if !checked {
+			if !h.checkForm(w, r, p, s, fields) {
+				part.Close()
+				return false
+			}
+			checked = true
+		}
+		ok := h.photo(w, r, orgID, p, s, stored, part)
+		part.Close()
+		if !ok {
+			return false
+		}
+	}
+	return checked || h.checkForm(w, r, p, s, fields)
+}
+
+// checkForm fills s from the fields of a form and checks it.
+func (h *Handler) checkForm(w http.ResponseWriter, r *http.Request, p models.RequestPortal, s *intake.Submission, fields map[string]string) bool {
+	s.Title, s.Description = fields["title"], fields["description"]
+	s.Name, s.Email, s.Phone = fields["name"], fields["email"], fields["phone"]
+	var answer string
+	for _, f := range captchaFields {
+		if answer = fields[f]; answer != "" {
+			break
+		}
+	}
+	return h.check(w, r, p, s, answer)
+}
+
+// photo stores one "photos" part and adds it to s, and to stored when its
+// content is new, writing 400 when the portal takes no photos, too many
+// were sent or the part is not an image.
+func (h *Handler) photo(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, p models.RequestPortal, s *intake.Submission, stored *[]models.File, part *multipart.Part) bool {
+	if !p.Photos {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "this portal does not take photos"})
+		return false
+	}
+	if len(s.Photos) >= intake.MaxPhotos {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "too many photos"})
+		return false
+	}
+	name := part.FileName()
+	if name == "" {
+		name = "photo"
+	}
+	br := bufio.NewReaderSize(part, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		httpserver.WriteError(w, err, "invalid multipart body")
+		return false
+	}
+	if !strings.HasPrefix(blobs.Sniff(head, name), "image/") {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "photos must be images"})
+		return false
+	}
+	f, created, err := h.files.Upload(r.Context(), orgID, uuid.Nil, name, br)
+	if err != nil {
+		httpserver.WriteError(w, err, "upload failed")
+		return false
+	}
+	// A file with the same content was there before and may be linked
+	// elsewhere; it stays.
+	if created {
+		*stored = append(*stored, f)
+	}
+	if !slices.Contains(s.Photos, f.ID) {
+		s.Photos = append(s.Photos, f.ID)
+	}
+	return true
+}
+
+// Status handles GET /portal/status/{token}: the status of the request a
+// token follows, and of its work order once it has one.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	s, found, err := intake.Track(r.Context(), h.repo, chi.URLParam(r, "token"))
+	if err != nil {
+		httpserver.WriteError(w, err, "fetch failed")
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "request not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, s)
+}
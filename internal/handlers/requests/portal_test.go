@@ -0,0 +1,290 @@
+package requests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	blobs "yourapp/internal/files"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	intake "yourapp/internal/requests"
+)
+
+var portalOrg = uuid.MustParse("00000000-0000-4000-8000-0000000000f1")
+
+// portalRepo serves one portal, keeps files in memory and has no requests
+// table, so every submission that gets as far as intake.Submit fails with
+// ErrNoTable. Any other method panics through the nil embedded Repo.
+type portalRepo struct {
+	repo.Repo
+	portal models.RequestPortal
+	mu     sync.Mutex
+	files  map[uuid.UUID]models.File
+}
+
+func (m *portalRepo) RequestPortalOrg(_ context.Context, key string) (uuid.UUID, bool, error) {
+	return portalOrg, key == m.portal.Key, nil
+}
+
+func (m *portalRepo) GetRequestPortal(context.Context, uuid.UUID) (models.RequestPortal, bool, error) {
+	return m.portal, true, nil
+}
+
+func (m *portalRepo) GetFileBySHA256(_ context.Context, _ uuid.UUID, sha string) (models.File, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.files {
+		if f.SHA256 == sha {
+			return f, true, nil
+		}
+	}
+	return models.File{}, false, nil
+}
+
+func (m *portalRepo) InsertFile(_ context.Context, _ uuid.UUID, f models.File) (uuid.UUID, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f.ID = uuid.New()
+	m.files[f.ID] = f
+	return f.ID, true, nil
+}
+
+func (m *portalRepo) GetFile(_ context.Context, _, id uuid.UUID) (models.File, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[id]
+	return f, ok, nil
+}
+
+func (m *portalRepo) DeleteFile(_ context.Context, _, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.files[id]
+	delete(m.files, id)
+	return ok, nil
+}
+
+func (m *portalRepo) InTx(_ context.Context, fn func(repo.Repo) error) error { return fn(m) }
+
+func (m *portalRepo) ListUserTables(context.Context, uuid.UUID) ([]models.UserTable, error) {
+	return nil, nil
+}
+
+func (m *portalRepo) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.files)
+}
+
+// portalTest is a portal served with a captcha provider that accepts the
+// answer "solved" when asked with the secret "captcha-secret".
+type portalTest struct {
+	repo  *portalRepo
+	dir   string // of the blobs
+	files *blobs.Service
+	srv   *httptest.Server
+}
+
+// newPortalTest serves p, asking the captcha provider with secret; the
+// captcha is not configured when secret is empty.
+func newPortalTest(t *testing.T, p models.RequestPortal, secret string) *portalTest {
+	t.Helper()
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "captcha-secret" {
+			http.Error(w, "bad secret", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"success": r.FormValue("response") == "solved"})
+	}))
+	t.Cleanup(provider.Close)
+
+	p.Key, p.Enabled = "front-desk", true
+	pt := &portalTest{repo: &portalRepo{portal: p, files: map[uuid.UUID]models.File{}}, dir: t.TempDir()}
+	pt.files = blobs.NewService(pt.repo, blobs.LocalStore{Dir: pt.dir}, blobs.Options{Secret: []byte("test")})
+	h := New(pt.repo, pt.files, intake.Captcha{VerifyURL: provider.URL, Secret: secret, Client: provider.Client()})
+	r := chi.NewRouter()
+	r.Post("/portal/{key}/requests", h.Submit)
+	pt.srv = httptest.NewServer(r)
+	t.Cleanup(pt.srv.Close)
+	return pt
+}
+
+// submit posts a body and returns the status and error message.
+func (pt *portalTest) submit(t *testing.T, contentType string, body []byte) (int, string) {
+	t.Helper()
+	resp, err := pt.srv.Client().Post(pt.srv.URL+"/portal/front-desk/requests", contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out.Error
+}
+
+// blobs counts the blobs stored.
+func (pt *portalTest) blobs(t *testing.T) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(pt.dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// photo returns a small PNG, different for each shade.
+func photo(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = shade
+	}
+	img.SetGray(0, 0, color.Gray{Y: shade + 1})
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// form is a multipart body of fields, in order, then files as "photos"
+// parts.
+func form(t *testing.T, fields [][2]string, files ...[]byte) (string, []byte) {
+	t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for _, f := range fields {
+		mw.WriteField(f[0], f[1])
+	}
+	for i, content := range files {
+		fw, err := mw.CreateFormFile("photos", "photo"+string(rune('a'+i))+".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	mw.Close()
+	return mw.FormDataContentType(), b.Bytes()
+}
+
+func TestSubmitCaptcha(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"no answer", "captcha-secret", `{"title":"Leak"}`, http.StatusBadRequest, "the captcha was not solved"},
+		{"wrong answer", "captcha-secret", `{"title":"Leak","captcha":"guess"}`, http.StatusBadRequest, "the captcha was not solved"},
+		{"provider refuses us", "other", `{"title":"Leak","captcha":"solved"}`, http.StatusBadGateway, "the captcha cannot be checked"},
+		{"not configured", "", `{"title":"Leak","captcha":"solved"}`, http.StatusServiceUnavailable, "the captcha cannot be checked"},
+		{"invalid before the captcha", "captcha-secret", `{"captcha":"solved"}`, http.StatusBadRequest, "title is required"},
+		// Past the captcha, as far as the missing requests table
+		{"solved", "captcha-secret", `{"title":"Leak","captcha":"solved"}`, http.StatusNotFound, "requests are not set up for this organisation"},
+	}
+	for _, tt := range tests {
+		pt := newPortalTest(t, models.RequestPortal{Captcha: true}, tt.secret)
+		status, msg := pt.submit(t, "application/json", []byte(tt.body))
+		if status != tt.wantStatus || msg != tt.wantError {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, status, msg, tt.wantStatus, tt.wantError)
+		}
+	}
+
+	// A form's captcha is checked before any photo is stored, with the
+	// answer of whichever widget sent one
+	pt := newPortalTest(t, models.RequestPortal{Captcha: true, Photos: true}, "captcha-secret")
+	ct, body := form(t, [][2]string{{"title", "Leak"}, {"h-captcha-response", "guess"}}, photo(t, 10))
+	if status, msg := pt.submit(t, ct, body); status != http.StatusBadRequest || msg != "the captcha was not solved" {
+		t.Errorf("form with a wrong answer: got %d %q", status, msg)
+	}
+	if pt.repo.count() != 0 || pt.blobs(t) != 0 {
+		t.Errorf("photos stored before the captcha was checked: %d files, %d blobs", pt.repo.count(), pt.blobs(t))
+	}
+	ct, body = form(t, [][2]string{{"title", "Leak"}, {"cf-turnstile-response", "solved"}})
+	if status, _ := pt.submit(t, ct, body); status != http.StatusNotFound {
+		t.Errorf("form with a solved captcha: status = %d, want 404 past the captcha", status)
+	}
+}
+
+// Photos stored for a submission that is then refused or fails are
+// deleted, files and blobs; photos that were there before stay.
+func TestSubmitPhotos(t *testing.T) {
+	fields := [][2]string{{"title", "Leak"}, {"email", "ann@example.com"}}
+	photos := func(n int) [][]byte {
+		var out [][]byte
+		for i := range n {
+			out = append(out, photo(t, uint8(i*20)))
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		noPhotos   bool // the portal takes none
+		files      [][]byte
+		wantStatus int
+		wantError  string
+	}{
+		{"portal takes no photos", true, photos(1), http.StatusBadRequest, "this portal does not take photos"},
+		{"too many photos", false, photos(intake.MaxPhotos + 1), http.StatusBadRequest, "too many photos"},
+		{"not an image", false, append(photos(2), []byte("%PDF-1.7\n")), http.StatusBadRequest, "photos must be images"},
+		{"empty photo", false, append(photos(2), nil), http.StatusBadRequest, "photos must be images"},
+		{"submit fails", false, photos(intake.MaxPhotos), http.StatusNotFound, "requests are not set up for this organisation"},
+		{"same photo twice", false, [][]byte{photo(t, 1), photo(t, 1)}, http.StatusNotFound, "requests are not set up for this organisation"},
+	}
+	for _, tt := range tests {
+		pt := newPortalTest(t, models.RequestPortal{Photos: !tt.noPhotos}, "")
+		ct, body := form(t, fields, tt.files...)
+		status, msg := pt.submit(t, ct, body)
+		if status != tt.wantStatus || msg != tt.wantError {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, status, msg, tt.wantStatus, tt.wantError)
+		}
+		if pt.repo.count() != 0 || pt.blobs(t) != 0 {
+			t.Errorf("%s: left %d files, %d blobs behind", tt.name, pt.repo.count(), pt.blobs(t))
+		}
+	}
+
+	// A photo already uploaded, perhaps linked to another row, stays
+	pt := newPortalTest(t, models.RequestPortal{Photos: true}, "")
+	ctx := context.Background()
+	kept, created, err := pt.files.Upload(ctx, portalOrg, uuid.New(), "pump.png", bytes.NewReader(photo(t, 200)))
+	if err != nil || !created {
+		t.Fatalf("Upload = %v, %v", created, err)
+	}
+	blobsBefore := pt.blobs(t)
+	ct, body := form(t, fields, photo(t, 200), photo(t, 100))
+	if status, _ := pt.submit(t, ct, body); status != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", status)
+	}
+	if _, found, _ := pt.repo.GetFile(ctx, portalOrg, kept.ID); !found || pt.repo.count() != 1 || pt.blobs(t) != blobsBefore {
+		t.Errorf("after a failed submission with an earlier photo: found %v, %d files, %d blobs; want only it, %d blobs",
+			found, pt.repo.count(), pt.blobs(t), blobsBefore)
+	}
+	if r, err := pt.files.Open(ctx, portalOrg, kept, false); err != nil {
+		t.Errorf("earlier photo's blob: %v", err)
+	} else {
+		r.Close()
+	}
+}
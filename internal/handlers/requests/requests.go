@@ -0,0 +1,162 @@
+// Package requests serves an org's public request portal settings and the
+// conversion of requests into work orders. Requests are taken and
+// converted by internal/requests; the public side of the portal is in
+// portal.go.
+package requests
+
+import (
+	"net/http"
+
+	blobs "yourapp/internal/files"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+	intake "yourapp/internal/requests"
+)
+
+type Handler struct {
+	repo    repo.Repo
+	files   *blobs.Service
+	captcha intake.Captcha
+}
+
+func New(repo repo.Repo, files *blobs.Service, captcha intake.Captcha) *Handler {
+	return &Handler{repo: repo, files: files, captcha: captcha}
+}
+
+// Portal handles GET /requests/portal: the org's request portal settings,
+// {"portal": null} until they are first saved.
+func (h *Handler) Portal(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	p, found, err := h.repo.GetRequestPortal(r.Context(), orgID)
+	if err != nil {
+		httpserver.WriteError(w, err, "fetch failed")
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusOK, map[string]any{"portal": nil})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"portal": p})
+}
+
+// portalInput is the body of UpdatePortal; photos defaults to true.
+type portalInput struct {
+	Enabled         bool   `json:"enabled"`
+	Title           string `json:"title"`
+	Intro           string `json:"intro"`
+	Captcha         bool   `json:"captcha"`
+	Photos          *bool  `json:"photos"`
+	DefaultPriority string `json:"default_priority"`
+}
+
+// UpdatePortal handles PUT /requests/portal with body {"enabled":true,
+// "title":"Report a problem","intro":"...","captcha":true,"photos":true,
+// "default_priority":"MEDIUM"}: creates the org's portal, with a new key,
+// or changes its settings.
+func (h *Handler) UpdatePortal(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	var in portalInput
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	p := models.RequestPortal{
+		Key:             intake.NewKey(),
+		Enabled:         in.Enabled,
+		Title:           in.Title,
+		Intro:           in.Intro,
+		Captcha:         in.Captcha,
+		Photos:          in.Photos == nil || *in.Photos,
+		DefaultPriority: in.DefaultPriority,
+		UpdatedBy:       &sess.UserID,
+	}
+	if err := intake.CheckPortal(&p, h.captcha.Configured()); err != nil {
+		httpserver.WriteError(w, err, "invalid portal")
+		return
+	}
+	saved, err := h.repo.SaveRequestPortal(r.Context(), orgID, p)
+	if err != nil {
+		httpserver.WriteError(w, err, "save failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"portal": saved})
+}
+
+// RotatePortalKey handles POST /requests/portal/rotate-key: gives the
+// portal a new key, so links to the old one stop working. Status tokens
+// are kept.
+func (h *Handler) RotatePortalKey(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	key := intake.NewKey()
+	found, err := h.repo.SetRequestPortalKey(r.Context(), orgID, key, &sess.UserID)
+	if err != nil {
+		httpserver.WriteError(w, err, "rotate failed")
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "the org has no request portal"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]string{"key": key})
+}
+
+// Convert handles POST /requests/{id}/convert with body {"values":
+// {"team":"...","due_date":"2026-10-25"},"note":"..."} (both optional):
+// approves the request and creates its work order. The caller needs edit
+// on the request and create on work orders. Response 201
+// {"work_order_id":"..."}.
+func (h *Handler) Convert(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var in struct {
+		Values map[string]any `json:"values"`
+		Note   string         `json:"note"`
+	}
+	if !httpserver.Decode(w, r, &in) {
+		return
+	}
+	ctx := r.Context()
+	tableID, _, found, err := h.repo.GetTablePermissions(ctx, orgID, sess.UserID, intake.Table)
+	var rowTable int64
+	var perms, woPerms models.TablePermissions
+	if err == nil && found {
+		rowTable, perms, found, err = h.repo.GetRowPermissions(ctx, orgID, sess.UserID, id)
+	}
+	if err == nil && found {
+		_, woPerms, _, err = h.repo.GetTablePermissions(ctx, orgID, sess.UserID, pm.WorkOrderTable)
+	}
+	if err != nil {
+		httpserver.WriteError(w, err, "permission check failed")
+		return
+	}
+	if !found || rowTable != tableID {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "request not found"})
+		return
+	}
+	if !perms.EditRow || !woPerms.CreateRow {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	woID, err := intake.Convert(ctx, h.repo, orgID, sess.UserID, id, in.Values, in.Note)
+	if err != nil {
+		httpserver.WriteError(w, err, "convert failed")
+		return
+	}
+	httpserver.JSON(w, http.StatusCreated, map[string]string{"work_order_id": woID.String()})
+}
@@ -2,18 +2,50 @@
 package handlers
 
 import (
+    "net/http"
+
     tables "yourapp/internal/handlers/tables"
     "yourapp/internal/handlers/admin"
+    "yourapp/internal/handlers/automations"
+    checklists "yourapp/internal/handlers/checklists"
+    blobs "yourapp/internal/files"
+    files "yourapp/internal/handlers/files"
+    inventory "yourapp/internal/handlers/inventory"
+    labour "yourapp/internal/handlers/labour"
+    meters "yourapp/internal/handlers/meters"
+    pm "yourapp/internal/handlers/pm"
+    requests "yourapp/internal/handlers/requests"
+    "yourapp/internal/handlers/search"
+    "yourapp/internal/handlers/teams"
+    templates "yourapp/internal/handlers/templates"
     "yourapp/internal/handlers/users"
+    "yourapp/internal/handlers/webhooks"
     "yourapp/internal/middleware"
+    "yourapp/internal/models"
     "yourapp/internal/repo"
+    intake "yourapp/internal/requests"
+    "yourapp/internal/stream"
 
     "github.com/go-chi/chi/v5"
 )
 
-func RegisterRoutes(mux *chi.Mux, r repo.Repo) {
+// RegisterRoutes mounts the API. portalLimit rate-limits the public request
+// portal, which takes requests without a session.
+func RegisterRoutes(mux *chi.Mux, r repo.Repo, hub *stream.Hub, fs *blobs.Service, captcha intake.Captcha, portalLimit func(http.Handler) http.Handler) {
     u := users.New(r)
-    t := tables.New(r)
+    t := tables.New(r, hub)
+    s := search.New(r)
+    tp := templates.New(r)
+    tm := teams.New(r)
+    wh := webhooks.New(r)
+    au := automations.New(r)
+    pms := pm.New(r)
+    mt := meters.New(r)
+    inv := inventory.New(r)
+    lb := labour.New(r)
+    cl := checklists.New(r)
+    fl := files.New(r, fs)
+    rq := requests.New(r, fs, captcha)
 
     mux.Route("/users", func(sr chi.Router) {
         // Apply auth to the whole group ONCE
@@ -28,15 +60,199 @@ func RegisterRoutes(mux *chi.Mux, r repo.Repo) {
         // Create and list org-scoped user tables
         sr.Get("/", t.List)
         sr.Get("/indexed-fields", t.IndexedFields)
-        sr.Post("/", t.Create)
+        sr.Get("/schema/export", t.ExportSchema)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/schema/import", t.ImportSchema)
+        // New tables default to Admin-managed schemas, so only admins create them
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/", t.Create)
         sr.Delete("/{table}", t.Delete)
+        sr.Get("/{table}/permissions", t.GetPermissions)
+        sr.Put("/{table}/permissions", t.PutPermissions)
+        sr.Get("/{table}/policies", t.GetPolicies)
+        sr.Put("/{table}/policies", t.PutPolicies)
+        sr.Get("/{table}/state-machines", t.GetStateMachines)
+        sr.Put("/{table}/state-machines/{column}", t.PutStateMachine)
+        sr.Delete("/{table}/state-machines/{column}", t.DeleteStateMachine)
+        sr.Get("/{table}/hierarchy", t.GetHierarchy)
+        sr.Put("/{table}/hierarchy", t.PutHierarchy)
+        sr.Delete("/{table}/hierarchy", t.DeleteHierarchy)
         sr.Post("/{table}/columns", t.AddColumn)
         sr.Delete("/{table}/columns/{column}", t.RemoveColumn)
+        sr.Put("/{table}/columns/{column}/access", t.SetColumnAccess)
         sr.Post("/{table}/rows", t.AddRow)
+        sr.Patch("/{table}/rows/{row_id}", t.UpdateRow)
         sr.Delete("/{table}/rows/{row_id}", t.DeleteRow)
+        sr.Get("/{table}/rows/{row_id}/transitions", t.RowStates)
+        sr.Post("/{table}/rows/{row_id}/transition", t.Transition)
+        sr.Get("/{table}/rows/{row_id}/subtree", t.Subtree)
+        sr.Get("/{table}/rows/{row_id}/ancestors", t.Ancestors)
+        sr.Post("/{table}/rows/{row_id}/move", t.Move)
         sr.Post("/{table}/rows/indexed", t.LookupIndexed)
         sr.Post("/rows/lookup", t.LookupRow)
         sr.Post("/{table}/search", t.Search)
+        // Live row events (Server-Sent Events)
+        sr.Get("/{table}/events", t.Events)
+    })
+
+    // Work order lifecycle shortcut for the table of the work_orders template,
+    // the parts used on work orders with their cost, the time spent on them and their checklists
+    mux.Route("/work-orders", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Post("/{id}/transition", t.WorkOrderTransition)
+        sr.Get("/parts-cost", inv.PartsCost)
+        sr.Get("/{id}/parts", inv.WorkOrderParts)
+        sr.Post("/{id}/parts", inv.IssueParts)
+        sr.Post("/{id}/parts/return", inv.ReturnParts)
+        sr.Get("/{id}/labour", lb.WorkOrderLabour)
+        sr.Post("/{id}/labour", lb.Record)
+        sr.Post("/{id}/labour/start", lb.Start)
+        sr.Get("/{id}/checklists", cl.WorkOrderChecklists)
+        sr.Post("/{id}/checklists", cl.AddChecklist)
+        sr.Delete("/{id}/checklists/{checklist_id}", cl.DeleteChecklist)
+        sr.Put("/{id}/checklists/{checklist_id}/items/{item_id}", cl.AnswerItem)
+        sr.Delete("/{id}/checklists/{checklist_id}/items/{item_id}/result", cl.ClearItem)
+    })
+
+    // Checklist templates; changing them is admin-only
+    mux.Route("/checklists", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/templates", cl.Templates)
+        sr.Get("/templates/{id}", cl.Template)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/templates", cl.CreateTemplate)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Put("/templates/{id}", cl.UpdateTemplate)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Delete("/templates/{id}", cl.DeleteTemplate)
+    })
+
+    // Uploaded files and their links to rows; signed download URLs work without a session
+    mux.Route("/files", func(sr chi.Router) {
+        sr.Get("/signed/{id}", fl.Signed)
+        sr.Group(func(g chi.Router) {
+            g.Use(middleware.RequireAuth(r))
+            g.Get("/", fl.List)
+            g.Post("/", fl.Upload)
+            g.Get("/{id}", fl.Get)
+            g.Delete("/{id}", fl.Delete)
+            g.Get("/{id}/content", fl.Content)
+            g.Get("/{id}/thumbnail", fl.Thumbnail)
+            g.Get("/{id}/url", fl.URL)
+            g.Post("/{id}/links", fl.Link)
+            g.Delete("/{id}/links/{row_id}", fl.Unlink)
+        })
+    })
+
+    // Request portal settings are admin-only; converting a request checks the caller's grants
+    mux.Route("/requests", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Get("/portal", rq.Portal)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Put("/portal", rq.UpdatePortal)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/portal/rotate-key", rq.RotatePortalKey)
+        sr.Post("/{id}/convert", rq.Convert)
+    })
+
+    // The public request portal works without a session, rate-limited per client
+    mux.Route("/portal", func(sr chi.Router) {
+        sr.Use(portalLimit)
+        sr.Get("/status/{token}", rq.Status)
+        sr.Get("/{key}", rq.PublicPortal)
+        sr.Post("/{key}/requests", rq.Submit)
+    })
+
+    // Labour timers, time entries and timesheets; hourly rates are admin-only
+    mux.Route("/labour", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/timer", lb.Timer)
+        sr.Post("/timer/stop", lb.StopTimer)
+        sr.Put("/entries/{id}", lb.UpdateEntry)
+        sr.Delete("/entries/{id}", lb.DeleteEntry)
+        sr.Get("/timesheet", lb.Timesheet)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Get("/rates", lb.Rates)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Put("/rates", lb.SetRate)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Delete("/rates/{id}", lb.DeleteRate)
+    })
+
+    // PM schedule occurrence logs and forecasts; scanning on demand is admin-only
+    mux.Route("/pm-schedules", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/scan", pms.Scan)
+        sr.Get("/{id}/occurrences", pms.Occurrences)
+        sr.Get("/{id}/forecast", pms.Forecast)
+    })
+
+    // Meter readings, their time series, and the threshold and delta rules acting on them
+    mux.Route("/meters", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Post("/readings", mt.Import)
+        sr.Get("/{id}/readings", mt.Readings)
+        sr.Post("/{id}/readings", mt.Record)
+        sr.Get("/{id}/readings/series", mt.Series)
+        sr.Get("/{id}/rules", mt.Rules)
+        sr.Post("/{id}/rules", mt.CreateRule)
+        sr.Put("/{id}/rules/{rule_id}", mt.UpdateRule)
+        sr.Delete("/{id}/rules/{rule_id}", mt.DeleteRule)
+        sr.Get("/{id}/alerts", mt.Alerts)
+    })
+
+    // Spare parts stock: levels, the movement ledger, reservations, part orders and the low-stock report
+    mux.Route("/inventory", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/stock", inv.Stock)
+        sr.Get("/parts/{id}/stock", inv.PartStock)
+        sr.Get("/movements", inv.Movements)
+        sr.Post("/movements", inv.Move)
+        sr.Get("/reservations", inv.Reservations)
+        sr.Post("/reservations", inv.Reserve)
+        sr.Post("/reservations/{id}/release", inv.Release)
+        sr.Get("/orders", inv.Orders)
+        sr.Post("/orders", inv.CreateOrder)
+        sr.Post("/orders/{id}/cancel", inv.CancelOrder)
+        sr.Get("/low-stock", inv.LowStock)
+    })
+
+    // Org-wide full-text search across all user tables
+    mux.Route("/search", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/", s.Search)
+    })
+
+    // Built-in table templates; provisioning changes the org schema so it is admin-only
+    mux.Route("/templates", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/", tp.List)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Post("/provision", tp.Provision)
+    })
+
+    // Members of team rows, which table grants can name; changing them is admin-only
+    mux.Route("/teams", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Get("/{team_id}/members", tm.Members)
+        sr.With(middleware.RequireRole(r, models.RoleAdmin)).Put("/{team_id}/members", tm.SetMembers)
+    })
+
+    // Org webhooks, their signing secrets and delivery logs are admin-only
+    mux.Route("/webhooks", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Use(middleware.RequireRole(r, models.RoleAdmin))
+        sr.Get("/", wh.List)
+        sr.Post("/", wh.Create)
+        sr.Get("/{id}", wh.Get)
+        sr.Put("/{id}", wh.Update)
+        sr.Delete("/{id}", wh.Delete)
+        sr.Post("/{id}/rotate-secret", wh.RotateSecret)
+        sr.Post("/{id}/ping", wh.Ping)
+        sr.Get("/{id}/deliveries", wh.Deliveries)
+        sr.Post("/{id}/deliveries/{delivery_id}/redeliver", wh.Redeliver)
+    })
+
+    // Automations of user tables and their run logs are admin-only
+    mux.Route("/automations", func(sr chi.Router) {
+        sr.Use(middleware.RequireAuth(r))
+        sr.Use(middleware.RequireRole(r, models.RoleAdmin))
+        sr.Get("/", au.List)
+        sr.Post("/", au.Create)
+        sr.Get("/{id}", au.Get)
+        sr.Put("/{id}", au.Update)
+        sr.Delete("/{id}", au.Delete)
+        sr.Get("/{id}/runs", au.Runs)
+        sr.Post("/{id}/runs/{run_id}/retry", au.Retry)
     })
 
 	// Admin routes
@@ -0,0 +1,68 @@
+// Package search serves the org-wide full-text search over user tables.
+package search
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+const (
+	minQueryLen     = 2
+	maxQueryLen     = 200
+	defaultPerTable = 5
+	maxPerTable     = 50
+)
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// Search handles GET /search?q=<text>&limit=<per table>
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if n := utf8.RuneCountInString(q); n < minQueryLen || n > maxQueryLen {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "q must be between 2 and 200 characters"})
+		return
+	}
+	perTable := defaultPerTable
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerTable {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 50"})
+			return
+		}
+		perTable = n
+	}
+	groups, err := h.repo.SearchOrg(r.Context(), orgID, q, perTable)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "search failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	// Drop groups of tables the caller cannot read
+	perms, err := h.repo.ListTablePermissions(r.Context(), orgID, sess.UserID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "search failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	visible := make([]models.SearchGroup, 0, len(groups))
+	for _, g := range groups {
+		if perms[g.TableID].Read {
+			visible = append(visible, g)
+		}
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"q": q, "results": visible})
+}
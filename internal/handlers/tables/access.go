@@ -0,0 +1,126 @@
+package tables
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+)
+
+// SetColumnAccess handles PUT /tables/{table}/columns/{column}/access with
+// body {"read_role":"Member","edit_role":"Admin","masked":true} and replaces
+// the column's field-level rules. Empty roles lift the restriction.
+func (h *Handler) SetColumnAccess(w http.ResponseWriter, r *http.Request) {
+	orgID, table, _, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	column := chi.URLParam(r, "column")
+	if column == "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing column"})
+		return
+	}
+	defer r.Body.Close()
+	var access models.ColumnAccess
+	if !httpserver.Decode(w, r, &access) {
+		return
+	}
+	rules := &access
+	if access == (models.ColumnAccess{}) {
+		rules = nil
+	}
+	if msg := checkAccess(rules); msg != "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	found, err := h.repo.SetColumnAccess(r.Context(), orgID, table, column, rules)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "column not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"column": column, "access": rules})
+}
+
+// checkAccess validates field-level rules. Rules stop at Admin so the people
+// managing a schema always see all of it.
+func checkAccess(a *models.ColumnAccess) string {
+	if a == nil {
+		return ""
+	}
+	for _, role := range []models.OrgRole{a.ReadRole, a.EditRole} {
+		switch role {
+		case "", models.RoleViewer, models.RoleMember, models.RoleAdmin:
+		default:
+			return "read_role and edit_role must be Viewer, Member or Admin"
+		}
+	}
+	return ""
+}
+
+// checkSearchFields rejects filters and sorts on fields the caller cannot
+// see in full, since matching rows would reveal hidden values, and filters
+// on uuid columns with values that are not row ids.
+func checkSearchFields(body map[string]any, schema []models.TableColumn) string {
+	visible := make(map[string]bool, len(schema))
+	refs := make(map[string]bool)
+	for _, c := range schema {
+		if c.FieldAccess != models.FieldMasked {
+			visible[c.Name] = true
+		}
+		if c.Type == "uuid" && c.Kind == "value" {
+			refs[c.Name] = true
+		}
+	}
+	if filters, ok := body["filterFields"].([]any); ok {
+		for _, f := range filters {
+			m, _ := f.(map[string]any)
+			name, _ := m["field"].(string)
+			if !visible[strings.ToLower(name)] {
+				return fmt.Sprintf("cannot filter on %q", name)
+			}
+			if refs[strings.ToLower(name)] && !rowIDFilter(m) {
+				return fmt.Sprintf("filter on %q needs row ids", name)
+			}
+		}
+	}
+	name, _ := body["sortField"].(string)
+	switch strings.ToLower(name) {
+	case "", "id", "created_at":
+		return ""
+	}
+	if !visible[strings.ToLower(name)] {
+		return fmt.Sprintf("cannot sort on %q", name)
+	}
+	return ""
+}
+
+// rowIDFilter reports whether a filter on a uuid column holds row ids: a
+// "value" for eq (the default) and under, "values" for in.
+func rowIDFilter(f map[string]any) bool {
+	op, _ := f["operation"].(string)
+	switch op {
+	case "", "eq", "under":
+		v, _ := f["value"].(string)
+		_, err := uuid.Parse(v)
+		return err == nil
+	case "in":
+		vs, _ := f["values"].([]any)
+		for _, v := range vs {
+			s, _ := v.(string)
+			if _, err := uuid.Parse(s); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
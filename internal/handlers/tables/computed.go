@@ -0,0 +1,150 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/formula"
+	"yourapp/internal/models"
+)
+
+// validationError carries a message that is safe to return to API clients.
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// prepareComputed validates a computed column definition against the table's
+// current schema, fills in the inferred type and the compiled SQL.
+func (h *Handler) prepareComputed(ctx context.Context, orgID uuid.UUID, table string, input *models.TableColumnInput) error {
+	if strings.TrimSpace(input.Expression) == "" {
+		return validationError("expression is required for computed columns")
+	}
+	if input.Required || input.Indexed || input.IsReference {
+		return validationError("computed columns cannot be required, indexed or references")
+	}
+	schema, err := h.repo.GetUserTableSchema(ctx, orgID, table)
+	if err != nil {
+		return err
+	}
+	cols := make(map[string]formula.Type, len(schema))
+	for _, c := range schema {
+		if t, ok := formula.TypeOfColumn(c.Type); ok {
+			cols[strings.ToLower(c.Name)] = t
+		}
+	}
+	compiled, err := formula.Compile(input.Expression, cols)
+	if err != nil {
+		return validationError("invalid expression: " + err.Error())
+	}
+	inferred := compiled.Type.ColumnType()
+	if input.Type != "" && input.Type != inferred {
+		return validationError(fmt.Sprintf("expression evaluates to %s, not %s", inferred, input.Type))
+	}
+	input.Type = inferred
+	input.EnumValues = nil
+	input.ExpressionSQL = compiled.SQL
+	return nil
+}
+
+// computedDependents lists computed columns whose expressions reference column.
+func computedDependents(schema []models.TableColumn, column string) []string {
+	column = strings.ToLower(column)
+	var out []string
+	for _, c := range schema {
+		if c.Kind != "computed" {
+			continue
+		}
+		for _, ref := range formula.References(c.Expression) {
+			if ref == column {
+				out = append(out, c.Name)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// checkDerivedFilters checks the values of eq filters on computed and rollup
+// columns, which the search casts to the column's type, and rewrites them
+// in the form the cast takes: "12.5" becomes 12.5 on a float column. It
+// returns a message for the caller when a value does not fit.
+func checkDerivedFilters(body map[string]any, schema []models.TableColumn) string {
+	types := make(map[string]string)
+	for _, c := range schema {
+		if c.Kind == "computed" || c.Kind == "rollup" {
+			types[c.Name] = c.Type
+		}
+	}
+	filters, _ := body["filterFields"].([]any)
+	for _, f := range filters {
+		m, _ := f.(map[string]any)
+		name, _ := m["field"].(string)
+		typ, ok := types[strings.ToLower(name)]
+		if !ok || m["value"] == nil {
+			continue
+		}
+		if op, _ := m["operation"].(string); op != "" && op != "eq" {
+			continue
+		}
+		v, ok := filterValue(m["value"], typ)
+		if !ok {
+			return fmt.Sprintf("filter on %q: value must be a %s", name, filterTypes[typ])
+		}
+		m["value"] = v
+	}
+	return ""
+}
+
+// filterTypes names the values filters on each column type take.
+var filterTypes = map[string]string{
+	"float": "number",
+	"bool":  "boolean",
+	"date":  "date (YYYY-MM-DD)",
+}
+
+// filterValue converts a filter value to the type of a column; false when
+// it has no value of that type. Text values are left alone.
+func filterValue(v any, typ string) (any, bool) {
+	switch typ {
+	case "float":
+		var f float64
+		switch x := v.(type) {
+		case float64:
+			f = x
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, false
+		}
+		return f, true
+	case "bool":
+		switch x := v.(type) {
+		case bool:
+			return x, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			return b, err == nil
+		}
+		return nil, false
+	case "date":
+		s, _ := v.(string)
+		d, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+		if err != nil {
+			return nil, false
+		}
+		return d.Format("2006-01-02"), true
+	}
+	return v, true
+}
@@ -0,0 +1,88 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/checklists"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// emitSchema records a table or column event carrying v as its data. r
+// should be the transaction making the change, so the event and its webhook
+// deliveries are only queued when the change commits.
+func emitSchema(ctx context.Context, r repo.Repo, orgID uuid.UUID, event string, tableID int64, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.EmitSchemaEvent(ctx, orgID, event, tableID, data)
+}
+
+// writeRowError answers a failed row write. A change a state machine does
+// not allow answers 422, or 403 when only the caller's role is missing.
+// When a sync automation failed, the change was rolled back together with
+// its run, so the failure is logged as a run of its own before answering
+// 422 with the automation's name.
+func (h *Handler) writeRowError(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, err error, fallback string) {
+	var refused *workflow.Error
+	if errors.As(err, &refused) {
+		status := http.StatusUnprocessableEntity
+		if refused.Forbidden {
+			status = http.StatusForbidden
+		}
+		resp := map[string]any{"error": refused.Error(), "column": refused.Column, "to": refused.To}
+		if !refused.New {
+			resp["from"] = refused.From
+		}
+		if refused.Allowed != nil {
+			resp["allowed"] = refused.Allowed
+		}
+		if len(refused.Missing) > 0 {
+			resp["missing"] = refused.Missing
+		}
+		httpserver.JSON(w, status, resp)
+		return
+	}
+	var open *checklists.Error
+	if errors.As(err, &open) {
+		httpserver.JSON(w, http.StatusUnprocessableEntity, map[string]string{"error": open.Msg})
+		return
+	}
+	var failed *automations.Error
+	if !errors.As(err, &failed) {
+		status, msg := httpserver.PGErrorMessage(err, fallback)
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	msg := failed.Err.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	run := models.AutomationRun{
+		AutomationID: failed.AutomationID,
+		RowID:        &failed.RowID,
+		Mode:         models.AutomationSync,
+		Status:       models.RunFailed,
+		Depth:        failed.Depth,
+		Error:        msg,
+	}
+	if _, err := h.repo.InsertAutomationRun(r.Context(), orgID, run); err != nil {
+		slog.ErrorContext(r.Context(), "log failed automation run failed", "automation_id", failed.AutomationID.String(), "err", err)
+	}
+	_, reason := httpserver.PGErrorMessage(failed.Err, "an action failed")
+	httpserver.JSON(w, http.StatusUnprocessableEntity, map[string]string{
+		"error":      fmt.Sprintf("automation %q failed: %s", failed.Name, reason),
+		"automation": failed.Name,
+	})
+}
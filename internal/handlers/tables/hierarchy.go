@@ -0,0 +1,263 @@
+package tables
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// Subtree size limits: nodes returned by default and at most.
+const (
+	defaultSubtreeNodes = 1000
+	maxSubtreeNodes     = 10000
+)
+
+// GetHierarchy handles GET /tables/{table}/hierarchy: the column holding the
+// parent of each row, if the table has one.
+func (h *Handler) GetHierarchy(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	hier, ok := h.hierarchy(w, r, orgID, tableID)
+	if !ok {
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"hierarchy": hier})
+}
+
+// PutHierarchy handles PUT /tables/{table}/hierarchy with body
+// {"column":"parent_asset"}: the column, a uuid column referencing the
+// table itself, becomes the parent of each row. Refused while the column's
+// values hold a cycle.
+func (h *Handler) PutHierarchy(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		Column string `json:"column"`
+	}
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	if body.Column == "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing column"})
+		return
+	}
+	valid, cycle, err := h.repo.PutHierarchy(r.Context(), orgID, tableID, body.Column)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !valid {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "column must be a uuid column referencing this table"})
+		return
+	}
+	if cycle != uuid.Nil {
+		httpserver.JSON(w, http.StatusConflict, map[string]any{
+			"error": "row " + cycle.String() + " is its own ancestor through " + body.Column + "; change its parent first",
+			"row":   cycle,
+		})
+		return
+	}
+	hier, ok := h.hierarchy(w, r, orgID, tableID)
+	if !ok {
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"hierarchy": hier})
+}
+
+// DeleteHierarchy handles DELETE /tables/{table}/hierarchy; the parent
+// column and its values are kept.
+func (h *Handler) DeleteHierarchy(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteHierarchy(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "table has no hierarchy"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+// Subtree handles GET /tables/{table}/rows/{row_id}/subtree?depth=&limit=:
+// the row and the rows below it, nearest levels first, each with its
+// parent, depth and label. Rows the caller cannot see are left out with
+// everything below them.
+func (h *Handler) Subtree(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	rid, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	depth, limit := 0, defaultSubtreeNodes
+	if v := r.URL.Query().Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "depth must be a positive number"})
+			return
+		}
+		depth = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSubtreeNodes {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and " + strconv.Itoa(maxSubtreeNodes)})
+			return
+		}
+		limit = n
+	}
+	hier, ok := h.hierarchy(w, r, orgID, tableID)
+	if !ok {
+		return
+	}
+	tree, found, err := h.repo.RowSubtree(r.Context(), hier, rid, depth, limit)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, tree)
+}
+
+// Ancestors handles GET /tables/{table}/rows/{row_id}/ancestors: the rows
+// above the row, the root first, for breadcrumbs. The list starts below the
+// nearest ancestor the caller cannot see.
+func (h *Handler) Ancestors(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	rid, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	hier, ok := h.hierarchy(w, r, orgID, tableID)
+	if !ok {
+		return
+	}
+	chain, found, err := h.repo.RowAncestors(r.Context(), hier, rid)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"ancestors": chain})
+}
+
+// Move handles POST /tables/{table}/rows/{row_id}/move with body
+// {"parent":"<row id>"} or {"parent":null} for a root: sets the row's
+// parent like an update of the parent column would, refusing to place a
+// row under itself or one of its descendants.
+func (h *Handler) Move(w http.ResponseWriter, r *http.Request) {
+	orgID, table, tableID, _, ok := h.authorize(w, r, canEdit)
+	if !ok {
+		return
+	}
+	rid, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body map[string]any
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	raw, present := body["parent"]
+	if !present {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "parent is required, null for a root"})
+		return
+	}
+	hier, ok := h.hierarchy(w, r, orgID, tableID)
+	if !ok {
+		return
+	}
+	var parent any
+	if raw != nil {
+		s, _ := raw.(string)
+		pid, err := uuid.Parse(s)
+		if err != nil {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "parent must be a row id or null"})
+			return
+		}
+		// The new parent must be a row of the table the caller sees
+		_, visible, err := h.repo.RowAncestors(r.Context(), hier, pid)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		if !visible {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "parent not found"})
+			return
+		}
+		parent = pid.String()
+	}
+	var row models.TableRow
+	var found bool
+	err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		values, err := workflow.Apply(r.Context(), tx, orgID, callerID(r), tableID, rid, map[string]any{hier.Column: parent})
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		row, found, err = automations.UpdateRow(r.Context(), tx, orgID, tableID, table, rid, payload)
+		return err
+	})
+	if err != nil {
+		h.writeRowError(w, r, orgID, err, "move failed")
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"row": row})
+}
+
+// hierarchy returns the table's hierarchy, writing 404 when it has none.
+func (h *Handler) hierarchy(w http.ResponseWriter, r *http.Request, orgID uuid.UUID, tableID int64) (models.Hierarchy, bool) {
+	hier, found, err := h.repo.GetHierarchy(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.Hierarchy{}, false
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "table has no hierarchy"})
+		return models.Hierarchy{}, false
+	}
+	return hier, true
+}
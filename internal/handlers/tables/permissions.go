@@ -0,0 +1,178 @@
+package tables
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// A right picks one permission out of TablePermissions.
+type right func(models.TablePermissions) bool
+
+var (
+	canRead   right = func(p models.TablePermissions) bool { return p.Read }
+	canCreate right = func(p models.TablePermissions) bool { return p.CreateRow }
+	canEdit   right = func(p models.TablePermissions) bool { return p.EditRow }
+	canDelete right = func(p models.TablePermissions) bool { return p.DeleteRow }
+	canManage right = func(p models.TablePermissions) bool { return p.ManageSchema }
+)
+
+// callerID returns the user of a request that passed httpserver.Caller or
+// authorize.
+func callerID(r *http.Request) uuid.UUID {
+	if sess, _ := auth.SessionFromContext(r.Context()); sess != nil {
+		return sess.UserID
+	}
+	return uuid.Nil
+}
+
+// authorize checks the caller's rights on the {table} URL parameter. Tables
+// the caller cannot read are reported as not found, so their names don't
+// leak; readable tables without the right answer 403.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, allow right) (uuid.UUID, string, int64, models.TablePermissions, bool) {
+	orgID, sess, ok := httpserver.Caller(w, r)
+	if !ok {
+		return uuid.Nil, "", 0, models.TablePermissions{}, false
+	}
+	table := chi.URLParam(r, "table")
+	if table == "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
+		return uuid.Nil, "", 0, models.TablePermissions{}, false
+	}
+	tableID, perms, found, err := h.repo.GetTablePermissions(r.Context(), orgID, sess.UserID, table)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "permission check failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return uuid.Nil, "", 0, models.TablePermissions{}, false
+	}
+	if !found || !perms.Read {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "table not found"})
+		return uuid.Nil, "", 0, models.TablePermissions{}, false
+	}
+	if !allow(perms) {
+		httpserver.JSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return uuid.Nil, "", 0, models.TablePermissions{}, false
+	}
+	return orgID, table, tableID, perms, true
+}
+
+// readableTables returns the caller's rights on every table they can read.
+func (h *Handler) readableTables(r *http.Request, orgID uuid.UUID) (map[int64]models.TablePermissions, error) {
+	sess, _ := auth.SessionFromContext(r.Context())
+	if sess == nil {
+		return map[int64]models.TablePermissions{}, nil
+	}
+	all, err := h.repo.ListTablePermissions(r.Context(), orgID, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for id, p := range all {
+		if !p.Read {
+			delete(all, id)
+		}
+	}
+	return all, nil
+}
+
+// GetPermissions handles GET /tables/{table}/permissions: the caller's rights,
+// plus the table's grants for callers who manage it. No grants means the
+// role defaults apply.
+func (h *Handler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, perms, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	resp := map[string]any{"permissions": perms}
+	if perms.ManageSchema {
+		grants, err := h.repo.ListTableGrants(r.Context(), orgID, tableID)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		resp["grants"] = grants
+		resp["defaults"] = len(grants) == 0
+	}
+	httpserver.JSON(w, http.StatusOK, resp)
+}
+
+// PutPermissions handles PUT /tables/{table}/permissions with body
+// {"grants":[{"role":"Member","read":true,...},{"user_id":"..."},{"team_id":"..."}]}
+// and replaces every grant of the table. An empty list restores the role
+// defaults.
+func (h *Handler) PutPermissions(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		Grants []models.TableGrant `json:"grants"`
+	}
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	for i := range body.Grants {
+		if msg := checkGrant(&body.Grants[i]); msg != "" {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]any{"error": msg, "index": i})
+			return
+		}
+	}
+	err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		if err := tx.ClearTableGrants(r.Context(), orgID, tableID); err != nil {
+			return err
+		}
+		for _, g := range body.Grants {
+			if err := tx.AddTableGrant(r.Context(), orgID, tableID, g); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	grants, err := h.repo.ListTableGrants(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"grants": grants, "defaults": len(grants) == 0})
+}
+
+// checkGrant validates a grant from a request body and normalises it: every
+// right implies read. It returns a message for the client when invalid.
+func checkGrant(g *models.TableGrant) string {
+	principals := 0
+	if g.Role != "" {
+		principals++
+		switch g.Role {
+		case models.RoleViewer, models.RoleMember, models.RoleAdmin, models.RoleOwner:
+		default:
+			return "role must be Viewer, Member, Admin or Owner"
+		}
+	}
+	if g.UserID != nil {
+		principals++
+	}
+	if g.TeamID != nil {
+		principals++
+	}
+	if principals != 1 {
+		return "each grant needs exactly one of role, user_id or team_id"
+	}
+	g.UserEmail = ""
+	if g.CreateRow || g.EditRow || g.DeleteRow || g.ManageSchema {
+		g.Read = true
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package tables
+
+import (
+	"net/http"
+	"strings"
+
+	"yourapp/internal/formula"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// GetPolicies handles GET /tables/{table}/policies: the table's row-level
+// sharing policies.
+func (h *Handler) GetPolicies(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	policies, err := h.repo.ListRowPolicies(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"policies": policies})
+}
+
+// PutPolicies handles PUT /tables/{table}/policies with body
+// {"policies":[{"name":"own team","role":"Member","expression":"team IN current_user.teams"}]}
+// and replaces every policy of the table. An empty list lifts all row
+// restrictions.
+func (h *Handler) PutPolicies(w http.ResponseWriter, r *http.Request) {
+	orgID, table, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		Policies []models.RowPolicy `json:"policies"`
+	}
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, table)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	cols := make(map[string]formula.Type, len(schema))
+	for _, c := range schema {
+		if c.FieldAccess == models.FieldMasked {
+			continue
+		}
+		if t, ok := formula.TypeOfColumn(c.Type); ok {
+			cols[strings.ToLower(c.Name)] = t
+		}
+	}
+	names := make(map[string]bool, len(body.Policies))
+	for i := range body.Policies {
+		p := &body.Policies[i]
+		if msg := checkPolicy(p, cols); msg != "" {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]any{"error": msg, "index": i})
+			return
+		}
+		if names[strings.ToLower(p.Name)] {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]any{"error": "duplicate policy name", "index": i})
+			return
+		}
+		names[strings.ToLower(p.Name)] = true
+	}
+	err = h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		if err := tx.ClearRowPolicies(r.Context(), orgID, tableID); err != nil {
+			return err
+		}
+		for _, p := range body.Policies {
+			if err := tx.AddRowPolicy(r.Context(), orgID, tableID, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	policies, err := h.repo.ListRowPolicies(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"policies": policies})
+}
+
+// checkPolicy validates a policy from a request body against the columns the
+// caller sees in full, and compiles its condition. It returns a message for
+// the client when invalid.
+func checkPolicy(p *models.RowPolicy, cols map[string]formula.Type) string {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > 100 {
+		return "name is required (at most 100 characters)"
+	}
+	principals := 0
+	if p.Role != "" {
+		principals++
+		switch p.Role {
+		case models.RoleViewer, models.RoleMember:
+		default:
+			return "role must be Viewer or Member; Admins and Owners see every row"
+		}
+	}
+	if p.UserID != nil {
+		principals++
+	}
+	if p.TeamID != nil {
+		principals++
+	}
+	if principals != 1 {
+		return "each policy needs exactly one of role, user_id or team_id"
+	}
+	compiled, err := formula.CompilePolicy(p.Expression, cols)
+	if err != nil {
+		return "invalid expression: " + err.Error()
+	}
+	p.UserEmail = ""
+	p.ExpressionSQL = compiled.SQL
+	p.Refs = compiled.Refs
+	return ""
+}
@@ -0,0 +1,137 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+)
+
+// rollupResultType gives the column type a rollup produces for an aggregate
+// over a target column of targetType.
+func rollupResultType(aggregate, targetType string) (string, error) {
+	switch aggregate {
+	case "count":
+		return "float", nil
+	case "sum":
+		if targetType != "float" {
+			return "", fmt.Errorf("sum needs a float target, got %s", targetType)
+		}
+		return "float", nil
+	case "any", "all":
+		if targetType != "bool" {
+			return "", fmt.Errorf("%s needs a bool target, got %s", aggregate, targetType)
+		}
+		return "bool", nil
+	case "min", "max", "latest":
+		switch targetType {
+		case "float", "date", "bool", "text":
+			if targetType == "bool" && aggregate != "latest" {
+				return "", fmt.Errorf("%s does not apply to bool", aggregate)
+			}
+			return targetType, nil
+		case "enum", "uuid":
+			return "text", nil
+		}
+		return "", fmt.Errorf("unsupported target type %s", targetType)
+	}
+	return "", fmt.Errorf("aggregate must be one of count, sum, min, max, latest, any, all")
+}
+
+func findColumn(schema []models.TableColumn, name string) (models.TableColumn, bool) {
+	for _, c := range schema {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return models.TableColumn{}, false
+}
+
+// prepareRollup validates a rollup column definition and resolves the child
+// columns it aggregates over.
+func (h *Handler) prepareRollup(ctx context.Context, orgID uuid.UUID, table string, input *models.TableColumnInput) error {
+	spec := input.Rollup
+	if spec == nil || spec.Table == "" || spec.Via == "" || spec.Aggregate == "" {
+		return validationError("rollup.table, rollup.via and rollup.aggregate are required for rollup columns")
+	}
+	if input.Required || input.Indexed || input.IsReference {
+		return validationError("rollup columns cannot be required, indexed or references")
+	}
+	spec.Aggregate = strings.ToLower(spec.Aggregate)
+
+	child, err := h.repo.GetUserTableSchema(ctx, orgID, spec.Table)
+	if err != nil {
+		return err
+	}
+	if len(child) == 0 {
+		return validationError(fmt.Sprintf("rollup table %q not found or has no columns", spec.Table))
+	}
+
+	via, ok := findColumn(child, spec.Via)
+	if !ok || via.Type != "uuid" || via.Kind != "value" {
+		return validationError(fmt.Sprintf("rollup.via must be a uuid column on %s", spec.Table))
+	}
+	if via.ReferenceTableID != nil {
+		tables, err := h.repo.ListUserTables(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if t.Slug == strings.ToLower(table) || strings.EqualFold(t.Name, table) {
+				if *via.ReferenceTableID != t.ID {
+					return validationError(fmt.Sprintf("rollup.via %s does not reference %s", via.Name, table))
+				}
+				break
+			}
+		}
+	}
+	input.RollupViaColumnID = via.ID
+	spec.Via = via.Name
+
+	targetType := ""
+	input.RollupTargetColumnID = 0
+	if spec.Aggregate != "count" {
+		if spec.Target == "" {
+			return validationError(fmt.Sprintf("rollup.target is required for %s", spec.Aggregate))
+		}
+		target, ok := findColumn(child, spec.Target)
+		if !ok {
+			return validationError(fmt.Sprintf("rollup.target %q not found on %s", spec.Target, spec.Table))
+		}
+		if target.Kind == "rollup" {
+			return validationError("rollup.target cannot be another rollup column")
+		}
+		input.RollupTargetColumnID = target.ID
+		spec.Target = target.Name
+		targetType = target.Type
+	} else {
+		spec.Target = ""
+	}
+
+	for i, f := range spec.Filter {
+		c, ok := findColumn(child, f.Field)
+		if !ok {
+			return validationError(fmt.Sprintf("rollup.filter field %q not found on %s", f.Field, spec.Table))
+		}
+		switch f.Operation {
+		case "", "eq", "cn", "in":
+		default:
+			return validationError("rollup.filter operation must be eq, cn or in")
+		}
+		spec.Filter[i].Field = c.Name
+	}
+
+	resultType, err := rollupResultType(spec.Aggregate, targetType)
+	if err != nil {
+		return validationError("invalid rollup: " + err.Error())
+	}
+	if input.Type != "" && input.Type != resultType {
+		return validationError(fmt.Sprintf("rollup evaluates to %s, not %s", resultType, input.Type))
+	}
+	input.Type = resultType
+	input.EnumValues = nil
+	return nil
+}
@@ -0,0 +1,562 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"yourapp/internal/formula"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+const schemaDocumentVersion = 1
+
+// Mirror the slug/column-name normalisation in CreateUserTable and
+// AddUserTableColumn so documents compare against stored names.
+var (
+	slugRE    = regexp.MustCompile(`[^a-z0-9]+`)
+	colNameRE = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+func tableSlug(name string) string {
+	return strings.Trim(slugRE.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func columnName(name string) string {
+	return strings.Trim(colNameRE.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// ExportSchema handles GET /tables/schema/export[?format=yaml] and returns
+// every table and column definition of the org.
+func (h *Handler) ExportSchema(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	doc, err := exportSchema(r.Context(), h.repo, orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "export failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if r.URL.Query().Get("format") == "yaml" {
+		out, err := toYAML(doc)
+		if err != nil {
+			httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "export failed"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(out)
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, doc)
+}
+
+// ImportSchema handles POST /tables/schema/import[?apply=true][&prune=true].
+// The body is a document from ExportSchema (JSON, or YAML when the
+// Content-Type says so). Without apply it only returns the plan; with apply
+// the whole plan runs in one transaction. Tables and columns missing from the
+// document are removed only when prune is set.
+func (h *Handler) ImportSchema(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "body too large"})
+		return
+	}
+	var doc models.SchemaDocument
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") || r.URL.Query().Get("format") == "yaml" {
+		err = fromYAML(raw, &doc)
+	} else {
+		err = json.Unmarshal(raw, &doc)
+	}
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid schema document"})
+		return
+	}
+	if doc.Version != 0 && doc.Version != schemaDocumentVersion {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unsupported schema document version %d", doc.Version)})
+		return
+	}
+	q := r.URL.Query()
+	apply, prune := q.Get("apply") == "true", q.Get("prune") == "true"
+
+	current, err := exportSchema(r.Context(), h.repo, orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "import failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	p := planSchema(current, doc, prune)
+	if !apply {
+		httpserver.JSON(w, http.StatusOK, p.plan)
+		return
+	}
+	if len(p.plan.Conflicts) > 0 {
+		httpserver.JSON(w, http.StatusConflict, p.plan)
+		return
+	}
+	err = h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		return p.apply(r.Context(), &Handler{repo: tx}, orgID)
+	})
+	if err != nil {
+		var verr validationError
+		if errors.As(err, &verr) {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": verr.Error()})
+			return
+		}
+		status, msg := httpserver.PGErrorMessage(err, "import failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	p.plan.Applied = true
+	httpserver.JSON(w, http.StatusOK, p.plan)
+}
+
+// exportSchema builds the portable definition of every org table, ordered by
+// creation so referenced tables tend to precede the tables using them.
+func exportSchema(ctx context.Context, r repo.Repo, orgID uuid.UUID) (models.SchemaDocument, error) {
+	tables, err := r.ListUserTables(ctx, orgID)
+	if err != nil {
+		return models.SchemaDocument{}, err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].ID < tables[j].ID })
+	slugs := make(map[int64]string, len(tables))
+	for _, t := range tables {
+		slugs[t.ID] = t.Slug
+	}
+	doc := models.SchemaDocument{Version: schemaDocumentVersion, Tables: make([]models.SchemaTable, 0, len(tables))}
+	for _, t := range tables {
+		cols, err := r.GetUserTableSchema(ctx, orgID, t.Slug)
+		if err != nil {
+			return models.SchemaDocument{}, err
+		}
+		st := models.SchemaTable{Name: t.Name, Slug: t.Slug, Columns: make([]models.TableColumnInput, 0, len(cols))}
+		for _, c := range cols {
+			in := models.TableColumnInput{
+				Name:                  c.Name,
+				Type:                  c.Type,
+				Required:              c.Required,
+				Indexed:               c.Indexed,
+				EnumValues:            c.EnumValues,
+				IsReference:           c.IsReference,
+				RequireDifferentTable: c.RequireDifferentTable,
+				Kind:                  c.Kind,
+				Expression:            c.Expression,
+				Rollup:                c.Rollup,
+				Access:                c.Access,
+			}
+			if c.ReferenceTableID != nil {
+				in.ReferenceTable = slugs[*c.ReferenceTableID]
+			}
+			st.Columns = append(st.Columns, in)
+		}
+		doc.Tables = append(doc.Tables, st)
+	}
+	return doc, nil
+}
+
+// schemaPlan is a computed import plan plus the steps that carry it out.
+type schemaPlan struct {
+	plan models.SchemaPlan
+
+	removeDerived []tableColumn
+	removeValue   []tableColumn
+	removeTables  []string
+	addTables     []string
+	addValue      []tableColumn
+	updateValue   []tableColumn
+	addDerived    []tableColumn // computed after what they read, see planSchema
+	setAccess     []tableColumn // field-level rules, applied last
+}
+
+type tableColumn struct {
+	table string
+	col   models.TableColumnInput
+}
+
+var columnTypes = []string{"text", "date", "bool", "enum", "uuid", "float"}
+
+func isDerived(kind string) bool { return kind == "computed" || kind == "rollup" }
+
+// planSchema compares the desired document with the current export.
+func planSchema(current, desired models.SchemaDocument, prune bool) *schemaPlan {
+	p := &schemaPlan{plan: models.SchemaPlan{Changes: []models.SchemaChange{}}}
+	conflict := func(format string, args ...any) {
+		p.plan.Conflicts = append(p.plan.Conflicts, fmt.Sprintf(format, args...))
+	}
+	change := func(action, table, column string, detail ...string) {
+		p.plan.Changes = append(p.plan.Changes, models.SchemaChange{Action: action, Table: table, Column: column, Detail: detail})
+	}
+
+	have := make(map[string]models.SchemaTable, len(current.Tables))
+	for _, t := range current.Tables {
+		have[t.Slug] = t
+	}
+	want := make(map[string]bool, len(desired.Tables))
+	for i := range desired.Tables {
+		t := &desired.Tables[i]
+		slug := tableSlug(t.Name)
+		given := t.Slug
+		t.Slug = "" // tables left without a slug are skipped below
+		switch {
+		case slug == "":
+			conflict("table %q: name is required", t.Name)
+			continue
+		case given != "" && given != slug:
+			conflict("table %q: slug %q does not match its name (expected %q)", t.Name, given, slug)
+			continue
+		case want[slug]:
+			conflict("table %q: listed more than once", slug)
+			continue
+		}
+		t.Slug = slug
+		want[slug] = true
+	}
+
+	var computed, rollups []tableColumn
+	tableIndex := make(map[string]int, len(desired.Tables))
+	rank := map[string]int{}         // "table.column" -> position among its table's computed columns
+	lateColumns := map[string]bool{} // "table.column" of computed columns reading a new rollup
+	for i, t := range desired.Tables {
+		if !want[t.Slug] {
+			continue
+		}
+		tableIndex[t.Slug] = i
+		exprs := map[string]string{}
+		newRollups := map[string]bool{}
+		cur, exists := have[t.Slug]
+		if !exists {
+			change("add_table", t.Slug, "")
+			p.addTables = append(p.addTables, t.Name)
+		}
+		curCols := make(map[string]models.TableColumnInput, len(cur.Columns))
+		for _, c := range cur.Columns {
+			curCols[c.Name] = c
+		}
+		names := make(map[string]bool, len(t.Columns))
+		for _, c := range t.Columns {
+			names[columnName(c.Name)] = true
+		}
+		seen := make(map[string]bool, len(t.Columns))
+		for _, c := range t.Columns {
+			c.Name = columnName(c.Name)
+			if c.Kind == "" {
+				c.Kind = "value"
+			}
+			switch {
+			case c.Name == "":
+				conflict("%s: column without a name", t.Slug)
+				continue
+			case seen[c.Name]:
+				conflict("%s.%s: listed more than once", t.Slug, c.Name)
+				continue
+			case c.Kind != "value" && !isDerived(c.Kind):
+				conflict("%s.%s: kind must be value, computed or rollup", t.Slug, c.Name)
+				continue
+			case c.Kind == "value" && !slices.Contains(columnTypes, c.Type):
+				conflict("%s.%s: type must be one of %s", t.Slug, c.Name, strings.Join(columnTypes, ", "))
+				continue
+			case c.IsReference && c.ReferenceTable != "" && !want[c.ReferenceTable] && (prune || have[c.ReferenceTable].Slug == ""):
+				conflict("%s.%s: referenced table %q is not in the document", t.Slug, c.Name, c.ReferenceTable)
+				continue
+			}
+			if msg := checkAccess(c.Access); msg != "" {
+				conflict("%s.%s: %s", t.Slug, c.Name, msg)
+				continue
+			}
+			seen[c.Name] = true
+			if c.Kind == "computed" {
+				for _, ref := range formula.References(c.Expression) {
+					if !names[ref] {
+						conflict("%s.%s: expression uses %q which is not in the document", t.Slug, c.Name, ref)
+					}
+				}
+				exprs[c.Name] = c.Expression
+			}
+			tc := tableColumn{table: t.Slug, col: c}
+
+			old, ok := curCols[c.Name]
+			if d := accessDiff(old.Access, c.Access); d != "" {
+				p.setAccess = append(p.setAccess, tc)
+				if ok {
+					change("change_access", t.Slug, c.Name, d)
+				}
+			}
+			if !ok {
+				change("add_column", t.Slug, c.Name)
+				if isDerived(c.Kind) {
+					if c.Kind == "computed" {
+						computed = append(computed, tc)
+					} else {
+						rollups = append(rollups, tc)
+						newRollups[c.Name] = true
+					}
+				} else {
+					p.addValue = append(p.addValue, tc)
+				}
+				continue
+			}
+			if old.Kind != c.Kind && (!isDerived(old.Kind) || !isDerived(c.Kind)) {
+				conflict("%s.%s: changing kind from %s to %s is not supported", t.Slug, c.Name, old.Kind, c.Kind)
+				continue
+			}
+			if isDerived(c.Kind) {
+				if diff := derivedDiff(old, c); len(diff) > 0 {
+					change("change_column", t.Slug, c.Name, diff...)
+					if c.Access != nil && accessDiff(old.Access, c.Access) == "" {
+						p.setAccess = append(p.setAccess, tc) // re-created without its rules
+					}
+					p.removeDerived = append(p.removeDerived, tc)
+					if c.Kind == "computed" {
+						computed = append(computed, tc)
+					} else {
+						rollups = append(rollups, tc)
+						newRollups[c.Name] = true
+					}
+				}
+				continue
+			}
+			if old.Type != c.Type {
+				conflict("%s.%s: changing type from %s to %s is not supported", t.Slug, c.Name, old.Type, c.Type)
+				continue
+			}
+			if old.IsReference != c.IsReference || old.ReferenceTable != c.ReferenceTable {
+				conflict("%s.%s: changing the referenced table is not supported", t.Slug, c.Name)
+				continue
+			}
+			if diff := valueDiff(old, c); len(diff) > 0 {
+				change("change_column", t.Slug, c.Name, diff...)
+				p.updateValue = append(p.updateValue, tc)
+			}
+		}
+		// A computed column is evaluated over the columns before it, so it
+		// is added after the computed columns it reads and, when it reads a
+		// rollup being added (directly or through another computed column),
+		// after the rollups.
+		order, err := formula.Order(exprs)
+		if err != nil {
+			conflict("%s: %s", t.Slug, err)
+		}
+		for i, name := range order {
+			rank[t.Slug+"."+name] = i
+			for _, ref := range formula.References(exprs[name]) {
+				if newRollups[ref] || lateColumns[t.Slug+"."+ref] {
+					lateColumns[t.Slug+"."+name] = true
+				}
+			}
+		}
+		if prune && exists {
+			for _, c := range cur.Columns {
+				if seen[c.Name] {
+					continue
+				}
+				change("remove_column", t.Slug, c.Name)
+				if isDerived(c.Kind) {
+					p.removeDerived = append(p.removeDerived, tableColumn{table: t.Slug, col: c})
+				} else {
+					p.removeValue = append(p.removeValue, tableColumn{table: t.Slug, col: c})
+				}
+			}
+		}
+	}
+	if prune {
+		for _, t := range current.Tables {
+			if !want[t.Slug] {
+				change("remove_table", t.Slug, "")
+				p.removeTables = append(p.removeTables, t.Slug)
+			}
+		}
+	}
+	slices.SortStableFunc(computed, func(a, b tableColumn) int {
+		if a.table != b.table {
+			return tableIndex[a.table] - tableIndex[b.table]
+		}
+		return rank[a.table+"."+a.col.Name] - rank[b.table+"."+b.col.Name]
+	})
+	var late []tableColumn
+	for _, tc := range computed {
+		if lateColumns[tc.table+"."+tc.col.Name] {
+			late = append(late, tc)
+		} else {
+			p.addDerived = append(p.addDerived, tc)
+		}
+	}
+	p.addDerived = slices.Concat(p.addDerived, rollups, late)
+	return p
+}
+
+func valueDiff(old, c models.TableColumnInput) []string {
+	var d []string
+	if old.Required != c.Required {
+		d = append(d, fmt.Sprintf("required: %t -> %t", old.Required, c.Required))
+	}
+	if old.Indexed != c.Indexed {
+		d = append(d, fmt.Sprintf("indexed: %t -> %t", old.Indexed, c.Indexed))
+	}
+	if c.Type == "enum" && !slices.Equal(old.EnumValues, c.EnumValues) {
+		d = append(d, fmt.Sprintf("enum_values: %v -> %v", old.EnumValues, c.EnumValues))
+	}
+	if old.RequireDifferentTable != c.RequireDifferentTable {
+		d = append(d, fmt.Sprintf("require_different_table: %t -> %t", old.RequireDifferentTable, c.RequireDifferentTable))
+	}
+	return d
+}
+
+// accessDiff describes a change of field-level rules, or returns "".
+func accessDiff(old, c *models.ColumnAccess) string {
+	var a, b models.ColumnAccess
+	if old != nil {
+		a = *old
+	}
+	if c != nil {
+		b = *c
+	}
+	if a == b {
+		return ""
+	}
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return fmt.Sprintf("access: %s -> %s", x, y)
+}
+
+func derivedDiff(old, c models.TableColumnInput) []string {
+	var d []string
+	if old.Kind != c.Kind {
+		d = append(d, fmt.Sprintf("kind: %s -> %s", old.Kind, c.Kind))
+	}
+	if c.Type != "" && old.Type != c.Type {
+		d = append(d, fmt.Sprintf("type: %s -> %s", old.Type, c.Type))
+	}
+	if c.Kind == "computed" && strings.TrimSpace(old.Expression) != strings.TrimSpace(c.Expression) {
+		d = append(d, fmt.Sprintf("expression: %q -> %q", old.Expression, c.Expression))
+	}
+	if c.Kind == "rollup" {
+		a, _ := json.Marshal(old.Rollup)
+		b, _ := json.Marshal(normalizeRollup(c.Rollup))
+		if string(a) != string(b) {
+			d = append(d, fmt.Sprintf("rollup: %s -> %s", a, b))
+		}
+	}
+	return d
+}
+
+func normalizeRollup(s *models.RollupSpec) *models.RollupSpec {
+	if s == nil {
+		return nil
+	}
+	n := *s
+	n.Aggregate = strings.ToLower(n.Aggregate)
+	if n.Aggregate == "count" {
+		n.Target = ""
+	}
+	return &n
+}
+
+// apply runs the plan against h's repo, which is expected to be bound to a
+// transaction. Derived columns go first on the way out and last on the way
+// in, since they depend on value columns.
+func (p *schemaPlan) apply(ctx context.Context, h *Handler, orgID uuid.UUID) error {
+	for _, list := range [][]tableColumn{p.removeDerived, p.removeValue} {
+		for _, tc := range list {
+			if _, _, err := h.repo.RemoveUserTableColumn(ctx, orgID, tc.table, tc.col.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, slug := range p.removeTables {
+		if _, _, err := h.repo.DeleteUserTable(ctx, orgID, slug); err != nil {
+			return err
+		}
+	}
+	for _, name := range p.addTables {
+		if _, _, err := h.repo.CreateUserTable(ctx, orgID, name); err != nil {
+			return err
+		}
+	}
+	for _, tc := range p.addValue {
+		if _, _, err := h.repo.AddUserTableColumn(ctx, orgID, tc.table, tc.col); err != nil {
+			return err
+		}
+	}
+	for _, tc := range p.updateValue {
+		if _, _, err := h.repo.UpdateUserTableColumn(ctx, orgID, tc.table, tc.col); err != nil {
+			return err
+		}
+	}
+	for _, tc := range p.addDerived {
+		input := tc.col
+		prepare := h.prepareComputed
+		if input.Kind == "rollup" {
+			prepare = h.prepareRollup
+		}
+		if err := prepare(ctx, orgID, tc.table, &input); err != nil {
+			var verr validationError
+			if errors.As(err, &verr) {
+				return validationError(fmt.Sprintf("%s.%s: %s", tc.table, input.Name, verr))
+			}
+			return err
+		}
+		if _, _, err := h.repo.AddUserTableColumn(ctx, orgID, tc.table, input); err != nil {
+			return err
+		}
+	}
+	for _, tc := range p.setAccess {
+		if _, err := h.repo.SetColumnAccess(ctx, orgID, tc.table, tc.col.Name, tc.col.Access); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toYAML renders v as block-style YAML with keys in struct order by going
+// through its JSON encoding (JSON is valid YAML, so the node tree keeps order).
+func toYAML(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n yaml.Node
+	if err := yaml.Unmarshal(b, &n); err != nil {
+		return nil, err
+	}
+	var clear func(*yaml.Node)
+	clear = func(n *yaml.Node) {
+		n.Style = 0
+		for _, c := range n.Content {
+			clear(c)
+		}
+	}
+	clear(&n)
+	return yaml.Marshal(&n)
+}
+
+// fromYAML decodes YAML into v using v's JSON field names.
+func fromYAML(data []byte, v any) error {
+	var generic any
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	b, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
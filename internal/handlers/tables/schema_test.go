@@ -0,0 +1,363 @@
+package tables
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// schemaRepo holds one org's tables and columns in memory, for the repo
+// methods schema export and import use. InTx works on a copy that is kept
+// only when fn succeeds. Any other method panics through the nil embedded
+// Repo.
+type schemaRepo struct {
+	repo.Repo
+	tables  []models.UserTable
+	columns map[string][]models.TableColumn // by table slug
+	nextID  int64
+}
+
+func (m *schemaRepo) clone() *schemaRepo {
+	c := &schemaRepo{tables: slices.Clone(m.tables), columns: map[string][]models.TableColumn{}, nextID: m.nextID}
+	for slug, cols := range m.columns {
+		c.columns[slug] = slices.Clone(cols)
+	}
+	return c
+}
+
+func (m *schemaRepo) InTx(_ context.Context, fn func(repo.Repo) error) error {
+	tx := m.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	*m = *tx
+	return nil
+}
+
+func (m *schemaRepo) table(name string) (models.UserTable, bool) {
+	for _, t := range m.tables {
+		if t.Slug == strings.ToLower(name) || strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return models.UserTable{}, false
+}
+
+func (m *schemaRepo) ListUserTables(context.Context, uuid.UUID) ([]models.UserTable, error) {
+	return slices.Clone(m.tables), nil
+}
+
+func (m *schemaRepo) GetUserTableSchema(_ context.Context, _ uuid.UUID, table string) ([]models.TableColumn, error) {
+	t, _ := m.table(table)
+	return slices.Clone(m.columns[t.Slug]), nil
+}
+
+func (m *schemaRepo) CreateUserTable(_ context.Context, _ uuid.UUID, name string) (models.UserTable, bool, error) {
+	if t, ok := m.table(tableSlug(name)); ok {
+		return t, false, nil
+	}
+	m.nextID++
+	t := models.UserTable{ID: m.nextID, Name: name, Slug: tableSlug(name)}
+	m.tables = append(m.tables, t)
+	return t, true, nil
+}
+
+func (m *schemaRepo) DeleteUserTable(_ context.Context, _ uuid.UUID, table string) (models.UserTable, bool, error) {
+	t, ok := m.table(table)
+	if ok {
+		m.tables = slices.DeleteFunc(m.tables, func(x models.UserTable) bool { return x.ID == t.ID })
+		delete(m.columns, t.Slug)
+	}
+	return t, ok, nil
+}
+
+func (m *schemaRepo) AddUserTableColumn(_ context.Context, _ uuid.UUID, table string, in models.TableColumnInput) (models.TableColumn, bool, error) {
+	t, ok := m.table(table)
+	if !ok {
+		return models.TableColumn{}, false, fmt.Errorf("unknown table %q", table)
+	}
+	if in.Kind == "" {
+		in.Kind = "value"
+	}
+	m.nextID++
+	c := models.TableColumn{
+		ID:                    m.nextID,
+		Name:                  in.Name,
+		Type:                  in.Type,
+		Required:              in.Required,
+		Indexed:               in.Indexed,
+		EnumValues:            in.EnumValues,
+		IsReference:           in.IsReference,
+		RequireDifferentTable: in.RequireDifferentTable,
+		Kind:                  in.Kind,
+		Expression:            in.Expression,
+		Rollup:                in.Rollup,
+	}
+	if in.IsReference {
+		ref, ok := m.table(in.ReferenceTable)
+		if !ok {
+			return models.TableColumn{}, false, fmt.Errorf("unknown reference table %q", in.ReferenceTable)
+		}
+		c.ReferenceTableID = &ref.ID
+	}
+	m.columns[t.Slug] = append(m.columns[t.Slug], c)
+	return c, true, nil
+}
+
+func (m *schemaRepo) UpdateUserTableColumn(_ context.Context, _ uuid.UUID, table string, in models.TableColumnInput) (models.TableColumn, bool, error) {
+	t, _ := m.table(table)
+	for i, c := range m.columns[t.Slug] {
+		if c.Name == in.Name {
+			c.Required, c.Indexed, c.EnumValues = in.Required, in.Indexed, in.EnumValues
+			m.columns[t.Slug][i] = c
+			return c, true, nil
+		}
+	}
+	return models.TableColumn{}, false, nil
+}
+
+func (m *schemaRepo) RemoveUserTableColumn(_ context.Context, _ uuid.UUID, table, column string) (models.TableColumn, bool, error) {
+	t, _ := m.table(table)
+	i := slices.IndexFunc(m.columns[t.Slug], func(c models.TableColumn) bool { return c.Name == column })
+	if i < 0 {
+		return models.TableColumn{}, false, nil
+	}
+	c := m.columns[t.Slug][i]
+	m.columns[t.Slug] = slices.Delete(m.columns[t.Slug], i, i+1)
+	return c, true, nil
+}
+
+func (m *schemaRepo) SetColumnAccess(_ context.Context, _ uuid.UUID, table, column string, access *models.ColumnAccess) (bool, error) {
+	t, _ := m.table(table)
+	for i, c := range m.columns[t.Slug] {
+		if c.Name == column {
+			m.columns[t.Slug][i].Access = access
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var schemaOrg = uuid.MustParse("00000000-0000-4000-8000-000000000002")
+
+// newSchemaRepo has Locations and Assets, whose location references
+// Locations.
+func newSchemaRepo(t *testing.T) *schemaRepo {
+	t.Helper()
+	ctx := context.Background()
+	m := &schemaRepo{columns: map[string][]models.TableColumn{}}
+	for _, step := range []struct {
+		table string
+		col   models.TableColumnInput
+	}{
+		{"Locations", models.TableColumnInput{Name: "name", Type: "text", Required: true}},
+		{"Assets", models.TableColumnInput{Name: "name", Type: "text", Required: true}},
+		{"Assets", models.TableColumnInput{Name: "cost", Type: "float"}},
+		{"Assets", models.TableColumnInput{Name: "location", Type: "uuid", IsReference: true, ReferenceTable: "locations"}},
+	} {
+		if _, _, err := m.CreateUserTable(ctx, schemaOrg, step.table); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := m.AddUserTableColumn(ctx, schemaOrg, tableSlug(step.table), step.col); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func serveSchema(t *testing.T, h http.HandlerFunc, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	ctx := auth.WithOrg(req.Context(), schemaOrg)
+	ctx = auth.WithSession(ctx, &models.Session{UserID: uuid.New(), ActiveOrg: schemaOrg})
+	req = req.WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func exportDoc(t *testing.T, h *Handler) models.SchemaDocument {
+	t.Helper()
+	rec := serveSchema(t, h.ExportSchema, http.MethodGet, "/tables/schema/export", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body)
+	}
+	var doc models.SchemaDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// hasConflict reports whether the plan in rec lists conflict.
+func hasConflict(t *testing.T, rec *httptest.ResponseRecorder, conflict string) bool {
+	t.Helper()
+	var plan models.SchemaPlan
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	return slices.Contains(plan.Conflicts, conflict)
+}
+
+func TestExportSchema(t *testing.T) {
+	h := New(newSchemaRepo(t), nil)
+	doc := exportDoc(t, h)
+	if doc.Version != schemaDocumentVersion || len(doc.Tables) != 2 {
+		t.Fatalf("doc = %+v", doc)
+	}
+	if doc.Tables[0].Slug != "locations" || doc.Tables[1].Slug != "assets" {
+		t.Errorf("tables = %s, %s; want locations, assets", doc.Tables[0].Slug, doc.Tables[1].Slug)
+	}
+	loc := doc.Tables[1].Columns[2]
+	if loc.Name != "location" || !loc.IsReference || loc.ReferenceTable != "locations" {
+		t.Errorf("assets.location = %+v, want a reference to locations by slug", loc)
+	}
+
+	// Importing the export unchanged plans nothing
+	rec := serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import", doc)
+	var plan models.SchemaPlan
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", rec.Code, rec.Body)
+	}
+	if len(plan.Changes) != 0 || len(plan.Conflicts) != 0 {
+		t.Errorf("round trip plan = %+v", plan)
+	}
+}
+
+func TestImportSchemaPlan(t *testing.T) {
+	m := newSchemaRepo(t)
+	h := New(m, nil)
+	doc := exportDoc(t, h)
+	doc.Tables[1].Columns[0].Indexed = true
+	doc.Tables[1].Columns = append(doc.Tables[1].Columns,
+		models.TableColumnInput{Name: "Cost With Tax", Kind: "computed", Expression: "cost * 1.2"})
+	doc.Tables = append(doc.Tables, models.SchemaTable{Name: "Spare Parts", Columns: []models.TableColumnInput{
+		{Name: "name", Type: "text"},
+		{Name: "location", Type: "uuid", IsReference: true, ReferenceTable: "locations"},
+	}})
+
+	rec := serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import", doc)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("plan: %d %s", rec.Code, rec.Body)
+	}
+	var plan models.SchemaPlan
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.SchemaChange{
+		{Action: "change_column", Table: "assets", Column: "name", Detail: []string{"indexed: false -> true"}},
+		{Action: "add_column", Table: "assets", Column: "cost_with_tax"},
+		{Action: "add_table", Table: "spare-parts"},
+		{Action: "add_column", Table: "spare-parts", Column: "name"},
+		{Action: "add_column", Table: "spare-parts", Column: "location"},
+	}
+	if plan.Applied || len(plan.Conflicts) > 0 || !slices.EqualFunc(plan.Changes, want, func(a, b models.SchemaChange) bool {
+		return a.Action == b.Action && a.Table == b.Table && a.Column == b.Column && slices.Equal(a.Detail, b.Detail)
+	}) {
+		t.Errorf("plan = %+v\nwant changes %+v", plan, want)
+	}
+	if len(m.tables) != 2 {
+		t.Errorf("planning created tables: %v", m.tables)
+	}
+
+	// References must name a table that exists or is in the document
+	doc.Tables[2].Columns[1].ReferenceTable = "sites"
+	rec = serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import?apply=true", doc)
+	if rec.Code != http.StatusConflict || !hasConflict(t, rec, `spare-parts.location: referenced table "sites" is not in the document`) {
+		t.Errorf("unknown reference: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestImportSchemaApply(t *testing.T) {
+	m := newSchemaRepo(t)
+	h := New(m, nil)
+	doc := exportDoc(t, h)
+	// Listed before the columns they read, and before the table they reference
+	doc.Tables[1].Columns = append(doc.Tables[1].Columns,
+		models.TableColumnInput{Name: "total", Kind: "computed", Expression: "subtotal + 1"},
+		models.TableColumnInput{Name: "subtotal", Kind: "computed", Expression: "cost * 2"})
+	doc.Tables = append([]models.SchemaTable{{Name: "Spare Parts", Columns: []models.TableColumnInput{
+		{Name: "name", Type: "text"},
+		{Name: "location", Type: "uuid", IsReference: true, ReferenceTable: "locations"},
+	}}}, doc.Tables...)
+
+	rec := serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import?apply=true", doc)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+	var plan models.SchemaPlan
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil || !plan.Applied {
+		t.Fatalf("plan = %s", rec.Body)
+	}
+
+	locations, _ := m.table("locations")
+	parts, ok := m.table("spare-parts")
+	if !ok {
+		t.Fatal("spare-parts was not created")
+	}
+	loc := m.columns[parts.Slug][1]
+	if loc.ReferenceTableID == nil || *loc.ReferenceTableID != locations.ID {
+		t.Errorf("spare-parts.location = %+v, want a reference to locations (%d)", loc, locations.ID)
+	}
+	var names []string
+	for _, c := range m.columns["assets"] {
+		names = append(names, c.Name)
+	}
+	// A computed column is added after the computed columns it reads
+	if want := []string{"name", "cost", "location", "subtotal", "total"}; !slices.Equal(names, want) {
+		t.Errorf("assets columns = %v, want %v", names, want)
+	}
+
+	// Computed columns reading each other are a conflict
+	doc = exportDoc(t, h)
+	doc.Tables[1].Columns = append(doc.Tables[1].Columns,
+		models.TableColumnInput{Name: "a", Kind: "computed", Expression: "b + 1"},
+		models.TableColumnInput{Name: "b", Kind: "computed", Expression: "a + 1"})
+	rec = serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import?apply=true", doc)
+	if rec.Code != http.StatusConflict || !hasConflict(t, rec, "assets: computed columns read each other: a -> b -> a") {
+		t.Errorf("cycle: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestImportSchemaRollback(t *testing.T) {
+	m := newSchemaRepo(t)
+	h := New(m, nil)
+	doc := exportDoc(t, h)
+	// The table and value column go in before the computed column fails to
+	// compile (text * number)
+	doc.Tables = append(doc.Tables, models.SchemaTable{Name: "Meters", Columns: []models.TableColumnInput{
+		{Name: "name", Type: "text"},
+	}})
+	doc.Tables[1].Columns = append(doc.Tables[1].Columns,
+		models.TableColumnInput{Name: "serial", Type: "text"},
+		models.TableColumnInput{Name: "bad", Kind: "computed", Expression: "name * 2"})
+
+	rec := serveSchema(t, h.ImportSchema, http.MethodPost, "/tables/schema/import?apply=true", doc)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "assets.bad: invalid expression") {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := m.table("meters"); ok || len(m.tables) != 2 {
+		t.Errorf("tables after a failed apply = %v", m.tables)
+	}
+	if len(m.columns["assets"]) != 3 {
+		t.Errorf("assets columns after a failed apply = %v", m.columns["assets"])
+	}
+}
@@ -0,0 +1,199 @@
+package tables
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/checklists"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// GetStateMachines handles GET /tables/{table}/state-machines: the state
+// machines of the table's enum columns.
+func (h *Handler) GetStateMachines(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	machines, err := h.repo.ListStateMachines(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"state_machines": machines})
+}
+
+// PutStateMachine handles PUT /tables/{table}/state-machines/{column} with
+// body {"initial":["OPEN"],"transitions":[{"from":["OPEN"],"to":"COMPLETED","roles":["Member"]}],
+// "states":{"COMPLETED":{"required":[{"field":"feedback"}],"set":{"completed_on":"today()"}}}}
+// and creates or replaces the machine of the column.
+func (h *Handler) PutStateMachine(w http.ResponseWriter, r *http.Request) {
+	orgID, table, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var m models.StateMachine
+	if !httpserver.Decode(w, r, &m) {
+		return
+	}
+	m.Column, m.TableID = chi.URLParam(r, "column"), tableID
+	schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, table)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if err := workflow.Compile(&m, schema); err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.repo.PutStateMachine(r.Context(), orgID, m); err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	machines, err := h.repo.ListStateMachines(r.Context(), orgID, tableID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	for _, sm := range machines {
+		if sm.Column == m.Column {
+			httpserver.JSON(w, http.StatusOK, map[string]any{"state_machine": sm})
+			return
+		}
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"state_machine": m})
+}
+
+// DeleteStateMachine handles DELETE /tables/{table}/state-machines/{column};
+// the column's values can then change freely.
+func (h *Handler) DeleteStateMachine(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canManage)
+	if !ok {
+		return
+	}
+	column := chi.URLParam(r, "column")
+	deleted, err := h.repo.DeleteStateMachine(r.Context(), orgID, tableID, column)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "state machine not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"deleted": true, "column": column})
+}
+
+// RowStates handles GET /tables/{table}/rows/{row_id}/transitions: the
+// row's state in each machine of the table and the states the caller may
+// move it to.
+func (h *Handler) RowStates(w http.ResponseWriter, r *http.Request) {
+	orgID, _, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	rid, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	states, found, err := workflow.States(r.Context(), h.repo, orgID, callerID(r), tableID, rid)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"states": states})
+}
+
+// Transition handles POST /tables/{table}/rows/{row_id}/transition with
+// body {"to":"COMPLETED","column":"status","values":{"feedback":"Done"}}:
+// moves the row to another state of a state machine, writing values along.
+// column may be left out when the table has one machine.
+func (h *Handler) Transition(w http.ResponseWriter, r *http.Request) {
+	orgID, table, tableID, _, ok := h.authorize(w, r, canEdit)
+	if !ok {
+		return
+	}
+	rid, ok := httpserver.PathID(w, r, "row_id")
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		Column string         `json:"column"`
+		To     string         `json:"to"`
+		Values map[string]any `json:"values"`
+	}
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	if body.To == "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing to"})
+		return
+	}
+	var row models.TableRow
+	var found bool
+	err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		values, visible, err := workflow.Transition(r.Context(), tx, orgID, callerID(r), tableID, rid, body.Column, body.To, body.Values)
+		if err != nil || !visible {
+			return err
+		}
+		if table == pm.WorkOrderTable {
+			if err := checklists.Completable(r.Context(), tx, orgID, rid, values); err != nil {
+				return err
+			}
+		}
+		payload, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		row, found, err = automations.UpdateRow(r.Context(), tx, orgID, tableID, table, rid, payload)
+		return err
+	})
+	switch {
+	case errors.Is(err, workflow.ErrNoMachine):
+		msg := "the table has no state machine for that column"
+		if body.Column == "" {
+			msg = "column is required unless the table has exactly one state machine"
+		}
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	case errors.Is(err, workflow.ErrUnchanged):
+		httpserver.JSON(w, http.StatusConflict, map[string]string{"error": "row already is " + body.To})
+		return
+	case err != nil:
+		h.writeRowError(w, r, orgID, err, "transition failed")
+		return
+	case !found:
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"row": row})
+}
+
+// WorkOrderTransition handles POST /work-orders/{id}/transition, the
+// Transition of the table provisioned from the work_orders template.
+func (h *Handler) WorkOrderTransition(w http.ResponseWriter, r *http.Request) {
+	rctx := chi.RouteContext(r.Context())
+	rctx.URLParams.Add("table", "work-orders")
+	rctx.URLParams.Add("row_id", chi.URLParam(r, "id"))
+	h.Transition(w, r)
+}
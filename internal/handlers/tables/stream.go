@@ -0,0 +1,186 @@
+package tables
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+)
+
+// streamBatch is how many events a stream reads at once when catching up.
+const streamBatch = 500
+
+// keepAlive is how often an idle stream sends a comment, so proxies and
+// load balancers don't close it. Read access is checked again as often.
+const keepAlive = 25 * time.Second
+
+// heldPoll is how often a stream reads again while events are held back
+// for older transactions to end; their end may not be announced.
+const heldPoll = time.Second
+
+// errRevoked ends a stream whose caller can no longer read the table.
+var errRevoked = errors.New("read access revoked")
+
+// position is where a stream is in a table's events: the transaction and
+// id of the last event sent. It is sent as the SSE id, "<txid>-<id>".
+type position struct {
+	txid, id int64
+}
+
+func (p position) String() string { return fmt.Sprintf("%d-%d", p.txid, p.id) }
+
+func parsePosition(s string) (position, bool) {
+	txid, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return position{}, false
+	}
+	var p position
+	var err1, err2 error
+	p.txid, err1 = strconv.ParseInt(txid, 10, 64)
+	p.id, err2 = strconv.ParseInt(id, 10, 64)
+	return p, err1 == nil && err2 == nil && p.txid >= 0 && p.id >= 0
+}
+
+// Events handles GET /tables/{table}/events, a Server-Sent Events stream of
+// the table's row events (row.created, row.updated, row.deleted) as the
+// caller may see them. A client reconnecting with Last-Event-ID, or
+// ?last_event_id= where it cannot set headers, first gets the events it
+// missed. The stream ends with a revoked event once the caller can no
+// longer read the table.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	orgID, table, tableID, _, ok := h.authorize(w, r, canRead)
+	if !ok {
+		return
+	}
+	if h.stream == nil {
+		httpserver.JSON(w, http.StatusServiceUnavailable, map[string]string{"error": "event streams are unavailable"})
+		return
+	}
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	var after position
+	if last != "" {
+		if after, ok = parsePosition(last); !ok {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	ctx := r.Context()
+	// Subscribe before reading the horizon or catching up, so nothing
+	// committed in between is missed.
+	sub := h.stream.Subscribe(orgID, tableID)
+	defer sub.Close()
+	if last == "" {
+		horizon, _, err := h.repo.RowEventHorizon(ctx, orgID, tableID)
+		if err != nil {
+			status, msg := httpserver.PGErrorMessage(err, "stream failed")
+			httpserver.JSON(w, status, map[string]string{"error": msg})
+			return
+		}
+		after = position{txid: horizon}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	send := func(events []models.RowEvent) error {
+		for _, ev := range events {
+			ev.Table = table
+			b, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			at := position{ev.Txid, ev.ID}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", at, ev.Type, b); err != nil {
+				return err
+			}
+			after = at
+		}
+		return rc.Flush()
+	}
+	// catchUp sends the events after the stream's position and reports
+	// whether newer ones are held back.
+	catchUp := func() (bool, error) {
+		for {
+			events, err := h.repo.StreamRowEvents(ctx, orgID, tableID, after.txid, after.id, streamBatch)
+			if err != nil {
+				return false, err
+			}
+			if err := send(events); err != nil {
+				return false, err
+			}
+			if len(events) < streamBatch {
+				break
+			}
+		}
+		_, held, err := h.repo.RowEventHorizon(ctx, orgID, tableID)
+		return held, err
+	}
+	// readable checks again that the caller may read the table; grants,
+	// memberships and the table itself may have changed since the stream
+	// began. Row policies and field access are applied to every event read.
+	readable := func() error {
+		id, perms, found, err := h.repo.GetTablePermissions(ctx, orgID, callerID(r), table)
+		switch {
+		case err != nil:
+			return err
+		case !found || !perms.Read || id != tableID:
+			return errRevoked
+		}
+		return nil
+	}
+
+	var held bool
+	var err error
+	if last != "" {
+		held, err = catchUp()
+	} else {
+		err = rc.Flush()
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for err == nil {
+		var poll <-chan time.Time
+		if held {
+			poll = time.After(heldPoll)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err = readable(); err == nil {
+				if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err == nil {
+					err = rc.Flush()
+				}
+			}
+		case <-poll:
+			held, err = catchUp()
+		case <-sub.Wake():
+			if err = readable(); err == nil {
+				held, err = catchUp()
+			}
+		}
+	}
+	if errors.Is(err, errRevoked) {
+		fmt.Fprint(w, "event: revoked\ndata: {}\n\n")
+		rc.Flush()
+		return
+	}
+	if ctx.Err() == nil {
+		slog.WarnContext(ctx, "row event stream ended", "table", table, "err", err)
+	}
+}
@@ -0,0 +1,302 @@
+package tables
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	"yourapp/internal/stream"
+)
+
+const (
+	ordersID = 7
+	partsID  = 8
+)
+
+var streamOrg = uuid.MustParse("00000000-0000-4000-8000-0000000000e1")
+
+// streamRepo holds the committed row events of two tables, orders and
+// parts, the event horizon and whether the caller may read orders. Any
+// other method panics through the nil embedded Repo.
+type streamRepo struct {
+	repo.Repo
+	mu       sync.Mutex
+	events   map[int64][]models.RowEvent // by table id
+	horizon  int64
+	readable bool
+}
+
+func (m *streamRepo) commit(tableID int64, ev models.RowEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[tableID] = append(m.events[tableID], ev)
+}
+
+func (m *streamRepo) setHorizon(h int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.horizon = h
+}
+
+func (m *streamRepo) setReadable(ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readable = ok
+}
+
+func (m *streamRepo) GetTablePermissions(_ context.Context, _, _ uuid.UUID, table string) (int64, models.TablePermissions, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch table {
+	case "orders":
+		return ordersID, models.TablePermissions{Read: m.readable}, true, nil
+	case "parts":
+		return partsID, models.TablePermissions{Read: true}, true, nil
+	}
+	return 0, models.TablePermissions{}, false, nil
+}
+
+// StreamRowEvents reads like app.stream_row_events: after the position, in
+// (txid, id) order, below the horizon.
+func (m *streamRepo) StreamRowEvents(_ context.Context, _ uuid.UUID, tableID, afterTxid, afterID int64, limit int) ([]models.RowEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byPosition := func(a, b models.RowEvent) int {
+		return cmp.Or(cmp.Compare(a.Txid, b.Txid), cmp.Compare(a.ID, b.ID))
+	}
+	all := slices.SortedFunc(slices.Values(m.events[tableID]), byPosition)
+	var out []models.RowEvent
+	for _, ev := range all {
+		after := ev.Txid > afterTxid || ev.Txid == afterTxid && ev.ID > afterID
+		if after && ev.Txid < m.horizon && len(out) < limit {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func (m *streamRepo) RowEventHorizon(_ context.Context, _ uuid.UUID, tableID int64) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held := slices.ContainsFunc(m.events[tableID], func(ev models.RowEvent) bool { return ev.Txid >= m.horizon })
+	return m.horizon, held, nil
+}
+
+func rowEvent(txid, id int64) models.RowEvent {
+	return models.RowEvent{ID: id, Txid: txid, Type: "row.updated", RowID: uuid.New(), Data: json.RawMessage(`{}`)}
+}
+
+// sseEvent is an event read from a stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// openStream serves the events of table and returns the events read from
+// it. lastEventID is sent as the Last-Event-ID header unless empty.
+func openStream(t *testing.T, m *streamRepo, hub *stream.Hub, table, lastEventID string) (int, <-chan sseEvent) {
+	t.Helper()
+	h := New(m, hub)
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := auth.WithOrg(req.Context(), streamOrg)
+			ctx = auth.WithSession(ctx, &models.Session{UserID: uuid.New(), ActiveOrg: streamOrg})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+	r.Get("/tables/{table}/events", h.Events)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/tables/"+table+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var ev sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			field, value, _ := strings.Cut(sc.Text(), ": ")
+			switch field {
+			case "id":
+				ev.id = value
+			case "event":
+				ev.event = value
+			case "data":
+				ev.data = value
+			case "":
+				if ev.event != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return resp.StatusCode, events
+}
+
+// ids returns the SSE ids of the next n events, failing when they don't
+// arrive in time.
+func ids(t *testing.T, events <-chan sseEvent, n int) []string {
+	t.Helper()
+	var out []string
+	for len(out) < n {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("stream ended after %v", out)
+			}
+			out = append(out, ev.id)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("got %v, want %d events", out, n)
+		}
+	}
+	return out
+}
+
+// quiet fails when an event arrives within a moment.
+func quiet(t *testing.T, events <-chan sseEvent) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func newStreamRepo() *streamRepo {
+	return &streamRepo{events: map[int64][]models.RowEvent{}, horizon: 100, readable: true}
+}
+
+func TestEventsResume(t *testing.T) {
+	m := newStreamRepo()
+	// Event 11 was written before event 12 but committed after it, in a
+	// later-ending transaction with a higher txid
+	for _, ev := range []models.RowEvent{rowEvent(5, 10), rowEvent(7, 12), rowEvent(8, 11), rowEvent(9, 13)} {
+		m.commit(ordersID, ev)
+	}
+	hub := stream.NewHub(nil)
+
+	status, events := openStream(t, m, hub, "orders", "7-12")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if got, want := ids(t, events, 2), []string{"8-11", "9-13"}; !slices.Equal(got, want) {
+		t.Errorf("resumed events = %v, want %v", got, want)
+	}
+	quiet(t, events)
+
+	// Later events arrive once announced, after the last one sent
+	m.commit(ordersID, rowEvent(10, 14))
+	hub.Publish(streamOrg, ordersID)
+	if got := ids(t, events, 1); got[0] != "10-14" {
+		t.Errorf("live event = %v, want 10-14", got)
+	}
+}
+
+func TestEventsStartAtHorizon(t *testing.T) {
+	m := newStreamRepo()
+	m.commit(ordersID, rowEvent(5, 10))
+	hub := stream.NewHub(nil)
+
+	_, events := openStream(t, m, hub, "orders", "")
+	quiet(t, events)
+	m.commit(ordersID, rowEvent(100, 11))
+	m.setHorizon(101)
+	hub.Publish(streamOrg, ordersID)
+	if got := ids(t, events, 1); got[0] != "100-11" {
+		t.Errorf("first event = %v, want 100-11", got)
+	}
+}
+
+func TestEventsBadLastEventID(t *testing.T) {
+	for _, last := range []string{"12", "a-1", "1-", "-1-2", "1-2-3"} {
+		status, _ := openStream(t, newStreamRepo(), stream.NewHub(nil), "orders", last)
+		if status != http.StatusBadRequest {
+			t.Errorf("Last-Event-ID %q: status = %d, want 400", last, status)
+		}
+	}
+}
+
+// Events of transactions above the horizon wait, even when announced, and
+// then arrive in transaction order without another announcement.
+func TestEventsHeldBack(t *testing.T) {
+	m := newStreamRepo()
+	hub := stream.NewHub(nil)
+	_, events := openStream(t, m, hub, "orders", "99-0")
+
+	m.commit(ordersID, rowEvent(101, 21))
+	hub.Publish(streamOrg, ordersID)
+	quiet(t, events)
+
+	m.commit(ordersID, rowEvent(100, 22))
+	m.setHorizon(102)
+	if got, want := ids(t, events, 2), []string{"100-22", "101-21"}; !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestEventsFiltering(t *testing.T) {
+	m := newStreamRepo()
+	hub := stream.NewHub(nil)
+	_, events := openStream(t, m, hub, "orders", "")
+
+	// Other tables and other orgs don't reach the stream
+	m.commit(partsID, rowEvent(100, 30))
+	m.setHorizon(101)
+	hub.Publish(streamOrg, partsID)
+	hub.Publish(uuid.New(), ordersID)
+	quiet(t, events)
+
+	// Losing read access ends the stream at the next announcement
+	m.setReadable(false)
+	m.commit(ordersID, rowEvent(101, 31))
+	m.setHorizon(102)
+	hub.Publish(streamOrg, ordersID)
+	select {
+	case ev := <-events:
+		if ev.event != "revoked" {
+			t.Errorf("event after losing access = %+v, want revoked", ev)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the stream went on after losing access")
+	}
+	if ev, ok := <-events; ok {
+		t.Errorf("event after revoked: %+v", ev)
+	}
+}
+
+func TestEventsUnreadable(t *testing.T) {
+	m := newStreamRepo()
+	m.readable = false
+	status, _ := openStream(t, m, stream.NewHub(nil), "orders", "")
+	if status != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", status)
+	}
+}
@@ -2,38 +2,38 @@ package tables
 
 import (
     "encoding/json"
+    "errors"
     "net/http"
 
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
 
     "yourapp/internal/auth"
+    "yourapp/internal/automations"
+    "yourapp/internal/checklists"
     httpserver "yourapp/internal/http"
     "yourapp/internal/repo"
     "yourapp/internal/models"
+    "yourapp/internal/pm"
+    "yourapp/internal/storage"
+    "yourapp/internal/stream"
+    "yourapp/internal/workflow"
 )
 
 type Handler struct {
-	repo repo.Repo
+	repo   repo.Repo
+	stream *stream.Hub // wakes row event streams; nil without one
 }
 
-func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+func New(repo repo.Repo, hub *stream.Hub) *Handler { return &Handler{repo: repo, stream: hub} }
 
 // Search handles POST /tables/{table}/search with JSON payload containing page/filterFields
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
-	// Require org context if needed later; currently generic search is not org-scoped in DB
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, _, perms, ok := h.authorize(w, r, canRead)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
         return
     }
 
-	table := chi.URLParam(r, "table")
-	if table == "" {
-		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
-		return
-	}
-
 	defer r.Body.Close()
 	var body map[string]any
 	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
@@ -45,11 +45,6 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON (extra content)"})
 		return
 	}
-	payload, err := json.Marshal(body)
-	if err != nil {
-		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "failed to encode payload"})
-		return
-	}
 
     // Fetch schema first, then rows
     schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, table)
@@ -57,6 +52,19 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "schema fetch failed"})
         return
     }
+    if msg := checkSearchFields(body, schema); msg != "" {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+        return
+    }
+    if msg := checkDerivedFilters(body, schema); msg != "" {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+        return
+    }
+	payload, err := json.Marshal(body)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "failed to encode payload"})
+		return
+	}
     rows, err := h.repo.SearchUserTable(r.Context(), orgID, table, payload)
     if err != nil {
         httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "search failed"})
@@ -92,16 +100,25 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
             }
         }
     }
-    // Batch lookups
+    // Batch lookups, only labelling rows of tables the caller can read
     labelCache := make(map[uuid.UUID]string)
-    for tbl, ids := range byTable {
-        if len(ids) == 0 { continue }
-        m, _ := h.repo.BatchGetRowLabels(r.Context(), orgID, tbl, ids)
-        for k, v := range m { labelCache[k] = v }
-    }
-    if len(autoIDs) > 0 {
-        m, _ := h.repo.BatchGetRowLabelsAuto(r.Context(), orgID, autoIDs)
-        for k, v := range m { labelCache[k] = v }
+    if len(byTable) > 0 || len(autoIDs) > 0 {
+        readable, err := h.readableTables(r, orgID)
+        if err != nil {
+            httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "search failed"})
+            return
+        }
+        for tbl, ids := range byTable {
+            if _, ok := readable[tbl]; !ok || len(ids) == 0 { continue }
+            m, _ := h.repo.BatchGetRowLabels(r.Context(), orgID, tbl, ids)
+            for k, v := range m { labelCache[k] = v }
+        }
+        if len(autoIDs) > 0 && len(readable) > 0 {
+            tableIDs := make([]int64, 0, len(readable))
+            for id := range readable { tableIDs = append(tableIDs, id) }
+            m, _ := h.repo.BatchGetRowLabelsAuto(r.Context(), orgID, autoIDs, tableIDs)
+            for k, v := range m { labelCache[k] = v }
+        }
     }
 
     // Second pass: build content, replacing uuid fields with {id,label?}
@@ -132,7 +149,7 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
         // If you want to keep a specific key, adjust here.
         contents = append(contents, m)
     }
-    httpserver.JSON(w, http.StatusOK, map[string]any{"columns": schema, "content": contents, "total_count": totalCount})
+    httpserver.JSON(w, http.StatusOK, map[string]any{"columns": schema, "content": contents, "total_count": totalCount, "permissions": perms})
 }
 
 // Create handles POST /tables with JSON body {"name": "..."} to create a new table for the org
@@ -143,18 +160,42 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
         return
     }
     defer r.Body.Close()
-    var body struct{ Name string `json:"name"` }
+    var body struct {
+        Name        string `json:"name"`
+        StorageMode string `json:"storage_mode"` // "" or eav (default), relational
+    }
     dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
     if err := dec.Decode(&body); err != nil || body.Name == "" {
         httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON or missing name"})
         return
     }
-    table, created, err := h.repo.CreateUserTable(r.Context(), orgID, body.Name)
+    if body.StorageMode != "" && body.StorageMode != models.StorageEAV && body.StorageMode != models.StorageRelational {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "storage_mode must be eav or relational"})
+        return
+    }
+    var table models.UserTable
+    var created bool
+    err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        var err error
+        table, created, err = tx.CreateUserTable(r.Context(), orgID, body.Name)
+        if err != nil || !created {
+            return err
+        }
+        return emitSchema(r.Context(), tx, orgID, models.EventTableCreated, table.ID, table)
+    })
     if err != nil {
         status, msg := httpserver.PGErrorMessage(err, "create failed")
         httpserver.JSON(w, status, map[string]string{"error": msg})
         return
     }
+    // An existing table keeps its engine; use cmd/storage to migrate it
+    if created && body.StorageMode == models.StorageRelational {
+        if _, err := storage.ToRelational(r.Context(), h.repo, orgID, table.Slug, storage.Options{}); err != nil {
+            status, msg := httpserver.PGErrorMessage(err, "create failed")
+            httpserver.JSON(w, status, map[string]string{"error": msg})
+            return
+        }
+    }
     httpserver.JSON(w, http.StatusCreated, map[string]any{"created": created, "table": table})
 }
 
@@ -170,22 +211,50 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "list failed"})
         return
     }
-    httpserver.JSON(w, http.StatusOK, map[string]any{"tables": tables})
+    readable, err := h.readableTables(r, orgID)
+    if err != nil {
+        httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "list failed"})
+        return
+    }
+    // Only tables the caller can read, each with the caller's rights
+    visible := make([]models.UserTable, 0, len(tables))
+    for _, t := range tables {
+        if p, ok := readable[t.ID]; ok {
+            t.Permissions = &p
+            visible = append(visible, t)
+        }
+    }
+    httpserver.JSON(w, http.StatusOK, map[string]any{"tables": visible})
 }
 
 // Delete handles DELETE /tables/{table} for the current org
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, tableID, _, ok := h.authorize(w, r, canManage)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
         return
     }
-    table := chi.URLParam(r, "table")
-    if table == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
+    // Its own automations go with the table, but not those creating rows in it
+    autos, err := h.repo.AutomationsUsingTable(r.Context(), orgID, tableID)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if len(autos) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "table is used by automations", "automations": autos})
         return
     }
-    ut, deleted, err := h.repo.DeleteUserTable(r.Context(), orgID, table)
+    var ut models.UserTable
+    var deleted bool
+    err = h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        var err error
+        ut, deleted, err = tx.DeleteUserTable(r.Context(), orgID, table)
+        if err != nil || !deleted {
+            return err
+        }
+        // The table is gone, so the event carries it as its data
+        return emitSchema(r.Context(), tx, orgID, models.EventTableDeleted, ut.ID, ut)
+    })
     if err != nil {
         status, msg := httpserver.PGErrorMessage(err, "delete failed")
         httpserver.JSON(w, status, map[string]string{"error": msg})
@@ -200,14 +269,8 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 
 // AddColumn handles POST /tables/{table}/columns to add a column to a user-defined table
 func (h *Handler) AddColumn(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, tableID, _, ok := h.authorize(w, r, canManage)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-        return
-    }
-    table := chi.URLParam(r, "table")
-    if table == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
         return
     }
     defer r.Body.Close()
@@ -217,11 +280,55 @@ func (h *Handler) AddColumn(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
         return
     }
-    if input.Name == "" || input.Type == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "name and type are required"})
+    switch input.Kind {
+    case "", "value":
+        if input.Name == "" || input.Type == "" {
+            httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "name and type are required"})
+            return
+        }
+    case "computed", "rollup":
+        if input.Name == "" {
+            httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+            return
+        }
+        prepare := h.prepareComputed
+        if input.Kind == "rollup" {
+            prepare = h.prepareRollup
+        }
+        if err := prepare(r.Context(), orgID, table, &input); err != nil {
+            var verr validationError
+            if errors.As(err, &verr) {
+                httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": verr.Error()})
+                return
+            }
+            status, msg := httpserver.PGErrorMessage(err, "add column failed")
+            httpserver.JSON(w, status, map[string]string{"error": msg})
+            return
+        }
+    default:
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "kind must be value, computed or rollup"})
         return
     }
-    col, created, err := h.repo.AddUserTableColumn(r.Context(), orgID, table, input)
+    if msg := checkAccess(input.Access); msg != "" {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+        return
+    }
+    var col models.TableColumn
+    var created bool
+    err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        var err error
+        col, created, err = tx.AddUserTableColumn(r.Context(), orgID, table, input)
+        if err != nil || !created {
+            return err
+        }
+        if input.Access != nil {
+            col.Access = input.Access
+            if _, err := tx.SetColumnAccess(r.Context(), orgID, table, col.Name, input.Access); err != nil {
+                return err
+            }
+        }
+        return emitSchema(r.Context(), tx, orgID, models.EventColumnAdded, tableID, col)
+    })
     if err != nil {
         status, msg := httpserver.PGErrorMessage(err, "add column failed")
         httpserver.JSON(w, status, map[string]string{"error": msg})
@@ -234,14 +341,8 @@ func (h *Handler) AddColumn(w http.ResponseWriter, r *http.Request) {
 
 // AddRow handles POST /tables/{table}/rows to insert a row with JSON body values
 func (h *Handler) AddRow(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, tableID, _, ok := h.authorize(w, r, canCreate)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-        return
-    }
-    table := chi.URLParam(r, "table")
-    if table == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
         return
     }
     defer r.Body.Close()
@@ -251,26 +352,77 @@ func (h *Handler) AddRow(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
         return
     }
-    payload, err := json.Marshal(body)
+    var row models.TableRow
+    err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        values, err := workflow.Apply(r.Context(), tx, orgID, callerID(r), tableID, uuid.Nil, body)
+        if err != nil {
+            return err
+        }
+        payload, err := json.Marshal(values)
+        if err != nil {
+            return err
+        }
+        row, err = automations.InsertRow(r.Context(), tx, orgID, tableID, table, payload)
+        return err
+    })
     if err != nil {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "failed to encode values"})
+        h.writeRowError(w, r, orgID, err, "insert failed")
+        return
+    }
+    httpserver.JSON(w, http.StatusCreated, map[string]any{"row": row})
+}
+
+// UpdateRow handles PATCH /tables/{table}/rows/{row_id} with the values to
+// change as the JSON body; columns left out keep their values.
+func (h *Handler) UpdateRow(w http.ResponseWriter, r *http.Request) {
+    orgID, table, tableID, _, ok := h.authorize(w, r, canEdit)
+    if !ok {
+        return
+    }
+    rid, ok := httpserver.PathID(w, r, "row_id")
+    if !ok {
+        return
+    }
+    defer r.Body.Close()
+    var body map[string]any
+    if !httpserver.Decode(w, r, &body) {
         return
     }
-    row, err := h.repo.InsertUserTableRow(r.Context(), orgID, table, payload)
+    var row models.TableRow
+    var found bool
+    err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        values, err := workflow.Apply(r.Context(), tx, orgID, callerID(r), tableID, rid, body)
+        if err != nil {
+            return err
+        }
+        if table == pm.WorkOrderTable {
+            if err := checklists.Completable(r.Context(), tx, orgID, rid, values); err != nil {
+                return err
+            }
+        }
+        payload, err := json.Marshal(values)
+        if err != nil {
+            return err
+        }
+        row, found, err = automations.UpdateRow(r.Context(), tx, orgID, tableID, table, rid, payload)
+        return err
+    })
     if err != nil {
-        status, msg := httpserver.PGErrorMessage(err, "insert failed")
-        httpserver.JSON(w, status, map[string]string{"error": msg})
+        h.writeRowError(w, r, orgID, err, "update failed")
         return
     }
-    httpserver.JSON(w, http.StatusCreated, map[string]any{"row": row})
+    if !found {
+        httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "row not found"})
+        return
+    }
+    httpserver.JSON(w, http.StatusOK, map[string]any{"row": row})
 }
 
 // LookupRow handles POST /tables/rows/lookup with JSON body {"id":"<uuid>"}
 // Returns the EAV-composed JSON for that row id using app.row_to_json.
 func (h *Handler) LookupRow(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, sess, ok := httpserver.Caller(w, r)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
         return
     }
     defer r.Body.Close()
@@ -285,6 +437,17 @@ func (h *Handler) LookupRow(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid UUID"})
         return
     }
+    // Rows of tables the caller cannot read are not found
+    _, perms, found, err := h.repo.GetRowPermissions(r.Context(), orgID, sess.UserID, uid)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "lookup failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if !found || !perms.Read {
+        httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+        return
+    }
     data, found, err := h.repo.GetRowData(r.Context(), orgID, uid)
     if err != nil {
         status, msg := httpserver.PGErrorMessage(err, "lookup failed")
@@ -302,14 +465,8 @@ func (h *Handler) LookupRow(w http.ResponseWriter, r *http.Request) {
 // Body: {"field":"title","q":"fil","limit":20}
 // Returns items: [{id, label}...]
 func (h *Handler) LookupIndexed(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, _, _, ok := h.authorize(w, r, canRead)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-        return
-    }
-    table := chi.URLParam(r, "table")
-    if table == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table"})
         return
     }
     defer r.Body.Close()
@@ -347,20 +504,30 @@ func (h *Handler) IndexedFields(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, status, map[string]string{"error": msg})
         return
     }
-    httpserver.JSON(w, http.StatusOK, map[string]any{"items": items})
+    readable, err := h.readableTables(r, orgID)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    visible := make([]models.IndexedField, 0, len(items))
+    for _, f := range items {
+        if _, ok := readable[f.TableID]; ok {
+            visible = append(visible, f)
+        }
+    }
+    httpserver.JSON(w, http.StatusOK, map[string]any{"items": visible})
 }
 
 // DeleteRow handles DELETE /tables/{table}/rows/{row_id}
 func (h *Handler) DeleteRow(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, tableID, _, ok := h.authorize(w, r, canDelete)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
         return
     }
-    table := chi.URLParam(r, "table")
     rowParam := chi.URLParam(r, "row_id")
-    if table == "" || rowParam == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table or row_id"})
+    if rowParam == "" {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing row_id"})
         return
     }
     rid, err := uuid.Parse(rowParam)
@@ -368,10 +535,14 @@ func (h *Handler) DeleteRow(w http.ResponseWriter, r *http.Request) {
         httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid row_id"})
         return
     }
-    deleted, err := h.repo.DeleteUserTableRow(r.Context(), orgID, table, rid)
+    var deleted bool
+    err = h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        var err error
+        deleted, err = automations.DeleteRow(r.Context(), tx, orgID, tableID, table, rid)
+        return err
+    })
     if err != nil {
-        status, msg := httpserver.PGErrorMessage(err, "delete failed")
-        httpserver.JSON(w, status, map[string]string{"error": msg})
+        h.writeRowError(w, r, orgID, err, "delete failed")
         return
     }
     if !deleted {
@@ -383,18 +554,75 @@ func (h *Handler) DeleteRow(w http.ResponseWriter, r *http.Request) {
 
 // RemoveColumn handles DELETE /tables/{table}/columns/{column}
 func (h *Handler) RemoveColumn(w http.ResponseWriter, r *http.Request) {
-    orgID, ok := auth.OrgFromContext(r.Context())
+    orgID, table, tableID, _, ok := h.authorize(w, r, canManage)
     if !ok {
-        httpserver.JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
         return
     }
-    table := chi.URLParam(r, "table")
     column := chi.URLParam(r, "column")
-    if table == "" || column == "" {
-        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing table or column"})
+    if column == "" {
+        httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "missing column"})
         return
     }
-    col, deleted, err := h.repo.RemoveUserTableColumn(r.Context(), orgID, table, column)
+    schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, table)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if deps := computedDependents(schema, column); len(deps) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "column is used by computed columns", "computed_columns": deps})
+        return
+    }
+    policies, err := h.repo.RowPoliciesUsingColumn(r.Context(), orgID, table, column)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if len(policies) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "column is used by row policies", "policies": policies})
+        return
+    }
+    hooks, err := h.repo.WebhooksUsingColumn(r.Context(), orgID, table, column)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if len(hooks) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "column is used by webhook filters", "webhooks": hooks})
+        return
+    }
+    autos, err := h.repo.AutomationsUsingColumn(r.Context(), orgID, tableID, column)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if len(autos) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "column is used by automations", "automations": autos})
+        return
+    }
+    machines, err := h.repo.StateMachinesUsingColumn(r.Context(), orgID, tableID, column)
+    if err != nil {
+        status, msg := httpserver.PGErrorMessage(err, "delete failed")
+        httpserver.JSON(w, status, map[string]string{"error": msg})
+        return
+    }
+    if len(machines) > 0 {
+        httpserver.JSON(w, http.StatusConflict, map[string]any{"error": "column is used by state machines", "state_machines": machines})
+        return
+    }
+    var col models.TableColumn
+    var deleted bool
+    err = h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+        var err error
+        col, deleted, err = tx.RemoveUserTableColumn(r.Context(), orgID, table, column)
+        if err != nil || !deleted {
+            return err
+        }
+        return emitSchema(r.Context(), tx, orgID, models.EventColumnRemoved, tableID, col)
+    })
     if err != nil {
         status, msg := httpserver.PGErrorMessage(err, "delete failed")
         httpserver.JSON(w, status, map[string]string{"error": msg})
@@ -0,0 +1,109 @@
+// Package teams manages which users belong to the team rows that table
+// grants can name.
+package teams
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/repo"
+)
+
+// errNotMember rolls back SetMembers when a user is not in the org.
+var errNotMember = errors.New("user is not a member of the org")
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// Members handles GET /teams/{team_id}/members
+func (h *Handler) Members(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	teamID, ok := httpserver.PathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	members, found, err := h.repo.ListTeamMembers(r.Context(), orgID, teamID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "team not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"members": members})
+}
+
+// SetMembers handles PUT /teams/{team_id}/members with body
+// {"user_ids":["..."]} and replaces the team's members. Every user must
+// belong to the org.
+func (h *Handler) SetMembers(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	teamID, ok := httpserver.PathID(w, r, "team_id")
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+	if !httpserver.Decode(w, r, &body) {
+		return
+	}
+	unique := make(map[uuid.UUID]struct{}, len(body.UserIDs))
+	for _, id := range body.UserIDs {
+		unique[id] = struct{}{}
+	}
+
+	var found bool
+	err := h.repo.InTx(r.Context(), func(tx repo.Repo) error {
+		var err error
+		if _, found, err = tx.ListTeamMembers(r.Context(), orgID, teamID); err != nil || !found {
+			return err
+		}
+		if err := tx.ClearTeamMembers(r.Context(), orgID, teamID); err != nil {
+			return err
+		}
+		n, err := tx.AddTeamMembers(r.Context(), orgID, teamID, body.UserIDs)
+		if err != nil {
+			return err
+		}
+		if n < len(unique) {
+			return errNotMember
+		}
+		return nil
+	})
+	if errors.Is(err, errNotMember) {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "user_ids must all be members of the org"})
+		return
+	}
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "team not found"})
+		return
+	}
+	members, _, err := h.repo.ListTeamMembers(r.Context(), orgID, teamID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"members": members})
+}
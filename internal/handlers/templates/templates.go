@@ -0,0 +1,65 @@
+// Package templates exposes the built-in table templates and provisions them
+// into the caller's org.
+package templates
+
+import (
+	"net/http"
+
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/repo"
+	"yourapp/internal/templates"
+)
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// List handles GET /templates: every template with the org's installed
+// version, plus the available template sets.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	statuses, err := templates.Statuses(r.Context(), h.repo, orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "list templates failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"templates": statuses, "sets": templates.Sets()})
+}
+
+// Provision handles POST /templates/provision with body
+// { "templates": ["cmms"] } naming templates and/or sets. Re-running it is
+// safe and adds columns introduced by newer template versions.
+func (h *Handler) Provision(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var body struct {
+		Templates []string `json:"templates"`
+	}
+	// The body is optional
+	if r.ContentLength != 0 && !httpserver.Decode(w, r, &body) {
+		return
+	}
+	if len(body.Templates) == 0 {
+		body.Templates = []string{templates.DefaultSet}
+	}
+	if _, err := templates.Resolve(body.Templates...); err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	results, err := templates.Provision(r.Context(), h.repo, orgID, body.Templates...)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "provision failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"results": results})
+}
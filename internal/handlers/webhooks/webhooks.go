@@ -0,0 +1,400 @@
+// Package webhooks manages the org's webhook subscriptions and their
+// delivery logs. Delivery itself happens in internal/webhooks.
+package webhooks
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"yourapp/internal/formula"
+	httpserver "yourapp/internal/http"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	hooks "yourapp/internal/webhooks"
+)
+
+// events are the event types a webhook can subscribe to.
+var events = map[string]bool{
+	models.EventRowCreated:    true,
+	models.EventRowUpdated:    true,
+	models.EventRowDeleted:    true,
+	models.EventTableCreated:  true,
+	models.EventTableDeleted:  true,
+	models.EventColumnAdded:   true,
+	models.EventColumnRemoved: true,
+}
+
+type Handler struct {
+	repo repo.Repo
+}
+
+func New(repo repo.Repo) *Handler { return &Handler{repo: repo} }
+
+// input is the request body of Create and Update.
+type input struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Table  string   `json:"table"`  // name or slug; empty for every table
+	Filter string   `json:"filter"` // e.g. "status = 'COMPLETED'"
+	Active *bool    `json:"active"` // default true
+}
+
+// List handles GET /webhooks
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.repo.ListWebhooks(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"webhooks": list})
+}
+
+// Get handles GET /webhooks/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	hook, found, err := h.repo.GetWebhook(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"webhook": hook})
+}
+
+// Create handles POST /webhooks with body
+// {"name":"ERP","url":"https://erp.example/hooks","events":["row.updated"],"table":"work_orders","filter":"status = 'COMPLETED'"}.
+// The response is the only one to carry the signing secret.
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := h.decode(w, r, orgID)
+	if !ok {
+		return
+	}
+	secret, err := hooks.NewSecret()
+	if err != nil {
+		httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "create failed"})
+		return
+	}
+	hook.Secret = secret
+	id, err := h.repo.CreateWebhook(r.Context(), orgID, hook)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "create failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created, _, err := h.repo.GetWebhook(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	created.Secret = secret
+	httpserver.JSON(w, http.StatusCreated, map[string]any{"webhook": created})
+}
+
+// Update handles PUT /webhooks/{id} with the same body as Create and
+// replaces the webhook's settings; the secret is kept.
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	hook, ok := h.decode(w, r, orgID)
+	if !ok {
+		return
+	}
+	hook.ID = id
+	found, err := h.repo.UpdateWebhook(r.Context(), orgID, hook)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	updated, _, err := h.repo.GetWebhook(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"webhook": updated})
+}
+
+// Delete handles DELETE /webhooks/{id}; pending deliveries are dropped.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.DeleteWebhook(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "delete failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !deleted {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"deleted": true, "id": id})
+}
+
+// RotateSecret handles POST /webhooks/{id}/rotate-secret and returns the
+// new secret. Deliveries from then on, retries included, use it.
+func (h *Handler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	secret, err := hooks.NewSecret()
+	if err != nil {
+		httpserver.JSON(w, http.StatusInternalServerError, map[string]string{"error": "update failed"})
+		return
+	}
+	found, err := h.repo.SetWebhookSecret(r.Context(), orgID, id, secret)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "update failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"id": id, "secret": secret})
+}
+
+// Ping handles POST /webhooks/{id}/ping and queues a ping event for the
+// webhook, even when it is inactive.
+func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, found, err := h.repo.PingWebhook(r.Context(), orgID, id)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "ping failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusAccepted, map[string]any{"delivery_id": deliveryID})
+}
+
+// Deliveries handles GET /webhooks/{id}/deliveries?status=dead&limit=50,
+// the webhook's delivery log, newest first. status=dead lists the
+// dead-letter queue.
+func (h *Handler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "status must be pending, delivered or dead"})
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+	_, found, err := h.repo.GetWebhook(r.Context(), orgID, id)
+	if err != nil {
+		code, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	list, err := h.repo.ListWebhookDeliveries(r.Context(), orgID, id, status, limit)
+	if err != nil {
+		code, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, code, map[string]string{"error": msg})
+		return
+	}
+	httpserver.JSON(w, http.StatusOK, map[string]any{"deliveries": list})
+}
+
+// Redeliver handles POST /webhooks/{id}/deliveries/{delivery_id}/redeliver
+// and queues the delivery again with a fresh retry budget, e.g. to replay a
+// dead one once the receiver is fixed.
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	orgID, _, ok := httpserver.Caller(w, r)
+	if !ok {
+		return
+	}
+	id, ok := httpserver.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "delivery_id"), 10, 64)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid delivery_id"})
+		return
+	}
+	found, err := h.repo.RedeliverWebhookDelivery(r.Context(), orgID, id, deliveryID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "redeliver failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !found {
+		httpserver.JSON(w, http.StatusNotFound, map[string]string{"error": "delivery not found"})
+		return
+	}
+	httpserver.JSON(w, http.StatusAccepted, map[string]any{"delivery_id": deliveryID, "status": models.DeliveryPending})
+}
+
+// decode reads and validates a Create or Update body, resolving its table
+// and compiling its filter. It writes the error response when invalid.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (models.Webhook, bool) {
+	defer r.Body.Close()
+	var in input
+	if !httpserver.Decode(w, r, &in) {
+		return models.Webhook{}, false
+	}
+	hook := models.Webhook{
+		Name:   strings.TrimSpace(in.Name),
+		URL:    strings.TrimSpace(in.URL),
+		Filter: strings.TrimSpace(in.Filter),
+		Active: in.Active == nil || *in.Active,
+	}
+	if msg := checkWebhook(&hook, in.Events); msg != "" {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return models.Webhook{}, false
+	}
+	table := strings.TrimSpace(in.Table)
+	if table == "" {
+		if hook.Filter != "" {
+			httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "a filter needs a table"})
+			return models.Webhook{}, false
+		}
+		return hook, true
+	}
+	tables, err := h.repo.ListUserTables(r.Context(), orgID)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.Webhook{}, false
+	}
+	for _, t := range tables {
+		if t.Slug == strings.ToLower(table) || strings.EqualFold(t.Name, table) {
+			id := t.ID
+			hook.TableID = &id
+			table = t.Slug
+			break
+		}
+	}
+	if hook.TableID == nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "table not found"})
+		return models.Webhook{}, false
+	}
+	if hook.Filter == "" {
+		return hook, true
+	}
+	schema, err := h.repo.GetUserTableSchema(r.Context(), orgID, table)
+	if err != nil {
+		status, msg := httpserver.PGErrorMessage(err, "fetch failed")
+		httpserver.JSON(w, status, map[string]string{"error": msg})
+		return models.Webhook{}, false
+	}
+	cols := make(map[string]formula.Type, len(schema))
+	for _, c := range schema {
+		if t, ok := formula.TypeOfColumn(c.Type); ok {
+			cols[strings.ToLower(c.Name)] = t
+		}
+	}
+	compiled, err := formula.CompileEventFilter(hook.Filter, cols)
+	if err != nil {
+		httpserver.JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid filter: " + err.Error()})
+		return models.Webhook{}, false
+	}
+	hook.FilterSQL = compiled.SQL
+	hook.FilterRefs = compiled.Refs
+	return hook, true
+}
+
+// checkWebhook validates the name, URL and event types of a webhook and
+// sets its de-duplicated Events. It returns a message for the client when
+// invalid.
+func checkWebhook(hook *models.Webhook, types []string) string {
+	if hook.Name == "" || len(hook.Name) > 100 {
+		return "name is required (at most 100 characters)"
+	}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url must be an absolute http or https URL"
+	}
+	seen := make(map[string]bool, len(types))
+	hook.Events = make([]string, 0, len(types))
+	for _, t := range types {
+		if !events[t] {
+			return "unknown event type " + strconv.Quote(t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			hook.Events = append(hook.Events, t)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/checklists"
+	"yourapp/internal/files"
+	"yourapp/internal/inventory"
+	"yourapp/internal/labour"
+	"yourapp/internal/requests"
+	"yourapp/internal/workflow"
+)
+
+// WriteError writes err as a JSON error: 400 with the message of a domain
+// package refusing a change, 413 for an upload over its limit, 403 or 422
+// for a refused state transition, 422 when an automation failed, and
+// otherwise what PGErrorMessage maps it to, with fallback as the message
+// of unexpected errors.
+func WriteError(w http.ResponseWriter, err error, fallback string) {
+	if msg, ok := refusal(err); ok {
+		JSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	var transition *workflow.Error
+	var failed *automations.Error
+	switch {
+	case errors.Is(err, files.ErrTooLarge), errors.As(err, &tooLarge):
+		JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "the file is too large"})
+	case errors.Is(err, requests.ErrConverted):
+		JSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, requests.ErrNoTable):
+		JSON(w, http.StatusNotFound, map[string]string{"error": "requests are not set up for this organisation"})
+	case errors.As(err, &transition):
+		status := http.StatusUnprocessableEntity
+		if transition.Forbidden {
+			status = http.StatusForbidden
+		}
+		JSON(w, status, map[string]string{"error": transition.Error()})
+	case errors.As(err, &failed):
+		JSON(w, http.StatusUnprocessableEntity, map[string]string{"error": failed.Error()})
+	default:
+		status, msg := PGErrorMessage(err, fallback)
+		JSON(w, status, map[string]string{"error": msg})
+	}
+}
+
+// refusal returns the message of the domain error in err's chain.
+func refusal(err error) (string, bool) {
+	var (
+		times   *labour.Error
+		check   *checklists.Error
+		stock   *inventory.Error
+		blob    *files.Error
+		request *requests.Error
+	)
+	switch {
+	case errors.As(err, &times):
+		return times.Msg, true
+	case errors.As(err, &check):
+		return check.Msg, true
+	case errors.As(err, &stock):
+		return stock.Msg, true
+	case errors.As(err, &blob):
+		return blob.Msg, true
+	case errors.As(err, &request):
+		return request.Msg, true
+	}
+	return "", false
+}
@@ -30,12 +30,36 @@ func PGErrorMessage(err error, fallback string) (int, string) {
             msg = "A table with this name already exists in your organisation."
         case "columns_table_name_unique":
             msg = "A column with this name already exists for this table."
+        case "stock_levels_serial_key":
+            msg = "This serial number is already in stock."
+        case "time_entries_running_key":
+            msg = "A timer is already running for this user."
+        case "checklist_templates_name_key":
+            msg = "A checklist template with this name already exists."
         default:
             msg = "Duplicate value violates a unique constraint."
         }
     case "23503": // foreign_key_violation
-        status = http.StatusBadRequest
-        msg = "Referenced record not found."
+        switch pgErr.ConstraintName {
+        case "columns_rollup_via_fk", "columns_rollup_target_fk":
+            status = http.StatusConflict
+            msg = "Column is used by a rollup column."
+        case "stock_movements_part_id_fkey", "stock_movements_from_bin_id_fkey",
+            "stock_movements_to_bin_id_fkey", "stock_movements_work_order_id_fkey":
+            status = http.StatusConflict
+            msg = "Record has stock movements and cannot be deleted; archive it instead."
+        default:
+            status = http.StatusBadRequest
+            msg = "Referenced record not found."
+        }
+    case "23P01": // exclusion_violation
+        status = http.StatusConflict
+        switch pgErr.ConstraintName {
+        case "time_entries_no_overlap":
+            msg = "Time entry overlaps another entry of the user."
+        default:
+            msg = "Value conflicts with an existing record."
+        }
     case "23514": // check_violation
         status = http.StatusBadRequest
         if pgErr.Detail != "" { msg = pgErr.Detail } else { msg = "Value violates a check constraint." }
@@ -54,6 +78,9 @@ func PGErrorMessage(err error, fallback string) (int, string) {
     case "22003": // numeric_value_out_of_range
         status = http.StatusBadRequest
         msg = "Numeric value out of range."
+    case "42501": // insufficient_privilege, raised for read-only fields
+        status = http.StatusForbidden
+        if strings.HasPrefix(pgErr.Message, "Field ") { msg = pgErr.Message }
     case "P0001": // raise_exception from functions
         status = http.StatusBadRequest
         // Surface known messages safely, otherwise use fallback
@@ -65,6 +92,8 @@ func PGErrorMessage(err error, fallback string) (int, string) {
             msg = m
         case strings.Contains(m, "Missing required columns"):
             msg = m
+        case strings.Contains(m, "Computed column"):
+            msg = m
         default:
             msg = fallback
         }
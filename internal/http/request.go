@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"yourapp/internal/auth"
+	"yourapp/internal/models"
+)
+
+// maxBody bounds the JSON request bodies Decode reads.
+const maxBody = 1 << 20
+
+// Caller returns the org and session of an authenticated request, writing
+// 401 when missing.
+func Caller(w http.ResponseWriter, r *http.Request) (uuid.UUID, *models.Session, bool) {
+	orgID, ok := auth.OrgFromContext(r.Context())
+	sess, _ := auth.SessionFromContext(r.Context())
+	if !ok || sess == nil {
+		JSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return uuid.Nil, nil, false
+	}
+	return orgID, sess, true
+}
+
+// PathID parses the uuid URL parameter name, writing 400 when invalid.
+func PathID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, name))
+	if err != nil {
+		JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// Decode reads a JSON request body into dst, writing 400 when invalid.
+func Decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return DecodeLimit(w, r, dst, maxBody)
+}
+
+// DecodeLimit is Decode for bodies of up to limit bytes.
+func DecodeLimit(w http.ResponseWriter, r *http.Request, dst any, limit int64) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	if err := dec.Decode(dst); err != nil {
+		JSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return false
+	}
+	return true
+}
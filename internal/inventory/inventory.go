@@ -0,0 +1,347 @@
+// Package inventory moves spare parts in and out of stock.
+//
+// Parts are rows of the table provisioned from the parts template and bins
+// rows of the bins template. Stock only changes through movements stored in
+// the append-only ledger (app.stock_movements), which the database applies
+// to the stock levels per part, bin, lot and serial number, refusing any
+// that would take a level below zero.
+//
+// Outgoing movements (issues, transfers, downward adjustments) that do not
+// name the lot or serial number to take are allocated here: the part's
+// stock is taken level by level, the earliest expiry first for parts kept
+// first-expired-first-out (fefo) and otherwise the oldest receipt first,
+// skipping expired lots. One request may thus store several movements.
+// Issues record the part's cost as their unit cost. After the movements
+// the part row's quantity column is set to the quantity on hand, so lists,
+// search, automations and rollups see it.
+//
+// Issues to a work order, less the returns of what it did not use, are its
+// part lines; their cost is kept in the work order's parts_cost column.
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// Slugs of the tables of the parts and bins templates.
+const (
+	PartTable = "parts"
+	BinTable  = "bins"
+)
+
+// Tracking of a part, its tracking column: none, by lot (with an expiry
+// date), or by serial number, one unit each.
+const (
+	TrackNone   = "NONE"
+	TrackLot    = "LOT"
+	TrackSerial = "SERIAL"
+)
+
+// epsilon absorbs the rounding of quantities split across levels.
+const epsilon = 1e-9
+
+// Error is a movement refused for what it asks, answered with 400.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func refuse(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Move stores a movement of a part, split over the levels it takes from
+// when it is outgoing, and updates the part's quantity, in one transaction.
+// It returns the movements stored. Callers check that the part, bins and
+// work order are rows of their tables the user may see. Like the PM
+// scheduler it acts for the system, so the part row is updated whatever the
+// user's field access; CreatedBy still records the user.
+func Move(ctx context.Context, r repo.Repo, orgID, userID uuid.UUID, m models.StockMovement) ([]models.StockMovement, error) {
+	return MoveAll(ctx, r, orgID, userID, []models.StockMovement{m})
+}
+
+// MoveAll stores movements like Move, all or none of them. The parts they
+// move and the work orders they issue to or return from are updated once,
+// after the last.
+func MoveAll(ctx context.Context, r repo.Repo, orgID, userID uuid.UUID, ms []models.StockMovement) ([]models.StockMovement, error) {
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	for i := range ms {
+		if userID != uuid.Nil {
+			ms[i].CreatedBy = &userID
+		}
+		if err := check(ms[i]); err != nil {
+			return nil, err
+		}
+	}
+	var out []models.StockMovement
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		parts := map[uuid.UUID]part{}
+		var order []uuid.UUID
+		var orders []uuid.UUID
+		for _, m := range ms {
+			p, ok := parts[m.PartID]
+			if !ok {
+				var err error
+				if p, err = loadPart(ctx, tx, orgID, m.PartID); err != nil {
+					return err
+				}
+				parts[m.PartID] = p
+				order = append(order, m.PartID)
+			}
+			stored, err := p.move(ctx, tx, orgID, m)
+			if err != nil {
+				return err
+			}
+			out = append(out, stored...)
+			if m.WorkOrderID != nil && (m.Kind == models.StockIssue || m.Kind == models.StockReturn) && !slices.Contains(orders, *m.WorkOrderID) {
+				orders = append(orders, *m.WorkOrderID)
+			}
+		}
+		for _, id := range order {
+			if err := parts[id].sync(ctx, tx, orgID); err != nil {
+				return err
+			}
+		}
+		return syncWorkOrders(ctx, tx, orgID, orders)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// move stores one movement of the part, split over the levels it takes
+// from when outgoing and over the lines it returns to when a return names
+// no lot or serial number.
+func (p part) move(ctx context.Context, tx repo.Repo, orgID uuid.UUID, m models.StockMovement) ([]models.StockMovement, error) {
+	if err := p.tracked(m); err != nil {
+		return nil, err
+	}
+	if m.Kind == models.StockIssue && m.UnitCost == nil {
+		m.UnitCost = p.cost
+	}
+	moves := []models.StockMovement{m}
+	var err error
+	switch {
+	case m.FromBinID != nil || m.Kind == models.StockIssue:
+		moves, err = p.allocate(ctx, tx, orgID, m)
+	case m.Kind == models.StockReturn && m.Lot == "" && m.Serial == "":
+		moves, err = p.returnable(ctx, tx, orgID, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.StockMovement, 0, len(moves))
+	for _, mv := range moves {
+		stored, err := tx.InsertStockMovement(ctx, orgID, mv)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, stored)
+	}
+	return out, nil
+}
+
+// check validates what a movement asks regardless of the part.
+func check(m models.StockMovement) error {
+	if math.IsNaN(m.Quantity) || math.IsInf(m.Quantity, 0) || m.Quantity <= 0 {
+		return refuse("quantity must be a positive number")
+	}
+	if m.UnitCost != nil && (math.IsNaN(*m.UnitCost) || math.IsInf(*m.UnitCost, 0) || *m.UnitCost < 0) {
+		return refuse("unit_cost must be a number of 0 or more")
+	}
+	from, to := m.FromBinID != nil, m.ToBinID != nil
+	switch m.Kind {
+	case models.StockReceive:
+		if from || !to {
+			return refuse("a receipt goes into to_bin only")
+		}
+	case models.StockReturn:
+		if from || !to {
+			return refuse("a return goes into to_bin only")
+		}
+		if m.WorkOrderID == nil {
+			return refuse("a return needs the work_order it comes back from")
+		}
+	case models.StockIssue:
+		if to {
+			return refuse("an issue takes from from_bin only")
+		}
+	case models.StockTransfer:
+		if !from || !to {
+			return refuse("a transfer needs from_bin and to_bin")
+		}
+		if *m.FromBinID == *m.ToBinID {
+			return refuse("a transfer needs two different bins")
+		}
+	case models.StockAdjust:
+		if from == to {
+			return refuse("an adjustment needs either to_bin (stock found) or from_bin (stock lost)")
+		}
+	default:
+		return refuse("kind must be receive, issue, transfer, adjust or return")
+	}
+	if m.OrderID != nil && m.Kind != models.StockReceive {
+		return refuse("only receipts can reference an order")
+	}
+	if m.ExpiresOn != "" && m.ToBinID == nil {
+		return refuse("expires_on is given for stock coming in")
+	}
+	return nil
+}
+
+// part is what a movement needs of a part row.
+type part struct {
+	id       uuid.UUID
+	tableID  int64
+	tracking string
+	fefo     bool
+	cost     *float64
+	hasQty   bool // the table has a quantity column
+}
+
+// loadPart reads a part row of the org's parts table.
+func loadPart(ctx context.Context, tx repo.Repo, orgID, id uuid.UUID) (part, error) {
+	p := part{id: id, tracking: TrackNone}
+	tables, err := tx.ListUserTables(ctx, orgID)
+	if err != nil {
+		return p, err
+	}
+	for _, t := range tables {
+		if t.Slug == PartTable {
+			p.tableID = t.ID
+		}
+	}
+	if p.tableID == 0 {
+		return p, fmt.Errorf("no %s table: provision the parts template first", PartTable)
+	}
+	cols, err := tx.GetUserTableSchema(ctx, orgID, PartTable)
+	if err != nil {
+		return p, err
+	}
+	for _, c := range cols {
+		if c.Name == "quantity" && (c.Kind == "" || c.Kind == "value") {
+			p.hasQty = true
+		}
+	}
+	b, found, err := tx.RowSnapshot(ctx, orgID, id)
+	if err != nil {
+		return p, err
+	}
+	if !found {
+		return p, refuse("part %s not found", id)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return p, err
+	}
+	if t, ok := data["tracking"].(string); ok && t != "" {
+		p.tracking = t
+	}
+	p.fefo, _ = data["fefo"].(bool)
+	if c, ok := data["cost"].(float64); ok {
+		p.cost = &c
+	}
+	return p, nil
+}
+
+// tracked checks a movement against the part's tracking: stock coming in
+// names its lot, or serial number one unit at a time. Returns take the lot
+// and serial number they were issued with.
+func (p part) tracked(m models.StockMovement) error {
+	in := m.ToBinID != nil && m.FromBinID == nil && m.Kind != models.StockReturn
+	switch p.tracking {
+	case TrackLot:
+		if in && m.Lot == "" {
+			return refuse("the part is tracked by lot: lot is required")
+		}
+	case TrackSerial:
+		if m.Quantity != math.Trunc(m.Quantity) {
+			return refuse("the part is tracked by serial number: quantity must be a whole number")
+		}
+		if in && m.Serial == "" {
+			return refuse("the part is tracked by serial number: serial is required")
+		}
+	}
+	if m.Serial != "" && m.Quantity != 1 {
+		return refuse("a serial number is one unit: quantity must be 1")
+	}
+	return nil
+}
+
+// allocate splits an outgoing movement over the levels it takes from: those
+// of its bin, lot and serial number where given, in allocation order, until
+// the quantity is covered. Expired lots are only taken when named.
+func (p part) allocate(ctx context.Context, tx repo.Repo, orgID uuid.UUID, m models.StockMovement) ([]models.StockMovement, error) {
+	var lot, serial *string
+	if m.Lot != "" {
+		lot = &m.Lot
+	}
+	if m.Serial != "" {
+		serial = &m.Serial
+	}
+	levels, err := tx.AllocatableStock(ctx, orgID, p.id, m.FromBinID, lot, serial, p.fefo, lot == nil && serial == nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.StockMovement
+	left := m.Quantity
+	for _, l := range levels {
+		if left <= epsilon {
+			break
+		}
+		mv := m
+		bin := l.BinID
+		mv.FromBinID, mv.Lot, mv.Serial = &bin, l.Lot, l.Serial
+		mv.Quantity = min(l.Quantity, left)
+		left -= mv.Quantity
+		out = append(out, mv)
+	}
+	if left > epsilon {
+		where := ""
+		if m.FromBinID != nil {
+			where = " in the bin"
+		}
+		var taken []string
+		if lot != nil {
+			taken = append(taken, "lot "+*lot)
+		}
+		if serial != nil {
+			taken = append(taken, "serial "+*serial)
+		}
+		if len(taken) > 0 {
+			where += " for " + strings.Join(taken, " ")
+		}
+		return nil, refuse("not enough stock%s: %g short", where, left)
+	}
+	return out, nil
+}
+
+// sync sets the part row's quantity column to its quantity on hand.
+func (p part) sync(ctx context.Context, tx repo.Repo, orgID uuid.UUID) error {
+	if !p.hasQty {
+		return nil
+	}
+	stock, err := tx.PartStock(ctx, []uuid.UUID{p.id})
+	if err != nil || len(stock) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{"quantity": stock[0].OnHand})
+	if err != nil {
+		return err
+	}
+	_, _, err = automations.UpdateRow(ctx, tx, orgID, p.tableID, PartTable, p.id, payload)
+	return err
+}
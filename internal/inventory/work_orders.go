@@ -0,0 +1,60 @@
+package inventory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+// PartsCostColumn is the work order column the cost of its parts is kept in.
+const PartsCostColumn = "parts_cost"
+
+// returnable splits a return that names no lot or serial number over what
+// is left of the part's lines on the work order, the last issued first.
+// Each movement is valued at its line's cost by the database.
+func (p part) returnable(ctx context.Context, tx repo.Repo, orgID uuid.UUID, m models.StockMovement) ([]models.StockMovement, error) {
+	lines, err := tx.WorkOrderPartLines(ctx, orgID, *m.WorkOrderID)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.StockMovement
+	left, held := m.Quantity, 0.0
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := lines[i]
+		if l.PartID != p.id || l.Quantity <= epsilon {
+			continue
+		}
+		held += l.Quantity
+		if left <= epsilon {
+			continue
+		}
+		mv := m
+		mv.Lot, mv.Serial = l.Lot, l.Serial
+		mv.Quantity = min(l.Quantity, left)
+		left -= mv.Quantity
+		out = append(out, mv)
+	}
+	if left > epsilon {
+		return nil, refuse("only %g of the part issued to the work order can be returned", held)
+	}
+	return out, nil
+}
+
+// syncWorkOrders sets the parts_cost column of work orders to the cost of
+// the parts they used.
+func syncWorkOrders(ctx context.Context, tx repo.Repo, orgID uuid.UUID, ids []uuid.UUID) error {
+	for _, id := range ids {
+		cost, err := tx.WorkOrderPartsCost(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := pm.SetWorkOrderValues(ctx, tx, orgID, id, map[string]any{PartsCostColumn: cost}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package labour records the time users spend on work orders.
+//
+// Time entries come from timers, started and stopped live, or are entered
+// by hand afterwards. The database keeps a user to one running timer and
+// refuses entries of a user that overlap, running timers included. Each
+// entry is valued at the hourly rate that applied when it was created: the
+// user's own, else that of the work order's team when the user is in it,
+// else the highest of the user's teams.
+//
+// After each change the work order's labour_hours and labour_cost columns
+// are set to the totals of its finished entries, so lists, search,
+// automations and rollups see them.
+package labour
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+)
+
+// Work order columns the labour totals are kept in.
+const (
+	HoursColumn = "labour_hours"
+	CostColumn  = "labour_cost"
+)
+
+// maxEntry bounds the length of an entry entered by hand.
+const maxEntry = 24 * time.Hour
+
+// skew is how far in the future an entry may end, for clocks running ahead.
+const skew = time.Minute
+
+// Error is a change refused for what it asks, answered with 400.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func refuse(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// check refuses a period that is empty, runs backwards, ends in the future
+// or is longer than a day.
+func check(startedAt time.Time, endedAt *time.Time) error {
+	now := time.Now()
+	if startedAt.IsZero() {
+		return refuse("started_at is required")
+	}
+	if startedAt.After(now.Add(skew)) {
+		return refuse("started_at is in the future")
+	}
+	if endedAt == nil {
+		return nil
+	}
+	if !endedAt.After(startedAt) {
+		return refuse("ended_at must be after started_at")
+	}
+	if endedAt.After(now.Add(skew)) {
+		return refuse("ended_at is in the future")
+	}
+	if endedAt.Sub(startedAt) > maxEntry {
+		return refuse("an entry may not be longer than %g hours", maxEntry.Hours())
+	}
+	return nil
+}
+
+// Start starts a timer for userID on a work order and returns its entry.
+// Callers check that the work order is a row the user may see; by is the
+// user starting it.
+func Start(ctx context.Context, r repo.Repo, orgID, workOrderID, userID, by uuid.UUID, note string) (models.TimeEntry, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	var e models.TimeEntry
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		id, err := tx.StartTimer(ctx, orgID, workOrderID, userID, note, &by)
+		if err != nil {
+			return err
+		}
+		e, _, err = tx.GetTimeEntry(ctx, orgID, id)
+		return err
+	})
+	return e, err
+}
+
+// Stop stops a running timer and updates the totals of its work order. It
+// refuses entries that are not running.
+func Stop(ctx context.Context, r repo.Repo, orgID uuid.UUID, e models.TimeEntry) (models.TimeEntry, error) {
+	if e.EndedAt != nil {
+		return e, refuse("the timer is not running")
+	}
+	return change(ctx, r, orgID, e.WorkOrderID, func(tx repo.Repo) (uuid.UUID, error) {
+		stopped, err := tx.StopTimeEntry(ctx, orgID, e.ID)
+		if err == nil && !stopped {
+			err = refuse("the timer is not running")
+		}
+		return e.ID, err
+	})
+}
+
+// Record stores an entry entered by hand and updates the totals of its work
+// order. Callers check that the work order is a row the user may see.
+func Record(ctx context.Context, r repo.Repo, orgID uuid.UUID, e models.TimeEntry) (models.TimeEntry, error) {
+	if e.EndedAt == nil {
+		return e, refuse("ended_at is required")
+	}
+	if err := check(e.StartedAt, e.EndedAt); err != nil {
+		return e, err
+	}
+	return change(ctx, r, orgID, e.WorkOrderID, func(tx repo.Repo) (uuid.UUID, error) {
+		return tx.InsertTimeEntry(ctx, orgID, e)
+	})
+}
+
+// Update sets the period and note of an entry and updates the totals of its
+// work order; an entry given an end is stopped, and a finished entry keeps
+// an end.
+func Update(ctx context.Context, r repo.Repo, orgID uuid.UUID, e models.TimeEntry, startedAt time.Time, endedAt *time.Time, note string) (models.TimeEntry, error) {
+	if endedAt == nil && e.EndedAt != nil {
+		return e, refuse("ended_at is required")
+	}
+	if err := check(startedAt, endedAt); err != nil {
+		return e, err
+	}
+	return change(ctx, r, orgID, e.WorkOrderID, func(tx repo.Repo) (uuid.UUID, error) {
+		_, err := tx.UpdateTimeEntry(ctx, orgID, e.ID, startedAt, endedAt, note)
+		return e.ID, err
+	})
+}
+
+// Delete deletes an entry and updates the totals of its work order.
+func Delete(ctx context.Context, r repo.Repo, orgID uuid.UUID, e models.TimeEntry) error {
+	_, err := change(ctx, r, orgID, e.WorkOrderID, func(tx repo.Repo) (uuid.UUID, error) {
+		_, err := tx.DeleteTimeEntry(ctx, orgID, e.ID)
+		return uuid.Nil, err
+	})
+	return err
+}
+
+// change runs fn and sets the totals of the work order in one transaction,
+// returning the entry of the id fn returns. Like the PM scheduler it acts
+// for the system, so the work order is updated whatever the user's field
+// access.
+func change(ctx context.Context, r repo.Repo, orgID, workOrderID uuid.UUID, fn func(tx repo.Repo) (uuid.UUID, error)) (models.TimeEntry, error) {
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	var e models.TimeEntry
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		id, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		if id != uuid.Nil {
+			if e, _, err = tx.GetTimeEntry(ctx, orgID, id); err != nil {
+				return err
+			}
+		}
+		return sync(ctx, tx, orgID, workOrderID)
+	})
+	return e, err
+}
+
+// sync sets the labour columns of a work order to the totals of its
+// finished entries.
+func sync(ctx context.Context, tx repo.Repo, orgID, workOrderID uuid.UUID) error {
+	hours, cost, err := tx.WorkOrderLabour(ctx, workOrderID)
+	if err != nil {
+		return err
+	}
+	return pm.SetWorkOrderValues(ctx, tx, orgID, workOrderID, map[string]any{
+		HoursColumn: round(hours),
+		CostColumn:  round(cost),
+	})
+}
+
+// Summarise totals the finished entries of a work order per user and
+// against its estimated hours, when it has an estimate.
+func Summarise(entries []models.TimeEntry, estimated *float64) models.LabourSummary {
+	s := models.LabourSummary{EstimatedHours: estimated, ByUser: []models.LabourUserTotal{}}
+	at := map[uuid.UUID]int{}
+	for _, e := range entries {
+		if e.EndedAt == nil {
+			s.Running++
+			continue
+		}
+		i, ok := at[e.UserID]
+		if !ok {
+			i = len(s.ByUser)
+			at[e.UserID] = i
+			s.ByUser = append(s.ByUser, models.LabourUserTotal{UserID: e.UserID, UserEmail: e.UserEmail, UserName: e.UserName})
+		}
+		s.Hours += e.Hours
+		s.ByUser[i].Hours += e.Hours
+		if e.Cost != nil {
+			s.Cost += *e.Cost
+			s.ByUser[i].Cost += *e.Cost
+		}
+	}
+	s.Hours, s.Cost = round(s.Hours), round(s.Cost)
+	for i := range s.ByUser {
+		s.ByUser[i].Hours, s.ByUser[i].Cost = round(s.ByUser[i].Hours), round(s.ByUser[i].Cost)
+	}
+	if estimated != nil {
+		v := round(s.Hours - *estimated)
+		s.VarianceHours = &v
+	}
+	return s
+}
+
+// round rounds hours and costs to hundredths.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
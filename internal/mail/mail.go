@@ -0,0 +1,97 @@
+// Package mail sends email. Features queue messages in the mail outbox
+// (app.outbound_emails) inside their own transaction, and the Mailer sends
+// them afterwards through a Sender, retrying failures, so nothing is sent
+// for a change that was rolled back.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is one email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string // plain text
+}
+
+// Sender hands a message over for delivery.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// ValidAddress reports whether s is a bare email address such as
+// "ops@example.com", without a display name.
+func ValidAddress(s string) bool {
+	a, err := netmail.ParseAddress(s)
+	return err == nil && a.Name == "" && a.Address == s
+}
+
+// SMTPSender sends through an SMTP server, with PLAIN authentication when a
+// username is set.
+type SMTPSender struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPSender) Send(ctx context.Context, m Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	msg, err := compose(s.From, m, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, m.To, msg)
+}
+
+// compose renders m as a UTF-8 plain text message.
+func compose(from string, m Message, date time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&b)
+	if _, err := w.Write([]byte(m.Body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// oneLine keeps a header value on one line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// LogSender only logs messages; it stands in for SMTP in development.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m Message) error {
+	slog.InfoContext(ctx, "email (not sent, no SMTP server configured)",
+		"to", strings.Join(m.To, ", "), "subject", m.Subject, "body", m.Body)
+	return nil
+}
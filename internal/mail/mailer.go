@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// Defaults of Options fields left zero.
+const (
+	DefaultPollInterval = 10 * time.Second
+	DefaultMaxAttempts  = 5
+	DefaultBatchSize    = 20
+)
+
+// sendTimeout bounds the lease of a claimed message; net/smtp cannot be
+// cancelled, so it is generous.
+const sendTimeout = 2 * time.Minute
+
+// Options tune a Mailer.
+type Options struct {
+	PollInterval time.Duration // how often to look for due messages
+	MaxAttempts  int           // attempts before a message is dead
+	BatchSize    int           // messages claimed, and sent concurrently, at once
+}
+
+// Mailer sends due messages of the mail outbox of every org.
+type Mailer struct {
+	repo   repo.Repo
+	sender Sender
+	opts   Options
+}
+
+// NewMailer returns a Mailer sending through s using r, which must not be
+// bound to an org.
+func NewMailer(r repo.Repo, s Sender, opts Options) *Mailer {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Mailer{repo: r, sender: s, opts: opts}
+}
+
+// Run sends due messages every PollInterval until ctx is done.
+func (m *Mailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+	slog.InfoContext(ctx, "mailer started", "poll_interval", m.opts.PollInterval.String())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := m.SendDue(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "mail send failed", "err", err)
+				}
+				if err != nil || n < m.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// SendDue claims one batch of due messages, sends them and reports how many
+// were claimed.
+func (m *Mailer) SendDue(ctx context.Context) (int, error) {
+	claimed, err := m.repo.ClaimOutboundEmails(ctx, m.opts.BatchSize, sendTimeout)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func(c models.ClaimedJob) {
+			defer wg.Done()
+			m.send(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+	return len(claimed), nil
+}
+
+// send sends one claimed message and records the outcome.
+func (m *Mailer) send(ctx context.Context, c models.ClaimedJob) {
+	ctx = repo.WithOrg(ctx, c.OrgID)
+	e, found, err := m.repo.GetOutboundEmail(ctx, c.OrgID, c.ID)
+	if err != nil || !found {
+		return
+	}
+	err = m.sender.Send(ctx, Message{To: e.Recipients, Subject: e.Subject, Body: e.Body})
+	if err == nil {
+		m.record(ctx, c, models.EmailSent, "", time.Now())
+		return
+	}
+	slog.WarnContext(ctx, "email send failed", "email_id", c.ID, "attempt", e.Attempts, "err", err)
+	if e.Attempts >= m.opts.MaxAttempts {
+		m.record(ctx, c, models.EmailDead, err.Error(), time.Now())
+		return
+	}
+	m.record(ctx, c, models.EmailPending, err.Error(), time.Now().Add(time.Duration(e.Attempts)*time.Minute))
+}
+
+func (m *Mailer) record(ctx context.Context, c models.ClaimedJob, status, msg string, next time.Time) {
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := m.repo.RecordEmailAttempt(ctx, c.OrgID, c.ID, status, msg, next); err != nil {
+		slog.ErrorContext(ctx, "record email attempt failed", "email_id", c.ID, "err", err)
+	}
+}
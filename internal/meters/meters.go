@@ -0,0 +1,420 @@
+// Package meters ingests the readings of meters and runs the rules on them.
+//
+// Meters are rows of the table provisioned from the meters template, each
+// read on an asset: run hours, cycles, energy, a temperature. Every reading
+// is stored in app.meter_readings; the meter row keeps the latest in its
+// reading and read_on columns, which meter-based PM schedules follow (see
+// internal/pm), so a new latest reading brings the org's next PM scan
+// forward.
+//
+// Rules are checked on each new latest reading, in the order the readings
+// were taken; readings older than the latest one are stored for the time
+// series only. Thresholds fire when the reading crosses them, not on every
+// reading beyond them; deltas fire when the reading moves by at least their
+// value from the previous one. A rule either creates a work order for the
+// meter's asset, or flags the open work orders of the asset. A rule whose
+// previous work order is still open flags that one instead of creating
+// another.
+package meters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// MeterTable is the slug of the table of the meters template.
+const MeterTable = "meters"
+
+// MaxReadings bounds the readings of one ingestion.
+const MaxReadings = 10000
+
+// Result is what an ingestion did.
+type Result struct {
+	Inserted   int                 `json:"inserted"`
+	Duplicates int                 `json:"duplicates"` // already stored at the same instant
+	Alerts     []models.MeterAlert `json:"alerts"`
+}
+
+// Ingest stores readings of meters of an org, updates the meters' latest
+// reading and runs their rules, all in one transaction. Callers check that
+// every MeterID is a meter the user may edit. It acts for the system, like
+// the PM scheduler, so the work orders it creates or flags are not subject
+// to the user's row policies and field access rules; CreatedBy still
+// records the user.
+func Ingest(ctx context.Context, r repo.Repo, orgID, userID uuid.UUID, readings []models.MeterReading) (Result, error) {
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	res := Result{Alerts: []models.MeterAlert{}}
+	in := &ingester{orgID: orgID, today: time.Now().UTC().Format(time.DateOnly)}
+	if err := in.load(ctx, r); err != nil {
+		return res, err
+	}
+
+	// Readings of each meter, in the order they were taken.
+	byMeter := map[uuid.UUID][]models.MeterReading{}
+	var order []uuid.UUID
+	for _, m := range readings {
+		if _, ok := byMeter[m.MeterID]; !ok {
+			order = append(order, m.MeterID)
+		}
+		if userID != uuid.Nil {
+			m.CreatedBy = &userID
+		}
+		byMeter[m.MeterID] = append(byMeter[m.MeterID], m)
+	}
+	changed := false
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		for _, meterID := range order {
+			list := byMeter[meterID]
+			slices.SortStableFunc(list, func(a, b models.MeterReading) int { return a.ReadAt.Compare(b.ReadAt) })
+			moved, err := in.meter(ctx, tx, meterID, list, &res)
+			if err != nil {
+				return err
+			}
+			changed = changed || moved
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if changed {
+		// Meter schedules pick the new readings up at the next scan; a
+		// failure here only delays it.
+		_ = r.RequestPMScan(ctx, orgID)
+	}
+	return res, nil
+}
+
+// ingester runs one ingestion for an org.
+type ingester struct {
+	orgID          uuid.UUID
+	today          string
+	meterTable     int64
+	meterCols      map[string]bool
+	workOrderTable int64
+	workOrderCols  map[string]models.TableColumn // value columns by name
+}
+
+// load looks up the meter and work order tables of the org. Orgs without a
+// work order table store readings, but their rules fire without acting.
+func (in *ingester) load(ctx context.Context, r repo.Repo) error {
+	tables, err := r.ListUserTables(ctx, in.orgID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		switch t.Slug {
+		case MeterTable:
+			in.meterTable = t.ID
+		case pm.WorkOrderTable:
+			in.workOrderTable = t.ID
+		}
+	}
+	if in.meterTable == 0 {
+		return fmt.Errorf("no %s table: provision the meters template first", MeterTable)
+	}
+	cols, err := r.GetUserTableSchema(ctx, in.orgID, MeterTable)
+	if err != nil {
+		return err
+	}
+	in.meterCols = map[string]bool{}
+	for _, c := range cols {
+		if c.Kind == "" || c.Kind == "value" {
+			in.meterCols[c.Name] = true
+		}
+	}
+	if in.workOrderTable == 0 {
+		return nil
+	}
+	cols, err = r.GetUserTableSchema(ctx, in.orgID, pm.WorkOrderTable)
+	if err != nil {
+		return err
+	}
+	in.workOrderCols = map[string]models.TableColumn{}
+	for _, c := range cols {
+		if c.Kind == "" || c.Kind == "value" {
+			in.workOrderCols[c.Name] = c
+		}
+	}
+	return nil
+}
+
+// meter stores the readings of one meter, oldest first, and runs its rules
+// on those that are newer than its latest reading. moved reports whether
+// the latest reading changed.
+func (in *ingester) meter(ctx context.Context, tx repo.Repo, meterID uuid.UUID, readings []models.MeterReading, res *Result) (bool, error) {
+	b, found, err := tx.RowSnapshot(ctx, in.orgID, meterID)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, fmt.Errorf("meter %s not found", meterID)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return false, err
+	}
+	latest, hasLatest, err := tx.LatestMeterReading(ctx, in.orgID, meterID)
+	if err != nil {
+		return false, err
+	}
+	var previous *float64
+	if hasLatest {
+		v := latest.Value
+		previous = &v
+	} else if v, ok := data["reading"].(float64); ok {
+		// Readings entered on the meter row before any was ingested
+		previous = &v
+	}
+	rules, err := tx.ListMeterRules(ctx, in.orgID, meterID)
+	if err != nil {
+		return false, err
+	}
+
+	moved := false
+	for _, m := range readings {
+		rec, inserted, err := tx.InsertMeterReading(ctx, in.orgID, m)
+		if err != nil {
+			return false, err
+		}
+		if !inserted {
+			res.Duplicates++
+			continue
+		}
+		res.Inserted++
+		if hasLatest && !rec.ReadAt.After(latest.ReadAt) {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.Active || !crossed(rule, rec.Value, previous) {
+				continue
+			}
+			alert, err := in.fire(ctx, tx, data, rule, rec, previous)
+			if err != nil {
+				return false, fmt.Errorf("meter rule %q: %w", rule.Name, err)
+			}
+			res.Alerts = append(res.Alerts, alert)
+		}
+		latest, hasLatest, moved = rec, true, true
+		v := rec.Value
+		previous = &v
+	}
+	if !moved {
+		return false, nil
+	}
+
+	values := map[string]any{"reading": latest.Value, "read_on": latest.ReadAt.UTC().Format(time.DateOnly)}
+	for col := range values {
+		if !in.meterCols[col] {
+			delete(values, col)
+		}
+	}
+	if len(values) > 0 {
+		payload, err := json.Marshal(values)
+		if err != nil {
+			return false, err
+		}
+		if _, _, err := automations.UpdateRow(ctx, tx, in.orgID, in.meterTable, MeterTable, meterID, payload); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// crossed reports whether a reading of value, following previous (nil for
+// a meter's first reading), fires rule.
+func crossed(rule models.MeterRule, value float64, previous *float64) bool {
+	switch rule.Kind {
+	case models.MeterRuleAbove:
+		return value > rule.Value && (previous == nil || *previous <= rule.Value)
+	case models.MeterRuleBelow:
+		return value < rule.Value && (previous == nil || *previous >= rule.Value)
+	case models.MeterRuleDelta:
+		return previous != nil && math.Abs(value-*previous) >= rule.Value
+	}
+	return false
+}
+
+// fire runs the action of a rule fired by a reading of the meter with data
+// and records the alert.
+func (in *ingester) fire(ctx context.Context, tx repo.Repo, meter map[string]any, rule models.MeterRule, m models.MeterReading, previous *float64) (models.MeterAlert, error) {
+	alert := models.MeterAlert{
+		RuleID:       rule.ID,
+		RuleName:     rule.Name,
+		MeterID:      m.MeterID,
+		ReadingID:    m.ID,
+		Value:        m.Value,
+		Previous:     previous,
+		Action:       rule.Action,
+		WorkOrderIDs: []uuid.UUID{},
+	}
+	if in.workOrderTable != 0 {
+		reason := describe(meter, rule, m.Value, previous)
+		var err error
+		switch rule.Action {
+		case models.MeterCreateWorkOrder:
+			alert.WorkOrderIDs, err = in.createWorkOrder(ctx, tx, meter, rule, m.Value, reason)
+		case models.MeterFlagWorkOrders:
+			alert.WorkOrderIDs, err = in.flagWorkOrders(ctx, tx, meter, reason)
+		}
+		if err != nil {
+			return alert, err
+		}
+	}
+	return tx.RecordMeterAlert(ctx, in.orgID, alert)
+}
+
+// createWorkOrder creates the work order of a rule for the meter's asset,
+// or flags the one the rule created last while it is still open.
+func (in *ingester) createWorkOrder(ctx context.Context, tx repo.Repo, meter map[string]any, rule models.MeterRule, value float64, reason string) ([]uuid.UUID, error) {
+	prev, found, err := tx.LastMeterRuleWorkOrder(ctx, in.orgID, rule.ID)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		flagged, err := in.flag(ctx, tx, prev, reason)
+		if err != nil || flagged {
+			return []uuid.UUID{prev}, err
+		}
+	}
+
+	title := rule.WOTitle
+	if strings.TrimSpace(title) == "" {
+		title = "{rule}: {meter}"
+	}
+	title = strings.NewReplacer(
+		"{rule}", rule.Name,
+		"{meter}", str(meter["name"]),
+		"{value}", strconv.FormatFloat(value, 'f', -1, 64),
+		"{unit}", str(meter["unit"]),
+	).Replace(title)
+	description := reason
+	if d := strings.TrimSpace(rule.WODescription); d != "" {
+		description = d + "\n\n" + reason
+	}
+	values := map[string]any{
+		"title":       strings.TrimSpace(title),
+		"description": description,
+		"due_date":    in.today,
+	}
+	if rule.WOPriority != "" {
+		values["priority"] = rule.WOPriority
+	}
+	if asset := str(meter["asset"]); asset != "" {
+		values["asset"] = asset
+	}
+	for col := range values {
+		if _, ok := in.workOrderCols[col]; !ok {
+			delete(values, col)
+		}
+	}
+	values, err = workflow.Apply(ctx, tx, in.orgID, uuid.Nil, in.workOrderTable, uuid.Nil, values)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	row, err := automations.InsertRow(ctx, tx, in.orgID, in.workOrderTable, pm.WorkOrderTable, payload)
+	if err != nil {
+		return nil, err
+	}
+	return []uuid.UUID{row.RowID}, nil
+}
+
+// flagWorkOrders flags the open work orders of the meter's asset.
+func (in *ingester) flagWorkOrders(ctx context.Context, tx repo.Repo, meter map[string]any, reason string) ([]uuid.UUID, error) {
+	out := []uuid.UUID{}
+	asset, err := uuid.Parse(str(meter["asset"]))
+	col, ok := in.workOrderCols["asset"]
+	if err != nil || !ok {
+		return out, nil
+	}
+	ids, err := tx.ReferencingRows(ctx, col.ID, asset)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		flagged, err := in.flag(ctx, tx, id, reason)
+		if err != nil {
+			return nil, err
+		}
+		if flagged {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// flag sets flagged and flag_reason on a work order while it is open;
+// false when it is not.
+func (in *ingester) flag(ctx context.Context, tx repo.Repo, id uuid.UUID, reason string) (bool, error) {
+	b, found, err := tx.RowSnapshot(ctx, in.orgID, id)
+	if err != nil || !found {
+		return false, err
+	}
+	var wo map[string]any
+	if err := json.Unmarshal(b, &wo); err != nil {
+		return false, err
+	}
+	if !pm.Open(wo) {
+		return false, nil
+	}
+	values := map[string]any{"flagged": true, "flag_reason": reason}
+	for col := range values {
+		if _, ok := in.workOrderCols[col]; !ok {
+			delete(values, col)
+		}
+	}
+	if len(values) == 0 {
+		return true, nil
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return false, err
+	}
+	_, _, err = automations.UpdateRow(ctx, tx, in.orgID, in.workOrderTable, pm.WorkOrderTable, id, payload)
+	return err == nil, err
+}
+
+// describe says why a rule fired, e.g. "Gearbox oil: 92 °C is above 85".
+func describe(meter map[string]any, rule models.MeterRule, value float64, previous *float64) string {
+	unit := ""
+	if u := str(meter["unit"]); u != "" {
+		unit = " " + u
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	name := str(meter["name"])
+	switch rule.Kind {
+	case models.MeterRuleAbove:
+		return fmt.Sprintf("%s: %s%s is above %s", name, f(value), unit, f(rule.Value))
+	case models.MeterRuleBelow:
+		return fmt.Sprintf("%s: %s%s is below %s", name, f(value), unit, f(rule.Value))
+	}
+	return fmt.Sprintf("%s: %s%s moved %s from %s", name, f(value), unit, f(math.Abs(value-*previous)), f(*previous))
+}
+
+func str(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
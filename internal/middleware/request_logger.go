@@ -29,6 +29,10 @@ func (w *responseWriter) Write(b []byte) (int, error) {
     return n, err
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, e.g. so
+// event streams can flush.
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
 // SlogRequestLogger logs each HTTP request with structured fields using slog.
 func SlogRequestLogger(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,7 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -117,35 +118,123 @@ type TableRow struct {
 
 // TableColumn describes a user-defined column for rendering/searching.
 type TableColumn struct {
-    ID                    int64    `json:"id"`
-    Name                  string   `json:"name"`
-    Type                  string   `json:"type"`
-    Required              bool     `json:"required"`
-    Indexed               bool     `json:"indexed"`
-    EnumValues            []string `json:"enum_values,omitempty"`
-    IsReference           bool     `json:"is_reference"`
-    ReferenceTableID      *int64   `json:"reference_table_id,omitempty"`
-    RequireDifferentTable bool     `json:"require_different_table"`
+    ID                    int64         `json:"id"`
+    Name                  string        `json:"name"`
+    Type                  string        `json:"type"`
+    Required              bool          `json:"required"`
+    Indexed               bool          `json:"indexed"`
+    EnumValues            []string      `json:"enum_values,omitempty"`
+    IsReference           bool          `json:"is_reference"`
+    ReferenceTableID      *int64        `json:"reference_table_id,omitempty"`
+    RequireDifferentTable bool          `json:"require_different_table"`
+    Kind                  string        `json:"kind"`                 // value|computed|rollup
+    Expression            string        `json:"expression,omitempty"` // formula source for computed columns
+    Rollup                *RollupSpec   `json:"rollup,omitempty"`     // definition for rollup columns
+    Access                *ColumnAccess `json:"access,omitempty"`     // field-level rules; nil when unrestricted
+    FieldAccess           string        `json:"field_access,omitempty"` // caller's access: edit|read|masked
+}
+
+// Field access levels of the caller on a column (TableColumn.FieldAccess).
+const (
+    FieldEdit   = "edit"
+    FieldRead   = "read"
+    FieldMasked = "masked"
+)
+
+// ColumnAccess restricts a column to org roles: ReadRole is the lowest role
+// that sees its values and EditRole the lowest that may write them. Callers
+// below ReadRole get the field omitted, or masked when Masked is set.
+type ColumnAccess struct {
+    ReadRole OrgRole `json:"read_role,omitempty"`
+    EditRole OrgRole `json:"edit_role,omitempty"`
+    Masked   bool    `json:"masked,omitempty"`
 }
 
 // TableColumnInput mirrors TableColumn fields the user can set when creating.
 type TableColumnInput struct {
-    Name                  string   `json:"name"`
-    Type                  string   `json:"type"` // text|date|bool|enum|uuid|float
-    Required              bool     `json:"required"`
-    Indexed               bool     `json:"indexed"`
-    EnumValues            []string `json:"enum_values,omitempty"`
-    IsReference           bool     `json:"is_reference"`
-    ReferenceTable        string   `json:"reference_table,omitempty"` // slug or name
-    RequireDifferentTable bool     `json:"require_different_table"`
+    Name                  string        `json:"name"`
+    Type                  string        `json:"type"` // text|date|bool|enum|uuid|float
+    Required              bool          `json:"required"`
+    Indexed               bool          `json:"indexed"`
+    EnumValues            []string      `json:"enum_values,omitempty"`
+    IsReference           bool          `json:"is_reference"`
+    ReferenceTable        string        `json:"reference_table,omitempty"` // slug or name
+    RequireDifferentTable bool          `json:"require_different_table"`
+    Kind                  string        `json:"kind,omitempty"`       // value (default) | computed | rollup
+    Expression            string        `json:"expression,omitempty"` // required when kind is computed
+    ExpressionSQL         string        `json:"-"`                    // compiled by the handler, never client-supplied
+    Rollup                *RollupSpec   `json:"rollup,omitempty"`     // required when kind is rollup
+    Access                *ColumnAccess `json:"access,omitempty"`     // optional field-level rules
+    RollupViaColumnID     int64         `json:"-"`                    // resolved by the handler
+    RollupTargetColumnID  int64         `json:"-"`                    // resolved by the handler; 0 for count
+}
+
+// RollupSpec describes how a rollup column aggregates rows of another table
+// that reference this row through a uuid column.
+type RollupSpec struct {
+    Table     string         `json:"table"`            // child table slug or name
+    Via       string         `json:"via"`              // uuid column on the child table pointing at this table
+    Aggregate string         `json:"aggregate"`        // count|sum|min|max|latest|any|all
+    Target    string         `json:"target,omitempty"` // child column to aggregate; not used by count
+    Filter    []RollupFilter `json:"filter,omitempty"` // all must match
+}
+
+// RollupFilter restricts the child rows a rollup aggregates. Same shape as
+// search filterFields.
+type RollupFilter struct {
+    Field     string `json:"field"`
+    Operation string `json:"operation,omitempty"` // eq (default)|cn|in
+    Value     any    `json:"value,omitempty"`
+    Values    []any  `json:"values,omitempty"`
 }
 
 // UserTable represents a user-defined logical table (per org).
 type UserTable struct {
-    ID        int64     `json:"id"`
-    Name      string    `json:"name"`
-    Slug      string    `json:"slug"`
-    CreatedAt time.Time `json:"created_at"`
+    ID          int64             `json:"id"`
+    Name        string            `json:"name"`
+    Slug        string            `json:"slug"`
+    CreatedAt   time.Time         `json:"created_at"`
+    Permissions *TablePermissions `json:"permissions,omitempty"` // the caller's rights, when listed for a user
+}
+
+// TablePermissions are rights on a user table. Any right implies Read.
+type TablePermissions struct {
+    Read         bool `json:"read"`
+    CreateRow    bool `json:"create_row"`
+    EditRow      bool `json:"edit_row"`
+    DeleteRow    bool `json:"delete_row"`
+    ManageSchema bool `json:"manage_schema"` // columns, grants, deleting the table
+}
+
+// TableGrant gives one principal rights on a table. Exactly one of Role
+// (that role and every higher one), UserID or TeamID is set.
+type TableGrant struct {
+    Role      OrgRole    `json:"role,omitempty"`
+    UserID    *uuid.UUID `json:"user_id,omitempty"`
+    UserEmail string     `json:"user_email,omitempty"`
+    TeamID    *uuid.UUID `json:"team_id,omitempty"` // a row of the org's Teams table
+    TablePermissions
+}
+
+// RowPolicy limits the rows of a table one principal sees to those matching
+// a condition, e.g. "team IN current_user.teams". Exactly one of Role (that
+// role and every lower one), UserID or TeamID is set.
+type RowPolicy struct {
+    Name          string     `json:"name"`
+    Role          OrgRole    `json:"role,omitempty"`
+    UserID        *uuid.UUID `json:"user_id,omitempty"`
+    UserEmail     string     `json:"user_email,omitempty"`
+    TeamID        *uuid.UUID `json:"team_id,omitempty"`
+    Expression    string     `json:"expression"`
+    ExpressionSQL string     `json:"-"`              // compiled by the handler, never client-supplied
+    Refs          []string   `json:"refs,omitempty"` // columns the condition reads
+}
+
+// TeamMember is a user belonging to a team.
+type TeamMember struct {
+    ID    uuid.UUID `json:"id"`
+    Email string    `json:"email"`
+    Name  string    `json:"name,omitempty"`
 }
 
 // IndexedRow is a minimal listing item exposing UUIDs and a display label.
@@ -154,6 +243,25 @@ type IndexedRow struct {
     Label string    `json:"label"`
 }
 
+// SearchHit is one row matched by the org-wide search, in the {id,label}
+// shape used by lookups plus the matched column and a highlighted snippet.
+type SearchHit struct {
+    ID      uuid.UUID `json:"id"`
+    Label   string    `json:"label"`
+    Column  string    `json:"column"`
+    Snippet string    `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+    Rank    float64   `json:"rank"`
+}
+
+// SearchGroup collects the hits from one table, best tables first.
+type SearchGroup struct {
+    TableID   int64       `json:"table_id"`
+    TableSlug string      `json:"table_slug"`
+    TableName string      `json:"table_name"`
+    Total     int64       `json:"total"` // matching rows in the table, before the per-table limit
+    Hits      []SearchHit `json:"hits"`
+}
+
 // IndexedField describes an indexed label-capable field and its table.
 type IndexedField struct {
     TableID    int64  `json:"table_id"`
@@ -163,3 +271,780 @@ type IndexedField struct {
     ColumnName string `json:"column_name"`
     ColumnType string `json:"column_type"`
 }
+
+// TemplateInstall records the version of a table template provisioned into an org.
+type TemplateInstall struct {
+    Template    string    `json:"template"`
+    Version     int       `json:"version"`
+    InstalledAt time.Time `json:"installed_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Storage modes of a user table: where its values live.
+const (
+    StorageEAV        = "eav"        // app.values_* tables
+    StorageDual       = "dual"       // EAV, mirrored into the physical table while migrating
+    StorageRelational = "relational" // physical app_data table only
+)
+
+// TableStorage reports the storage engine of a user table.
+type TableStorage struct {
+    TableID       int64      `json:"table_id"`
+    Name          string     `json:"name"`
+    Slug          string     `json:"slug"`
+    Mode          string     `json:"storage_mode"`
+    PhysicalTable string     `json:"physical_table,omitempty"`
+    MigratedAt    *time.Time `json:"migrated_at,omitempty"`
+    RowCount      int64      `json:"row_count"`
+}
+
+// SchemaDocument is the portable form of an org's table definitions used by
+// schema export/import. Columns reuse the add-column input shape, with
+// references expressed as table slugs rather than ids.
+type SchemaDocument struct {
+    Version int           `json:"version"`
+    Tables  []SchemaTable `json:"tables"`
+}
+
+// SchemaTable is one table in a SchemaDocument.
+type SchemaTable struct {
+    Name    string             `json:"name"`
+    Slug    string             `json:"slug,omitempty"`
+    Columns []TableColumnInput `json:"columns"`
+}
+
+// SchemaChange is one step of a schema import plan.
+type SchemaChange struct {
+    Action string   `json:"action"` // add_table|remove_table|add_column|change_column|remove_column
+    Table  string   `json:"table"`
+    Column string   `json:"column,omitempty"`
+    Detail []string `json:"detail,omitempty"` // what differs, for change_column
+}
+
+// SchemaPlan is the result of comparing a SchemaDocument with an org's
+// current tables. Conflicts are differences import cannot apply.
+type SchemaPlan struct {
+    Applied   bool           `json:"applied"`
+    Changes   []SchemaChange `json:"changes"`
+    Conflicts []string       `json:"conflicts,omitempty"`
+}
+
+// Event types recorded in app.events and delivered to webhooks.
+const (
+    EventRowCreated    = "row.created"
+    EventRowUpdated    = "row.updated"
+    EventRowDeleted    = "row.deleted"
+    EventTableCreated  = "table.created"
+    EventTableDeleted  = "table.deleted"
+    EventColumnAdded   = "column.added"
+    EventColumnRemoved = "column.removed"
+    EventPing          = "ping" // sent on request to test an endpoint
+)
+
+// Webhook subscribes an HTTP endpoint to the org's events. Events empty
+// means every event; Table limits it to one table and Filter, a condition
+// over the changed row, to some of its row events.
+type Webhook struct {
+    ID         uuid.UUID `json:"id"`
+    Name       string    `json:"name"`
+    URL        string    `json:"url"`
+    Secret     string    `json:"secret,omitempty"` // only returned when created or rotated
+    Events     []string  `json:"events"`
+    Table      string    `json:"table,omitempty"` // slug
+    TableID    *int64    `json:"-"`
+    Filter     string    `json:"filter,omitempty"`
+    FilterSQL  string    `json:"-"`                     // compiled by the handler, never client-supplied
+    FilterRefs []string  `json:"filter_refs,omitempty"` // columns the filter reads
+    Active     bool      `json:"active"`
+    CreatedAt  time.Time `json:"created_at"`
+    UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Delivery states of a webhook delivery; dead deliveries gave up retrying.
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event queued for one webhook, with the outcome of
+// its latest attempt.
+type WebhookDelivery struct {
+    ID            int64      `json:"id"`
+    EventID       int64      `json:"event_id"`
+    Event         string     `json:"event"`
+    RowID         *uuid.UUID `json:"row_id,omitempty"`
+    Status        string     `json:"status"`
+    Attempts      int        `json:"attempts"`
+    NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"` // pending only
+    LastStatus    int        `json:"last_status,omitempty"`     // HTTP status of the latest attempt
+    LastError     string     `json:"last_error,omitempty"`
+    DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ClaimedJob names queued work of an org (a webhook delivery, an automation
+// run or an email) a worker claimed for an attempt.
+type ClaimedJob struct {
+    ID    int64
+    OrgID uuid.UUID
+}
+
+// WebhookAttempt is what the dispatcher needs to attempt a claimed delivery.
+type WebhookAttempt struct {
+    DeliveryID int64
+    WebhookID  uuid.UUID
+    Attempts   int // including this one
+    Active     bool
+    URL        string
+    Secret     string
+    Event      string
+    Payload    []byte
+}
+
+// Automation triggers: a row of the table was created, updated or deleted,
+// or a field changed (optionally to a given value) on creation or update.
+const (
+    TriggerCreated = "created"
+    TriggerUpdated = "updated"
+    TriggerDeleted = "deleted"
+    TriggerChanged = "changed"
+)
+
+// Automation modes: sync automations run in the transaction of the change,
+// async ones are queued for the runner.
+const (
+    AutomationSync  = "sync"
+    AutomationAsync = "async"
+)
+
+// Automation action types.
+const (
+    ActionSetFields = "set_fields" // set fields of the triggering row
+    ActionCreateRow = "create_row" // insert a row into a table
+    ActionWebhook   = "webhook"    // queue a delivery of the event to a webhook
+    ActionEmail     = "email"      // queue an email
+)
+
+// Automation is an org-defined rule run on row events of a table.
+type Automation struct {
+    ID           uuid.UUID          `json:"id"`
+    Name         string             `json:"name"`
+    Table        string             `json:"table"` // slug
+    TableID      int64              `json:"-"`
+    Trigger      AutomationTrigger  `json:"trigger"`
+    Condition    string             `json:"condition,omitempty"`
+    ConditionSQL string             `json:"-"`
+    Actions      []AutomationAction `json:"actions"`
+    Refs         []string           `json:"-"` // "<table_id>.<column>" read or written
+    Mode         string             `json:"mode"`
+    Active       bool               `json:"active"`
+    CreatedAt    time.Time          `json:"created_at"`
+    UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// AutomationTrigger says which row events run an automation.
+type AutomationTrigger struct {
+    On    string  `json:"on"`
+    Field string  `json:"field,omitempty"` // changed only
+    To    *string `json:"to,omitempty"`    // changed only; compared as text
+}
+
+// AutomationAction is one step of an automation. Values, Subject and Body
+// are formulas; SQL holds them compiled, keyed by column, or by "subject"
+// and "body" for emails.
+type AutomationAction struct {
+    Type      string            `json:"type"`
+    Table     string            `json:"table,omitempty"`      // create_row: target table slug
+    TableID   int64             `json:"-"`
+    Values    map[string]string `json:"values,omitempty"`     // set_fields, create_row: column -> formula
+    WebhookID *uuid.UUID        `json:"webhook_id,omitempty"` // webhook
+    To        []string          `json:"to,omitempty"`         // email: recipient addresses
+    Subject   string            `json:"subject,omitempty"`    // email
+    Body      string            `json:"body,omitempty"`       // email
+    SQL       map[string]string `json:"-"`
+}
+
+// Run states of an automation run; skipped runs hit the loop protection.
+const (
+    RunPending   = "pending"
+    RunSucceeded = "succeeded"
+    RunFailed    = "failed"
+    RunSkipped   = "skipped"
+)
+
+// AutomationRun is one execution, or queued execution, of an automation.
+type AutomationRun struct {
+    ID           int64           `json:"id"`
+    AutomationID uuid.UUID       `json:"automation_id"`
+    EventID      *int64          `json:"event_id,omitempty"`
+    RowID        *uuid.UUID      `json:"row_id,omitempty"`
+    Mode         string          `json:"mode"`
+    Status       string          `json:"status"`
+    Depth        int             `json:"depth"`
+    Attempts     int             `json:"attempts"`
+    Error        string          `json:"error,omitempty"`
+    Result       json.RawMessage `json:"result,omitempty"` // what each action did
+    CreatedAt    time.Time       `json:"created_at"`
+    FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+}
+
+// AutomationJob is what the runner needs to execute a claimed async run.
+type AutomationJob struct {
+    RunID      int64
+    Attempts   int // including this one
+    Depth      int
+    EventID    int64
+    RowID      uuid.UUID
+    Automation Automation
+}
+
+// Email states of the mail outbox.
+const (
+    EmailPending = "pending"
+    EmailSent    = "sent"
+    EmailDead    = "dead"
+)
+
+// OutboundEmail is a queued email.
+type OutboundEmail struct {
+    ID         int64
+    Recipients []string
+    Subject    string
+    Body       string
+    Attempts   int // including this one
+}
+
+// RowEvent is a row event of a table as a stream subscriber may see it.
+type RowEvent struct {
+    ID        int64           `json:"id,string"`
+    Txid      int64           `json:"-"` // writing transaction; streams read in (Txid, ID) order
+    Type      string          `json:"type"`
+    Table     string          `json:"table"` // slug
+    RowID     uuid.UUID       `json:"row_id"`
+    Data      json.RawMessage `json:"data"`     // null when deleted or no longer visible
+    Previous  json.RawMessage `json:"previous"` // null when created or not visible before
+    CreatedAt time.Time       `json:"created_at"`
+}
+
+// StateMachine is the lifecycle of an enum column of a table: the states
+// rows may be created in, the allowed transitions and what entering each
+// state requires and stamps.
+type StateMachine struct {
+    ID          uuid.UUID             `json:"id"`
+    Table       string                `json:"table"` // slug
+    TableID     int64                 `json:"-"`
+    Column      string                `json:"column"`
+    Initial     []string              `json:"initial"` // empty: any state
+    Transitions []StateTransition     `json:"transitions"`
+    States      map[string]StateRules `json:"states"`
+    Refs        []string              `json:"-"`
+    CreatedAt   time.Time             `json:"created_at"`
+    UpdatedAt   time.Time             `json:"updated_at"`
+}
+
+// AnyState in From matches every state.
+const AnyState = "*"
+
+// StateTransition allows moving from any of From to To. Roles are the org
+// roles that may make it, Owners always may; empty means anyone who may
+// edit the row.
+type StateTransition struct {
+    From  []string  `json:"from"`
+    To    string    `json:"to"`
+    Roles []OrgRole `json:"roles,omitempty"`
+}
+
+// StateRules is what entering a state takes. Set maps columns to formulas
+// whose values are written on entry unless the change sets the column
+// itself; SQL holds them compiled.
+type StateRules struct {
+    Required []RequiredField   `json:"required,omitempty"`
+    Set      map[string]string `json:"set,omitempty"`
+    SQL      map[string]string `json:"-"`
+}
+
+// RequiredField is a column that must have a value on entering a state, or
+// only when the When formula holds.
+type RequiredField struct {
+    Field   string `json:"field"`
+    When    string `json:"when,omitempty"`
+    WhenSQL string `json:"-"`
+}
+
+// Triggers and statuses of PM occurrences.
+const (
+    PMTriggerCalendar = "calendar"
+    PMTriggerMeter    = "meter"
+    PMCreated         = "created" // a work order was generated
+    PMSkipped         = "skipped" // see Note
+)
+
+// PMOccurrence is an occurrence of a PM schedule the scheduler handled:
+// the date it falls on (DueOn, YYYY-MM-DD) or the meter reading it falls
+// due at, and the work order generated for it or why it was skipped.
+type PMOccurrence struct {
+    ID          int64      `json:"id"`
+    PMID        uuid.UUID  `json:"pm_id"`
+    Trigger     string     `json:"trigger"`
+    DueOn       string     `json:"due_on,omitempty"`
+    DueReading  *float64   `json:"due_reading,omitempty"`
+    WorkOrderID *uuid.UUID `json:"work_order_id,omitempty"`
+    Status      string     `json:"status"`
+    Note        string     `json:"note,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// MeterReading is one reading of a meter row at an instant.
+type MeterReading struct {
+    ID        int64      `json:"id"`
+    MeterID   uuid.UUID  `json:"meter_id"`
+    Value     float64    `json:"value"`
+    ReadAt    time.Time  `json:"read_at"`
+    CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+}
+
+// MeterBucket aggregates the readings of a meter over one interval of a
+// time series, starting at Start.
+type MeterBucket struct {
+    Start    time.Time `json:"start"`
+    Min      float64   `json:"min"`
+    Max      float64   `json:"max"`
+    Avg      float64   `json:"avg"`
+    Readings int64     `json:"readings"`
+}
+
+// Meter rule kinds: the reading rises above or falls below Value, or moves
+// by Value or more from the previous reading.
+const (
+    MeterRuleAbove = "above"
+    MeterRuleBelow = "below"
+    MeterRuleDelta = "delta"
+)
+
+// Meter rule actions.
+const (
+    MeterCreateWorkOrder = "create_work_order"
+    MeterFlagWorkOrders  = "flag_work_orders" // the open work orders of the meter's asset
+)
+
+// MeterRule is a threshold or delta checked on each new latest reading of
+// a meter. WO fields shape the work orders create_work_order makes.
+type MeterRule struct {
+    ID              uuid.UUID  `json:"id"`
+    MeterID         uuid.UUID  `json:"meter_id"`
+    Name            string     `json:"name"`
+    Kind            string     `json:"kind"`
+    Value           float64    `json:"value"`
+    Action          string     `json:"action"`
+    WOTitle         string     `json:"wo_title,omitempty"`
+    WODescription   string     `json:"wo_description,omitempty"`
+    WOPriority      string     `json:"wo_priority,omitempty"`
+    Active          bool       `json:"active"`
+    LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// MeterAlert records a meter rule firing on a reading, with the work
+// orders it created or flagged.
+type MeterAlert struct {
+    ID           int64       `json:"id"`
+    RuleID       uuid.UUID   `json:"rule_id"`
+    RuleName     string      `json:"rule_name,omitempty"`
+    MeterID      uuid.UUID   `json:"meter_id"`
+    ReadingID    int64       `json:"reading_id"`
+    Value        float64     `json:"value"`
+    Previous     *float64    `json:"previous,omitempty"`
+    Action       string      `json:"action"`
+    WorkOrderIDs []uuid.UUID `json:"work_order_ids"`
+    CreatedAt    time.Time   `json:"created_at"`
+}
+
+// Hierarchy declares a uuid column of a table, referencing the table
+// itself, as the parent of its rows.
+type Hierarchy struct {
+    Table     string    `json:"table"` // slug
+    TableID   int64     `json:"-"`
+    Column    string    `json:"column"`
+    ColumnID  int64     `json:"-"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// TreeNode is a row of a hierarchy: in a subtree, Depth levels below the
+// row asked about, in ancestors that many levels above it.
+type TreeNode struct {
+    ID       uuid.UUID  `json:"id"`
+    ParentID *uuid.UUID `json:"parent_id"`
+    Depth    int        `json:"depth"`
+    Label    *string    `json:"label"`
+}
+
+// Subtree is a row with the rows below it that the caller may see, nearest
+// levels first. Truncated is set when the size limit cut it short.
+type Subtree struct {
+    Nodes     []TreeNode `json:"nodes"`
+    Truncated bool       `json:"truncated"`
+}
+
+// Stock movement kinds. Receipts and returns go into a bin, issues come out
+// of one, transfers move between two and adjustments correct one either way.
+const (
+    StockReceive  = "receive"
+    StockIssue    = "issue"
+    StockTransfer = "transfer"
+    StockAdjust   = "adjust"
+    StockReturn   = "return"
+)
+
+// StockMovement is an entry of the append-only stock ledger: Quantity of a
+// part (always positive) out of FromBinID and/or into ToBinID. Dates are
+// YYYY-MM-DD.
+type StockMovement struct {
+    ID          int64      `json:"id"`
+    PartID      uuid.UUID  `json:"part_id"`
+    Kind        string     `json:"kind"`
+    Quantity    float64    `json:"quantity"`
+    FromBinID   *uuid.UUID `json:"from_bin_id,omitempty"`
+    ToBinID     *uuid.UUID `json:"to_bin_id,omitempty"`
+    Lot         string     `json:"lot,omitempty"`
+    Serial      string     `json:"serial,omitempty"`
+    ExpiresOn   string     `json:"expires_on,omitempty"`
+    WorkOrderID *uuid.UUID `json:"work_order_id,omitempty"`
+    OrderID     *uuid.UUID `json:"order_id,omitempty"`
+    UnitCost    *float64   `json:"unit_cost,omitempty"`
+    Note        string     `json:"note,omitempty"`
+    CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// StockLevel is the quantity of a part on hand in a bin, per lot and
+// serial number.
+type StockLevel struct {
+    PartID     uuid.UUID `json:"part_id"`
+    BinID      uuid.UUID `json:"bin_id"`
+    Lot        string    `json:"lot,omitempty"`
+    Serial     string    `json:"serial,omitempty"`
+    ExpiresOn  string    `json:"expires_on,omitempty"`
+    Quantity   float64   `json:"quantity"`
+    ReceivedAt time.Time `json:"received_at"`
+}
+
+// PartStock sums up the stock of a part: on hand in all bins, reserved for
+// open work orders, on order, and what is left to use.
+type PartStock struct {
+    PartID    uuid.UUID `json:"part_id"`
+    OnHand    float64   `json:"on_hand"`
+    Reserved  float64   `json:"reserved"`
+    OnOrder   float64   `json:"on_order"`
+    Available float64   `json:"available"` // OnHand - Reserved
+}
+
+// Stock reservation statuses.
+const (
+    ReservationActive    = "active"
+    ReservationFulfilled = "fulfilled" // issued to the work order in full
+    ReservationReleased  = "released"
+)
+
+// StockReservation holds Quantity of a part for a planned work order until
+// it is issued to it or released.
+type StockReservation struct {
+    ID          uuid.UUID  `json:"id"`
+    PartID      uuid.UUID  `json:"part_id"`
+    WorkOrderID uuid.UUID  `json:"work_order_id"`
+    BinID       *uuid.UUID `json:"bin_id,omitempty"`
+    Quantity    float64    `json:"quantity"`
+    Issued      float64    `json:"issued"`
+    NeededOn    string     `json:"needed_on,omitempty"`
+    Status      string     `json:"status"`
+    Note        string     `json:"note,omitempty"`
+    CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Part order statuses.
+const (
+    PartOrderOpen      = "open"
+    PartOrderReceived  = "received"
+    PartOrderCancelled = "cancelled"
+)
+
+// PartOrder is Quantity of a part on order; receipts against it count
+// towards Received until it is received in full.
+type PartOrder struct {
+    ID         uuid.UUID  `json:"id"`
+    PartID     uuid.UUID  `json:"part_id"`
+    Quantity   float64    `json:"quantity"`
+    Received   float64    `json:"received"`
+    Supplier   string     `json:"supplier,omitempty"`
+    Reference  string     `json:"reference,omitempty"`
+    ExpectedOn string     `json:"expected_on,omitempty"`
+    Status     string     `json:"status"`
+    CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt  time.Time  `json:"created_at"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// LowStockPart is a line of the low-stock report: a part whose projected
+// stock (on hand + on order - reserved) is at or below its reorder point,
+// with the quantity to order to bring it back up to its maximum.
+type LowStockPart struct {
+    PartID       uuid.UUID `json:"part_id"`
+    Name         string    `json:"name"`
+    PartNumber   string    `json:"part_number,omitempty"`
+    Unit         string    `json:"unit,omitempty"`
+    ReorderPoint float64   `json:"reorder_point"`
+    SafetyStock  *float64  `json:"safety_stock,omitempty"`
+    MaxQuantity  *float64  `json:"max_quantity,omitempty"`
+    OnHand       float64   `json:"on_hand"`
+    Reserved     float64   `json:"reserved"`
+    OnOrder      float64   `json:"on_order"`
+    Projected    float64   `json:"projected"`
+    BelowSafety  bool      `json:"below_safety"` // on hand below the safety stock
+    SuggestedQty float64   `json:"suggested_quantity"`
+}
+
+// StockFilter narrows stock listings to a part, a bin or a work order; nil
+// fields match all.
+type StockFilter struct {
+    PartID      *uuid.UUID
+    BinID       *uuid.UUID
+    WorkOrderID *uuid.UUID
+}
+
+// WorkOrderPartLine is what a work order used of a part, lot and serial
+// number: the quantity issued to it less what was returned, valued at the
+// unit costs of the movements.
+type WorkOrderPartLine struct {
+    PartID       uuid.UUID `json:"part_id"`
+    Lot          string    `json:"lot,omitempty"`
+    Serial       string    `json:"serial,omitempty"`
+    Issued       float64   `json:"issued"`
+    Returned     float64   `json:"returned"`
+    Quantity     float64   `json:"quantity"` // used: issued - returned
+    IssuedCost   float64   `json:"issued_cost"`
+    ReturnedCost float64   `json:"returned_cost"`
+    Cost         float64   `json:"cost"`
+    LastMovedAt  time.Time `json:"last_moved_at"`
+}
+
+// Groupings of the parts cost report.
+const (
+    PartsCostByAsset = "asset"
+    PartsCostBySite  = "site"
+    PartsCostByMonth = "month"
+)
+
+// PartsCostTotal is the cost of parts used on the work orders of an asset,
+// a site or a month (YYYY-MM). Key is nil for work orders without an asset
+// or site.
+type PartsCostTotal struct {
+    Key          *string `json:"key"`
+    Name         string  `json:"name,omitempty"`
+    Cost         float64 `json:"cost"`
+    IssuedCost   float64 `json:"issued_cost"`
+    ReturnedCost float64 `json:"returned_cost"`
+    WorkOrders   int64   `json:"work_orders"`
+}
+
+// Sources of time entries.
+const (
+    TimeEntryTimer  = "timer"
+    TimeEntryManual = "manual"
+)
+
+// TimeEntry is time a user spent on a work order, from a timer (running
+// while EndedAt is nil) or entered by hand. Cost is Hours at HourlyRate,
+// the rate that applied when the entry was created; both are nil when no
+// rate applied.
+type TimeEntry struct {
+    ID             uuid.UUID  `json:"id"`
+    WorkOrderID    uuid.UUID  `json:"work_order_id"`
+    WorkOrderTitle string     `json:"work_order_title,omitempty"`
+    UserID         uuid.UUID  `json:"user_id"`
+    UserEmail      string     `json:"user_email"`
+    UserName       string     `json:"user_name,omitempty"`
+    Source         string     `json:"source"`
+    StartedAt      time.Time  `json:"started_at"`
+    EndedAt        *time.Time `json:"ended_at"`
+    Hours          float64    `json:"hours"` // up to now while running
+    HourlyRate     *float64   `json:"hourly_rate"`
+    Cost           *float64   `json:"cost"`
+    Note           string     `json:"note,omitempty"`
+    CreatedBy      *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TimeEntryFilter narrows time entries to a work order, a user and the
+// period [From, To) they started in; nil fields match all.
+type TimeEntryFilter struct {
+    WorkOrderID *uuid.UUID
+    UserID      *uuid.UUID
+    From        *time.Time
+    To          *time.Time
+}
+
+// LabourRate is the hourly rate of a user or, for its members, a team;
+// exactly one of UserID and TeamID is set.
+type LabourRate struct {
+    ID         uuid.UUID  `json:"id"`
+    UserID     *uuid.UUID `json:"user_id,omitempty"`
+    UserEmail  string     `json:"user_email,omitempty"`
+    TeamID     *uuid.UUID `json:"team_id,omitempty"`
+    TeamName   string     `json:"team_name,omitempty"`
+    HourlyRate float64    `json:"hourly_rate"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// LabourSummary totals the finished time entries of a work order against
+// its estimate; VarianceHours is Hours less EstimatedHours.
+type LabourSummary struct {
+    Hours          float64           `json:"hours"`
+    Cost           float64           `json:"cost"`
+    Running        int               `json:"running"` // timers still running, not counted
+    EstimatedHours *float64          `json:"estimated_hours"`
+    VarianceHours  *float64          `json:"variance_hours"`
+    ByUser         []LabourUserTotal `json:"by_user"`
+}
+
+// LabourUserTotal is the finished time of one user on a work order.
+type LabourUserTotal struct {
+    UserID    uuid.UUID `json:"user_id"`
+    UserEmail string    `json:"user_email"`
+    UserName  string    `json:"user_name,omitempty"`
+    Hours     float64   `json:"hours"`
+    Cost      float64   `json:"cost"`
+}
+
+// Kinds of checklist items.
+const (
+    ChecklistCheckbox  = "checkbox"
+    ChecklistPassFail  = "pass_fail"
+    ChecklistReading   = "reading"
+    ChecklistText      = "text"
+    ChecklistPhoto     = "photo"
+    ChecklistSignature = "signature"
+)
+
+// Results of answered checklist items: done for checkboxes, text, photos
+// and signatures, pass, fail or na for pass/fail items and readings.
+const (
+    ChecklistDone = "done"
+    ChecklistPass = "pass"
+    ChecklistFail = "fail"
+    ChecklistNA   = "na"
+)
+
+// ChecklistTemplate is a procedure whose items are copied onto work orders.
+// Items is only filled in for a single template.
+type ChecklistTemplate struct {
+    ID          uuid.UUID               `json:"id"`
+    Name        string                  `json:"name"`
+    Description string                  `json:"description,omitempty"`
+    ItemCount   int                     `json:"item_count"`
+    Items       []ChecklistTemplateItem `json:"items,omitempty"`
+    CreatedBy   *uuid.UUID              `json:"created_by,omitempty"`
+    CreatedAt   time.Time               `json:"created_at"`
+    UpdatedAt   time.Time               `json:"updated_at"`
+}
+
+// ChecklistTemplateItem is a step of a checklist. Min and Max bound the
+// passing values of readings; FollowUp creates a corrective work order
+// when the item fails.
+type ChecklistTemplateItem struct {
+    ID       uuid.UUID `json:"id"`
+    Position int       `json:"position"`
+    Label    string    `json:"label"`
+    Kind     string    `json:"kind"`
+    Required bool      `json:"required"`
+    Min      *float64  `json:"min,omitempty"`
+    Max      *float64  `json:"max,omitempty"`
+    Unit     string    `json:"unit,omitempty"`
+    FollowUp bool      `json:"follow_up"`
+    Help     string    `json:"help,omitempty"`
+}
+
+// Checklist is a copy of a template on a work order. Open counts its
+// required items not answered yet.
+type Checklist struct {
+    ID          uuid.UUID       `json:"id"`
+    WorkOrderID uuid.UUID       `json:"work_order_id"`
+    TemplateID  *uuid.UUID      `json:"template_id"`
+    Name        string          `json:"name"`
+    Items       []ChecklistItem `json:"items"`
+    Answered    int             `json:"answered"`
+    Failed      int             `json:"failed"`
+    Open        int             `json:"open"`
+    CreatedBy   *uuid.UUID      `json:"created_by,omitempty"`
+    CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ChecklistItem is an item of a checklist on a work order with its answer,
+// if any: Result with the Reading, Text or File the kind takes, and who
+// answered it when.
+type ChecklistItem struct {
+    ChecklistTemplateItem
+    ChecklistID         uuid.UUID  `json:"checklist_id"`
+    Result              string     `json:"result,omitempty"`
+    Reading             *float64   `json:"reading,omitempty"`
+    Text                string     `json:"text,omitempty"`
+    File                string     `json:"file,omitempty"`
+    Note                string     `json:"note,omitempty"`
+    CompletedBy         *uuid.UUID `json:"completed_by,omitempty"`
+    CompletedByEmail    string     `json:"completed_by_email,omitempty"`
+    CompletedAt         *time.Time `json:"completed_at,omitempty"`
+    FollowUpWorkOrderID *uuid.UUID `json:"follow_up_work_order_id,omitempty"`
+}
+
+// File is an uploaded file whose content is kept in the blob store under its
+// SHA256. Width and Height are set for images; Latitude, Longitude and
+// TakenAt when the photo's EXIF data has them.
+type File struct {
+    ID          uuid.UUID  `json:"id"`
+    Name        string     `json:"name"`
+    ContentType string     `json:"content_type"`
+    Size        int64      `json:"size"`
+    SHA256      string     `json:"sha256"`
+    Width       *int       `json:"width,omitempty"`
+    Height      *int       `json:"height,omitempty"`
+    Thumbnail   bool       `json:"thumbnail"`
+    Latitude    *float64   `json:"latitude,omitempty"`
+    Longitude   *float64   `json:"longitude,omitempty"`
+    TakenAt     *time.Time `json:"taken_at,omitempty"`
+    CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// FileLink is a row a file is linked to.
+type FileLink struct {
+    RowID     uuid.UUID  `json:"row_id"`
+    TableID   int64      `json:"table_id"`
+    TableSlug string     `json:"table_slug"`
+    CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+}
+
+// RequestPortal is an org's public form for maintenance requests, reached
+// at /portal/{key}.
+type RequestPortal struct {
+    Key             string     `json:"key"`
+    Enabled         bool       `json:"enabled"`
+    Title           string     `json:"title"`
+    Intro           string     `json:"intro"`
+    Captcha         bool       `json:"captcha"`
+    Photos          bool       `json:"photos"`
+    DefaultPriority string     `json:"default_priority,omitempty"`
+    UpdatedBy       *uuid.UUID `json:"updated_by,omitempty"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// RequestToken is the request a requester's status token follows.
+type RequestToken struct {
+    OrgID     uuid.UUID
+    RowID     uuid.UUID
+    CreatedAt time.Time
+}
@@ -0,0 +1,568 @@
+// Package pm generates the work orders of preventive maintenance schedules.
+//
+// PM schedules are rows of the table provisioned from the pm_schedules
+// template. A calendar schedule recurs from its start date by its
+// recurrence rule (see Rule), or by its frequency and interval; a meter
+// schedule falls due every meter_interval units of its meter's reading.
+// Generate scans the schedules of an org and, for each occurrence that is
+// due, lead_days (or meter_lead units) ahead, creates a work order from the
+// schedule: its title, or wo_title with {title} and {due} filled in, its
+// description, or wo_description, and its priority, asset, location, team,
+// category and checklist, with parent_pm pointing back, and a copy of its
+// checklist_template's items (see internal/checklists). With skip_if_open
+// the occurrence is skipped instead while the schedule's previous work
+// order is open.
+//
+// Every occurrence handled is recorded in app.pm_occurrences, which lets
+// each generate one work order at most. Occurrences missed while nobody
+// scanned are not made up: only the latest that is due generates a work
+// order.
+package pm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// Slugs of the tables of the pm_schedules and work_orders templates.
+const (
+	ScheduleTable  = "pm-schedules"
+	WorkOrderTable = "work-orders"
+)
+
+// maxPerScan bounds the work orders one scan generates for a schedule; the
+// next scan carries on.
+const maxPerScan = 50
+
+// pageSize is the page size of the search reading schedules.
+const pageSize = 100
+
+// errHandled rolls back a work order generated for an occurrence another
+// scan recorded first.
+var errHandled = errors.New("occurrence already handled")
+
+// Schedule is a PM schedule row as the scheduler reads it.
+type Schedule struct {
+	ID         uuid.UUID
+	Data       map[string]any
+	Meter      bool // schedule_type METER
+	Rule       Rule
+	Start      time.Time
+	LeadDays   int
+	DueInDays  int
+	SkipIfOpen bool
+
+	MeterID       uuid.UUID
+	MeterInterval float64
+	MeterLead     float64
+	NextReading   *float64 // the reading the next occurrence falls due at
+}
+
+// ParseSchedule reads the data of a PM schedule row. Errors are messages
+// for the client.
+func ParseSchedule(id uuid.UUID, data map[string]any) (Schedule, error) {
+	s := Schedule{
+		ID:         id,
+		Data:       data,
+		Meter:      strings.EqualFold(str(data["schedule_type"]), "METER"),
+		LeadDays:   int(math.Max(num(data["lead_days"]), 0)),
+		DueInDays:  int(math.Max(num(data["due_in_days"]), 0)),
+		SkipIfOpen: data["skip_if_open"] == true,
+	}
+	if s.Meter {
+		var err error
+		if s.MeterID, err = uuid.Parse(str(data["meter"])); err != nil {
+			return Schedule{}, fmt.Errorf("meter schedules need a meter")
+		}
+		if s.MeterInterval = num(data["meter_interval"]); s.MeterInterval <= 0 {
+			return Schedule{}, fmt.Errorf("meter schedules need a positive meter_interval")
+		}
+		s.MeterLead = math.Max(num(data["meter_lead"]), 0)
+		if v, ok := data["next_due_reading"].(float64); ok {
+			s.NextReading = &v
+		}
+		return s, nil
+	}
+
+	start, err := time.Parse(time.DateOnly, str(data["start_date"]))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("calendar schedules need a start_date")
+	}
+	s.Start = start
+	if rule := strings.TrimSpace(str(data["recurrence"])); rule != "" {
+		if s.Rule, err = ParseRule(rule); err != nil {
+			return Schedule{}, fmt.Errorf("recurrence: %v", err)
+		}
+		return s, nil
+	}
+	interval := 1.0
+	if v, ok := data["interval"].(float64); ok {
+		interval = v
+	}
+	if s.Rule, err = RuleFromFrequency(str(data["frequency"]), interval); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// Active reports whether a PM schedule row generates work orders: unless
+// its active column is false.
+func Active(data map[string]any) bool {
+	return data["active"] != false
+}
+
+// Upcoming returns up to n dates of the calendar schedule s after the date
+// after.
+func (s Schedule) Upcoming(after time.Time, n int) []time.Time {
+	out := []time.Time{}
+	for len(out) < n {
+		next, ok := s.Rule.Next(s.Start, after)
+		if !ok {
+			break
+		}
+		out = append(out, next)
+		after = next
+	}
+	return out
+}
+
+// ScheduleError is a schedule a scan could not handle.
+type ScheduleError struct {
+	PMID  uuid.UUID `json:"pm_id"`
+	Error string    `json:"error"`
+}
+
+// Result is what a scan of an org did.
+type Result struct {
+	Occurrences []models.PMOccurrence `json:"occurrences"`
+	Errors      []ScheduleError       `json:"errors,omitempty"`
+}
+
+// Generate scans the PM schedules of an org as of now and handles the
+// occurrences that are due. Orgs without both the schedule and work order
+// tables have nothing to scan. Schedules that fail are reported in the
+// result; the error is for failures of the scan itself. It acts for the
+// system, so row policies and field access rules do not apply, even when an
+// admin asks for the scan.
+func Generate(ctx context.Context, r repo.Repo, orgID uuid.UUID, now time.Time) (Result, error) {
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	res := Result{Occurrences: []models.PMOccurrence{}}
+	tables, err := r.ListUserTables(ctx, orgID)
+	if err != nil {
+		return res, err
+	}
+	g := &generator{repo: r, orgID: orgID, today: day(now)}
+	for _, t := range tables {
+		switch t.Slug {
+		case ScheduleTable:
+			g.scheduleTable = t.ID
+		case WorkOrderTable:
+			g.workOrderTable = t.ID
+		}
+	}
+	if g.scheduleTable == 0 || g.workOrderTable == 0 {
+		return res, nil
+	}
+	schema, err := r.GetUserTableSchema(ctx, orgID, WorkOrderTable)
+	if err != nil {
+		return res, err
+	}
+	g.workOrderCols = make(map[string]bool, len(schema))
+	for _, c := range schema {
+		if c.Kind == "" || c.Kind == "value" {
+			g.workOrderCols[c.Name] = true
+		}
+	}
+
+	for page := 0; ; page++ {
+		payload := fmt.Sprintf(`{"pageNum":%d,"pageSize":%d,"sortField":"created_at","sortDirection":"asc"}`, page, pageSize)
+		rows, err := r.SearchUserTable(ctx, orgID, ScheduleTable, []byte(payload))
+		if err != nil {
+			return res, err
+		}
+		for _, row := range rows {
+			if !Active(row.Data) {
+				continue
+			}
+			s, err := ParseSchedule(row.RowID, row.Data)
+			if err == nil {
+				var occs []models.PMOccurrence
+				occs, err = g.scan(ctx, s)
+				res.Occurrences = append(res.Occurrences, occs...)
+			}
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			if err != nil {
+				res.Errors = append(res.Errors, ScheduleError{PMID: row.RowID, Error: err.Error()})
+			}
+		}
+		if len(rows) < pageSize {
+			return res, nil
+		}
+	}
+}
+
+// generator handles the schedules of one org.
+type generator struct {
+	repo           repo.Repo
+	orgID          uuid.UUID
+	today          time.Time
+	scheduleTable  int64
+	workOrderTable int64
+	workOrderCols  map[string]bool
+}
+
+func (g *generator) scan(ctx context.Context, s Schedule) ([]models.PMOccurrence, error) {
+	if s.Meter {
+		return g.scanMeter(ctx, s)
+	}
+	return g.scanCalendar(ctx, s)
+}
+
+// scanCalendar handles the occurrences of a calendar schedule up to
+// lead_days from today.
+func (g *generator) scanCalendar(ctx context.Context, s Schedule) ([]models.PMOccurrence, error) {
+	after := s.Start.AddDate(0, 0, -1)
+	last, found, err := g.repo.LastPMOccurrence(ctx, g.orgID, s.ID, models.PMTriggerCalendar)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if after, err = time.Parse(time.DateOnly, last.DueOn); err != nil {
+			return nil, err
+		}
+	}
+	next, ok := s.Rule.Next(s.Start, after)
+	// Of the occurrences missed, only the latest is due.
+	for ok && next.Before(g.today) {
+		later, more := s.Rule.Next(s.Start, next)
+		if !more || later.After(g.today) {
+			break
+		}
+		next = later
+	}
+
+	var out []models.PMOccurrence
+	horizon := g.today.AddDate(0, 0, s.LeadDays)
+	for ok && !next.After(horizon) && len(out) < maxPerScan {
+		occ := models.PMOccurrence{PMID: s.ID, Trigger: models.PMTriggerCalendar, DueOn: next.Format(time.DateOnly)}
+		occ, recorded, err := g.generate(ctx, s, occ, next)
+		if err != nil {
+			return out, err
+		}
+		if recorded {
+			out = append(out, occ)
+		}
+		next, ok = s.Rule.Next(s.Start, next)
+	}
+
+	var nextDue any
+	if ok {
+		nextDue = next.Format(time.DateOnly)
+	}
+	if str(s.Data["next_due_date"]) != str(nextDue) {
+		return out, g.updateSchedule(ctx, s, map[string]any{"next_due_date": nextDue})
+	}
+	return out, nil
+}
+
+// scanMeter handles the occurrence a meter schedule's reading has reached,
+// less meter_lead. A schedule that never fell due starts counting at its
+// next_due_reading, or one interval from the current reading.
+func (g *generator) scanMeter(ctx context.Context, s Schedule) ([]models.PMOccurrence, error) {
+	b, found, err := g.repo.RowSnapshot(ctx, g.orgID, s.MeterID)
+	if err != nil || !found {
+		return nil, err
+	}
+	var meter map[string]any
+	if err := json.Unmarshal(b, &meter); err != nil {
+		return nil, err
+	}
+	reading, ok := meter["reading"].(float64)
+	if !ok {
+		return nil, nil
+	}
+
+	last, found, err := g.repo.LastPMOccurrence(ctx, g.orgID, s.ID, models.PMTriggerMeter)
+	if err != nil {
+		return nil, err
+	}
+	var due float64
+	switch {
+	case found:
+		due = *last.DueReading + s.MeterInterval
+	case s.NextReading != nil:
+		due = *s.NextReading
+	default:
+		due = reading + s.MeterInterval
+	}
+	// Of the occurrences missed, only the latest is due.
+	if reading >= due+s.MeterInterval {
+		due += math.Floor((reading-due)/s.MeterInterval) * s.MeterInterval
+	}
+
+	var out []models.PMOccurrence
+	if reading >= due-s.MeterLead {
+		occ := models.PMOccurrence{PMID: s.ID, Trigger: models.PMTriggerMeter, DueReading: &due}
+		occ, recorded, err := g.generate(ctx, s, occ, g.today)
+		if err != nil {
+			return nil, err
+		}
+		if recorded {
+			out = append(out, occ)
+		}
+		due += s.MeterInterval
+	}
+	if s.NextReading == nil || *s.NextReading != due {
+		return out, g.updateSchedule(ctx, s, map[string]any{"next_due_reading": due})
+	}
+	return out, nil
+}
+
+// generate handles one occurrence falling due on date: creates its work
+// order, or skips it, and records it. recorded is false when another scan
+// recorded it first.
+func (g *generator) generate(ctx context.Context, s Schedule, occ models.PMOccurrence, date time.Time) (models.PMOccurrence, bool, error) {
+	err := g.repo.InTx(ctx, func(tx repo.Repo) error {
+		if s.SkipIfOpen {
+			open, err := g.openWorkOrder(ctx, tx, s.ID)
+			if err != nil {
+				return err
+			}
+			if open != uuid.Nil {
+				occ.Status, occ.Note = models.PMSkipped, "work order "+open.String()+" is still open"
+			}
+		}
+		if occ.Status == "" {
+			values, err := workflow.Apply(ctx, tx, g.orgID, uuid.Nil, g.workOrderTable, uuid.Nil, g.workOrder(s, occ, date))
+			if err != nil {
+				return err
+			}
+			payload, err := json.Marshal(values)
+			if err != nil {
+				return err
+			}
+			row, err := automations.InsertRow(ctx, tx, g.orgID, g.workOrderTable, WorkOrderTable, payload)
+			if err != nil {
+				return err
+			}
+			occ.Status, occ.WorkOrderID = models.PMCreated, &row.RowID
+			if tid, err := uuid.Parse(str(s.Data["checklist_template"])); err == nil {
+				// A template deleted since is left out.
+				if _, _, err := tx.CopyChecklist(ctx, row.RowID, tid, nil); err != nil {
+					return err
+				}
+			}
+		}
+		rec, recorded, err := tx.RecordPMOccurrence(ctx, g.orgID, occ)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			return errHandled
+		}
+		occ = rec
+		return nil
+	})
+	if errors.Is(err, errHandled) {
+		return occ, false, nil
+	}
+	if err != nil {
+		return occ, false, fmt.Errorf("generate work order: %w", err)
+	}
+	return occ, true, nil
+}
+
+// openWorkOrder returns the schedule's previous work order while it is
+// neither completed, cancelled nor archived, uuid.Nil otherwise.
+func (g *generator) openWorkOrder(ctx context.Context, tx repo.Repo, pmID uuid.UUID) (uuid.UUID, error) {
+	id, found, err := tx.LastPMWorkOrder(ctx, g.orgID, pmID)
+	if err != nil || !found {
+		return uuid.Nil, err
+	}
+	b, found, err := tx.RowSnapshot(ctx, g.orgID, id)
+	if err != nil || !found {
+		return uuid.Nil, err
+	}
+	var wo map[string]any
+	if err := json.Unmarshal(b, &wo); err != nil {
+		return uuid.Nil, err
+	}
+	if !Open(wo) {
+		return uuid.Nil, nil
+	}
+	return id, nil
+}
+
+// Open reports whether a work order row is still open: neither completed,
+// cancelled nor archived.
+func Open(wo map[string]any) bool {
+	switch str(wo["status"]) {
+	case "COMPLETED", "CANCELLED":
+		return false
+	}
+	return wo["archived"] != true
+}
+
+// SetWorkOrderValues sets values kept by the system on a work order, such
+// as its cost roll-ups, leaving out columns the org's work order table does
+// not have. Call it inside InTx, in a system context.
+func SetWorkOrderValues(ctx context.Context, tx repo.Repo, orgID, id uuid.UUID, values map[string]any) error {
+	tables, err := tx.ListUserTables(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	var tableID int64
+	for _, t := range tables {
+		if t.Slug == WorkOrderTable {
+			tableID = t.ID
+		}
+	}
+	if tableID == 0 {
+		return nil
+	}
+	schema, err := tx.GetUserTableSchema(ctx, orgID, WorkOrderTable)
+	if err != nil {
+		return err
+	}
+	set := map[string]any{}
+	for _, c := range schema {
+		if v, ok := values[c.Name]; ok && (c.Kind == "" || c.Kind == "value") {
+			set[c.Name] = v
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	_, _, err = automations.UpdateRow(ctx, tx, orgID, tableID, WorkOrderTable, id, payload)
+	return err
+}
+
+// CreateWorkOrder creates a work order for the system with values, leaving
+// out columns the org's work order table does not have, and returns its
+// id; false when the org has no work order table. The state machine's
+// initial state applies. Call it inside InTx, in a system context.
+func CreateWorkOrder(ctx context.Context, tx repo.Repo, orgID uuid.UUID, values map[string]any) (uuid.UUID, bool, error) {
+	tables, err := tx.ListUserTables(ctx, orgID)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	var tableID int64
+	for _, t := range tables {
+		if t.Slug == WorkOrderTable {
+			tableID = t.ID
+		}
+	}
+	if tableID == 0 {
+		return uuid.Nil, false, nil
+	}
+	schema, err := tx.GetUserTableSchema(ctx, orgID, WorkOrderTable)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	set := map[string]any{}
+	for _, c := range schema {
+		if v, ok := values[c.Name]; ok && (c.Kind == "" || c.Kind == "value") {
+			set[c.Name] = v
+		}
+	}
+	set, err = workflow.Apply(ctx, tx, orgID, uuid.Nil, tableID, uuid.Nil, set)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	payload, err := json.Marshal(set)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	row, err := automations.InsertRow(ctx, tx, orgID, tableID, WorkOrderTable, payload)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return row.RowID, true, nil
+}
+
+// workOrder returns the values of the work order of an occurrence, limited
+// to the columns the org's work order table has.
+func (g *generator) workOrder(s Schedule, occ models.PMOccurrence, date time.Time) map[string]any {
+	due := occ.DueOn
+	if occ.DueReading != nil {
+		due = strconv.FormatFloat(*occ.DueReading, 'f', -1, 64)
+	}
+	title := str(s.Data["title"])
+	if tmpl := strings.TrimSpace(str(s.Data["wo_title"])); tmpl != "" {
+		title = strings.NewReplacer("{title}", title, "{due}", due).Replace(tmpl)
+	}
+	description := str(s.Data["wo_description"])
+	if strings.TrimSpace(description) == "" {
+		description = str(s.Data["description"])
+	}
+
+	values := map[string]any{
+		"title":     title,
+		"parent_pm": s.ID.String(),
+		"due_date":  date.AddDate(0, 0, s.DueInDays).Format(time.DateOnly),
+	}
+	if description != "" {
+		values["description"] = description
+	}
+	if occ.Trigger == models.PMTriggerCalendar {
+		values["estimated_start_date"] = occ.DueOn
+	}
+	for _, col := range []string{"priority", "asset", "location", "team", "category", "checklist"} {
+		if v := s.Data[col]; v != nil && v != "" {
+			values[col] = v
+		}
+	}
+	for col := range values {
+		if !g.workOrderCols[col] {
+			delete(values, col)
+		}
+	}
+	return values
+}
+
+// updateSchedule writes what the scheduler keeps on a schedule row, such as
+// its next due date.
+func (g *generator) updateSchedule(ctx context.Context, s Schedule, values map[string]any) error {
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return g.repo.InTx(ctx, func(tx repo.Repo) error {
+		_, _, err := automations.UpdateRow(ctx, tx, g.orgID, g.scheduleTable, ScheduleTable, s.ID, payload)
+		return err
+	})
+}
+
+func str(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+func num(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
@@ -0,0 +1,371 @@
+package pm
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Freq is how often a Rule repeats.
+type Freq string
+
+const (
+	Daily   Freq = "DAILY"
+	Weekly  Freq = "WEEKLY"
+	Monthly Freq = "MONTHLY"
+	Yearly  Freq = "YEARLY"
+)
+
+// Bounds of rule parts; maxPeriods bounds the periods searched for the next
+// occurrence of rules that rarely match, such as the 31st of every month
+// that is also a Monday.
+const (
+	maxInterval = 1000
+	maxCount    = 1000
+	maxPeriods  = 2000
+)
+
+// Rule is a recurrence in the subset of RFC 5545 RRULEs PM schedules use,
+// e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH": every Interval days, weeks,
+// months or years from the schedule's start date, on the weekdays of ByDay
+// (in monthly rules optionally the nth one, as 1MO or -1FR) or the days of
+// ByMonthDay (negative ones count from the end of the month), at most Count
+// times and not after Until. Weeks start on Monday. Without ByDay and
+// ByMonthDay a rule falls on the start date's weekday or day of the month;
+// months without that day are skipped.
+type Rule struct {
+	Freq       Freq
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int       // 0 for no limit
+	Until      time.Time // zero for no limit
+}
+
+// WeekdayNum is a BYDAY entry: a weekday, or its Nth occurrence in the
+// month when N is not 0.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// ParseRule parses a rule such as "FREQ=MONTHLY;BYDAY=-1FR"; an "RRULE:"
+// prefix is allowed. Errors are messages for the client.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	r := Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return Rule{}, fmt.Errorf("%s is given twice", key)
+		}
+		seen[key] = true
+		switch key {
+		case "FREQ":
+			switch f := Freq(value); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			default:
+				return Rule{}, fmt.Errorf("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxInterval {
+				return Rule{}, fmt.Errorf("INTERVAL must be between 1 and %d", maxInterval)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxCount {
+				return Rule{}, fmt.Errorf("COUNT must be between 1 and %d", maxCount)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := weekdays[d[max(len(d)-2, 0):]]
+				if !ok {
+					return Rule{}, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				var n int
+				if num := d[:len(d)-2]; num != "" {
+					var err error
+					if n, err = strconv.Atoi(num); err != nil || n == 0 || n < -5 || n > 5 {
+						return Rule{}, fmt.Errorf("invalid BYDAY %q", d)
+					}
+				}
+				r.ByDay = append(r.ByDay, WeekdayNum{N: n, Day: wd})
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, fmt.Errorf("invalid BYMONTHDAY %q", d)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+	if r.Freq == "" {
+		return Rule{}, fmt.Errorf("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return Rule{}, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return Rule{}, fmt.Errorf("BYMONTHDAY needs FREQ=MONTHLY")
+	}
+	if len(r.ByDay) > 0 && r.Freq == Yearly {
+		return Rule{}, fmt.Errorf("BYDAY needs FREQ=DAILY, WEEKLY or MONTHLY")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return Rule{}, fmt.Errorf("numbered BYDAY needs FREQ=MONTHLY")
+		}
+	}
+	return r, nil
+}
+
+// parseUntil accepts an RFC 5545 date or date-time, or YYYY-MM-DD.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	if len(s) >= 8 {
+		if t, err := time.Parse("20060102", s[:8]); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", s)
+}
+
+// RuleFromFrequency returns the rule of the pm_schedules template's
+// frequency and interval columns, e.g. QUARTERLY every 2 for every six
+// months.
+func RuleFromFrequency(frequency string, interval float64) (Rule, error) {
+	n := int(math.Round(interval))
+	if n < 1 {
+		n = 1
+	}
+	r := Rule{Interval: n}
+	switch strings.ToUpper(frequency) {
+	case "DAILY":
+		r.Freq = Daily
+	case "WEEKLY":
+		r.Freq = Weekly
+	case "MONTHLY":
+		r.Freq = Monthly
+	case "QUARTERLY":
+		r.Freq, r.Interval = Monthly, 3*n
+	case "YEARLY":
+		r.Freq = Yearly
+	default:
+		return Rule{}, fmt.Errorf("unknown frequency %q", frequency)
+	}
+	if r.Interval > maxInterval {
+		return Rule{}, fmt.Errorf("interval must be at most %d", maxInterval)
+	}
+	return r, nil
+}
+
+// String formats r as an RRULE value.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = strings.ToUpper(d.Day.String()[:2])
+			if d.N != 0 {
+				days[i] = strconv.Itoa(d.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of r strictly after the date after,
+// for a schedule starting on start; ok is false when there is none left.
+// Dates are days in UTC.
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	start, after = day(start), day(after)
+	first := 0
+	if r.Count == 0 && after.After(start) {
+		// Jump close to after; COUNT rules count from the start.
+		first = max(r.periodsBetween(start, after)/r.Interval-1, 0)
+	}
+	n := 0
+	for k := first; k < first+maxPeriods; k++ {
+		for _, d := range r.period(start, k) {
+			if d.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && d.After(day(r.Until)) {
+				return time.Time{}, false
+			}
+			if n++; r.Count > 0 && n > r.Count {
+				return time.Time{}, false
+			}
+			if d.After(after) {
+				return d, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// periodsBetween counts the days, weeks, months or years from start to t.
+func (r Rule) periodsBetween(start, t time.Time) int {
+	switch r.Freq {
+	case Daily:
+		return int(t.Sub(start).Hours() / 24)
+	case Weekly:
+		return int(t.Sub(weekStart(start)).Hours() / (24 * 7))
+	case Monthly:
+		return (t.Year()-start.Year())*12 + int(t.Month()-start.Month())
+	}
+	return t.Year() - start.Year()
+}
+
+// period returns the candidate dates of the kth period of r, in order.
+func (r Rule) period(start time.Time, k int) []time.Time {
+	n := k * r.Interval
+	switch r.Freq {
+	case Daily:
+		d := start.AddDate(0, 0, n)
+		if len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(w WeekdayNum) bool { return w.Day == d.Weekday() }) {
+			return nil
+		}
+		return []time.Time{d}
+	case Weekly:
+		week := weekStart(start).AddDate(0, 0, 7*n)
+		days := []time.Weekday{start.Weekday()}
+		if len(r.ByDay) > 0 {
+			days = days[:0]
+			for _, w := range r.ByDay {
+				days = append(days, w.Day)
+			}
+		}
+		out := make([]time.Time, 0, len(days))
+		for _, wd := range days {
+			d := week.AddDate(0, 0, (int(wd)+6)%7)
+			if !slices.ContainsFunc(out, d.Equal) {
+				out = append(out, d)
+			}
+		}
+		slices.SortFunc(out, time.Time.Compare)
+		return out
+	case Monthly:
+		return r.monthDays(time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC), start)
+	}
+	d := time.Date(start.Year()+n, start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	if d.Day() != start.Day() {
+		// No 29 February this year
+		return nil
+	}
+	return []time.Time{d}
+}
+
+// monthDays returns the dates of r in the month starting on first.
+func (r Rule) monthDays(first, start time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var byMonthDay []int
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = last + 1 + d
+		}
+		if d >= 1 && d <= last {
+			byMonthDay = append(byMonthDay, d)
+		}
+	}
+	var byDay []int
+	for _, w := range r.ByDay {
+		firstOfDay := 1 + (int(w.Day)-int(first.Weekday())+7)%7
+		switch {
+		case w.N == 0:
+			for d := firstOfDay; d <= last; d += 7 {
+				byDay = append(byDay, d)
+			}
+		case w.N > 0:
+			if d := firstOfDay + 7*(w.N-1); d <= last {
+				byDay = append(byDay, d)
+			}
+		default:
+			lastOfDay := firstOfDay + 7*((last-firstOfDay)/7)
+			if d := lastOfDay + 7*(w.N+1); d >= 1 {
+				byDay = append(byDay, d)
+			}
+		}
+	}
+
+	var days []int
+	switch {
+	case len(r.ByMonthDay) > 0 && len(r.ByDay) > 0:
+		for _, d := range byMonthDay {
+			if slices.Contains(byDay, d) {
+				days = append(days, d)
+			}
+		}
+	case len(r.ByMonthDay) > 0:
+		days = byMonthDay
+	case len(r.ByDay) > 0:
+		days = byDay
+	case start.Day() <= last:
+		days = []int{start.Day()}
+	}
+	slices.Sort(days)
+	days = slices.Compact(days)
+	out := make([]time.Time, len(days))
+	for i, d := range days {
+		out[i] = first.AddDate(0, 0, d-1)
+	}
+	return out
+}
+
+// day truncates t to its date in UTC.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the Monday of the week of t.
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
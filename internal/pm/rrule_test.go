@@ -0,0 +1,240 @@
+package pm
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// upcoming formats up to n occurrences of rule after the date after.
+func upcoming(t *testing.T, rule, start, after string, n int) string {
+	t.Helper()
+	r, err := ParseRule(rule)
+	if err != nil {
+		t.Fatalf("ParseRule(%q): %v", rule, err)
+	}
+	var out []string
+	for _, d := range (Schedule{Start: date(start), Rule: r}).Upcoming(date(after), n) {
+		out = append(out, d.Format(time.DateOnly))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"rrule:freq=monthly;byday=-1fr", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=12", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=12"},
+		{"FREQ=WEEKLY;UNTIL=20261231T235959Z", "FREQ=WEEKLY;UNTIL=20261231"},
+		{"FREQ=YEARLY;UNTIL=2030-02-28", "FREQ=YEARLY;UNTIL=20300228"},
+		{"FREQ=DAILY;INTERVAL=1;", "FREQ=DAILY"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.src)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", tt.src, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseRule(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "FREQ is required"},
+		{"INTERVAL=2", "FREQ is required"},
+		{"FREQ=HOURLY", "unsupported FREQ HOURLY"},
+		{"FREQ=DAILY;FREQ=WEEKLY", "FREQ is given twice"},
+		{"FREQ=DAILY;INTERVAL", `invalid rule part "INTERVAL"`},
+		{"FREQ=DAILY;INTERVAL=0", "INTERVAL must be between 1 and 1000"},
+		{"FREQ=DAILY;COUNT=1001", "COUNT must be between 1 and 1000"},
+		{"FREQ=DAILY;UNTIL=tomorrow", `invalid UNTIL "TOMORROW"`},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20260101", "COUNT and UNTIL cannot be combined"},
+		{"FREQ=WEEKLY;BYDAY=XX", `invalid BYDAY "XX"`},
+		{"FREQ=MONTHLY;BYDAY=6MO", `invalid BYDAY "6MO"`},
+		{"FREQ=MONTHLY;BYDAY=0MO", `invalid BYDAY "0MO"`},
+		{"FREQ=WEEKLY;BYDAY=1MO", "numbered BYDAY needs FREQ=MONTHLY"},
+		{"FREQ=YEARLY;BYDAY=MO", "BYDAY needs FREQ=DAILY, WEEKLY or MONTHLY"},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", "BYMONTHDAY needs FREQ=MONTHLY"},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", `invalid BYMONTHDAY "32"`},
+		{"FREQ=MONTHLY;BYSETPOS=1", "unsupported rule part BYSETPOS"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRule(tt.src)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ParseRule(%q) error = %v, want %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start string
+		after string
+		want  string
+	}{
+		{
+			name:  "day 31 skips short months",
+			rule:  "FREQ=MONTHLY",
+			start: "2026-01-31", after: "2026-01-30",
+			want: "2026-01-31 2026-03-31 2026-05-31 2026-07-31 2026-08-31 2026-10-31",
+		},
+		{
+			name:  "last day of every month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: "2026-01-15", after: "2026-01-14",
+			want: "2026-01-31 2026-02-28 2026-03-31 2026-04-30",
+		},
+		{
+			name:  "BYMONTHDAY=31 in short months",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=30,31",
+			start: "2026-01-01", after: "2026-01-01",
+			want: "2026-01-30 2026-01-31 2026-03-30 2026-03-31 2026-04-30",
+		},
+		{
+			name:  "last Friday",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: "2026-01-01", after: "2025-12-31",
+			want: "2026-01-30 2026-02-27 2026-03-27 2026-04-24 2026-05-29",
+		},
+		{
+			name:  "first Monday every quarter",
+			rule:  "FREQ=MONTHLY;INTERVAL=3;BYDAY=1MO",
+			start: "2026-01-01", after: "2025-12-31",
+			want: "2026-01-05 2026-04-06 2026-07-06",
+		},
+		{
+			name:  "every other week on Monday and Thursday",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			start: "2026-01-07", after: "2026-01-06",
+			want: "2026-01-08 2026-01-19 2026-01-22 2026-02-02 2026-02-05",
+		},
+		{
+			name:  "every other week, jumping ahead",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			start: "2026-01-07", after: "2026-03-06",
+			want: "2026-03-16 2026-03-19",
+		},
+		{
+			name:  "weekly on the start weekday",
+			rule:  "FREQ=WEEKLY",
+			start: "2026-01-07", after: "2026-01-07",
+			want: "2026-01-14 2026-01-21",
+		},
+		{
+			name:  "weekdays only",
+			rule:  "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			start: "2026-01-01", after: "2026-01-01",
+			want: "2026-01-02 2026-01-05 2026-01-06",
+		},
+		{
+			name:  "COUNT",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: "2026-01-01", after: "2025-12-01",
+			want: "2026-01-01 2026-01-02 2026-01-03",
+		},
+		{
+			name:  "COUNT counts from the start",
+			rule:  "FREQ=WEEKLY;COUNT=4",
+			start: "2026-01-01", after: "2026-01-10",
+			want: "2026-01-15 2026-01-22",
+		},
+		{
+			name:  "COUNT used up",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: "2026-01-01", after: "2026-01-03",
+			want: "",
+		},
+		{
+			name:  "UNTIL is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20260115",
+			start: "2026-01-01", after: "2025-12-31",
+			want: "2026-01-01 2026-01-08 2026-01-15",
+		},
+		{
+			name:  "UNTIL passed",
+			rule:  "FREQ=WEEKLY;UNTIL=2026-01-14",
+			start: "2026-01-01", after: "2026-01-08",
+			want: "",
+		},
+		{
+			name:  "29 February",
+			rule:  "FREQ=YEARLY",
+			start: "2024-02-29", after: "2024-02-29",
+			want: "2028-02-29 2032-02-29",
+		},
+		{
+			name:  "yearly",
+			rule:  "FREQ=YEARLY;INTERVAL=2",
+			start: "2026-06-15", after: "2030-01-01",
+			want: "2030-06-15 2032-06-15",
+		},
+		{
+			name:  "every third day, jumping ahead",
+			rule:  "FREQ=DAILY;INTERVAL=3",
+			start: "2026-01-01", after: "2026-07-01",
+			want: "2026-07-03 2026-07-06",
+		},
+		{
+			name:  "first occurrence is the start",
+			rule:  "FREQ=MONTHLY",
+			start: "2026-01-15", after: "2020-01-01",
+			want: "2026-01-15",
+		},
+	}
+	for _, tt := range tests {
+		n := max(len(strings.Fields(tt.want)), 1)
+		if got := upcoming(t, tt.rule, tt.start, tt.after, n); got != tt.want {
+			t.Errorf("%s: %s from %s after %s = %q, want %q", tt.name, tt.rule, tt.start, tt.after, got, tt.want)
+		}
+	}
+}
+
+// Dates keep their calendar day in the caller's zone across DST changes.
+func TestNextAcrossDST(t *testing.T) {
+	for _, tz := range []string{"Europe/Berlin", "America/New_York", "Australia/Sydney"} {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ := ParseRule("FREQ=DAILY")
+		start := time.Date(2026, 1, 1, 0, 0, 0, 0, loc)
+		// Late evening, when the UTC date can differ from the local one
+		after := time.Date(2026, 1, 1, 23, 30, 0, 0, loc)
+		for i := 0; i < 366; i++ {
+			next, ok := r.Next(start, after)
+			want := time.Date(2026, 1, 2+i, 0, 0, 0, 0, time.UTC)
+			if !ok || !next.Equal(want) {
+				t.Fatalf("%s: daily after %s = %s, want %s", tz, after, next.Format(time.DateOnly), want.Format(time.DateOnly))
+			}
+			after = time.Date(2026, 1, 2+i, 23, 30, 0, 0, loc)
+		}
+
+		r, _ = ParseRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=SU")
+		start = time.Date(2026, 3, 1, 0, 0, 0, 0, loc)
+		next, ok := r.Next(start, time.Date(2026, 10, 20, 12, 0, 0, 0, loc))
+		if want := date("2026-10-25"); !ok || !next.Equal(want) {
+			t.Errorf("%s: fortnightly Sunday = %s, want %s", tz, next.Format(time.DateOnly), want.Format(time.DateOnly))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package pm
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/repo"
+)
+
+// Defaults of Options fields left zero.
+const (
+	DefaultPollInterval = time.Minute
+	DefaultScanInterval = 15 * time.Minute
+	DefaultBatchSize    = 10
+)
+
+// scanLease is how long a claimed org is hidden from other schedulers; a
+// scan taking longer has hung.
+const scanLease = 10 * time.Minute
+
+// Options tune a Scheduler.
+type Options struct {
+	PollInterval time.Duration // how often to look for orgs due a scan
+	ScanInterval time.Duration // how long after a scan an org is scanned again
+	BatchSize    int           // orgs claimed, and scanned concurrently, at once
+}
+
+// Scheduler scans the PM schedules of every org in turn and generates the
+// work orders that are due.
+type Scheduler struct {
+	repo repo.Repo
+	opts Options
+}
+
+// NewScheduler returns a Scheduler using r, which must not be bound to an
+// org.
+func NewScheduler(r repo.Repo, opts Options) *Scheduler {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.ScanInterval <= 0 {
+		opts.ScanInterval = DefaultScanInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Scheduler{repo: r, opts: opts}
+}
+
+// Run scans the orgs that are due every PollInterval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	slog.InfoContext(ctx, "pm scheduler started", "poll_interval", s.opts.PollInterval.String(),
+		"scan_interval", s.opts.ScanInterval.String())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := s.ScanDue(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "pm scans failed", "err", err)
+				}
+				if err != nil || n < s.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// ScanDue claims one batch of orgs due a scan, scans them and reports how
+// many were claimed.
+func (s *Scheduler) ScanDue(ctx context.Context) (int, error) {
+	orgs, err := s.repo.ClaimPMScans(ctx, s.opts.BatchSize, scanLease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, orgID := range orgs {
+		wg.Add(1)
+		go func(orgID uuid.UUID) {
+			defer wg.Done()
+			s.scan(ctx, orgID)
+		}(orgID)
+	}
+	wg.Wait()
+	return len(orgs), nil
+}
+
+// scan scans one claimed org and records when to scan it next.
+func (s *Scheduler) scan(ctx context.Context, orgID uuid.UUID) {
+	ctx = repo.WithOrg(ctx, orgID)
+	res, err := Generate(ctx, s.repo, orgID, time.Now())
+	for _, e := range res.Errors {
+		slog.WarnContext(ctx, "pm schedule failed", "org_id", orgID.String(), "pm_id", e.PMID.String(), "err", e.Error)
+	}
+	if len(res.Occurrences) > 0 {
+		slog.InfoContext(ctx, "pm occurrences handled", "org_id", orgID.String(), "count", len(res.Occurrences))
+	}
+	var msg string
+	if err != nil {
+		slog.ErrorContext(ctx, "pm scan failed", "org_id", orgID.String(), "err", err)
+		if msg = err.Error(); len(msg) > 500 {
+			msg = msg[:500]
+		}
+	}
+	// Record even when ctx was cancelled mid-scan, so the lease ends.
+	ctx = context.WithoutCancel(ctx)
+	if err := s.repo.FinishPMScan(ctx, orgID, time.Now().Add(s.opts.ScanInterval), msg); err != nil {
+		slog.ErrorContext(ctx, "record pm scan failed", "org_id", orgID.String(), "err", err)
+	}
+}
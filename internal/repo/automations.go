@@ -0,0 +1,533 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Automations ----------------
+
+// storedAction is an action as kept in app.automations.actions, with its
+// compiled SQL, which the API never returns.
+type storedAction struct {
+	models.AutomationAction
+	TableID int64             `json:"table_id,omitempty"`
+	SQL     map[string]string `json:"sql,omitempty"`
+}
+
+func encodeActions(actions []models.AutomationAction) ([]byte, error) {
+	stored := make([]storedAction, len(actions))
+	for i, a := range actions {
+		stored[i] = storedAction{AutomationAction: a, TableID: a.TableID, SQL: a.SQL}
+	}
+	return json.Marshal(stored)
+}
+
+func decodeActions(b []byte) ([]models.AutomationAction, error) {
+	var stored []storedAction
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	out := make([]models.AutomationAction, len(stored))
+	for i, s := range stored {
+		out[i] = s.AutomationAction
+		out[i].TableID = s.TableID
+		out[i].SQL = s.SQL
+	}
+	return out, nil
+}
+
+func automationFromRow(r db.GetAutomationRow) (models.Automation, error) {
+	actions, err := decodeActions(r.Actions)
+	if err != nil {
+		return models.Automation{}, err
+	}
+	a := models.Automation{
+		ID:        toUUID(r.ID),
+		Name:      r.Name,
+		Table:     r.TableSlug,
+		TableID:   r.TableID,
+		Trigger:   models.AutomationTrigger{On: r.Trigger, Field: textOrEmpty(r.TriggerField)},
+		Condition: textOrEmpty(r.ConditionExpression),
+		Actions:   actions,
+		Refs:      r.Refs,
+		Mode:      r.Mode,
+		Active:    r.Active,
+		CreatedAt: toTime(r.CreatedAt),
+		UpdatedAt: toTime(r.UpdatedAt),
+	}
+	if r.TriggerTo.Valid {
+		to := r.TriggerTo.String
+		a.Trigger.To = &to
+	}
+	return a, nil
+}
+
+func (p *pgRepo) ListAutomations(ctx context.Context, orgID uuid.UUID) ([]models.Automation, error) {
+	slog.DebugContext(ctx, "ListAutomations", "org_id", orgID.String())
+	rows, err := p.q.ListAutomations(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListAutomations failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.Automation, 0, len(rows))
+	for _, r := range rows {
+		a, err := automationFromRow(db.GetAutomationRow(r))
+		if err != nil {
+			slog.ErrorContext(ctx, "ListAutomations: bad actions JSON", "automation_id", toUUID(r.ID).String(), "err", err)
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// GetAutomation returns an automation of the org; found is false when there
+// is none with that id.
+func (p *pgRepo) GetAutomation(ctx context.Context, orgID, id uuid.UUID) (models.Automation, bool, error) {
+	r, err := p.q.GetAutomation(ctx, db.GetAutomationParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Automation{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetAutomation failed", "err", err)
+		return models.Automation{}, false, err
+	}
+	a, err := automationFromRow(r)
+	if err != nil {
+		slog.ErrorContext(ctx, "GetAutomation: bad actions JSON", "err", err)
+		return models.Automation{}, false, err
+	}
+	return a, true, nil
+}
+
+// automationParams returns the stored form of an automation's trigger,
+// condition, actions and refs.
+func automationParams(a models.Automation) (field, to, cond, condSQL pgtype.Text, actions []byte, refs []string, err error) {
+	field = toNullableText(a.Trigger.Field)
+	if a.Trigger.To != nil {
+		to = pgtype.Text{String: *a.Trigger.To, Valid: true}
+	}
+	cond, condSQL = toNullableText(a.Condition), toNullableText(a.ConditionSQL)
+	refs = a.Refs
+	if refs == nil {
+		refs = []string{}
+	}
+	actions, err = encodeActions(a.Actions)
+	return
+}
+
+// CreateAutomation stores an automation whose SQL has been compiled by the
+// caller and returns its id.
+func (p *pgRepo) CreateAutomation(ctx context.Context, orgID uuid.UUID, a models.Automation) (uuid.UUID, error) {
+	field, to, cond, condSQL, actions, refs, err := automationParams(a)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := p.q.InsertAutomation(ctx, db.InsertAutomationParams{
+		OrgID:               fromUUID(orgID),
+		TableID:             a.TableID,
+		Name:                a.Name,
+		Trigger:             a.Trigger.On,
+		TriggerField:        field,
+		TriggerTo:           to,
+		ConditionExpression: cond,
+		ConditionSql:        condSQL,
+		Actions:             actions,
+		Refs:                refs,
+		Mode:                a.Mode,
+		Active:              a.Active,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreateAutomation failed", "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// UpdateAutomation replaces the settings of an automation.
+func (p *pgRepo) UpdateAutomation(ctx context.Context, orgID uuid.UUID, a models.Automation) (bool, error) {
+	field, to, cond, condSQL, actions, refs, err := automationParams(a)
+	if err != nil {
+		return false, err
+	}
+	n, err := p.q.UpdateAutomation(ctx, db.UpdateAutomationParams{
+		TableID:             a.TableID,
+		Name:                a.Name,
+		Trigger:             a.Trigger.On,
+		TriggerField:        field,
+		TriggerTo:           to,
+		ConditionExpression: cond,
+		ConditionSql:        condSQL,
+		Actions:             actions,
+		Refs:                refs,
+		Mode:                a.Mode,
+		Active:              a.Active,
+		ID:                  fromUUID(a.ID),
+		OrgID:               fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateAutomation failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteAutomation removes an automation together with its run log.
+func (p *pgRepo) DeleteAutomation(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteAutomation(ctx, db.DeleteAutomationParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteAutomation failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// AutomationsUsingColumn names the automations that read or write a column
+// of a table, on that table or, creating rows, on another one.
+func (p *pgRepo) AutomationsUsingColumn(ctx context.Context, orgID uuid.UUID, tableID int64, column string) ([]string, error) {
+	names, err := p.q.AutomationsUsingColumn(ctx, db.AutomationsUsingColumnParams{
+		OrgID:      fromUUID(orgID),
+		TableID:    tableID,
+		ColumnName: column,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "AutomationsUsingColumn failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+// AutomationsUsingTable names the automations of other tables that create
+// rows in a table.
+func (p *pgRepo) AutomationsUsingTable(ctx context.Context, orgID uuid.UUID, tableID int64) ([]string, error) {
+	names, err := p.q.AutomationsUsingTable(ctx, db.AutomationsUsingTableParams{OrgID: fromUUID(orgID), TableID: tableID})
+	if err != nil {
+		slog.ErrorContext(ctx, "AutomationsUsingTable failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+// ---------------- Automation runs ----------------
+
+// MatchAutomations returns the active automations of the table of a row
+// event whose trigger and condition match it, in the order they run. Only
+// ID, Name, Table, TableID, Actions and Mode are set.
+func (p *pgRepo) MatchAutomations(ctx context.Context, orgID uuid.UUID, eventID int64) ([]models.Automation, error) {
+	slog.DebugContext(ctx, "MatchAutomations", "org_id", orgID.String(), "event_id", eventID)
+	rows, err := p.q.MatchAutomations(ctx, eventID)
+	if err != nil {
+		slog.ErrorContext(ctx, "MatchAutomations failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.Automation, 0, len(rows))
+	for _, r := range rows {
+		actions, err := decodeActions(r.Actions)
+		if err != nil {
+			slog.ErrorContext(ctx, "MatchAutomations: bad actions JSON", "automation_id", toUUID(r.ID).String(), "err", err)
+			return nil, err
+		}
+		out = append(out, models.Automation{
+			ID:      toUUID(r.ID),
+			Name:    r.Name,
+			Table:   r.TableSlug,
+			TableID: r.TableID,
+			Actions: actions,
+			Mode:    r.Mode,
+		})
+	}
+	return out, nil
+}
+
+// EvalAutomationValues evaluates compiled action expressions, keyed by
+// name, against a row event.
+func (p *pgRepo) EvalAutomationValues(ctx context.Context, eventID int64, exprs map[string]string) (map[string]any, error) {
+	b, err := json.Marshal(exprs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.q.EvalAutomationValues(ctx, db.EvalAutomationValuesParams{EventID: eventID, Exprs: b})
+	if err != nil {
+		slog.ErrorContext(ctx, "EvalAutomationValues failed", "event_id", eventID, "err", err)
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(res, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetActingUser sets the user later statements of the transaction act for;
+// uuid.Nil acts for no user, bypassing field access rules and row policies.
+// It only has an effect inside InTx.
+func (p *pgRepo) SetActingUser(ctx context.Context, userID uuid.UUID) error {
+	user := ""
+	if userID != uuid.Nil {
+		user = userID.String()
+	}
+	if err := p.q.SetActingUser(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "SetActingUser failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// InsertAutomationRun logs a run of an automation and returns its id. A
+// pending sync run is finished with FinishAutomationRun in the same
+// transaction; a pending async run is queued for the runner.
+func (p *pgRepo) InsertAutomationRun(ctx context.Context, orgID uuid.UUID, run models.AutomationRun) (int64, error) {
+	var event pgtype.Int8
+	if run.EventID != nil {
+		event = pgtype.Int8{Int64: *run.EventID, Valid: true}
+	}
+	var row pgtype.UUID
+	if run.RowID != nil {
+		row = fromUUID(*run.RowID)
+	}
+	id, err := p.q.InsertAutomationRun(ctx, db.InsertAutomationRunParams{
+		OrgID:        fromUUID(orgID),
+		AutomationID: fromUUID(run.AutomationID),
+		EventID:      event,
+		RowID:        row,
+		Mode:         run.Mode,
+		Status:       run.Status,
+		Depth:        int32(run.Depth),
+		Error:        toNullableText(run.Error),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertAutomationRun failed", "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// FinishAutomationRun stores the outcome of a run: the new status, an error
+// message, what the actions did and, for runs left pending, when to try
+// again.
+func (p *pgRepo) FinishAutomationRun(ctx context.Context, orgID uuid.UUID, runID int64, status, errMsg string, result []byte, next time.Time) error {
+	err := p.q.FinishAutomationRun(ctx, db.FinishAutomationRunParams{
+		Status:        status,
+		Error:         toNullableText(errMsg),
+		Result:        result,
+		NextAttemptAt: pgtype.Timestamptz{Time: next, Valid: true},
+		ID:            runID,
+		OrgID:         fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "FinishAutomationRun failed", "run_id", runID, "err", err)
+	}
+	return err
+}
+
+// ListAutomationRuns returns the latest runs of an automation, newest
+// first, optionally only those with the given status.
+func (p *pgRepo) ListAutomationRuns(ctx context.Context, orgID, automationID uuid.UUID, status string, limit int) ([]models.AutomationRun, error) {
+	rows, err := p.q.ListAutomationRuns(ctx, db.ListAutomationRunsParams{
+		AutomationID: fromUUID(automationID),
+		OrgID:        fromUUID(orgID),
+		Status:       toNullableText(status),
+		LimitCount:   int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListAutomationRuns failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.AutomationRun, 0, len(rows))
+	for _, r := range rows {
+		run := models.AutomationRun{
+			ID:           r.ID,
+			AutomationID: toUUID(r.AutomationID),
+			Mode:         r.Mode,
+			Status:       r.Status,
+			Depth:        int(r.Depth),
+			Attempts:     int(r.Attempts),
+			Error:        textOrEmpty(r.Error),
+			Result:       r.Result,
+			CreatedAt:    toTime(r.CreatedAt),
+		}
+		if r.EventID.Valid {
+			id := r.EventID.Int64
+			run.EventID = &id
+		}
+		if r.RowID.Valid {
+			id := toUUID(r.RowID)
+			run.RowID = &id
+		}
+		if r.FinishedAt.Valid {
+			t := r.FinishedAt.Time
+			run.FinishedAt = &t
+		}
+		out = append(out, run)
+	}
+	return out, nil
+}
+
+// RetryAutomationRun queues a failed async run again with a fresh retry
+// budget.
+func (p *pgRepo) RetryAutomationRun(ctx context.Context, orgID, automationID uuid.UUID, runID int64) (bool, error) {
+	n, err := p.q.RetryAutomationRun(ctx, db.RetryAutomationRunParams{
+		ID:           runID,
+		AutomationID: fromUUID(automationID),
+		OrgID:        fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RetryAutomationRun failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ClaimAutomationRuns claims up to limit due async runs of every org, like
+// ClaimWebhookDeliveries. It must run without an org in ctx.
+func (p *pgRepo) ClaimAutomationRuns(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error) {
+	rows, err := p.q.ClaimAutomationRuns(ctx, db.ClaimAutomationRunsParams{
+		LimitCount:   int32(limit),
+		LeaseSeconds: int32(lease / time.Second),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClaimAutomationRuns failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.ClaimedJob, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.ClaimedJob{ID: r.ID, OrgID: toUUID(r.OrgID)})
+	}
+	return out, nil
+}
+
+// GetAutomationJob loads a pending run with its automation; found is false
+// once it is no longer pending or its event is gone.
+func (p *pgRepo) GetAutomationJob(ctx context.Context, orgID uuid.UUID, runID int64) (models.AutomationJob, bool, error) {
+	r, err := p.q.GetAutomationJob(ctx, db.GetAutomationJobParams{ID: runID, OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !r.EventID.Valid) {
+		return models.AutomationJob{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetAutomationJob failed", "err", err)
+		return models.AutomationJob{}, false, err
+	}
+	actions, err := decodeActions(r.Actions)
+	if err != nil {
+		slog.ErrorContext(ctx, "GetAutomationJob: bad actions JSON", "err", err)
+		return models.AutomationJob{}, false, err
+	}
+	return models.AutomationJob{
+		RunID:    r.RunID,
+		Attempts: int(r.Attempts),
+		Depth:    int(r.Depth),
+		EventID:  r.EventID.Int64,
+		RowID:    toUUID(r.RowID),
+		Automation: models.Automation{
+			ID:      toUUID(r.ID),
+			Name:    r.Name,
+			Table:   r.TableSlug,
+			TableID: r.TableID,
+			Actions: actions,
+			Mode:    r.Mode,
+			Active:  r.Active,
+		},
+	}, true, nil
+}
+
+// QueueWebhookDelivery queues a delivery of an event to an active webhook
+// of the org that does not have one yet; false when nothing was queued.
+func (p *pgRepo) QueueWebhookDelivery(ctx context.Context, orgID, webhookID uuid.UUID, eventID int64) (bool, error) {
+	n, err := p.q.QueueWebhookDelivery(ctx, db.QueueWebhookDeliveryParams{
+		EventID:   eventID,
+		WebhookID: fromUUID(webhookID),
+		OrgID:     fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "QueueWebhookDelivery failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ---------------- Mail outbox ----------------
+
+// QueueEmail adds an email to the outbox; runID names the automation run
+// that sent it, if any.
+func (p *pgRepo) QueueEmail(ctx context.Context, orgID uuid.UUID, runID int64, to []string, subject, body string) error {
+	var run pgtype.Int8
+	if runID != 0 {
+		run = pgtype.Int8{Int64: runID, Valid: true}
+	}
+	err := p.q.QueueEmail(ctx, db.QueueEmailParams{
+		OrgID:      fromUUID(orgID),
+		RunID:      run,
+		Recipients: to,
+		Subject:    subject,
+		Body:       body,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "QueueEmail failed", "err", err)
+	}
+	return err
+}
+
+// ClaimOutboundEmails claims up to limit due emails of every org, like
+// ClaimWebhookDeliveries. It must run without an org in ctx.
+func (p *pgRepo) ClaimOutboundEmails(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error) {
+	rows, err := p.q.ClaimOutboundEmails(ctx, db.ClaimOutboundEmailsParams{
+		LimitCount:   int32(limit),
+		LeaseSeconds: int32(lease / time.Second),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClaimOutboundEmails failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.ClaimedJob, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.ClaimedJob{ID: r.ID, OrgID: toUUID(r.OrgID)})
+	}
+	return out, nil
+}
+
+// GetOutboundEmail loads a pending email; found is false once it is no
+// longer pending.
+func (p *pgRepo) GetOutboundEmail(ctx context.Context, orgID uuid.UUID, id int64) (models.OutboundEmail, bool, error) {
+	r, err := p.q.GetOutboundEmail(ctx, db.GetOutboundEmailParams{ID: id, OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.OutboundEmail{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetOutboundEmail failed", "err", err)
+		return models.OutboundEmail{}, false, err
+	}
+	return models.OutboundEmail{
+		ID:         r.ID,
+		Recipients: r.Recipients,
+		Subject:    r.Subject,
+		Body:       r.Body,
+		Attempts:   int(r.Attempts),
+	}, true, nil
+}
+
+// RecordEmailAttempt stores the outcome of a send attempt: the new status,
+// an error message and, for pending emails, when to try again.
+func (p *pgRepo) RecordEmailAttempt(ctx context.Context, orgID uuid.UUID, id int64, status, errMsg string, next time.Time) error {
+	err := p.q.RecordEmailAttempt(ctx, db.RecordEmailAttemptParams{
+		Status:        status,
+		LastError:     toNullableText(errMsg),
+		NextAttemptAt: pgtype.Timestamptz{Time: next, Valid: true},
+		ID:            id,
+		OrgID:         fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RecordEmailAttempt failed", "email_id", id, "err", err)
+	}
+	return err
+}
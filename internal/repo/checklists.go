@@ -0,0 +1,314 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Checklists ----------------
+
+// ListChecklistTemplates returns the checklist templates of the org by
+// name, without their items.
+func (p *pgRepo) ListChecklistTemplates(ctx context.Context, orgID uuid.UUID) ([]models.ChecklistTemplate, error) {
+	rows, err := p.q.ListChecklistTemplates(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListChecklistTemplates failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.ChecklistTemplate, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, checklistTemplate(db.GetChecklistTemplateRow(r)))
+	}
+	return out, nil
+}
+
+// GetChecklistTemplate returns a checklist template with its items.
+func (p *pgRepo) GetChecklistTemplate(ctx context.Context, orgID, id uuid.UUID) (models.ChecklistTemplate, bool, error) {
+	r, err := p.q.GetChecklistTemplate(ctx, db.GetChecklistTemplateParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ChecklistTemplate{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetChecklistTemplate failed", "id", id.String(), "err", err)
+		return models.ChecklistTemplate{}, false, err
+	}
+	t := checklistTemplate(r)
+	items, err := p.q.ListChecklistTemplateItems(ctx, db.ListChecklistTemplateItemsParams{OrgID: fromUUID(orgID), TemplateID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListChecklistTemplateItems failed", "id", id.String(), "err", err)
+		return models.ChecklistTemplate{}, false, err
+	}
+	t.Items = make([]models.ChecklistTemplateItem, 0, len(items))
+	for _, i := range items {
+		t.Items = append(t.Items, models.ChecklistTemplateItem{
+			ID:       toUUID(i.ID),
+			Position: int(i.Position),
+			Label:    i.Label,
+			Kind:     i.Kind,
+			Required: i.Required,
+			Min:      optNumeric(i.MinValue),
+			Max:      optNumeric(i.MaxValue),
+			Unit:     textOrEmpty(i.Unit),
+			FollowUp: i.FollowUp,
+			Help:     textOrEmpty(i.Help),
+		})
+	}
+	return t, true, nil
+}
+
+func checklistTemplate(r db.GetChecklistTemplateRow) models.ChecklistTemplate {
+	return models.ChecklistTemplate{
+		ID:          toUUID(r.ID),
+		Name:        r.Name,
+		Description: textOrEmpty(r.Description),
+		ItemCount:   int(r.ItemCount),
+		CreatedBy:   optUUID(r.CreatedBy),
+		CreatedAt:   toTime(r.CreatedAt),
+		UpdatedAt:   toTime(r.UpdatedAt),
+	}
+}
+
+// CreateChecklistTemplate creates a template without items.
+func (p *pgRepo) CreateChecklistTemplate(ctx context.Context, orgID uuid.UUID, t models.ChecklistTemplate) (uuid.UUID, error) {
+	id, err := p.q.CreateChecklistTemplate(ctx, db.CreateChecklistTemplateParams{
+		OrgID:       fromUUID(orgID),
+		Name:        t.Name,
+		Description: toNullableText(t.Description),
+		CreatedBy:   optID(t.CreatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreateChecklistTemplate failed", "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// UpdateChecklistTemplate sets the name and description of a template.
+func (p *pgRepo) UpdateChecklistTemplate(ctx context.Context, orgID uuid.UUID, t models.ChecklistTemplate) (bool, error) {
+	n, err := p.q.UpdateChecklistTemplate(ctx, db.UpdateChecklistTemplateParams{
+		Name:        t.Name,
+		Description: toNullableText(t.Description),
+		OrgID:       fromUUID(orgID),
+		ID:          fromUUID(t.ID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateChecklistTemplate failed", "id", t.ID.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetChecklistTemplateItems replaces the items of a template, numbering
+// them in order. Call it inside InTx.
+func (p *pgRepo) SetChecklistTemplateItems(ctx context.Context, orgID, templateID uuid.UUID, items []models.ChecklistTemplateItem) error {
+	err := p.q.ClearChecklistTemplateItems(ctx, db.ClearChecklistTemplateItemsParams{OrgID: fromUUID(orgID), TemplateID: fromUUID(templateID)})
+	for i, it := range items {
+		if err != nil {
+			break
+		}
+		err = p.q.InsertChecklistTemplateItem(ctx, db.InsertChecklistTemplateItemParams{
+			OrgID:      fromUUID(orgID),
+			TemplateID: fromUUID(templateID),
+			Position:   int32(i + 1),
+			Label:      it.Label,
+			Kind:       it.Kind,
+			Required:   it.Required,
+			MinValue:   toFloat(it.Min),
+			MaxValue:   toFloat(it.Max),
+			Unit:       toNullableText(it.Unit),
+			FollowUp:   it.FollowUp,
+			Help:       toNullableText(it.Help),
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "SetChecklistTemplateItems failed", "template_id", templateID.String(), "err", err)
+	}
+	return err
+}
+
+// DeleteChecklistTemplate deletes a template; checklists copied from it
+// stay on their work orders.
+func (p *pgRepo) DeleteChecklistTemplate(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteChecklistTemplate(ctx, db.DeleteChecklistTemplateParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteChecklistTemplate failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CopyChecklist copies a template onto a work order and returns the new
+// checklist; false when the template does not exist.
+func (p *pgRepo) CopyChecklist(ctx context.Context, workOrderID, templateID uuid.UUID, createdBy *uuid.UUID) (uuid.UUID, bool, error) {
+	id, err := p.q.CopyChecklist(ctx, db.CopyChecklistParams{
+		WorkOrderID: fromUUID(workOrderID),
+		TemplateID:  fromUUID(templateID),
+		CreatedBy:   optID(createdBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CopyChecklist failed", "work_order_id", workOrderID.String(), "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(id), id.Valid, nil
+}
+
+// ListWorkOrderChecklists returns the checklists of a work order with their
+// items, the first added first.
+func (p *pgRepo) ListWorkOrderChecklists(ctx context.Context, orgID, workOrderID uuid.UUID) ([]models.Checklist, error) {
+	rows, err := p.q.ListWorkOrderChecklists(ctx, db.ListWorkOrderChecklistsParams{OrgID: fromUUID(orgID), WorkOrderID: fromUUID(workOrderID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListWorkOrderChecklists failed", "err", err)
+		return nil, err
+	}
+	items, err := p.q.ListChecklistItems(ctx, db.ListChecklistItemsParams{OrgID: fromUUID(orgID), WorkOrderID: fromUUID(workOrderID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListChecklistItems failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.Checklist, 0, len(rows))
+	at := make(map[uuid.UUID]int, len(rows))
+	for _, r := range rows {
+		at[toUUID(r.ID)] = len(out)
+		out = append(out, models.Checklist{
+			ID:          toUUID(r.ID),
+			WorkOrderID: toUUID(r.WorkOrderID),
+			TemplateID:  optUUID(r.TemplateID),
+			Name:        r.Name,
+			Items:       []models.ChecklistItem{},
+			CreatedBy:   optUUID(r.CreatedBy),
+			CreatedAt:   toTime(r.CreatedAt),
+		})
+	}
+	for _, r := range items {
+		i, ok := at[toUUID(r.ChecklistID)]
+		if !ok {
+			continue
+		}
+		it := models.ChecklistItem{
+			ChecklistTemplateItem: models.ChecklistTemplateItem{
+				ID:       toUUID(r.ID),
+				Position: int(r.Position),
+				Label:    r.Label,
+				Kind:     r.Kind,
+				Required: r.Required,
+				Min:      optNumeric(r.MinValue),
+				Max:      optNumeric(r.MaxValue),
+				Unit:     textOrEmpty(r.Unit),
+				FollowUp: r.FollowUp,
+				Help:     textOrEmpty(r.Help),
+			},
+			ChecklistID:         toUUID(r.ChecklistID),
+			Result:              textOrEmpty(r.Result),
+			Reading:             optNumeric(r.Reading),
+			Text:                textOrEmpty(r.TextValue),
+			File:                textOrEmpty(r.File),
+			Note:                textOrEmpty(r.Note),
+			CompletedBy:         optUUID(r.CompletedBy),
+			CompletedByEmail:    textOrEmpty(r.CompletedByEmail),
+			FollowUpWorkOrderID: optUUID(r.FollowUpWorkOrderID),
+		}
+		if r.CompletedAt.Valid {
+			t := r.CompletedAt.Time
+			it.CompletedAt = &t
+		}
+		c := &out[i]
+		switch {
+		case it.CompletedAt != nil:
+			c.Answered++
+			if it.Result == models.ChecklistFail {
+				c.Failed++
+			}
+		case it.Required:
+			c.Open++
+		}
+		c.Items = append(c.Items, it)
+	}
+	return out, nil
+}
+
+// DeleteChecklist removes a checklist from a work order.
+func (p *pgRepo) DeleteChecklist(ctx context.Context, orgID, workOrderID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteChecklist(ctx, db.DeleteChecklistParams{OrgID: fromUUID(orgID), WorkOrderID: fromUUID(workOrderID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteChecklist failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// AnswerChecklistItem records the answer of an item, now and by
+// item.CompletedBy.
+func (p *pgRepo) AnswerChecklistItem(ctx context.Context, orgID uuid.UUID, item models.ChecklistItem) (bool, error) {
+	n, err := p.q.AnswerChecklistItem(ctx, db.AnswerChecklistItemParams{
+		Result:      item.Result,
+		Reading:     toFloat(item.Reading),
+		TextValue:   toNullableText(item.Text),
+		File:        toNullableText(item.File),
+		Note:        toNullableText(item.Note),
+		CompletedBy: optID(item.CompletedBy),
+		OrgID:       fromUUID(orgID),
+		ChecklistID: fromUUID(item.ChecklistID),
+		ID:          fromUUID(item.ID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "AnswerChecklistItem failed", "id", item.ID.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ClearChecklistItem removes the answer of an item.
+func (p *pgRepo) ClearChecklistItem(ctx context.Context, orgID, checklistID, id uuid.UUID) (bool, error) {
+	n, err := p.q.ClearChecklistItem(ctx, db.ClearChecklistItemParams{OrgID: fromUUID(orgID), ChecklistID: fromUUID(checklistID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClearChecklistItem failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetChecklistItemFollowUp links an item to the work order created for its
+// failure.
+func (p *pgRepo) SetChecklistItemFollowUp(ctx context.Context, orgID, id, workOrderID uuid.UUID) error {
+	err := p.q.SetChecklistItemFollowUp(ctx, db.SetChecklistItemFollowUpParams{WorkOrderID: fromUUID(workOrderID), OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "SetChecklistItemFollowUp failed", "id", id.String(), "err", err)
+	}
+	return err
+}
+
+// WorkOrderChecklistOpen returns the number of required checklist items of
+// a work order not answered yet.
+func (p *pgRepo) WorkOrderChecklistOpen(ctx context.Context, workOrderID uuid.UUID) (int, error) {
+	n, err := p.q.WorkOrderChecklistOpen(ctx, fromUUID(workOrderID))
+	if err != nil {
+		slog.ErrorContext(ctx, "WorkOrderChecklistOpen failed", "work_order_id", workOrderID.String(), "err", err)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// toFloat converts an optional number to a possibly NULL float8.
+func toFloat(v *float64) pgtype.Float8 {
+	if v == nil {
+		return pgtype.Float8{}
+	}
+	return pgtype.Float8{Float64: *v, Valid: true}
+}
+
+// optFloat converts a possibly NULL float8 to an optional number.
+func optFloat(f pgtype.Float8) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	v := f.Float64
+	return &v
+}
@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Files ----------------
+
+// GetFile returns a file of the org.
+func (p *pgRepo) GetFile(ctx context.Context, orgID, id uuid.UUID) (models.File, bool, error) {
+	r, err := p.q.GetFile(ctx, db.GetFileParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.File{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetFile failed", "id", id.String(), "err", err)
+		return models.File{}, false, err
+	}
+	return fileRow(r), true, nil
+}
+
+// GetFileBySHA256 returns the file of the org with the given content.
+func (p *pgRepo) GetFileBySHA256(ctx context.Context, orgID uuid.UUID, sha256 string) (models.File, bool, error) {
+	r, err := p.q.GetFileBySHA256(ctx, db.GetFileBySHA256Params{OrgID: fromUUID(orgID), Sha256: sha256})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.File{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetFileBySHA256 failed", "err", err)
+		return models.File{}, false, err
+	}
+	return fileRow(db.GetFileRow(r)), true, nil
+}
+
+// InsertFile stores a file and returns its id, false when a file with the
+// same content was stored first; its id is returned then.
+func (p *pgRepo) InsertFile(ctx context.Context, orgID uuid.UUID, f models.File) (uuid.UUID, bool, error) {
+	r, err := p.q.InsertFile(ctx, db.InsertFileParams{
+		OrgID:       fromUUID(orgID),
+		Name:        f.Name,
+		ContentType: f.ContentType,
+		Size:        f.Size,
+		Sha256:      f.SHA256,
+		Width:       toInt(f.Width),
+		Height:      toInt(f.Height),
+		Thumbnail:   f.Thumbnail,
+		Latitude:    toFloat(f.Latitude),
+		Longitude:   toFloat(f.Longitude),
+		TakenAt:     optTime(f.TakenAt),
+		CreatedBy:   optID(f.CreatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertFile failed", "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(r.ID), r.Created, nil
+}
+
+// ListFiles returns the org's files, newest first, or those linked to
+// rowID when set.
+func (p *pgRepo) ListFiles(ctx context.Context, orgID uuid.UUID, rowID *uuid.UUID, limit int) ([]models.File, error) {
+	rows, err := p.q.ListFiles(ctx, db.ListFilesParams{OrgID: fromUUID(orgID), RowID: optID(rowID), Lim: int32(limit)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListFiles failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.File, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, fileRow(db.GetFileRow(r)))
+	}
+	return out, nil
+}
+
+func fileRow(r db.GetFileRow) models.File {
+	f := models.File{
+		ID:          toUUID(r.ID),
+		Name:        r.Name,
+		ContentType: r.ContentType,
+		Size:        r.Size,
+		SHA256:      r.Sha256,
+		Width:       optInt(r.Width),
+		Height:      optInt(r.Height),
+		Thumbnail:   r.Thumbnail,
+		Latitude:    optFloat(r.Latitude),
+		Longitude:   optFloat(r.Longitude),
+		CreatedBy:   optUUID(r.CreatedBy),
+		CreatedAt:   toTime(r.CreatedAt),
+	}
+	if r.TakenAt.Valid {
+		t := r.TakenAt.Time
+		f.TakenAt = &t
+	}
+	return f
+}
+
+// DeleteFile deletes a file and its links. The caller removes its blobs.
+func (p *pgRepo) DeleteFile(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteFile(ctx, db.DeleteFileParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteFile failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// LinkFile links a file to a row; linking it again is a no-op.
+func (p *pgRepo) LinkFile(ctx context.Context, orgID, fileID, rowID uuid.UUID, createdBy *uuid.UUID) error {
+	err := p.q.LinkFile(ctx, db.LinkFileParams{
+		OrgID:     fromUUID(orgID),
+		FileID:    fromUUID(fileID),
+		RowID:     fromUUID(rowID),
+		CreatedBy: optID(createdBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "LinkFile failed", "file_id", fileID.String(), "row_id", rowID.String(), "err", err)
+	}
+	return err
+}
+
+// UnlinkFile removes the link of a file to a row.
+func (p *pgRepo) UnlinkFile(ctx context.Context, orgID, fileID, rowID uuid.UUID) (bool, error) {
+	n, err := p.q.UnlinkFile(ctx, db.UnlinkFileParams{OrgID: fromUUID(orgID), FileID: fromUUID(fileID), RowID: fromUUID(rowID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "UnlinkFile failed", "file_id", fileID.String(), "row_id", rowID.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ListFileLinks returns the rows a file is linked to that the user sees.
+func (p *pgRepo) ListFileLinks(ctx context.Context, orgID, fileID uuid.UUID) ([]models.FileLink, error) {
+	rows, err := p.q.ListFileLinks(ctx, db.ListFileLinksParams{OrgID: fromUUID(orgID), FileID: fromUUID(fileID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListFileLinks failed", "file_id", fileID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.FileLink, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.FileLink{
+			RowID:     toUUID(r.RowID),
+			TableID:   r.TableID,
+			TableSlug: r.TableSlug,
+			CreatedBy: optUUID(r.CreatedBy),
+			CreatedAt: toTime(r.CreatedAt),
+		})
+	}
+	return out, nil
+}
+
+// toInt converts an optional number to a possibly NULL int.
+func toInt(v *int) pgtype.Int4 {
+	if v == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: int32(*v), Valid: true}
+}
+
+// optInt converts a possibly NULL int to an optional number.
+func optInt(i pgtype.Int4) *int {
+	if !i.Valid {
+		return nil
+	}
+	v := int(i.Int32)
+	return &v
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Row hierarchies ----------------
+
+// GetHierarchy returns the hierarchy of a table; found is false when the
+// table has none.
+func (p *pgRepo) GetHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64) (models.Hierarchy, bool, error) {
+	rows, err := p.q.GetHierarchy(ctx, db.GetHierarchyParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "GetHierarchy failed", "err", err)
+		return models.Hierarchy{}, false, err
+	}
+	if len(rows) == 0 {
+		return models.Hierarchy{}, false, nil
+	}
+	r := rows[0]
+	return models.Hierarchy{
+		Table:     r.TableSlug,
+		TableID:   r.TableID,
+		Column:    r.ColumnName,
+		ColumnID:  r.ColumnID,
+		CreatedAt: toTime(r.CreatedAt),
+	}, true, nil
+}
+
+// PutHierarchy makes a column the parent of the rows of its table, in place
+// of the table's previous hierarchy if any. valid is false unless the column
+// is a uuid column referencing the table; cycle names a row that already is
+// its own ancestor through the column, in which case nothing changes.
+func (p *pgRepo) PutHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64, column string) (valid bool, cycle uuid.UUID, err error) {
+	res, err := p.q.PutHierarchy(ctx, db.PutHierarchyParams{
+		TableID:    tableID,
+		ColumnName: column,
+		OrgID:      fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "PutHierarchy failed", "err", err)
+		return false, uuid.Nil, err
+	}
+	if res.CycleRow.Valid {
+		cycle = toUUID(res.CycleRow)
+	}
+	return res.Valid, cycle, nil
+}
+
+// DeleteHierarchy removes the hierarchy of a table; the parent column and
+// its values stay. deleted is false when the table has none.
+func (p *pgRepo) DeleteHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64) (bool, error) {
+	n, err := p.q.DeleteHierarchy(ctx, db.DeleteHierarchyParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteHierarchy failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RowSubtree returns a row of a hierarchy and up to maxNodes rows below it,
+// down to maxDepth levels (all when 0). Rows the caller may not see are
+// left out with everything below them; found is false when the row itself
+// is not visible.
+func (p *pgRepo) RowSubtree(ctx context.Context, h models.Hierarchy, root uuid.UUID, maxDepth, maxNodes int) (models.Subtree, bool, error) {
+	params := db.RowSubtreeParams{
+		ColumnID: h.ColumnID,
+		Root:     fromUUID(root),
+		MaxNodes: int64(maxNodes),
+		TableID:  h.TableID,
+	}
+	if maxDepth > 0 {
+		params.MaxDepth = pgtype.Int4{Int32: int32(maxDepth), Valid: true}
+	}
+	rows, err := p.q.RowSubtree(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "RowSubtree failed", "err", err)
+		return models.Subtree{}, false, err
+	}
+	out := models.Subtree{Nodes: make([]models.TreeNode, 0, len(rows))}
+	// Rows come by depth, so a parent is kept before its children are seen
+	kept := make(map[uuid.UUID]bool, len(rows))
+	for _, r := range rows {
+		out.Truncated = r.Truncated
+		id := toUUID(r.ID)
+		n := models.TreeNode{ID: id, Depth: int(r.Depth)}
+		if r.Depth > 0 {
+			parent := toUUID(r.ParentID)
+			if !kept[parent] {
+				continue
+			}
+			n.ParentID = &parent
+		}
+		if r.Label.Valid {
+			n.Label = &r.Label.String
+		}
+		kept[id] = true
+		out.Nodes = append(out.Nodes, n)
+	}
+	return out, kept[root], nil
+}
+
+// RowAncestors returns the ancestors of a row of a hierarchy, the root
+// first, up to the nearest one the caller may not see. found is false when
+// the row itself is not visible.
+func (p *pgRepo) RowAncestors(ctx context.Context, h models.Hierarchy, rowID uuid.UUID) ([]models.TreeNode, bool, error) {
+	rows, err := p.q.RowAncestors(ctx, db.RowAncestorsParams{
+		RowID:    fromUUID(rowID),
+		ColumnID: h.ColumnID,
+		TableID:  h.TableID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RowAncestors failed", "err", err)
+		return nil, false, err
+	}
+	if len(rows) == 0 || !rows[0].Visible {
+		return nil, false, nil
+	}
+	// rows[0] is the row itself and rows[i+1] the parent of rows[i]
+	var chain []models.TreeNode
+	for i := 1; i < len(rows) && rows[i].Visible; i++ {
+		n := models.TreeNode{ID: toUUID(rows[i].ID), Depth: int(rows[i].Depth)}
+		if rows[i].Label.Valid {
+			n.Label = &rows[i].Label.String
+		}
+		if i+1 < len(rows) && rows[i+1].Visible {
+			parent := toUUID(rows[i+1].ID)
+			n.ParentID = &parent
+		}
+		chain = append(chain, n)
+	}
+	out := make([]models.TreeNode, 0, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		out = append(out, chain[i])
+	}
+	return out, true, nil
+}
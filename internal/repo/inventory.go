@@ -0,0 +1,440 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Stock ledger ----------------
+
+// InsertStockMovement stores a movement, which the database applies to the
+// stock levels; a movement taking more than a level holds fails with a
+// check violation. The stored movement carries the expiry of the lot it
+// took from.
+func (p *pgRepo) InsertStockMovement(ctx context.Context, orgID uuid.UUID, m models.StockMovement) (models.StockMovement, error) {
+	expires, err := pgDate(m.ExpiresOn)
+	if err != nil {
+		return models.StockMovement{}, err
+	}
+	params := db.InsertStockMovementParams{
+		OrgID:       fromUUID(orgID),
+		PartID:      fromUUID(m.PartID),
+		Kind:        m.Kind,
+		Quantity:    m.Quantity,
+		FromBinID:   optID(m.FromBinID),
+		ToBinID:     optID(m.ToBinID),
+		Lot:         m.Lot,
+		Serial:      m.Serial,
+		ExpiresOn:   expires,
+		WorkOrderID: optID(m.WorkOrderID),
+		OrderID:     optID(m.OrderID),
+		Note:        toNullableText(m.Note),
+		CreatedBy:   optID(m.CreatedBy),
+	}
+	if m.UnitCost != nil {
+		params.UnitCost = pgtype.Float8{Float64: *m.UnitCost, Valid: true}
+	}
+	row, err := p.q.InsertStockMovement(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertStockMovement failed", "part_id", m.PartID.String(), "kind", m.Kind, "err", err)
+		return models.StockMovement{}, err
+	}
+	m.ID, m.ExpiresOn, m.CreatedAt = row.ID, dateOn(row.ExpiresOn), toTime(row.CreatedAt)
+	return m, nil
+}
+
+// ListStockMovements returns movements of parts of the parts table the
+// caller may see, latest first, below beforeID when not 0.
+func (p *pgRepo) ListStockMovements(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter, beforeID int64, limit int) ([]models.StockMovement, error) {
+	params := db.ListStockMovementsParams{
+		OrgID:        fromUUID(orgID),
+		PartID:       optID(f.PartID),
+		BinID:        optID(f.BinID),
+		WorkOrderID:  optID(f.WorkOrderID),
+		PartsTableID: partsTableID,
+		LimitCount:   int32(limit),
+	}
+	if beforeID > 0 {
+		params.BeforeID = pgtype.Int8{Int64: beforeID, Valid: true}
+	}
+	rows, err := p.q.ListStockMovements(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "ListStockMovements failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.StockMovement, 0, len(rows))
+	for _, r := range rows {
+		m := models.StockMovement{
+			ID:          r.ID,
+			PartID:      toUUID(r.PartID),
+			Kind:        r.Kind,
+			Quantity:    r.Quantity,
+			FromBinID:   optUUID(r.FromBinID),
+			ToBinID:     optUUID(r.ToBinID),
+			Lot:         r.Lot,
+			Serial:      r.Serial,
+			ExpiresOn:   dateOn(r.ExpiresOn),
+			WorkOrderID: optUUID(r.WorkOrderID),
+			OrderID:     optUUID(r.OrderID),
+			Note:        r.Note.String,
+			CreatedBy:   optUUID(r.CreatedBy),
+			CreatedAt:   toTime(r.CreatedAt),
+			UnitCost:    optNumeric(r.UnitCost),
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// ListStockLevels returns the levels holding stock of parts of the parts
+// table the caller may see.
+func (p *pgRepo) ListStockLevels(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter) ([]models.StockLevel, error) {
+	rows, err := p.q.ListStockLevels(ctx, db.ListStockLevelsParams{
+		OrgID:        fromUUID(orgID),
+		PartID:       optID(f.PartID),
+		BinID:        optID(f.BinID),
+		PartsTableID: partsTableID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListStockLevels failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.StockLevel, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.StockLevel{
+			PartID:     toUUID(r.PartID),
+			BinID:      toUUID(r.BinID),
+			Lot:        r.Lot,
+			Serial:     r.Serial,
+			ExpiresOn:  dateOn(r.ExpiresOn),
+			Quantity:   r.Quantity,
+			ReceivedAt: toTime(r.ReceivedAt),
+		})
+	}
+	return out, nil
+}
+
+// AllocatableStock returns the levels of a part holding stock, optionally
+// of one bin, lot or serial number, in the order to take from them: the
+// earliest expiry first when fefo is set, then the oldest receipt. Levels
+// past their expiry are left out when skipExpired is set. The levels stay
+// locked until the transaction ends.
+func (p *pgRepo) AllocatableStock(ctx context.Context, orgID, partID uuid.UUID, binID *uuid.UUID, lot, serial *string, fefo, skipExpired bool) ([]models.StockLevel, error) {
+	rows, err := p.q.AllocatableStock(ctx, db.AllocatableStockParams{
+		OrgID:       fromUUID(orgID),
+		PartID:      fromUUID(partID),
+		BinID:       optID(binID),
+		Lot:         toNullText(lot),
+		Serial:      toNullText(serial),
+		SkipExpired: skipExpired,
+		Fefo:        fefo,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "AllocatableStock failed", "part_id", partID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.StockLevel, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.StockLevel{
+			PartID:    partID,
+			BinID:     toUUID(r.BinID),
+			Lot:       r.Lot,
+			Serial:    r.Serial,
+			ExpiresOn: dateOn(r.ExpiresOn),
+			Quantity:  r.Quantity,
+		})
+	}
+	return out, nil
+}
+
+// PartStock sums up the stock of parts, in the order given.
+func (p *pgRepo) PartStock(ctx context.Context, partIDs []uuid.UUID) ([]models.PartStock, error) {
+	ids := make([]pgtype.UUID, len(partIDs))
+	for i, id := range partIDs {
+		ids[i] = fromUUID(id)
+	}
+	rows, err := p.q.PartStock(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "PartStock failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.PartStock, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.PartStock{
+			PartID:    toUUID(r.PartID),
+			OnHand:    r.OnHand,
+			Reserved:  r.Reserved,
+			OnOrder:   r.OnOrder,
+			Available: r.OnHand - r.Reserved,
+		})
+	}
+	return out, nil
+}
+
+// LowStockParts returns the parts the caller may see whose projected stock
+// is at or below their reorder point, the furthest below first, with the
+// quantity to order to bring them up to their maximum (their reorder point
+// when they have none).
+func (p *pgRepo) LowStockParts(ctx context.Context, partsTableID int64) ([]models.LowStockPart, error) {
+	rows, err := p.q.LowStockParts(ctx, partsTableID)
+	if err != nil {
+		slog.ErrorContext(ctx, "LowStockParts failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.LowStockPart, 0, len(rows))
+	for _, r := range rows {
+		l := models.LowStockPart{
+			PartID:       toUUID(r.PartID),
+			Name:         r.Name.String,
+			PartNumber:   r.PartNumber.String,
+			Unit:         r.Unit.String,
+			ReorderPoint: r.ReorderPoint,
+			OnHand:       r.OnHand,
+			Reserved:     r.Reserved,
+			OnOrder:      r.OnOrder,
+			Projected:    r.OnHand + r.OnOrder - r.Reserved,
+		}
+		target := l.ReorderPoint
+		if r.SafetyStock.Valid {
+			v := r.SafetyStock.Float64
+			l.SafetyStock = &v
+			l.BelowSafety = l.OnHand < v
+		}
+		if r.MaxQuantity.Valid {
+			v := r.MaxQuantity.Float64
+			l.MaxQuantity = &v
+			target = max(target, v)
+		}
+		l.SuggestedQty = max(target-l.Projected, 0)
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// ---------------- Stock reservations ----------------
+
+// CreateStockReservation holds stock of a part for a work order.
+func (p *pgRepo) CreateStockReservation(ctx context.Context, orgID uuid.UUID, r models.StockReservation) (uuid.UUID, error) {
+	needed, err := pgDate(r.NeededOn)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := p.q.CreateStockReservation(ctx, db.CreateStockReservationParams{
+		OrgID:       fromUUID(orgID),
+		PartID:      fromUUID(r.PartID),
+		WorkOrderID: fromUUID(r.WorkOrderID),
+		BinID:       optID(r.BinID),
+		Quantity:    r.Quantity,
+		NeededOn:    needed,
+		Note:        toNullableText(r.Note),
+		CreatedBy:   optID(r.CreatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreateStockReservation failed", "part_id", r.PartID.String(), "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// GetStockReservation returns one reservation.
+func (p *pgRepo) GetStockReservation(ctx context.Context, orgID, id uuid.UUID) (models.StockReservation, bool, error) {
+	r, err := p.q.GetStockReservation(ctx, db.GetStockReservationParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.StockReservation{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetStockReservation failed", "id", id.String(), "err", err)
+		return models.StockReservation{}, false, err
+	}
+	return stockReservation(r), true, nil
+}
+
+// ListStockReservations returns reservations of parts of the parts table
+// the caller may see, of any status when status is empty, the soonest
+// needed first.
+func (p *pgRepo) ListStockReservations(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter, status string) ([]models.StockReservation, error) {
+	rows, err := p.q.ListStockReservations(ctx, db.ListStockReservationsParams{
+		OrgID:        fromUUID(orgID),
+		PartID:       optID(f.PartID),
+		WorkOrderID:  optID(f.WorkOrderID),
+		Status:       toNullableText(status),
+		PartsTableID: partsTableID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListStockReservations failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.StockReservation, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, stockReservation(db.GetStockReservationRow(r)))
+	}
+	return out, nil
+}
+
+// ReleaseStockReservation releases an active reservation; false when it is
+// not active.
+func (p *pgRepo) ReleaseStockReservation(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.ReleaseStockReservation(ctx, db.ReleaseStockReservationParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ReleaseStockReservation failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func stockReservation(r db.GetStockReservationRow) models.StockReservation {
+	return models.StockReservation{
+		ID:          toUUID(r.ID),
+		PartID:      toUUID(r.PartID),
+		WorkOrderID: toUUID(r.WorkOrderID),
+		BinID:       optUUID(r.BinID),
+		Quantity:    r.Quantity,
+		Issued:      r.Issued,
+		NeededOn:    dateOn(r.NeededOn),
+		Status:      r.Status,
+		Note:        r.Note.String,
+		CreatedBy:   optUUID(r.CreatedBy),
+		CreatedAt:   toTime(r.CreatedAt),
+		UpdatedAt:   toTime(r.UpdatedAt),
+	}
+}
+
+// ---------------- Part orders ----------------
+
+// CreatePartOrder records a quantity of a part on order.
+func (p *pgRepo) CreatePartOrder(ctx context.Context, orgID uuid.UUID, o models.PartOrder) (uuid.UUID, error) {
+	expected, err := pgDate(o.ExpectedOn)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := p.q.CreatePartOrder(ctx, db.CreatePartOrderParams{
+		OrgID:      fromUUID(orgID),
+		PartID:     fromUUID(o.PartID),
+		Quantity:   o.Quantity,
+		Supplier:   toNullableText(o.Supplier),
+		Reference:  toNullableText(o.Reference),
+		ExpectedOn: expected,
+		CreatedBy:  optID(o.CreatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreatePartOrder failed", "part_id", o.PartID.String(), "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// GetPartOrder returns one part order.
+func (p *pgRepo) GetPartOrder(ctx context.Context, orgID, id uuid.UUID) (models.PartOrder, bool, error) {
+	r, err := p.q.GetPartOrder(ctx, db.GetPartOrderParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PartOrder{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetPartOrder failed", "id", id.String(), "err", err)
+		return models.PartOrder{}, false, err
+	}
+	return partOrder(r), true, nil
+}
+
+// ListPartOrders returns orders of parts of the parts table the caller may
+// see, of any status when status is empty: open orders by expected date,
+// then the others latest first.
+func (p *pgRepo) ListPartOrders(ctx context.Context, orgID uuid.UUID, partsTableID int64, partID *uuid.UUID, status string) ([]models.PartOrder, error) {
+	rows, err := p.q.ListPartOrders(ctx, db.ListPartOrdersParams{
+		OrgID:        fromUUID(orgID),
+		PartID:       optID(partID),
+		Status:       toNullableText(status),
+		PartsTableID: partsTableID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListPartOrders failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.PartOrder, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, partOrder(db.GetPartOrderRow(r)))
+	}
+	return out, nil
+}
+
+// CancelPartOrder cancels an open order; what was received stays in stock.
+// False when the order is not open.
+func (p *pgRepo) CancelPartOrder(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.CancelPartOrder(ctx, db.CancelPartOrderParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "CancelPartOrder failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func partOrder(r db.GetPartOrderRow) models.PartOrder {
+	return models.PartOrder{
+		ID:         toUUID(r.ID),
+		PartID:     toUUID(r.PartID),
+		Quantity:   r.Quantity,
+		Received:   r.Received,
+		Supplier:   r.Supplier.String,
+		Reference:  r.Reference.String,
+		ExpectedOn: dateOn(r.ExpectedOn),
+		Status:     r.Status,
+		CreatedBy:  optUUID(r.CreatedBy),
+		CreatedAt:  toTime(r.CreatedAt),
+		UpdatedAt:  toTime(r.UpdatedAt),
+	}
+}
+
+// optID converts an optional id to a possibly NULL uuid.
+func optID(id *uuid.UUID) pgtype.UUID {
+	if id == nil {
+		return pgtype.UUID{}
+	}
+	return fromUUID(*id)
+}
+
+// optUUID converts a possibly NULL uuid to an optional id.
+func optUUID(u pgtype.UUID) *uuid.UUID {
+	if !u.Valid {
+		return nil
+	}
+	id := toUUID(u)
+	return &id
+}
+
+// pgDate parses an optional YYYY-MM-DD date.
+func pgDate(s string) (pgtype.Date, error) {
+	if s == "" {
+		return pgtype.Date{}, nil
+	}
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return pgtype.Date{}, err
+	}
+	return pgtype.Date{Time: d, Valid: true}, nil
+}
+
+// dateOn formats a possibly NULL date as YYYY-MM-DD, or "".
+func dateOn(d pgtype.Date) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Time.Format(time.DateOnly)
+}
+
+// optNumeric converts a possibly NULL numeric to an optional number.
+func optNumeric(n pgtype.Numeric) *float64 {
+	f, err := n.Float64Value()
+	if err != nil || !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
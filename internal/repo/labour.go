@@ -0,0 +1,259 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Labour time on work orders ----------------
+
+// StartTimer starts a timer for a user on a work order and returns the id
+// of its entry.
+func (p *pgRepo) StartTimer(ctx context.Context, orgID, workOrderID, userID uuid.UUID, note string, createdBy *uuid.UUID) (uuid.UUID, error) {
+	id, err := p.q.StartTimer(ctx, db.StartTimerParams{
+		OrgID:       fromUUID(orgID),
+		WorkOrderID: fromUUID(workOrderID),
+		UserID:      fromUUID(userID),
+		Note:        toNullableText(note),
+		CreatedBy:   optID(createdBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "StartTimer failed", "work_order_id", workOrderID.String(), "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// InsertTimeEntry records a finished entry entered by hand.
+func (p *pgRepo) InsertTimeEntry(ctx context.Context, orgID uuid.UUID, e models.TimeEntry) (uuid.UUID, error) {
+	id, err := p.q.InsertTimeEntry(ctx, db.InsertTimeEntryParams{
+		OrgID:       fromUUID(orgID),
+		WorkOrderID: fromUUID(e.WorkOrderID),
+		UserID:      fromUUID(e.UserID),
+		StartedAt:   pgtype.Timestamptz{Time: e.StartedAt, Valid: true},
+		EndedAt:     optTime(e.EndedAt),
+		Note:        toNullableText(e.Note),
+		CreatedBy:   optID(e.CreatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertTimeEntry failed", "work_order_id", e.WorkOrderID.String(), "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// RunningTimeEntry returns the entry of the timer running for a user, if any.
+func (p *pgRepo) RunningTimeEntry(ctx context.Context, orgID, userID uuid.UUID) (uuid.UUID, bool, error) {
+	id, err := p.q.RunningTimeEntry(ctx, db.RunningTimeEntryParams{OrgID: fromUUID(orgID), UserID: fromUUID(userID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "RunningTimeEntry failed", "user_id", userID.String(), "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(id), true, nil
+}
+
+// StopTimeEntry stops a running timer now; false when it is not running.
+func (p *pgRepo) StopTimeEntry(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.StopTimeEntry(ctx, db.StopTimeEntryParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "StopTimeEntry failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UpdateTimeEntry sets the period and note of an entry; a nil endedAt
+// leaves it running.
+func (p *pgRepo) UpdateTimeEntry(ctx context.Context, orgID, id uuid.UUID, startedAt time.Time, endedAt *time.Time, note string) (bool, error) {
+	n, err := p.q.UpdateTimeEntry(ctx, db.UpdateTimeEntryParams{
+		StartedAt: pgtype.Timestamptz{Time: startedAt, Valid: true},
+		EndedAt:   optTime(endedAt),
+		Note:      toNullableText(note),
+		OrgID:     fromUUID(orgID),
+		ID:        fromUUID(id),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateTimeEntry failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteTimeEntry deletes an entry.
+func (p *pgRepo) DeleteTimeEntry(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteTimeEntry(ctx, db.DeleteTimeEntryParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteTimeEntry failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetTimeEntry returns one entry.
+func (p *pgRepo) GetTimeEntry(ctx context.Context, orgID, id uuid.UUID) (models.TimeEntry, bool, error) {
+	r, err := p.q.GetTimeEntry(ctx, db.GetTimeEntryParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TimeEntry{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetTimeEntry failed", "id", id.String(), "err", err)
+		return models.TimeEntry{}, false, err
+	}
+	return timeEntry(r), true, nil
+}
+
+// ListTimeEntries returns up to limit entries on the work orders the caller
+// sees that match f, in the order they started.
+func (p *pgRepo) ListTimeEntries(ctx context.Context, orgID uuid.UUID, workOrdersTableID int64, f models.TimeEntryFilter, limit int) ([]models.TimeEntry, error) {
+	rows, err := p.q.ListTimeEntries(ctx, db.ListTimeEntriesParams{
+		WorkOrdersTableID: workOrdersTableID,
+		OrgID:             fromUUID(orgID),
+		WorkOrderID:       optID(f.WorkOrderID),
+		UserID:            optID(f.UserID),
+		FromTime:          optTime(f.From),
+		ToTime:            optTime(f.To),
+		LimitCount:        int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTimeEntries failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.TimeEntry, 0, len(rows))
+	for _, r := range rows {
+		e := timeEntry(db.GetTimeEntryRow{
+			ID:          r.ID,
+			WorkOrderID: r.WorkOrderID,
+			UserID:      r.UserID,
+			UserEmail:   r.UserEmail,
+			UserName:    r.UserName,
+			Source:      r.Source,
+			StartedAt:   r.StartedAt,
+			EndedAt:     r.EndedAt,
+			Hours:       r.Hours,
+			HourlyRate:  r.HourlyRate,
+			Note:        r.Note,
+			CreatedBy:   r.CreatedBy,
+			CreatedAt:   r.CreatedAt,
+			UpdatedAt:   r.UpdatedAt,
+		})
+		e.WorkOrderTitle = textOrEmpty(r.WorkOrderTitle)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func timeEntry(r db.GetTimeEntryRow) models.TimeEntry {
+	e := models.TimeEntry{
+		ID:          toUUID(r.ID),
+		WorkOrderID: toUUID(r.WorkOrderID),
+		UserID:      toUUID(r.UserID),
+		UserEmail:   r.UserEmail,
+		UserName:    textOrEmpty(r.UserName),
+		Source:      r.Source,
+		StartedAt:   toTime(r.StartedAt),
+		Hours:       r.Hours,
+		Note:        textOrEmpty(r.Note),
+		CreatedBy:   optUUID(r.CreatedBy),
+		CreatedAt:   toTime(r.CreatedAt),
+		UpdatedAt:   toTime(r.UpdatedAt),
+	}
+	if r.EndedAt.Valid {
+		t := r.EndedAt.Time
+		e.EndedAt = &t
+	}
+	if rate := optNumeric(r.HourlyRate); rate != nil {
+		cost := r.Hours * *rate
+		e.HourlyRate, e.Cost = rate, &cost
+	}
+	return e
+}
+
+// WorkOrderLabour returns the hours and cost of the finished entries of a
+// work order.
+func (p *pgRepo) WorkOrderLabour(ctx context.Context, workOrderID uuid.UUID) (float64, float64, error) {
+	r, err := p.q.WorkOrderLabour(ctx, fromUUID(workOrderID))
+	if err != nil {
+		slog.ErrorContext(ctx, "WorkOrderLabour failed", "work_order_id", workOrderID.String(), "err", err)
+		return 0, 0, err
+	}
+	return r.Hours, r.Cost, nil
+}
+
+// ListLabourRates returns the hourly rates of the org, users first.
+func (p *pgRepo) ListLabourRates(ctx context.Context, orgID uuid.UUID) ([]models.LabourRate, error) {
+	rows, err := p.q.ListLabourRates(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListLabourRates failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.LabourRate, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.LabourRate{
+			ID:         toUUID(r.ID),
+			UserID:     optUUID(r.UserID),
+			UserEmail:  textOrEmpty(r.UserEmail),
+			TeamID:     optUUID(r.TeamID),
+			TeamName:   textOrEmpty(r.TeamName),
+			HourlyRate: r.HourlyRate,
+			UpdatedAt:  toTime(r.UpdatedAt),
+		})
+	}
+	return out, nil
+}
+
+// SetLabourRate sets the hourly rate of the user or team of rate, replacing
+// the one it had.
+func (p *pgRepo) SetLabourRate(ctx context.Context, orgID uuid.UUID, rate models.LabourRate) (uuid.UUID, error) {
+	var (
+		id  pgtype.UUID
+		err error
+	)
+	if rate.UserID != nil {
+		id, err = p.q.SetUserLabourRate(ctx, db.SetUserLabourRateParams{
+			OrgID:      fromUUID(orgID),
+			UserID:     fromUUID(*rate.UserID),
+			HourlyRate: rate.HourlyRate,
+		})
+	} else {
+		id, err = p.q.SetTeamLabourRate(ctx, db.SetTeamLabourRateParams{
+			OrgID:      fromUUID(orgID),
+			TeamID:     optID(rate.TeamID),
+			HourlyRate: rate.HourlyRate,
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "SetLabourRate failed", "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// DeleteLabourRate deletes an hourly rate.
+func (p *pgRepo) DeleteLabourRate(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteLabourRate(ctx, db.DeleteLabourRateParams{OrgID: fromUUID(orgID), ID: fromUUID(id)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteLabourRate failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// optTime converts an optional time to a possibly NULL timestamptz.
+func optTime(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
@@ -0,0 +1,304 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Meter readings ----------------
+
+// InsertMeterReading stores a reading of a meter; inserted is false when the
+// meter already has a reading at that instant.
+func (p *pgRepo) InsertMeterReading(ctx context.Context, orgID uuid.UUID, m models.MeterReading) (models.MeterReading, bool, error) {
+	params := db.InsertMeterReadingParams{
+		OrgID:   fromUUID(orgID),
+		MeterID: fromUUID(m.MeterID),
+		Value:   m.Value,
+		ReadAt:  pgtype.Timestamptz{Time: m.ReadAt, Valid: true},
+	}
+	if m.CreatedBy != nil {
+		params.CreatedBy = fromUUID(*m.CreatedBy)
+	}
+	row, err := p.q.InsertMeterReading(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.MeterReading{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertMeterReading failed", "meter_id", m.MeterID.String(), "err", err)
+		return models.MeterReading{}, false, err
+	}
+	m.ID, m.CreatedAt = row.ID, toTime(row.CreatedAt)
+	return m, true, nil
+}
+
+// LatestMeterReading returns the reading of a meter taken last.
+func (p *pgRepo) LatestMeterReading(ctx context.Context, orgID, meterID uuid.UUID) (models.MeterReading, bool, error) {
+	r, err := p.q.LatestMeterReading(ctx, db.LatestMeterReadingParams{MeterID: fromUUID(meterID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.MeterReading{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "LatestMeterReading failed", "meter_id", meterID.String(), "err", err)
+		return models.MeterReading{}, false, err
+	}
+	return meterReading(db.ListMeterReadingsRow(r)), true, nil
+}
+
+// ListMeterReadings returns the readings of a meter taken in [from, to),
+// latest first.
+func (p *pgRepo) ListMeterReadings(ctx context.Context, orgID, meterID uuid.UUID, from, to time.Time, limit int) ([]models.MeterReading, error) {
+	rows, err := p.q.ListMeterReadings(ctx, db.ListMeterReadingsParams{
+		MeterID:    fromUUID(meterID),
+		OrgID:      fromUUID(orgID),
+		FromAt:     pgtype.Timestamptz{Time: from, Valid: true},
+		ToAt:       pgtype.Timestamptz{Time: to, Valid: true},
+		LimitCount: int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListMeterReadings failed", "meter_id", meterID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.MeterReading, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, meterReading(r))
+	}
+	return out, nil
+}
+
+// MeterReadingSeries aggregates the readings of a meter taken in [from, to)
+// per interval, or per calendar month (UTC) when months is set. Intervals
+// are aligned on Mondays 00:00 UTC; those without readings are left out.
+func (p *pgRepo) MeterReadingSeries(ctx context.Context, orgID, meterID uuid.UUID, from, to time.Time, interval time.Duration, months bool) ([]models.MeterBucket, error) {
+	rows, err := p.q.MeterReadingSeries(ctx, db.MeterReadingSeriesParams{
+		Months:     months,
+		BinSeconds: interval.Seconds(),
+		MeterID:    fromUUID(meterID),
+		OrgID:      fromUUID(orgID),
+		FromAt:     pgtype.Timestamptz{Time: from, Valid: true},
+		ToAt:       pgtype.Timestamptz{Time: to, Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "MeterReadingSeries failed", "meter_id", meterID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.MeterBucket, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.MeterBucket{
+			Start:    toTime(r.Bucket).UTC(),
+			Min:      r.MinValue,
+			Max:      r.MaxValue,
+			Avg:      r.AvgValue,
+			Readings: r.Readings,
+		})
+	}
+	return out, nil
+}
+
+func meterReading(r db.ListMeterReadingsRow) models.MeterReading {
+	m := models.MeterReading{
+		ID:        r.ID,
+		MeterID:   toUUID(r.MeterID),
+		Value:     r.Value,
+		ReadAt:    toTime(r.ReadAt),
+		CreatedAt: toTime(r.CreatedAt),
+	}
+	if r.CreatedBy.Valid {
+		id := toUUID(r.CreatedBy)
+		m.CreatedBy = &id
+	}
+	return m
+}
+
+// ---------------- Meter rules ----------------
+
+// ListMeterRules returns the rules of a meter, oldest first.
+func (p *pgRepo) ListMeterRules(ctx context.Context, orgID, meterID uuid.UUID) ([]models.MeterRule, error) {
+	rows, err := p.q.ListMeterRules(ctx, db.ListMeterRulesParams{MeterID: fromUUID(meterID), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListMeterRules failed", "meter_id", meterID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.MeterRule, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, meterRule(db.GetMeterRuleRow(r)))
+	}
+	return out, nil
+}
+
+// GetMeterRule returns one rule of a meter.
+func (p *pgRepo) GetMeterRule(ctx context.Context, orgID, meterID, id uuid.UUID) (models.MeterRule, bool, error) {
+	r, err := p.q.GetMeterRule(ctx, db.GetMeterRuleParams{ID: fromUUID(id), MeterID: fromUUID(meterID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.MeterRule{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetMeterRule failed", "id", id.String(), "err", err)
+		return models.MeterRule{}, false, err
+	}
+	return meterRule(r), true, nil
+}
+
+// CreateMeterRule stores a new rule of a meter and returns its id.
+func (p *pgRepo) CreateMeterRule(ctx context.Context, orgID uuid.UUID, m models.MeterRule) (uuid.UUID, error) {
+	id, err := p.q.InsertMeterRule(ctx, db.InsertMeterRuleParams{
+		OrgID:         fromUUID(orgID),
+		MeterID:       fromUUID(m.MeterID),
+		Name:          m.Name,
+		Kind:          m.Kind,
+		Value:         m.Value,
+		Action:        m.Action,
+		WoTitle:       toNullableText(m.WOTitle),
+		WoDescription: toNullableText(m.WODescription),
+		WoPriority:    toNullableText(m.WOPriority),
+		Active:        m.Active,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreateMeterRule failed", "meter_id", m.MeterID.String(), "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// UpdateMeterRule replaces a rule of a meter; false when it does not exist.
+func (p *pgRepo) UpdateMeterRule(ctx context.Context, orgID uuid.UUID, m models.MeterRule) (bool, error) {
+	n, err := p.q.UpdateMeterRule(ctx, db.UpdateMeterRuleParams{
+		Name:          m.Name,
+		Kind:          m.Kind,
+		Value:         m.Value,
+		Action:        m.Action,
+		WoTitle:       toNullableText(m.WOTitle),
+		WoDescription: toNullableText(m.WODescription),
+		WoPriority:    toNullableText(m.WOPriority),
+		Active:        m.Active,
+		ID:            fromUUID(m.ID),
+		MeterID:       fromUUID(m.MeterID),
+		OrgID:         fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateMeterRule failed", "id", m.ID.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteMeterRule deletes a rule of a meter with its alerts; false when it
+// does not exist.
+func (p *pgRepo) DeleteMeterRule(ctx context.Context, orgID, meterID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteMeterRule(ctx, db.DeleteMeterRuleParams{ID: fromUUID(id), MeterID: fromUUID(meterID), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteMeterRule failed", "id", id.String(), "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func meterRule(r db.GetMeterRuleRow) models.MeterRule {
+	m := models.MeterRule{
+		ID:            toUUID(r.ID),
+		MeterID:       toUUID(r.MeterID),
+		Name:          r.Name,
+		Kind:          r.Kind,
+		Value:         r.Value,
+		Action:        r.Action,
+		WOTitle:       textOrEmpty(r.WoTitle),
+		WODescription: textOrEmpty(r.WoDescription),
+		WOPriority:    textOrEmpty(r.WoPriority),
+		Active:        r.Active,
+		CreatedAt:     toTime(r.CreatedAt),
+		UpdatedAt:     toTime(r.UpdatedAt),
+	}
+	if r.LastTriggeredAt.Valid {
+		t := r.LastTriggeredAt.Time
+		m.LastTriggeredAt = &t
+	}
+	return m
+}
+
+// ---------------- Meter alerts ----------------
+
+// RecordMeterAlert records a rule firing on a reading and marks the rule
+// triggered.
+func (p *pgRepo) RecordMeterAlert(ctx context.Context, orgID uuid.UUID, a models.MeterAlert) (models.MeterAlert, error) {
+	params := db.InsertMeterAlertParams{
+		RuleID:       fromUUID(a.RuleID),
+		OrgID:        fromUUID(orgID),
+		MeterID:      fromUUID(a.MeterID),
+		ReadingID:    a.ReadingID,
+		Value:        a.Value,
+		Action:       a.Action,
+		WorkOrderIds: make([]pgtype.UUID, 0, len(a.WorkOrderIDs)),
+	}
+	if a.Previous != nil {
+		params.Previous = pgtype.Float8{Float64: *a.Previous, Valid: true}
+	}
+	for _, id := range a.WorkOrderIDs {
+		params.WorkOrderIds = append(params.WorkOrderIds, fromUUID(id))
+	}
+	row, err := p.q.InsertMeterAlert(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "RecordMeterAlert failed", "rule_id", a.RuleID.String(), "err", err)
+		return models.MeterAlert{}, err
+	}
+	a.ID, a.CreatedAt = row.ID, toTime(row.CreatedAt)
+	return a, nil
+}
+
+// ListMeterAlerts returns the latest alerts of a meter's rules, newest
+// first.
+func (p *pgRepo) ListMeterAlerts(ctx context.Context, orgID, meterID uuid.UUID, limit int) ([]models.MeterAlert, error) {
+	rows, err := p.q.ListMeterAlerts(ctx, db.ListMeterAlertsParams{
+		MeterID:    fromUUID(meterID),
+		OrgID:      fromUUID(orgID),
+		LimitCount: int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListMeterAlerts failed", "meter_id", meterID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.MeterAlert, 0, len(rows))
+	for _, r := range rows {
+		a := models.MeterAlert{
+			ID:           r.ID,
+			RuleID:       toUUID(r.RuleID),
+			RuleName:     r.RuleName,
+			MeterID:      toUUID(r.MeterID),
+			ReadingID:    r.ReadingID,
+			Value:        r.Value,
+			Action:       r.Action,
+			WorkOrderIDs: make([]uuid.UUID, 0, len(r.WorkOrderIds)),
+			CreatedAt:    toTime(r.CreatedAt),
+		}
+		if r.Previous.Valid {
+			v := r.Previous.Float64
+			a.Previous = &v
+		}
+		for _, id := range r.WorkOrderIds {
+			a.WorkOrderIDs = append(a.WorkOrderIDs, toUUID(id))
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// LastMeterRuleWorkOrder returns the work order a rule created last that
+// still exists.
+func (p *pgRepo) LastMeterRuleWorkOrder(ctx context.Context, orgID, ruleID uuid.UUID) (uuid.UUID, bool, error) {
+	id, err := p.q.LastMeterRuleWorkOrder(ctx, db.LastMeterRuleWorkOrderParams{RuleID: fromUUID(ruleID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "LastMeterRuleWorkOrder failed", "rule_id", ruleID.String(), "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(id), true, nil
+}
@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Row level security on the app.* tables only admits rows of the org named
+// by the app.org_id setting. The repo sets it for every statement from the
+// org carried in the context, so a query that forgets its org filter still
+// cannot see another org's data. app.user_id names the caller next to it,
+// for field-level access rules; it is empty for work done without a user.
+
+type orgCtxKey struct{}
+
+type userCtxKey struct{}
+
+// WithOrg scopes repo calls made with the returned context to orgID.
+func WithOrg(ctx context.Context, orgID uuid.UUID) context.Context {
+	return context.WithValue(ctx, orgCtxKey{}, orgID)
+}
+
+func orgFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(orgCtxKey{}).(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+// WithUser names the user on whose behalf repo calls made with the returned
+// context run.
+func WithUser(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userCtxKey{}, userID)
+}
+
+func userFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(userCtxKey{}).(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+// setOrg sets app.org_id, and app.user_id from ctx, for the rest of tx.
+func setOrg(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) error {
+	user := ""
+	if id, ok := userFromContext(ctx); ok {
+		user = id.String()
+	}
+	_, err := tx.Exec(ctx, "SELECT set_config('app.org_id', $1, true), set_config('app.user_id', $2, true)", orgID.String(), user)
+	return err
+}
+
+// orgDB implements db.DBTX on a pool. Statements whose context carries an org
+// run in a short transaction that sets app.org_id first; others run directly
+// and see no app.* rows at all.
+type orgDB struct{ pool *pgxpool.Pool }
+
+func (d orgDB) begin(ctx context.Context) (pgx.Tx, bool, error) {
+	orgID, ok := orgFromContext(ctx)
+	if !ok {
+		return nil, false, nil
+	}
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	if err := setOrg(ctx, tx, orgID); err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, true, err
+	}
+	return tx, true, nil
+}
+
+func (d orgDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	tx, scoped, err := d.begin(ctx)
+	if !scoped {
+		return d.pool.Exec(ctx, sql, args...)
+	}
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return tag, err
+	}
+	return tag, tx.Commit(ctx)
+}
+
+func (d orgDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	tx, scoped, err := d.begin(ctx)
+	if !scoped {
+		return d.pool.Query(ctx, sql, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	return &txRows{Rows: rows, ctx: ctx, tx: tx}, nil
+}
+
+func (d orgDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if _, ok := orgFromContext(ctx); !ok {
+		return d.pool.QueryRow(ctx, sql, args...)
+	}
+	return txRow{ctx: ctx, d: d, sql: sql, args: args}
+}
+
+// txRows finishes its transaction once the result set is exhausted (commit)
+// or closed early (rollback), reporting a failed commit through Err.
+type txRows struct {
+	pgx.Rows
+	ctx  context.Context
+	tx   pgx.Tx
+	done bool
+	err  error
+}
+
+func (r *txRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *txRows) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.Rows.Close()
+	if r.Rows.Err() != nil {
+		_ = r.tx.Rollback(r.ctx)
+		return
+	}
+	r.err = r.tx.Commit(r.ctx)
+}
+
+func (r *txRows) Close() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.Rows.Close()
+	_ = r.tx.Rollback(r.ctx)
+}
+
+func (r *txRows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// txRow runs the whole begin/query/commit cycle when scanned.
+type txRow struct {
+	ctx  context.Context
+	d    orgDB
+	sql  string
+	args []interface{}
+}
+
+func (r txRow) Scan(dest ...any) error {
+	tx, _, err := r.d.begin(r.ctx)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...); err != nil {
+		_ = tx.Rollback(r.ctx)
+		return err
+	}
+	return tx.Commit(r.ctx)
+}
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Table permissions ----------------
+
+// ListTablePermissions returns the user's rights on every table of the org,
+// keyed by table id.
+func (p *pgRepo) ListTablePermissions(ctx context.Context, orgID, userID uuid.UUID) (map[int64]models.TablePermissions, error) {
+	slog.DebugContext(ctx, "ListTablePermissions", "org_id", orgID.String(), "user_id", userID.String())
+	rows, err := p.q.ListTablePermissions(ctx, db.ListTablePermissionsParams{
+		UserID: fromUUID(userID),
+		OrgID:  fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTablePermissions failed", "err", err)
+		return nil, err
+	}
+	out := make(map[int64]models.TablePermissions, len(rows))
+	for _, r := range rows {
+		out[r.TableID] = tablePermissions(db.GetTablePermissionsRow(r))
+	}
+	return out, nil
+}
+
+func (p *pgRepo) GetTablePermissions(ctx context.Context, orgID, userID uuid.UUID, table string) (int64, models.TablePermissions, bool, error) {
+	row, err := p.q.GetTablePermissions(ctx, db.GetTablePermissionsParams{
+		UserID:    fromUUID(userID),
+		OrgID:     fromUUID(orgID),
+		TableName: table,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.TablePermissions{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetTablePermissions failed", "err", err)
+		return 0, models.TablePermissions{}, false, err
+	}
+	return row.TableID, tablePermissions(row), true, nil
+}
+
+// GetRowPermissions returns the user's rights on the table holding rowID.
+func (p *pgRepo) GetRowPermissions(ctx context.Context, orgID, userID, rowID uuid.UUID) (int64, models.TablePermissions, bool, error) {
+	row, err := p.q.GetRowPermissions(ctx, db.GetRowPermissionsParams{
+		UserID: fromUUID(userID),
+		RowID:  fromUUID(rowID),
+		OrgID:  fromUUID(orgID),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.TablePermissions{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetRowPermissions failed", "err", err)
+		return 0, models.TablePermissions{}, false, err
+	}
+	return row.TableID, tablePermissions(db.GetTablePermissionsRow(row)), true, nil
+}
+
+func (p *pgRepo) ListTableGrants(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.TableGrant, error) {
+	slog.DebugContext(ctx, "ListTableGrants", "org_id", orgID.String(), "table_id", tableID)
+	rows, err := p.q.ListTableGrants(ctx, db.ListTableGrantsParams{
+		TableID: tableID,
+		OrgID:   fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTableGrants failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.TableGrant, 0, len(rows))
+	for _, r := range rows {
+		g := models.TableGrant{
+			Role:      models.OrgRole(r.Role),
+			UserEmail: r.UserEmail.String,
+			TablePermissions: models.TablePermissions{
+				Read:         r.CanRead,
+				CreateRow:    r.CanCreate,
+				EditRow:      r.CanEdit,
+				DeleteRow:    r.CanDelete,
+				ManageSchema: r.CanManage,
+			},
+		}
+		if r.UserID.Valid {
+			id := toUUID(r.UserID)
+			g.UserID = &id
+		}
+		if r.TeamID.Valid {
+			id := toUUID(r.TeamID)
+			g.TeamID = &id
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+// ClearTableGrants removes every grant of a table, restoring the role
+// defaults.
+func (p *pgRepo) ClearTableGrants(ctx context.Context, orgID uuid.UUID, tableID int64) error {
+	err := p.q.DeleteTableGrants(ctx, db.DeleteTableGrantsParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClearTableGrants failed", "err", err)
+	}
+	return err
+}
+
+func (p *pgRepo) AddTableGrant(ctx context.Context, orgID uuid.UUID, tableID int64, g models.TableGrant) error {
+	arg := db.InsertTableGrantParams{
+		OrgID:     fromUUID(orgID),
+		TableID:   tableID,
+		Role:      toNullableText(string(g.Role)),
+		CanRead:   g.Read,
+		CanCreate: g.CreateRow,
+		CanEdit:   g.EditRow,
+		CanDelete: g.DeleteRow,
+		CanManage: g.ManageSchema,
+	}
+	if g.UserID != nil {
+		arg.UserID = fromUUID(*g.UserID)
+	}
+	if g.TeamID != nil {
+		arg.TeamID = fromUUID(*g.TeamID)
+	}
+	err := p.q.InsertTableGrant(ctx, arg)
+	if err != nil {
+		slog.ErrorContext(ctx, "AddTableGrant failed", "err", err)
+	}
+	return err
+}
+
+// ---------------- Team members ----------------
+
+// ListTeamMembers lists the members of a team row; found is false when the
+// row does not exist in the org.
+func (p *pgRepo) ListTeamMembers(ctx context.Context, orgID, teamID uuid.UUID) ([]models.TeamMember, bool, error) {
+	found, err := p.q.TeamRowExists(ctx, db.TeamRowExistsParams{TeamID: fromUUID(teamID), OrgID: fromUUID(orgID)})
+	if err != nil || !found {
+		return nil, false, err
+	}
+	rows, err := p.q.ListTeamMembers(ctx, db.ListTeamMembersParams{TeamID: fromUUID(teamID), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTeamMembers failed", "err", err)
+		return nil, true, err
+	}
+	out := make([]models.TeamMember, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.TeamMember{ID: toUUID(r.ID), Email: r.Email, Name: textOrEmpty(r.Name)})
+	}
+	return out, true, nil
+}
+
+func (p *pgRepo) ClearTeamMembers(ctx context.Context, orgID, teamID uuid.UUID) error {
+	err := p.q.DeleteTeamMembers(ctx, db.DeleteTeamMembersParams{TeamID: fromUUID(teamID), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClearTeamMembers failed", "err", err)
+	}
+	return err
+}
+
+// AddTeamMembers adds org members to a team and reports how many were
+// added; users outside the org are skipped.
+func (p *pgRepo) AddTeamMembers(ctx context.Context, orgID, teamID uuid.UUID, userIDs []uuid.UUID) (int, error) {
+	ids := make([]pgtype.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		ids = append(ids, fromUUID(id))
+	}
+	n, err := p.q.AddTeamMembers(ctx, db.AddTeamMembersParams{
+		TeamID:  fromUUID(teamID),
+		OrgID:   fromUUID(orgID),
+		UserIds: ids,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "AddTeamMembers failed", "err", err)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func tablePermissions(r db.GetTablePermissionsRow) models.TablePermissions {
+	return models.TablePermissions{
+		Read:         r.CanRead,
+		CreateRow:    r.CanCreate,
+		EditRow:      r.CanEdit,
+		DeleteRow:    r.CanDelete,
+		ManageSchema: r.CanManage,
+	}
+}
@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- PM scheduling ----------------
+
+// ClaimPMScans claims up to limit orgs whose PM scan is due,
+// hiding them from other schedulers for lease.
+func (p *pgRepo) ClaimPMScans(ctx context.Context, limit int, lease time.Duration) ([]uuid.UUID, error) {
+	rows, err := p.q.ClaimPMScans(ctx, db.ClaimPMScansParams{
+		LimitCount:   int32(limit),
+		LeaseSeconds: int32(lease / time.Second),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClaimPMScans failed", "err", err)
+		return nil, err
+	}
+	out := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, toUUID(r))
+	}
+	return out, nil
+}
+
+// FinishPMScan records the end of an org's scan, with the error that cut it
+// short if any, and when to scan the org next.
+func (p *pgRepo) FinishPMScan(ctx context.Context, orgID uuid.UUID, next time.Time, errMsg string) error {
+	err := p.q.FinishPMScan(ctx, db.FinishPMScanParams{
+		NextScanAt: pgtype.Timestamptz{Time: next, Valid: true},
+		LastError:  toNullableText(errMsg),
+		OrgID:      fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "FinishPMScan failed", "err", err)
+	}
+	return err
+}
+
+// RecordPMOccurrence records an occurrence of a PM schedule; recorded is
+// false when the occurrence already was, by this or another scheduler.
+func (p *pgRepo) RecordPMOccurrence(ctx context.Context, orgID uuid.UUID, o models.PMOccurrence) (models.PMOccurrence, bool, error) {
+	params := db.InsertPMOccurrenceParams{
+		OrgID:   fromUUID(orgID),
+		PmID:    fromUUID(o.PMID),
+		Trigger: o.Trigger,
+		Status:  o.Status,
+		Note:    toNullableText(o.Note),
+	}
+	if o.DueOn != "" {
+		d, err := time.Parse(time.DateOnly, o.DueOn)
+		if err != nil {
+			return models.PMOccurrence{}, false, err
+		}
+		params.DueOn = pgtype.Date{Time: d, Valid: true}
+	}
+	if o.DueReading != nil {
+		params.DueReading = pgtype.Float8{Float64: *o.DueReading, Valid: true}
+	}
+	if o.WorkOrderID != nil {
+		params.WorkOrderID = fromUUID(*o.WorkOrderID)
+	}
+	row, err := p.q.InsertPMOccurrence(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PMOccurrence{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "RecordPMOccurrence failed", "pm_id", o.PMID.String(), "err", err)
+		return models.PMOccurrence{}, false, err
+	}
+	o.ID, o.CreatedAt = row.ID, toTime(row.CreatedAt)
+	return o, true, nil
+}
+
+// LastPMOccurrence returns the latest occurrence of a PM schedule handled
+// for a trigger: the one of the latest date, or of the highest reading.
+func (p *pgRepo) LastPMOccurrence(ctx context.Context, orgID, pmID uuid.UUID, trigger string) (models.PMOccurrence, bool, error) {
+	r, err := p.q.LastPMOccurrence(ctx, db.LastPMOccurrenceParams{
+		PmID:    fromUUID(pmID),
+		OrgID:   fromUUID(orgID),
+		Trigger: trigger,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PMOccurrence{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "LastPMOccurrence failed", "pm_id", pmID.String(), "err", err)
+		return models.PMOccurrence{}, false, err
+	}
+	return pmOccurrence(db.ListPMOccurrencesRow(r)), true, nil
+}
+
+// LastPMWorkOrder returns the work order last generated for a PM schedule
+// that still exists.
+func (p *pgRepo) LastPMWorkOrder(ctx context.Context, orgID, pmID uuid.UUID) (uuid.UUID, bool, error) {
+	id, err := p.q.LastPMWorkOrder(ctx, db.LastPMWorkOrderParams{PmID: fromUUID(pmID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "LastPMWorkOrder failed", "pm_id", pmID.String(), "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(id), true, nil
+}
+
+// ListPMOccurrences returns the latest occurrences of a PM schedule, newest
+// first.
+func (p *pgRepo) ListPMOccurrences(ctx context.Context, orgID, pmID uuid.UUID, limit int) ([]models.PMOccurrence, error) {
+	rows, err := p.q.ListPMOccurrences(ctx, db.ListPMOccurrencesParams{
+		PmID:       fromUUID(pmID),
+		OrgID:      fromUUID(orgID),
+		LimitCount: int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListPMOccurrences failed", "pm_id", pmID.String(), "err", err)
+		return nil, err
+	}
+	out := make([]models.PMOccurrence, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, pmOccurrence(r))
+	}
+	return out, nil
+}
+
+func pmOccurrence(r db.ListPMOccurrencesRow) models.PMOccurrence {
+	o := models.PMOccurrence{
+		ID:        r.ID,
+		PMID:      toUUID(r.PmID),
+		Trigger:   r.Trigger,
+		DueOn:     dateOn(r.DueOn),
+		Status:    r.Status,
+		Note:      r.Note.String,
+		CreatedAt: toTime(r.CreatedAt),
+	}
+	if r.DueReading.Valid {
+		v := r.DueReading.Float64
+		o.DueReading = &v
+	}
+	if r.WorkOrderID.Valid {
+		id := toUUID(r.WorkOrderID)
+		o.WorkOrderID = &id
+	}
+	return o
+}
+
+// RequestPMScan brings the next PM scan of an org forward to now, so
+// meter schedules follow a new reading without waiting for the interval.
+func (p *pgRepo) RequestPMScan(ctx context.Context, orgID uuid.UUID) error {
+	err := p.q.RequestPMScan(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "RequestPMScan failed", "err", err)
+	}
+	return err
+}
@@ -3,10 +3,12 @@ package repo
 
 import (
 	"context"
+	"log/slog"
 	"net/netip"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	db "yourapp/internal/db/gen" // <-- change if your sqlc package path differs
 	"yourapp/internal/models"
@@ -65,15 +67,203 @@ type Repo interface {
     GetRowLabelAuto(ctx context.Context, orgID uuid.UUID, rowID uuid.UUID) (string, error)
     // Batch resolve labels for known reference table
     BatchGetRowLabels(ctx context.Context, orgID uuid.UUID, tableID int64, rowIDs []uuid.UUID) (map[uuid.UUID]string, error)
-    // Batch resolve labels for mixed tables
-    BatchGetRowLabelsAuto(ctx context.Context, orgID uuid.UUID, rowIDs []uuid.UUID) (map[uuid.UUID]string, error)
+    // Batch resolve labels for mixed tables; rows outside tableIDs get none
+    BatchGetRowLabelsAuto(ctx context.Context, orgID uuid.UUID, rowIDs []uuid.UUID, tableIDs []int64) (map[uuid.UUID]string, error)
+
+    // Full-text search across every table in the org, grouped by table
+    SearchOrg(ctx context.Context, orgID uuid.UUID, q string, perTable int) ([]models.SearchGroup, error)
+
+	// Table templates provisioned into the org
+	ListTemplateInstalls(ctx context.Context, orgID uuid.UUID) ([]models.TemplateInstall, error)
+	RecordTemplateInstall(ctx context.Context, orgID uuid.UUID, template string, version int) (models.TemplateInstall, error)
+
+	// Storage engine of user tables and the EAV -> relational migration steps
+	ListTableStorage(ctx context.Context, orgID uuid.UUID) ([]models.TableStorage, error)
+	GetTableStorage(ctx context.Context, orgID uuid.UUID, table string) (models.TableStorage, error)
+	EnsurePhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64) (string, error)
+	BackfillPhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64, batchSize int) (int, error)
+	PhysicalTableDrift(ctx context.Context, orgID uuid.UUID, tableID int64, limit int) ([]uuid.UUID, error)
+	SyncPhysicalRow(ctx context.Context, orgID uuid.UUID, rowID uuid.UUID) error
+	CutOverRelational(ctx context.Context, orgID uuid.UUID, tableID int64) error
+	RevertRelational(ctx context.Context, orgID uuid.UUID, tableID int64) error
+	DropPhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64) error
+
+	// Per-table permissions and the team memberships they can refer to
+	ListTablePermissions(ctx context.Context, orgID, userID uuid.UUID) (map[int64]models.TablePermissions, error)
+	GetTablePermissions(ctx context.Context, orgID, userID uuid.UUID, table string) (int64, models.TablePermissions, bool, error)
+	GetRowPermissions(ctx context.Context, orgID, userID, rowID uuid.UUID) (int64, models.TablePermissions, bool, error)
+	ListTableGrants(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.TableGrant, error)
+	ClearTableGrants(ctx context.Context, orgID uuid.UUID, tableID int64) error
+	AddTableGrant(ctx context.Context, orgID uuid.UUID, tableID int64, g models.TableGrant) error
+	ListTeamMembers(ctx context.Context, orgID, teamID uuid.UUID) ([]models.TeamMember, bool, error)
+	ClearTeamMembers(ctx context.Context, orgID, teamID uuid.UUID) error
+	AddTeamMembers(ctx context.Context, orgID, teamID uuid.UUID, userIDs []uuid.UUID) (int, error)
+
+	// Row-level sharing policies
+	ListRowPolicies(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.RowPolicy, error)
+	ClearRowPolicies(ctx context.Context, orgID uuid.UUID, tableID int64) error
+	AddRowPolicy(ctx context.Context, orgID uuid.UUID, tableID int64, p models.RowPolicy) error
+	RowPoliciesUsingColumn(ctx context.Context, orgID uuid.UUID, table, column string) ([]string, error)
+
+	// Webhooks, the events they subscribe to and their delivery outbox
+	ListWebhooks(ctx context.Context, orgID uuid.UUID) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, orgID, id uuid.UUID) (models.Webhook, bool, error)
+	CreateWebhook(ctx context.Context, orgID uuid.UUID, w models.Webhook) (uuid.UUID, error)
+	UpdateWebhook(ctx context.Context, orgID uuid.UUID, w models.Webhook) (bool, error)
+	DeleteWebhook(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	SetWebhookSecret(ctx context.Context, orgID, id uuid.UUID, secret string) (bool, error)
+	WebhooksUsingColumn(ctx context.Context, orgID uuid.UUID, table, column string) ([]string, error)
+	ListWebhookDeliveries(ctx context.Context, orgID, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, orgID, webhookID uuid.UUID, deliveryID int64) (bool, error)
+	PingWebhook(ctx context.Context, orgID, webhookID uuid.UUID) (int64, bool, error)
+	RowSnapshot(ctx context.Context, orgID, rowID uuid.UUID) ([]byte, bool, error)
+	EmitRowEvent(ctx context.Context, orgID uuid.UUID, event string, tableID int64, rowID uuid.UUID, previous []byte) (int64, error)
+	StreamRowEvents(ctx context.Context, orgID uuid.UUID, tableID, afterTxid, afterID int64, limit int) ([]models.RowEvent, error)
+	RowEventHorizon(ctx context.Context, orgID uuid.UUID, tableID int64) (horizon int64, held bool, err error)
+	EmitSchemaEvent(ctx context.Context, orgID uuid.UUID, event string, tableID int64, data []byte) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error)
+	GetWebhookAttempt(ctx context.Context, orgID uuid.UUID, deliveryID int64) (models.WebhookAttempt, bool, error)
+	RecordWebhookAttempt(ctx context.Context, orgID uuid.UUID, deliveryID int64, status string, httpStatus int, errMsg string, next time.Time) error
+
+	// Automations, their run log and the mail outbox
+	ListAutomations(ctx context.Context, orgID uuid.UUID) ([]models.Automation, error)
+	GetAutomation(ctx context.Context, orgID, id uuid.UUID) (models.Automation, bool, error)
+	CreateAutomation(ctx context.Context, orgID uuid.UUID, a models.Automation) (uuid.UUID, error)
+	UpdateAutomation(ctx context.Context, orgID uuid.UUID, a models.Automation) (bool, error)
+	DeleteAutomation(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	AutomationsUsingColumn(ctx context.Context, orgID uuid.UUID, tableID int64, column string) ([]string, error)
+	AutomationsUsingTable(ctx context.Context, orgID uuid.UUID, tableID int64) ([]string, error)
+	MatchAutomations(ctx context.Context, orgID uuid.UUID, eventID int64) ([]models.Automation, error)
+	EvalAutomationValues(ctx context.Context, eventID int64, exprs map[string]string) (map[string]any, error)
+	SetActingUser(ctx context.Context, userID uuid.UUID) error
+	InsertAutomationRun(ctx context.Context, orgID uuid.UUID, run models.AutomationRun) (int64, error)
+	FinishAutomationRun(ctx context.Context, orgID uuid.UUID, runID int64, status, errMsg string, result []byte, next time.Time) error
+	ListAutomationRuns(ctx context.Context, orgID, automationID uuid.UUID, status string, limit int) ([]models.AutomationRun, error)
+	RetryAutomationRun(ctx context.Context, orgID, automationID uuid.UUID, runID int64) (bool, error)
+	ClaimAutomationRuns(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error)
+	GetAutomationJob(ctx context.Context, orgID uuid.UUID, runID int64) (models.AutomationJob, bool, error)
+	QueueWebhookDelivery(ctx context.Context, orgID, webhookID uuid.UUID, eventID int64) (bool, error)
+	QueueEmail(ctx context.Context, orgID uuid.UUID, runID int64, to []string, subject, body string) error
+	ClaimOutboundEmails(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error)
+	GetOutboundEmail(ctx context.Context, orgID uuid.UUID, id int64) (models.OutboundEmail, bool, error)
+	RecordEmailAttempt(ctx context.Context, orgID uuid.UUID, id int64, status, errMsg string, next time.Time) error
+
+	// State machines of enum columns
+	ListStateMachines(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.StateMachine, error)
+	PutStateMachine(ctx context.Context, orgID uuid.UUID, m models.StateMachine) error
+	DeleteStateMachine(ctx context.Context, orgID uuid.UUID, tableID int64, column string) (bool, error)
+	StateMachinesUsingColumn(ctx context.Context, orgID uuid.UUID, tableID int64, column string) ([]string, error)
+	EvalRowExprs(ctx context.Context, data, previous []byte, exprs map[string]string) (map[string]any, error)
+
+	// Row hierarchies: parent columns and the trees they form
+	GetHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64) (models.Hierarchy, bool, error)
+	PutHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64, column string) (valid bool, cycle uuid.UUID, err error)
+	DeleteHierarchy(ctx context.Context, orgID uuid.UUID, tableID int64) (bool, error)
+	RowSubtree(ctx context.Context, h models.Hierarchy, root uuid.UUID, maxDepth, maxNodes int) (models.Subtree, bool, error)
+	RowAncestors(ctx context.Context, h models.Hierarchy, rowID uuid.UUID) ([]models.TreeNode, bool, error)
+
+	// PM scheduling
+	ClaimPMScans(ctx context.Context, limit int, lease time.Duration) ([]uuid.UUID, error)
+	FinishPMScan(ctx context.Context, orgID uuid.UUID, next time.Time, errMsg string) error
+	RecordPMOccurrence(ctx context.Context, orgID uuid.UUID, o models.PMOccurrence) (models.PMOccurrence, bool, error)
+	LastPMOccurrence(ctx context.Context, orgID, pmID uuid.UUID, trigger string) (models.PMOccurrence, bool, error)
+	LastPMWorkOrder(ctx context.Context, orgID, pmID uuid.UUID) (uuid.UUID, bool, error)
+	ListPMOccurrences(ctx context.Context, orgID, pmID uuid.UUID, limit int) ([]models.PMOccurrence, error)
+	RequestPMScan(ctx context.Context, orgID uuid.UUID) error
+
+	// Meter readings, and the rules and alerts acting on them
+	InsertMeterReading(ctx context.Context, orgID uuid.UUID, m models.MeterReading) (models.MeterReading, bool, error)
+	LatestMeterReading(ctx context.Context, orgID, meterID uuid.UUID) (models.MeterReading, bool, error)
+	ListMeterReadings(ctx context.Context, orgID, meterID uuid.UUID, from, to time.Time, limit int) ([]models.MeterReading, error)
+	MeterReadingSeries(ctx context.Context, orgID, meterID uuid.UUID, from, to time.Time, interval time.Duration, months bool) ([]models.MeterBucket, error)
+	ListMeterRules(ctx context.Context, orgID, meterID uuid.UUID) ([]models.MeterRule, error)
+	GetMeterRule(ctx context.Context, orgID, meterID, id uuid.UUID) (models.MeterRule, bool, error)
+	CreateMeterRule(ctx context.Context, orgID uuid.UUID, m models.MeterRule) (uuid.UUID, error)
+	UpdateMeterRule(ctx context.Context, orgID uuid.UUID, m models.MeterRule) (bool, error)
+	DeleteMeterRule(ctx context.Context, orgID, meterID, id uuid.UUID) (bool, error)
+	RecordMeterAlert(ctx context.Context, orgID uuid.UUID, a models.MeterAlert) (models.MeterAlert, error)
+	ListMeterAlerts(ctx context.Context, orgID, meterID uuid.UUID, limit int) ([]models.MeterAlert, error)
+	LastMeterRuleWorkOrder(ctx context.Context, orgID, ruleID uuid.UUID) (uuid.UUID, bool, error)
+	ReferencingRows(ctx context.Context, columnID int64, target uuid.UUID) ([]uuid.UUID, error)
+
+	// Spare parts inventory: the stock ledger, stock levels, reservations
+	// and part orders
+	InsertStockMovement(ctx context.Context, orgID uuid.UUID, m models.StockMovement) (models.StockMovement, error)
+	ListStockMovements(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter, beforeID int64, limit int) ([]models.StockMovement, error)
+	ListStockLevels(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter) ([]models.StockLevel, error)
+	AllocatableStock(ctx context.Context, orgID, partID uuid.UUID, binID *uuid.UUID, lot, serial *string, fefo, skipExpired bool) ([]models.StockLevel, error)
+	PartStock(ctx context.Context, partIDs []uuid.UUID) ([]models.PartStock, error)
+	LowStockParts(ctx context.Context, partsTableID int64) ([]models.LowStockPart, error)
+	CreateStockReservation(ctx context.Context, orgID uuid.UUID, r models.StockReservation) (uuid.UUID, error)
+	GetStockReservation(ctx context.Context, orgID, id uuid.UUID) (models.StockReservation, bool, error)
+	ListStockReservations(ctx context.Context, orgID uuid.UUID, partsTableID int64, f models.StockFilter, status string) ([]models.StockReservation, error)
+	ReleaseStockReservation(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	CreatePartOrder(ctx context.Context, orgID uuid.UUID, o models.PartOrder) (uuid.UUID, error)
+	GetPartOrder(ctx context.Context, orgID, id uuid.UUID) (models.PartOrder, bool, error)
+	ListPartOrders(ctx context.Context, orgID uuid.UUID, partsTableID int64, partID *uuid.UUID, status string) ([]models.PartOrder, error)
+	CancelPartOrder(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+
+	// Parts used on work orders and their cost
+	WorkOrderPartLines(ctx context.Context, orgID, workOrderID uuid.UUID) ([]models.WorkOrderPartLine, error)
+	WorkOrderPartsCost(ctx context.Context, workOrderID uuid.UUID) (float64, error)
+	PartsCostTotals(ctx context.Context, orgID uuid.UUID, workOrdersTableID int64, groupBy, from, to string) ([]models.PartsCostTotal, error)
+
+	// Labour time on work orders and hourly rates
+	StartTimer(ctx context.Context, orgID, workOrderID, userID uuid.UUID, note string, createdBy *uuid.UUID) (uuid.UUID, error)
+	InsertTimeEntry(ctx context.Context, orgID uuid.UUID, e models.TimeEntry) (uuid.UUID, error)
+	RunningTimeEntry(ctx context.Context, orgID, userID uuid.UUID) (uuid.UUID, bool, error)
+	StopTimeEntry(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	UpdateTimeEntry(ctx context.Context, orgID, id uuid.UUID, startedAt time.Time, endedAt *time.Time, note string) (bool, error)
+	DeleteTimeEntry(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	GetTimeEntry(ctx context.Context, orgID, id uuid.UUID) (models.TimeEntry, bool, error)
+	ListTimeEntries(ctx context.Context, orgID uuid.UUID, workOrdersTableID int64, f models.TimeEntryFilter, limit int) ([]models.TimeEntry, error)
+	WorkOrderLabour(ctx context.Context, workOrderID uuid.UUID) (float64, float64, error)
+	ListLabourRates(ctx context.Context, orgID uuid.UUID) ([]models.LabourRate, error)
+	SetLabourRate(ctx context.Context, orgID uuid.UUID, rate models.LabourRate) (uuid.UUID, error)
+	DeleteLabourRate(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+
+	// Checklist templates and the checklists copied onto work orders
+	ListChecklistTemplates(ctx context.Context, orgID uuid.UUID) ([]models.ChecklistTemplate, error)
+	GetChecklistTemplate(ctx context.Context, orgID, id uuid.UUID) (models.ChecklistTemplate, bool, error)
+	CreateChecklistTemplate(ctx context.Context, orgID uuid.UUID, t models.ChecklistTemplate) (uuid.UUID, error)
+	UpdateChecklistTemplate(ctx context.Context, orgID uuid.UUID, t models.ChecklistTemplate) (bool, error)
+	SetChecklistTemplateItems(ctx context.Context, orgID, templateID uuid.UUID, items []models.ChecklistTemplateItem) error
+	DeleteChecklistTemplate(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	CopyChecklist(ctx context.Context, workOrderID, templateID uuid.UUID, createdBy *uuid.UUID) (uuid.UUID, bool, error)
+	ListWorkOrderChecklists(ctx context.Context, orgID, workOrderID uuid.UUID) ([]models.Checklist, error)
+	DeleteChecklist(ctx context.Context, orgID, workOrderID, id uuid.UUID) (bool, error)
+	AnswerChecklistItem(ctx context.Context, orgID uuid.UUID, item models.ChecklistItem) (bool, error)
+	ClearChecklistItem(ctx context.Context, orgID, checklistID, id uuid.UUID) (bool, error)
+	SetChecklistItemFollowUp(ctx context.Context, orgID, id, workOrderID uuid.UUID) error
+	WorkOrderChecklistOpen(ctx context.Context, workOrderID uuid.UUID) (int, error)
+
+	// Uploaded files and the rows they are linked to
+	GetFile(ctx context.Context, orgID, id uuid.UUID) (models.File, bool, error)
+	GetFileBySHA256(ctx context.Context, orgID uuid.UUID, sha256 string) (models.File, bool, error)
+	InsertFile(ctx context.Context, orgID uuid.UUID, f models.File) (uuid.UUID, bool, error)
+	ListFiles(ctx context.Context, orgID uuid.UUID, rowID *uuid.UUID, limit int) ([]models.File, error)
+	DeleteFile(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	LinkFile(ctx context.Context, orgID, fileID, rowID uuid.UUID, createdBy *uuid.UUID) error
+	UnlinkFile(ctx context.Context, orgID, fileID, rowID uuid.UUID) (bool, error)
+	ListFileLinks(ctx context.Context, orgID, fileID uuid.UUID) ([]models.FileLink, error)
+
+	// Public request portals and the tokens requesters follow requests with
+	GetRequestPortal(ctx context.Context, orgID uuid.UUID) (models.RequestPortal, bool, error)
+	SaveRequestPortal(ctx context.Context, orgID uuid.UUID, p models.RequestPortal) (models.RequestPortal, error)
+	SetRequestPortalKey(ctx context.Context, orgID uuid.UUID, key string, updatedBy *uuid.UUID) (bool, error)
+	RequestPortalOrg(ctx context.Context, key string) (uuid.UUID, bool, error)
+	InsertRequestToken(ctx context.Context, orgID, rowID uuid.UUID, tokenHash string) error
+	RequestTokenRow(ctx context.Context, tokenHash string) (models.RequestToken, bool, error)
 
 	// Columns management
 	AddUserTableColumn(ctx context.Context, orgID uuid.UUID, table string, input models.TableColumnInput) (models.TableColumn, bool, error)
+	UpdateUserTableColumn(ctx context.Context, orgID uuid.UUID, table string, input models.TableColumnInput) (models.TableColumn, bool, error)
 	RemoveUserTableColumn(ctx context.Context, orgID uuid.UUID, table string, columnName string) (models.TableColumn, bool, error)
+	SetColumnAccess(ctx context.Context, orgID uuid.UUID, table, column string, access *models.ColumnAccess) (bool, error)
 
 	// Rows management
 	InsertUserTableRow(ctx context.Context, orgID uuid.UUID, table string, values []byte) (models.TableRow, error)
+	UpdateUserTableRow(ctx context.Context, orgID uuid.UUID, table string, rowID uuid.UUID, values []byte) (models.TableRow, bool, error)
 
 	UserHasTOTP(ctx context.Context, uid uuid.UUID) bool
 	SetTOTPSecret(ctx context.Context, uid uuid.UUID, secret, issuer, label string) error
@@ -93,9 +283,40 @@ type Repo interface {
 
 	// Local credential management
 	UpdateLocalPasswordHash(ctx context.Context, userID uuid.UUID, phc string) error
+
+	// InTx runs fn against a Repo bound to a single transaction, committing
+	// when fn returns nil and rolling back otherwise. Nested calls reuse the
+	// outer transaction.
+	InTx(ctx context.Context, fn func(Repo) error) error
 }
 
-// pgRepo wraps the sqlc Queries.
-type pgRepo struct{ q *db.Queries }
+// pgRepo wraps the sqlc Queries. pool is nil when the repo is bound to a
+// transaction.
+type pgRepo struct {
+	q    *db.Queries
+	pool *pgxpool.Pool
+}
 
-func New(q *db.Queries) Repo { return &pgRepo{q: q} }
+func New(pool *pgxpool.Pool) Repo { return &pgRepo{q: db.New(orgDB{pool: pool}), pool: pool} }
+
+func (p *pgRepo) InTx(ctx context.Context, fn func(Repo) error) error {
+	if p.pool == nil {
+		return fn(p)
+	}
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "InTx begin failed", "err", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if orgID, ok := orgFromContext(ctx); ok {
+		if err := setOrg(ctx, tx, orgID); err != nil {
+			slog.ErrorContext(ctx, "InTx set org failed", "err", err)
+			return err
+		}
+	}
+	if err := fn(&pgRepo{q: p.q.WithTx(tx)}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
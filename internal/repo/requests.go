@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Request portals ----------------
+
+// GetRequestPortal returns the org's request portal; false when it has
+// none yet.
+func (p *pgRepo) GetRequestPortal(ctx context.Context, orgID uuid.UUID) (models.RequestPortal, bool, error) {
+	r, err := p.q.GetRequestPortal(ctx, fromUUID(orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.RequestPortal{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetRequestPortal failed", "err", err)
+		return models.RequestPortal{}, false, err
+	}
+	return requestPortalRow(r), true, nil
+}
+
+// SaveRequestPortal creates or updates the org's request portal. p.Key only
+// applies to a new portal; an existing one keeps its key.
+func (p *pgRepo) SaveRequestPortal(ctx context.Context, orgID uuid.UUID, in models.RequestPortal) (models.RequestPortal, error) {
+	r, err := p.q.SaveRequestPortal(ctx, db.SaveRequestPortalParams{
+		OrgID:           fromUUID(orgID),
+		Key:             in.Key,
+		Enabled:         in.Enabled,
+		Title:           in.Title,
+		Intro:           toNullableText(in.Intro),
+		Captcha:         in.Captcha,
+		Photos:          in.Photos,
+		DefaultPriority: toNullableText(in.DefaultPriority),
+		UpdatedBy:       optID(in.UpdatedBy),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "SaveRequestPortal failed", "err", err)
+		return models.RequestPortal{}, err
+	}
+	return requestPortalRow(db.GetRequestPortalRow(r)), nil
+}
+
+// SetRequestPortalKey gives the org's portal a new key; false when the org
+// has no portal.
+func (p *pgRepo) SetRequestPortalKey(ctx context.Context, orgID uuid.UUID, key string, updatedBy *uuid.UUID) (bool, error) {
+	n, err := p.q.SetRequestPortalKey(ctx, db.SetRequestPortalKeyParams{OrgID: fromUUID(orgID), Key: key, UpdatedBy: optID(updatedBy)})
+	if err != nil {
+		slog.ErrorContext(ctx, "SetRequestPortalKey failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RequestPortalOrg returns the org of the enabled portal with a key; false
+// when there is none. It needs no org scope.
+func (p *pgRepo) RequestPortalOrg(ctx context.Context, key string) (uuid.UUID, bool, error) {
+	id, err := p.q.RequestPortalOrg(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "RequestPortalOrg failed", "err", err)
+		return uuid.Nil, false, err
+	}
+	return toUUID(id), id.Valid, nil
+}
+
+// InsertRequestToken stores the SHA-256 of the token of a request.
+func (p *pgRepo) InsertRequestToken(ctx context.Context, orgID, rowID uuid.UUID, tokenHash string) error {
+	err := p.q.InsertRequestToken(ctx, db.InsertRequestTokenParams{TokenHash: tokenHash, OrgID: fromUUID(orgID), RowID: fromUUID(rowID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "InsertRequestToken failed", "err", err)
+	}
+	return err
+}
+
+// RequestTokenRow returns the request of a token given its SHA-256; false
+// when unknown. It needs no org scope.
+func (p *pgRepo) RequestTokenRow(ctx context.Context, tokenHash string) (models.RequestToken, bool, error) {
+	r, err := p.q.RequestTokenRow(ctx, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.RequestToken{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "RequestTokenRow failed", "err", err)
+		return models.RequestToken{}, false, err
+	}
+	return models.RequestToken{OrgID: toUUID(r.OrgID), RowID: toUUID(r.RowID), CreatedAt: toTime(r.CreatedAt)}, true, nil
+}
+
+func requestPortalRow(r db.GetRequestPortalRow) models.RequestPortal {
+	return models.RequestPortal{
+		Key:             r.Key,
+		Enabled:         r.Enabled,
+		Title:           r.Title,
+		Intro:           textOrEmpty(r.Intro),
+		Captcha:         r.Captcha,
+		Photos:          r.Photos,
+		DefaultPriority: textOrEmpty(r.DefaultPriority),
+		UpdatedBy:       optUUID(r.UpdatedBy),
+		UpdatedAt:       toTime(r.UpdatedAt),
+	}
+}
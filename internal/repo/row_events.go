@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// StreamRowEvents returns up to limit row events of a table after the
+// position (afterTxid, afterID) as the caller sees them, in (txid, id)
+// order, holding back those of transactions newer than the event horizon.
+// Events of rows the caller cannot see are left out.
+func (p *pgRepo) StreamRowEvents(ctx context.Context, orgID uuid.UUID, tableID, afterTxid, afterID int64, limit int) ([]models.RowEvent, error) {
+	rows, err := p.q.StreamRowEvents(ctx, db.StreamRowEventsParams{
+		TableID:    tableID,
+		AfterTxid:  afterTxid,
+		AfterID:    afterID,
+		LimitCount: int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "StreamRowEvents failed", "org_id", orgID.String(), "table_id", tableID, "err", err)
+		return nil, err
+	}
+	out := make([]models.RowEvent, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.RowEvent{
+			ID:        r.ID,
+			Txid:      r.Txid,
+			Type:      r.Type,
+			RowID:     toUUID(r.RowID),
+			Data:      r.Data,
+			Previous:  r.Previous,
+			CreatedAt: toTime(r.CreatedAt),
+		})
+	}
+	return out, nil
+}
+
+// RowEventHorizon returns the transaction below which every transaction has
+// ended, where a new stream starts, and whether committed events of a table
+// are held back above it.
+func (p *pgRepo) RowEventHorizon(ctx context.Context, orgID uuid.UUID, tableID int64) (int64, bool, error) {
+	r, err := p.q.RowEventHorizon(ctx, tableID)
+	if err != nil {
+		slog.ErrorContext(ctx, "RowEventHorizon failed", "org_id", orgID.String(), "table_id", tableID, "err", err)
+	}
+	return r.Horizon, r.Held, err
+}
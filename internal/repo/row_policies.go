@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Row policies ----------------
+
+func (p *pgRepo) ListRowPolicies(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.RowPolicy, error) {
+	slog.DebugContext(ctx, "ListRowPolicies", "org_id", orgID.String(), "table_id", tableID)
+	rows, err := p.q.ListRowPolicies(ctx, db.ListRowPoliciesParams{
+		TableID: tableID,
+		OrgID:   fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListRowPolicies failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.RowPolicy, 0, len(rows))
+	for _, r := range rows {
+		pol := models.RowPolicy{
+			Name:       r.Name,
+			Role:       models.OrgRole(r.Role),
+			UserEmail:  r.UserEmail.String,
+			Expression: r.Expression,
+			Refs:       r.Refs,
+		}
+		if r.UserID.Valid {
+			id := toUUID(r.UserID)
+			pol.UserID = &id
+		}
+		if r.TeamID.Valid {
+			id := toUUID(r.TeamID)
+			pol.TeamID = &id
+		}
+		out = append(out, pol)
+	}
+	return out, nil
+}
+
+// ClearRowPolicies removes every policy of a table, so every caller with
+// read access sees all of its rows again.
+func (p *pgRepo) ClearRowPolicies(ctx context.Context, orgID uuid.UUID, tableID int64) error {
+	err := p.q.DeleteRowPolicies(ctx, db.DeleteRowPoliciesParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClearRowPolicies failed", "err", err)
+	}
+	return err
+}
+
+// AddRowPolicy stores a policy whose ExpressionSQL and Refs have been
+// compiled by the caller.
+func (p *pgRepo) AddRowPolicy(ctx context.Context, orgID uuid.UUID, tableID int64, pol models.RowPolicy) error {
+	refs := pol.Refs
+	if refs == nil {
+		refs = []string{}
+	}
+	arg := db.InsertRowPolicyParams{
+		OrgID:         fromUUID(orgID),
+		TableID:       tableID,
+		Name:          pol.Name,
+		Role:          toNullableText(string(pol.Role)),
+		Expression:    pol.Expression,
+		ExpressionSql: pol.ExpressionSQL,
+		Refs:          refs,
+	}
+	if pol.UserID != nil {
+		arg.UserID = fromUUID(*pol.UserID)
+	}
+	if pol.TeamID != nil {
+		arg.TeamID = fromUUID(*pol.TeamID)
+	}
+	err := p.q.InsertRowPolicy(ctx, arg)
+	if err != nil {
+		slog.ErrorContext(ctx, "AddRowPolicy failed", "err", err)
+	}
+	return err
+}
+
+// RowPoliciesUsingColumn names the policies of a table whose conditions read
+// column; used to guard column removal.
+func (p *pgRepo) RowPoliciesUsingColumn(ctx context.Context, orgID uuid.UUID, table, column string) ([]string, error) {
+	names, err := p.q.RowPoliciesUsingColumn(ctx, db.RowPoliciesUsingColumnParams{
+		OrgID:      fromUUID(orgID),
+		TableName:  table,
+		ColumnName: column,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RowPoliciesUsingColumn failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
@@ -38,3 +38,39 @@ func (p *pgRepo) SearchUsers(ctx context.Context, org_id uuid.UUID, payload []by
 	slog.DebugContext(ctx, "SearchUsers ok", "count", len(users))
 	return users, nil
 }
+
+// SearchOrg runs the org-wide full-text search and groups hits by table,
+// preserving the query's table and rank ordering.
+func (p *pgRepo) SearchOrg(ctx context.Context, orgID uuid.UUID, q string, perTable int) ([]models.SearchGroup, error) {
+	slog.DebugContext(ctx, "SearchOrg", "org_id", orgID.String(), "q", q, "per_table", perTable)
+	rows, err := p.q.SearchOrgRows(ctx, db.SearchOrgRowsParams{
+		OrgID:    fromUUID(orgID),
+		Q:        q,
+		PerTable: int32(perTable),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "SearchOrg failed", "err", err)
+		return nil, err
+	}
+	groups := []models.SearchGroup{}
+	for _, r := range rows {
+		if n := len(groups); n == 0 || groups[n-1].TableID != r.TableID {
+			groups = append(groups, models.SearchGroup{
+				TableID:   r.TableID,
+				TableSlug: r.TableSlug,
+				TableName: r.TableName,
+				Total:     r.TableTotal,
+			})
+		}
+		g := &groups[len(groups)-1]
+		g.Hits = append(g.Hits, models.SearchHit{
+			ID:      toUUID(r.RowID),
+			Label:   r.Label.String,
+			Column:  r.MatchedColumn,
+			Snippet: r.Snippet.String,
+			Rank:    r.Rank,
+		})
+	}
+	slog.DebugContext(ctx, "SearchOrg ok", "tables", len(groups), "rows", len(rows))
+	return groups, nil
+}
@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- State machines ----------------
+
+// storedRequired and storedRules are the rules of a state as kept in
+// app.state_machines.states, with their compiled SQL, which the API never
+// returns.
+type storedRequired struct {
+	models.RequiredField
+	SQL string `json:"sql,omitempty"`
+}
+
+type storedRules struct {
+	Required []storedRequired  `json:"required,omitempty"`
+	Set      map[string]string `json:"set,omitempty"`
+	SQL      map[string]string `json:"sql,omitempty"`
+}
+
+func encodeStates(states map[string]models.StateRules) ([]byte, error) {
+	stored := make(map[string]storedRules, len(states))
+	for name, s := range states {
+		req := make([]storedRequired, len(s.Required))
+		for i, f := range s.Required {
+			req[i] = storedRequired{RequiredField: f, SQL: f.WhenSQL}
+		}
+		stored[name] = storedRules{Required: req, Set: s.Set, SQL: s.SQL}
+	}
+	return json.Marshal(stored)
+}
+
+func decodeStates(b []byte) (map[string]models.StateRules, error) {
+	var stored map[string]storedRules
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	out := make(map[string]models.StateRules, len(stored))
+	for name, s := range stored {
+		rules := models.StateRules{Set: s.Set, SQL: s.SQL}
+		for _, f := range s.Required {
+			f.WhenSQL = f.SQL
+			rules.Required = append(rules.Required, f.RequiredField)
+		}
+		out[name] = rules
+	}
+	return out, nil
+}
+
+// ListStateMachines returns the state machines of a table, by column.
+func (p *pgRepo) ListStateMachines(ctx context.Context, orgID uuid.UUID, tableID int64) ([]models.StateMachine, error) {
+	rows, err := p.q.ListStateMachines(ctx, db.ListStateMachinesParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListStateMachines failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.StateMachine, 0, len(rows))
+	for _, r := range rows {
+		m := models.StateMachine{
+			ID:        toUUID(r.ID),
+			Table:     r.TableSlug,
+			TableID:   r.TableID,
+			Column:    r.ColumnName,
+			Initial:   r.Initial,
+			Refs:      r.Refs,
+			CreatedAt: toTime(r.CreatedAt),
+			UpdatedAt: toTime(r.UpdatedAt),
+		}
+		if m.Initial == nil {
+			m.Initial = []string{}
+		}
+		err := json.Unmarshal(r.Transitions, &m.Transitions)
+		if err == nil {
+			m.States, err = decodeStates(r.States)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "ListStateMachines: bad JSON", "table_id", tableID, "column", r.ColumnName, "err", err)
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// PutStateMachine creates or replaces the state machine of a column; its
+// SQL and Refs have been compiled by the caller.
+func (p *pgRepo) PutStateMachine(ctx context.Context, orgID uuid.UUID, m models.StateMachine) error {
+	transitions, err := json.Marshal(m.Transitions)
+	if err != nil {
+		return err
+	}
+	states, err := encodeStates(m.States)
+	if err != nil {
+		return err
+	}
+	initial, refs := m.Initial, m.Refs
+	if initial == nil {
+		initial = []string{}
+	}
+	if refs == nil {
+		refs = []string{}
+	}
+	err = p.q.UpsertStateMachine(ctx, db.UpsertStateMachineParams{
+		OrgID:       fromUUID(orgID),
+		TableID:     m.TableID,
+		ColumnName:  m.Column,
+		Initial:     initial,
+		Transitions: transitions,
+		States:      states,
+		Refs:        refs,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "PutStateMachine failed", "err", err)
+	}
+	return err
+}
+
+// DeleteStateMachine removes the state machine of a column; deleted is
+// false when it has none.
+func (p *pgRepo) DeleteStateMachine(ctx context.Context, orgID uuid.UUID, tableID int64, column string) (bool, error) {
+	n, err := p.q.DeleteStateMachine(ctx, db.DeleteStateMachineParams{
+		TableID:    tableID,
+		OrgID:      fromUUID(orgID),
+		ColumnName: column,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteStateMachine failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// StateMachinesUsingColumn names, by their column, the state machines of a
+// table that read or write a column.
+func (p *pgRepo) StateMachinesUsingColumn(ctx context.Context, orgID uuid.UUID, tableID int64, column string) ([]string, error) {
+	names, err := p.q.StateMachinesUsingColumn(ctx, db.StateMachinesUsingColumnParams{
+		TableID:    tableID,
+		OrgID:      fromUUID(orgID),
+		ColumnName: column,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "StateMachinesUsingColumn failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+// EvalRowExprs evaluates compiled expressions ({"name": "<sql>"}) over a
+// row after and before a change, previous being nil for new rows, for the
+// acting user.
+func (p *pgRepo) EvalRowExprs(ctx context.Context, data, previous []byte, exprs map[string]string) (map[string]any, error) {
+	b, err := json.Marshal(exprs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.q.EvalRowExprs(ctx, db.EvalRowExprsParams{Data: data, Previous: previous, Exprs: b})
+	if err != nil {
+		slog.ErrorContext(ctx, "EvalRowExprs failed", "err", err)
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(res, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Storage engines ----------------
+
+func (p *pgRepo) ListTableStorage(ctx context.Context, orgID uuid.UUID) ([]models.TableStorage, error) {
+	slog.DebugContext(ctx, "ListTableStorage", "org_id", orgID.String())
+	rows, err := p.q.ListTableStorage(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTableStorage failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.TableStorage, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, tableStorage(db.GetTableStorageRow(r)))
+	}
+	return out, nil
+}
+
+func (p *pgRepo) GetTableStorage(ctx context.Context, orgID uuid.UUID, table string) (models.TableStorage, error) {
+	slog.DebugContext(ctx, "GetTableStorage", "org_id", orgID.String(), "table", table)
+	row, err := p.q.GetTableStorage(ctx, db.GetTableStorageParams{
+		OrgID:     fromUUID(orgID),
+		TableName: table,
+	})
+	if err != nil {
+		return models.TableStorage{}, err
+	}
+	return tableStorage(row), nil
+}
+
+func (p *pgRepo) EnsurePhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64) (string, error) {
+	slog.DebugContext(ctx, "EnsurePhysicalTable", "org_id", orgID.String(), "table_id", tableID)
+	name, err := p.q.EnsurePhysicalTable(ctx, db.EnsurePhysicalTableParams{
+		TableID: tableID,
+		OrgID:   fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "EnsurePhysicalTable failed", "err", err)
+		return "", err
+	}
+	return name, nil
+}
+
+// BackfillPhysicalTable copies up to batchSize rows (all when 0) into the
+// physical table and reports how many it copied.
+func (p *pgRepo) BackfillPhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64, batchSize int) (int, error) {
+	n, err := p.q.BackfillPhysicalTable(ctx, db.BackfillPhysicalTableParams{
+		BatchSize: int32(batchSize),
+		TableID:   tableID,
+		OrgID:     fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "BackfillPhysicalTable failed", "err", err)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// PhysicalTableDrift lists up to limit rows (all when 0) whose physical copy
+// is missing or differs from EAV.
+func (p *pgRepo) PhysicalTableDrift(ctx context.Context, orgID uuid.UUID, tableID int64, limit int) ([]uuid.UUID, error) {
+	rows, err := p.q.ListPhysicalTableDrift(ctx, db.ListPhysicalTableDriftParams{
+		LimitCount: int32(limit),
+		TableID:    tableID,
+		OrgID:      fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "PhysicalTableDrift failed", "err", err)
+		return nil, err
+	}
+	out := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, toUUID(r))
+	}
+	return out, nil
+}
+
+func (p *pgRepo) SyncPhysicalRow(ctx context.Context, orgID uuid.UUID, rowID uuid.UUID) error {
+	err := p.q.SyncPhysicalRow(ctx, db.SyncPhysicalRowParams{
+		RowID: fromUUID(rowID),
+		OrgID: fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "SyncPhysicalRow failed", "err", err)
+	}
+	return err
+}
+
+func (p *pgRepo) CutOverRelational(ctx context.Context, orgID uuid.UUID, tableID int64) error {
+	slog.DebugContext(ctx, "CutOverRelational", "org_id", orgID.String(), "table_id", tableID)
+	err := p.q.CutOverRelational(ctx, db.CutOverRelationalParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "CutOverRelational failed", "err", err)
+	}
+	return err
+}
+
+func (p *pgRepo) RevertRelational(ctx context.Context, orgID uuid.UUID, tableID int64) error {
+	slog.DebugContext(ctx, "RevertRelational", "org_id", orgID.String(), "table_id", tableID)
+	err := p.q.RevertRelational(ctx, db.RevertRelationalParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "RevertRelational failed", "err", err)
+	}
+	return err
+}
+
+func (p *pgRepo) DropPhysicalTable(ctx context.Context, orgID uuid.UUID, tableID int64) error {
+	slog.DebugContext(ctx, "DropPhysicalTable", "org_id", orgID.String(), "table_id", tableID)
+	err := p.q.DropPhysicalTable(ctx, db.DropPhysicalTableParams{TableID: tableID, OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DropPhysicalTable failed", "err", err)
+	}
+	return err
+}
+
+func tableStorage(r db.GetTableStorageRow) models.TableStorage {
+	out := models.TableStorage{
+		TableID:       r.ID,
+		Name:          r.Name,
+		Slug:          r.Slug,
+		Mode:          r.StorageMode,
+		PhysicalTable: r.PhysicalTable.String,
+		RowCount:      r.RowCount,
+	}
+	if r.MigratedAt.Valid {
+		t := r.MigratedAt.Time
+		out.MigratedAt = &t
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Table templates ----------------
+
+func (p *pgRepo) ListTemplateInstalls(ctx context.Context, orgID uuid.UUID) ([]models.TemplateInstall, error) {
+	slog.DebugContext(ctx, "ListTemplateInstalls", "org_id", orgID.String())
+	rows, err := p.q.ListTemplateInstalls(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListTemplateInstalls failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.TemplateInstall, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, templateInstall(r))
+	}
+	return out, nil
+}
+
+func (p *pgRepo) RecordTemplateInstall(ctx context.Context, orgID uuid.UUID, template string, version int) (models.TemplateInstall, error) {
+	slog.DebugContext(ctx, "RecordTemplateInstall", "org_id", orgID.String(), "template", template, "version", version)
+	row, err := p.q.RecordTemplateInstall(ctx, db.RecordTemplateInstallParams{
+		OrgID:    fromUUID(orgID),
+		Template: template,
+		Version:  int32(version),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RecordTemplateInstall failed", "err", err)
+		return models.TemplateInstall{}, err
+	}
+	return templateInstall(row), nil
+}
+
+func templateInstall(r db.AppTemplateInstall) models.TemplateInstall {
+	return models.TemplateInstall{
+		Template:    r.Template,
+		Version:     int(r.Version),
+		InstalledAt: r.InstalledAt.Time,
+		UpdatedAt:   r.UpdatedAt.Time,
+	}
+}
@@ -3,6 +3,7 @@ package repo
 import (
     "context"
     "encoding/json"
+    "errors"
     "log/slog"
     "time"
 
@@ -10,6 +11,8 @@ import (
     "yourapp/internal/models"
 
     "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgtype"
 )
 
 // toJSONBytes tries to normalize various JSON representations to a []byte
@@ -27,24 +30,6 @@ func toJSONBytes(v any) []byte {
     }
 }
 
-func toString(v any) string {
-    switch x := v.(type) {
-    case nil:
-        return ""
-    case string:
-        return x
-    case []byte:
-        return string(x)
-    default:
-        b, _ := json.Marshal(x)
-        if len(b) > 0 && b[0] == '"' && b[len(b)-1] == '"' {
-            var s string
-            if err := json.Unmarshal(b, &s); err == nil { return s }
-        }
-        return string(b)
-    }
-}
-
 // SearchUserTable exposes the generic search over user-defined EAV tables.
 func (p *pgRepo) SearchUserTable(ctx context.Context, org_id uuid.UUID, table string, payload []byte) ([]models.TableRow, error) {
 	slog.DebugContext(ctx, "SearchUserTable", "org_id", org_id.String(), "table", table)
@@ -111,11 +96,58 @@ func (p *pgRepo) GetUserTableSchema(ctx context.Context, org_id uuid.UUID, table
 			IsReference:           r.IsReference,
 			ReferenceTableID:      refID,
 			RequireDifferentTable: r.RequireDifferentTable,
+			Kind:                  r.Kind,
+			Expression:            r.Expression.String,
+			Rollup:                rollupSpec(ctx, r.RollupAggregate, r.RollupTable, r.RollupVia, r.RollupTarget, r.RollupFilter),
+			Access:                columnAccess(r.ReadRole, r.EditRole, r.Masked),
+			FieldAccess:           fieldAccess(r.Visible, r.Editable),
 		})
 	}
 	return out, nil
 }
 
+// SetColumnAccess replaces the field-level rules of a column; nil access
+// lifts every restriction.
+func (p *pgRepo) SetColumnAccess(ctx context.Context, orgID uuid.UUID, table, column string, access *models.ColumnAccess) (bool, error) {
+	slog.DebugContext(ctx, "SetColumnAccess", "org_id", orgID.String(), "table", table, "column", column)
+	arg := db.SetColumnAccessParams{OrgID: fromUUID(orgID), TableName: table, ColumnName: column}
+	if access != nil {
+		arg.ReadRole = toNullableText(string(access.ReadRole))
+		arg.EditRole = toNullableText(string(access.EditRole))
+		arg.Masked = access.Masked
+	}
+	_, err := p.q.SetColumnAccess(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "SetColumnAccess failed", "err", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func columnAccess(readRole, editRole string, masked bool) *models.ColumnAccess {
+	if readRole == "" && editRole == "" && !masked {
+		return nil
+	}
+	return &models.ColumnAccess{
+		ReadRole: models.OrgRole(readRole),
+		EditRole: models.OrgRole(editRole),
+		Masked:   masked,
+	}
+}
+
+func fieldAccess(visible, editable bool) string {
+	switch {
+	case !visible:
+		return models.FieldMasked
+	case !editable:
+		return models.FieldRead
+	}
+	return models.FieldEdit
+}
+
 func (p *pgRepo) CreateUserTable(ctx context.Context, orgID uuid.UUID, name string) (models.UserTable, bool, error) {
 	slog.DebugContext(ctx, "CreateUserTable", "org_id", orgID.String(), "name", name)
 	row, err := p.q.CreateUserTable(ctx, db.CreateUserTableParams{
@@ -201,6 +233,23 @@ func (p *pgRepo) AddUserTableColumn(ctx context.Context, orgID uuid.UUID, table
 		}
 		enumJSON = b
 	}
+	kind := input.Kind
+	if kind == "" {
+		kind = "value"
+	}
+	var rollupAgg pgtype.Text
+	var rollupFilter []byte
+	if kind == "rollup" && input.Rollup != nil {
+		rollupAgg = pgtype.Text{String: input.Rollup.Aggregate, Valid: true}
+		if len(input.Rollup.Filter) > 0 {
+			b, err := json.Marshal(input.Rollup.Filter)
+			if err != nil {
+				slog.ErrorContext(ctx, "AddUserTableColumn: bad rollup filter", "err", err)
+				return models.TableColumn{}, false, err
+			}
+			rollupFilter = b
+		}
+	}
 	row, err := p.q.AddUserTableColumn(ctx, db.AddUserTableColumnParams{
 		OrgID:                 fromUUID(orgID),
 		TableName:             table,
@@ -212,6 +261,13 @@ func (p *pgRepo) AddUserTableColumn(ctx context.Context, orgID uuid.UUID, table
 		IsReference:           input.IsReference,
 		ReferenceTable:        input.ReferenceTable,
 		RequireDifferentTable: input.RequireDifferentTable,
+		Kind:                  kind,
+		Expression:            pgtype.Text{String: input.Expression, Valid: kind == "computed"},
+		ExpressionSql:         pgtype.Text{String: input.ExpressionSQL, Valid: kind == "computed"},
+		RollupViaColumnID:     pgtype.Int8{Int64: input.RollupViaColumnID, Valid: kind == "rollup"},
+		RollupTargetColumnID:  pgtype.Int8{Int64: input.RollupTargetColumnID, Valid: kind == "rollup" && input.RollupTargetColumnID != 0},
+		RollupAggregate:       rollupAgg,
+		RollupFilter:          rollupFilter,
 	})
 	if err != nil {
 		slog.ErrorContext(ctx, "AddUserTableColumn failed", "err", err)
@@ -238,10 +294,76 @@ func (p *pgRepo) AddUserTableColumn(ctx context.Context, orgID uuid.UUID, table
 		IsReference:           row.IsReference,
 		ReferenceTableID:      refID,
 		RequireDifferentTable: row.RequireDifferentTable,
+		Kind:                  row.Kind,
+		Expression:            row.Expression.String,
+		Rollup:                rollupSpec(ctx, row.RollupAggregate, row.RollupTable, row.RollupVia, row.RollupTarget, row.RollupFilter),
+	}
+	if row.Created && row.Kind == "rollup" {
+		// Backfill the cache for existing rows; later writes keep it current via triggers.
+		if err := p.q.RefreshRollupColumn(ctx, row.ID); err != nil {
+			slog.ErrorContext(ctx, "AddUserTableColumn: rollup backfill failed", "err", err)
+			return col, row.Created, err
+		}
 	}
 	return col, row.Created, nil
 }
 
+// UpdateUserTableColumn changes the required/indexed flags, enum values and
+// require_different_table of an existing value column. Type and reference
+// target are immutable; found is false when no such value column exists.
+func (p *pgRepo) UpdateUserTableColumn(ctx context.Context, orgID uuid.UUID, table string, input models.TableColumnInput) (models.TableColumn, bool, error) {
+	slog.DebugContext(ctx, "UpdateUserTableColumn", "org_id", orgID.String(), "table", table, "name", input.Name)
+	var enumJSON []byte
+	if len(input.EnumValues) > 0 {
+		b, err := json.Marshal(input.EnumValues)
+		if err != nil {
+			slog.ErrorContext(ctx, "UpdateUserTableColumn: bad enum values", "err", err)
+			return models.TableColumn{}, false, err
+		}
+		enumJSON = b
+	}
+	row, err := p.q.UpdateUserTableColumn(ctx, db.UpdateUserTableColumnParams{
+		OrgID:                 fromUUID(orgID),
+		TableName:             table,
+		ColumnName:            input.Name,
+		IsRequired:            input.Required,
+		IsIndexed:             input.Indexed,
+		EnumValues:            enumJSON,
+		RequireDifferentTable: input.RequireDifferentTable,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TableColumn{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateUserTableColumn failed", "err", err)
+		return models.TableColumn{}, false, err
+	}
+	var enums []string
+	if len(row.EnumValues) > 0 {
+		if err := json.Unmarshal(row.EnumValues, &enums); err != nil {
+			slog.WarnContext(ctx, "UpdateUserTableColumn: bad enum_values JSON from DB", "err", err)
+		}
+	}
+	var refID *int64
+	if row.ReferenceTableID.Valid {
+		v := row.ReferenceTableID.Int64
+		refID = &v
+	}
+	return models.TableColumn{
+		ID:                    row.ID,
+		Name:                  row.Name,
+		Type:                  row.Type,
+		Required:              row.IsRequired,
+		Indexed:               row.IsIndexed,
+		EnumValues:            enums,
+		IsReference:           row.IsReference,
+		ReferenceTableID:      refID,
+		RequireDifferentTable: row.RequireDifferentTable,
+		Kind:                  row.Kind,
+		Expression:            row.Expression.String,
+	}, true, nil
+}
+
 func (p *pgRepo) RemoveUserTableColumn(ctx context.Context, orgID uuid.UUID, table string, columnName string) (models.TableColumn, bool, error) {
 	slog.DebugContext(ctx, "RemoveUserTableColumn", "org_id", orgID.String(), "table", table, "column", columnName)
 	row, err := p.q.RemoveUserTableColumn(ctx, db.RemoveUserTableColumnParams{
@@ -278,6 +400,8 @@ func (p *pgRepo) RemoveUserTableColumn(ctx context.Context, orgID uuid.UUID, tab
 		IsReference:           row.IsReference,
 		ReferenceTableID:      refID,
 		RequireDifferentTable: row.RequireDifferentTable,
+		Kind:                  row.Kind,
+		Expression:            row.Expression.String,
 	}
 	return col, row.Deleted, nil
 }
@@ -306,6 +430,32 @@ func (p *pgRepo) InsertUserTableRow(ctx context.Context, orgID uuid.UUID, table
 	}, nil
 }
 
+// UpdateUserTableRow sets the given values on a row of the table; found is
+// false when the row is not in that table.
+func (p *pgRepo) UpdateUserTableRow(ctx context.Context, orgID uuid.UUID, table string, rowID uuid.UUID, values []byte) (models.TableRow, bool, error) {
+	slog.DebugContext(ctx, "UpdateUserTableRow", "org_id", orgID.String(), "table", table, "row_id", rowID.String())
+	row, err := p.q.UpdateUserTableRow(ctx, db.UpdateUserTableRowParams{
+		OrgID:     fromUUID(orgID),
+		TableName: table,
+		RowID:     fromUUID(rowID),
+		Values:    values,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TableRow{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateUserTableRow failed", "err", err)
+		return models.TableRow{}, false, err
+	}
+	var data map[string]any
+	if b := toJSONBytes(row.Data); len(b) > 0 {
+		if err := json.Unmarshal(b, &data); err != nil {
+			slog.WarnContext(ctx, "UpdateUserTableRow: bad row JSON", "err", err)
+		}
+	}
+	return models.TableRow{RowID: toUUID(row.RowID), Data: data}, true, nil
+}
+
 func (p *pgRepo) GetRowData(ctx context.Context, orgID uuid.UUID, rowID uuid.UUID) (map[string]any, bool, error) {
 	slog.DebugContext(ctx, "GetRowData", "org_id", orgID.String(), "row_id", rowID.String())
 	r, err := p.q.GetRowData(ctx, db.GetRowDataParams{
@@ -409,7 +559,7 @@ func (p *pgRepo) GetRowLabel(ctx context.Context, orgID uuid.UUID, tableID int64
     if err != nil {
         return "", err
     }
-    return toString(lbl), nil
+    return lbl.String, nil
 }
 
 func (p *pgRepo) GetRowLabelAuto(ctx context.Context, orgID uuid.UUID, rowID uuid.UUID) (string, error) {
@@ -420,7 +570,7 @@ func (p *pgRepo) GetRowLabelAuto(ctx context.Context, orgID uuid.UUID, rowID uui
     if err != nil {
         return "", err
     }
-    return toString(lbl), nil
+    return lbl.String, nil
 }
 
 func (p *pgRepo) BatchGetRowLabels(ctx context.Context, orgID uuid.UUID, tableID int64, rowIDs []uuid.UUID) (map[uuid.UUID]string, error) {
@@ -436,23 +586,59 @@ func (p *pgRepo) BatchGetRowLabels(ctx context.Context, orgID uuid.UUID, tableID
     if err != nil { return nil, err }
     out := make(map[uuid.UUID]string, len(rows))
     for _, r := range rows {
-        out[toUUID(r.RowID)] = toString(r.Label)
+        out[toUUID(r.RowID)] = r.Label.String
     }
     return out, nil
 }
 
-func (p *pgRepo) BatchGetRowLabelsAuto(ctx context.Context, orgID uuid.UUID, rowIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+func (p *pgRepo) BatchGetRowLabelsAuto(ctx context.Context, orgID uuid.UUID, rowIDs []uuid.UUID, tableIDs []int64) (map[uuid.UUID]string, error) {
     arr := make([]string, 0, len(rowIDs))
     for _, id := range rowIDs { arr = append(arr, id.String()) }
     b, _ := json.Marshal(arr)
     rows, err := p.q.BatchGetRowLabelsAuto(ctx, db.BatchGetRowLabelsAutoParams{
-        OrgID: fromUUID(orgID),
-        Ids:   b,
+        OrgID:    fromUUID(orgID),
+        Ids:      b,
+        TableIds: tableIDs,
     })
     if err != nil { return nil, err }
     out := make(map[uuid.UUID]string, len(rows))
     for _, r := range rows {
-        out[toUUID(r.RowID)] = toString(r.Label)
+        out[toUUID(r.RowID)] = r.Label.String
     }
     return out, nil
 }
+
+// rollupSpec rebuilds the API view of a rollup definition from its joined
+// column metadata; nil for non-rollup columns.
+func rollupSpec(ctx context.Context, agg, table, via, target pgtype.Text, filter []byte) *models.RollupSpec {
+	if !agg.Valid {
+		return nil
+	}
+	spec := &models.RollupSpec{
+		Table:     table.String,
+		Via:       via.String,
+		Aggregate: agg.String,
+		Target:    target.String,
+	}
+	if len(filter) > 0 {
+		if err := json.Unmarshal(filter, &spec.Filter); err != nil {
+			slog.WarnContext(ctx, "rollupSpec: bad rollup_filter JSON", "err", err)
+		}
+	}
+	return spec
+}
+
+// ReferencingRows returns the rows whose value in a uuid column is target,
+// whichever storage engine holds the column's table.
+func (p *pgRepo) ReferencingRows(ctx context.Context, columnID int64, target uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := p.q.ReferencingRows(ctx, db.ReferencingRowsParams{ColumnID: columnID, Target: fromUUID(target)})
+	if err != nil {
+		slog.ErrorContext(ctx, "ReferencingRows failed", "column_id", columnID, "err", err)
+		return nil, err
+	}
+	out := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, toUUID(r))
+	}
+	return out, nil
+}
@@ -0,0 +1,355 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Webhooks ----------------
+
+func webhookFromRow(r db.GetWebhookRow) models.Webhook {
+	w := models.Webhook{
+		ID:         toUUID(r.ID),
+		Name:       r.Name,
+		URL:        r.Url,
+		Events:     r.Events,
+		Table:      textOrEmpty(r.TableSlug),
+		Filter:     textOrEmpty(r.FilterExpression),
+		FilterRefs: r.FilterRefs,
+		Active:     r.Active,
+		CreatedAt:  toTime(r.CreatedAt),
+		UpdatedAt:  toTime(r.UpdatedAt),
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	if r.TableID.Valid {
+		id := r.TableID.Int64
+		w.TableID = &id
+	}
+	return w
+}
+
+func (p *pgRepo) ListWebhooks(ctx context.Context, orgID uuid.UUID) ([]models.Webhook, error) {
+	slog.DebugContext(ctx, "ListWebhooks", "org_id", orgID.String())
+	rows, err := p.q.ListWebhooks(ctx, fromUUID(orgID))
+	if err != nil {
+		slog.ErrorContext(ctx, "ListWebhooks failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.Webhook, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, webhookFromRow(db.GetWebhookRow(r)))
+	}
+	return out, nil
+}
+
+// GetWebhook returns a webhook of the org without its secret; found is
+// false when there is none with that id.
+func (p *pgRepo) GetWebhook(ctx context.Context, orgID, id uuid.UUID) (models.Webhook, bool, error) {
+	r, err := p.q.GetWebhook(ctx, db.GetWebhookParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Webhook{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetWebhook failed", "err", err)
+		return models.Webhook{}, false, err
+	}
+	return webhookFromRow(r), true, nil
+}
+
+// webhookFilter returns the stored form of a webhook's optional filter.
+func webhookFilter(w models.Webhook) (pgtype.Int8, pgtype.Text, pgtype.Text, []string) {
+	var table pgtype.Int8
+	if w.TableID != nil {
+		table = pgtype.Int8{Int64: *w.TableID, Valid: true}
+	}
+	refs := w.FilterRefs
+	if refs == nil {
+		refs = []string{}
+	}
+	return table, toNullableText(w.Filter), toNullableText(w.FilterSQL), refs
+}
+
+func webhookEvents(w models.Webhook) []string {
+	if w.Events == nil {
+		return []string{}
+	}
+	return w.Events
+}
+
+// CreateWebhook stores a webhook whose Secret and FilterSQL have been set by
+// the caller and returns its id.
+func (p *pgRepo) CreateWebhook(ctx context.Context, orgID uuid.UUID, w models.Webhook) (uuid.UUID, error) {
+	table, filter, filterSQL, refs := webhookFilter(w)
+	id, err := p.q.InsertWebhook(ctx, db.InsertWebhookParams{
+		OrgID:            fromUUID(orgID),
+		Name:             w.Name,
+		Url:              w.URL,
+		Secret:           w.Secret,
+		Events:           webhookEvents(w),
+		TableID:          table,
+		FilterExpression: filter,
+		FilterSql:        filterSQL,
+		FilterRefs:       refs,
+		Active:           w.Active,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "CreateWebhook failed", "err", err)
+		return uuid.Nil, err
+	}
+	return toUUID(id), nil
+}
+
+// UpdateWebhook replaces the settings of a webhook, keeping its secret.
+func (p *pgRepo) UpdateWebhook(ctx context.Context, orgID uuid.UUID, w models.Webhook) (bool, error) {
+	table, filter, filterSQL, refs := webhookFilter(w)
+	n, err := p.q.UpdateWebhook(ctx, db.UpdateWebhookParams{
+		Name:             w.Name,
+		Url:              w.URL,
+		Events:           webhookEvents(w),
+		TableID:          table,
+		FilterExpression: filter,
+		FilterSql:        filterSQL,
+		FilterRefs:       refs,
+		Active:           w.Active,
+		ID:               fromUUID(w.ID),
+		OrgID:            fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "UpdateWebhook failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteWebhook removes a webhook together with its delivery log.
+func (p *pgRepo) DeleteWebhook(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	n, err := p.q.DeleteWebhook(ctx, db.DeleteWebhookParams{ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "DeleteWebhook failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetWebhookSecret replaces the signing secret of a webhook; pending
+// deliveries are signed with the new one.
+func (p *pgRepo) SetWebhookSecret(ctx context.Context, orgID, id uuid.UUID, secret string) (bool, error) {
+	n, err := p.q.SetWebhookSecret(ctx, db.SetWebhookSecretParams{Secret: secret, ID: fromUUID(id), OrgID: fromUUID(orgID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "SetWebhookSecret failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// WebhooksUsingColumn names the webhooks whose filters read column; used to
+// guard column removal.
+func (p *pgRepo) WebhooksUsingColumn(ctx context.Context, orgID uuid.UUID, table, column string) ([]string, error) {
+	names, err := p.q.WebhooksUsingColumn(ctx, db.WebhooksUsingColumnParams{
+		OrgID:      fromUUID(orgID),
+		TableName:  table,
+		ColumnName: column,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "WebhooksUsingColumn failed", "err", err)
+		return nil, err
+	}
+	return names, nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook, newest
+// first, optionally only those with the given status.
+func (p *pgRepo) ListWebhookDeliveries(ctx context.Context, orgID, webhookID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := p.q.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		WebhookID:  fromUUID(webhookID),
+		OrgID:      fromUUID(orgID),
+		Status:     toNullableText(status),
+		LimitCount: int32(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ListWebhookDeliveries failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.WebhookDelivery, 0, len(rows))
+	for _, r := range rows {
+		d := models.WebhookDelivery{
+			ID:         r.ID,
+			EventID:    r.EventID,
+			Event:      r.Event,
+			Status:     r.Status,
+			Attempts:   int(r.Attempts),
+			LastStatus: int(r.LastStatus.Int32),
+			LastError:  textOrEmpty(r.LastError),
+			CreatedAt:  toTime(r.CreatedAt),
+		}
+		if r.RowID.Valid {
+			id := toUUID(r.RowID)
+			d.RowID = &id
+		}
+		if r.Status == models.DeliveryPending && r.NextAttemptAt.Valid {
+			t := r.NextAttemptAt.Time
+			d.NextAttemptAt = &t
+		}
+		if r.DeliveredAt.Valid {
+			t := r.DeliveredAt.Time
+			d.DeliveredAt = &t
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// RedeliverWebhookDelivery queues a delivery of the webhook again with a
+// fresh retry budget, whatever its state.
+func (p *pgRepo) RedeliverWebhookDelivery(ctx context.Context, orgID, webhookID uuid.UUID, deliveryID int64) (bool, error) {
+	n, err := p.q.RedeliverWebhookDelivery(ctx, db.RedeliverWebhookDeliveryParams{
+		ID:        deliveryID,
+		WebhookID: fromUUID(webhookID),
+		OrgID:     fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RedeliverWebhookDelivery failed", "err", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// PingWebhook queues a ping event for one webhook, active or not, and
+// returns the delivery id.
+func (p *pgRepo) PingWebhook(ctx context.Context, orgID, webhookID uuid.UUID) (int64, bool, error) {
+	id, err := p.q.PingWebhook(ctx, db.PingWebhookParams{WebhookID: fromUUID(webhookID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "PingWebhook failed", "err", err)
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// ---------------- Events ----------------
+
+// RowSnapshot returns the unmasked JSON of a row, to record as the previous
+// state in the event of a change to it; found is false when it does not exist.
+func (p *pgRepo) RowSnapshot(ctx context.Context, orgID, rowID uuid.UUID) ([]byte, bool, error) {
+	data, err := p.q.GetRowSnapshot(ctx, db.GetRowSnapshotParams{RowID: fromUUID(rowID), OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "RowSnapshot failed", "err", err)
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// EmitRowEvent records a row event, queues its webhook deliveries and
+// returns the event id. The row's current data is read in the database;
+// previous is its snapshot from before the change, nil for created rows.
+// Call it in the transaction that changes the row.
+func (p *pgRepo) EmitRowEvent(ctx context.Context, orgID uuid.UUID, event string, tableID int64, rowID uuid.UUID, previous []byte) (int64, error) {
+	id, err := p.q.EmitRowEvent(ctx, db.EmitRowEventParams{
+		OrgID:    fromUUID(orgID),
+		Type:     event,
+		TableID:  tableID,
+		RowID:    fromUUID(rowID),
+		Previous: previous,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "EmitRowEvent failed", "event", event, "err", err)
+	}
+	return id, err
+}
+
+// EmitSchemaEvent records a table or column event carrying data, the JSON
+// of the table or column, and queues its webhook deliveries.
+func (p *pgRepo) EmitSchemaEvent(ctx context.Context, orgID uuid.UUID, event string, tableID int64, data []byte) error {
+	_, err := p.q.EmitSchemaEvent(ctx, db.EmitSchemaEventParams{
+		OrgID:   fromUUID(orgID),
+		Type:    event,
+		TableID: tableID,
+		Data:    data,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "EmitSchemaEvent failed", "event", event, "err", err)
+	}
+	return err
+}
+
+// ---------------- Webhook dispatch ----------------
+
+// ClaimWebhookDeliveries claims up to limit due deliveries of every org for
+// one attempt each; a claimed delivery is not due again before lease has
+// passed. It must run without an org in ctx.
+func (p *pgRepo) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error) {
+	rows, err := p.q.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+		LimitCount:   int32(limit),
+		LeaseSeconds: int32(lease / time.Second),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ClaimWebhookDeliveries failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.ClaimedJob, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.ClaimedJob{ID: r.ID, OrgID: toUUID(r.OrgID)})
+	}
+	return out, nil
+}
+
+// GetWebhookAttempt loads a pending delivery with its webhook and event;
+// found is false once it is no longer pending.
+func (p *pgRepo) GetWebhookAttempt(ctx context.Context, orgID uuid.UUID, deliveryID int64) (models.WebhookAttempt, bool, error) {
+	r, err := p.q.GetWebhookAttempt(ctx, db.GetWebhookAttemptParams{ID: deliveryID, OrgID: fromUUID(orgID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.WebhookAttempt{}, false, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "GetWebhookAttempt failed", "err", err)
+		return models.WebhookAttempt{}, false, err
+	}
+	return models.WebhookAttempt{
+		DeliveryID: r.DeliveryID,
+		WebhookID:  toUUID(r.WebhookID),
+		Attempts:   int(r.Attempts),
+		Active:     r.Active,
+		URL:        r.Url,
+		Secret:     r.Secret,
+		Event:      r.Event,
+		Payload:    r.Payload,
+	}, true, nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt: the new status,
+// the HTTP status (0 when no response arrived), an error message and, for
+// pending deliveries, when to try again.
+func (p *pgRepo) RecordWebhookAttempt(ctx context.Context, orgID uuid.UUID, deliveryID int64, status string, httpStatus int, errMsg string, next time.Time) error {
+	var last pgtype.Int4
+	if httpStatus != 0 {
+		last = pgtype.Int4{Int32: int32(httpStatus), Valid: true}
+	}
+	err := p.q.RecordWebhookAttempt(ctx, db.RecordWebhookAttemptParams{
+		Status:        status,
+		LastStatus:    last,
+		LastError:     toNullableText(errMsg),
+		NextAttemptAt: pgtype.Timestamptz{Time: next, Valid: true},
+		ID:            deliveryID,
+		OrgID:         fromUUID(orgID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "RecordWebhookAttempt failed", "err", err)
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	db "yourapp/internal/db/gen"
+	"yourapp/internal/models"
+)
+
+// ---------------- Parts used on work orders ----------------
+
+// WorkOrderPartLines returns what a work order used per part, lot and
+// serial number, in the order the parts were first issued to it.
+func (p *pgRepo) WorkOrderPartLines(ctx context.Context, orgID, workOrderID uuid.UUID) ([]models.WorkOrderPartLine, error) {
+	rows, err := p.q.WorkOrderPartLines(ctx, db.WorkOrderPartLinesParams{
+		OrgID:       fromUUID(orgID),
+		WorkOrderID: fromUUID(workOrderID),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "WorkOrderPartLines failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.WorkOrderPartLine, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, models.WorkOrderPartLine{
+			PartID:       toUUID(r.PartID),
+			Lot:          r.Lot,
+			Serial:       r.Serial,
+			Issued:       r.Issued,
+			Returned:     r.Returned,
+			Quantity:     r.Issued - r.Returned,
+			IssuedCost:   r.IssuedCost,
+			ReturnedCost: r.ReturnedCost,
+			Cost:         r.IssuedCost - r.ReturnedCost,
+			LastMovedAt:  toTime(r.LastMovedAt),
+		})
+	}
+	return out, nil
+}
+
+// WorkOrderPartsCost returns the cost of the parts used on a work order.
+func (p *pgRepo) WorkOrderPartsCost(ctx context.Context, workOrderID uuid.UUID) (float64, error) {
+	cost, err := p.q.WorkOrderPartsCost(ctx, fromUUID(workOrderID))
+	if err != nil {
+		slog.ErrorContext(ctx, "WorkOrderPartsCost failed", "err", err)
+		return 0, err
+	}
+	return cost, nil
+}
+
+// PartsCostTotals returns the cost of parts used on the work orders the
+// caller sees, grouped by groupBy (models.PartsCostBy*), over the days from
+// and to (YYYY-MM-DD, either may be empty).
+func (p *pgRepo) PartsCostTotals(ctx context.Context, orgID uuid.UUID, workOrdersTableID int64, groupBy, from, to string) ([]models.PartsCostTotal, error) {
+	fromDate, err := pgDate(from)
+	if err != nil {
+		return nil, err
+	}
+	toDate, err := pgDate(to)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.q.PartsCostTotals(ctx, db.PartsCostTotalsParams{
+		OrgID:             fromUUID(orgID),
+		WorkOrdersTableID: workOrdersTableID,
+		FromDate:          fromDate,
+		ToDate:            toDate,
+		GroupBy:           groupBy,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "PartsCostTotals failed", "err", err)
+		return nil, err
+	}
+	out := make([]models.PartsCostTotal, 0, len(rows))
+	for _, r := range rows {
+		// key and name come out of CASE expressions, which sqlc leaves untyped
+		name, _ := r.Name.(string)
+		t := models.PartsCostTotal{
+			Name:         name,
+			Cost:         r.Cost,
+			IssuedCost:   r.IssuedCost,
+			ReturnedCost: r.ReturnedCost,
+			WorkOrders:   r.WorkOrders,
+		}
+		if key, ok := r.Key.(string); ok {
+			t.Key = &key
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
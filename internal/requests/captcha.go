@@ -0,0 +1,64 @@
+package requests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Captcha checks the captcha answers of portal submissions with a
+// provider's siteverify endpoint. hCaptcha, reCAPTCHA and Cloudflare
+// Turnstile all take the same form:
+//
+//	https://api.hcaptcha.com/siteverify
+//	https://www.google.com/recaptcha/api/siteverify
+//	https://challenges.cloudflare.com/turnstile/v0/siteverify
+type Captcha struct {
+	VerifyURL string
+	SiteKey   string // shown to the form, which renders the widget
+	Secret    string
+	Client    *http.Client // http.DefaultClient when nil
+}
+
+// Configured reports whether answers can be checked.
+func (c Captcha) Configured() bool { return c.VerifyURL != "" && c.Secret != "" }
+
+// Verify reports whether the provider accepts an answer given from
+// remoteIP. Errors are failures to ask it.
+func (c Captcha) Verify(ctx context.Context, answer, remoteIP string) (bool, error) {
+	if strings.TrimSpace(answer) == "" {
+		return false, nil
+	}
+	form := url.Values{"secret": {c.Secret}, "response": {answer}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return false, fmt.Errorf("captcha verify: %s", resp.Status)
+	}
+	var out struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return false, fmt.Errorf("captcha verify: %w", err)
+	}
+	return out.Success, nil
+}
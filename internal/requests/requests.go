@@ -0,0 +1,420 @@
+// Package requests takes maintenance requests from people without an
+// account, through an org's public request portal, and turns approved
+// requests into work orders.
+//
+// Requests are rows of the table provisioned from the requests template.
+// A portal submission creates one for the system, with source PORTAL, the
+// requester's contact details and photos linked to it, and returns a token:
+// the requester follows the request's status, and that of the work order it
+// became, with it. Only the SHA-256 of the token is kept.
+//
+// Converting a request creates a work order from its title, description,
+// priority, location, asset and image, with parent_request pointing back,
+// links its files to the work order, and approves the request, which
+// records the work order, the approver and the day. The approval goes
+// through the request table's state machine, so its roles say who may
+// approve.
+package requests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/automations"
+	"yourapp/internal/models"
+	"yourapp/internal/pm"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// Table is the slug of the table of the requests template.
+const Table = "requests"
+
+// MaxPhotos bounds the photos of a submission.
+const MaxPhotos = 5
+
+// Bounds of submitted texts, in characters.
+const (
+	maxTitle = 200
+	maxText  = 5000
+	maxField = 200
+)
+
+// StatusApproved is the status of a request converted into a work order.
+const StatusApproved = "APPROVED"
+
+// Priorities are the priorities of requests and work orders.
+var Priorities = []string{"NONE", "LOW", "MEDIUM", "HIGH", "URGENT"}
+
+// Error is a submission or change refused for what it asks, answered with
+// 400.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func refuse(format string, args ...any) error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// ErrConverted refuses converting a request that already has a work order.
+var ErrConverted = errors.New("the request already has a work order")
+
+// ErrNoTable is returned when the org has not provisioned the requests
+// table.
+var ErrNoTable = errors.New("the org has no requests table")
+
+// NewKey returns a new random portal key.
+func NewKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// newToken returns a new status token and the SHA-256 it is kept as.
+func newToken() (string, string) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token)
+}
+
+// HashToken returns the SHA-256 a status token is kept as.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPortal validates the settings of a portal and tidies its texts.
+// captcha tells whether the server has a captcha provider configured.
+func CheckPortal(p *models.RequestPortal, captcha bool) error {
+	p.Title, p.Intro = strings.TrimSpace(p.Title), strings.TrimSpace(p.Intro)
+	p.DefaultPriority = strings.ToUpper(strings.TrimSpace(p.DefaultPriority))
+	switch {
+	case p.Title == "":
+		return refuse("title is required")
+	case utf8.RuneCountInString(p.Title) > maxTitle:
+		return refuse("title must be at most %d characters", maxTitle)
+	case utf8.RuneCountInString(p.Intro) > maxText:
+		return refuse("intro must be at most %d characters", maxText)
+	case p.DefaultPriority != "" && !slices.Contains(Priorities, p.DefaultPriority):
+		return refuse("default_priority must be one of %s", strings.Join(Priorities, ", "))
+	case p.Captcha && !captcha:
+		return refuse("no captcha provider is configured on the server")
+	}
+	return nil
+}
+
+// Submission is a request submitted through a portal. Photos are files
+// already uploaded.
+type Submission struct {
+	Title       string
+	Description string
+	Name        string
+	Email       string
+	Phone       string
+	Photos      []uuid.UUID
+}
+
+// Check validates a submission and tidies its texts.
+func (s *Submission) Check() error {
+	s.Title, s.Description = strings.TrimSpace(s.Title), strings.TrimSpace(s.Description)
+	s.Name, s.Email, s.Phone = strings.TrimSpace(s.Name), strings.TrimSpace(s.Email), strings.TrimSpace(s.Phone)
+	switch {
+	case s.Title == "":
+		return refuse("title is required")
+	case utf8.RuneCountInString(s.Title) > maxTitle:
+		return refuse("title must be at most %d characters", maxTitle)
+	case utf8.RuneCountInString(s.Description) > maxText:
+		return refuse("description must be at most %d characters", maxText)
+	case utf8.RuneCountInString(s.Name) > maxField, utf8.RuneCountInString(s.Phone) > maxField, len(s.Email) > maxField:
+		return refuse("name, email and phone must be at most %d characters", maxField)
+	case len(s.Photos) > MaxPhotos:
+		return refuse("at most %d photos may be sent", MaxPhotos)
+	}
+	if s.Email != "" {
+		addr, err := mail.ParseAddress(s.Email)
+		if err != nil || addr.Address != s.Email {
+			return refuse("email is not a valid address")
+		}
+	}
+	return nil
+}
+
+// Submit creates the request of a submission to a portal of orgID and
+// returns its id and the token following it. Like the PM scheduler it acts
+// for the system.
+func Submit(ctx context.Context, r repo.Repo, orgID uuid.UUID, portal models.RequestPortal, s Submission) (uuid.UUID, string, error) {
+	values := map[string]any{
+		"title":  s.Title,
+		"source": "PORTAL",
+	}
+	for col, v := range map[string]string{
+		"description":     s.Description,
+		"requester_name":  s.Name,
+		"requester_email": s.Email,
+		"requester_phone": s.Phone,
+		"priority":        portal.DefaultPriority,
+	} {
+		if v != "" {
+			values[col] = v
+		}
+	}
+	if len(s.Photos) > 0 {
+		values["image"] = s.Photos[0].String()
+	}
+	token, hash := newToken()
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	var id uuid.UUID
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		tableID, set, err := tableValues(ctx, tx, orgID, values)
+		if err != nil {
+			return err
+		}
+		set, err = workflow.Apply(ctx, tx, orgID, uuid.Nil, tableID, uuid.Nil, set)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(set)
+		if err != nil {
+			return err
+		}
+		row, err := automations.InsertRow(ctx, tx, orgID, tableID, Table, payload)
+		if err != nil {
+			return err
+		}
+		id = row.RowID
+		for _, f := range s.Photos {
+			if err := tx.LinkFile(ctx, orgID, f, id, nil); err != nil {
+				return err
+			}
+		}
+		return tx.InsertRequestToken(ctx, orgID, id, hash)
+	})
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return id, token, nil
+}
+
+// tableValues returns the id of the org's requests table and values
+// limited to the columns it has.
+func tableValues(ctx context.Context, tx repo.Repo, orgID uuid.UUID, values map[string]any) (int64, map[string]any, error) {
+	tables, err := tx.ListUserTables(ctx, orgID)
+	if err != nil {
+		return 0, nil, err
+	}
+	var tableID int64
+	for _, t := range tables {
+		if t.Slug == Table {
+			tableID = t.ID
+		}
+	}
+	if tableID == 0 {
+		return 0, nil, ErrNoTable
+	}
+	schema, err := tx.GetUserTableSchema(ctx, orgID, Table)
+	if err != nil {
+		return 0, nil, err
+	}
+	set := map[string]any{}
+	for _, c := range schema {
+		if v, ok := values[c.Name]; ok && (c.Kind == "" || c.Kind == "value") {
+			set[c.Name] = v
+		}
+	}
+	return tableID, set, nil
+}
+
+// Status is what a requester sees of their request.
+type Status struct {
+	Title       string           `json:"title"`
+	Status      string           `json:"status"`
+	SubmittedAt time.Time        `json:"submitted_at"`
+	ReviewedOn  string           `json:"reviewed_on,omitempty"`
+	Note        string           `json:"note,omitempty"`
+	WorkOrder   *WorkOrderStatus `json:"work_order,omitempty"`
+}
+
+// WorkOrderStatus is what a requester sees of the work order their request
+// became.
+type WorkOrderStatus struct {
+	Status      string `json:"status"`
+	DueDate     string `json:"due_date,omitempty"`
+	CompletedOn string `json:"completed_on,omitempty"`
+}
+
+// Track returns the status of the request a token follows; false when the
+// token is unknown or its request was deleted.
+func Track(ctx context.Context, r repo.Repo, token string) (Status, bool, error) {
+	t, found, err := r.RequestTokenRow(ctx, HashToken(token))
+	if err != nil || !found {
+		return Status{}, false, err
+	}
+	ctx = repo.WithUser(repo.WithOrg(ctx, t.OrgID), uuid.Nil)
+	req, found, err := snapshot(ctx, r, t.OrgID, t.RowID)
+	if err != nil || !found {
+		return Status{}, false, err
+	}
+	s := Status{
+		Title:       str(req["title"]),
+		Status:      str(req["status"]),
+		SubmittedAt: t.CreatedAt,
+		ReviewedOn:  str(req["reviewed_on"]),
+		Note:        str(req["review_note"]),
+	}
+	if woID, err := uuid.Parse(str(req["work_order"])); err == nil {
+		wo, found, err := snapshot(ctx, r, t.OrgID, woID)
+		if err != nil {
+			return Status{}, false, err
+		}
+		if found {
+			s.WorkOrder = &WorkOrderStatus{
+				Status:      str(wo["status"]),
+				DueDate:     str(wo["due_date"]),
+				CompletedOn: str(wo["completed_on"]),
+			}
+		}
+	}
+	return s, true, nil
+}
+
+// snapshot returns the values of a row, unmasked.
+func snapshot(ctx context.Context, r repo.Repo, orgID, rowID uuid.UUID) (map[string]any, bool, error) {
+	b, found, err := r.RowSnapshot(ctx, orgID, rowID)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Overridable lists the work order columns a conversion may set on top of
+// those taken from the request.
+var Overridable = []string{"title", "description", "priority", "asset", "location", "team", "category", "due_date", "estimated_start_date"}
+
+// Convert approves a request for userID, creating its work order with
+// overrides on top of the values taken from the request, all in one
+// transaction, and returns the work order's id. note is recorded as the
+// request's review_note when set; requesters see it. The work order is
+// created for the system like the PM scheduler's; the approval is checked
+// against the roles of the request table's state machine.
+func Convert(ctx context.Context, r repo.Repo, orgID, userID, requestID uuid.UUID, overrides map[string]any, note string) (uuid.UUID, error) {
+	for col := range overrides {
+		if !slices.Contains(Overridable, col) {
+			return uuid.Nil, refuse("values may only set %s", strings.Join(Overridable, ", "))
+		}
+	}
+	ctx = repo.WithUser(repo.WithOrg(ctx, orgID), uuid.Nil)
+	var woID uuid.UUID
+	err := r.InTx(ctx, func(tx repo.Repo) error {
+		req, found, err := snapshot(ctx, tx, orgID, requestID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return refuse("request not found")
+		}
+		if str(req["work_order"]) != "" {
+			return ErrConverted
+		}
+		values := workOrderValues(requestID, req)
+		for col, v := range overrides {
+			values[col] = v
+		}
+		id, created, err := pm.CreateWorkOrder(ctx, tx, orgID, values)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return refuse("the org has no work order table")
+		}
+		woID = id
+
+		files, err := tx.ListFiles(ctx, orgID, &requestID, 100)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := tx.LinkFile(ctx, orgID, f.ID, woID, &userID); err != nil {
+				return err
+			}
+		}
+
+		approval := map[string]any{"work_order": woID.String(), "reviewed_by": userID.String()}
+		if note = strings.TrimSpace(note); note != "" {
+			approval["review_note"] = note
+		}
+		tableID, approval, err := tableValues(ctx, tx, orgID, approval)
+		if err != nil {
+			return err
+		}
+		set, _, err := workflow.Transition(ctx, tx, orgID, userID, tableID, requestID, "status", StatusApproved, approval)
+		switch {
+		case errors.Is(err, workflow.ErrNoMachine):
+			set, err = approval, nil
+			set["status"] = StatusApproved
+		case errors.Is(err, workflow.ErrUnchanged):
+			return ErrConverted
+		}
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(set)
+		if err != nil {
+			return err
+		}
+		_, found, err = automations.UpdateRow(ctx, tx, orgID, tableID, Table, requestID, payload)
+		if err == nil && !found {
+			err = refuse("request not found")
+		}
+		return err
+	})
+	return woID, err
+}
+
+// workOrderValues returns the values of the work order a request becomes.
+func workOrderValues(requestID uuid.UUID, req map[string]any) map[string]any {
+	values := map[string]any{"parent_request": requestID.String()}
+	for _, col := range []string{"title", "description", "priority", "location", "asset", "image"} {
+		if v := req[col]; v != nil && v != "" {
+			values[col] = v
+		}
+	}
+	var contact []string
+	for _, col := range []string{"requester_name", "requester_email", "requester_phone"} {
+		if v := str(req[col]); v != "" {
+			contact = append(contact, v)
+		}
+	}
+	if len(contact) > 0 {
+		d := str(values["description"])
+		if d != "" {
+			d += "\n\n"
+		}
+		values["description"] = d + "Requested by " + strings.Join(contact, ", ")
+	}
+	return values
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,109 @@
+// Package storage moves user tables between the EAV and relational storage
+// engines while they stay online.
+//
+// Moving to relational creates the physical table, which puts the table in
+// dual mode: EAV stays authoritative and every write is mirrored. Existing
+// rows are then backfilled in small batches, rows that raced the backfill
+// are resynced, and a short cut-over under a table lock makes the physical
+// table authoritative. Moving back copies the values into EAV again.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// DefaultBatchSize is the number of rows copied per backfill transaction.
+const DefaultBatchSize = 500
+
+// driftPasses bounds the resync passes before cut-over; whatever is still
+// out of sync after them is resynced by the cut-over itself.
+const driftPasses = 3
+
+// Options tune a migration.
+type Options struct {
+	BatchSize int // rows per backfill transaction; DefaultBatchSize when 0
+}
+
+// ToRelational migrates a table to the relational engine. It is safe to
+// re-run after a failure, and a no-op for tables that are already relational.
+func ToRelational(ctx context.Context, r repo.Repo, orgID uuid.UUID, table string, opts Options) (models.TableStorage, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	st, err := r.GetTableStorage(ctx, orgID, table)
+	if err != nil {
+		return st, fmt.Errorf("table %s: %w", table, err)
+	}
+	if st.Mode == models.StorageRelational {
+		return st, nil
+	}
+	batch := opts.BatchSize
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+
+	if _, err := r.EnsurePhysicalTable(ctx, orgID, st.TableID); err != nil {
+		return st, fmt.Errorf("create physical table for %s: %w", st.Slug, err)
+	}
+
+	copied := 0
+	for {
+		n, err := r.BackfillPhysicalTable(ctx, orgID, st.TableID, batch)
+		if err != nil {
+			return st, fmt.Errorf("backfill %s: %w", st.Slug, err)
+		}
+		copied += n
+		if n < batch {
+			break
+		}
+		slog.InfoContext(ctx, "storage backfill", "table", st.Slug, "copied", copied, "rows", st.RowCount)
+	}
+
+	// Rows updated while their batch was being copied may hold stale values.
+	for pass := 0; pass < driftPasses; pass++ {
+		ids, err := r.PhysicalTableDrift(ctx, orgID, st.TableID, batch)
+		if err != nil {
+			return st, fmt.Errorf("check %s: %w", st.Slug, err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			if err := r.SyncPhysicalRow(ctx, orgID, id); err != nil {
+				return st, fmt.Errorf("resync %s row %s: %w", st.Slug, id, err)
+			}
+		}
+	}
+
+	if err := r.CutOverRelational(ctx, orgID, st.TableID); err != nil {
+		return st, fmt.Errorf("cut over %s: %w", st.Slug, err)
+	}
+	slog.InfoContext(ctx, "storage migrated", "table", st.Slug, "mode", models.StorageRelational, "copied", copied)
+	return r.GetTableStorage(ctx, orgID, table)
+}
+
+// ToEAV moves a table back to the EAV engine. The physical table is kept in
+// sync (dual mode) so a later ToRelational is quick, unless drop is set.
+func ToEAV(ctx context.Context, r repo.Repo, orgID uuid.UUID, table string, drop bool) (models.TableStorage, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	st, err := r.GetTableStorage(ctx, orgID, table)
+	if err != nil {
+		return st, fmt.Errorf("table %s: %w", table, err)
+	}
+	if st.Mode == models.StorageRelational {
+		if err := r.RevertRelational(ctx, orgID, st.TableID); err != nil {
+			return st, fmt.Errorf("revert %s: %w", st.Slug, err)
+		}
+	}
+	if drop && st.PhysicalTable != "" {
+		if err := r.DropPhysicalTable(ctx, orgID, st.TableID); err != nil {
+			return st, fmt.Errorf("drop physical table of %s: %w", st.Slug, err)
+		}
+	}
+	return r.GetTableStorage(ctx, orgID, table)
+}
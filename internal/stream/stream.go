@@ -0,0 +1,158 @@
+// Package stream wakes live row event streams. The database announces every
+// committed row event on the app_row_events channel; a Hub LISTENs on one
+// connection per process and wakes the subscriptions of the event's table,
+// which read the events themselves, as their caller, from app.events after
+// the last one they sent. Several API processes each run their own Hub.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel is the notification channel of row events (034_row_event_stream).
+const Channel = "app_row_events"
+
+// notification is the payload of Channel.
+type notification struct {
+	OrgID   uuid.UUID `json:"org_id"`
+	TableID int64     `json:"table_id"`
+}
+
+type key struct {
+	org   uuid.UUID
+	table int64
+}
+
+// Hub fans row event notifications out to subscriptions.
+type Hub struct {
+	pool *pgxpool.Pool
+
+	mu   sync.Mutex
+	subs map[key]map[*Subscription]struct{}
+}
+
+// NewHub returns a Hub listening through a connection of pool; without one
+// it is only woken through Publish.
+func NewHub(pool *pgxpool.Pool) *Hub {
+	return &Hub{pool: pool, subs: map[key]map[*Subscription]struct{}{}}
+}
+
+// Run listens until ctx is done, reconnecting after errors. Notifications
+// sent while it was disconnected are lost, so every subscription is woken
+// when it reconnects.
+func (h *Hub) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "row event stream started", "channel", Channel)
+	delay := time.Second
+	for {
+		connected, err := h.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = time.Second
+		}
+		slog.ErrorContext(ctx, "row event listener failed", "err", err, "retry_in", delay.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, time.Minute)
+	}
+}
+
+// listen holds one LISTEN connection until it fails; connected reports
+// whether it got as far as listening.
+func (h *Hub) listen(ctx context.Context) (connected bool, err error) {
+	c, err := h.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	// The connection keeps listening, so it never goes back to the pool.
+	conn := c.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return false, err
+	}
+	h.wakeAll()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		var msg notification
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			slog.WarnContext(ctx, "bad row event notification", "payload", n.Payload, "err", err)
+			continue
+		}
+		h.Publish(msg.OrgID, msg.TableID)
+	}
+}
+
+// Publish wakes the subscriptions to a table of an org; Run calls it for
+// every notification.
+func (h *Hub) Publish(orgID uuid.UUID, tableID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[key{orgID, tableID}] {
+		s.signal()
+	}
+}
+
+func (h *Hub) wakeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, set := range h.subs {
+		for s := range set {
+			s.signal()
+		}
+	}
+}
+
+// Subscribe returns a subscription to the row events of a table of an org.
+// Close it when done.
+func (h *Hub) Subscribe(orgID uuid.UUID, tableID int64) *Subscription {
+	s := &Subscription{hub: h, key: key{orgID, tableID}, wake: make(chan struct{}, 1)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s.key] == nil {
+		h.subs[s.key] = map[*Subscription]struct{}{}
+	}
+	h.subs[s.key][s] = struct{}{}
+	return s
+}
+
+// Subscription wakes when a table may have new row events.
+type Subscription struct {
+	hub  *Hub
+	key  key
+	wake chan struct{}
+}
+
+// Wake receives a value when events may be waiting; several announcements
+// between reads wake it once.
+func (s *Subscription) Wake() <-chan struct{} { return s.wake }
+
+// Close unsubscribes.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	delete(s.hub.subs[s.key], s)
+	if len(s.hub.subs[s.key]) == 0 {
+		delete(s.hub.subs, s.key)
+	}
+}
+
+func (s *Subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,250 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+	"yourapp/internal/workflow"
+)
+
+// Status reports a template against what an org has installed.
+type Status struct {
+	Template
+	InstalledVersion int  `json:"installed_version,omitempty"` // 0 when never provisioned
+	UpgradeAvailable bool `json:"upgrade_available"`
+}
+
+// Result describes what provisioning one template changed.
+type Result struct {
+	Template        string           `json:"template"`
+	Version         int              `json:"version"`
+	PreviousVersion int              `json:"previous_version,omitempty"` // 0 on first install
+	Table           models.UserTable `json:"table"`
+	TableCreated    bool             `json:"table_created"`
+	ColumnsAdded    []string         `json:"columns_added"`
+	// StateMachinesAdded names the columns whose state machine was
+	// installed; columns that already have one keep it.
+	StateMachinesAdded []string `json:"state_machines_added,omitempty"`
+	// HierarchyAdded names the parent column when the table's hierarchy
+	// was declared; a table that has one keeps it.
+	HierarchyAdded string `json:"hierarchy_added,omitempty"`
+	// Conflicts lists existing columns whose definition differs from the
+	// template. They are left untouched and the version is not recorded.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// Statuses lists every template with the org's installed version.
+func Statuses(ctx context.Context, r repo.Repo, orgID uuid.UUID) ([]Status, error) {
+	installed, err := installedVersions(ctx, r, orgID)
+	if err != nil {
+		return nil, err
+	}
+	all := All()
+	out := make([]Status, 0, len(all))
+	for _, t := range all {
+		v := installed[t.Name]
+		out = append(out, Status{Template: t, InstalledVersion: v, UpgradeAvailable: v > 0 && v < t.Version})
+	}
+	return out, nil
+}
+
+// Provision installs the named templates and sets (plus anything they
+// reference) into an org. It is idempotent: tables and columns that already
+// exist are kept as they are, so running it again after a template gains
+// columns upgrades the org in place.
+//
+// All tables are created before any column so that templates may reference
+// each other (or themselves) regardless of order.
+func Provision(ctx context.Context, r repo.Repo, orgID uuid.UUID, names ...string) ([]Result, error) {
+	ctx = repo.WithOrg(ctx, orgID)
+	tmpls, err := Resolve(names...)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := installedVersions(ctx, r, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(tmpls))
+	tables := make(map[string]models.UserTable, len(tmpls))
+	for i, t := range tmpls {
+		ut, created, err := r.CreateUserTable(ctx, orgID, t.Table)
+		if err != nil {
+			return nil, fmt.Errorf("provision %s: %w", t.Name, err)
+		}
+		tables[t.Name] = ut
+		results[i] = Result{
+			Template:        t.Name,
+			Version:         t.Version,
+			PreviousVersion: installed[t.Name],
+			Table:           ut,
+			TableCreated:    created,
+			ColumnsAdded:    []string{},
+		}
+	}
+
+	for i, t := range tmpls {
+		res := &results[i]
+		schema, err := r.GetUserTableSchema(ctx, orgID, res.Table.Slug)
+		if err != nil {
+			return nil, fmt.Errorf("provision %s: %w", t.Name, err)
+		}
+		existing := make(map[string]models.TableColumn, len(schema))
+		for _, c := range schema {
+			existing[c.Name] = c
+		}
+		for _, c := range t.Columns {
+			var ref models.UserTable
+			if c.References != "" {
+				ref = tables[c.References]
+			}
+			if cur, ok := existing[c.Name]; ok {
+				if msg := conflict(c, cur, ref); msg != "" {
+					res.Conflicts = append(res.Conflicts, c.Name+": "+msg)
+				}
+				continue
+			}
+			input := models.TableColumnInput{
+				Name:       c.Name,
+				Type:       c.Type,
+				Required:   c.Required,
+				Indexed:    c.Indexed,
+				EnumValues: c.Enum,
+			}
+			if c.References != "" {
+				input.IsReference = true
+				input.ReferenceTable = ref.Slug
+				input.RequireDifferentTable = c.References != t.Name
+			}
+			_, created, err := r.AddUserTableColumn(ctx, orgID, res.Table.Slug, input)
+			if err != nil {
+				return nil, fmt.Errorf("provision %s.%s: %w", t.Name, c.Name, err)
+			}
+			if !created {
+				continue
+			}
+			res.ColumnsAdded = append(res.ColumnsAdded, c.Name)
+			if c.Access != nil {
+				access := &models.ColumnAccess{
+					ReadRole: models.OrgRole(c.Access.ReadRole),
+					EditRole: models.OrgRole(c.Access.EditRole),
+					Masked:   c.Access.Masked,
+				}
+				if _, err := r.SetColumnAccess(ctx, orgID, res.Table.Slug, c.Name, access); err != nil {
+					return nil, fmt.Errorf("provision %s.%s: %w", t.Name, c.Name, err)
+				}
+			}
+		}
+		if len(t.StateMachines) > 0 {
+			if err := installStateMachines(ctx, r, orgID, t, res); err != nil {
+				return nil, fmt.Errorf("provision %s: %w", t.Name, err)
+			}
+		}
+		if t.Hierarchy != "" {
+			if err := installHierarchy(ctx, r, orgID, t, res); err != nil {
+				return nil, fmt.Errorf("provision %s: %w", t.Name, err)
+			}
+		}
+		if len(res.Conflicts) == 0 {
+			if _, err := r.RecordTemplateInstall(ctx, orgID, t.Name, t.Version); err != nil {
+				return nil, fmt.Errorf("provision %s: %w", t.Name, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// installStateMachines installs the template's state machines on columns
+// without one. Machines that don't fit the org's columns are reported as
+// conflicts.
+func installStateMachines(ctx context.Context, r repo.Repo, orgID uuid.UUID, t Template, res *Result) error {
+	schema, err := r.GetUserTableSchema(ctx, orgID, res.Table.Slug)
+	if err != nil {
+		return err
+	}
+	existing, err := r.ListStateMachines(ctx, orgID, res.Table.ID)
+	if err != nil {
+		return err
+	}
+	for _, sm := range t.StateMachines {
+		if slices.ContainsFunc(existing, func(m models.StateMachine) bool { return strings.EqualFold(m.Column, sm.Column) }) {
+			continue
+		}
+		m := sm.model()
+		m.TableID = res.Table.ID
+		if err := workflow.Compile(&m, schema); err != nil {
+			res.Conflicts = append(res.Conflicts, "state machine of "+sm.Column+": "+err.Error())
+			continue
+		}
+		if err := r.PutStateMachine(ctx, orgID, m); err != nil {
+			return err
+		}
+		res.StateMachinesAdded = append(res.StateMachinesAdded, m.Column)
+	}
+	return nil
+}
+
+// installHierarchy declares the template's parent column as the table's
+// hierarchy unless it has one. A parent column whose values hold a cycle is
+// reported as a conflict.
+func installHierarchy(ctx context.Context, r repo.Repo, orgID uuid.UUID, t Template, res *Result) error {
+	_, found, err := r.GetHierarchy(ctx, orgID, res.Table.ID)
+	if err != nil || found {
+		return err
+	}
+	valid, cycle, err := r.PutHierarchy(ctx, orgID, res.Table.ID, t.Hierarchy)
+	switch {
+	case err != nil:
+		return err
+	case !valid:
+		res.Conflicts = append(res.Conflicts, "hierarchy: "+t.Hierarchy+" does not reference the table itself")
+	case cycle != uuid.Nil:
+		res.Conflicts = append(res.Conflicts, "hierarchy: row "+cycle.String()+" is its own ancestor through "+t.Hierarchy)
+	default:
+		res.HierarchyAdded = t.Hierarchy
+	}
+	return nil
+}
+
+func installedVersions(ctx context.Context, r repo.Repo, orgID uuid.UUID) (map[string]int, error) {
+	rows, err := r.ListTemplateInstalls(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(rows))
+	for _, i := range rows {
+		out[i.Template] = i.Version
+	}
+	return out, nil
+}
+
+// conflict explains how an existing column differs from the template, or
+// returns "" when it is compatible. Extra enum values are allowed.
+func conflict(want Column, have models.TableColumn, ref models.UserTable) string {
+	if have.Kind != "" && have.Kind != "value" {
+		return "exists as a " + have.Kind + " column"
+	}
+	if have.Type != want.Type {
+		return fmt.Sprintf("type is %s, template expects %s", have.Type, want.Type)
+	}
+	if want.References != "" && (have.ReferenceTableID == nil || *have.ReferenceTableID != ref.ID) {
+		return "does not reference " + ref.Slug
+	}
+	var missing []string
+	for _, v := range want.Enum {
+		if !slices.Contains(have.EnumValues, v) {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return "missing enum values " + strings.Join(missing, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,333 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// memRepo holds one org's tables in memory, for the repo methods Provision
+// uses. Any other method panics through the nil embedded Repo.
+type memRepo struct {
+	repo.Repo
+	tables    []models.UserTable
+	columns   map[string][]models.TableColumn // by table slug
+	access    map[string]*models.ColumnAccess // by "slug.column"
+	machines  map[int64][]models.StateMachine
+	hierarchy map[int64]string
+	installs  map[string]int
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{
+		columns:   map[string][]models.TableColumn{},
+		access:    map[string]*models.ColumnAccess{},
+		machines:  map[int64][]models.StateMachine{},
+		hierarchy: map[int64]string{},
+		installs:  map[string]int{},
+	}
+}
+
+func (m *memRepo) table(slug string) (models.UserTable, bool) {
+	for _, t := range m.tables {
+		if t.Slug == slug {
+			return t, true
+		}
+	}
+	return models.UserTable{}, false
+}
+
+func (m *memRepo) CreateUserTable(_ context.Context, _ uuid.UUID, name string) (models.UserTable, bool, error) {
+	slug := strings.ReplaceAll(strings.ToLower(name), " ", "-")
+	if t, ok := m.table(slug); ok {
+		return t, false, nil
+	}
+	t := models.UserTable{ID: int64(len(m.tables) + 1), Name: name, Slug: slug}
+	m.tables = append(m.tables, t)
+	return t, true, nil
+}
+
+func (m *memRepo) GetUserTableSchema(_ context.Context, _ uuid.UUID, table string) ([]models.TableColumn, error) {
+	return slices.Clone(m.columns[table]), nil
+}
+
+func (m *memRepo) AddUserTableColumn(_ context.Context, _ uuid.UUID, table string, in models.TableColumnInput) (models.TableColumn, bool, error) {
+	for _, c := range m.columns[table] {
+		if c.Name == in.Name {
+			return c, false, nil
+		}
+	}
+	c := models.TableColumn{
+		ID:          int64(len(m.columns[table]) + 1),
+		Name:        in.Name,
+		Type:        in.Type,
+		Required:    in.Required,
+		Indexed:     in.Indexed,
+		EnumValues:  in.EnumValues,
+		IsReference: in.IsReference,
+		Kind:        "value",
+	}
+	if in.IsReference {
+		ref, ok := m.table(in.ReferenceTable)
+		if !ok {
+			return models.TableColumn{}, false, fmt.Errorf("unknown reference table %q", in.ReferenceTable)
+		}
+		c.ReferenceTableID = &ref.ID
+	}
+	m.columns[table] = append(m.columns[table], c)
+	return c, true, nil
+}
+
+func (m *memRepo) SetColumnAccess(_ context.Context, _ uuid.UUID, table, column string, access *models.ColumnAccess) (bool, error) {
+	m.access[table+"."+column] = access
+	return true, nil
+}
+
+func (m *memRepo) ListStateMachines(_ context.Context, _ uuid.UUID, tableID int64) ([]models.StateMachine, error) {
+	return m.machines[tableID], nil
+}
+
+func (m *memRepo) PutStateMachine(_ context.Context, _ uuid.UUID, sm models.StateMachine) error {
+	m.machines[sm.TableID] = append(m.machines[sm.TableID], sm)
+	return nil
+}
+
+func (m *memRepo) GetHierarchy(_ context.Context, _ uuid.UUID, tableID int64) (models.Hierarchy, bool, error) {
+	col, ok := m.hierarchy[tableID]
+	return models.Hierarchy{TableID: tableID, Column: col}, ok, nil
+}
+
+func (m *memRepo) PutHierarchy(_ context.Context, _ uuid.UUID, tableID int64, column string) (bool, uuid.UUID, error) {
+	t := m.tables[tableID-1]
+	for _, c := range m.columns[t.Slug] {
+		if c.Name == column && c.ReferenceTableID != nil && *c.ReferenceTableID == tableID {
+			m.hierarchy[tableID] = column
+			return true, uuid.Nil, nil
+		}
+	}
+	return false, uuid.Nil, nil
+}
+
+func (m *memRepo) ListTemplateInstalls(_ context.Context, _ uuid.UUID) ([]models.TemplateInstall, error) {
+	var out []models.TemplateInstall
+	for name, v := range m.installs {
+		out = append(out, models.TemplateInstall{Template: name, Version: v})
+	}
+	return out, nil
+}
+
+func (m *memRepo) RecordTemplateInstall(_ context.Context, _ uuid.UUID, template string, version int) (models.TemplateInstall, error) {
+	m.installs[template] = version
+	return models.TemplateInstall{Template: template, Version: version}, nil
+}
+
+// withTemplate replaces a template for the rest of the test.
+func withTemplate(t *testing.T, tmpl Template) {
+	prev := byName[tmpl.Name]
+	byName[tmpl.Name] = tmpl
+	t.Cleanup(func() { byName[tmpl.Name] = prev })
+}
+
+func columnNames(cols []Column) []string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = c.Name
+	}
+	return out
+}
+
+var org = uuid.MustParse("00000000-0000-4000-8000-000000000001")
+
+func TestProvisionInstall(t *testing.T) {
+	ctx := context.Background()
+	r := newMemRepo()
+
+	results, err := Provision(ctx, r, org, "assets")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	var got []string
+	for _, res := range results {
+		got = append(got, res.Template)
+	}
+	// References are provisioned along, before the templates using them
+	if want := []string{"locations", "teams", "assets"}; !slices.Equal(got, want) {
+		t.Fatalf("templates = %v, want %v", got, want)
+	}
+	for _, res := range results {
+		tmpl, _ := Get(res.Template)
+		if !res.TableCreated || res.PreviousVersion != 0 || len(res.Conflicts) > 0 {
+			t.Errorf("%s: created %v, previous %d, conflicts %v", res.Template, res.TableCreated, res.PreviousVersion, res.Conflicts)
+		}
+		if want := columnNames(tmpl.Columns); !slices.Equal(res.ColumnsAdded, want) {
+			t.Errorf("%s: columns added = %v, want %v", res.Template, res.ColumnsAdded, want)
+		}
+		if r.installs[res.Template] != tmpl.Version {
+			t.Errorf("%s: recorded version %d, want %d", res.Template, r.installs[res.Template], tmpl.Version)
+		}
+	}
+
+	assets, locations := results[2], results[0]
+	if assets.HierarchyAdded != "parent_asset" || r.hierarchy[assets.Table.ID] != "parent_asset" {
+		t.Errorf("assets hierarchy = %q", assets.HierarchyAdded)
+	}
+	for _, c := range r.columns["assets"] {
+		if c.Name == "location" && (c.ReferenceTableID == nil || *c.ReferenceTableID != locations.Table.ID) {
+			t.Errorf("assets.location does not reference locations")
+		}
+	}
+	if a := r.access["assets.acquisition_cost"]; a == nil || a.ReadRole != models.RoleMember || a.EditRole != models.RoleAdmin {
+		t.Errorf("assets.acquisition_cost access = %+v", a)
+	}
+
+	// Provisioning again changes nothing
+	again, err := Provision(ctx, r, org, "assets")
+	if err != nil {
+		t.Fatalf("Provision again: %v", err)
+	}
+	for _, res := range again {
+		tmpl, _ := Get(res.Template)
+		if res.TableCreated || len(res.ColumnsAdded) > 0 || res.HierarchyAdded != "" || res.PreviousVersion != tmpl.Version {
+			t.Errorf("%s provisioned again: %+v", res.Template, res)
+		}
+	}
+	if len(r.tables) != 3 {
+		t.Errorf("%d tables after provisioning twice, want 3", len(r.tables))
+	}
+}
+
+// Signup provisions DefaultSet into the new org.
+func TestProvisionSignupSet(t *testing.T) {
+	ctx := context.Background()
+	r := newMemRepo()
+
+	results, err := Provision(ctx, r, org, DefaultSet)
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	set := sets[DefaultSet]
+	for _, name := range set.Templates {
+		tmpl, _ := Get(name)
+		if r.installs[name] != tmpl.Version {
+			t.Errorf("%s: installed version %d, want %d", name, r.installs[name], tmpl.Version)
+		}
+	}
+	for _, res := range results {
+		if len(res.Conflicts) > 0 {
+			t.Errorf("%s: conflicts %v", res.Template, res.Conflicts)
+		}
+		tmpl, _ := Get(res.Template)
+		if len(res.StateMachinesAdded) != len(tmpl.StateMachines) {
+			t.Errorf("%s: state machines added %v, template has %d", res.Template, res.StateMachinesAdded, len(tmpl.StateMachines))
+		}
+	}
+	if len(r.machines) == 0 {
+		t.Error("no state machines installed")
+	}
+
+	statuses, err := Statuses(ctx, r, org)
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	for _, s := range statuses {
+		if !slices.Contains(set.Templates, s.Name) {
+			continue
+		}
+		if s.InstalledVersion != s.Version || s.UpgradeAvailable {
+			t.Errorf("%s: installed %d of %d, upgrade available %v", s.Name, s.InstalledVersion, s.Version, s.UpgradeAvailable)
+		}
+	}
+}
+
+func TestProvisionUpgrade(t *testing.T) {
+	ctx := context.Background()
+	r := newMemRepo()
+
+	current, _ := Get("assets")
+	if current.Version < 2 {
+		t.Fatalf("assets is at version %d, the test needs an earlier one", current.Version)
+	}
+	// An earlier version without the references and the hierarchy
+	old := current
+	old.Version = current.Version - 1
+	old.Columns = slices.DeleteFunc(slices.Clone(current.Columns), func(c Column) bool { return c.Type == "uuid" })
+	old.Hierarchy = ""
+	withTemplate(t, old)
+
+	if _, err := Provision(ctx, r, org, "assets"); err != nil {
+		t.Fatalf("Provision %d: %v", old.Version, err)
+	}
+	statuses, err := Statuses(ctx, r, org)
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	i := slices.IndexFunc(statuses, func(s Status) bool { return s.Name == "assets" })
+	if statuses[i].InstalledVersion != old.Version || statuses[i].UpgradeAvailable {
+		t.Errorf("status after first install = %+v", statuses[i])
+	}
+
+	byName["assets"] = current
+	statuses, err = Statuses(ctx, r, org)
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	if s := statuses[i]; s.InstalledVersion != old.Version || !s.UpgradeAvailable {
+		t.Errorf("status with a newer template = installed %d, upgrade available %v", s.InstalledVersion, s.UpgradeAvailable)
+	}
+
+	results, err := Provision(ctx, r, org, "assets")
+	if err != nil {
+		t.Fatalf("Provision %d: %v", current.Version, err)
+	}
+	res := results[len(results)-1]
+	if res.Template != "assets" || res.TableCreated || res.PreviousVersion != old.Version || res.Version != current.Version {
+		t.Fatalf("upgrade result = %+v", res)
+	}
+	if want := []string{"location", "parent_asset", "team"}; !slices.Equal(res.ColumnsAdded, want) {
+		t.Errorf("columns added = %v, want %v", res.ColumnsAdded, want)
+	}
+	if res.HierarchyAdded != "parent_asset" {
+		t.Errorf("hierarchy added = %q, want parent_asset", res.HierarchyAdded)
+	}
+	if r.installs["assets"] != current.Version {
+		t.Errorf("recorded version %d, want %d", r.installs["assets"], current.Version)
+	}
+	if got := len(r.columns["assets"]); got != len(current.Columns) {
+		t.Errorf("assets has %d columns, want %d", got, len(current.Columns))
+	}
+}
+
+func TestProvisionConflict(t *testing.T) {
+	ctx := context.Background()
+	r := newMemRepo()
+
+	// The org made its own Teams table with a different name column
+	if _, _, err := r.CreateUserTable(ctx, org, "Teams"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.AddUserTableColumn(ctx, org, "teams", models.TableColumnInput{Name: "name", Type: "float"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Provision(ctx, r, org, "teams")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	res := results[0]
+	if want := []string{"name: type is float, template expects text"}; !slices.Equal(res.Conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", res.Conflicts, want)
+	}
+	if want := []string{"description", "email"}; !slices.Equal(res.ColumnsAdded, want) {
+		t.Errorf("columns added = %v, want %v", res.ColumnsAdded, want)
+	}
+	if _, ok := r.installs["teams"]; ok {
+		t.Error("a conflicting install was recorded")
+	}
+}
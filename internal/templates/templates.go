@@ -0,0 +1,312 @@
+// Package templates holds declarative table templates (Work Orders, Assets,
+// Locations, ...) and provisions them into an org's user tables.
+//
+// Templates are YAML files embedded from defs/. Each describes one table and
+// carries a version; bumping the version and appending columns is the upgrade
+// path, since provisioning only ever adds what is missing.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"yourapp/internal/models"
+	"yourapp/internal/workflow"
+)
+
+//go:embed defs/*.yaml
+var defs embed.FS
+
+// Template describes one user table.
+type Template struct {
+	Name        string   `yaml:"name" json:"name"`
+	Title       string   `yaml:"title" json:"title"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Version     int      `yaml:"version" json:"version"`
+	Table       string   `yaml:"table" json:"table"`
+	Columns     []Column `yaml:"columns" json:"columns"`
+	// StateMachines are the lifecycles of enum columns (see
+	// internal/workflow), installed where the column has none yet.
+	StateMachines []StateMachine `yaml:"state_machines" json:"state_machines,omitempty"`
+	// Hierarchy names a column referencing the template itself that holds
+	// the parent of each row, declared where the table has no hierarchy yet.
+	Hierarchy string `yaml:"hierarchy" json:"hierarchy,omitempty"`
+}
+
+// Column is a value column of a template table. References name another
+// template, not a table, so templates stay independent of org table names.
+type Column struct {
+	Name       string   `yaml:"name" json:"name"`
+	Type       string   `yaml:"type" json:"type"` // text|date|bool|enum|uuid|float
+	Required   bool     `yaml:"required" json:"required,omitempty"`
+	Indexed    bool     `yaml:"indexed" json:"indexed,omitempty"`
+	Enum       []string `yaml:"enum" json:"enum,omitempty"`
+	References string   `yaml:"references" json:"references,omitempty"`
+	Access     *Access  `yaml:"access" json:"access,omitempty"`
+}
+
+// Access holds the field-level rules a new column is created with, e.g. to
+// keep costs away from Viewers. Existing columns keep their rules.
+type Access struct {
+	ReadRole string `yaml:"read_role" json:"read_role,omitempty"`
+	EditRole string `yaml:"edit_role" json:"edit_role,omitempty"`
+	Masked   bool   `yaml:"masked" json:"masked,omitempty"`
+}
+
+// StateMachine is the lifecycle a template gives one of its enum columns.
+type StateMachine struct {
+	Column      string                `yaml:"column" json:"column"`
+	Initial     []string              `yaml:"initial" json:"initial,omitempty"`
+	Transitions []Transition          `yaml:"transitions" json:"transitions"`
+	States      map[string]StateRules `yaml:"states" json:"states,omitempty"`
+}
+
+// Transition is an allowed move between states; see
+// models.StateTransition.
+type Transition struct {
+	From  []string `yaml:"from" json:"from"`
+	To    string   `yaml:"to" json:"to"`
+	Roles []string `yaml:"roles" json:"roles,omitempty"`
+}
+
+// StateRules is what entering a state takes; see models.StateRules.
+type StateRules struct {
+	Required []RequiredField   `yaml:"required" json:"required,omitempty"`
+	Set      map[string]string `yaml:"set" json:"set,omitempty"`
+}
+
+// RequiredField is a field a state requires, when When holds if set.
+type RequiredField struct {
+	Field string `yaml:"field" json:"field"`
+	When  string `yaml:"when" json:"when,omitempty"`
+}
+
+// model converts a template state machine for workflow.Compile.
+func (m StateMachine) model() models.StateMachine {
+	out := models.StateMachine{
+		Column:  m.Column,
+		Initial: slices.Clone(m.Initial),
+		States:  make(map[string]models.StateRules, len(m.States)),
+	}
+	for _, t := range m.Transitions {
+		tr := models.StateTransition{From: slices.Clone(t.From), To: t.To}
+		for _, r := range t.Roles {
+			tr.Roles = append(tr.Roles, models.OrgRole(r))
+		}
+		out.Transitions = append(out.Transitions, tr)
+	}
+	for name, rules := range m.States {
+		r := models.StateRules{Set: maps.Clone(rules.Set)}
+		for _, f := range rules.Required {
+			r.Required = append(r.Required, models.RequiredField{Field: f.Field, When: f.When})
+		}
+		out.States[name] = r
+	}
+	return out
+}
+
+// schema describes the template's columns as workflow.Compile expects.
+func (t Template) schema() []models.TableColumn {
+	out := make([]models.TableColumn, len(t.Columns))
+	for i, c := range t.Columns {
+		out[i] = models.TableColumn{Name: c.Name, Type: c.Type, EnumValues: c.Enum, Kind: "value"}
+	}
+	return out
+}
+
+// Set groups templates that are usually provisioned together.
+type Set struct {
+	Name        string   `yaml:"-" json:"name"`
+	Title       string   `yaml:"title" json:"title"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Templates   []string `yaml:"templates" json:"templates"`
+}
+
+// DefaultSet is provisioned into orgs created through signup.
+const DefaultSet = "cmms"
+
+var (
+	byName = map[string]Template{}
+	sets   = map[string]Set{}
+)
+
+func init() {
+	if err := load(defs); err != nil {
+		panic("templates: " + err.Error())
+	}
+}
+
+func load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "defs/*.yaml")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return err
+		}
+		if path.Base(f) == "sets.yaml" {
+			var m map[string]Set
+			if err := yaml.Unmarshal(b, &m); err != nil {
+				return fmt.Errorf("%s: %w", f, err)
+			}
+			for name, s := range m {
+				s.Name = name
+				sets[name] = s
+			}
+			continue
+		}
+		var t Template
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&t); err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+		if _, dup := byName[t.Name]; dup {
+			return fmt.Errorf("%s: duplicate template %q", f, t.Name)
+		}
+		byName[t.Name] = t
+	}
+	for _, t := range byName {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	for _, s := range sets {
+		if _, ok := byName[s.Name]; ok {
+			return fmt.Errorf("set %q shadows a template", s.Name)
+		}
+		for _, n := range s.Templates {
+			if _, ok := byName[n]; !ok {
+				return fmt.Errorf("set %q: unknown template %q", s.Name, n)
+			}
+		}
+	}
+	return nil
+}
+
+func (t Template) validate() error {
+	if t.Name == "" || t.Table == "" || t.Version < 1 {
+		return fmt.Errorf("template %q: name, table and a positive version are required", t.Name)
+	}
+	seen := map[string]bool{}
+	for _, c := range t.Columns {
+		if c.Name == "" || seen[c.Name] {
+			return fmt.Errorf("template %q: missing or duplicate column name %q", t.Name, c.Name)
+		}
+		seen[c.Name] = true
+		switch c.Type {
+		case "text", "date", "bool", "float":
+		case "enum":
+			if len(c.Enum) == 0 {
+				return fmt.Errorf("template %q: enum column %q needs values", t.Name, c.Name)
+			}
+		case "uuid":
+			if c.References != "" {
+				if _, ok := byName[c.References]; !ok {
+					return fmt.Errorf("template %q: column %q references unknown template %q", t.Name, c.Name, c.References)
+				}
+			}
+		default:
+			return fmt.Errorf("template %q: column %q has unsupported type %q", t.Name, c.Name, c.Type)
+		}
+		if c.References != "" && c.Type != "uuid" {
+			return fmt.Errorf("template %q: reference column %q must be uuid", t.Name, c.Name)
+		}
+		if a := c.Access; a != nil {
+			for _, role := range []string{a.ReadRole, a.EditRole} {
+				if role != "" && role != "Viewer" && role != "Member" && role != "Admin" {
+					return fmt.Errorf("template %q: column %q access roles must be Viewer, Member or Admin", t.Name, c.Name)
+				}
+			}
+		}
+	}
+	if t.Hierarchy != "" && !slices.ContainsFunc(t.Columns, func(c Column) bool { return c.Name == t.Hierarchy && c.References == t.Name }) {
+		return fmt.Errorf("template %q: hierarchy %q must be a column referencing the template itself", t.Name, t.Hierarchy)
+	}
+	machines := map[string]bool{}
+	for _, sm := range t.StateMachines {
+		if machines[sm.Column] {
+			return fmt.Errorf("template %q: duplicate state machine for %q", t.Name, sm.Column)
+		}
+		machines[sm.Column] = true
+		m := sm.model()
+		if err := workflow.Compile(&m, t.schema()); err != nil {
+			return fmt.Errorf("template %q: state machine of %q: %w", t.Name, sm.Column, err)
+		}
+	}
+	return nil
+}
+
+// All returns every template ordered by name.
+func All() []Template {
+	out := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Sets returns every template set ordered by name.
+func Sets() []Set {
+	out := make([]Set, 0, len(sets))
+	for _, s := range sets {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Get returns the template with the given name.
+func Get(name string) (Template, bool) {
+	t, ok := byName[name]
+	return t, ok
+}
+
+// Resolve expands template and set names into the templates to provision,
+// including every template they reference, ordered so that references come
+// before the templates using them where possible (self and mutual references
+// are fine since all tables are created before any column).
+func Resolve(names ...string) ([]Template, error) {
+	var out []Template
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(n string) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		t := byName[n]
+		for _, c := range t.Columns {
+			if c.References != "" {
+				visit(c.References)
+			}
+		}
+		out = append(out, t)
+	}
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if s, ok := sets[n]; ok {
+			for _, m := range s.Templates {
+				visit(m)
+			}
+			continue
+		}
+		if _, ok := byName[n]; !ok {
+			return nil, fmt.Errorf("unknown template or set %q", n)
+		}
+		visit(n)
+	}
+	return out, nil
+}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// Defaults of Options fields left zero.
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxAttempts  = 8
+	DefaultBatchSize    = 20
+)
+
+// Options tune a Dispatcher.
+type Options struct {
+	PollInterval time.Duration // how often to look for due deliveries
+	Timeout      time.Duration // per request
+	MaxAttempts  int           // attempts before a delivery is dead
+	BatchSize    int           // deliveries claimed, and attempted concurrently, at once
+}
+
+// Dispatcher attempts due webhook deliveries of every org.
+type Dispatcher struct {
+	repo   repo.Repo
+	opts   Options
+	client *http.Client
+}
+
+// NewDispatcher returns a Dispatcher using r, which must not be bound to an
+// org.
+func NewDispatcher(r repo.Repo, opts Options) *Dispatcher {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Dispatcher{
+		repo: r,
+		opts: opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// A redirect is reported as a failure rather than followed, so a
+			// signed payload only ever goes to the configured URL.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run dispatches due deliveries every PollInterval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	slog.InfoContext(ctx, "webhook dispatcher started", "poll_interval", d.opts.PollInterval.String())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := d.DispatchDue(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "webhook dispatch failed", "err", err)
+				}
+				// A full batch suggests a backlog; keep going without waiting.
+				if err != nil || n < d.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DispatchDue claims one batch of due deliveries, attempts them and
+// reports how many were claimed.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	// The lease outlives the request, so a delivery is only attempted again
+	// if this process died before recording the outcome.
+	claimed, err := d.repo.ClaimWebhookDeliveries(ctx, d.opts.BatchSize, d.opts.Timeout+time.Minute)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func(c models.ClaimedJob) {
+			defer wg.Done()
+			d.attempt(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+	return len(claimed), nil
+}
+
+// attempt delivers one claimed delivery and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, c models.ClaimedJob) {
+	ctx = repo.WithOrg(ctx, c.OrgID)
+	a, found, err := d.repo.GetWebhookAttempt(ctx, c.OrgID, c.ID)
+	if err != nil || !found {
+		return
+	}
+	if !a.Active {
+		d.record(ctx, c, models.DeliveryDead, 0, "webhook is disabled", time.Now())
+		return
+	}
+	status, err := d.post(ctx, a)
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		d.record(ctx, c, models.DeliveryDelivered, status, "", time.Now())
+		return
+	case err == nil:
+		err = fmt.Errorf("unexpected response %d %s", status, http.StatusText(status))
+	}
+	slog.WarnContext(ctx, "webhook delivery failed", "delivery_id", c.ID, "webhook_id", a.WebhookID.String(),
+		"attempt", a.Attempts, "err", err)
+	if a.Attempts >= d.opts.MaxAttempts {
+		d.record(ctx, c, models.DeliveryDead, status, err.Error(), time.Now())
+		return
+	}
+	d.record(ctx, c, models.DeliveryPending, status, err.Error(), time.Now().Add(Backoff(a.Attempts)))
+}
+
+// post sends the signed payload and returns the response status.
+func (d *Dispatcher) post(ctx context.Context, a models.WebhookAttempt) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(a.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "yourapp-webhooks/1")
+	req.Header.Set(HeaderWebhook, a.WebhookID.String())
+	req.Header.Set(HeaderEvent, a.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(a.DeliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(a.Secret, ts, a.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(ctx context.Context, c models.ClaimedJob, status string, httpStatus int, msg string, next time.Time) {
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	// Record even when ctx was cancelled mid-request, so the attempt counts.
+	ctx = context.WithoutCancel(ctx)
+	if err := d.repo.RecordWebhookAttempt(ctx, c.OrgID, c.ID, status, httpStatus, msg, next); err != nil {
+		slog.ErrorContext(ctx, "record webhook attempt failed", "delivery_id", c.ID, "err", err)
+	}
+}
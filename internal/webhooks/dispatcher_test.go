@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// delivery is a queued delivery of outboxRepo.
+type delivery struct {
+	models.WebhookAttempt
+	orgID      uuid.UUID
+	status     string
+	httpStatus int
+	lastError  string
+	next       time.Time
+}
+
+// outboxRepo keeps webhook deliveries in memory, claiming them like
+// ClaimWebhookDeliveries: due pending ones, counting the attempt and
+// leasing them. Any other method panics through the nil embedded Repo.
+type outboxRepo struct {
+	repo.Repo
+	mu         sync.Mutex
+	deliveries map[int64]*delivery
+}
+
+func (m *outboxRepo) ClaimWebhookDeliveries(_ context.Context, limit int, lease time.Duration) ([]models.ClaimedJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.ClaimedJob
+	for id, d := range m.deliveries {
+		if len(out) < limit && d.status == models.DeliveryPending && !d.next.After(time.Now()) {
+			d.Attempts++
+			d.next = time.Now().Add(lease)
+			out = append(out, models.ClaimedJob{ID: id, OrgID: d.orgID})
+		}
+	}
+	return out, nil
+}
+
+func (m *outboxRepo) GetWebhookAttempt(_ context.Context, orgID uuid.UUID, id int64) (models.WebhookAttempt, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok || d.orgID != orgID {
+		return models.WebhookAttempt{}, false, nil
+	}
+	return d.WebhookAttempt, true, nil
+}
+
+func (m *outboxRepo) RecordWebhookAttempt(_ context.Context, _ uuid.UUID, id int64, status string, httpStatus int, errMsg string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.deliveries[id]
+	d.status, d.httpStatus, d.lastError, d.next = status, httpStatus, errMsg, next
+	return nil
+}
+
+func (m *outboxRepo) get(id int64) delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.deliveries[id]
+}
+
+// due makes a delivery's retry due now.
+func (m *outboxRepo) due(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[id].next = time.Time{}
+}
+
+// receiver answers deliveries with the statuses given in turn, repeating
+// the last, and fails the test on requests that don't verify.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	statuses []int
+	mu       sync.Mutex
+	requests int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !Verify(rc.secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, 5*time.Minute) {
+		rc.t.Errorf("delivery %s did not verify", r.Header.Get(HeaderDelivery))
+	}
+	if r.Header.Get(HeaderEvent) != "row.created" || r.Header.Get("Content-Type") != "application/json" {
+		rc.t.Errorf("headers = %v", r.Header)
+	}
+	rc.mu.Lock()
+	status := rc.statuses[min(rc.requests, len(rc.statuses)-1)]
+	rc.requests++
+	rc.mu.Unlock()
+	if status == http.StatusFound {
+		w.Header().Set("Location", "/elsewhere")
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests
+}
+
+// outbox returns a dispatcher with one delivery queued to a receiver
+// answering statuses.
+func outbox(t *testing.T, maxAttempts int, statuses ...int) (*Dispatcher, *outboxRepo, *receiver) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	m := &outboxRepo{deliveries: map[int64]*delivery{
+		1: {
+			WebhookAttempt: models.WebhookAttempt{
+				DeliveryID: 1, WebhookID: uuid.New(), Active: true, URL: srv.URL + "/hook",
+				Secret: rc.secret, Event: "row.created", Payload: []byte(`{"type":"row.created"}`),
+			},
+			orgID:  uuid.New(),
+			status: models.DeliveryPending,
+		},
+	}}
+	return NewDispatcher(m, Options{MaxAttempts: maxAttempts, Timeout: 5 * time.Second}), m, rc
+}
+
+// dispatch runs one round and checks one delivery was claimed.
+func dispatch(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	n, err := d.DispatchDue(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("DispatchDue = %d, %v; want 1 claimed", n, err)
+	}
+}
+
+func TestDispatchRetriesThenDelivers(t *testing.T) {
+	d, m, rc := outbox(t, 5, http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+
+	for i, want := range []int{http.StatusInternalServerError, http.StatusBadGateway} {
+		start := time.Now()
+		dispatch(t, d)
+		got := m.get(1)
+		if got.status != models.DeliveryPending || got.httpStatus != want {
+			t.Fatalf("attempt %d: %s %d, want pending %d", i+1, got.status, got.httpStatus, want)
+		}
+		if got.lastError != "unexpected response "+strconv.Itoa(want)+" "+http.StatusText(want) {
+			t.Errorf("attempt %d: error = %q", i+1, got.lastError)
+		}
+		if wait := got.next.Sub(start); wait < Backoff(i+1) || wait > Backoff(i+1)+time.Second {
+			t.Errorf("attempt %d: retry in %s, want %s", i+1, wait, Backoff(i+1))
+		}
+		// Not due before the backoff passed
+		if n, _ := d.DispatchDue(context.Background()); n != 0 {
+			t.Fatalf("attempt %d: retried %d before the backoff", i+1, n)
+		}
+		m.due(1)
+	}
+
+	dispatch(t, d)
+	if got := m.get(1); got.status != models.DeliveryDelivered || got.httpStatus != http.StatusNoContent || got.Attempts != 3 {
+		t.Errorf("after 3 attempts: %s %d in %d attempts, want delivered 204 in 3", got.status, got.httpStatus, got.Attempts)
+	}
+	if n, _ := d.DispatchDue(context.Background()); n != 0 || rc.count() != 3 {
+		t.Errorf("delivered delivery attempted again: %d claimed, %d requests", n, rc.count())
+	}
+}
+
+func TestDispatchDeadAfterMaxAttempts(t *testing.T) {
+	d, m, rc := outbox(t, 3, http.StatusServiceUnavailable)
+	for attempt := 1; attempt <= 3; attempt++ {
+		dispatch(t, d)
+		want := models.DeliveryPending
+		if attempt == 3 {
+			want = models.DeliveryDead
+		}
+		if got := m.get(1); got.status != want {
+			t.Fatalf("attempt %d: %s, want %s", attempt, got.status, want)
+		}
+		m.due(1)
+	}
+	if n, _ := d.DispatchDue(context.Background()); n != 0 || rc.count() != 3 {
+		t.Errorf("dead delivery attempted again: %d claimed, %d requests", n, rc.count())
+	}
+	if got := m.get(1); got.httpStatus != http.StatusServiceUnavailable {
+		t.Errorf("dead delivery status = %d, want 503", got.httpStatus)
+	}
+}
+
+func TestDispatchRedirectFails(t *testing.T) {
+	d, m, rc := outbox(t, 3, http.StatusFound)
+	dispatch(t, d)
+	if got := m.get(1); got.status != models.DeliveryPending || got.httpStatus != http.StatusFound || rc.count() != 1 {
+		t.Errorf("redirect: %s %d after %d requests, want pending 302 after 1", got.status, got.httpStatus, rc.count())
+	}
+}
+
+func TestDispatchInactiveWebhook(t *testing.T) {
+	d, m, rc := outbox(t, 3, http.StatusOK)
+	m.deliveries[1].Active = false
+	dispatch(t, d)
+	if got := m.get(1); got.status != models.DeliveryDead || got.lastError != "webhook is disabled" || rc.count() != 0 {
+		t.Errorf("disabled webhook: %s %q after %d requests, want dead without a request", got.status, got.lastError, rc.count())
+	}
+}
@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"row.created","data":{"title":"Pump"}}`)
+	now := time.Now().Unix()
+	ts := strconv.FormatInt(now, 10)
+	sig := Sign(secret, now, body)
+	if !strings.HasPrefix(sig, "sha256=") || len(sig) != len("sha256=")+64 {
+		t.Fatalf("Sign = %q, want sha256= and 64 hex digits", sig)
+	}
+	if Sign(secret, now, body) != sig {
+		t.Error("Sign is not deterministic")
+	}
+
+	stale := strconv.FormatInt(now-600, 10)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		tolerance time.Duration
+		want      bool
+	}{
+		{"genuine", secret, ts, sig, string(body), 5 * time.Minute, true},
+		{"no age check", secret, stale, Sign(secret, now-600, body), string(body), 0, true},
+		{"tampered body", secret, ts, sig, strings.Replace(string(body), "Pump", "Pipe", 1), 5 * time.Minute, false},
+		{"body with a trailing newline", secret, ts, sig, string(body) + "\n", 5 * time.Minute, false},
+		{"other secret", "whsec_other", ts, sig, string(body), 5 * time.Minute, false},
+		{"timestamp changed", secret, strconv.FormatInt(now+1, 10), sig, string(body), 5 * time.Minute, false},
+		{"stale timestamp", secret, stale, Sign(secret, now-600, body), string(body), 5 * time.Minute, false},
+		{"future timestamp", secret, strconv.FormatInt(now+600, 10), Sign(secret, now+600, body), string(body), 5 * time.Minute, false},
+		{"invalid timestamp", secret, "yesterday", sig, string(body), 5 * time.Minute, false},
+		{"signature without prefix", secret, ts, strings.TrimPrefix(sig, "sha256="), string(body), 5 * time.Minute, false},
+		{"signature in upper case", secret, ts, strings.ToUpper(sig), string(body), 5 * time.Minute, false},
+		{"empty signature", secret, ts, "", string(body), 5 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), tt.tolerance); got != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if !strings.HasPrefix(a, secretPrefix) || len(a) != len(secretPrefix)+48 || a == b {
+		t.Errorf("NewSecret = %q, %q", a, b)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{-1, 30 * time.Second},
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{12, 6 * time.Hour},
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package workflow
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"yourapp/internal/formula"
+	"yourapp/internal/models"
+)
+
+// maxTransitions bounds the transitions of one machine.
+const maxTransitions = 100
+
+// Compile validates a state machine against the columns of its table and
+// compiles its formulas, filling in the SQL, WhenSQL and Refs fields and
+// spelling column names as the schema does. Errors are messages for the
+// client.
+func Compile(m *models.StateMachine, schema []models.TableColumn) error {
+	byName := make(map[string]models.TableColumn, len(schema))
+	cols := make(map[string]formula.Type, len(schema))
+	for _, c := range schema {
+		byName[strings.ToLower(c.Name)] = c
+		if t, ok := formula.TypeOfColumn(c.Type); ok {
+			cols[strings.ToLower(c.Name)] = t
+		}
+	}
+	col, ok := byName[strings.ToLower(strings.TrimSpace(m.Column))]
+	if !ok {
+		return fmt.Errorf("column %q not found", m.Column)
+	}
+	if col.Type != "enum" || (col.Kind != "" && col.Kind != "value") {
+		return fmt.Errorf("%s is not an enum value column", col.Name)
+	}
+	m.Column = col.Name
+	refs := []string{strings.ToLower(col.Name)}
+	ref := func(names ...string) {
+		for _, n := range names {
+			if n = strings.ToLower(n); !slices.Contains(refs, n) {
+				refs = append(refs, n)
+			}
+		}
+	}
+	state := func(s, where string) error {
+		if !slices.Contains(col.EnumValues, s) {
+			return fmt.Errorf("%s: %q is not a value of %s", where, s, col.Name)
+		}
+		return nil
+	}
+
+	initial := make([]string, 0, len(m.Initial))
+	for _, s := range m.Initial {
+		if err := state(s, "initial"); err != nil {
+			return err
+		}
+		if !slices.Contains(initial, s) {
+			initial = append(initial, s)
+		}
+	}
+	m.Initial = initial
+
+	if len(m.Transitions) == 0 || len(m.Transitions) > maxTransitions {
+		return fmt.Errorf("between 1 and %d transitions are required", maxTransitions)
+	}
+	for i := range m.Transitions {
+		t := &m.Transitions[i]
+		where := "transition " + strconv.Itoa(i+1)
+		if err := state(t.To, where); err != nil {
+			return err
+		}
+		if len(t.From) == 0 {
+			return fmt.Errorf("%s: from needs at least one state, or %q for any", where, models.AnyState)
+		}
+		for _, s := range t.From {
+			if s == models.AnyState {
+				continue
+			}
+			if err := state(s, where); err != nil {
+				return err
+			}
+		}
+		for _, role := range t.Roles {
+			switch role {
+			case models.RoleViewer, models.RoleMember, models.RoleAdmin, models.RoleOwner:
+			default:
+				return fmt.Errorf("%s: unknown role %q", where, role)
+			}
+		}
+	}
+
+	for name, rules := range m.States {
+		where := "state " + name
+		if err := state(name, where); err != nil {
+			return err
+		}
+		for i := range rules.Required {
+			f := &rules.Required[i]
+			c, ok := byName[strings.ToLower(strings.TrimSpace(f.Field))]
+			if !ok {
+				return fmt.Errorf("%s: required field %q is not a column", where, f.Field)
+			}
+			f.Field = c.Name
+			f.When, f.WhenSQL = strings.TrimSpace(f.When), ""
+			ref(c.Name)
+			if f.When == "" {
+				continue
+			}
+			compiled, err := formula.CompileAutomationCondition(f.When, cols)
+			if err != nil {
+				return fmt.Errorf("%s: invalid condition for %s: %v", where, c.Name, err)
+			}
+			f.WhenSQL = compiled.SQL
+			ref(compiled.Refs...)
+		}
+		set := make(map[string]string, len(rules.Set))
+		rules.SQL = make(map[string]string, len(rules.Set))
+		for name, expr := range rules.Set {
+			c, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+			if !ok || (c.Kind != "" && c.Kind != "value") {
+				return fmt.Errorf("%s: %q is not a value column", where, name)
+			}
+			if c.Name == col.Name {
+				return fmt.Errorf("%s: the state column cannot be set", where)
+			}
+			compiled, err := formula.CompileAutomationValue(expr, cols)
+			if err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %v", where, c.Name, err)
+			}
+			if want := cols[strings.ToLower(c.Name)]; compiled.Type != want && compiled.Type != formula.TypeNull {
+				return fmt.Errorf("%s: %s is a %s column, the value is a %s", where, c.Name, want, compiled.Type)
+			}
+			set[c.Name] = strings.TrimSpace(expr)
+			rules.SQL[c.Name] = compiled.SQL
+			ref(c.Name)
+			ref(compiled.Refs...)
+		}
+		rules.Set = set
+		m.States[name] = rules
+	}
+	if m.States == nil {
+		m.States = map[string]models.StateRules{}
+	}
+	m.Refs = refs
+	return nil
+}
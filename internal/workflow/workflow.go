@@ -0,0 +1,384 @@
+// Package workflow enforces the state machines of user tables
+// (app.state_machines) on the row writes of API callers.
+//
+// A change that sets a machine's column moves the row from one state to
+// another: the move must be an allowed transition, the caller's org role
+// one of those the transition names, and the fields the new state requires
+// must have values. Entering a state also stamps the fields its rules set,
+// e.g. completed_on = today(), unless the change sets them itself. New rows
+// must start in one of the initial states, or are put in the first one when
+// they don't name a state. Automations are not bound by state machines.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"yourapp/internal/models"
+	"yourapp/internal/repo"
+)
+
+// ErrNoMachine is returned by Transition for a column without a state
+// machine.
+var ErrNoMachine = errors.New("no state machine")
+
+// ErrUnchanged is returned by Transition when the row already is in the
+// requested state.
+var ErrUnchanged = errors.New("row already is in that state")
+
+// Error reports a change a state machine does not allow.
+type Error struct {
+	Column    string
+	New       bool   // the row is being created
+	From      string // "" for rows without a state
+	To        string
+	Allowed   []string // the states the row may move to instead
+	Forbidden bool     // the transition exists, but not for the caller's role
+	Missing   []string // fields the new state requires
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Forbidden:
+		return fmt.Sprintf("your role may not change %s from %s to %s", e.Column, e.From, e.To)
+	case len(e.Missing) > 0:
+		return fmt.Sprintf("%s %s requires %s", e.Column, e.To, strings.Join(e.Missing, ", "))
+	case e.New:
+		return fmt.Sprintf("rows cannot be created with %s %s", e.Column, e.To)
+	case e.To == "":
+		return fmt.Sprintf("%s cannot be cleared", e.Column)
+	case e.From == "":
+		return fmt.Sprintf("%s cannot be set to %s", e.Column, e.To)
+	}
+	return fmt.Sprintf("%s cannot change from %s to %s", e.Column, e.From, e.To)
+}
+
+// State is the state of a row in one machine and where the caller may move
+// it from there.
+type State struct {
+	Column string   `json:"column"`
+	State  *string  `json:"state"`
+	Next   []string `json:"next"`
+}
+
+// Apply checks a change userID makes to a row against the state machines
+// of its table and returns the values to write: the given ones plus the
+// stamps of the states entered. rowID is uuid.Nil for a new row, userID
+// uuid.Nil for changes made by the system. Updates of rows
+// the caller cannot see are passed through, for the write to report them
+// not found. Call it inside InTx, before automations.InsertRow or
+// UpdateRow.
+func Apply(ctx context.Context, tx repo.Repo, orgID, userID uuid.UUID, tableID int64, rowID uuid.UUID, values map[string]any) (map[string]any, error) {
+	machines, err := tx.ListStateMachines(ctx, orgID, tableID)
+	if err != nil || len(machines) == 0 {
+		return values, err
+	}
+	current, found, err := snapshot(ctx, tx, orgID, rowID)
+	if err != nil || !found {
+		return values, err
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	return apply(ctx, tx, orgID, userID, machines, rowID != uuid.Nil, current, values)
+}
+
+// Transition moves a row to state to in the machine of column, with values
+// to write along, and returns the values to write as Apply does. An empty
+// column names the table's only machine. found is false when the caller
+// cannot see the row.
+func Transition(ctx context.Context, tx repo.Repo, orgID, userID uuid.UUID, tableID int64, rowID uuid.UUID, column, to string, values map[string]any) (map[string]any, bool, error) {
+	machines, err := tx.ListStateMachines(ctx, orgID, tableID)
+	if err != nil {
+		return nil, false, err
+	}
+	m, ok := pick(machines, column)
+	if !ok {
+		return nil, false, ErrNoMachine
+	}
+	current, found, err := snapshot(ctx, tx, orgID, rowID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	if state, _ := current[m.Column].(string); state == to {
+		return nil, true, ErrUnchanged
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	values[m.Column] = to
+	values, err = apply(ctx, tx, orgID, userID, machines, true, current, values)
+	return values, true, err
+}
+
+// States returns the state of a row in each machine of its table and the
+// states userID may move it to; found is false when the caller cannot
+// see the row. Required fields are not considered.
+func States(ctx context.Context, r repo.Repo, orgID, userID uuid.UUID, tableID int64, rowID uuid.UUID) ([]State, bool, error) {
+	data, found, err := r.GetRowData(ctx, orgID, rowID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	machines, err := r.ListStateMachines(ctx, orgID, tableID)
+	if err != nil {
+		return nil, false, err
+	}
+	role, err := roleOf(ctx, r, orgID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]State, 0, len(machines))
+	for _, m := range machines {
+		v, seen := data[m.Column]
+		if !seen {
+			// Hidden from the caller by a field access rule
+			continue
+		}
+		st := State{Column: m.Column, Next: []string{}}
+		if s, ok := v.(string); ok {
+			st.State = &s
+		}
+		for _, t := range m.Transitions {
+			if st.State != nil && t.To != *st.State && from(t, *st.State) && permits(t, role) && !slices.Contains(st.Next, t.To) {
+				st.Next = append(st.Next, t.To)
+			}
+		}
+		out = append(out, st)
+	}
+	return out, true, nil
+}
+
+// snapshot returns the unmasked data of a row the caller can see, an empty
+// map for new rows.
+func snapshot(ctx context.Context, tx repo.Repo, orgID, rowID uuid.UUID) (map[string]any, bool, error) {
+	current := map[string]any{}
+	if rowID == uuid.Nil {
+		return current, true, nil
+	}
+	if _, visible, err := tx.GetRowData(ctx, orgID, rowID); err != nil || !visible {
+		return nil, false, err
+	}
+	b, exists, err := tx.RowSnapshot(ctx, orgID, rowID)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(b, &current); err != nil {
+		return nil, false, err
+	}
+	return current, true, nil
+}
+
+// entry is a state a change enters.
+type entry struct {
+	m     models.StateMachine
+	rules models.StateRules
+	to    string
+}
+
+func apply(ctx context.Context, tx repo.Repo, orgID, userID uuid.UUID, machines []models.StateMachine, update bool, current, values map[string]any) (map[string]any, error) {
+	var role models.OrgRole
+	var roleLoaded bool
+	var entered []entry
+	for _, m := range machines {
+		v, set := values[m.Column]
+		if !update && !set && len(m.Initial) > 0 {
+			v, set = m.Initial[0], true
+			values[m.Column] = v
+		}
+		if !set {
+			continue
+		}
+		to, _ := v.(string)
+		prev, _ := current[m.Column].(string)
+		if update && to == prev {
+			continue
+		}
+		if !update {
+			if to != "" && len(m.Initial) > 0 && !slices.Contains(m.Initial, to) {
+				return nil, &Error{Column: m.Column, New: true, To: to, Allowed: m.Initial}
+			}
+		} else {
+			t, ok := transition(m, prev, to)
+			if !ok {
+				return nil, &Error{Column: m.Column, From: prev, To: to, Allowed: targets(m, prev)}
+			}
+			if len(t.Roles) > 0 {
+				if !roleLoaded {
+					var err error
+					if role, err = roleOf(ctx, tx, orgID, userID); err != nil {
+						return nil, err
+					}
+					roleLoaded = true
+				}
+				if !permits(t, role) {
+					return nil, &Error{Column: m.Column, From: prev, To: to, Forbidden: true}
+				}
+			}
+		}
+		if to != "" {
+			entered = append(entered, entry{m: m, rules: m.States[to], to: to})
+		}
+	}
+	if len(entered) == 0 {
+		return values, nil
+	}
+
+	// Stamps, then the required fields over the row they complete.
+	row := merge(current, values)
+	stamps := map[string]string{}
+	for _, e := range entered {
+		for col, sql := range e.rules.SQL {
+			if _, set := values[col]; !set {
+				stamps[col] = sql
+			}
+		}
+	}
+	if len(stamps) > 0 {
+		set, err := eval(ctx, tx, row, current, update, stamps)
+		if err != nil {
+			return nil, err
+		}
+		for col, v := range set {
+			values[col] = v
+		}
+		row = merge(current, values)
+	}
+	conds := map[string]string{}
+	for i, e := range entered {
+		for j, f := range e.rules.Required {
+			if f.WhenSQL != "" {
+				conds[strconv.Itoa(i)+"."+strconv.Itoa(j)] = f.WhenSQL
+			}
+		}
+	}
+	var applies map[string]any
+	if len(conds) > 0 {
+		var err error
+		if applies, err = eval(ctx, tx, row, current, update, conds); err != nil {
+			return nil, err
+		}
+	}
+	for i, e := range entered {
+		var missing []string
+		for j, f := range e.rules.Required {
+			if f.WhenSQL != "" && applies[strconv.Itoa(i)+"."+strconv.Itoa(j)] != true {
+				continue
+			}
+			if empty(row[f.Field]) {
+				missing = append(missing, f.Field)
+			}
+		}
+		if len(missing) > 0 {
+			prev, _ := current[e.m.Column].(string)
+			return nil, &Error{Column: e.m.Column, New: !update, From: prev, To: e.to, Missing: missing}
+		}
+	}
+	return values, nil
+}
+
+// eval evaluates compiled expressions over the row after and before the
+// change.
+func eval(ctx context.Context, tx repo.Repo, row, current map[string]any, update bool, exprs map[string]string) (map[string]any, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	var previous []byte
+	if update {
+		if previous, err = json.Marshal(current); err != nil {
+			return nil, err
+		}
+	}
+	return tx.EvalRowExprs(ctx, data, previous, exprs)
+}
+
+// pick returns the machine of column, or the only one when column is "".
+func pick(machines []models.StateMachine, column string) (models.StateMachine, bool) {
+	if column == "" {
+		if len(machines) == 1 {
+			return machines[0], true
+		}
+		return models.StateMachine{}, false
+	}
+	for _, m := range machines {
+		if strings.EqualFold(m.Column, column) {
+			return m, true
+		}
+	}
+	return models.StateMachine{}, false
+}
+
+// transition returns the transition of m from one state to another.
+func transition(m models.StateMachine, prev, to string) (models.StateTransition, bool) {
+	if to == "" {
+		return models.StateTransition{}, false
+	}
+	for _, t := range m.Transitions {
+		if t.To == to && from(t, prev) {
+			return t, true
+		}
+	}
+	return models.StateTransition{}, false
+}
+
+// targets lists the states m allows moving to from prev.
+func targets(m models.StateMachine, prev string) []string {
+	out := []string{}
+	for _, t := range m.Transitions {
+		if t.To != prev && from(t, prev) && !slices.Contains(out, t.To) {
+			out = append(out, t.To)
+		}
+	}
+	return out
+}
+
+// from reports whether t leaves from state; rows without a state only
+// leave through AnyState.
+func from(t models.StateTransition, state string) bool {
+	for _, f := range t.From {
+		if f == models.AnyState || (f == state && state != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// permits reports whether role may make t. Callers without a role act for
+// the system and may make every transition.
+func permits(t models.StateTransition, role models.OrgRole) bool {
+	return len(t.Roles) == 0 || role == "" || role == models.RoleOwner || slices.Contains(t.Roles, role)
+}
+
+// roleOf returns the org role of a user, "" for the system.
+func roleOf(ctx context.Context, r repo.Repo, orgID, userID uuid.UUID) (models.OrgRole, error) {
+	if userID == uuid.Nil {
+		return "", nil
+	}
+	return r.GetRole(ctx, orgID, userID)
+}
+
+func merge(current, values map[string]any) map[string]any {
+	out := make(map[string]any, len(current)+len(values))
+	maps.Copy(out, current)
+	maps.Copy(out, values)
+	return out
+}
+
+// empty reports whether a required field has no value.
+func empty(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(x) == ""
+	}
+	return false
+}
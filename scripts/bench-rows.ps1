@@ -0,0 +1,9 @@
+# scripts/bench-rows.ps1
+# Times per-row against set-based row composition on seeded data (changes are rolled back).
+#   .\scripts\bench-rows.ps1 [-Rows 50000] [-Iterations 3]
+param([int]$Rows = 50000, [int]$Iterations = 3)
+$ErrorActionPreference = "Stop"
+if (-not $env:DATABASE_URL) { Write-Error "DATABASE_URL is not set. Run:  . ./scripts/env.ps1" }
+
+$sql = Resolve-Path (Join-Path $PSScriptRoot "..\database\bench\row_materialisation.sql")
+psql "$env:DATABASE_URL" -v ON_ERROR_STOP=1 -v rows=$Rows -v iterations=$Iterations -f "$sql"
@@ -0,0 +1,7 @@
+# scripts/test-rls.ps1
+# Runs the org isolation checks against the database (changes are rolled back).
+$ErrorActionPreference = "Stop"
+if (-not $env:DATABASE_URL) { Write-Error "DATABASE_URL is not set. Run:  . ./scripts/env.ps1" }
+
+$sql = Resolve-Path (Join-Path $PSScriptRoot "..\database\tests\rls_isolation.sql")
+psql "$env:DATABASE_URL" -v ON_ERROR_STOP=1 -f "$sql"
@@ -0,0 +1,12 @@
+# scripts/test-sql.ps1
+# Runs the SQL checks of database/tests against the database (changes are rolled back).
+$ErrorActionPreference = "Stop"
+if (-not $env:DATABASE_URL) { Write-Error "DATABASE_URL is not set. Run:  . ./scripts/env.ps1" }
+
+$env:TEST_DATABASE_URL = $env:DATABASE_URL
+Push-Location (Join-Path $PSScriptRoot "..")
+try {
+  go test -count=1 -v ./database/tests
+} finally {
+  Pop-Location
+}